@@ -25,7 +25,10 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
 	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
+	"github.com/hyperledger/firefly-ethconnect/internal/migrate"
 	"github.com/hyperledger/firefly-ethconnect/internal/rest"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 	"github.com/icza/dyno"
@@ -44,6 +47,7 @@ type ServerConfig struct {
 	Webhooks     map[string]*rest.RESTGatewayConf  `json:"webhooks"`
 	RESTGateways map[string]*rest.RESTGatewayConf  `json:"rest"`
 	Plugins      PluginConfig                      `json:"plugins"`
+	Solc         eth.SolcConf                      `json:"solc"`
 }
 
 func initLogging(debugLevel int) {
@@ -77,8 +81,13 @@ var rootConfig struct {
 	DebugLevel int
 	DebugPort  int
 	PrintYAML  bool
+	KLDCompat  bool
 }
 
+// solcConfig limits the Solidity compilations of the single command that is run.
+// It is shared by everything in the process that compiles Solidity
+var solcConfig eth.SolcConf
+
 var serverCmdConfig struct {
 	Filename string
 	Type     string
@@ -90,6 +99,10 @@ var rootCmd = &cobra.Command{
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		initLogging(rootConfig.DebugLevel)
 
+		if rootConfig.KLDCompat {
+			migrate.EnableCompatibilityMode()
+		}
+
 		if rootConfig.DebugPort > 0 {
 			go func() {
 				log.Debugf("Debug HTTP endpoint listening on localhost:%d: %s", rootConfig.DebugPort, http.ListenAndServe(fmt.Sprintf("localhost:%d", rootConfig.DebugPort), nil))
@@ -169,7 +182,7 @@ func startServer() (err error) {
 	anyRoutineFinished := make(chan bool)
 	var dontPrintYaml = false
 	for name, conf := range serverConfig.KafkaBridges {
-		kafkaBridge := kafka.NewKafkaBridge(&dontPrintYaml)
+		kafkaBridge := kafka.NewKafkaBridge(&dontPrintYaml, &serverConfig.Solc)
 		kafkaBridge.SetConf(conf)
 		if err := kafkaBridge.ValidateConf(); err != nil {
 			return err
@@ -190,7 +203,7 @@ func startServer() (err error) {
 		serverConfig.RESTGateways[name] = conf
 	}
 	for name, conf := range serverConfig.RESTGateways {
-		restGateway := rest.NewRESTGateway(&dontPrintYaml)
+		restGateway := rest.NewRESTGateway(&dontPrintYaml, &serverConfig.Solc)
 		restGateway.SetConf(conf)
 		if err := restGateway.ValidateConf(); err != nil {
 			return err
@@ -214,16 +227,24 @@ func init() {
 	rootCmd.PersistentFlags().IntVarP(&rootConfig.DebugLevel, "debug", "d", 1, "0=error, 1=info, 2=debug")
 	rootCmd.PersistentFlags().IntVarP(&rootConfig.DebugPort, "debugPort", "Z", 6060, "Port for pprof HTTP endpoints (localhost only)")
 	rootCmd.PersistentFlags().BoolVarP(&rootConfig.PrintYAML, "print-yaml-confg", "Y", false, "Print YAML config snippet and exit")
+	rootCmd.PersistentFlags().BoolVarP(&rootConfig.KLDCompat, "kld-compat", "", false, "Use the kld- query parameters and x-kaleido- headers of legacy releases")
 
 	serverCmd := initServer()
 	rootCmd.AddCommand(serverCmd)
 
-	kafkaBridge := kafka.NewKafkaBridge(&rootConfig.PrintYAML)
-	rootCmd.AddCommand(kafkaBridge.CobraInit())
+	kafkaBridge := kafka.NewKafkaBridge(&rootConfig.PrintYAML, &solcConfig)
+	restGateway := rest.NewRESTGateway(&rootConfig.PrintYAML, &solcConfig)
+	for _, bridgeCmd := range []*cobra.Command{
+		kafkaBridge.CobraInit(),
+		restGateway.CobraInit("webhooks"), // for backwards compatibility
+		restGateway.CobraInit("rest"),
+	} {
+		eth.CobraInitSolc(bridgeCmd, &solcConfig)
+		rootCmd.AddCommand(bridgeCmd)
+	}
 
-	restGateway := rest.NewRESTGateway(&rootConfig.PrintYAML)
-	rootCmd.AddCommand(restGateway.CobraInit("webhooks")) // for backwards compatibility
-	rootCmd.AddCommand(restGateway.CobraInit("rest"))
+	rootCmd.AddCommand(migrate.NewMigrator().CobraInit())
+	rootCmd.AddCommand(events.NewEventsBackupTool().CobraInit())
 }
 
 // Execute is called by the main method of the package
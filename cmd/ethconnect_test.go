@@ -149,6 +149,35 @@ func TestExecuteServerWithYAML(t *testing.T) {
 	assert.Equal(0, osExit)
 }
 
+func TestReadServerConfigSolc(t *testing.T) {
+	assert := assert.New(t)
+
+	exampleConfYAML, _ := ioutil.TempFile("", "testYAML")
+	defer syscall.Unlink(exampleConfYAML.Name())
+	ioutil.WriteFile(exampleConfYAML.Name(), []byte(
+		"solc:\n"+
+			"  timeoutSec: 5\n"+
+			"  maxConcurrent: 2\n"+
+			"rest:\n"+
+			"  rbridge1:\n"+
+			"    http:\n"+
+			"      port: 1234\n"), 0644)
+
+	serverCmdConfig.Filename = exampleConfYAML.Name()
+	serverCmdConfig.Type = "yaml"
+	defer func() { serverCmdConfig.Filename = "" }()
+	serverConfig, err := readServerConfig()
+	assert.NoError(err)
+	assert.Equal(5, serverConfig.Solc.TimeoutSec)
+	assert.Equal(2, serverConfig.Solc.MaxConcurrent)
+
+	for _, name := range []string{"kafka", "rest", "webhooks"} {
+		cmd, _, err := rootCmd.Find([]string{name})
+		assert.NoError(err)
+		assert.NotNil(cmd.Flags().Lookup("solc-timeout"), name)
+	}
+}
+
 func TestExecuteServerWithJSON(t *testing.T) {
 	assert := assert.New(t)
 
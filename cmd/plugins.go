@@ -19,6 +19,7 @@ import (
 
 	"github.com/hyperledger/firefly-ethconnect/internal/auth"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/identifiers"
 	"github.com/hyperledger/firefly-ethconnect/pkg/plugins"
 	log "github.com/sirupsen/logrus"
 )
@@ -26,12 +27,18 @@ import (
 // PluginConfig is the JSON configuration for loading plugins
 type PluginConfig struct {
 	SecurityModulePlugin string `json:"securityModule"`
+	// AddressResolverPlugins are the paths of the plugins that resolve identifiers supplied for
+	// address parameters, keyed by the identifier scheme they resolve, such as "did:web"
+	AddressResolverPlugins map[string]string `json:"addressResolvers,omitempty"`
 }
 
 func loadPlugins(conf *PluginConfig) error {
 	if err := loadSecurityModulePlugin(conf); err != nil {
 		return err
 	}
+	if err := loadAddressResolverPlugins(conf); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -56,3 +63,22 @@ func loadSecurityModulePlugin(conf *PluginConfig) error {
 	auth.RegisterSecurityModule(*smSymbol.(*plugins.SecurityModule))
 	return nil
 }
+
+func loadAddressResolverPlugins(conf *PluginConfig) error {
+
+	for scheme, modulePath := range conf.AddressResolverPlugins {
+		log.Debugf("Loading AddressResolver plugin '%s' for '%s'", modulePath, scheme)
+		arPlugin, err := plugin.Open(modulePath)
+		if err != nil {
+			return errors.Errorf(errors.SecurityModulePluginLoad, err)
+		}
+
+		arSymbol, err := arPlugin.Lookup("AddressResolver")
+		if err != nil || arSymbol == nil {
+			return errors.Errorf(errors.AddressResolverPluginSymbol, modulePath, err)
+		}
+
+		identifiers.RegisterResolver(scheme, *arSymbol.(*plugins.AddressResolver))
+	}
+	return nil
+}
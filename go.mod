@@ -1,9 +1,11 @@
 module github.com/hyperledger/firefly-ethconnect
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/Shopify/sarama v1.30.0
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
 	github.com/dsnet/compress v0.0.1 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/globalsign/mgo v0.0.0-20181015135952-eeefdecb41b8
 	github.com/go-openapi/jsonreference v0.19.6
 	github.com/go-openapi/spec v0.20.4
@@ -12,9 +14,11 @@ require (
 	github.com/icza/dyno v0.0.0-20210726202311-f1bafe5d9996
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/kaleido-io/ethbinding v0.0.0-20220104211806-1a198c06124a
+	github.com/lib/pq v1.10.9
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
 	github.com/mholt/archiver v3.1.1+incompatible
+	github.com/nats-io/nats.go v1.11.0
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d
 	github.com/nwaples/rardecode v1.1.2 // indirect
 	github.com/oklog/ulid/v2 v2.0.2
@@ -36,6 +36,11 @@ func RegisterSecurityModule(sm plugins.SecurityModule) {
 	securityModule = sm
 }
 
+// IsSecurityModuleRegistered checks if a security module has been registered, so requests are authenticated
+func IsSecurityModuleRegistered() bool {
+	return securityModule != nil
+}
+
 // NewSystemAuthContext creates a system background context
 func NewSystemAuthContext() context.Context {
 	return context.WithValue(context.Background(), ContextKeySystemAuth, true)
@@ -134,3 +139,32 @@ func AuthReadAsyncReplyByUUID(ctx context.Context) error {
 	}
 	return nil
 }
+
+// AuthWebSocket authorize the upgrade of a connection to a WebSocket
+func AuthWebSocket(ctx context.Context) error {
+	if securityModule != nil && !IsSystemContext(ctx) {
+		authCtx := GetAuthContext(ctx)
+		if authCtx == nil {
+			return errors.Errorf(errors.SecurityModuleNoAuthContext)
+		}
+		if wsm, ok := securityModule.(plugins.WebSocketSecurityModule); ok {
+			return wsm.AuthWebSocket(authCtx)
+		}
+	}
+	return nil
+}
+
+// AuthWebSocketTopic authorize a WebSocket connection listening on a topic
+func AuthWebSocketTopic(ctx context.Context, topic string) error {
+	if securityModule != nil && !IsSystemContext(ctx) {
+		authCtx := GetAuthContext(ctx)
+		if authCtx == nil {
+			return errors.Errorf(errors.SecurityModuleNoAuthContext)
+		}
+		if wsm, ok := securityModule.(plugins.WebSocketSecurityModule); ok {
+			return wsm.AuthWebSocketTopic(authCtx, topic)
+		}
+		return securityModule.AuthEventStreams(authCtx)
+	}
+	return nil
+}
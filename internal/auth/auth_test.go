@@ -39,8 +39,10 @@ func TestAccessToken(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal("", GetAccessToken(ctx))
 	assert.Equal(nil, GetAuthContext(ctx))
+	assert.False(IsSecurityModuleRegistered())
 
 	RegisterSecurityModule(&authtest.TestSecurityModule{})
+	assert.True(IsSecurityModuleRegistered())
 
 	ctx, err = WithAuthContext(context.Background(), "testat")
 	assert.NoError(err)
@@ -147,3 +149,51 @@ func TestAuthReadAsyncReplyByUUID(t *testing.T) {
 	RegisterSecurityModule(nil)
 
 }
+
+func TestAuthWebSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(AuthWebSocket(context.Background()))
+
+	RegisterSecurityModule(&authtest.TestSecurityModule{})
+
+	assert.Regexp("No auth context", AuthWebSocket(context.Background()))
+
+	assert.NoError(AuthWebSocket(NewSystemAuthContext()))
+
+	ctx, _ := WithAuthContext(context.Background(), "testat")
+	assert.NoError(AuthWebSocket(ctx))
+
+	RegisterSecurityModule(&authtest.TestWebSocketSecurityModule{})
+
+	ctx, _ = WithAuthContext(context.Background(), "testat")
+	assert.NoError(AuthWebSocket(ctx))
+	assert.Regexp("badness", AuthWebSocket(context.WithValue(context.Background(), ContextKeyAuthContext, 12345)))
+
+	RegisterSecurityModule(nil)
+
+}
+
+func TestAuthWebSocketTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(AuthWebSocketTopic(context.Background(), "anything"))
+
+	RegisterSecurityModule(&authtest.TestSecurityModule{})
+
+	assert.Regexp("No auth context", AuthWebSocketTopic(context.Background(), "anything"))
+
+	assert.NoError(AuthWebSocketTopic(NewSystemAuthContext(), "anything"))
+
+	ctx, _ := WithAuthContext(context.Background(), "testat")
+	assert.NoError(AuthWebSocketTopic(ctx, "anything"))
+
+	RegisterSecurityModule(&authtest.TestWebSocketSecurityModule{})
+
+	ctx, _ = WithAuthContext(context.Background(), "testat")
+	assert.NoError(AuthWebSocketTopic(ctx, "testtopic"))
+	assert.Regexp("badness", AuthWebSocketTopic(ctx, "anything"))
+
+	RegisterSecurityModule(nil)
+
+}
@@ -77,3 +77,28 @@ func (sm *TestSecurityModule) AuthReadAsyncReplyByUUID(authCtx interface{}) erro
 	}
 	return fmt.Errorf("badness")
 }
+
+// TestWebSocketSecurityModule designed for unit testing - adds the optional WebSocket authorization checks
+type TestWebSocketSecurityModule struct {
+	TestSecurityModule
+}
+
+// AuthWebSocket of TEST MODULE returns true if there is an auth context
+func (sm *TestWebSocketSecurityModule) AuthWebSocket(authCtx interface{}) error {
+	switch authCtx.(type) {
+	case string:
+		return nil
+	}
+	return fmt.Errorf("badness")
+}
+
+// AuthWebSocketTopic of TEST MODULE checks if a topic matches a fixed string
+func (sm *TestWebSocketSecurityModule) AuthWebSocketTopic(authCtx interface{}, topic string) error {
+	switch authCtx.(type) {
+	case string:
+		if topic == "testtopic" {
+			return nil
+		}
+	}
+	return fmt.Errorf("badness")
+}
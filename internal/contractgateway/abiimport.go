@@ -0,0 +1,372 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+const (
+	// ABIImportSourceEtherscan fetches verified contracts from an Etherscan compatible API
+	ABIImportSourceEtherscan = "etherscan"
+	// ABIImportSourceSourcify fetches verified contracts from a Sourcify repository
+	ABIImportSourceSourcify = "sourcify"
+
+	defaultEtherscanURL = "https://api.etherscan.io/api"
+	defaultSourcifyURL  = "https://repo.sourcify.dev"
+	defaultChainID      = 1
+	maxABIImportSize    = 20 * 1024 * 1024
+	maxABIImportHops    = 10
+)
+
+// ABIImportConf configures the defaults for importing verified ABIs, which can be
+// overridden on each request. Requests can only use an apiURL on one of the allowed hosts
+type ABIImportConf struct {
+	EtherscanURL    string   `json:"etherscanURL,omitempty"`
+	EtherscanAPIKey string   `json:"etherscanAPIKey,omitempty"`
+	SourcifyURL     string   `json:"sourcifyURL,omitempty"`
+	ChainID         uint64   `json:"chainId,omitempty"`
+	AllowedHosts    []string `json:"allowedHosts,omitempty"`
+}
+
+// abiImportRequest is the body of a POST /abis/import
+type abiImportRequest struct {
+	Address  string `json:"address"`
+	Source   string `json:"source"`
+	ChainID  uint64 `json:"chainId,omitempty"`
+	APIURL   string `json:"apiURL,omitempty"`
+	APIKey   string `json:"apiKey,omitempty"`
+	Register string `json:"register,omitempty"`
+}
+
+// abiImportResult is the reply to a POST /abis/import, including the contract
+// if the instance was registered
+type abiImportResult struct {
+	ABI      *contractregistry.ABIInfo      `json:"abi"`
+	Contract *contractregistry.ContractInfo `json:"contract,omitempty"`
+}
+
+// verifiedContract is the ABI and metadata fetched from a source
+type verifiedContract struct {
+	ABI             ethbinding.ABIMarshaling
+	ContractName    string
+	CompilerVersion string
+	DevDoc          string
+}
+
+type etherscanResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type etherscanSourceCode struct {
+	ABI             string `json:"ABI"`
+	ContractName    string `json:"ContractName"`
+	CompilerVersion string `json:"CompilerVersion"`
+}
+
+type sourcifyMetadata struct {
+	Compiler struct {
+		Version string `json:"version"`
+	} `json:"compiler"`
+	Output struct {
+		ABI    ethbinding.ABIMarshaling `json:"abi"`
+		DevDoc json.RawMessage          `json:"devdoc"`
+	} `json:"output"`
+	Settings struct {
+		CompilationTarget map[string]string `json:"compilationTarget"`
+	} `json:"settings"`
+}
+
+type abiImporter struct {
+	conf            *ABIImportConf
+	allowPrivateIPs bool
+	client          *http.Client
+	overrideClient  *http.Client
+}
+
+func newABIImporter(conf *ABIImportConf, allowPrivateIPs bool) *abiImporter {
+	defaults := *conf
+	if defaults.EtherscanURL == "" {
+		defaults.EtherscanURL = defaultEtherscanURL
+	}
+	if defaults.SourcifyURL == "" {
+		defaults.SourcifyURL = defaultSourcifyURL
+	}
+	if defaults.ChainID == 0 {
+		defaults.ChainID = defaultChainID
+	}
+	i := &abiImporter{
+		conf:            &defaults,
+		allowPrivateIPs: allowPrivateIPs,
+		client:          &http.Client{Timeout: 30 * time.Second},
+	}
+	i.overrideClient = &http.Client{Timeout: 30 * time.Second, CheckRedirect: i.checkRedirect}
+	return i
+}
+
+// checkOverride checks the apiURL of a request is on one of the allowed hosts, and is not a
+// private address, as the gateway sends the request on behalf of the caller
+func (i *abiImporter) checkOverride(apiURL string) (int, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return 400, errors.Errorf(errors.RESTGatewayABIImportInvalidRequest, err)
+	}
+	if len(i.conf.AllowedHosts) == 0 {
+		return 403, errors.Errorf(errors.RESTGatewayABIImportURLNotAllowed, u.Hostname(), "no hosts are allowed for apiURL")
+	}
+	if _, err := events.ResolveWebhookAddress(i.allowPrivateIPs, i.conf.AllowedHosts, u); err != nil {
+		return 403, errors.Errorf(errors.RESTGatewayABIImportURLNotAllowed, u.Hostname(), err)
+	}
+	return 200, nil
+}
+
+// checkRedirect applies the checks of checkOverride to each redirect of a request to an apiURL
+// from the caller, so an allowed host cannot redirect the gateway to any other address
+func (i *abiImporter) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxABIImportHops {
+		return fmt.Errorf("stopped after %d redirects", maxABIImportHops)
+	}
+	if _, err := events.ResolveWebhookAddress(i.allowPrivateIPs, i.conf.AllowedHosts, req.URL); err != nil {
+		return errors.Errorf(errors.RESTGatewayABIImportURLNotAllowed, req.URL.Hostname(), err)
+	}
+	return nil
+}
+
+// fetch retrieves the verified ABI and metadata for the address in the request
+func (i *abiImporter) fetch(r *abiImportRequest) (*verifiedContract, int, error) {
+	addrCheck, _ := regexp.Compile("^(0x)?[0-9a-fA-F]{40}$")
+	if !addrCheck.MatchString(r.Address) {
+		return nil, 400, errors.Errorf(errors.RESTGatewayABIImportInvalidRequest, "address must be a 40 character hex string")
+	}
+	switch strings.ToLower(r.Source) {
+	case ABIImportSourceEtherscan:
+		return i.fetchEtherscan(r)
+	case ABIImportSourceSourcify:
+		return i.fetchSourcify(r)
+	default:
+		return nil, 400, errors.Errorf(errors.RESTGatewayABIImportUnknownSource, r.Source)
+	}
+}
+
+// get sends a request to the source, reading at most maxABIImportSize of the response.
+// Redirects are checked against the allowed hosts if the URL is an override from the caller
+func (i *abiImporter) get(source, u string, override bool) ([]byte, int, error) {
+	log.Infof("ABI import: GET --> %s", source)
+	client := i.client
+	if override {
+		client = i.overrideClient
+	}
+	res, err := client.Get(u)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, res.Body, maxABIImportSize))
+	log.Infof("ABI import: GET <-- %s [%d]", source, res.StatusCode)
+	return body, res.StatusCode, err
+}
+
+func (i *abiImporter) fetchEtherscan(r *abiImportRequest) (*verifiedContract, int, error) {
+	// The configured API key is only sent to the configured API
+	apiURL := i.conf.EtherscanURL
+	apiKey := i.conf.EtherscanAPIKey
+	override := r.APIURL != "" && r.APIURL != apiURL
+	if override {
+		if status, err := i.checkOverride(r.APIURL); err != nil {
+			return nil, status, err
+		}
+		apiURL = r.APIURL
+		apiKey = ""
+	}
+	if r.APIKey != "" {
+		apiKey = r.APIKey
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, 400, errors.Errorf(errors.RESTGatewayABIImportInvalidRequest, err)
+	}
+	q := u.Query()
+	q.Set("module", "contract")
+	q.Set("action", "getsourcecode")
+	q.Set("address", r.Address)
+	if apiKey != "" {
+		q.Set("apikey", apiKey)
+	}
+	u.RawQuery = q.Encode()
+
+	body, status, err := i.get(ABIImportSourceEtherscan, u.String(), override)
+	if err == nil && status != 200 {
+		err = fmt.Errorf("status=%d", status)
+	}
+	var esRes etherscanResponse
+	if err == nil {
+		err = json.Unmarshal(body, &esRes)
+	}
+	if err == nil && esRes.Status != "1" {
+		// The result is a string describing the error, such as an invalid API key
+		err = fmt.Errorf("%s: %s", esRes.Message, esRes.Result)
+	}
+	var results []etherscanSourceCode
+	if err == nil {
+		err = json.Unmarshal(esRes.Result, &results)
+	}
+	if err == nil && len(results) == 0 {
+		err = fmt.Errorf("no result")
+	}
+	if err != nil {
+		return nil, 502, errors.Errorf(errors.RESTGatewayABIImportFetchFailed, r.Address, ABIImportSourceEtherscan, err)
+	}
+
+	// Unverified contracts are returned with a message in place of the ABI
+	var abi ethbinding.ABIMarshaling
+	if err := json.Unmarshal([]byte(results[0].ABI), &abi); err != nil {
+		return nil, 404, errors.Errorf(errors.RESTGatewayABIImportNotVerified, r.Address, ABIImportSourceEtherscan)
+	}
+	return &verifiedContract{
+		ABI:             abi,
+		ContractName:    results[0].ContractName,
+		CompilerVersion: results[0].CompilerVersion,
+	}, 200, nil
+}
+
+func (i *abiImporter) fetchSourcify(r *abiImportRequest) (*verifiedContract, int, error) {
+	repoURL := i.conf.SourcifyURL
+	override := r.APIURL != "" && r.APIURL != repoURL
+	if override {
+		if status, err := i.checkOverride(r.APIURL); err != nil {
+			return nil, status, err
+		}
+		repoURL = r.APIURL
+	}
+	chainID := r.ChainID
+	if chainID == 0 {
+		chainID = i.conf.ChainID
+	}
+	// Sourcify stores contracts under their checksum address. We prefer a full
+	// match, where the metadata hash also matches, to a partial match
+	addr := ethbind.API.HexToAddress(r.Address).Hex()
+	var body []byte
+	var err error
+	for _, match := range []string{"full_match", "partial_match"} {
+		u := fmt.Sprintf("%s/contracts/%s/%d/%s/metadata.json", strings.TrimSuffix(repoURL, "/"), match, chainID, addr)
+		var status int
+		body, status, err = i.get(ABIImportSourceSourcify, u, override)
+		if err == nil && status == 200 {
+			break
+		}
+		if err == nil && status != 404 {
+			err = fmt.Errorf("status=%d", status)
+		}
+		if err != nil {
+			return nil, 502, errors.Errorf(errors.RESTGatewayABIImportFetchFailed, r.Address, ABIImportSourceSourcify, err)
+		}
+		body = nil
+	}
+	if body == nil {
+		return nil, 404, errors.Errorf(errors.RESTGatewayABIImportNotVerified, r.Address, ABIImportSourceSourcify)
+	}
+
+	var metadata sourcifyMetadata
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, 502, errors.Errorf(errors.RESTGatewayABIImportFetchFailed, r.Address, ABIImportSourceSourcify, err)
+	}
+	vc := &verifiedContract{
+		ABI:             metadata.Output.ABI,
+		CompilerVersion: metadata.Compiler.Version,
+	}
+	for _, contractName := range metadata.Settings.CompilationTarget {
+		vc.ContractName = contractName
+	}
+	if len(metadata.Output.DevDoc) > 0 {
+		vc.DevDoc = string(metadata.Output.DevDoc)
+	}
+	return vc, 200, nil
+}
+
+// importABI handles POST /abis/import, to fetch a verified ABI from a public source,
+// store it, and optionally register the contract instance at the address
+func (g *smartContractGW) importABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var importReq abiImportRequest
+	if err := json.NewDecoder(req.Body).Decode(&importReq); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayABIImportInvalidRequest, err), 400)
+		return
+	}
+	if importReq.Register == "" {
+		importReq.Register = getFlyParam("register", req)
+	}
+
+	vc, status, err := g.abiImporter.fetch(&importReq)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, status)
+		return
+	}
+
+	msg := &messages.DeployContract{}
+	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.Headers.ID = utils.UUIDv4()
+	msg.ABI = vc.ABI
+	msg.ContractName = vc.ContractName
+	msg.CompilerVersion = vc.CompilerVersion
+	msg.DevDoc = vc.DevDoc
+	// The name is checked before storing the ABI, so a clash does not leave an orphaned ABI behind
+	if importReq.Register != "" {
+		if err := g.cs.CheckNameAvailable(importReq.Register, false); err != nil {
+			g.gatewayErrReply(res, req, err, registrationErrStatus(err))
+			return
+		}
+	}
+	result := &abiImportResult{}
+	if result.ABI, err = g.storeDeployableABI(msg, nil); err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status = 200
+	if importReq.Register != "" {
+		addrHexNo0x := strings.ToLower(strings.TrimPrefix(importReq.Address, "0x"))
+		if result.Contract, err = g.cs.AddContract(addrHexNo0x, result.ABI.ID, importReq.Register, importReq.Register, nil); err != nil {
+			g.gatewayErrReply(res, req, err, registrationErrStatus(err))
+			return
+		}
+		status = 201
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(result)
+}
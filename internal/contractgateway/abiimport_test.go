@@ -0,0 +1,349 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+)
+
+const testImportABI = `[{"type":"function","name":"set","inputs":[{"name":"x","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"}]`
+
+const testImportAddress = "0x0123456789abcdef0123456789abcdef01234567"
+
+func newTestABIImportGateway(t *testing.T, conf *ABIImportConf) (*httprouter.Router, func()) {
+	dir := tempdir()
+	scgw, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			SubscriptionManagerConf: events.SubscriptionManagerConf{WebhooksAllowPrivateIPs: true},
+			StoragePath:             dir,
+			BaseURL:                 "http://localhost/api/v1",
+			ABIImport:               *conf,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	assert.NoError(t, err)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	return router, func() { cleanup(dir) }
+}
+
+func postABIImport(router *httprouter.Router, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/abis/import", bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	return res, reply
+}
+
+func TestImportABIEtherscanAndRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("getsourcecode", req.URL.Query().Get("action"))
+		assert.Regexp("^0x[0-9a-f]{40}$", req.URL.Query().Get("address"))
+		assert.Equal("mykey", req.URL.Query().Get("apikey"))
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"status":  "1",
+			"message": "OK",
+			"result": []map[string]string{
+				{"ABI": testImportABI, "ContractName": "Store", "CompilerVersion": "v0.8.7+commit.e28d00a7"},
+			},
+		})
+	}))
+	defer svr.Close()
+	router, done := newTestABIImportGateway(t, &ABIImportConf{EtherscanURL: svr.URL, EtherscanAPIKey: "mykey"})
+	defer done()
+
+	res, reply := postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","register":"store1"}`)
+	assert.Equal(201, res.Code)
+	abi := reply["abi"].(map[string]interface{})
+	assert.Equal("Store", abi["name"])
+	assert.Equal("v0.8.7+commit.e28d00a7", abi["compilerVersion"])
+	contract := reply["contract"].(map[string]interface{})
+	assert.Equal("/contracts/store1", contract["path"])
+	assert.Equal(abi["id"], contract["abi"])
+
+	req := httptest.NewRequest("GET", "/abis/"+abi["id"].(string), nil)
+	getRes := httptest.NewRecorder()
+	router.ServeHTTP(getRes, req)
+	assert.Equal(200, getRes.Code)
+
+	// The name cannot be registered again for a different address
+	res, reply = postABIImport(router, `{"address":"0x1123456789abcdef0123456789abcdef01234567","source":"etherscan","register":"store1"}`)
+	assert.Equal(409, res.Code)
+	assert.Regexp("already registered for name 'store1'", reply["error"])
+
+	// The ABI of the rejected import is not stored
+	req = httptest.NewRequest("GET", "/abis", nil)
+	getRes = httptest.NewRecorder()
+	router.ServeHTTP(getRes, req)
+	var abis []map[string]interface{}
+	json.NewDecoder(getRes.Body).Decode(&abis)
+	assert.Equal(1, len(abis))
+}
+
+func TestImportABIEtherscanNotVerified(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"status":  "1",
+			"message": "OK",
+			"result":  []map[string]string{{"ABI": "Contract source code not verified"}},
+		})
+	}))
+	defer svr.Close()
+	router, done := newTestABIImportGateway(t, &ABIImportConf{AllowedHosts: []string{"127.0.0.1"}})
+	defer done()
+
+	res, reply := postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","apiURL":"`+svr.URL+`"}`)
+	assert.Equal(404, res.Code)
+	assert.Regexp("Contract 0x0123456789abcdef0123456789abcdef01234567 is not verified on etherscan", reply["error"])
+}
+
+func TestImportABIEtherscanErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	status := 200
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"status":  "0",
+			"message": "NOTOK",
+			"result":  "Invalid API Key",
+		})
+	}))
+	defer svr.Close()
+	router, done := newTestABIImportGateway(t, &ABIImportConf{EtherscanURL: svr.URL})
+	defer done()
+
+	res, reply := postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan"}`)
+	assert.Equal(502, res.Code)
+	assert.Regexp("Failed to fetch the verified ABI.*NOTOK: \"Invalid API Key\"", reply["error"])
+
+	status = 500
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan"}`)
+	assert.Equal(502, res.Code)
+	assert.Regexp("status=500", reply["error"])
+
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","apiURL":":bad"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid ABI import request", reply["error"])
+}
+
+func TestImportABISourcifyPartialMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var paths []string
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		if req.URL.Path != "/contracts/partial_match/5/0x0123456789abcDEF0123456789abCDef01234567/metadata.json" {
+			res.WriteHeader(404)
+			return
+		}
+		res.Write([]byte(`{
+			"compiler": {"version": "0.8.7+commit.e28d00a7"},
+			"output": {"abi": ` + testImportABI + `, "devdoc": {"kind": "dev", "methods": {}}},
+			"settings": {"compilationTarget": {"contracts/Store.sol": "Store"}}
+		}`))
+	}))
+	defer svr.Close()
+	router, done := newTestABIImportGateway(t, &ABIImportConf{SourcifyURL: svr.URL})
+	defer done()
+
+	res, reply := postABIImport(router, `{"address":"`+testImportAddress+`","source":"Sourcify","chainId":5}`)
+	assert.Equal(200, res.Code)
+	assert.Len(paths, 2)
+	assert.Regexp("/full_match/", paths[0])
+	abi := reply["abi"].(map[string]interface{})
+	assert.Equal("Store", abi["name"])
+	assert.Equal("0.8.7+commit.e28d00a7", abi["compilerVersion"])
+	assert.Nil(reply["contract"])
+}
+
+func TestImportABISourcifyErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	status := 404
+	body := ""
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+		res.Write([]byte(body))
+	}))
+	defer svr.Close()
+	router, done := newTestABIImportGateway(t, &ABIImportConf{SourcifyURL: svr.URL, AllowedHosts: []string{"localhost"}})
+	defer done()
+
+	res, reply := postABIImport(router, `{"address":"`+testImportAddress+`","source":"sourcify"}`)
+	assert.Equal(404, res.Code)
+	assert.Regexp("is not verified on sourcify", reply["error"])
+
+	status = 503
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"sourcify"}`)
+	assert.Equal(502, res.Code)
+	assert.Regexp("status=503", reply["error"])
+
+	status = 200
+	body = "!json"
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"sourcify"}`)
+	assert.Equal(502, res.Code)
+	assert.Regexp("Failed to fetch the verified ABI", reply["error"])
+
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"sourcify","apiURL":"http://localhost:0"}`)
+	assert.Equal(502, res.Code)
+	assert.Regexp("Failed to fetch the verified ABI", reply["error"])
+}
+
+func TestImportABIOverrideNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	configured := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Fail("configured API called")
+	}))
+	defer configured.Close()
+	var apiKeys []string
+	override := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		apiKeys = append(apiKeys, req.URL.Query().Get("apikey"))
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"status":  "1",
+			"message": "OK",
+			"result":  []map[string]string{{"ABI": testImportABI, "ContractName": "Store"}},
+		})
+	}))
+	defer override.Close()
+
+	router, done := newTestABIImportGateway(t, &ABIImportConf{EtherscanURL: configured.URL, EtherscanAPIKey: "mykey"})
+	defer done()
+	res, reply := postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","apiURL":"`+override.URL+`"}`)
+	assert.Equal(403, res.Code)
+	assert.Regexp("Cannot import an ABI from '127.0.0.1': no hosts are allowed", reply["error"])
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"sourcify","apiURL":"`+override.URL+`"}`)
+	assert.Equal(403, res.Code)
+	assert.Regexp("Cannot import an ABI from", reply["error"])
+	done()
+
+	router, done = newTestABIImportGateway(t, &ABIImportConf{EtherscanURL: configured.URL, EtherscanAPIKey: "mykey", AllowedHosts: []string{"api.example.com"}})
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","apiURL":"`+override.URL+`"}`)
+	assert.Equal(403, res.Code)
+	assert.Regexp("not in the list of allowed hosts", reply["error"])
+	done()
+
+	// The configured API key is not sent to an allowed override, but the key of the request is
+	router, done = newTestABIImportGateway(t, &ABIImportConf{EtherscanURL: configured.URL, EtherscanAPIKey: "mykey", AllowedHosts: []string{"127.0.0.1"}})
+	defer done()
+	res, _ = postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","apiURL":"`+override.URL+`"}`)
+	assert.Equal(200, res.Code)
+	res, _ = postABIImport(router, `{"address":"`+testImportAddress+`","source":"etherscan","apiURL":"`+override.URL+`","apiKey":"theirkey"}`)
+	assert.Equal(200, res.Code)
+	assert.Equal([]string{"", "theirkey"}, apiKeys)
+}
+
+func TestImportABIOverridePrivateIP(t *testing.T) {
+	assert := assert.New(t)
+	i := newABIImporter(&ABIImportConf{AllowedHosts: []string{"127.0.0.1"}}, false)
+	status, err := i.checkOverride("http://127.0.0.1:8545")
+	assert.Equal(403, status)
+	assert.Regexp("FFEC100399.*Cannot send Webhook POST to address", err)
+}
+
+func TestImportABIOverrideRedirect(t *testing.T) {
+	assert := assert.New(t)
+	target := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"status":  "1",
+			"message": "OK",
+			"result":  []map[string]string{{"ABI": testImportABI, "ContractName": "Store"}},
+		})
+	}))
+	defer target.Close()
+	var redirectTo string
+	redirector := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Redirect(res, req, redirectTo, http.StatusFound)
+	}))
+	defer redirector.Close()
+	i := newABIImporter(&ABIImportConf{AllowedHosts: []string{"127.0.0.1"}}, true)
+
+	// Each redirect must be to an allowed host
+	redirectTo = strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	_, status, err := i.fetch(&abiImportRequest{Address: testImportAddress, Source: "etherscan", APIURL: redirector.URL})
+	assert.Equal(502, status)
+	assert.Regexp("Cannot import an ABI from 'localhost'.*not in the list of allowed hosts", err)
+
+	redirectTo = target.URL
+	vc, status, err := i.fetch(&abiImportRequest{Address: testImportAddress, Source: "etherscan", APIURL: redirector.URL})
+	assert.NoError(err)
+	assert.Equal(200, status)
+	assert.Equal("Store", vc.ContractName)
+
+	// And not to a private address
+	i.allowPrivateIPs = false
+	err = i.checkRedirect(httptest.NewRequest("GET", target.URL, nil), nil)
+	assert.Regexp("Cannot send Webhook POST to address", err)
+	err = i.checkRedirect(httptest.NewRequest("GET", target.URL, nil), make([]*http.Request, maxABIImportHops))
+	assert.Regexp("stopped after 10 redirects", err)
+}
+
+func TestImportABIResponseTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write(make([]byte, maxABIImportSize+1))
+	}))
+	defer svr.Close()
+	i := newABIImporter(&ABIImportConf{SourcifyURL: svr.URL}, true)
+
+	_, status, err := i.fetch(&abiImportRequest{Address: testImportAddress, Source: "sourcify"})
+	assert.Equal(502, status)
+	assert.Regexp("Failed to fetch the verified ABI.*too large", err)
+}
+
+func TestImportABIBadRequests(t *testing.T) {
+	assert := assert.New(t)
+	router, done := newTestABIImportGateway(t, &ABIImportConf{})
+	defer done()
+
+	res, reply := postABIImport(router, `!json`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid ABI import request", reply["error"])
+
+	res, reply = postABIImport(router, `{"address":"0x12345","source":"etherscan"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("address must be a 40 character hex string", reply["error"])
+
+	res, reply = postABIImport(router, `{"address":"`+testImportAddress+`","source":"other"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Unknown ABI import source 'other'", reply["error"])
+
+	// Other ABI IDs are routed to deploy the contract
+	req := httptest.NewRequest("POST", "/abis/other", bytes.NewReader([]byte(`{}`)))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("No ABI found with ID other", reply["error"])
+}
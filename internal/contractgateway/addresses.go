@@ -0,0 +1,67 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/identifiers"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// resolveAddressInputs replaces the identifiers supplied for an address input, or for the addresses in
+// an array or tuple input, with the addresses they resolve to. Inputs of other types are unchanged
+func resolveAddressInputs(ctx context.Context, argName string, t *ethbinding.ABIType, value interface{}) (interface{}, error) {
+	switch t.T {
+	case ethbinding.AddressTy:
+		if identifier, ok := value.(string); ok {
+			addr, err := identifiers.Resolve(ctx, identifier)
+			if err != nil {
+				return nil, errors.Errorf(errors.RESTGatewayAddressResolveFailed, identifier, argName, err)
+			}
+			return addr, nil
+		}
+	case ethbinding.SliceTy, ethbinding.ArrayTy:
+		if values, ok := value.([]interface{}); ok && t.Elem != nil {
+			resolved := make([]interface{}, len(values))
+			for i, v := range values {
+				var err error
+				if resolved[i], err = resolveAddressInputs(ctx, fmt.Sprintf("%s[%d]", argName, i), t.Elem, v); err != nil {
+					return nil, err
+				}
+			}
+			return resolved, nil
+		}
+	case ethbinding.TupleTy:
+		if fields, ok := value.(map[string]interface{}); ok {
+			resolved := make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				resolved[k] = v
+			}
+			for i, name := range t.TupleRawNames {
+				if v, ok := fields[name]; ok {
+					var err error
+					if resolved[name], err = resolveAddressInputs(ctx, argName+"."+name, t.TupleElems[i], v); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return resolved, nil
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testDIDAddr = "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+
+var testAddressInputsABI = ethbinding.ABIMarshaling{
+	{
+		Type: "function", Name: "balanceOf", StateMutability: "view",
+		Inputs:  []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address"}},
+		Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "balance", Type: "uint256"}},
+	},
+}
+
+func TestResolveAddressInputs(t *testing.T) {
+	assert := assert.New(t)
+
+	args, err := ethbind.API.ABIArgumentsMarshalingToABIArguments([]ethbinding.ABIArgumentMarshaling{
+		{Name: "owner", Type: "address"},
+		{Name: "recipients", Type: "address[]"},
+		{Name: "transfer", Type: "tuple", Components: []ethbinding.ABIArgumentMarshaling{
+			{Name: "to", Type: "address"},
+			{Name: "amount", Type: "uint256"},
+		}},
+		{Name: "amount", Type: "uint256"},
+	})
+	assert.NoError(err)
+
+	did := "did:ethr:" + testDIDAddr
+	v, err := resolveAddressInputs(context.Background(), "owner", &args[0].Type, did)
+	assert.NoError(err)
+	assert.Equal(testDIDAddr, v)
+	v, err = resolveAddressInputs(context.Background(), "owner", &args[0].Type, float64(12345))
+	assert.NoError(err)
+	assert.Equal(float64(12345), v)
+	v, err = resolveAddressInputs(context.Background(), "recipients", &args[1].Type, []interface{}{did, "0x0000000000000000000000000000000000000001"})
+	assert.NoError(err)
+	assert.Equal([]interface{}{testDIDAddr, "0x0000000000000000000000000000000000000001"}, v)
+	v, err = resolveAddressInputs(context.Background(), "transfer", &args[2].Type, map[string]interface{}{"to": did, "amount": "10", "extra": true})
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{"to": testDIDAddr, "amount": "10", "extra": true}, v)
+	v, err = resolveAddressInputs(context.Background(), "amount", &args[3].Type, did)
+	assert.NoError(err)
+	assert.Equal(did, v)
+
+	_, err = resolveAddressInputs(context.Background(), "recipients", &args[1].Type, []interface{}{"did:ethr:bad"})
+	assert.Regexp("FFEC100376.*did:ethr:bad.*recipients\\[0\\]", err)
+	_, err = resolveAddressInputs(context.Background(), "transfer", &args[2].Type, map[string]interface{}{"to": "did:ethr:bad"})
+	assert.Regexp("FFEC100376.*transfer.to", err)
+}
+
+func TestCallMethodWithDID(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", strings.TrimPrefix(to, "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testAddressInputsABI}}, nil)
+
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.MatchedBy(func(tx interface{}) bool {
+		b, _ := json.Marshal(tx)
+		return strings.Contains(string(b), strings.TrimPrefix(testDIDAddr, "0x"))
+	}), "latest").
+		Run(func(args mock.Arguments) {
+			result := args[1].(*string)
+			*result = "0x000000000000000000000000000000000000000000000000000000000001e240"
+		}).
+		Return(nil)
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner=did:ethr:"+testDIDAddr, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Regexp(`"balance": "123456"`, res.Body.String())
+
+	req = httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner=did:ethr:bad", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var reply errors.RESTError
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Failed to resolve 'did:ethr:bad' supplied for parameter 'owner'", reply.Message)
+
+	mockRPC.AssertExpectations(t)
+}
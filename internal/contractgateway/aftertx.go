@@ -0,0 +1,68 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+var txHashCheck = regexp.MustCompile("^0x[0-9a-fA-F]{64}$")
+
+var (
+	// afterTxMaxWait bounds how long a query waits for a transaction, when the request has no shorter timeout
+	afterTxMaxWait = 30 * time.Second
+	// afterTxPollInterval is how often the receipt of the transaction is checked
+	afterTxPollInterval = 250 * time.Millisecond
+)
+
+// waitForAfterTx waits for the transaction supplied as the 'aftertx' param of a query to be mined,
+// so a client reads the state it has just changed. Returns the status to reply with on error
+func (r *rest2eth) waitForAfterTx(req *http.Request) (int, error) {
+	txHash := getFlyParam("aftertx", req)
+	if txHash == "" {
+		return 0, nil
+	}
+	if !txHashCheck.MatchString(txHash) {
+		return 400, errors.Errorf(errors.RESTGatewayAfterTxInvalid, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), txHash)
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(req.Context(), afterTxMaxWait)
+	defer cancel()
+	tx := &eth.Txn{Hash: txHash}
+	for {
+		isMined, err := tx.GetTXReceipt(ctx, r.rpc)
+		if err != nil && ctx.Err() == nil {
+			return 500, err
+		}
+		if isMined {
+			log.Debugf("Transaction %s mined after %.2fs, before query", txHash, time.Since(start).Seconds())
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 408, errors.Errorf(errors.RESTGatewayAfterTxTimeout, time.Since(start).Seconds(), txHash)
+		case <-time.After(afterTxPollInterval):
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testAfterTxHash = "0xe2215336b09f9b5b82e36e1144ed64f40a42e61b68fdaca82549fd98b8531a89"
+
+func newTestAfterTxREST2Eth() (*httprouter.Router, *ethmocks.RPCClient, string) {
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", strings.TrimPrefix(to, "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testAddressInputsABI}}, nil)
+	return router, r.rpc.(*ethmocks.RPCClient), to
+}
+
+func TestCallMethodAfterTx(t *testing.T) {
+	assert := assert.New(t)
+	afterTxPollInterval = 1 * time.Millisecond
+	defer func() { afterTxPollInterval = 250 * time.Millisecond }()
+
+	router, mockRPC, to := newTestAfterTxREST2Eth()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionReceipt", testAfterTxHash).
+		Return(nil).Once()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionReceipt", testAfterTxHash).
+		Run(func(args mock.Arguments) {
+			blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+			args[1].(*eth.TxnReceipt).BlockNumber = &blockNumber
+		}).
+		Return(nil).Once()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Run(func(args mock.Arguments) {
+			*args[1].(*string) = "0x000000000000000000000000000000000000000000000000000000000001e240"
+		}).
+		Return(nil)
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner="+testDIDAddr+"&fly-aftertx="+testAfterTxHash, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Regexp(`"balance": "123456"`, res.Body.String())
+
+	mockRPC.AssertExpectations(t)
+	mockRPC.AssertNumberOfCalls(t, "CallContext", 3)
+}
+
+func TestCallMethodAfterTxTimeout(t *testing.T) {
+	assert := assert.New(t)
+	afterTxPollInterval = 1 * time.Millisecond
+	afterTxMaxWait = 20 * time.Millisecond
+	defer func() {
+		afterTxPollInterval = 250 * time.Millisecond
+		afterTxMaxWait = 30 * time.Second
+	}()
+
+	router, mockRPC, to := newTestAfterTxREST2Eth()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionReceipt", testAfterTxHash).Return(nil)
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner="+testDIDAddr, nil)
+	req.Header.Set("x-firefly-aftertx", testAfterTxHash)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(408, res.Code)
+	var reply errors.RESTError
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Timed out after .*s waiting for transaction "+testAfterTxHash+" to be mined", reply.Message)
+	mockRPC.AssertNotCalled(t, "CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest")
+}
+
+func TestCallMethodAfterTxFail(t *testing.T) {
+	assert := assert.New(t)
+
+	router, mockRPC, to := newTestAfterTxREST2Eth()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionReceipt", testAfterTxHash).Return(fmt.Errorf("pop"))
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner="+testDIDAddr+"&fly-aftertx="+testAfterTxHash, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+	var reply errors.RESTError
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("pop", reply.Message)
+}
+
+func TestCallMethodAfterTxInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	router, _, to := newTestAfterTxREST2Eth()
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner="+testDIDAddr+"&fly-aftertx=0x12345", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var reply errors.RESTError
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Invalid fly-aftertx '0x12345'", reply.Message)
+}
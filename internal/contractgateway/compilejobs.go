@@ -0,0 +1,281 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+)
+
+const (
+	defaultCompileWorkers = 1
+	compileJobQueueLength = 100
+	// Completed jobs are available to query for this long, before they are purged
+	compileJobRetention   = 1 * time.Hour
+	compileWebhookTimeout = 30 * time.Second
+)
+
+const (
+	compileJobQueued    = "queued"
+	compileJobRunning   = "running"
+	compileJobSucceeded = "succeeded"
+	compileJobFailed    = "failed"
+)
+
+// compileFunc performs the compile and store processing for a job, using the
+// extracted files in the directory and the fields of the submitted form
+type compileFunc func(dir string, form url.Values, job *compileJob) (result interface{}, status int, err error)
+
+// compileJobInfo is the status of a background compile job, returned on the REST API
+// and sent to the webhook (if one was supplied) on completion
+type compileJobInfo struct {
+	ID      string      `json:"id"`
+	Status  string      `json:"status"`
+	Stage   string      `json:"stage,omitempty"`
+	Logs    []string    `json:"logs"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Webhook string      `json:"webhook,omitempty"`
+	Created string      `json:"created"`
+	Updated string      `json:"updated"`
+}
+
+type compileJob struct {
+	lock      sync.Mutex
+	info      compileJobInfo
+	dir       string
+	form      url.Values
+	completed time.Time
+}
+
+// compileJobs is a queue of compilations, processed in the background by a fixed
+// number of workers, for projects that take too long to compile within an HTTP request.
+// Webhooks are restricted to the same hosts and addresses as event stream webhooks
+type compileJobs struct {
+	lock            sync.Mutex
+	jobs            map[string]*compileJob
+	queue           chan *compileJob
+	closing         chan struct{}
+	closeOnce       sync.Once
+	compile         compileFunc
+	httpClient      *http.Client
+	allowPrivateIPs bool
+	allowedHosts    []string
+}
+
+func newCompileJobs(workers int, allowPrivateIPs bool, allowedHosts []string, compile compileFunc) *compileJobs {
+	if workers <= 0 {
+		workers = defaultCompileWorkers
+	}
+	cj := &compileJobs{
+		jobs:            make(map[string]*compileJob),
+		queue:           make(chan *compileJob, compileJobQueueLength),
+		closing:         make(chan struct{}),
+		compile:         compile,
+		httpClient:      &http.Client{Timeout: compileWebhookTimeout},
+		allowPrivateIPs: allowPrivateIPs,
+		allowedHosts:    allowedHosts,
+	}
+	for i := 0; i < workers; i++ {
+		go cj.worker()
+	}
+	return cj
+}
+
+// submit queues a job to process the files in the directory, which is then owned
+// by the job and removed once it completes
+func (cj *compileJobs) submit(dir string, form url.Values, webhook string) (*compileJobInfo, int, error) {
+	if webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, 400, errors.Errorf(errors.RESTGatewayCompileJobInvalidWebhook, webhook)
+		}
+		if _, err := events.ResolveWebhookAddress(cj.allowPrivateIPs, cj.allowedHosts, u); err != nil {
+			return nil, 400, err
+		}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	job := &compileJob{
+		info: compileJobInfo{
+			ID:      utils.UUIDv4(),
+			Status:  compileJobQueued,
+			Stage:   compileJobQueued,
+			Logs:    []string{},
+			Webhook: webhook,
+			Created: now,
+			Updated: now,
+		},
+		dir:  dir,
+		form: form,
+	}
+
+	cj.lock.Lock()
+	defer cj.lock.Unlock()
+	cj.purgeExpired()
+	select {
+	case cj.queue <- job:
+	default:
+		return nil, 503, errors.Errorf(errors.RESTGatewayCompileJobQueueFull)
+	}
+	cj.jobs[job.info.ID] = job
+	log.Infof("Compile job %s: queued", job.info.ID)
+	return job.snapshot(), 202, nil
+}
+
+// purgeExpired must be called holding the lock
+func (cj *compileJobs) purgeExpired() {
+	for id, job := range cj.jobs {
+		job.lock.Lock()
+		expired := !job.completed.IsZero() && time.Since(job.completed) > compileJobRetention
+		job.lock.Unlock()
+		if expired {
+			delete(cj.jobs, id)
+		}
+	}
+}
+
+func (cj *compileJobs) get(id string) *compileJobInfo {
+	cj.lock.Lock()
+	defer cj.lock.Unlock()
+	if job, exists := cj.jobs[id]; exists {
+		return job.snapshot()
+	}
+	return nil
+}
+
+func (cj *compileJobs) worker() {
+	for {
+		select {
+		case <-cj.closing:
+			return
+		case job := <-cj.queue:
+			cj.run(job)
+		}
+	}
+}
+
+func (cj *compileJobs) run(job *compileJob) {
+	defer cleanup(job.dir)
+	job.setStatus(compileJobRunning, compileJobRunning)
+	result, _, err := cj.compile(job.dir, job.form, job)
+	job.lock.Lock()
+	if err != nil {
+		job.info.Status = compileJobFailed
+		job.info.Error = err.Error()
+	} else {
+		job.info.Status = compileJobSucceeded
+		job.info.Result = result
+	}
+	job.info.Stage = job.info.Status
+	job.completed = time.Now()
+	job.info.Updated = job.completed.UTC().Format(time.RFC3339)
+	status := job.info.Status
+	job.lock.Unlock()
+	log.Infof("Compile job %s: %s", job.info.ID, status)
+
+	if job.info.Webhook != "" {
+		cj.notify(job)
+	}
+}
+
+// notify sends the final status of the job to the webhook. Failures are
+// only recorded in the logs of the job, as the status can still be polled
+func (cj *compileJobs) notify(job *compileJob) {
+	// The address is checked again, as the host might resolve differently since the job was submitted
+	u, _ := url.Parse(job.info.Webhook)
+	_, err := events.ResolveWebhookAddress(cj.allowPrivateIPs, cj.allowedHosts, u)
+	var res *http.Response
+	if err == nil {
+		b, _ := json.Marshal(job.snapshot())
+		res, err = cj.httpClient.Post(job.info.Webhook, "application/json", bytes.NewReader(b))
+	}
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			err = fmt.Errorf("[%d] %s", res.StatusCode, http.StatusText(res.StatusCode))
+		}
+	}
+	if err != nil {
+		job.logf("Webhook notification failed: %s", err)
+	}
+}
+
+func (cj *compileJobs) close() {
+	cj.closeOnce.Do(func() {
+		close(cj.closing)
+		// Remove the files of any jobs that will not run
+		for {
+			select {
+			case job := <-cj.queue:
+				cleanup(job.dir)
+			default:
+				return
+			}
+		}
+	})
+}
+
+func (j *compileJob) snapshot() *compileJobInfo {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	info := j.info
+	info.Logs = append([]string{}, j.info.Logs...)
+	return &info
+}
+
+func (j *compileJob) setStatus(status, stage string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.Status = status
+	j.info.Stage = stage
+	j.info.Updated = time.Now().UTC().Format(time.RFC3339)
+}
+
+// setStage records the progress of a job. It is safe to call on a nil job,
+// for compilations that run synchronously
+func (j *compileJob) setStage(stage string) {
+	if j == nil {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.Stage = stage
+	j.info.Updated = time.Now().UTC().Format(time.RFC3339)
+}
+
+// logf adds to the logs of a job. It is safe to call on a nil job,
+// for compilations that run synchronously
+func (j *compileJob) logf(format string, args ...interface{}) {
+	if j == nil {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	log.Infof("Compile job %s: %s", j.info.ID, msg)
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.Logs = append(j.info.Logs, msg)
+	j.info.Updated = time.Now().UTC().Format(time.RFC3339)
+}
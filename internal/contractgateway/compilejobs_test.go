@@ -0,0 +1,284 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+)
+
+func newTestCompileJobsGateway(dir string) (SmartContractGateway, *httprouter.Router) {
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			SubscriptionManagerConf: events.SubscriptionManagerConf{WebhooksAllowPrivateIPs: true},
+			StoragePath:             dir,
+			BaseURL:                 "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	return scgw, router
+}
+
+func waitForCompileJob(router *httprouter.Router, id string) *compileJobInfo {
+	for {
+		req := httptest.NewRequest("GET", "/compilejobs/"+id, nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var job compileJobInfo
+		json.NewDecoder(res.Body).Decode(&job)
+		if job.Status == compileJobSucceeded || job.Status == compileJobFailed {
+			return &job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAsyncCompileJobPreCompiledWithWebhook(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	notifications := make(chan *compileJobInfo, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var job compileJobInfo
+		json.NewDecoder(req.Body).Decode(&job)
+		notifications <- &job
+	}))
+	defer webhook.Close()
+
+	scgw, router := newTestCompileJobsGateway(dir)
+	defer scgw.Shutdown()
+
+	b, _ := ioutil.ReadFile(path.Join("..", "..", "test", "simpleevents.solc.output.json"))
+	var contract SolcJson
+	json.Unmarshal(b, &contract)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormField("abi")
+	io.Copy(fw, bytes.NewReader([]byte(contract.ABI)))
+	fw, _ = writer.CreateFormField("bytecode")
+	io.Copy(fw, bytes.NewReader([]byte(contract.Bin)))
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/abis?async&webhook="+url.QueryEscape(webhook.URL), bytes.NewReader(body.Bytes()))
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	var job compileJobInfo
+	json.NewDecoder(res.Body).Decode(&job)
+	assert.NotEmpty(job.ID)
+	assert.Equal(webhook.URL, job.Webhook)
+
+	notified := <-notifications
+	assert.Equal(job.ID, notified.ID)
+	assert.Equal(compileJobSucceeded, notified.Status)
+
+	completed := waitForCompileJob(router, job.ID)
+	assert.Equal(compileJobSucceeded, completed.Stage)
+	assert.NotEmpty(completed.Result.(map[string]interface{})["id"])
+}
+
+func TestAsyncCompileJobFailure(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, router := newTestCompileJobsGateway(dir)
+	defer scgw.Shutdown()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormFile("files", "solidity.sol")
+	io.Copy(fw, bytes.NewReader([]byte(simpleEventsSource())))
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis?async=true&compiler=0.99", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	var job compileJobInfo
+	json.NewDecoder(res.Body).Decode(&job)
+
+	completed := waitForCompileJob(router, job.ID)
+	assert.Equal(compileJobFailed, completed.Status)
+	assert.Regexp("Failed checking solc version", completed.Error)
+	assert.Nil(completed.Result)
+}
+
+func TestAsyncCompileJobBadWebhook(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, router := newTestCompileJobsGateway(dir)
+	defer scgw.Shutdown()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis?async&webhook=ftp://example.com", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Regexp("Invalid webhook URL for compile job notification: ftp://example.com", resBody["error"])
+}
+
+func TestCompileJobsWebhookNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	cj := newCompileJobs(1, false, nil, func(dir string, form url.Values, job *compileJob) (interface{}, int, error) {
+		return nil, 200, nil
+	})
+	defer cj.close()
+	_, status, err := cj.submit(tempdir(), url.Values{}, "http://127.0.0.1:8545")
+	assert.Equal(400, status)
+	assert.Regexp("Cannot send Webhook POST to address: 127.0.0.1", err)
+	_, status, err = cj.submit(tempdir(), url.Values{}, "http://169.254.169.254/latest/meta-data")
+	assert.Equal(400, status)
+	assert.Regexp("Cannot send Webhook POST to address: 169.254.169.254", err)
+
+	cj.allowPrivateIPs = true
+	cj.allowedHosts = []string{"api.example.com"}
+	_, status, err = cj.submit(tempdir(), url.Values{}, "http://127.0.0.1:8545")
+	assert.Equal(400, status)
+	assert.Regexp("Webhook host '127.0.0.1' is not in the list of allowed hosts", err)
+}
+
+func TestCompileJobsWebhookNotAllowedAtNotify(t *testing.T) {
+	assert := assert.New(t)
+
+	cj := newCompileJobs(1, true, nil, func(dir string, form url.Values, job *compileJob) (interface{}, int, error) {
+		return nil, 200, nil
+	})
+	defer cj.close()
+	job := &compileJob{info: compileJobInfo{Webhook: "http://127.0.0.1:0"}}
+	cj.allowPrivateIPs = false
+	cj.notify(job)
+	assert.Regexp("Webhook notification failed: .*Cannot send Webhook POST to address", job.info.Logs[0])
+}
+
+func TestGetCompileJobNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, router := newTestCompileJobsGateway(dir)
+	defer scgw.Shutdown()
+
+	req := httptest.NewRequest("GET", "/compilejobs/unknown", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("Compile job unknown not found", resBody["error"])
+}
+
+func TestCompileJobsQueueFullAndClose(t *testing.T) {
+	assert := assert.New(t)
+
+	blocked := make(chan struct{})
+	started := make(chan struct{}, 1)
+	cj := newCompileJobs(0, true, nil, func(dir string, form url.Values, job *compileJob) (interface{}, int, error) {
+		started <- struct{}{}
+		<-blocked
+		return nil, 200, nil
+	})
+	defer close(blocked)
+
+	_, _, err := cj.submit(tempdir(), url.Values{}, "")
+	assert.NoError(err)
+	<-started
+	var queuedDirs []string
+	for i := 0; i < compileJobQueueLength; i++ {
+		dir := tempdir()
+		queuedDirs = append(queuedDirs, dir)
+		_, _, err = cj.submit(dir, url.Values{}, "")
+		assert.NoError(err)
+	}
+	_, status, err := cj.submit(tempdir(), url.Values{}, "")
+	assert.Equal(503, status)
+	assert.Regexp("The compile job queue is full", err)
+
+	cj.close()
+	for _, dir := range queuedDirs {
+		_, err := os.Stat(dir)
+		assert.True(os.IsNotExist(err))
+	}
+	cj.close()
+}
+
+func TestCompileJobsWebhookFailureAndPurge(t *testing.T) {
+	assert := assert.New(t)
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer webhook.Close()
+
+	cj := newCompileJobs(1, true, nil, func(dir string, form url.Values, job *compileJob) (interface{}, int, error) {
+		job.logf("compiling %s", form.Get("source"))
+		return nil, 400, fmt.Errorf("pop")
+	})
+	defer cj.close()
+
+	info, _, err := cj.submit(tempdir(), url.Values{"source": []string{"test.sol"}}, webhook.URL)
+	assert.NoError(err)
+	var job *compileJobInfo
+	for job == nil || len(job.Logs) < 2 {
+		time.Sleep(10 * time.Millisecond)
+		job = cj.get(info.ID)
+	}
+	assert.Equal(compileJobFailed, job.Status)
+	assert.Equal("pop", job.Error)
+	assert.Equal("compiling test.sol", job.Logs[0])
+	assert.Equal("Webhook notification failed: [500] Internal Server Error", job.Logs[1])
+
+	// Expire the job, and check it is purged on the next submission
+	cj.lock.Lock()
+	cj.jobs[info.ID].lock.Lock()
+	cj.jobs[info.ID].completed = time.Now().Add(-2 * compileJobRetention)
+	cj.jobs[info.ID].lock.Unlock()
+	cj.lock.Unlock()
+	_, _, err = cj.submit(tempdir(), url.Values{}, "")
+	assert.NoError(err)
+	assert.Nil(cj.get(info.ID))
+}
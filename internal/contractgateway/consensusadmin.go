@@ -0,0 +1,176 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const validatorsPath = "/admin/validators"
+
+// ConsensusAdminConf enables the /admin/validators routes, to manage the validators of a
+// Hyperledger Besu QBFT or IBFT 2.0 chain through the gateway. Disabled when Protocol is empty
+type ConsensusAdminConf struct {
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// validatorsInfo is the reply to GET /admin/validators
+type validatorsInfo struct {
+	BlockNumber string   `json:"blockNumber"`
+	Validators  []string `json:"validators"`
+}
+
+func (g *smartContractGW) addConsensusAdminRoutes(router *httprouter.Router) {
+	if g.conf == nil || g.conf.ConsensusAdmin.Protocol == "" {
+		return
+	}
+	router.GET(validatorsPath, g.getValidators)
+	router.GET(validatorsPath+"/votes", g.getValidatorVotes)
+	router.POST(validatorsPath+"/votes", g.proposeValidatorVote)
+	router.DELETE(validatorsPath+"/votes/:address", g.discardValidatorVote)
+}
+
+// withConsensusAdminAuth checks the caller is authorized for the consensus JSON/RPC method before
+// it is called, so an unauthorized request is rejected with a 401 rather than a failed call
+func (g *smartContractGW) withConsensusAdminAuth(res http.ResponseWriter, req *http.Request, method string, args ...interface{}) bool {
+	if err := auth.AuthRPC(req.Context(), g.conf.ConsensusAdmin.Protocol+"_"+method, args...); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return false
+	}
+	return true
+}
+
+// validatorsBlockNumber returns the block number to pass to the node, from a decimal or
+// hex number, or a block tag. The default is the latest block
+func validatorsBlockNumber(s string) (string, error) {
+	switch s {
+	case "":
+		return "latest", nil
+	case "latest", "earliest", "pending":
+		return s, nil
+	}
+	var i big.Int
+	if _, ok := i.SetString(s, 0); !ok || i.Sign() < 0 {
+		return "", errors.Errorf(errors.ConsensusAdminInvalidBlock, s)
+	}
+	return "0x" + i.Text(16), nil
+}
+
+func (g *smartContractGW) getValidators(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	blockNumber, err := validatorsBlockNumber(req.URL.Query().Get("blockNumber"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	if !g.withConsensusAdminAuth(res, req, "getValidatorsByBlockNumber", blockNumber) {
+		return
+	}
+	validators, err := eth.GetValidators(req.Context(), g.r2e.rpc, g.conf.ConsensusAdmin.Protocol, blockNumber)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	g.consensusAdminReply(res, req, 200, &validatorsInfo{BlockNumber: blockNumber, Validators: validators})
+}
+
+func (g *smartContractGW) getValidatorVotes(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if !g.withConsensusAdminAuth(res, req, "getPendingVotes") {
+		return
+	}
+	votes, err := eth.GetValidatorVotes(req.Context(), g.r2e.rpc, g.conf.ConsensusAdmin.Protocol)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	g.consensusAdminReply(res, req, 200, votes)
+}
+
+func (g *smartContractGW) proposeValidatorVote(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var vote eth.ValidatorVote
+	if err := json.NewDecoder(req.Body).Decode(&vote); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	addr, err := utils.StrToAddress("address", vote.Address)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	vote.Address = strings.ToLower(addr.Hex())
+	vote.Vote = strings.ToLower(vote.Vote)
+	if vote.Vote != eth.ValidatorVoteAdd && vote.Vote != eth.ValidatorVoteRemove {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.ConsensusAdminInvalidVote, vote.Vote), 400)
+		return
+	}
+	if !g.withConsensusAdminAuth(res, req, "proposeValidatorVote", vote.Address, vote.Vote == eth.ValidatorVoteAdd) {
+		return
+	}
+	if err := eth.ProposeValidatorVote(req.Context(), g.r2e.rpc, g.conf.ConsensusAdmin.Protocol, vote.Address, vote.Vote); err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	g.consensusAdminReply(res, req, 200, &vote)
+}
+
+func (g *smartContractGW) discardValidatorVote(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	addr, err := utils.StrToAddress("address", params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	addrHex := strings.ToLower(addr.Hex())
+	if !g.withConsensusAdminAuth(res, req, "discardValidatorVote", addrHex) {
+		return
+	}
+	if err := eth.DiscardValidatorVote(req.Context(), g.r2e.rpc, g.conf.ConsensusAdmin.Protocol, addrHex); err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.WriteHeader(status)
+}
+
+func (g *smartContractGW) consensusAdminReply(res http.ResponseWriter, req *http.Request, status int, retval interface{}) {
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(retval)
+}
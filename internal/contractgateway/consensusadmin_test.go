@@ -0,0 +1,218 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestConsensusAdminGateway(protocol string) (*smartContractGW, *ethmocks.RPCClient, *httprouter.Router) {
+	rpc := &ethmocks.RPCClient{}
+	s := &smartContractGW{
+		conf: &SmartContractGatewayConf{ConsensusAdmin: ConsensusAdminConf{Protocol: protocol}},
+		r2e:  &rest2eth{rpc: rpc},
+	}
+	router := &httprouter.Router{}
+	s.addConsensusAdminRoutes(router)
+	return s, rpc, router
+}
+
+func testConsensusAdminPath(router *httprouter.Router, method, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestConsensusAdminDisabled(t *testing.T) {
+	assert := assert.New(t)
+	_, _, router := newTestConsensusAdminGateway("")
+	res := testConsensusAdminPath(router, "GET", "/admin/validators", nil)
+	assert.Equal(404, res.Code)
+}
+
+func TestConsensusAdminInvalidProtocol(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{ConsensusAdmin: ConsensusAdminConf{Protocol: "clique"}},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	assert.Regexp("Invalid consensus protocol 'clique'", err)
+}
+
+func TestGetValidators(t *testing.T) {
+	assert := assert.New(t)
+	_, rpc, router := newTestConsensusAdminGateway(eth.ConsensusProtocolQBFT)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "qbft_getValidatorsByBlockNumber", "latest").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*[]string)) = []string{"0x1111", "0x2222"}
+		}).
+		Return(nil)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "qbft_getValidatorsByBlockNumber", "0x64").
+		Return(fmt.Errorf("pop"))
+
+	res := testConsensusAdminPath(router, "GET", "/admin/validators", nil)
+	assert.Equal(200, res.Code)
+	var info validatorsInfo
+	err := json.NewDecoder(res.Body).Decode(&info)
+	assert.NoError(err)
+	assert.Equal("latest", info.BlockNumber)
+	assert.Equal([]string{"0x1111", "0x2222"}, info.Validators)
+
+	res = testConsensusAdminPath(router, "GET", "/admin/validators?blockNumber=100", nil)
+	assert.Equal(500, res.Code)
+	assert.Regexp("qbft_getValidatorsByBlockNumber returned: pop", res.Body.String())
+
+	res = testConsensusAdminPath(router, "GET", "/admin/validators?blockNumber=-1", nil)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid block number '-1'", res.Body.String())
+	rpc.AssertExpectations(t)
+}
+
+func TestValidatorsBlockNumber(t *testing.T) {
+	assert := assert.New(t)
+	for in, out := range map[string]string{"": "latest", "pending": "pending", "16": "0x10", "0x10": "0x10"} {
+		b, err := validatorsBlockNumber(in)
+		assert.NoError(err)
+		assert.Equal(out, b)
+	}
+	_, err := validatorsBlockNumber("badness")
+	assert.Regexp("Invalid block number 'badness'", err)
+}
+
+func TestGetValidatorVotes(t *testing.T) {
+	assert := assert.New(t)
+	_, rpc, router := newTestConsensusAdminGateway(eth.ConsensusProtocolIBFT)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "ibft_getPendingVotes").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*map[string]bool)) = map[string]bool{"0x1111": true}
+		}).
+		Return(nil).Once()
+	rpc.On("CallContext", mock.Anything, mock.Anything, "ibft_getPendingVotes").
+		Return(fmt.Errorf("pop"))
+
+	res := testConsensusAdminPath(router, "GET", "/admin/validators/votes", nil)
+	assert.Equal(200, res.Code)
+	var votes []*eth.ValidatorVote
+	err := json.NewDecoder(res.Body).Decode(&votes)
+	assert.NoError(err)
+	assert.Equal([]*eth.ValidatorVote{{Address: "0x1111", Vote: eth.ValidatorVoteAdd}}, votes)
+
+	res = testConsensusAdminPath(router, "GET", "/admin/validators/votes", nil)
+	assert.Equal(500, res.Code)
+}
+
+func TestProposeValidatorVote(t *testing.T) {
+	assert := assert.New(t)
+	_, rpc, router := newTestConsensusAdminGateway(eth.ConsensusProtocolQBFT)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "qbft_proposeValidatorVote", "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", false).
+		Run(func(args mock.Arguments) {
+			*(args[1].(*bool)) = true
+		}).
+		Return(nil)
+
+	res := testConsensusAdminPath(router, "POST", "/admin/validators/votes",
+		[]byte(`{"address": "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "vote": "Remove"}`))
+	assert.Equal(200, res.Code)
+	var vote eth.ValidatorVote
+	err := json.NewDecoder(res.Body).Decode(&vote)
+	assert.NoError(err)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", vote.Address)
+	assert.Equal(eth.ValidatorVoteRemove, vote.Vote)
+	rpc.AssertExpectations(t)
+}
+
+func TestProposeValidatorVoteBadInput(t *testing.T) {
+	assert := assert.New(t)
+	_, _, router := newTestConsensusAdminGateway(eth.ConsensusProtocolQBFT)
+
+	res := testConsensusAdminPath(router, "POST", "/admin/validators/votes", []byte(`!json`))
+	assert.Equal(400, res.Code)
+
+	res = testConsensusAdminPath(router, "POST", "/admin/validators/votes", []byte(`{"address": "badness", "vote": "add"}`))
+	assert.Equal(400, res.Code)
+
+	res = testConsensusAdminPath(router, "POST", "/admin/validators/votes",
+		[]byte(`{"address": "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "vote": "maybe"}`))
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid validator vote 'maybe'", res.Body.String())
+}
+
+func TestProposeValidatorVoteRejected(t *testing.T) {
+	assert := assert.New(t)
+	_, rpc, router := newTestConsensusAdminGateway(eth.ConsensusProtocolQBFT)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "qbft_proposeValidatorVote", mock.Anything, true).
+		Return(nil)
+
+	res := testConsensusAdminPath(router, "POST", "/admin/validators/votes",
+		[]byte(`{"address": "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "vote": "add"}`))
+	assert.Equal(500, res.Code)
+	assert.Regexp("The node did not accept qbft_proposeValidatorVote", res.Body.String())
+}
+
+func TestDiscardValidatorVote(t *testing.T) {
+	assert := assert.New(t)
+	_, rpc, router := newTestConsensusAdminGateway(eth.ConsensusProtocolQBFT)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "qbft_discardValidatorVote", "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*bool)) = true
+		}).
+		Return(nil).Once()
+	rpc.On("CallContext", mock.Anything, mock.Anything, "qbft_discardValidatorVote", "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1").
+		Return(fmt.Errorf("pop"))
+
+	res := testConsensusAdminPath(router, "DELETE", "/admin/validators/votes/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", nil)
+	assert.Equal(204, res.Code)
+
+	res = testConsensusAdminPath(router, "DELETE", "/admin/validators/votes/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", nil)
+	assert.Equal(500, res.Code)
+
+	res = testConsensusAdminPath(router, "DELETE", "/admin/validators/votes/badness", nil)
+	assert.Equal(400, res.Code)
+	rpc.AssertExpectations(t)
+}
+
+func TestConsensusAdminRequiresAuth(t *testing.T) {
+	assert := assert.New(t)
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	_, rpc, router := newTestConsensusAdminGateway(eth.ConsensusProtocolQBFT)
+
+	res := testConsensusAdminPath(router, "GET", "/admin/validators", nil)
+	assert.Equal(401, res.Code)
+	res = testConsensusAdminPath(router, "GET", "/admin/validators/votes", nil)
+	assert.Equal(401, res.Code)
+	res = testConsensusAdminPath(router, "POST", "/admin/validators/votes",
+		[]byte(`{"address": "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "vote": "add"}`))
+	assert.Equal(401, res.Code)
+	res = testConsensusAdminPath(router, "DELETE", "/admin/validators/votes/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", nil)
+	assert.Equal(401, res.Code)
+	rpc.AssertNotCalled(t, "CallContext")
+}
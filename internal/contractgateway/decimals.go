@@ -0,0 +1,226 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// natspecDecimalsTag is the NatSpec tag that declares the decimals of amount parameters, as
+	// '@custom:decimals amount 18', on a method or the contract. Multiple parameters are comma separated
+	natspecDecimalsTag = "custom:decimals"
+	// maxDecimals is the most decimals that leave room for a whole token in a uint256
+	maxDecimals = 77
+)
+
+var (
+	decimalsParamName = regexp.MustCompile(`^([a-zA-Z_$][a-zA-Z0-9_$]*\.)?[a-zA-Z_$][a-zA-Z0-9_$]*$`)
+	decimalAmount     = regexp.MustCompile(`^(-?)([0-9]*)(?:\.([0-9]*))?$`)
+)
+
+// normalizeDecimals validates the token decimals supplied when registering a contract, which
+// are keyed by the name of a parameter in any method, or by method.parameter
+func normalizeDecimals(decimals map[string]int) (map[string]int, error) {
+	if len(decimals) == 0 {
+		return nil, nil
+	}
+	for name, d := range decimals {
+		if !decimalsParamName.MatchString(name) {
+			return nil, errors.Errorf(errors.RESTGatewayDecimalsInvalid, "invalid parameter name '"+name+"'")
+		}
+		if d < 0 || d > maxDecimals {
+			return nil, errors.Errorf(errors.RESTGatewayDecimalsInvalid, "parameter '"+name+"' must have between 0 and "+strconv.Itoa(maxDecimals)+" decimals")
+		}
+	}
+	return decimals, nil
+}
+
+// parseNatspecDecimals parses the value of a '@custom:decimals' tag into the decimals of each parameter
+func parseNatspecDecimals(tag string, decimals map[string]int) {
+	for _, entry := range strings.FieldsFunc(tag, func(r rune) bool { return r == ',' || r == '\n' }) {
+		fields := strings.Fields(entry)
+		if len(fields) != 2 {
+			log.Warnf("Ignoring invalid @%s NatSpec entry '%s'", natspecDecimalsTag, entry)
+			continue
+		}
+		d, err := strconv.Atoi(fields[1])
+		if err != nil || d < 0 || d > maxDecimals {
+			log.Warnf("Ignoring invalid @%s NatSpec entry '%s'", natspecDecimalsTag, entry)
+			continue
+		}
+		decimals[fields[0]] = d
+	}
+}
+
+// methodDecimals resolves the decimals of the inputs and outputs of a method, by name. NatSpec on
+// the contract applies to every method, and is overridden by NatSpec on the method. The decimals
+// in the registration of the contract override the NatSpec, with method.parameter taking precedence
+func methodDecimals(registered map[string]int, devdocsJSON string, name string, method *ethbinding.ABIMethod) map[string]int {
+	decimals := make(map[string]int)
+	if devdocsJSON != "" {
+		devdocs := gjson.Parse(devdocsJSON)
+		parseNatspecDecimals(devdocs.Get(gjsonEscape(natspecDecimalsTag)).String(), decimals)
+		sig := name + "("
+		for i, input := range method.Inputs {
+			if i > 0 {
+				sig += ","
+			}
+			sig += input.Type.String()
+		}
+		sig += ")"
+		if name == "constructor" {
+			sig = name
+		}
+		methodDocs := devdocs.Get("methods." + gjsonEscape(sig))
+		parseNatspecDecimals(methodDocs.Get(gjsonEscape(natspecDecimalsTag)).String(), decimals)
+	}
+	for param, d := range registered {
+		if !strings.Contains(param, ".") {
+			decimals[param] = d
+		}
+	}
+	for param, d := range registered {
+		if strings.HasPrefix(param, name+".") {
+			decimals[strings.TrimPrefix(param, name+".")] = d
+		}
+	}
+	if len(decimals) == 0 {
+		return nil
+	}
+	return decimals
+}
+
+func gjsonEscape(path string) string {
+	for _, c := range []string{".", ":", "(", ")", "*", "?"} {
+		path = strings.ReplaceAll(path, c, "\\"+c)
+	}
+	return path
+}
+
+func isAmountType(t *ethbinding.ABIType) bool {
+	return t.T == ethbinding.IntTy || t.T == ethbinding.UintTy
+}
+
+// toBaseUnits converts a human amount, such as "1.5", to an integer number of base units
+func toBaseUnits(amount string, decimals int) (string, bool) {
+	m := decimalAmount.FindStringSubmatch(strings.TrimSpace(amount))
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return "", false
+	}
+	frac := strings.TrimRight(m[3], "0")
+	if len(frac) > decimals {
+		// The amount is more precise than a single base unit
+		return "", false
+	}
+	i, ok := new(big.Int).SetString(m[1]+m[2]+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok {
+		return "", false
+	}
+	return i.String(), true
+}
+
+// fromBaseUnits converts an integer number of base units to a human amount, formatted
+// in the same way as token balances. Values that are not integers are unchanged
+func fromBaseUnits(baseUnits string, decimals int) string {
+	i, ok := new(big.Int).SetString(baseUnits, 10)
+	if !ok {
+		return baseUnits
+	}
+	if i.Sign() < 0 {
+		return "-" + formatTokenAmount(new(big.Int).Neg(i).String(), decimals)
+	}
+	return formatTokenAmount(i.String(), decimals)
+}
+
+// inputToBaseUnits converts the value of an amount input, or each value of an array of
+// amounts, from a human amount to base units. Inputs of other types are unchanged
+func inputToBaseUnits(argName string, t *ethbinding.ABIType, value interface{}, decimals int) (interface{}, error) {
+	if (t.T == ethbinding.SliceTy || t.T == ethbinding.ArrayTy) && t.Elem != nil {
+		if values, ok := value.([]interface{}); ok {
+			converted := make([]interface{}, len(values))
+			for i, v := range values {
+				var err error
+				if converted[i], err = inputToBaseUnits(argName, t.Elem, v, decimals); err != nil {
+					return nil, err
+				}
+			}
+			return converted, nil
+		}
+		return value, nil
+	}
+	if !isAmountType(t) {
+		return value, nil
+	}
+	var amount string
+	switch v := value.(type) {
+	case string:
+		amount = v
+	case json.Number:
+		amount = v.String()
+	case float64:
+		amount = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, errors.Errorf(errors.RESTGatewayDecimalsInvalidAmount, value, argName, decimals)
+	}
+	baseUnits, ok := toBaseUnits(amount, decimals)
+	if !ok {
+		return nil, errors.Errorf(errors.RESTGatewayDecimalsInvalidAmount, value, argName, decimals)
+	}
+	return baseUnits, nil
+}
+
+// outputsFromBaseUnits converts the amount outputs of a call, that have decimals, to human amounts
+func outputsFromBaseUnits(outputs ethbinding.ABIArguments, resBody map[string]interface{}, decimals map[string]int) {
+	for i, output := range outputs {
+		argName := output.Name
+		if argName == "" {
+			argName = "output"
+			if i != 0 {
+				argName += strconv.Itoa(i)
+			}
+		}
+		if d, ok := decimals[argName]; ok {
+			resBody[argName] = outputFromBaseUnits(&output.Type, resBody[argName], d)
+		}
+	}
+}
+
+func outputFromBaseUnits(t *ethbinding.ABIType, value interface{}, decimals int) interface{} {
+	switch v := value.(type) {
+	case string:
+		if isAmountType(t) {
+			return fromBaseUnits(v, decimals)
+		}
+	case []interface{}:
+		if t.Elem != nil {
+			converted := make([]interface{}, len(v))
+			for i, e := range v {
+				converted[i] = outputFromBaseUnits(t.Elem, e, decimals)
+			}
+			return converted
+		}
+	}
+	return value
+}
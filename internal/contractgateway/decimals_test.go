@@ -0,0 +1,275 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testDecimalsABI = ethbinding.ABIMarshaling{
+	{Type: "function", Name: "transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "to", Type: "address"}, {Name: "amount", Type: "uint256"}}},
+	{Type: "function", Name: "batch", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amounts", Type: "uint256[]"}}},
+	{Type: "function", Name: "balanceOf", StateMutability: "view", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address"}},
+		Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "", Type: "uint256"}}},
+}
+
+func testDecimalsMethod(t *testing.T, name string) *ethbinding.ABIMethod {
+	for _, element := range testDecimalsABI {
+		if element.Name == name {
+			method, err := ethbind.API.ABIElementMarshalingToABIMethod(&element)
+			assert.NoError(t, err)
+			return method
+		}
+	}
+	return nil
+}
+
+func expectDecimalsContract(mcr *contractregistrymocks.ContractStore, address string, decimals map[string]int, devdocs string) {
+	mcr.On("GetContractByAddress", strings.TrimPrefix(strings.ToLower(address), "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1", Decimals: decimals}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: testDecimalsABI, DevDoc: devdocs},
+	}, nil)
+}
+
+func TestNormalizeDecimals(t *testing.T) {
+	assert := assert.New(t)
+
+	decimals, err := normalizeDecimals(nil)
+	assert.NoError(err)
+	assert.Nil(decimals)
+
+	decimals, err = normalizeDecimals(map[string]int{"amount": 18, "transfer.value": 0})
+	assert.NoError(err)
+	assert.Equal(map[string]int{"amount": 18, "transfer.value": 0}, decimals)
+
+	_, err = normalizeDecimals(map[string]int{"a.b.c": 18})
+	assert.Regexp("invalid parameter name 'a.b.c'", err)
+
+	_, err = normalizeDecimals(map[string]int{"amount": -1})
+	assert.Regexp("parameter 'amount' must have between 0 and 77 decimals", err)
+}
+
+func TestMethodDecimals(t *testing.T) {
+	assert := assert.New(t)
+	transfer := testDecimalsMethod(t, "transfer")
+
+	assert.Nil(methodDecimals(nil, "", "transfer", transfer))
+
+	devdocs := `{
+		"custom:decimals": "amount 6, output 6",
+		"methods": {
+			"transfer(address,uint256)": {"custom:decimals": "amount 18\nfee bad, rebate 99"}
+		}
+	}`
+	assert.Equal(map[string]int{"amount": 18, "output": 6}, methodDecimals(nil, devdocs, "transfer", transfer))
+
+	registered := map[string]int{"amount": 2, "transfer.amount": 8, "mint.amount": 4}
+	assert.Equal(map[string]int{"amount": 8, "output": 6}, methodDecimals(registered, devdocs, "transfer", transfer))
+	assert.Equal(map[string]int{"amount": 2, "output": 6}, methodDecimals(registered, devdocs, "burn", transfer))
+
+	constructor := &ethbinding.ABIMethod{}
+	devdocs = `{"methods": {"constructor": {"custom:decimals": "cap 18"}}}`
+	assert.Equal(map[string]int{"cap": 18}, methodDecimals(nil, devdocs, "constructor", constructor))
+}
+
+func TestToBaseUnits(t *testing.T) {
+	assert := assert.New(t)
+
+	for amount, expected := range map[string]string{
+		"1.5":     "1500000000000000000",
+		"1":       "1000000000000000000",
+		".25":     "250000000000000000",
+		"1.":      "1000000000000000000",
+		"-2.5":    "-2500000000000000000",
+		"0.1000":  "100000000000000000",
+		"0":       "0",
+		" 00042 ": "42000000000000000000",
+	} {
+		v, ok := toBaseUnits(amount, 18)
+		assert.True(ok, amount)
+		assert.Equal(expected, v, amount)
+	}
+
+	v, ok := toBaseUnits("1.000000", 0)
+	assert.True(ok)
+	assert.Equal("1", v)
+
+	for _, amount := range []string{"", ".", "1.2.3", "abc", "1e18", "0.0000001"} {
+		_, ok := toBaseUnits(amount, 6)
+		assert.False(ok, amount)
+	}
+}
+
+func TestFromBaseUnits(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1.5", fromBaseUnits("1500000000000000000", 18))
+	assert.Equal("1", fromBaseUnits("1000000", 6))
+	assert.Equal("0.000001", fromBaseUnits("1", 6))
+	assert.Equal("0", fromBaseUnits("0", 6))
+	assert.Equal("-0.25", fromBaseUnits("-250000", 6))
+	assert.Equal("12345", fromBaseUnits("12345", 0))
+	assert.Equal("not a number", fromBaseUnits("not a number", 6))
+}
+
+func TestInputToBaseUnits(t *testing.T) {
+	assert := assert.New(t)
+	uintType, _ := ethbind.API.NewType("uint256", "")
+	sliceType, _ := ethbind.API.NewType("uint256[]", "")
+	stringType, _ := ethbind.API.NewType("string", "")
+
+	v, err := inputToBaseUnits("amount", &uintType, "1.5", 6)
+	assert.NoError(err)
+	assert.Equal("1500000", v)
+
+	v, err = inputToBaseUnits("amount", &uintType, 1.5, 6)
+	assert.NoError(err)
+	assert.Equal("1500000", v)
+
+	v, err = inputToBaseUnits("amount", &uintType, json.Number("2"), 6)
+	assert.NoError(err)
+	assert.Equal("2000000", v)
+
+	v, err = inputToBaseUnits("amounts", &sliceType, []interface{}{"1", 0.5}, 6)
+	assert.NoError(err)
+	assert.Equal([]interface{}{"1000000", "500000"}, v)
+
+	v, err = inputToBaseUnits("amounts", &sliceType, "not an array", 6)
+	assert.NoError(err)
+	assert.Equal("not an array", v)
+
+	v, err = inputToBaseUnits("memo", &stringType, "1.5", 6)
+	assert.NoError(err)
+	assert.Equal("1.5", v)
+
+	_, err = inputToBaseUnits("amount", &uintType, "1.0000001", 6)
+	assert.Regexp("Invalid amount '1.0000001' for parameter 'amount' with 6 decimals", err)
+
+	_, err = inputToBaseUnits("amount", &uintType, true, 6)
+	assert.Regexp("Invalid amount 'true' for parameter 'amount' with 6 decimals", err)
+
+	_, err = inputToBaseUnits("amounts", &sliceType, []interface{}{"1", "x"}, 6)
+	assert.Regexp("Invalid amount 'x' for parameter 'amounts' with 6 decimals", err)
+}
+
+func TestOutputsFromBaseUnits(t *testing.T) {
+	assert := assert.New(t)
+	uintType, _ := ethbind.API.NewType("uint256", "")
+	sliceType, _ := ethbind.API.NewType("uint256[]", "")
+	outputs := ethbinding.ABIArguments{
+		{Type: uintType},
+		{Name: "amounts", Type: sliceType},
+		{Name: "raw", Type: uintType},
+	}
+
+	resBody := map[string]interface{}{
+		"output":  "1500000",
+		"amounts": []interface{}{"1000000", "1"},
+		"raw":     "1500000",
+	}
+	outputsFromBaseUnits(outputs, resBody, map[string]int{"output": 6, "amounts": 6})
+	assert.Equal(map[string]interface{}{
+		"output":  "1.5",
+		"amounts": []interface{}{"1", "0.000001"},
+		"raw":     "1500000",
+	}, resBody)
+}
+
+func TestDecimalsSendTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectDecimalsContract(mcr, to, nil, `{"methods":{"transfer(address,uint256)":{"custom:decimals":"amount 18"}}}`)
+
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/transfer", bytes.NewReader([]byte(`{"to":"`+from+`","amount":"1.5"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Code)
+	assert.Equal([]interface{}{from, "1500000000000000000"}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestDecimalsSendTransactionBadAmount(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectDecimalsContract(mcr, to, map[string]int{"amount": 2}, "")
+
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/transfer?amount=1.005&to="+from, bytes.NewReader([]byte{}))
+	req.Header.Set("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Code)
+	var errBody errors.RESTError
+	json.NewDecoder(res.Body).Decode(&errBody)
+	assert.Regexp("Invalid amount '1.005' for parameter 'amount' with 2 decimals", errBody.Message)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestDecimalsCallOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectDecimalsContract(mcr, to, map[string]int{"balanceOf.output": 6}, "")
+
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*string)) = "0x000000000000000000000000000000000000000000000000000000000016e360"
+		}).
+		Return(nil)
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/balanceOf?owner="+to, bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Code)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("1.5", reply["output"])
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+const (
+	defaultDependencyGitHubURL = "https://raw.githubusercontent.com"
+	maxDependencyFiles         = 500
+	maxDependencySize          = 5 * 1024 * 1024
+)
+
+var (
+	solidityImportRegex  = regexp.MustCompile(`import\s+(?:[^"';]*?\s*from\s*)?["']([^"']+)["']`)
+	dependencyPathRegex  = regexp.MustCompile(`^[A-Za-z0-9@._/-]+$`)
+	dependencyVersionReg = regexp.MustCompile(`^[A-Za-z0-9.^~*<>=+-]+$`)
+)
+
+// DependencyConf configures the resolver that fetches the npm and GitHub imports of uploaded
+// Solidity that are not included in the upload. The resolver is only enabled when a mirror is set
+type DependencyConf struct {
+	MirrorURL string `json:"mirrorURL,omitempty"`
+	GitHubURL string `json:"githubURL,omitempty"`
+}
+
+type dependencyResolver struct {
+	conf   *DependencyConf
+	client *http.Client
+}
+
+// dependencyFile is a Solidity file in the compile directory, with the URL it was fetched
+// from if it was not part of the upload
+type dependencyFile struct {
+	path string
+	url  *url.URL
+}
+
+func newDependencyResolver(conf *DependencyConf) *dependencyResolver {
+	if conf.MirrorURL == "" {
+		return nil
+	}
+	defaults := *conf
+	defaults.MirrorURL = strings.TrimSuffix(defaults.MirrorURL, "/")
+	if defaults.GitHubURL == "" {
+		defaults.GitHubURL = defaultDependencyGitHubURL
+	}
+	defaults.GitHubURL = strings.TrimSuffix(defaults.GitHubURL, "/")
+	return &dependencyResolver{
+		conf:   &defaults,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// resolve fetches the missing imports of the Solidity files in the directory, and the imports
+// of those files in turn, writing each one at its import path so solc finds it without remapping
+func (d *dependencyResolver) resolve(dir string, form url.Values, remappings []string, job *compileJob) error {
+	versions, err := readDependencyVersions(dir, form)
+	if err != nil {
+		return err
+	}
+
+	var queue []*dependencyFile
+	_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(p, ".sol") {
+			rel, _ := filepath.Rel(dir, p)
+			queue = append(queue, &dependencyFile{path: filepath.ToSlash(rel)})
+		}
+		return nil
+	})
+
+	fetched := 0
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file.path)))
+		if err != nil {
+			continue
+		}
+		for _, match := range solidityImportRegex.FindAllStringSubmatch(string(b), -1) {
+			importPath := match[1]
+			var target string
+			var u *url.URL
+			if strings.HasPrefix(importPath, "./") || strings.HasPrefix(importPath, "../") {
+				// Relative imports in the upload are left for solc to resolve
+				if file.url == nil {
+					continue
+				}
+				target = path.Join(path.Dir(file.path), importPath)
+				u, _ = file.url.Parse(importPath)
+			} else {
+				if isRemapped(remappings, importPath) {
+					continue
+				}
+				target = path.Clean(importPath)
+			}
+			if !isValidDependencyPath(target) {
+				return errors.Errorf(errors.RESTGatewayDependencyInvalid, importPath)
+			}
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(target))); err == nil {
+				continue
+			}
+			if u == nil {
+				if u, err = d.dependencyURL(target, versions); err != nil {
+					return err
+				}
+			}
+			if fetched++; fetched > maxDependencyFiles {
+				return errors.Errorf(errors.RESTGatewayDependencyLimit, maxDependencyFiles)
+			}
+			if err := d.fetch(dir, target, u, job); err != nil {
+				return err
+			}
+			queue = append(queue, &dependencyFile{path: target, url: u})
+		}
+	}
+	return nil
+}
+
+// dependencyURL returns the location of a non-relative import. GitHub imports use the form
+// github.com/<owner>/<repo>/blob/<ref>/<path>, and all others are npm packages on the mirror
+func (d *dependencyResolver) dependencyURL(importPath string, versions map[string]string) (*url.URL, error) {
+	segments := strings.Split(importPath, "/")
+	if segments[0] == "github.com" {
+		if len(segments) < 6 || segments[3] != "blob" {
+			return nil, errors.Errorf(errors.RESTGatewayDependencyInvalid, importPath)
+		}
+		return url.Parse(fmt.Sprintf("%s/%s/%s/%s", d.conf.GitHubURL, segments[1], segments[2], strings.Join(segments[4:], "/")))
+	}
+	pkgSegments := 1
+	if strings.HasPrefix(importPath, "@") {
+		pkgSegments = 2
+	}
+	if len(segments) <= pkgSegments {
+		return nil, errors.Errorf(errors.RESTGatewayDependencyInvalid, importPath)
+	}
+	pkg := strings.Join(segments[:pkgSegments], "/")
+	if version, ok := versions[pkg]; ok {
+		pkg += "@" + url.PathEscape(version)
+	}
+	return url.Parse(fmt.Sprintf("%s/%s/%s", d.conf.MirrorURL, pkg, strings.Join(segments[pkgSegments:], "/")))
+}
+
+func (d *dependencyResolver) fetch(dir, target string, u *url.URL, job *compileJob) error {
+	log.Infof("Fetching Solidity dependency %s from %s", target, u)
+	job.logf("Fetching %s from %s", target, u)
+	res, err := d.client.Get(u.String())
+	if err != nil {
+		return errors.Errorf(errors.RESTGatewayDependencyFetchFailed, target, u, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf(errors.RESTGatewayDependencyFetchFailed, target, u, fmt.Sprintf("status=%d", res.StatusCode))
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, res.Body, maxDependencySize))
+	if err != nil {
+		return errors.Errorf(errors.RESTGatewayDependencyFetchFailed, target, u, err)
+	}
+	filename := filepath.Join(dir, filepath.FromSlash(target))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return errors.Errorf(errors.RESTGatewayDependencyFetchFailed, target, u, err)
+	}
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		return errors.Errorf(errors.RESTGatewayDependencyFetchFailed, target, u, err)
+	}
+	return nil
+}
+
+// readDependencyVersions returns the npm package versions from the dependencies of a package.json
+// in the root of the upload, overridden by the dependencies form fields of pkg@version, one per line.
+// Versions in the package.json that are not from the registry, such as git URLs, are ignored
+func readDependencyVersions(dir string, form url.Values) (map[string]string, error) {
+	versions := make(map[string]string)
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var pkg struct {
+			Dependencies    map[string]string `json:"dependencies"`
+			DevDependencies map[string]string `json:"devDependencies"`
+		}
+		if err := json.Unmarshal(b, &pkg); err != nil {
+			log.Warnf("Failed to parse package.json: %s", err)
+		}
+		for _, deps := range []map[string]string{pkg.DevDependencies, pkg.Dependencies} {
+			for name, version := range deps {
+				if dependencyPathRegex.MatchString(name) && dependencyVersionReg.MatchString(version) {
+					versions[name] = version
+				}
+			}
+		}
+	}
+	for _, v := range form["dependencies"] {
+		for _, line := range strings.Split(v, "\n") {
+			dep := strings.TrimSpace(line)
+			if dep == "" {
+				continue
+			}
+			at := strings.LastIndex(dep, "@")
+			if at <= 0 || !dependencyPathRegex.MatchString(dep[:at]) || !dependencyVersionReg.MatchString(dep[at+1:]) {
+				return nil, errors.Errorf(errors.RESTGatewayDependencyInvalid, dep)
+			}
+			versions[dep[:at]] = dep[at+1:]
+		}
+	}
+	return versions, nil
+}
+
+// isRemapped checks whether an import is handled by one of the remappings, so is provided by the upload
+func isRemapped(remappings []string, importPath string) bool {
+	for _, remapping := range remappings {
+		prefix := remapping[:strings.Index(remapping, "=")]
+		if colon := strings.Index(prefix, ":"); colon >= 0 {
+			prefix = prefix[colon+1:]
+		}
+		if prefix != "" && strings.HasPrefix(importPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidDependencyPath checks a fetched file will be written within the compile directory
+func isValidDependencyPath(target string) bool {
+	return dependencyPathRegex.MatchString(target) && !path.IsAbs(target) &&
+		target != ".." && !strings.HasPrefix(target, "../") && strings.HasSuffix(target, ".sol")
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDependencyMirror(files map[string]string) (*httptest.Server, *[]string) {
+	requested := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+		content, ok := files[req.URL.Path]
+		if !ok {
+			res.WriteHeader(404)
+			return
+		}
+		res.Write([]byte(content))
+	}))
+	return server, &requested
+}
+
+func newTestDependencyDir(files map[string]string) string {
+	dir, _ := ioutil.TempDir("", "deps")
+	for name, content := range files {
+		os.MkdirAll(path.Join(dir, path.Dir(name)), 0755)
+		ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644)
+	}
+	return dir
+}
+
+func TestResolveDependencies(t *testing.T) {
+	assert := assert.New(t)
+	server, requested := newTestDependencyMirror(map[string]string{
+		"/@openzeppelin/contracts@4.3.0/token/ERC20/ERC20.sol":  `import "./IERC20.sol"; import {Context} from "../../utils/Context.sol";`,
+		"/@openzeppelin/contracts@4.3.0/token/ERC20/IERC20.sol": `interface IERC20 {}`,
+		"/@openzeppelin/contracts@4.3.0/utils/Context.sol":      `abstract contract Context {}`,
+		"/solmate/src/auth/Owned.sol":                           `abstract contract Owned {}`,
+		"/github/owner/repo/v1.0.0/contracts/Lib.sol":           `library Lib {}`,
+	})
+	defer server.Close()
+	dir := newTestDependencyDir(map[string]string{
+		"package.json": `{"dependencies":{"@openzeppelin/contracts":"^4.0.0","bad":"git+https://example.com/bad.git"}}`,
+		"Token.sol": `import "@openzeppelin/contracts/token/ERC20/ERC20.sol";
+import * as owned from 'solmate/src/auth/Owned.sol';
+import "github.com/owner/repo/blob/v1.0.0/contracts/Lib.sol";
+import "./local/Local.sol";
+import "lib/forge-std/src/Test.sol";`,
+		"local/Local.sol": `import "@openzeppelin/contracts/utils/Context.sol";`,
+	})
+	defer os.RemoveAll(dir)
+
+	d := newDependencyResolver(&DependencyConf{MirrorURL: server.URL + "/", GitHubURL: server.URL + "/github"})
+	err := d.resolve(dir, url.Values{"dependencies": {"@openzeppelin/contracts@4.3.0"}}, []string{"forge-std/=lib/forge-std/src/", "ctx:lib/=lib/"}, nil)
+	assert.NoError(err)
+
+	b, err := ioutil.ReadFile(path.Join(dir, "@openzeppelin/contracts/token/ERC20/IERC20.sol"))
+	assert.NoError(err)
+	assert.Equal("interface IERC20 {}", string(b))
+	b, err = ioutil.ReadFile(path.Join(dir, "github.com/owner/repo/blob/v1.0.0/contracts/Lib.sol"))
+	assert.NoError(err)
+	assert.Equal("library Lib {}", string(b))
+	// Each file is fetched once, even when imported twice
+	assert.Equal(5, len(*requested))
+	for _, p := range *requested {
+		assert.NotContains(p, "^")
+	}
+}
+
+func TestResolveDependenciesPackageJSONVersion(t *testing.T) {
+	assert := assert.New(t)
+	server, requested := newTestDependencyMirror(map[string]string{
+		"/@openzeppelin/contracts@^4.0.0/access/Ownable.sol": `contract Ownable {}`,
+	})
+	defer server.Close()
+	dir := newTestDependencyDir(map[string]string{
+		"package.json": `{"devDependencies":{"@openzeppelin/contracts":"^4.0.0"}}`,
+		"A.sol":        `import "@openzeppelin/contracts/access/Ownable.sol";`,
+	})
+	defer os.RemoveAll(dir)
+
+	d := newDependencyResolver(&DependencyConf{MirrorURL: server.URL})
+	err := d.resolve(dir, url.Values{}, nil, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"/@openzeppelin/contracts@^4.0.0/access/Ownable.sol"}, *requested)
+	assert.Equal(defaultDependencyGitHubURL, d.conf.GitHubURL)
+}
+
+func TestResolveDependenciesFailures(t *testing.T) {
+	assert := assert.New(t)
+	server, _ := newTestDependencyMirror(map[string]string{
+		"/pkg/Big.sol": strings.Repeat(" ", maxDependencySize+1),
+	})
+	defer server.Close()
+	d := newDependencyResolver(&DependencyConf{MirrorURL: server.URL})
+
+	for imp, expected := range map[string]string{
+		"pkg/Missing.sol":                   "Failed to fetch Solidity dependency 'pkg/Missing.sol'.*status=404",
+		"pkg/Big.sol":                       "Failed to fetch Solidity dependency 'pkg/Big.sol'.*too large",
+		"pkg/../../etc/passwd.sol":          "Invalid Solidity dependency",
+		"/etc/passwd.sol":                   "Invalid Solidity dependency",
+		"pkg/file name.sol":                 "Invalid Solidity dependency",
+		"Top.sol":                           "Invalid Solidity dependency 'Top.sol'",
+		"@scope/Top.sol":                    "Invalid Solidity dependency '@scope/Top.sol'",
+		"github.com/owner/repo/v1/Lib.sol":  "Invalid Solidity dependency 'github.com/owner/repo/v1/Lib.sol'",
+		"github.com/owner/repo/blob/v1.sol": "Invalid Solidity dependency",
+	} {
+		dir := newTestDependencyDir(map[string]string{"A.sol": `import "` + imp + `";`})
+		err := d.resolve(dir, url.Values{}, nil, nil)
+		assert.Regexp(expected, err, imp)
+		os.RemoveAll(dir)
+	}
+
+	dir := newTestDependencyDir(map[string]string{"A.sol": `import "pkg/A.sol";`})
+	defer os.RemoveAll(dir)
+	err := d.resolve(dir, url.Values{"dependencies": {"pkg"}}, nil, nil)
+	assert.Regexp("Invalid Solidity dependency 'pkg'", err)
+	err = d.resolve(dir, url.Values{"dependencies": {"pkg@1.0 || 2.0"}}, nil, nil)
+	assert.Regexp("Invalid Solidity dependency 'pkg@1.0 || 2.0'", err)
+
+	d.conf.MirrorURL = "http://localhost:0"
+	err = d.resolve(dir, url.Values{}, nil, nil)
+	assert.Regexp("Failed to fetch Solidity dependency 'pkg/A.sol'", err)
+}
+
+func TestResolveDependenciesLimit(t *testing.T) {
+	assert := assert.New(t)
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// Every file imports another new file
+		count++
+		res.Write([]byte(fmt.Sprintf(`import "./f%d.sol";`, count)))
+	}))
+	defer server.Close()
+	dir := newTestDependencyDir(map[string]string{"A.sol": `import "pkg/a.sol";`})
+	defer os.RemoveAll(dir)
+
+	d := newDependencyResolver(&DependencyConf{MirrorURL: server.URL})
+	err := d.resolve(dir, url.Values{}, nil, nil)
+	assert.Regexp("exceeded the limit of 500 files", err)
+}
+
+func TestReadDependencyVersionsBadPackageJSON(t *testing.T) {
+	assert := assert.New(t)
+	dir := newTestDependencyDir(map[string]string{"package.json": `!json`})
+	defer os.RemoveAll(dir)
+
+	versions, err := readDependencyVersions(dir, url.Values{"dependencies": {"a@1.0.0\n\n@b/c@~2.1"}})
+	assert.NoError(err)
+	assert.Equal(map[string]string{"a": "1.0.0", "@b/c": "~2.1"}, versions)
+}
+
+func TestNewDependencyResolverDisabled(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newDependencyResolver(&DependencyConf{GitHubURL: "https://example.com"}))
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// documentETag returns a weak ETag for a response body, from its hash. The ETag is weak as the
+// gzip middleware can send the same document with a different encoding, which is not byte-identical
+func documentETag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// etagMatches checks the If-None-Match header of a request against an ETag. A weak
+// comparison is used, as allowed for If-None-Match, so W/ prefixes are ignored
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// replyWithETag sends a document with its ETag, or a 304 with no body if the client already has it
+func replyWithETag(res http.ResponseWriter, req *http.Request, body []byte) {
+	etag := documentETag(body)
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Content-Type", "application/json")
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		log.Infof("<-- %s %s [%d]", req.Method, req.URL, http.StatusNotModified)
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.WriteHeader(200)
+	_, _ = res.Write(body)
+}
+
+// replyWithJSONETag sends an indented JSON document with its ETag
+func replyWithJSONETag(res http.ResponseWriter, req *http.Request, v interface{}) {
+	body, _ := json.MarshalIndent(v, "", "  ")
+	replyWithETag(res, req, append(body, '\n'))
+}
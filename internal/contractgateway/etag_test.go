@@ -0,0 +1,132 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagMatches(t *testing.T) {
+	assert := assert.New(t)
+	etag := documentETag([]byte("hello"))
+	assert.Regexp(`^W/"[0-9a-f]{32}"$`, etag)
+	assert.NotEqual(etag, documentETag([]byte("world")))
+	assert.True(etagMatches(etag, etag))
+	assert.True(etagMatches(`"other", `+etag, etag))
+	assert.True(etagMatches(strings.TrimPrefix(etag, "W/"), etag))
+	assert.True(etagMatches("*", etag))
+	assert.False(etagMatches(`"other"`, etag))
+}
+
+func newTestETagGateway() (*smartContractGW, *contractregistrymocks.ContractStore, *httprouter.Router) {
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw := s.(*smartContractGW)
+	scgw.cs = mcs
+	mcs.On("GetContractByAddress", "123456789abcdef0123456789abcdef012345678").Return(&contractregistry.ContractInfo{
+		ABI:     "abi1",
+		Address: "123456789abcdef0123456789abcdef012345678",
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{
+			ContractName: "simple",
+			ABI: ethbinding.ABIMarshaling{
+				{Type: "function", Name: "set", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256"}}},
+			},
+		},
+	}, nil)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	return scgw, mcs, router
+}
+
+func TestGetContractSwaggerETag(t *testing.T) {
+	assert := assert.New(t)
+	_, mcs, router := newTestETagGateway()
+
+	req := httptest.NewRequest("GET", "/contracts/123456789abcdef0123456789abcdef012345678?swagger", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	etag := res.Header().Get("ETag")
+	assert.Equal(documentETag(res.Body.Bytes()), etag)
+	assert.Regexp(`"swagger": "2.0"`, res.Body.String())
+
+	req = httptest.NewRequest("GET", "/contracts/123456789abcdef0123456789abcdef012345678?swagger", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(304, res.Code)
+	assert.Equal(etag, res.Header().Get("ETag"))
+	assert.Equal(0, res.Body.Len())
+
+	// A different rendering of the document has a different ETag
+	req = httptest.NewRequest("GET", "/contracts/123456789abcdef0123456789abcdef012345678?swagger&from=0x0123456789abcdef0123456789abcdef01234567", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.NotEqual(etag, res.Header().Get("ETag"))
+
+	mcs.AssertExpectations(t)
+}
+
+func TestGetContractInfoETag(t *testing.T) {
+	assert := assert.New(t)
+	_, _, router := newTestETagGateway()
+
+	req := httptest.NewRequest("GET", "/contracts/123456789abcdef0123456789abcdef012345678", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("application/json", res.Header().Get("Content-Type"))
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(etag)
+	assert.Regexp(`"address": "123456789abcdef0123456789abcdef012345678"`, res.Body.String())
+
+	req = httptest.NewRequest("GET", "/contracts/123456789abcdef0123456789abcdef012345678", nil)
+	req.Header.Set("If-None-Match", `"stale", `+etag)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(304, res.Code)
+
+	req = httptest.NewRequest("GET", "/contracts/123456789abcdef0123456789abcdef012345678?abi", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Regexp(`"name": "set"`, res.Body.String())
+}
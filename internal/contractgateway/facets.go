@@ -0,0 +1,119 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// contractFacet is the body of a request to add a facet to a diamond contract
+type contractFacet struct {
+	ABI string `json:"abi"`
+}
+
+// addFacet registers an additional ABI against a contract, so the methods and events of a facet of
+// a diamond contract are callable under the one contract path alongside those it was registered with
+func (g *smartContractGW) addFacet(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	_, _, info, err := g.resolveAddressOrName(params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, lookupErrStatus(err))
+		return
+	}
+
+	var facet contractFacet
+	if err := json.NewDecoder(req.Body).Decode(&facet); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayFacetABIMissing), 400)
+		return
+	}
+	if facet.ABI == "" {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayFacetABIMissing), 400)
+		return
+	}
+
+	result, err := g.cs.GetABI(contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    facet.ABI,
+	}, false)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	if result == nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayLocalStoreABINotFound, facet.ABI), 404)
+		return
+	}
+	if result.Contract.Deleted != "" {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayABIDeleted, facet.ABI, result.Contract.Deleted), 410)
+		return
+	}
+
+	info, err = g.cs.AddFacet(info.Address, facet.ABI)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, facetErrStatus(err))
+		return
+	}
+	g.replyWithFacets(res, req, info)
+}
+
+// removeFacet removes an ABI registered as a facet of a contract, when the facet is cut from the diamond
+func (g *smartContractGW) removeFacet(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	_, _, info, err := g.resolveAddressOrName(params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, lookupErrStatus(err))
+		return
+	}
+
+	info, err = g.cs.RemoveFacet(info.Address, params.ByName("abi"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, facetErrStatus(err))
+		return
+	}
+	g.replyWithFacets(res, req, info)
+}
+
+func (g *smartContractGW) replyWithFacets(res http.ResponseWriter, req *http.Request, info *contractregistry.ContractInfo) {
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(info)
+}
+
+// facetErrStatus is the HTTP status for a failure to add or remove a facet, which is 409 if the
+// facet is already registered or collides with the contract, 404 if it is not a facet of the
+// contract, or 500 if it could not be stored
+func facetErrStatus(err error) int {
+	if e, ok := err.(errors.EthconnectError); ok {
+		switch e.Code() {
+		case errors.ContractRegistryFacetExists.Code(), errors.ContractRegistryFacetCollision.Code():
+			return 409
+		case errors.ContractRegistryFacetNotFound.Code():
+			return 404
+		}
+	}
+	return 500
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testFacetABI = ethbinding.ABIMarshaling{
+	{
+		Type: "function", Name: "owner", StateMutability: "view",
+		Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "o", Type: "uint256"}},
+	},
+}
+
+func TestInvokeFacetMethod(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", strings.TrimPrefix(to, "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1", Facets: []string{"facet1"}}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testUnauthorizedABI}}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "facet1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testFacetABI}}, nil)
+
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Run(func(args mock.Arguments) {
+			result := args[1].(*string)
+			*result = "0x000000000000000000000000000000000000000000000000000000000001e240"
+		}).
+		Return(nil)
+
+	result, err := r.Invoke(context.Background(), to, "owner", nil, &InvokeOptions{})
+	assert.NoError(err)
+	assert.Equal("123456", result.Outputs["o"])
+	result, err = r.Invoke(context.Background(), to, "get", nil, &InvokeOptions{})
+	assert.NoError(err)
+	assert.Equal("123456", result.Outputs["i"])
+
+	mcr.AssertExpectations(t)
+	mockRPC.AssertExpectations(t)
+}
+
+func TestInvokeFacetMissing(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", strings.TrimPrefix(to, "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1", Facets: []string{"facet1"}}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testUnauthorizedABI}}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "facet1"}, false).
+		Return(nil, nil)
+
+	_, err := r.Invoke(context.Background(), to, "owner", nil, &InvokeOptions{})
+	assert.Regexp("No ABI found with ID facet1", err)
+}
+
+func TestGetContractSwaggerWithFacets(t *testing.T) {
+	assert := assert.New(t)
+	scgw, _, router := newTestETagGateway()
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw.cs = mcs
+	mcs.On("GetContractByAddress", testUpgradeAddr).Return(&contractregistry.ContractInfo{
+		Address: testUpgradeAddr,
+		ABI:     "abi1",
+		Facets:  []string{"facet1"},
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testUnauthorizedABI}}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "facet1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testFacetABI}}, nil)
+
+	deployMsg, _, _, err := scgw.resolveAddressOrName(testUpgradeAddr)
+	assert.NoError(err)
+	assert.Equal(4, len(deployMsg.ABI))
+	assert.Equal(3, len(testUnauthorizedABI))
+
+	req := httptest.NewRequest("GET", "/contracts/"+testUpgradeAddr+"?swagger", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Regexp(`"/owner"`, res.Body.String())
+	assert.Regexp(`"/get"`, res.Body.String())
+}
+
+func TestContractABIWithFacets(t *testing.T) {
+	assert := assert.New(t)
+	scgw, _, _ := newTestETagGateway()
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw.cs = mcs
+	mcs.On("GetContractByAddress", "0x"+testUpgradeAddr).Return(&contractregistry.ContractInfo{
+		Address: testUpgradeAddr,
+		ABI:     "abi1",
+		Facets:  []string{"facet1"},
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testUnauthorizedABI}}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "facet1"}, false).
+		Return(nil, fmt.Errorf("pop")).Once()
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "facet1"}, false).
+		Return(&contractregistry.DeployContractWithAddress{Contract: &messages.DeployContract{ABI: testFacetABI}}, nil)
+
+	_, err := scgw.ContractABI("0x"+testUpgradeAddr, nil)
+	assert.Regexp("pop", err)
+	result, err := scgw.ContractABI("0x"+testUpgradeAddr, nil)
+	assert.NoError(err)
+	assert.Equal(append(append(ethbinding.ABIMarshaling{}, testUnauthorizedABI...), testFacetABI...), result)
+}
+
+func TestAddFacet(t *testing.T) {
+	assert := assert.New(t)
+	_, mcs, router := newTestETagGateway()
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "facet1"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: testFacetABI},
+	}, nil)
+	mcs.On("AddFacet", testUpgradeAddr, "facet1").Return(&contractregistry.ContractInfo{
+		Address: testUpgradeAddr,
+		ABI:     "abi1",
+		Facets:  []string{"facet1"},
+	}, nil)
+
+	req := httptest.NewRequest("PUT", "/contracts/"+testUpgradeAddr+"/facets", strings.NewReader(`{"abi":"facet1"}`))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Regexp(`"facets": \[\s*"facet1"\s*\]`, res.Body.String())
+	mcs.AssertExpectations(t)
+}
+
+func TestAddFacetErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, mcs, router := newTestETagGateway()
+	mcs.On("GetContractByAddress", "unknown").Return(nil, fmt.Errorf("not found"))
+	mcs.On("ResolveContractAddress", "unknown").Return("", fmt.Errorf("not found"))
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "missing"}, false).Return(nil, fmt.Errorf("pop"))
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "nil"}, false).Return(nil, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "deleted"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{Deleted: "2021-01-01T00:00:00Z"},
+	}, nil)
+	for _, id := range []string{"colliding", "existing", "fails"} {
+		mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: id}, false).Return(&contractregistry.DeployContractWithAddress{
+			Contract: &messages.DeployContract{},
+		}, nil)
+	}
+	mcs.On("AddFacet", testUpgradeAddr, "colliding").Return(nil, errors.Errorf(errors.ContractRegistryFacetCollision, "colliding", testUpgradeAddr, "function set (declared differently by ABI abi1)"))
+	mcs.On("AddFacet", testUpgradeAddr, "existing").Return(nil, errors.Errorf(errors.ContractRegistryFacetExists, "existing", testUpgradeAddr))
+	mcs.On("AddFacet", testUpgradeAddr, "fails").Return(nil, fmt.Errorf("pop"))
+
+	addFacet := func(addr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/contracts/"+addr+"/facets", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res := addFacet("unknown", `{"abi":"facet1"}`)
+	assert.Equal(404, res.Code)
+	res = addFacet(testUpgradeAddr, `!json`)
+	assert.Equal(400, res.Code)
+	res = addFacet(testUpgradeAddr, `{}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Must supply the abi of the facet", res.Body.String())
+	res = addFacet(testUpgradeAddr, `{"abi":"missing"}`)
+	assert.Equal(404, res.Code)
+	res = addFacet(testUpgradeAddr, `{"abi":"nil"}`)
+	assert.Equal(404, res.Code)
+	assert.Regexp("No ABI found with ID nil", res.Body.String())
+	res = addFacet(testUpgradeAddr, `{"abi":"deleted"}`)
+	assert.Equal(410, res.Code)
+	res = addFacet(testUpgradeAddr, `{"abi":"colliding"}`)
+	assert.Equal(409, res.Code)
+	assert.Regexp("function set", res.Body.String())
+	res = addFacet(testUpgradeAddr, `{"abi":"existing"}`)
+	assert.Equal(409, res.Code)
+	res = addFacet(testUpgradeAddr, `{"abi":"fails"}`)
+	assert.Equal(500, res.Code)
+}
+
+func TestRemoveFacet(t *testing.T) {
+	assert := assert.New(t)
+	_, mcs, router := newTestETagGateway()
+	mcs.On("RemoveFacet", testUpgradeAddr, "facet1").Return(&contractregistry.ContractInfo{
+		Address: testUpgradeAddr,
+		ABI:     "abi1",
+	}, nil)
+	mcs.On("RemoveFacet", testUpgradeAddr, "facet2").Return(nil, errors.Errorf(errors.ContractRegistryFacetNotFound, "facet2", testUpgradeAddr))
+	mcs.On("GetContractByAddress", "unknown").Return(nil, fmt.Errorf("not found"))
+	mcs.On("ResolveContractAddress", "unknown").Return("", fmt.Errorf("not found"))
+
+	removeFacet := func(addr, abiID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/contracts/"+addr+"/facets/"+abiID, nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res := removeFacet(testUpgradeAddr, "facet1")
+	assert.Equal(200, res.Code)
+	assert.NotRegexp("facets", res.Body.String())
+	res = removeFacet(testUpgradeAddr, "facet2")
+	assert.Equal(404, res.Code)
+	assert.Regexp("is not a facet of contract", res.Body.String())
+	res = removeFacet("unknown", "facet1")
+	assert.Equal(404, res.Code)
+}
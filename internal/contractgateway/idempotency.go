@@ -0,0 +1,319 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultIdempotencyRetentionSec  = 24 * 60 * 60
+	defaultIdempotencyPurgeInterval = 1 * time.Hour
+	idempotencyKeyHeader            = "X-Idempotency-Key"
+	idempotencyReplayedHeader       = "X-Idempotency-Replayed"
+)
+
+// IdempotencyConf enables idempotency keys on REST transaction submissions. A submission that
+// repeats the key of an earlier one within the retention period gets the reply to the earlier
+// one, rather than submitting a duplicate transaction.
+// The keys are kept in their own LevelDB, rather than the receipt store, as the receipt store
+// belongs to the REST gateway rather than the contract gateway, can be MongoDB or in-memory,
+// and has no atomic reserve of a key, or a retention independent of the receipts
+type IdempotencyConf struct {
+	DBPath       string `json:"dbPath,omitempty"`
+	RetentionSec int    `json:"retentionSec,omitempty"`
+}
+
+// idempotencyRecord is stored against each key, with the reply once the request completes
+// for a synchronous request, or once it is accepted for an asynchronous request
+type idempotencyRecord struct {
+	RequestID string    `json:"requestId"`
+	Hash      string    `json:"hash"`
+	Created   time.Time `json:"created"`
+	Accepted  bool      `json:"accepted,omitempty"`
+	TXHash    string    `json:"transactionHash,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Reply     []byte    `json:"reply,omitempty"`
+}
+
+type idempotencyStore struct {
+	lock          sync.Mutex
+	db            kvstore.KVStore
+	retention     time.Duration
+	purgeInterval time.Duration
+	purgeStop     chan struct{}
+	purgeDone     chan struct{}
+}
+
+// newIdempotencyStore opens the store of idempotency keys, or returns nil when they are not enabled
+func newIdempotencyStore(conf *IdempotencyConf) (*idempotencyStore, error) {
+	if conf.DBPath == "" {
+		return nil, nil
+	}
+	if conf.RetentionSec <= 0 {
+		conf.RetentionSec = defaultIdempotencyRetentionSec
+	}
+	db, err := kvstore.NewLDBKeyValueStore(conf.DBPath)
+	if err != nil {
+		return nil, errors.Errorf(errors.RESTGatewayIdempotencyDBOpenFailed, err)
+	}
+	s := &idempotencyStore{
+		db:            db,
+		retention:     time.Duration(conf.RetentionSec) * time.Second,
+		purgeInterval: defaultIdempotencyPurgeInterval,
+	}
+	log.Infof("Idempotency keys enabled, and retained for %ds in %s", conf.RetentionSec, conf.DBPath)
+	s.startPurge()
+	return s, nil
+}
+
+func (s *idempotencyStore) get(key string) *idempotencyRecord {
+	b, err := s.db.Get(key)
+	if err != nil {
+		return nil
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		log.Warnf("Ignoring invalid record for idempotency key '%s': %s", key, err)
+		return nil
+	}
+	if time.Since(record.Created) > s.retention {
+		return nil
+	}
+	return &record
+}
+
+func (s *idempotencyStore) put(key string, record *idempotencyRecord) {
+	b, _ := json.Marshal(record)
+	if err := s.db.Put(key, b); err != nil {
+		log.Errorf("Failed to store idempotency key '%s': %s", key, err)
+	}
+}
+
+// reserve records a key against a new request, unless the key is already held by a request within
+// the retention period, in which case the record of that request is returned
+func (s *idempotencyStore) reserve(key, requestID, hash string) *idempotencyRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if existing := s.get(key); existing != nil {
+		return existing
+	}
+	s.put(key, &idempotencyRecord{RequestID: requestID, Hash: hash, Created: time.Now().UTC()})
+	return nil
+}
+
+// update stores the outcome of the request holding a key
+func (s *idempotencyStore) update(key string, fn func(record *idempotencyRecord)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if record := s.get(key); record != nil {
+		fn(record)
+		s.put(key, record)
+	}
+}
+
+// release frees a key held by a request that was rejected before it was dispatched, so it can be retried
+func (s *idempotencyStore) release(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.db.Delete(key); err != nil {
+		log.Errorf("Failed to release idempotency key '%s': %s", key, err)
+	}
+}
+
+func (s *idempotencyStore) startPurge() {
+	s.purgeStop = make(chan struct{})
+	s.purgeDone = make(chan struct{})
+	go s.purgeLoop()
+}
+
+func (s *idempotencyStore) purgeLoop() {
+	defer close(s.purgeDone)
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+	for {
+		s.purgeExpired()
+		select {
+		case <-ticker.C:
+		case <-s.purgeStop:
+			return
+		}
+	}
+}
+
+// purgeExpired deletes the keys that are older than the retention period
+func (s *idempotencyStore) purgeExpired() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var expired []string
+	it := s.db.NewIterator()
+	for it.Next() {
+		var record idempotencyRecord
+		if err := json.Unmarshal(it.Value(), &record); err != nil || time.Since(record.Created) > s.retention {
+			expired = append(expired, it.Key())
+		}
+	}
+	it.Release()
+	for _, key := range expired {
+		if err := s.db.Delete(key); err != nil {
+			log.Errorf("Failed to purge idempotency key '%s': %s", key, err)
+		}
+	}
+	if len(expired) > 0 {
+		log.Infof("Purged %d expired idempotency keys", len(expired))
+	}
+}
+
+func (s *idempotencyStore) close() {
+	if s == nil {
+		return
+	}
+	close(s.purgeStop)
+	<-s.purgeDone
+	s.db.Close()
+}
+
+// idempotentRequest is a transaction submission holding an idempotency key. It wraps the
+// response, to capture the reply to the submission
+type idempotentRequest struct {
+	http.ResponseWriter
+	store  *idempotencyStore
+	key    string // namespaced key in the store
+	isSync bool
+	sent   bool   // the transaction was submitted to the node, so the key must not be released
+	txHash string // hash of the submitted transaction, when known
+	status int
+	body   bytes.Buffer
+}
+
+// markSent records that the transaction of a synchronous request has been submitted to the node
+func (ir *idempotentRequest) markSent(txHash string) {
+	if ir == nil {
+		return
+	}
+	ir.sent = true
+	if txHash != "" {
+		ir.txHash = txHash
+	}
+}
+
+// receiptTXHash returns the hash of the transaction a sync reply is for, if it is a receipt
+func receiptTXHash(receipt messages.ReplyWithHeaders) string {
+	if txReceipt := receipt.IsReceipt(); txReceipt != nil && txReceipt.TransactionHash != nil {
+		return txReceipt.TransactionHash.String()
+	}
+	return ""
+}
+
+func (ir *idempotentRequest) WriteHeader(status int) {
+	ir.status = status
+	ir.ResponseWriter.WriteHeader(status)
+}
+
+func (ir *idempotentRequest) Write(b []byte) (int, error) {
+	ir.body.Write(b)
+	return ir.ResponseWriter.Write(b)
+}
+
+// idempotencyRequestHash is the hash of a transaction submission, to detect a key being repeated
+// with a different request. It covers the method and path, and the parameters from the body or query
+func idempotencyRequestHash(req *http.Request, from string, value json.Number, msgParams []interface{}) string {
+	h := sha256.New()
+	paramBytes, _ := json.Marshal(msgParams)
+	for _, v := range [][]byte{[]byte(req.Method), []byte(req.URL.Path), []byte(strings.ToLower(from)), []byte(value), paramBytes} {
+		h.Write(v)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// startIdempotent reserves the idempotency key of a transaction submission, supplied in the
+// X-Idempotency-Key header or as the request ID. Keys are namespaced by the from address and the
+// path of the request, so clients cannot see each other's replies. When the key is already held by
+// an earlier submission, the reply to that submission is sent and replayed is true. Otherwise the
+// returned request, if not nil, must be used for the response and finished once the reply is sent
+func (r *rest2eth) startIdempotent(res http.ResponseWriter, req *http.Request, requestID, from string, value json.Number, msgParams []interface{}, isSync bool) (ir *idempotentRequest, replayed bool) {
+	if r.idempotency == nil {
+		return nil, false
+	}
+	clientKey := req.Header.Get(idempotencyKeyHeader)
+	if clientKey == "" {
+		clientKey = getFlyParam("id", req)
+	}
+	if clientKey == "" {
+		return nil, false
+	}
+	key := strings.ToLower(from) + " " + req.URL.Path + " " + clientKey
+	hash := idempotencyRequestHash(req, from, value, msgParams)
+	existing := r.idempotency.reserve(key, requestID, hash)
+	if existing == nil {
+		return &idempotentRequest{ResponseWriter: res, store: r.idempotency, key: key, isSync: isSync}, false
+	}
+	if existing.Hash != hash {
+		r.restErrReply(res, req, errors.Errorf(errors.RESTGatewayIdempotencyKeyMismatch, clientKey, existing.RequestID), 422)
+		return nil, true
+	}
+	log.Infof("Replaying reply to request %s for idempotency key '%s' (tx=%s)", existing.RequestID, clientKey, existing.TXHash)
+	res.Header().Set(idempotencyReplayedHeader, "true")
+	switch {
+	case existing.Reply != nil:
+		log.Infof("<-- %s %s [%d]", req.Method, req.URL, existing.Status)
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(existing.Status)
+		res.Write(existing.Reply)
+	case existing.Accepted:
+		r.restAsyncReply(res, req, &messages.AsyncSentMsg{Sent: true, Request: existing.RequestID})
+	default:
+		r.restErrReply(res, req, errors.Errorf(errors.RESTGatewayIdempotencyKeyInProgress, clientKey, existing.RequestID), 409)
+	}
+	return nil, true
+}
+
+// finish records the outcome of a submission holding an idempotency key. The reply to a synchronous
+// request is stored to be replayed once its transaction has been sent, even if the reply is an error
+// such as a failed receipt or a timeout waiting for one, as a retry would send a second transaction.
+// An asynchronous request is recorded as accepted. A request rejected before its transaction was sent,
+// such as by a bad request, a guard, or a failure to reach the node, releases the key so it can be retried
+func (ir *idempotentRequest) finish() {
+	if ir == nil {
+		return
+	}
+	switch {
+	case ir.isSync && ir.sent:
+		ir.store.update(ir.key, func(record *idempotencyRecord) {
+			record.TXHash = ir.txHash
+			record.Status = ir.status
+			record.Reply = ir.body.Bytes()
+		})
+	case !ir.isSync && ir.status == http.StatusAccepted:
+		ir.store.update(ir.key, func(record *idempotencyRecord) {
+			record.Accepted = true
+		})
+	default:
+		ir.store.release(ir.key)
+	}
+}
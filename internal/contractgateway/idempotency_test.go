@@ -0,0 +1,357 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	contractregistrymocks "github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIdempotencyTestREST2Eth(t *testing.T, dir string, dispatcher *mockREST2EthDispatcher) (*rest2eth, *httprouter.Router) {
+	r, router := newTestREST2Eth(dispatcher)
+	var err error
+	r.idempotency, err = newIdempotencyStore(&IdempotencyConf{DBPath: path.Join(dir, "idempotency")})
+	assert.NoError(t, err)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectNotRegistered(mcr, "0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8")
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "testabi",
+	}, false).
+		Return(&contractregistry.DeployContractWithAddress{
+			Contract: &messages.DeployContract{
+				ABI: ethbinding.ABIMarshaling{
+					{
+						Name: "set", Type: "function", Inputs: []ethbinding.ABIArgumentMarshaling{
+							{Name: "x", Type: "uint256", InternalType: "uint256"},
+						},
+					},
+				},
+			},
+		}, nil)
+	return r, router
+}
+
+func sendIdempotentTestRequest(router *httprouter.Router, query, key string) *httptest.ResponseRecorder {
+	return sendIdempotentTestRequestFrom(router, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", "x=105"+query, key)
+}
+
+func sendIdempotentTestRequestFrom(router *httprouter.Router, from, query, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/abis/testabi/0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8/set?"+query, bytes.NewReader([]byte{}))
+	req.Header.Add("x-firefly-from", from)
+	if key != "" {
+		req.Header.Set("X-Idempotency-Key", key)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestIdempotencyKeyAsyncReplay(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Empty(res.Result().Header.Get("X-Idempotency-Replayed"))
+	requestID := dispatcher.asyncDispatchMsg["headers"].(map[string]interface{})["id"]
+
+	dispatcher.asyncDispatchMsg = nil
+	res = sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal("true", res.Result().Header.Get("X-Idempotency-Replayed"))
+	var reply messages.AsyncSentMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.True(reply.Sent)
+	assert.Equal(requestID, reply.Request)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+
+	// A different key is submitted
+	res = sendIdempotentTestRequest(router, "", "key2")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
+
+func TestIdempotencyKeyFromRequestID(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "myid"},
+	}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "&fly-id=myid", "")
+	assert.Equal(202, res.Result().StatusCode)
+
+	dispatcher.asyncDispatchMsg = nil
+	res = sendIdempotentTestRequest(router, "&fly-id=myid", "")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal("true", res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.Nil(dispatcher.asyncDispatchMsg)
+
+	// Requests without a key are not checked
+	res = sendIdempotentTestRequest(router, "", "")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
+
+func TestIdempotencyKeyAsyncFailureReleased(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchError:  fmt.Errorf("pop"),
+		asyncDispatchStatus: 500,
+	}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(500, res.Result().StatusCode)
+
+	dispatcher.asyncDispatchError = nil
+	dispatcher.asyncDispatchReply = &messages.AsyncSentMsg{Sent: true, Request: "request1"}
+	dispatcher.asyncDispatchMsg = nil
+	res = sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Empty(res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
+
+func TestIdempotencyKeySyncReplay(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	receipt := &messages.TransactionReceipt{}
+	receipt.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	receipt.Headers.ID = "reply1"
+	dispatcher := &mockREST2EthDispatcher{sendTransactionSyncReceipt: receipt}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(200, res.Result().StatusCode)
+	original := res.Body.String()
+
+	dispatcher.sendTransactionMsg = nil
+	res = sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("true", res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.Equal(original, res.Body.String())
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	dispatcher.asyncDispatchReply = &messages.AsyncSentMsg{Sent: true, Request: "request1"}
+	res := sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(202, res.Result().StatusCode)
+	requestID := dispatcher.asyncDispatchMsg["headers"].(map[string]interface{})["id"].(string)
+
+	// Mark the key as held by a request that has not been accepted yet
+	it := r.idempotency.db.NewIterator()
+	it.Next()
+	key := it.Key()
+	it.Release()
+	assert.Regexp("^0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8 /abis/testabi/.*/set key1$", key)
+	r.idempotency.update(key, func(record *idempotencyRecord) {
+		record.Accepted = false
+	})
+
+	dispatcher.asyncDispatchMsg = nil
+	res = sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(409, res.Result().StatusCode)
+	assert.Regexp("key1.*"+requestID+".*FFEC100395", res.Body.String())
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestIdempotencyKeyDifferentRequest(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "", "key1")
+	assert.Equal(202, res.Result().StatusCode)
+
+	// The same key with different parameters is rejected
+	dispatcher.asyncDispatchMsg = nil
+	res = sendIdempotentTestRequestFrom(router, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", "x=106", "key1")
+	assert.Equal(422, res.Result().StatusCode)
+	assert.Regexp("key1.*different parameters.*FFEC100400", res.Body.String())
+	assert.Nil(dispatcher.asyncDispatchMsg)
+
+	// The same key from a different address is a different key, and is submitted
+	res = sendIdempotentTestRequestFrom(router, "0x11c5fe653e7a9ebb628a6d40f0452d1e358baee8", "x=105", "key1")
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Empty(res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
+
+func TestIdempotencyKeySyncServerErrorReleased(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{sendTransactionSyncError: fmt.Errorf("pop")}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(500, res.Result().StatusCode)
+
+	receipt := &messages.TransactionReceipt{}
+	receipt.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	dispatcher.sendTransactionSyncError = nil
+	dispatcher.sendTransactionSyncReceipt = receipt
+	dispatcher.sendTransactionMsg = nil
+	res = sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Empty(res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.NotNil(dispatcher.sendTransactionMsg)
+}
+
+func TestIdempotencyKeySyncFailedReceiptNotResent(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	txHash := ethbind.API.HexToHash("0xe2f3d5ac1f2d4a7e7e0e9cf1de16c7e88b4e2e8e1a1b3d19a8f2f0fbcc15ad23")
+	receipt := &messages.TransactionReceipt{TransactionHash: &txHash}
+	receipt.Headers.MsgType = messages.MsgTypeTransactionFailure
+	dispatcher := &mockREST2EthDispatcher{sendTransactionSyncReceipt: receipt}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(500, res.Result().StatusCode)
+	original := res.Body.String()
+
+	// The transaction was mined, so the retry gets the failed receipt rather than sending again
+	dispatcher.sendTransactionMsg = nil
+	res = sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("true", res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.Equal(original, res.Body.String())
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestIdempotencyKeySyncReceiptTimeoutNotResent(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncError:  fmt.Errorf("Timed out waiting for transaction receipt"),
+		sendTransactionSyncTXHash: "0x12345",
+	}
+	r, router := newIdempotencyTestREST2Eth(t, dir, dispatcher)
+	defer r.idempotency.close()
+
+	res := sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(500, res.Result().StatusCode)
+
+	it := r.idempotency.db.NewIterator()
+	it.Next()
+	key := it.Key()
+	it.Release()
+	assert.Equal("0x12345", r.idempotency.get(key).TXHash)
+
+	// The transaction was sent and might still be mined, so the retry must not send it again
+	dispatcher.sendTransactionMsg = nil
+	dispatcher.sendTransactionSyncError = nil
+	res = sendIdempotentTestRequest(router, "&fly-sync", "key1")
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("true", res.Result().Header.Get("X-Idempotency-Replayed"))
+	assert.Regexp("Timed out waiting for transaction receipt", res.Body.String())
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestIdempotencyStoreExpiryAndPurge(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	s, err := newIdempotencyStore(&IdempotencyConf{DBPath: path.Join(dir, "idempotency")})
+	assert.NoError(err)
+	defer s.close()
+	assert.Equal(time.Duration(defaultIdempotencyRetentionSec)*time.Second, s.retention)
+
+	assert.Nil(s.reserve("key1", "request1", "hash1"))
+	assert.Equal("request1", s.reserve("key1", "request2", "hash1").RequestID)
+	s.db.Put("bad", []byte("!json"))
+	assert.Nil(s.get("bad"))
+
+	s.retention = 0
+	assert.Nil(s.reserve("key1", "request2", "hash1"))
+	s.purgeExpired()
+	_, err = s.db.Get("key1")
+	assert.Error(err)
+	_, err = s.db.Get("bad")
+	assert.Error(err)
+}
+
+func TestIdempotencyStoreDisabled(t *testing.T) {
+	assert := assert.New(t)
+	s, err := newIdempotencyStore(&IdempotencyConf{})
+	assert.NoError(err)
+	assert.Nil(s)
+	s.close()
+
+	r := &rest2eth{}
+	ir, replayed := r.startIdempotent(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil), "request1", "0x12345", "", nil, false)
+	assert.Nil(ir)
+	assert.False(replayed)
+	ir.finish()
+}
+
+func TestIdempotencyStoreOpenFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	badPath := path.Join(dir, "badfile")
+	os.WriteFile(badPath, []byte{}, 0644)
+
+	_, err := newIdempotencyStore(&IdempotencyConf{DBPath: path.Join(badPath, "idempotency")})
+	assert.Regexp("FFEC100394", err)
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// hdWalletUpdate is the body of PUT /admin/hdwallet - the new configuration, and the
+// HD-<instanceId>-<walletId>-<index> 'from' address used to probe it before it is applied
+type hdWalletUpdate struct {
+	tx.HDWalletConf
+	Probe string `json:"probe"`
+}
+
+// addressBookUpdate is the body of PUT /admin/addressbook - the new configuration, and the
+// address looked up to probe it before it is applied
+type addressBookUpdate struct {
+	tx.AddressBookConf
+	Probe string `json:"probe"`
+}
+
+// addIntegrationRoutes adds the routes to re-point the HD wallet and address book. These change where
+// transactions are signed and sent, so are only added when requests are authenticated by a security
+// module, or the operator has explicitly enabled them
+func (g *smartContractGW) addIntegrationRoutes(router *httprouter.Router) {
+	if !auth.IsSecurityModuleRegistered() && (g.conf == nil || !g.conf.AdminIntegrations) {
+		return
+	}
+	router.PUT("/admin/hdwallet", g.updateHDWallet)
+	router.PUT("/admin/addressbook", g.updateAddressBook)
+}
+
+func (g *smartContractGW) updateHDWallet(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var body hdWalletUpdate
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	if err := auth.AuthRPC(req.Context(), "ethconnect_updateHDWallet", body.URLTemplate, body.Probe); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	update, err := g.r2e.processor.UpdateHDWallet(&body.HDWalletConf, body.Probe)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	g.integrationUpdateReply(res, req, update)
+}
+
+func (g *smartContractGW) updateAddressBook(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var body addressBookUpdate
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	if err := auth.AuthRPC(req.Context(), "ethconnect_updateAddressBook", body.AddressbookURLPrefix, body.Probe); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	update, err := g.r2e.processor.UpdateAddressBook(req.Context(), &body.AddressBookConf, body.Probe)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	g.integrationUpdateReply(res, req, update)
+}
+
+func (g *smartContractGW) integrationUpdateReply(res http.ResponseWriter, req *http.Request, update *tx.IntegrationUpdate) {
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(update)
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIntegrationsGateway(processor *mockProcessor) *httprouter.Router {
+	s := &smartContractGW{
+		conf: &SmartContractGatewayConf{AdminIntegrations: true},
+		r2e:  &rest2eth{processor: processor},
+	}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+	return router
+}
+
+func TestUpdateHDWallet(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{
+		integrationUpdate: &tx.IntegrationUpdate{Integration: "hdWallet", Enabled: true, Probe: "HD-inst-wallet-0"},
+	}
+	router := newTestIntegrationsGateway(processor)
+
+	req := httptest.NewRequest("PUT", "/admin/hdwallet", bytes.NewReader([]byte(`{
+		"urlTemplate": "https://hdwallet/{{.InstanceID}}/{{.WalletID}}/{{.Index}}",
+		"chainID": "12345",
+		"headers": {"Authorization": ["Bearer rotated"]},
+		"probe": "HD-inst-wallet-0"
+	}`)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var update tx.IntegrationUpdate
+	err := json.NewDecoder(res.Body).Decode(&update)
+	assert.NoError(err)
+	assert.True(update.Enabled)
+	assert.Equal("HD-inst-wallet-0", processor.integrationProbe)
+	assert.Equal("https://hdwallet/{{.InstanceID}}/{{.WalletID}}/{{.Index}}", processor.hdWalletConf.URLTemplate)
+	assert.Equal("12345", processor.hdWalletConf.ChainID)
+	assert.Equal([]string{"Bearer rotated"}, processor.hdWalletConf.Headers["Authorization"])
+}
+
+func TestUpdateAddressBook(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{
+		integrationUpdate: &tx.IntegrationUpdate{Integration: "addressBook", Enabled: true},
+	}
+	router := newTestIntegrationsGateway(processor)
+
+	req := httptest.NewRequest("PUT", "/admin/addressbook", bytes.NewReader([]byte(`{
+		"urlPrefix": "https://addressbook/addresses",
+		"hostsFile": "/etc/hosts",
+		"propNames": {"endpoint": "rpc"},
+		"probe": "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	}`)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", processor.integrationProbe)
+	assert.Equal("https://addressbook/addresses", processor.addressBookConf.AddressbookURLPrefix)
+	assert.Equal("/etc/hosts", processor.addressBookConf.HostsFile)
+	assert.Equal("rpc", processor.addressBookConf.PropNames.RPCEndpoint)
+}
+
+func TestUpdateIntegrationsFail(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{}
+	router := newTestIntegrationsGateway(processor)
+
+	for _, path := range []string{"/admin/hdwallet", "/admin/addressbook"} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("PUT", path, bytes.NewReader([]byte("!json"))))
+		assert.Equal(400, res.Code)
+		var errBody map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&errBody)
+		assert.Regexp("Unable to parse as YAML or JSON", errBody["error"])
+
+		processor.err = fmt.Errorf("pop")
+		res = httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("PUT", path, bytes.NewReader([]byte("{}"))))
+		assert.Equal(400, res.Code)
+		json.NewDecoder(res.Body).Decode(&errBody)
+		assert.Regexp("pop", errBody["error"])
+		processor.err = nil
+
+		auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+		res = httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("PUT", path, bytes.NewReader([]byte("{}"))))
+		assert.Equal(401, res.Code)
+		auth.RegisterSecurityModule(nil)
+	}
+}
+
+func TestIntegrationRoutesDisabled(t *testing.T) {
+	assert := assert.New(t)
+	s := &smartContractGW{r2e: &rest2eth{processor: &mockProcessor{}}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+	for _, path := range []string{"/admin/hdwallet", "/admin/addressbook"} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("PUT", path, bytes.NewReader([]byte("{}"))))
+		assert.Equal(404, res.Code)
+	}
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	router = &httprouter.Router{}
+	s.AddRoutes(router)
+	for _, path := range []string{"/admin/hdwallet", "/admin/addressbook"} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("PUT", path, bytes.NewReader([]byte("{}"))))
+		assert.Equal(401, res.Code)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Invoker invokes the methods of contracts without going through HTTP, for embedding the gateway
+// and for integration tests. The contract is resolved, and the parameters validated, packed and
+// dispatched exactly as for a request to /contracts/:address/:method
+type Invoker interface {
+	Invoke(ctx context.Context, addr, method string, params map[string]interface{}, opts *InvokeOptions) (*InvokeResult, error)
+}
+
+// InvokeOptions are the options of an invocation, equivalent to the fly- parameters of the REST API
+type InvokeOptions struct {
+	ID                   string
+	From                 string
+	Value                string
+	Gas                  string
+	GasPrice             string
+	MaxFeePerGas         string
+	MaxPriorityFeePerGas string
+	Call                 bool   // query the method with eth_call, even if it is not read-only
+	Sync                 bool   // wait for the receipt of the transaction
+	BlockNumber          string // the block a call is made against
+	PrivateFrom          string
+	PrivateFor           []string
+	PrivacyGroupID       string
+}
+
+// InvokeResult is the outcome of an invocation. Outputs are set for a call, Receipt for a
+// synchronous transaction, and Sent for an asynchronous transaction once it is dispatched
+type InvokeResult struct {
+	Outputs map[string]interface{}
+	Receipt *messages.TransactionReceipt
+	Sent    *messages.AsyncSentMsg
+}
+
+// InvokeError is the error of an invocation, with the status the REST API returns for it.
+// The receipt is set when a synchronous transaction was mined, but failed
+type InvokeError struct {
+	errors.RESTError
+	Status  int
+	Receipt *messages.TransactionReceipt
+}
+
+func (e *InvokeError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return e.Message
+}
+
+// invokeResponse captures the reply of the REST handler for an invocation
+type invokeResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *invokeResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *invokeResponse) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *invokeResponse) WriteHeader(status int) {
+	r.status = status
+}
+
+func (o *InvokeOptions) flyParams() url.Values {
+	prefix := utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly") + "-"
+	query := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			query.Set(prefix+name, value)
+		}
+	}
+	set("id", o.ID)
+	set("from", o.From)
+	set("ethvalue", o.Value)
+	set("gas", o.Gas)
+	set("gasprice", o.GasPrice)
+	set("maxfee", o.MaxFeePerGas)
+	set("priorityfee", o.MaxPriorityFeePerGas)
+	set("blocknumber", o.BlockNumber)
+	set("privatefrom", o.PrivateFrom)
+	set("privacygroupid", o.PrivacyGroupID)
+	for _, privateFor := range o.PrivateFor {
+		query.Add(prefix+"privatefor", privateFor)
+	}
+	if o.Call {
+		set("call", "true")
+	}
+	if o.Sync {
+		set("sync", "true")
+	}
+	return query
+}
+
+// Invoke calls a method of a contract, or sends a transaction to it, by running the REST handler
+// in-process. The address can be the registered name of the contract
+func (r *rest2eth) Invoke(ctx context.Context, addr, method string, params map[string]interface{}, opts *InvokeOptions) (*InvokeResult, error) {
+	if opts == nil {
+		opts = &InvokeOptions{}
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, &InvokeError{
+			RESTError: *errors.ToRESTError(errors.Errorf(errors.RESTGatewayInvokeParamsInvalid, method, err)),
+			Status:    400,
+		}
+	}
+	reqURL := &url.URL{
+		Path:     "/contracts/" + addr + "/" + method,
+		RawQuery: opts.flyParams().Encode(),
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := &invokeResponse{header: http.Header{}, status: 200}
+	r.restHandler(res, req, httprouter.Params{
+		{Key: "address", Value: addr},
+		{Key: "method", Value: method},
+	})
+	return res.result()
+}
+
+// result converts the reply of the REST handler to the result of the invocation
+func (r *invokeResponse) result() (*InvokeResult, error) {
+	body := r.body.Bytes()
+	var reply struct {
+		errors.RESTError
+		Headers *messages.ReplyHeaders `json:"headers"`
+	}
+	_ = json.Unmarshal(body, &reply)
+	if reply.Headers != nil {
+		receipt := &messages.TransactionReceipt{}
+		_ = json.Unmarshal(body, receipt)
+		if r.status != 200 {
+			txHash := ""
+			if receipt.TransactionHash != nil {
+				txHash = receipt.TransactionHash.String()
+			}
+			restErr := errors.ToRESTError(errors.Errorf(errors.RESTGatewayInvokeTransactionFailed, txHash))
+			restErr.RevertReason = receipt.RevertReason
+			return nil, &InvokeError{RESTError: *restErr, Status: r.status, Receipt: receipt}
+		}
+		return &InvokeResult{Receipt: receipt}, nil
+	}
+	switch r.status {
+	case 200:
+		var outputs map[string]interface{}
+		_ = json.Unmarshal(body, &outputs)
+		return &InvokeResult{Outputs: outputs}, nil
+	case 202:
+		sent := &messages.AsyncSentMsg{}
+		_ = json.Unmarshal(body, sent)
+		return &InvokeResult{Sent: sent}, nil
+	default:
+		return nil, &InvokeError{RESTError: reply.RESTError, Status: r.status}
+	}
+}
+
+// Invoke invokes a method of a contract registered with the gateway, without going through HTTP
+func (g *smartContractGW) Invoke(ctx context.Context, addr, method string, params map[string]interface{}, opts *InvokeOptions) (*InvokeResult, error) {
+	return g.r2e.Invoke(ctx, addr, method, params, opts)
+}
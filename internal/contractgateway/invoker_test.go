@@ -0,0 +1,210 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestInvokeCallSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "0x3039").
+		Run(func(args mock.Arguments) {
+			result := args[1].(*string)
+			*result = "0x000000000000000000000000000000000000000000000000000000000001e240"
+		}).
+		Return(nil)
+
+	result, err := r.Invoke(context.Background(), to, "get", nil, &InvokeOptions{BlockNumber: "12345"})
+	assert.NoError(err)
+	assert.Equal("123456", result.Outputs["i"])
+	assert.Nil(result.Receipt)
+	assert.Nil(result.Sent)
+
+	mcr.AssertExpectations(t)
+	mockRPC.AssertExpectations(t)
+}
+
+func TestInvokeSendAsyncSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	r, _ := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+
+	result, err := r.Invoke(context.Background(), to, "set", map[string]interface{}{"i": 12345}, &InvokeOptions{
+		ID:         "id+1",
+		From:       from,
+		Gas:        "100000",
+		PrivateFor: []string{"key1", "key2"},
+	})
+	assert.NoError(err)
+	assert.True(result.Sent.Sent)
+	assert.Equal("request1", result.Sent.Request)
+
+	assert.Equal("id+1", dispatcher.asyncDispatchMsg["headers"].(map[string]interface{})["id"])
+	assert.Equal(from, dispatcher.asyncDispatchMsg["from"])
+	assert.Equal(to, dispatcher.asyncDispatchMsg["to"])
+	assert.Equal(float64(100000), dispatcher.asyncDispatchMsg["gas"])
+	assert.Equal([]interface{}{"key1", "key2"}, dispatcher.asyncDispatchMsg["privateFor"])
+
+	mcr.AssertExpectations(t)
+}
+
+func TestInvokeSendSyncSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: &messages.TransactionReceipt{
+			ReplyCommon: messages.ReplyCommon{
+				Headers: messages.ReplyHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeTransactionSuccess,
+					},
+				},
+			},
+		},
+	}
+	r, _ := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+
+	result, err := r.Invoke(context.Background(), to, "set", map[string]interface{}{"i": 12345}, &InvokeOptions{
+		From:  "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+		Value: "1234",
+		Sync:  true,
+	})
+	assert.NoError(err)
+	assert.Equal(messages.MsgTypeTransactionSuccess, result.Receipt.Headers.MsgType)
+	assert.Equal(json.Number("1234"), dispatcher.sendTransactionMsg.Value)
+
+	mcr.AssertExpectations(t)
+}
+
+func TestInvokeSendSyncFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: &messages.TransactionReceipt{
+			ReplyCommon: messages.ReplyCommon{
+				Headers: messages.ReplyHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeTransactionFailure,
+					},
+				},
+			},
+			RevertReason: "Not allowed",
+		},
+	}
+	r, _ := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+
+	_, err := r.Invoke(context.Background(), to, "set", map[string]interface{}{"i": 12345}, &InvokeOptions{
+		From: "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+		Sync: true,
+	})
+	assert.Regexp("FFEC100366", err)
+	invokeErr := err.(*InvokeError)
+	assert.Equal(500, invokeErr.Status)
+	assert.Equal("Not allowed", invokeErr.RevertReason)
+	assert.Equal(messages.MsgTypeTransactionFailure, invokeErr.Receipt.Headers.MsgType)
+
+	mcr.AssertExpectations(t)
+}
+
+func TestInvokeContractNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").
+		Return(nil, fmt.Errorf("pop"))
+
+	_, err := r.Invoke(context.Background(), to, "set", nil, nil)
+	assert.Regexp("pop", err)
+	assert.Equal(404, err.(*InvokeError).Status)
+
+	mcr.AssertExpectations(t)
+}
+
+func TestInvokeMissingParam(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+
+	_, err := r.Invoke(context.Background(), to, "set", map[string]interface{}{}, &InvokeOptions{
+		From: "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+	})
+	assert.Regexp("Parameter 'i' of method 'set' was not specified", err)
+	assert.Equal(400, err.(*InvokeError).Status)
+}
+
+func TestInvokeParamsUnserializable(t *testing.T) {
+	assert := assert.New(t)
+
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	_, err := r.Invoke(context.Background(), "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "set", map[string]interface{}{
+		"i": map[bool]bool{false: true},
+	}, nil)
+	assert.Regexp("FFEC100365", err)
+	assert.Equal(400, err.(*InvokeError).Status)
+}
+
+func TestGatewayInvoke(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").
+		Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", mock.Anything, false).Return(nil, nil)
+	gw := &smartContractGW{r2e: r}
+
+	_, err := gw.Invoke(context.Background(), to, "set", nil, nil)
+	assert.Equal(404, err.(*InvokeError).Status)
+}
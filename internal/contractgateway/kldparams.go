@@ -17,11 +17,17 @@ package contractgateway
 import (
 	"net/http"
 	"net/textproto"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 )
 
+var flyParamName = regexp.MustCompile("^[a-z]+$")
+
 func getQueryParamNoCase(name string, req *http.Request) []string {
 	name = strings.ToLower(name)
 	req.ParseForm()
@@ -74,3 +80,50 @@ func getFlyParamMulti(name string, req *http.Request) (val []string) {
 	}
 	return
 }
+
+// getFlyParamSeconds returns a 'fly' param that is a positive number of seconds, which can
+// be fractional, as a duration. Returns zero if the param is not specified
+func getFlyParamSeconds(name string, req *http.Request) (time.Duration, error) {
+	valStr := getFlyParam(name, req)
+	if valStr == "" {
+		return 0, nil
+	}
+	secs, err := strconv.ParseFloat(valStr, 64)
+	if err != nil || secs <= 0 {
+		return 0, errors.Errorf(errors.RESTGatewayInvalidTimeout, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), valStr)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// normalizeFlyParamDefaults validates default values for 'fly' params, which can be named with or
+// without the prefix (such as 'fly-from' or 'from'), and returns them keyed by the name without the prefix
+func normalizeFlyParamDefaults(defaults map[string]string) (map[string]string, error) {
+	prefix := utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly") + "-"
+	normalized := make(map[string]string, len(defaults))
+	for name, value := range defaults {
+		n := strings.TrimPrefix(strings.ToLower(name), prefix)
+		if !flyParamName.MatchString(n) {
+			return nil, errors.Errorf(errors.RESTGatewayParamDefaultsInvalid, "invalid parameter name '"+name+"'")
+		}
+		if _, exists := normalized[n]; exists {
+			return nil, errors.Errorf(errors.RESTGatewayParamDefaultsInvalid, "duplicate parameter '"+n+"'")
+		}
+		normalized[n] = value
+	}
+	return normalized, nil
+}
+
+// applyFlyParamDefaults sets the default value of each 'fly' param that is not specified
+// on the request, in either the query params or headers
+func applyFlyParamDefaults(req *http.Request, defaults map[string]string) {
+	if len(defaults) == 0 {
+		return
+	}
+	req.ParseForm()
+	prefix := utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly") + "-"
+	for name, value := range defaults {
+		if getFlyParam(name, req) == "" && len(getQueryParamNoCase(prefix+name, req)) == 0 {
+			req.Form.Set(prefix+name, value)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"math/big"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// ContractABI returns the stored ABI of a registered contract, at the block a transaction was
+// mined in, so the transaction processor can decode the logs in the receipt
+func (g *smartContractGW) ContractABI(address string, blockNumber *big.Int) (ethbinding.ABIMarshaling, error) {
+	info, err := g.cs.GetContractByAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	abiID := info.ABI
+	if blockNumber != nil {
+		abiID = info.ABIAtBlock(blockNumber)
+	}
+	deployMsg, err := g.cs.GetABI(contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    abiID,
+	}, false)
+	if err != nil || deployMsg == nil || deployMsg.Contract == nil {
+		return nil, err
+	}
+	// The logs of a diamond contract can be emitted by any of its facets
+	merged, err := contractregistry.MergeFacets(g.cs, info, deployMsg.Contract)
+	if err != nil {
+		return nil, err
+	}
+	return merged.ABI, nil
+}
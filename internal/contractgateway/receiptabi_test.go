@@ -0,0 +1,88 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"fmt"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSmartContractGatewaySetsABIResolver(t *testing.T) {
+	dir := tempdir()
+	defer cleanup(dir)
+	assert := assert.New(t)
+	processor := &mockProcessor{}
+	s, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL:     "http://localhost/api/v1",
+			StoragePath: path.Join(dir, "abis"),
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, processor, nil, nil,
+	)
+	assert.NoError(err)
+	assert.Equal(s, processor.abiResolver)
+}
+
+func TestContractABI(t *testing.T) {
+	assert := assert.New(t)
+	scgw, _, _ := newTestETagGateway()
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw.cs = mcs
+	abi := ethbinding.ABIMarshaling{{Type: "event", Name: "Changed"}}
+	mcs.On("GetContractByAddress", "0x"+testUpgradeAddr).Return(&contractregistry.ContractInfo{
+		Address: testUpgradeAddr,
+		ABI:     "abi2",
+		ABIVersions: []*contractregistry.ABIVersion{
+			{ABI: "abi1", FromBlock: "0"},
+			{ABI: "abi2", FromBlock: "100"},
+		},
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: abi},
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi2"}, false).Return(nil, nil)
+
+	result, err := scgw.ContractABI("0x"+testUpgradeAddr, big.NewInt(99))
+	assert.NoError(err)
+	assert.Equal(abi, result)
+
+	result, err = scgw.ContractABI("0x"+testUpgradeAddr, nil)
+	assert.NoError(err)
+	assert.Nil(result)
+	mcs.AssertExpectations(t)
+}
+
+func TestContractABINotFound(t *testing.T) {
+	assert := assert.New(t)
+	scgw, _, _ := newTestETagGateway()
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw.cs = mcs
+	mcs.On("GetContractByAddress", "0x"+testUpgradeAddr).Return(nil, fmt.Errorf("pop"))
+
+	_, err := scgw.ContractABI("0x"+testUpgradeAddr, big.NewInt(1))
+	assert.Regexp("pop", err)
+}
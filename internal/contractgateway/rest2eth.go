@@ -57,6 +57,7 @@ type rest2EthSyncDispatcher interface {
 // rest2EthReplyProcessor interface
 type rest2EthReplyProcessor interface {
 	ReplyWithError(err error)
+	ReplyWithTXError(err error, txHash string)
 	ReplyWithReceipt(receipt messages.ReplyWithHeaders)
 	ReplyWithReceiptAndError(receipt messages.ReplyWithHeaders, err error)
 }
@@ -69,7 +70,11 @@ type rest2eth struct {
 	processor       tx.TxnProcessor
 	asyncDispatcher REST2EthAsyncDispatcher
 	syncDispatcher  rest2EthSyncDispatcher
+	syncPool        *syncRequestPool
+	idempotency     *idempotencyStore
 	subMgr          events.SubscriptionManager
+	abiImport       httprouter.Handle
+	contractRestore httprouter.Handle
 }
 
 type restAsyncMsg struct {
@@ -83,15 +88,22 @@ type restReceiptAndError struct {
 
 // rest2EthInflight is instantiated for each async reply in flight
 type rest2EthSyncResponder struct {
-	r      *rest2eth
-	res    http.ResponseWriter
-	req    *http.Request
-	done   bool
-	waiter *sync.Cond
+	r          *rest2eth
+	res        http.ResponseWriter
+	req        *http.Request
+	idempotent *idempotentRequest
+	done       bool
+	waiter     *sync.Cond
 }
 
 var addrCheck = regexp.MustCompile("^(0x)?[0-9a-z]{40}$")
 
+const (
+	// fromZero can be supplied as the from of a query, to make the call from the zero address
+	fromZero        = "zero"
+	zeroFromAddress = "0x0000000000000000000000000000000000000000"
+)
+
 func (i *rest2EthSyncResponder) ReplyWithError(err error) {
 	i.r.restErrReply(i.res, i.req, err, 500)
 	i.done = true
@@ -99,7 +111,15 @@ func (i *rest2EthSyncResponder) ReplyWithError(err error) {
 	return
 }
 
+// ReplyWithTXError replies with an error for a transaction that has already been sent, such as a
+// timeout waiting for the receipt
+func (i *rest2EthSyncResponder) ReplyWithTXError(err error, txHash string) {
+	i.idempotent.markSent(txHash)
+	i.ReplyWithError(err)
+}
+
 func (i *rest2EthSyncResponder) ReplyWithReceiptAndError(receipt messages.ReplyWithHeaders, err error) {
+	i.idempotent.markSent(receiptTXHash(receipt))
 	status := 500
 	reply, _ := json.MarshalIndent(&restReceiptAndError{err.Error(), receipt}, "", "  ")
 	log.Infof("<-- %s %s [%d]", i.req.Method, i.req.URL, status)
@@ -113,6 +133,7 @@ func (i *rest2EthSyncResponder) ReplyWithReceiptAndError(receipt messages.ReplyW
 }
 
 func (i *rest2EthSyncResponder) ReplyWithReceipt(receipt messages.ReplyWithHeaders) {
+	i.idempotent.markSent(receiptTXHash(receipt))
 	txReceiptMsg := receipt.IsReceipt()
 	if txReceiptMsg != nil && txReceiptMsg.ContractAddress != nil {
 		if err := i.r.gw.PostDeploy(txReceiptMsg); err != nil {
@@ -150,11 +171,12 @@ func newREST2eth(gw SmartContractGateway, cr contractregistry.ContractResolver,
 
 func (r *rest2eth) addRoutes(router *httprouter.Router) {
 	// Built-in registry managed routes
-	router.POST("/contracts/:address/:method", r.restHandler)
+	router.POST("/contracts/:address/:method", r.invokeOrRestoreHandler)
 	router.GET("/contracts/:address/:method", r.restHandler)
 	router.POST("/contracts/:address/:method/:subcommand", r.restHandler)
+	router.GET("/contracts/:address/:method/:subcommand/:arg", r.tokenHandler)
 
-	router.POST("/abis/:abi", r.restHandler)
+	router.POST("/abis/:abi", r.deployOrImportHandler)
 	router.POST("/abis/:abi/:address/:method", r.restHandler)
 	router.GET("/abis/:abi/:address/:method", r.restHandler)
 	router.POST("/abis/:abi/:address/:method/:subcommand", r.restHandler)
@@ -177,6 +199,8 @@ func (r *rest2eth) addRoutes(router *httprouter.Router) {
 	router.POST("/g/:gateway_lookup/:address/:method", r.restHandler)
 	router.GET("/g/:gateway_lookup/:address/:method", r.restHandler)
 	router.POST("/g/:gateway_lookup/:address/:method/:subcommand", r.restHandler)
+	router.POST("/transactions/:hash/speedup", r.speedUpHandler)
+	router.POST("/transactions/:hash/cancel", r.cancelHandler)
 }
 
 type restCmd struct {
@@ -184,22 +208,30 @@ type restCmd struct {
 	addr            string
 	value           json.Number
 	abiLocation     *contractregistry.ABILocation
+	methodPolicy    *contractregistry.MethodPolicy
+	guards          []*contractregistry.MethodGuard
+	registeredDecs  map[string]int
+	decimals        map[string]int
 	abiMethod       *ethbinding.ABIMethod
 	abiMethodElem   *ethbinding.ABIElementMarshaling
 	abiEvent        *ethbinding.ABIEvent
 	abiEventElem    *ethbinding.ABIElementMarshaling
+	abiEvents       ethbinding.ABIMarshaling
+	abiErrors       ethbinding.ABIMarshaling
 	isDeploy        bool
 	deployMsg       *messages.DeployContract
 	body            map[string]interface{}
 	msgParams       []interface{}
 	blocknumber     string
 	transactionHash string
+	fromZero        bool
 }
 
 func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params httprouter.Params, c *restCmd, addrParam string) (a ethbinding.ABIMarshaling, validAddress bool, err error) {
 	c.addr = strings.ToLower(strings.TrimPrefix(addrParam, "0x"))
 	validAddress = addrCheck.MatchString(c.addr)
 	var location contractregistry.ABILocation
+	var info *contractregistry.ContractInfo
 
 	// There are multiple ways we resolve the path into an ABI
 	// 1. we lookup it up remotely in a REST attached contract registry (the newer option)
@@ -221,22 +253,38 @@ func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params
 		abiID := params.ByName("abi")
 		if abiID != "" {
 			location.Name = abiID
+			if validAddress {
+				// Calling a registered contract through its ABI must not bypass the policy, guards and defaults of its registration
+				var registered *contractregistry.ContractInfo
+				if registered, err = r.registeredContract(c.addr); err != nil {
+					r.restErrReply(res, req, err, 500)
+					return
+				}
+				if registered != nil {
+					c.methodPolicy = registered.MethodPolicy
+					c.guards = registered.Guards
+					applyFlyParamDefaults(req, registered.ParamDefaults)
+				}
+			}
 		} else {
 			if !validAddress {
 				// Resolve the address as a registered name, to an actual contract address
 				if c.addr, err = r.cr.ResolveContractAddress(addrParam); err != nil {
-					r.restErrReply(res, req, err, 404)
+					r.restErrReply(res, req, err, lookupErrStatus(err))
 					return
 				}
 			}
 			validAddress = true
 			addrParam = c.addr
-			var info *contractregistry.ContractInfo
 			if info, err = r.cr.GetContractByAddress(addrParam); err != nil {
-				r.restErrReply(res, req, err, 404)
+				r.restErrReply(res, req, err, lookupErrStatus(err))
 				return
 			}
 			location.Name = info.ABI
+			c.methodPolicy = info.MethodPolicy
+			c.guards = info.Guards
+			c.registeredDecs = info.Decimals
+			applyFlyParamDefaults(req, info.ParamDefaults)
 		}
 	}
 
@@ -248,20 +296,50 @@ func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params
 		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInstanceNotFound)
 		r.restErrReply(res, req, err, 404)
 		return
+	} else if location.ABIType == contractregistry.LocalABI && params.ByName("abi") != "" && deployMsg.Contract.Deleted != "" {
+		// Deleted ABIs are still loaded for the contracts and subscriptions that use them, but cannot be used directly
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayABIDeleted, location.Name, deployMsg.Contract.Deleted)
+		r.restErrReply(res, req, err, 410)
+		return
+	}
+	// The methods and events of the facets of a diamond contract are all callable under its path
+	if c.deployMsg, err = contractregistry.MergeFacets(r.cr, info, deployMsg.Contract); err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
 	}
-	c.deployMsg = deployMsg.Contract
 	c.deployMsg.Headers.ABIID = deployMsg.Contract.Headers.ID // Reference to the original ABI needs to flow through for registration
 	c.abiLocation = &location
 	if deployMsg.Address != "" {
 		c.addr = deployMsg.Address
 	}
 	a = c.deployMsg.ABI
+	c.abiErrors = eth.ABIErrors(a)
 	return
 }
 
+// registeredContract returns the registration of the contract at an address, or nil if there is none
+func (r *rest2eth) registeredContract(addrHexNo0x string) (*contractregistry.ContractInfo, error) {
+	info, err := r.cr.GetContractByAddress(addrHexNo0x)
+	if err != nil {
+		if e, ok := err.(ethconnecterrors.EthconnectError); ok && e.Code() == ethconnecterrors.RESTGatewayLocalStoreContractNotFound.Code() {
+			return nil, nil
+		}
+		if contractregistry.IsDeleted(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
 func (r *rest2eth) resolveMethod(res http.ResponseWriter, req *http.Request, c *restCmd, a ethbinding.ABIMarshaling, methodParam string) (err error) {
+	hidden := false
 	for _, element := range a {
 		if element.Type == "function" && element.Name == methodParam {
+			if !c.methodPolicy.Permits(&element) {
+				hidden = true
+				continue
+			}
 			c.abiMethodElem = &element
 			if c.abiMethod, err = ethbind.API.ABIElementMarshalingToABIMethod(&element); err != nil {
 				err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodABIInvalid, methodParam, err)
@@ -271,9 +349,39 @@ func (r *rest2eth) resolveMethod(res http.ResponseWriter, req *http.Request, c *
 			return
 		}
 	}
+	if hidden {
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodNotExposed, url.QueryEscape(methodParam), c.addr)
+		r.restErrReply(res, req, err, 403)
+	}
 	return
 }
 
+// contractEvents returns the events declared in an ABI, for a subscription to all the events of a contract
+func contractEvents(a ethbinding.ABIMarshaling) ethbinding.ABIMarshaling {
+	events := ethbinding.ABIMarshaling{}
+	for _, element := range a {
+		if element.Type == "event" {
+			events = append(events, element)
+		}
+	}
+	return events
+}
+
+// isEventsOnlyABI is true for an ABI that declares events, and no functions or constructor
+func isEventsOnlyABI(a ethbinding.ABIMarshaling) bool {
+	hasEvents := false
+	for _, element := range a {
+		switch element.Type {
+		case "event":
+			hasEvents = true
+		case "error":
+		default:
+			return false
+		}
+	}
+	return hasEvents
+}
+
 func (r *rest2eth) resolveConstructor(res http.ResponseWriter, req *http.Request, c *restCmd, a ethbinding.ABIMarshaling) (err error) {
 	for _, element := range a {
 		if element.Type == "constructor" {
@@ -287,6 +395,11 @@ func (r *rest2eth) resolveConstructor(res http.ResponseWriter, req *http.Request
 			return
 		}
 	}
+	if isEventsOnlyABI(a) && len(c.deployMsg.Compiled) == 0 {
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventsOnlyNotDeployable)
+		r.restErrReply(res, req, err, 400)
+		return
+	}
 	if !c.isDeploy {
 		// Default constructor
 		c.abiMethodElem = &ethbinding.ABIElementMarshaling{
@@ -356,6 +469,16 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 		}
 	}
 
+	// A subscribe on a contract address without an event name, is a subscription to all of its events
+	if c.abiMethod == nil && c.abiEvent == nil && methodParamLC == "subscribe" && c.addr != "" && validAddress {
+		c.abiEvents = contractEvents(a)
+		if len(c.abiEvents) == 0 {
+			err = ethconnecterrors.Errorf(ethconnecterrors.EventStreamsSubscribeNoContractEvents)
+			r.restErrReply(res, req, err, 400)
+			return
+		}
+	}
+
 	// Last case is the constructor, where nothing is specified
 	if methodParam == "" && c.abiMethod == nil && c.abiEvent == nil {
 		if err = r.resolveConstructor(res, req, &c, a); err != nil {
@@ -364,7 +487,7 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 	}
 
 	// If we didn't find the method or event, report to the user
-	if c.abiMethod == nil && c.abiEvent == nil {
+	if c.abiMethod == nil && c.abiEvent == nil && c.abiEvents == nil {
 		if methodParamLC == "subscribe" {
 			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventNotDeclared, methodParam)
 			r.restErrReply(res, req, err, 404)
@@ -389,7 +512,10 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 	// If we have a from, it needs to be a valid address
 	From := getFlyParam("from", req)
 	fromNo0xPrefix := strings.ToLower(strings.TrimPrefix(From, "0x"))
-	if fromNo0xPrefix != "" {
+	if strings.EqualFold(From, fromZero) {
+		c.from = zeroFromAddress
+		c.fromZero = true
+	} else if fromNo0xPrefix != "" {
 		if addrCheck.MatchString(fromNo0xPrefix) {
 			c.from = "0x" + fromNo0xPrefix
 		} else if tx.IsHDWalletRequest(fromNo0xPrefix) != nil {
@@ -412,10 +538,17 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 	c.blocknumber = getFlyParam("blocknumber", req)
 	c.transactionHash = getFlyParam("transaction", req)
 
-	if c.abiEvent != nil || c.transactionHash != "" {
+	if c.abiEvent != nil || c.abiEvents != nil || c.transactionHash != "" {
 		return
 	}
 
+	// Amounts are converted between human amounts and base units, for parameters with declared decimals
+	methodName := c.abiMethod.Name
+	if c.isDeploy {
+		methodName = "constructor"
+	}
+	c.decimals = methodDecimals(c.registeredDecs, c.deployMsg.DevDoc, methodName, c.abiMethod)
+
 	c.msgParams = make([]interface{}, len(c.abiMethod.Inputs))
 	queryParams := req.Form
 	for i, abiParam := range c.abiMethod.Inputs {
@@ -437,11 +570,55 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 			r.restErrReply(res, req, err, 400)
 			return
 		}
+		if d, ok := c.decimals[argName]; ok {
+			if c.msgParams[i], err = inputToBaseUnits(argName, &abiParam.Type, c.msgParams[i], d); err != nil {
+				r.restErrReply(res, req, err, 400)
+				return
+			}
+		}
+		// Identifiers such as DIDs supplied for addresses are resolved, so applications need not handle chain addresses
+		if c.msgParams[i], err = resolveAddressInputs(req.Context(), argName, &abiParam.Type, c.msgParams[i]); err != nil {
+			r.restErrReply(res, req, err, 400)
+			return
+		}
 	}
 
 	return
 }
 
+// deployOrImportHandler passes POST /abis/import to the import handler, as httprouter
+// does not allow a static path segment alongside the :abi wildcard
+func (r *rest2eth) deployOrImportHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	if params.ByName("abi") == "import" && r.abiImport != nil {
+		r.abiImport(res, req, params)
+		return
+	}
+	r.restHandler(res, req, params)
+}
+
+// invokeOrRestoreHandler passes POST /contracts/:address/restore to the restore handler, as httprouter
+// does not allow a static path segment alongside the :method parameter. This is only done for
+// a deleted contract, which cannot be invoked, so a contract can still have a method named restore
+func (r *rest2eth) invokeOrRestoreHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	if params.ByName("method") == "restore" && r.contractRestore != nil && r.isDeletedContract(params.ByName("address")) {
+		r.contractRestore(res, req, params)
+		return
+	}
+	r.restHandler(res, req, params)
+}
+
+// isDeletedContract checks if an address or registered name is for a contract that has been deleted
+func (r *rest2eth) isDeletedContract(addrParam string) bool {
+	addr := strings.ToLower(strings.TrimPrefix(addrParam, "0x"))
+	var err error
+	if addrCheck.MatchString(addr) {
+		_, err = r.cr.GetContractByAddress(addr)
+	} else {
+		_, err = r.cr.ResolveContractAddress(addrParam)
+	}
+	return contractregistry.IsDeleted(err)
+}
+
 func (r *rest2eth) restHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
@@ -450,20 +627,42 @@ func (r *rest2eth) restHandler(res http.ResponseWriter, req *http.Request, param
 		return
 	}
 
-	if c.abiEvent != nil {
-		r.subscribeEvent(res, req, c.addr, c.abiLocation, c.abiEventElem, c.body)
+	// The deadline of the request applies to the calls to the node, and to waiting for the
+	// receipt of a sync request. A client disconnecting cancels the context in the same way
+	timeout, err := getFlyParamSeconds("timeout", req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	if c.abiEvent != nil || c.abiEvents != nil {
+		r.subscribeEvent(res, req, c.addr, c.abiLocation, c.abiEventElem, c.abiEvents, c.body)
 	} else if c.transactionHash != "" {
 		r.lookupTransaction(res, req, c.transactionHash, c.abiMethod)
 	} else if req.Method != http.MethodPost || c.abiMethod.IsConstant() || getFlyParamBool("call", req) {
-		r.callContract(res, req, c.from, c.addr, c.value, c.abiMethod, c.msgParams, c.blocknumber)
+		if status, err := r.waitForAfterTx(req); err != nil {
+			r.restErrReply(res, req, err, status)
+			return
+		}
+		r.callContract(res, req, c.from, c.addr, c.value, c.abiMethod, c.abiErrors, c.msgParams, c.blocknumber, c.decimals)
 	} else {
 		if c.from == "" {
 			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMissingFromAddress, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly"))
 			r.restErrReply(res, req, err, 400)
+		} else if c.fromZero {
+			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayZeroFromNotQuery, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"))
+			r.restErrReply(res, req, err, 400)
 		} else if c.isDeploy {
 			r.deployContract(res, req, c.from, c.value, c.abiMethodElem, c.deployMsg, c.msgParams)
+		} else if status, err := r.checkGuards(req.Context(), &c); err != nil {
+			r.restErrReply(res, req, err, status)
 		} else {
-			r.sendTransaction(res, req, c.from, c.addr, c.value, c.abiMethodElem, c.msgParams)
+			r.sendTransaction(res, req, c.from, c.addr, c.value, c.abiMethod, c.abiMethodElem, c.abiErrors, c.msgParams)
 		}
 	}
 }
@@ -477,7 +676,8 @@ func (r *rest2eth) fromBodyOrForm(req *http.Request, body map[string]interface{}
 	return req.FormValue(param)
 }
 
-func (r *rest2eth) subscribeEvent(res http.ResponseWriter, req *http.Request, addrStr string, abi *contractregistry.ABILocation, abiEvent *ethbinding.ABIElementMarshaling, body map[string]interface{}) {
+// subscribeEvent subscribes to a single event, or to every event in the ABI of a contract when abiEvents is set
+func (r *rest2eth) subscribeEvent(res http.ResponseWriter, req *http.Request, addrStr string, abi *contractregistry.ABILocation, abiEvent *ethbinding.ABIElementMarshaling, abiEvents ethbinding.ABIMarshaling, body map[string]interface{}) {
 
 	err := auth.AuthEventStreams(req.Context())
 	if err != nil {
@@ -504,7 +704,28 @@ func (r *rest2eth) subscribeEvent(res http.ResponseWriter, req *http.Request, ad
 	// if the end user provided a name for the subscription, use it
 	// If not provided, it will be set to a system-generated summary
 	name := r.fromBodyOrForm(req, body, "name")
-	sub, err := r.subMgr.AddSubscription(req.Context(), addr, abi, abiEvent, streamID, fromBlock, name)
+	// A filter on the values of indexed arguments can only be supplied in a JSON body
+	filter, _ := body["filter"].(map[string]interface{})
+	// The definition of the event in the installed ABI can be overridden in a JSON body, such as to
+	// decode an event emitted as anonymous, or with different indexed arguments
+	if override, ok := body["event"].(map[string]interface{}); ok && abiEvents == nil {
+		b, _ := json.Marshal(override)
+		abiEvent = &ethbinding.ABIElementMarshaling{}
+		if err := json.Unmarshal(b, abiEvent); err != nil {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventOverrideInvalid, err), 400)
+			return
+		}
+	}
+	var sub *events.SubscriptionInfo
+	if abiEvents != nil {
+		if len(filter) > 0 {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.EventStreamsSubscribeFilterMultipleEvents), 400)
+			return
+		}
+		sub, err = r.subMgr.AddSubscriptionAllEvents(req.Context(), addr, abi, abiEvents, streamID, fromBlock, name)
+	} else {
+		sub, err = r.subMgr.AddSubscription(req.Context(), addr, abi, abiEvent, filter, streamID, fromBlock, name)
+	}
 	if err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
@@ -540,6 +761,11 @@ func (r *rest2eth) addPrivateTx(msg *messages.TransactionCommon, req *http.Reque
 	return nil
 }
 
+func (r *rest2eth) addRequestEcho(msg *messages.TransactionCommon, req *http.Request) {
+	msg.EchoRequest = getFlyParamBool("echo", req)
+	msg.RequestPath = req.URL.Path
+}
+
 func (r *rest2eth) assignMessageID(headers *messages.RequestHeaders, req *http.Request) {
 	headers.ID = getFlyParam("id", req)
 	if headers.ID == "" {
@@ -554,12 +780,15 @@ func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, fr
 	deployMsg.From = from
 	deployMsg.Gas = json.Number(getFlyParam("gas", req))
 	deployMsg.GasPrice = json.Number(getFlyParam("gasprice", req))
+	deployMsg.MaxFeePerGas = json.Number(getFlyParam("maxfee", req))
+	deployMsg.MaxPriorityFeePerGas = json.Number(getFlyParam("priorityfee", req))
 	deployMsg.Value = value
 	deployMsg.Parameters = msgParams
 	if err := r.addPrivateTx(&deployMsg.TransactionCommon, req, res); err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
 	}
+	r.addRequestEcho(&deployMsg.TransactionCommon, req)
 	deployMsg.RegisterAs = getFlyParam("register", req)
 	if deployMsg.RegisterAs != "" {
 		if err := r.cr.CheckNameAvailable(deployMsg.RegisterAs, contractregistry.IsRemote(deployMsg.Headers.CommonHeaders)); err != nil {
@@ -567,13 +796,29 @@ func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, fr
 			return
 		}
 	}
-	if getFlyParamBool("sync", req) {
+	isSync := getFlyParamBool("sync", req)
+	ir, replayed := r.startIdempotent(res, req, deployMsg.Headers.ID, from, value, msgParams, isSync)
+	if replayed {
+		return
+	}
+	if ir != nil {
+		res = ir
+		defer ir.finish()
+	}
+	if isSync {
+		if err := r.syncPool.acquire(req.Context()); err != nil {
+			res.Header().Set("Retry-After", strconv.Itoa(r.syncPool.retryAfter))
+			r.restErrReply(res, req, err, 503)
+			return
+		}
+		defer r.syncPool.release()
 		responder := &rest2EthSyncResponder{
-			r:      r,
-			res:    res,
-			req:    req,
-			done:   false,
-			waiter: sync.NewCond(&sync.Mutex{}),
+			r:          r,
+			res:        res,
+			req:        req,
+			idempotent: ir,
+			done:       false,
+			waiter:     sync.NewCond(&sync.Mutex{}),
 		}
 		r.syncDispatcher.DispatchDeployContractSync(req.Context(), deployMsg, responder)
 		responder.waiter.L.Lock()
@@ -598,30 +843,114 @@ func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, fr
 	return
 }
 
-func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethodElem *ethbinding.ABIElementMarshaling, msgParams []interface{}) {
+// simulateTransaction runs a transaction as an eth_call against the latest block, so the outcome
+// can be returned in the ack of an async submission before the transaction is mined
+func (r *rest2eth) simulateTransaction(ctx context.Context, from, addr string, value json.Number, abiMethod *ethbinding.ABIMethod, abiErrors ethbinding.ABIMarshaling, msgParams []interface{}) *messages.SimulationResult {
+	resolvedFrom, err := r.processor.ResolveAddress(from)
+	var outputs map[string]interface{}
+	if err == nil {
+		outputs, err = eth.CallMethod(ctx, r.rpc, nil, resolvedFrom, addr, value, abiMethod, msgParams, "latest", abiErrors)
+	}
+	if err != nil {
+		log.Warnf("Simulation of %s on %s failed: %s", abiMethod.Name, addr, err)
+		return &messages.SimulationResult{
+			Success: false,
+			Error:   ethconnecterrors.ToRESTError(err).Message,
+		}
+	}
+	return &messages.SimulationResult{
+		Success: true,
+		Outputs: outputs,
+	}
+}
+
+// checkGuards calls each guard registered for the contract that applies to the method, and
+// rejects the transaction if any of them does not return true for the sender. This turns a
+// transaction that would revert on-chain into an immediate 403, with a reason for the caller
+func (r *rest2eth) checkGuards(ctx context.Context, c *restCmd) (int, error) {
+	if len(c.guards) == 0 {
+		return 0, nil
+	}
+	from, err := r.processor.ResolveAddress(c.from)
+	if err != nil {
+		return 500, err
+	}
+	for _, guard := range c.guards {
+		if !guard.AppliesTo(c.abiMethodElem) {
+			continue
+		}
+		element, err := guard.FunctionABI()
+		if err != nil {
+			return 500, err
+		}
+		method, err := ethbind.API.ABIElementMarshalingToABIMethod(element)
+		if err != nil {
+			return 500, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardCheckFailed, guard.Function, err)
+		}
+		addr := guard.Address
+		if addr == "" {
+			addr = c.addr
+		}
+		outputs, err := eth.CallMethod(ctx, r.rpc, nil, from, addr, "", method, guard.CallParams(from), "latest", nil)
+		if err != nil {
+			return 500, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardCheckFailed, guard.Function, err)
+		}
+		if allowed, _ := outputs["output"].(bool); !allowed {
+			reason := guard.Reason
+			if reason == "" {
+				reason = guard.Function + " returned false"
+			}
+			log.Warnf("Guard %s rejected %s from %s to %s", guard.Function, c.abiMethodElem.Name, from, c.addr)
+			return 403, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardDenied, from, c.addr, reason)
+		}
+	}
+	return 0, nil
+}
+
+func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethod *ethbinding.ABIMethod, abiMethodElem *ethbinding.ABIElementMarshaling, abiErrors ethbinding.ABIMarshaling, msgParams []interface{}) {
 
 	msg := &messages.SendTransaction{}
 	r.assignMessageID(&msg.Headers, req)
 	msg.Headers.MsgType = messages.MsgTypeSendTransaction
 	msg.Method = abiMethodElem
+	msg.Errors = abiErrors
 	msg.To = addr
 	msg.From = from
 	msg.Gas = json.Number(getFlyParam("gas", req))
 	msg.GasPrice = json.Number(getFlyParam("gasprice", req))
+	msg.MaxFeePerGas = json.Number(getFlyParam("maxfee", req))
+	msg.MaxPriorityFeePerGas = json.Number(getFlyParam("priorityfee", req))
 	msg.Value = value
 	msg.Parameters = msgParams
 	if err := r.addPrivateTx(&msg.TransactionCommon, req, res); err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
 	}
+	r.addRequestEcho(&msg.TransactionCommon, req)
 
-	if getFlyParamBool("sync", req) {
+	isSync := getFlyParamBool("sync", req)
+	ir, replayed := r.startIdempotent(res, req, msg.Headers.ID, from, value, msgParams, isSync)
+	if replayed {
+		return
+	}
+	if ir != nil {
+		res = ir
+		defer ir.finish()
+	}
+	if isSync {
+		if err := r.syncPool.acquire(req.Context()); err != nil {
+			res.Header().Set("Retry-After", strconv.Itoa(r.syncPool.retryAfter))
+			r.restErrReply(res, req, err, 503)
+			return
+		}
+		defer r.syncPool.release()
 		responder := &rest2EthSyncResponder{
-			r:      r,
-			res:    res,
-			req:    req,
-			done:   false,
-			waiter: sync.NewCond(&sync.Mutex{}),
+			r:          r,
+			res:        res,
+			req:        req,
+			idempotent: ir,
+			done:       false,
+			waiter:     sync.NewCond(&sync.Mutex{}),
 		}
 		r.syncDispatcher.DispatchSendTransactionSync(req.Context(), msg, responder)
 		responder.waiter.L.Lock()
@@ -631,6 +960,10 @@ func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, f
 	} else {
 		ack := !getFlyParamBool("noack", req) // turn on ack's by default
 		immediateReceipt := strings.EqualFold(getFlyParam("acktype", req), "receipt")
+		var simulation *messages.SimulationResult
+		if getFlyParamBool("simulate", req) {
+			simulation = r.simulateTransaction(req.Context(), from, addr, value, abiMethod, abiErrors, msgParams)
+		}
 
 		// Async messages are dispatched as generic map payloads.
 		// We are confident in the re-serialization here as we've deserialized from JSON then built our own structure
@@ -640,24 +973,32 @@ func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, f
 		if asyncResponse, status, err := r.asyncDispatcher.DispatchMsgAsync(req.Context(), mapMsg, ack, immediateReceipt); err != nil {
 			r.restErrReply(res, req, err, status)
 		} else {
+			if simulation != nil {
+				asyncResponse.Simulation = simulation
+			}
 			r.restAsyncReply(res, req, asyncResponse)
 		}
 	}
 	return
 }
 
-func (r *rest2eth) callContract(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethod *ethbinding.ABIMethod, msgParams []interface{}, blocknumber string) {
+func (r *rest2eth) callContract(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethod *ethbinding.ABIMethod, abiErrors ethbinding.ABIMarshaling, msgParams []interface{}, blocknumber string, decimals map[string]int) {
 	var err error
-	if from, err = r.processor.ResolveAddress(from); err != nil {
-		r.restErrReply(res, req, err, 500)
-		return
+	// Nothing is signed for a query, so any address can be the sender. Only HD wallet
+	// requests need resolving to the address of the signer
+	if tx.IsHDWalletRequest(from) != nil {
+		if from, err = r.processor.ResolveAddress(from); err != nil {
+			r.restErrReply(res, req, err, 500)
+			return
+		}
 	}
 
-	resBody, err := eth.CallMethod(req.Context(), r.rpc, nil, from, addr, value, abiMethod, msgParams, blocknumber)
+	resBody, err := eth.CallMethod(req.Context(), r.rpc, nil, from, addr, value, abiMethod, msgParams, blocknumber, abiErrors)
 	if err != nil {
 		r.restErrReply(res, req, err, 500)
 		return
 	}
+	outputsFromBaseUnits(abiMethod.Outputs, resBody, decimals)
 	resBytes, _ := json.MarshalIndent(&resBody, "", "  ")
 	status := 200
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
@@ -24,6 +24,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/auth"
 	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
@@ -51,9 +52,11 @@ type mockREST2EthDispatcher struct {
 	sendTransactionMsg         *messages.SendTransaction
 	sendTransactionSyncReceipt *messages.TransactionReceipt
 	sendTransactionSyncError   error
+	sendTransactionSyncTXHash  string
 	deployContractMsg          *messages.DeployContract
 	deployContractSyncReceipt  *messages.TransactionReceipt
 	deployContractSyncError    error
+	sendTransactionSyncCtx     context.Context
 }
 
 func (m *mockREST2EthDispatcher) DispatchMsgAsync(ctx context.Context, msg map[string]interface{}, ack, immediateReceipt bool) (*messages.AsyncSentMsg, int, error) {
@@ -64,7 +67,10 @@ func (m *mockREST2EthDispatcher) DispatchMsgAsync(ctx context.Context, msg map[s
 
 func (m *mockREST2EthDispatcher) DispatchSendTransactionSync(ctx context.Context, msg *messages.SendTransaction, replyProcessor rest2EthReplyProcessor) {
 	m.sendTransactionMsg = msg
-	if m.sendTransactionSyncError != nil {
+	m.sendTransactionSyncCtx = ctx
+	if m.sendTransactionSyncError != nil && m.sendTransactionSyncTXHash != "" {
+		replyProcessor.ReplyWithTXError(m.sendTransactionSyncError, m.sendTransactionSyncTXHash)
+	} else if m.sendTransactionSyncError != nil {
 		replyProcessor.ReplyWithError(m.sendTransactionSyncError)
 	} else {
 		replyProcessor.ReplyWithReceipt(m.sendTransactionSyncReceipt)
@@ -92,18 +98,39 @@ func (m *mockGateway) PostDeploy(msg *messages.TransactionReceipt) error {
 }
 func (m *mockGateway) AddRoutes(router *httprouter.Router) { return }
 func (m *mockGateway) Shutdown()                           { return }
+func (m *mockGateway) Invoke(ctx context.Context, addr, method string, params map[string]interface{}, opts *InvokeOptions) (*InvokeResult, error) {
+	return nil, nil
+}
 
 type mockSubMgr struct {
 	err             error
 	updateStreamErr error
+	updateSubErr    error
+	captureUpdate   *events.SubscriptionUpdateDTO
+	backup          *events.EventsBackup
+	importResult    *events.EventsImportResult
 	captureSub      *events.SubscriptionCreateDTO
+	captureSubs     []*events.SubscriptionCreateDTO
+	batchResults    []*events.SubscriptionBatchResult
 	sub             *events.SubscriptionInfo
 	stream          *events.StreamInfo
 	subs            []*events.SubscriptionInfo
 	streams         []*events.StreamInfo
 	suspended       bool
 	resumed         bool
+	suspendedAll    bool
+	resumedAll      bool
+	checkpoint      *events.SubscriptionCheckpoint
+	deadLetters     []*events.DeadLetter
+	metrics         *events.StreamMetrics
+	heartbeat       *events.Heartbeat
+	requeued        string
+	deletedDL       string
 	capturedAddr    *ethbinding.Address
+	capturedEvents  ethbinding.ABIMarshaling
+	capturedEvent   *ethbinding.ABIElementMarshaling
+	capturedFilter  map[string]interface{}
+	upgraded        string
 }
 
 func (m *mockSubMgr) Init() error { return m.err }
@@ -125,9 +152,41 @@ func (m *mockSubMgr) ResumeStream(ctx context.Context, id string) error {
 	m.resumed = true
 	return m.err
 }
+func (m *mockSubMgr) SuspendAllStreams(ctx context.Context) error {
+	m.suspendedAll = true
+	return m.err
+}
+func (m *mockSubMgr) ResumeAllStreams(ctx context.Context) error {
+	m.resumedAll = true
+	return m.err
+}
 func (m *mockSubMgr) DeleteStream(ctx context.Context, id string) error { return m.err }
-func (m *mockSubMgr) AddSubscription(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string) (*events.SubscriptionInfo, error) {
+func (m *mockSubMgr) StreamMetrics(ctx context.Context, id string) (*events.StreamMetrics, error) {
+	return m.metrics, m.err
+}
+func (m *mockSubMgr) LastHeartbeat(ctx context.Context) (*events.Heartbeat, error) {
+	return m.heartbeat, m.err
+}
+func (m *mockSubMgr) DeadLetters(ctx context.Context, streamID string) ([]*events.DeadLetter, error) {
+	return m.deadLetters, m.err
+}
+func (m *mockSubMgr) RequeueDeadLetter(ctx context.Context, streamID, id string) error {
+	m.requeued = id
+	return m.err
+}
+func (m *mockSubMgr) DeleteDeadLetter(ctx context.Context, streamID, id string) error {
+	m.deletedDL = id
+	return m.err
+}
+func (m *mockSubMgr) AddSubscription(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, event *ethbinding.ABIElementMarshaling, filter map[string]interface{}, streamID, initialBlock, name string) (*events.SubscriptionInfo, error) {
 	m.capturedAddr = addr
+	m.capturedEvent = event
+	m.capturedFilter = filter
+	return m.sub, m.err
+}
+func (m *mockSubMgr) AddSubscriptionAllEvents(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, events ethbinding.ABIMarshaling, streamID, initialBlock, name string) (*events.SubscriptionInfo, error) {
+	m.capturedAddr = addr
+	m.capturedEvents = events
 	return m.sub, m.err
 }
 func (m *mockSubMgr) AddSubscriptionDirect(ctx context.Context, newSub *events.SubscriptionCreateDTO) (*events.SubscriptionInfo, error) {
@@ -135,18 +194,43 @@ func (m *mockSubMgr) AddSubscriptionDirect(ctx context.Context, newSub *events.S
 	m.captureSub = newSub
 	return m.sub, m.err
 }
+func (m *mockSubMgr) AddSubscriptions(ctx context.Context, newSubs []*events.SubscriptionCreateDTO) ([]*events.SubscriptionBatchResult, error) {
+	m.captureSubs = newSubs
+	return m.batchResults, m.err
+}
 func (m *mockSubMgr) Subscriptions(ctx context.Context) []*events.SubscriptionInfo { return m.subs }
 func (m *mockSubMgr) SubscriptionByID(ctx context.Context, id string) (*events.SubscriptionInfo, error) {
 	return m.sub, m.err
 }
 func (m *mockSubMgr) DeleteSubscription(ctx context.Context, id string) error { return m.err }
+func (m *mockSubMgr) ContractUpgraded(ctx context.Context, address string) {
+	m.upgraded = address
+}
+func (m *mockSubMgr) UpdateSubscription(ctx context.Context, id string, update *events.SubscriptionUpdateDTO) (*events.SubscriptionInfo, error) {
+	m.captureUpdate = update
+	return m.sub, m.updateSubErr
+}
 func (m *mockSubMgr) ResetSubscription(ctx context.Context, id, initialBlock string) error {
 	return m.err
 }
+func (m *mockSubMgr) ExportCheckpoint(ctx context.Context, id string) (*events.SubscriptionCheckpoint, error) {
+	return m.checkpoint, m.err
+}
+func (m *mockSubMgr) ImportCheckpoint(ctx context.Context, id string, cp *events.SubscriptionCheckpoint) error {
+	m.checkpoint = cp
+	return m.err
+}
+func (m *mockSubMgr) ExportEvents(ctx context.Context) (*events.EventsBackup, error) {
+	return m.backup, m.err
+}
+func (m *mockSubMgr) ImportEvents(ctx context.Context, backup *events.EventsBackup) (*events.EventsImportResult, error) {
+	m.backup = backup
+	return m.importResult, m.err
+}
 func (m *mockSubMgr) Close(wait bool) {}
 
 func newTestDeployMsg(t *testing.T, addr string) *contractregistry.DeployContractWithAddress {
-	compiled, err := eth.CompileContract(simpleEventsSource(), "SimpleEvents", "", "")
+	compiled, err := eth.CompileContract(&eth.SolcConf{}, simpleEventsSource(), "SimpleEvents", "", "")
 	assert.NoError(t, err)
 	return &contractregistry.DeployContractWithAddress{
 		Contract: &messages.DeployContract{ABI: compiled.ABI},
@@ -182,6 +266,12 @@ func expectContractSuccess(t *testing.T, mcr *contractregistrymocks.ContractStor
 	expectABISuccess(t, mcr, "abi1")
 }
 
+func expectNotRegistered(mcr *contractregistrymocks.ContractStore, address string) {
+	addrHexNo0x := strings.TrimPrefix(strings.ToLower(address), "0x")
+	mcr.On("GetContractByAddress", addrHexNo0x).
+		Return(nil, errors.Errorf(errors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x))
+}
+
 func expectABISuccess(t *testing.T, mcr *contractregistrymocks.ContractStore, abiID string) {
 	mcr.On("GetABI", contractregistry.ABILocation{
 		ABIType: contractregistry.LocalABI,
@@ -231,6 +321,49 @@ func TestSendTransactionAsyncSuccess(t *testing.T) {
 	mcr.AssertExpectations(t)
 }
 
+func TestSendTransactionAsyncEchoRequest(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "testabi",
+	}, false).
+		Return(&contractregistry.DeployContractWithAddress{
+			Contract: &messages.DeployContract{
+				ABI: ethbinding.ABIMarshaling{
+					{
+						Name: "set", Type: "function", Inputs: []ethbinding.ABIArgumentMarshaling{
+							{Name: "x", Type: "uint256", InternalType: "uint256"},
+						},
+					},
+				},
+			},
+		}, nil)
+
+	expectNotRegistered(mcr, "0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8")
+
+	req := httptest.NewRequest("POST", "/abis/testabi/0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8/set?x=105&fly-echo", bytes.NewReader([]byte{}))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal(true, dispatcher.asyncDispatchMsg["echoRequest"])
+	assert.Equal("/abis/testabi/0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8/set", dispatcher.asyncDispatchMsg["requestPath"])
+
+	mcr.AssertExpectations(t)
+}
+
 func TestDeployContractAsyncSuccess(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -386,6 +519,41 @@ func TestSendTransactionSyncSuccess(t *testing.T) {
 	mcr.AssertExpectations(t)
 }
 
+func TestSendTransactionDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	bodyMap := make(map[string]interface{})
+	bodyMap["i"] = 12345
+	bodyMap["s"] = "testing"
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+
+	r, router, res, _ := newTestREST2EthAndMsg(dispatcher, from, to, bodyMap)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractSuccess(t, mcr, to)
+
+	body, _ := json.Marshal(&bodyMap)
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/set?fly-maxfee=2000", bytes.NewReader(body))
+	req.Header.Add("x-firefly-from", from)
+	req.Header.Add("x-firefly-priorityfee", "100")
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal(json.Number("2000"), dispatcher.sendTransactionMsg.MaxFeePerGas)
+	assert.Equal(json.Number("100"), dispatcher.sendTransactionMsg.MaxPriorityFeePerGas)
+	assert.Equal(json.Number(""), dispatcher.sendTransactionMsg.GasPrice)
+
+	mcr.AssertExpectations(t)
+}
+
 func TestSendTransactionSyncFailure(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -427,6 +595,37 @@ func TestSendTransactionSyncFailure(t *testing.T) {
 	mcr.AssertExpectations(t)
 }
 
+func TestSendTransactionSyncSaturated(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	bodyMap := make(map[string]interface{})
+	bodyMap["i"] = 12345
+	bodyMap["s"] = "testing"
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{}
+
+	r, router, res, _ := newTestREST2EthAndMsg(dispatcher, from, to, bodyMap)
+	r.syncPool = newSyncRequestPool(&SyncRequestConf{MaxInFlight: 1, RetryAfterSec: 10})
+	r.syncPool.acquire(context.Background())
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractSuccess(t, mcr, to)
+
+	body, _ := json.Marshal(&bodyMap)
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/set?fly-sync", bytes.NewReader(body))
+	req.Header.Add("x-firefly-from", from)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(503, res.Result().StatusCode)
+	assert.Equal("10", res.Result().Header.Get("Retry-After"))
+	var reply errors.RESTError
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("Too many synchronous requests in flight. Retry after 10 seconds", reply.Message)
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
 func TestSendTransactionSyncPostDeployErr(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -502,6 +701,7 @@ func TestSendTransactionSyncViaABISuccess(t *testing.T) {
 	r, router, res, _ := newTestREST2EthAndMsg(dispatcher, from, to, bodyMap)
 	mcr := r.cr.(*contractregistrymocks.ContractStore)
 	expectABISuccess(t, mcr, abi)
+	expectNotRegistered(mcr, to)
 
 	body, _ := json.Marshal(&bodyMap)
 	req := httptest.NewRequest("POST", "/abis/"+abi+"/"+to+"/set?fly-sync&fly-ethvalue=1234", bytes.NewReader(body))
@@ -1162,6 +1362,8 @@ func TestSendTransactionUnnamedParamsABI(t *testing.T) {
 			},
 		}, nil)
 
+	expectNotRegistered(mcr, "0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8")
+
 	req := httptest.NewRequest("POST", "/abis/testabi/0x29fb3f4f7cc82a1456903a506e88cdd63b1d74e8/unnamedparamsmethod", bytes.NewReader([]byte{}))
 	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
 	q := req.URL.Query()
@@ -1652,6 +1854,103 @@ func TestCallMethodFail(t *testing.T) {
 	mcr.AssertExpectations(t)
 }
 
+type testRevertDataError struct {
+	data string
+}
+
+func (e *testRevertDataError) Error() string {
+	return "execution reverted"
+}
+
+func (e *testRevertDataError) ErrorData() interface{} {
+	return e.data
+}
+
+var testUnauthorizedABI = ethbinding.ABIMarshaling{
+	{
+		Type: "function", Name: "get", StateMutability: "view",
+		Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "i", Type: "uint256"}},
+	},
+	{
+		Type: "function", Name: "set", StateMutability: "nonpayable",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "i", Type: "uint256"}},
+	},
+	{
+		Type: "error", Name: "Unauthorized",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "caller", Type: "address"}},
+	},
+}
+
+func expectUnauthorizedABIContract(mcr *contractregistrymocks.ContractStore, address string) {
+	mcr.On("GetContractByAddress", strings.TrimPrefix(strings.ToLower(address), "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: testUnauthorizedABI},
+	}, nil)
+}
+
+func TestCallMethodRevertCustomError(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{}
+
+	r, router, res, _ := newTestREST2EthAndMsg(dispatcher, "", to, map[string]interface{}{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+
+	errorABI, err := ethbind.API.ABIElementMarshalingToABIMethod(&testUnauthorizedABI[2])
+	assert.NoError(err)
+	packed, err := errorABI.Inputs.Pack(ethbind.API.HexToAddress(to))
+	assert.NoError(err)
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(&testRevertDataError{data: ethbind.API.HexEncode(append(errorABI.ID, packed...))})
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/get", bytes.NewReader([]byte{}))
+	router.ServeHTTP(res, req)
+
+	assert.Equal(500, res.Result().StatusCode)
+	reply := errors.RESTError{}
+	err = json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal(`EVM reverted: Unauthorized({"caller":"`+to+`"})`, reply.Message)
+	assert.Equal(`Unauthorized({"caller":"`+to+`"})`, reply.RevertReason)
+	assert.Equal("reverted", reply.ErrorType)
+
+	mcr.AssertExpectations(t)
+	mockRPC.AssertExpectations(t)
+}
+
+func TestSendTransactionWithCustomErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+
+	r, router, res, req := newTestREST2EthAndMsg(dispatcher, from, to, map[string]interface{}{"i": 12345})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectUnauthorizedABIContract(mcr, to)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	var msg messages.SendTransaction
+	msgBytes, _ := json.Marshal(dispatcher.asyncDispatchMsg)
+	json.Unmarshal(msgBytes, &msg)
+	assert.Equal(ethbinding.ABIMarshaling{testUnauthorizedABI[2]}, msg.Errors)
+
+	mcr.AssertExpectations(t)
+}
+
 func TestCallMethodViaABIBadAddress(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -1816,123 +2115,366 @@ func TestSubscribeNoAddressSuccess(t *testing.T) {
 	mcr.AssertExpectations(t)
 }
 
-func TestSubscribeWithAddressSuccess(t *testing.T) {
+func TestSubscribeNoAddressAnyContract(t *testing.T) {
 	assert := assert.New(t)
-	dir := tempdir()
-	defer cleanup(dir)
 
 	dispatcher := &mockREST2EthDispatcher{}
 	r, router := newTestREST2Eth(dispatcher)
 	mcr := r.cr.(*contractregistrymocks.ContractStore)
-	expectContractSuccess(t, mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "factory1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "create"},
+			{Type: "event", Name: "Created", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address", Indexed: true}}},
+		}},
+	}, nil)
 
 	sm := &mockSubMgr{
 		sub: &events.SubscriptionInfo{ID: "sub1"},
 	}
 	r.subMgr = sm
 	bodyBytes, _ := json.Marshal(&map[string]string{
-		"stream": "stream1",
+		"stream":    "stream1",
+		"fromBlock": "0",
 	})
-	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+	req := httptest.NewRequest("POST", "/abis/factory1/Created/subscribe", bytes.NewReader(bodyBytes))
 	res := httptest.NewRecorder()
 	router.ServeHTTP(res, req)
 
 	assert.Equal(200, res.Result().StatusCode)
-	reply := events.SubscriptionInfo{}
-	err := json.NewDecoder(res.Result().Body).Decode(&reply)
-	assert.NoError(err)
-	assert.Equal("sub1", reply.ID)
-	assert.Equal("0x66C5fE653e7A9EBB628a6D40f0452d1e358BaEE8", sm.capturedAddr.Hex())
+	assert.Nil(sm.capturedAddr)
+	assert.Equal("Created", sm.capturedEvent.Name)
+	assert.Nil(sm.capturedEvents)
 
 	mcr.AssertExpectations(t)
 }
 
-func TestSubscribeWithAddressBadAddress(t *testing.T) {
+func TestSubscribeIndexedFilter(t *testing.T) {
 	assert := assert.New(t)
-	dir := tempdir()
-	defer cleanup(dir)
 
 	dispatcher := &mockREST2EthDispatcher{}
-
 	r, router := newTestREST2Eth(dispatcher)
 	mcr := r.cr.(*contractregistrymocks.ContractStore)
-	mcr.On("ResolveContractAddress", "badness").Return("", fmt.Errorf("unregistered"))
+	expectContractABI(mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", ethbinding.ABIMarshaling{
+		{Type: "event", Name: "Transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address", Indexed: true}}},
+	})
 
-	r.subMgr = &mockSubMgr{
+	sm := &mockSubMgr{
 		sub: &events.SubscriptionInfo{ID: "sub1"},
 	}
-	bodyBytes, _ := json.Marshal(&map[string]string{
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(&map[string]interface{}{
 		"stream": "stream1",
+		"filter": map[string]interface{}{"from": "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
 	})
-	req := httptest.NewRequest("POST", "/contracts/badness/Changed/subscribe", bytes.NewReader(bodyBytes))
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Transfer/subscribe", bytes.NewReader(bodyBytes))
 	res := httptest.NewRecorder()
 	router.ServeHTTP(res, req)
 
-	assert.Equal(404, res.Result().StatusCode)
-	reply := errors.RESTError{}
-	err := json.NewDecoder(res.Result().Body).Decode(&reply)
-	assert.NoError(err)
-	assert.Equal("unregistered", reply.Message)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("Transfer", sm.capturedEvent.Name)
+	assert.Equal(map[string]interface{}{"from": "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}, sm.capturedFilter)
 
-	mcr.AssertExpectations(t)
+	req = httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/subscribe", bytes.NewReader(bodyBytes))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Regexp("A filter on indexed arguments can only be used when subscribing to a single event", resBody["error"])
+	assert.Nil(sm.capturedEvents)
 }
 
-func TestSubscribeWithAddressSubmgrFailure(t *testing.T) {
+func TestSubscribeEventOverride(t *testing.T) {
 	assert := assert.New(t)
-	dir := tempdir()
-	defer cleanup(dir)
 
 	dispatcher := &mockREST2EthDispatcher{}
 	r, router := newTestREST2Eth(dispatcher)
 	mcr := r.cr.(*contractregistrymocks.ContractStore)
-	expectContractSuccess(t, mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	expectContractABI(mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", ethbinding.ABIMarshaling{
+		{Type: "event", Name: "Transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address"}}},
+	})
 
-	r.subMgr = &mockSubMgr{
-		err: fmt.Errorf("pop"),
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
 	}
-	bodyBytes, _ := json.Marshal(&map[string]string{
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(&map[string]interface{}{
 		"stream": "stream1",
+		"event": map[string]interface{}{
+			"type":      "event",
+			"name":      "Transfer",
+			"anonymous": true,
+			"inputs":    []interface{}{map[string]interface{}{"name": "from", "type": "address", "indexed": true}},
+		},
 	})
-	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Transfer/subscribe", bytes.NewReader(bodyBytes))
 	res := httptest.NewRecorder()
 	router.ServeHTTP(res, req)
 
-	assert.Equal(400, res.Result().StatusCode)
-	reply := errors.RESTError{}
-	err := json.NewDecoder(res.Result().Body).Decode(&reply)
-	assert.NoError(err)
-	assert.Equal("pop", reply.Message)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.True(sm.capturedEvent.Anonymous)
+	assert.True(sm.capturedEvent.Inputs[0].Indexed)
 
-	mcr.AssertExpectations(t)
+	req = httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Transfer/subscribe", bytes.NewReader([]byte(`{"stream":"stream1","event":{"inputs":"wrong"}}`)))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Regexp("Invalid event definition", resBody["error"])
 }
 
-func TestSendTransactionWithIDAsyncSuccess(t *testing.T) {
+func TestSendTransactionSyncTimeout(t *testing.T) {
 	assert := assert.New(t)
-	dir := tempdir()
-	defer cleanup(dir)
 
-	bodyMap := make(map[string]interface{})
-	bodyMap["i"] = 12345
-	bodyMap["s"] = "testing"
-	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
-	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	receipt := &messages.TransactionReceipt{}
+	receipt.Headers.MsgType = messages.MsgTypeTransactionSuccess
 	dispatcher := &mockREST2EthDispatcher{
-		asyncDispatchReply: &messages.AsyncSentMsg{
-			Sent:    true,
-			Request: "request1",
-		},
+		sendTransactionSyncReceipt: receipt,
 	}
-
-	r, router, res, req := newTestREST2EthAndMsg(dispatcher, from, to, bodyMap)
+	r, router := newTestREST2Eth(dispatcher)
 	mcr := r.cr.(*contractregistrymocks.ContractStore)
-	expectContractSuccess(t, mcr, to)
+	expectContractABI(mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", ethbinding.ABIMarshaling{
+		{Type: "function", Name: "set", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256"}}},
+	})
 
-	req.Header.Set("X-Firefly-ID", "my-id")
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/set?fly-from=0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8&fly-sync&fly-timeout=2.5", bytes.NewReader([]byte(`{"x":"1"}`)))
+	res := httptest.NewRecorder()
+	startTime := time.Now()
 	router.ServeHTTP(res, req)
 
-	assert.Equal(202, res.Result().StatusCode)
-	reply := messages.AsyncSentMsg{}
-	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(200, res.Result().StatusCode)
+	deadline, ok := dispatcher.sendTransactionSyncCtx.Deadline()
+	assert.True(ok)
+	assert.WithinDuration(startTime.Add(2500*time.Millisecond), deadline, 1*time.Second)
+	assert.Error(dispatcher.sendTransactionSyncCtx.Err())
+
+	req = httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/set?fly-from=0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8&fly-sync", bytes.NewReader([]byte(`{"x":"1"}`)))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	_, ok = dispatcher.sendTransactionSyncCtx.Deadline()
+	assert.False(ok)
+}
+
+func TestSendTransactionBadTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractABI(mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", ethbinding.ABIMarshaling{
+		{Type: "function", Name: "set", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256"}}},
+	})
+
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/set?fly-from=0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8&fly-sync", bytes.NewReader([]byte(`{"x":"1"}`)))
+	req.Header.Set("x-firefly-timeout", "-1")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("Invalid fly-timeout '-1': must be a positive number of seconds", resBody["error"])
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestSubscribeWithAddressSuccess(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractSuccess(t, mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
+	}
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(&map[string]string{
+		"stream": "stream1",
+	})
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	reply := events.SubscriptionInfo{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal("sub1", reply.ID)
+	assert.Equal("0x66C5fE653e7A9EBB628a6D40f0452d1e358BaEE8", sm.capturedAddr.Hex())
+
+	mcr.AssertExpectations(t)
+}
+
+func expectContractABI(mcr *contractregistrymocks.ContractStore, address string, abi ethbinding.ABIMarshaling) {
+	mcr.On("GetContractByAddress", strings.TrimPrefix(strings.ToLower(address), "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: abi},
+	}, nil)
+}
+
+func TestSubscribeAllEventsSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractABI(mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", ethbinding.ABIMarshaling{
+		{Type: "function", Name: "set", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256"}}},
+		{Type: "event", Name: "Changed", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256"}}},
+		{Type: "event", Name: "Reset"},
+	})
+
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
+	}
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(&map[string]string{
+		"stream": "stream1",
+	})
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	reply := events.SubscriptionInfo{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal("sub1", reply.ID)
+	assert.Equal("0x66C5fE653e7A9EBB628a6D40f0452d1e358BaEE8", sm.capturedAddr.Hex())
+	assert.Equal(2, len(sm.capturedEvents))
+	assert.Equal("Changed", sm.capturedEvents[0].Name)
+	assert.Equal("Reset", sm.capturedEvents[1].Name)
+
+	mcr.AssertExpectations(t)
+}
+
+func TestSubscribeAllEventsNoEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractABI(mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", ethbinding.ABIMarshaling{
+		{Type: "function", Name: "set", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256"}}},
+	})
+
+	sm := &mockSubMgr{}
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(&map[string]string{
+		"stream": "stream1",
+	})
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Regexp("The ABI does not declare any events that are not anonymous", resBody["error"])
+	assert.Nil(sm.capturedEvents)
+}
+
+func TestSubscribeWithAddressBadAddress(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{}
+
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("ResolveContractAddress", "badness").Return("", fmt.Errorf("unregistered"))
+
+	r.subMgr = &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
+	}
+	bodyBytes, _ := json.Marshal(&map[string]string{
+		"stream": "stream1",
+	})
+	req := httptest.NewRequest("POST", "/contracts/badness/Changed/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(404, res.Result().StatusCode)
+	reply := errors.RESTError{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal("unregistered", reply.Message)
+
+	mcr.AssertExpectations(t)
+}
+
+func TestSubscribeWithAddressSubmgrFailure(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractSuccess(t, mcr, "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+
+	r.subMgr = &mockSubMgr{
+		err: fmt.Errorf("pop"),
+	}
+	bodyBytes, _ := json.Marshal(&map[string]string{
+		"stream": "stream1",
+	})
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	reply := errors.RESTError{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal("pop", reply.Message)
+
+	mcr.AssertExpectations(t)
+}
+
+func TestSendTransactionWithIDAsyncSuccess(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	bodyMap := make(map[string]interface{})
+	bodyMap["i"] = 12345
+	bodyMap["s"] = "testing"
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+
+	r, router, res, req := newTestREST2EthAndMsg(dispatcher, from, to, bodyMap)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	expectContractSuccess(t, mcr, to)
+
+	req.Header.Set("X-Firefly-ID", "my-id")
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	reply := messages.AsyncSentMsg{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
 	assert.NoError(err)
 	assert.Equal(true, reply.Sent)
 	assert.Equal("request1", reply.Request)
@@ -2034,3 +2576,472 @@ func TestGetTransactionInfoDecodeFail(t *testing.T) {
 
 	assert.Equal(500, res.Result().StatusCode)
 }
+
+func TestMethodPolicyHidesMethods(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{
+		ABI: "abi1",
+		MethodPolicy: &contractregistry.MethodPolicy{
+			Deny: []string{"mint", "burn(uint256)"},
+		},
+	}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+			{Type: "function", Name: "burn", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+			{Type: "function", Name: "burn", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address"}, {Name: "amount", Type: "uint256"}}},
+		}},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/mint?amount=1", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(403, res.Code)
+	reply := errors.RESTError{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("Method 'mint' is not exposed for contract 567a417717cb6c59ddc1035705f02c0fd1ab1872", reply.Message)
+
+	// Only the overload that is hidden cannot be called
+	req = httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/burn?amount=1", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Parameter 'from' of method 'burn' was not specified", reply.Message)
+}
+
+func TestMethodPolicyAppliedViaABI(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{
+		ABI: "abi1",
+		MethodPolicy: &contractregistry.MethodPolicy{
+			Deny: []string{"mint"},
+		},
+	}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+		}},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/abis/abi1/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/mint?amount=1", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(403, res.Code)
+	reply := errors.RESTError{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("Method 'mint' is not exposed for contract 567a417717cb6c59ddc1035705f02c0fd1ab1872", reply.Message)
+}
+
+func TestABIRegistrationLookupFail(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(nil, fmt.Errorf("pop"))
+
+	req := httptest.NewRequest("POST", "/abis/abi1/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/mint?amount=1", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+	reply := errors.RESTError{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("pop", reply.Message)
+}
+
+func TestParamDefaultsAppliedUnlessOverridden(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: &messages.TransactionReceipt{
+			ReplyCommon: messages.ReplyCommon{
+				Headers: messages.ReplyHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeTransactionSuccess,
+					},
+				},
+			},
+		},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{
+		ABI: "abi1",
+		ParamDefaults: map[string]string{
+			"from": "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+			"gas":  "100000",
+			"sync": "true",
+		},
+	}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+		}},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/mint?amount=1", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.sendTransactionMsg.From)
+	assert.Equal(json.Number("100000"), dispatcher.sendTransactionMsg.Gas)
+
+	req = httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/mint?amount=1&FLY-GAS=200000", nil)
+	req.Header.Set("x-firefly-from", "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c", dispatcher.sendTransactionMsg.From)
+	assert.Equal(json.Number("200000"), dispatcher.sendTransactionMsg.Gas)
+}
+
+func TestParamDefaultsAppliedViaABI(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: &messages.TransactionReceipt{
+			ReplyCommon: messages.ReplyCommon{
+				Headers: messages.ReplyHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeTransactionSuccess,
+					},
+				},
+			},
+		},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{
+		ABI: "abi1",
+		ParamDefaults: map[string]string{
+			"from": "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+			"gas":  "100000",
+			"sync": "true",
+		},
+	}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+		}},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/abis/abi1/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/mint?amount=1", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.sendTransactionMsg.From)
+	assert.Equal(json.Number("100000"), dispatcher.sendTransactionMsg.Gas)
+}
+
+func TestSendTransactionAsyncSimulate(t *testing.T) {
+	assert := assert.New(t)
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	r.processor.(*mockProcessor).resolvedFrom = from
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{
+				Type:    "function",
+				Name:    "mint",
+				Inputs:  []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}},
+				Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "ok", Type: "bool"}},
+			},
+		}},
+	}, nil)
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*string)) = "0x0000000000000000000000000000000000000000000000000000000000000001"
+		}).Return(nil).Once()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*string)) = "0x08c379a0" +
+				"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000004" +
+				"706f702100000000000000000000000000000000000000000000000000000000"
+		}).Return(nil).Once()
+
+	var reply messages.AsyncSentMsg
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/mint?fly-simulate", bytes.NewReader([]byte(`{"amount":"10"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("request1", reply.Request)
+	assert.True(reply.Simulation.Success)
+	assert.Equal(true, reply.Simulation.Outputs["ok"])
+
+	reply = messages.AsyncSentMsg{}
+	dispatcher.asyncDispatchReply = &messages.AsyncSentMsg{Sent: true, Request: "request2"}
+	req = httptest.NewRequest("POST", "/contracts/"+to+"/mint?fly-simulate", bytes.NewReader([]byte(`{"amount":"10"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("request2", reply.Request)
+	assert.False(reply.Simulation.Success)
+	assert.Regexp("pop!", reply.Simulation.Error)
+
+	// No simulation unless requested
+	reply = messages.AsyncSentMsg{}
+	dispatcher.asyncDispatchReply = &messages.AsyncSentMsg{Sent: true, Request: "request3"}
+	req = httptest.NewRequest("POST", "/contracts/"+to+"/mint", bytes.NewReader([]byte(`{"amount":"10"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Nil(reply.Simulation)
+	mockRPC.AssertExpectations(t)
+}
+
+func TestSendTransactionGuards(t *testing.T) {
+	assert := assert.New(t)
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	r.processor.(*mockProcessor).resolvedFrom = from
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{
+		ABI: "abi1",
+		Guards: []*contractregistry.MethodGuard{
+			{Methods: []string{"mint"}, Function: "hasRole(bytes32,address)", Params: []string{"0x9f2df0fed2c77648de5860a4cc508cd0818c85b8b8a1ab4ceeef8d981c8956a6", "${from}"}},
+			{Methods: []string{"mint"}, Function: "paused()", Reason: "minting is paused"},
+		},
+	}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+			{Type: "function", Name: "burn", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+		}},
+	}, nil)
+	returnBool := func(b string) func(args mock.Arguments) {
+		return func(args mock.Arguments) {
+			*(args[1].(*string)) = "0x000000000000000000000000000000000000000000000000000000000000000" + b
+		}
+	}
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").Run(returnBool("1")).Return(nil).Twice()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").Run(returnBool("1")).Return(nil).Once()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").Run(returnBool("0")).Return(nil).Once()
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").Return(fmt.Errorf("pop")).Once()
+
+	send := func(method string) (int, string) {
+		req := httptest.NewRequest("POST", "/contracts/"+to+"/"+method, bytes.NewReader([]byte(`{"amount":"10"}`)))
+		req.Header.Set("x-firefly-from", from)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var errBody errors.RESTError
+		json.NewDecoder(res.Body).Decode(&errBody)
+		return res.Code, errBody.Message
+	}
+
+	// Both guards permit the transaction
+	status, _ := send("mint")
+	assert.Equal(202, status)
+
+	// The second guard does not permit the transaction
+	status, msg := send("mint")
+	assert.Equal(403, status)
+	assert.Regexp("Transaction from "+from+" to "+to+" was not permitted: minting is paused", msg)
+
+	// The guard cannot be checked
+	status, msg = send("mint")
+	assert.Equal(500, status)
+	assert.Regexp("Failed to check guard hasRole\\(bytes32,address\\): .*pop", msg)
+
+	// No guards apply to burn
+	status, _ = send("burn")
+	assert.Equal(202, status)
+	mockRPC.AssertExpectations(t)
+
+	r.processor.(*mockProcessor).err = fmt.Errorf("pop")
+	status, msg = send("mint")
+	assert.Equal(500, status)
+	assert.Regexp("pop", msg)
+}
+
+func TestSendTransactionGuardsViaABI(t *testing.T) {
+	assert := assert.New(t)
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	r.processor.(*mockProcessor).resolvedFrom = from
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{
+		ABI: "abi1",
+		Guards: []*contractregistry.MethodGuard{
+			{Methods: []string{"mint"}, Function: "paused()", Reason: "minting is paused"},
+		},
+	}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+		}},
+	}, nil)
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").Run(func(args mock.Arguments) {
+		*(args[1].(*string)) = "0x0000000000000000000000000000000000000000000000000000000000000000"
+	}).Return(nil).Once()
+
+	req := httptest.NewRequest("POST", "/abis/abi1/"+to+"/mint", bytes.NewReader([]byte(`{"amount":"10"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(403, res.Code)
+	var errBody errors.RESTError
+	json.NewDecoder(res.Body).Decode(&errBody)
+	assert.Regexp("Transaction from "+from+" to "+to+" was not permitted: minting is paused", errBody.Message)
+	mockRPC.AssertExpectations(t)
+}
+
+func TestSimulateTransactionResolveFail(t *testing.T) {
+	assert := assert.New(t)
+	r, _ := newTestREST2Eth(&mockREST2EthDispatcher{})
+	r.processor.(*mockProcessor).err = fmt.Errorf("pop")
+	result := r.simulateTransaction(context.Background(), "HD-u01234abcd-u01234abcd-12345", "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "", &ethbinding.ABIMethod{Name: "mint"}, nil, nil)
+	assert.False(result.Success)
+	assert.Equal("pop", result.Error)
+}
+
+func newTestREST2EthMyBalance() (*rest2eth, *httprouter.Router) {
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", "567a417717cb6c59ddc1035705f02c0fd1ab1872").Return(&contractregistry.ContractInfo{ABI: "abi1"}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{
+				Type:    "function",
+				Name:    "myBalance",
+				Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "balance", Type: "uint256"}},
+			},
+		}},
+	}, nil)
+	return r, router
+}
+
+func TestCallMethodImpersonatedFrom(t *testing.T) {
+	assert := assert.New(t)
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, router := newTestREST2EthMyBalance()
+	// No signing account is resolved for a query
+	r.processor.(*mockProcessor).err = fmt.Errorf("pop")
+
+	var callFrom []string
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Run(func(args mock.Arguments) {
+			callFrom = append(callFrom, args[3].(*eth.SendTXArgs).From)
+			*(args[1].(*string)) = "0x000000000000000000000000000000000000000000000000000000000000000a"
+		}).Return(nil)
+
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/myBalance", bytes.NewReader([]byte{}))
+	req.Header.Set("x-firefly-from", "0xd0f8dbb1a58fd24ac2e7ed2c4e1ab2aa8ddbb76b")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("10", reply["balance"])
+
+	req = httptest.NewRequest("GET", "/contracts/"+to+"/myBalance?fly-from=ZERO", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+
+	assert.Equal(2, len(callFrom))
+	assert.True(strings.EqualFold("0xd0f8dbb1a58fd24ac2e7ed2c4e1ab2aa8ddbb76b", callFrom[0]))
+	assert.Equal(zeroFromAddress, callFrom[1])
+	mockRPC.AssertExpectations(t)
+}
+
+func TestSendTransactionZeroFrom(t *testing.T) {
+	assert := assert.New(t)
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	_, router := newTestREST2EthMyBalance()
+
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/myBalance?fly-from=zero", bytes.NewReader([]byte(`{}`)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("A 'fly-from' of 'zero' can only be used to query a contract", reply["error"])
+}
+
+func TestDeployContractEventsOnly(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+			{
+				Type:   "event",
+				Name:   "Logged",
+				Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address", Indexed: true}},
+			},
+		}},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/abis/abi1", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("The ABI only declares events, and has no bytecode to deploy", reply["error"])
+}
+
+func TestIsEventsOnlyABI(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isEventsOnlyABI(ethbinding.ABIMarshaling{{Type: "event", Name: "Logged"}, {Type: "error", Name: "Failed"}}))
+	assert.False(isEventsOnlyABI(ethbinding.ABIMarshaling{{Type: "event", Name: "Logged"}, {Type: "constructor"}}))
+	assert.False(isEventsOnlyABI(ethbinding.ABIMarshaling{{Type: "event", Name: "Logged"}, {Name: "legacyFunction"}}))
+	assert.False(isEventsOnlyABI(ethbinding.ABIMarshaling{}))
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// RPCPassthroughConf enables POST /rpc, to call the JSON/RPC methods in the allow-list on the node
+// through the gateway. Disabled when AllowedMethods is empty
+type RPCPassthroughConf struct {
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+}
+
+// rpcPassthroughRequest is a single JSON/RPC request. Batches are not supported
+type rpcPassthroughRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  []interface{}   `json:"params"`
+}
+
+// rpcPassthroughResponse is the JSON/RPC response to a successful call
+type rpcPassthroughResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func (g *smartContractGW) addRPCPassthroughRoutes(router *httprouter.Router) {
+	if g.conf == nil || len(g.conf.RPCPassthrough.AllowedMethods) == 0 {
+		return
+	}
+	router.POST("/rpc", g.rpcPassthrough)
+}
+
+// isMethodAllowed checks a method against the allowed methods, which are exact method
+// names or wildcards for every method in a namespace, such as txpool_*
+func isMethodAllowed(allowedMethods []string, method string) bool {
+	for _, allowed := range allowedMethods {
+		if method == allowed || (strings.HasSuffix(allowed, "_*") && strings.HasPrefix(method, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcPassthrough calls a JSON/RPC method on the node, if it is in the allow-list and the caller
+// is authorized for it. Every call is logged with its outcome, as an audit trail
+func (g *smartContractGW) rpcPassthrough(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var rpcReq rpcPassthroughRequest
+	if err := json.NewDecoder(req.Body).Decode(&rpcReq); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RPCPassthroughInvalidRequest, err), 400)
+		return
+	}
+	if rpcReq.Method == "" {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RPCPassthroughInvalidRequest, "missing method"), 400)
+		return
+	}
+	if !isMethodAllowed(g.conf.RPCPassthrough.AllowedMethods, rpcReq.Method) {
+		g.auditRPCPassthrough(req, rpcReq.Method, "denied", 0)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RPCPassthroughMethodNotAllowed, rpcReq.Method), 403)
+		return
+	}
+	if err := auth.AuthRPC(req.Context(), rpcReq.Method, rpcReq.Params...); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.auditRPCPassthrough(req, rpcReq.Method, "unauthorized", 0)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	start := time.Now().UTC()
+	var result json.RawMessage
+	err := g.r2e.rpc.CallContext(req.Context(), &result, rpcReq.Method, rpcReq.Params...)
+	callTime := time.Now().UTC().Sub(start)
+	if err != nil {
+		g.auditRPCPassthrough(req, rpcReq.Method, "failed", callTime)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RPCCallReturnedError, rpcReq.Method, err), 500)
+		return
+	}
+	g.auditRPCPassthrough(req, rpcReq.Method, "succeeded", callTime)
+
+	if len(result) == 0 {
+		result = json.RawMessage("null")
+	}
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(&rpcPassthroughResponse{
+		JSONRPC: "2.0",
+		ID:      rpcReq.ID,
+		Result:  result,
+	})
+}
+
+func (g *smartContractGW) auditRPCPassthrough(req *http.Request, method, outcome string, callTime time.Duration) {
+	log.Infof("RPC passthrough audit: method=%s outcome=%s remote=%s authenticated=%t [%.2fs]",
+		method, outcome, req.RemoteAddr, auth.GetAuthContext(req.Context()) != nil, callTime.Seconds())
+}
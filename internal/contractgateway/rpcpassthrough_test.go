@@ -0,0 +1,134 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestRPCPassthroughGateway(allowed ...string) (*ethmocks.RPCClient, *httprouter.Router) {
+	rpc := &ethmocks.RPCClient{}
+	s := &smartContractGW{
+		conf: &SmartContractGatewayConf{RPCPassthrough: RPCPassthroughConf{AllowedMethods: allowed}},
+		r2e:  &rest2eth{rpc: rpc},
+	}
+	router := &httprouter.Router{}
+	s.addRPCPassthroughRoutes(router)
+	return rpc, router
+}
+
+func testRPCPassthrough(router *httprouter.Router, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/rpc", bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestIsMethodAllowed(t *testing.T) {
+	assert := assert.New(t)
+	allowed := []string{"net_peerCount", "txpool_*"}
+	assert.True(isMethodAllowed(allowed, "net_peerCount"))
+	assert.True(isMethodAllowed(allowed, "txpool_status"))
+	assert.False(isMethodAllowed(allowed, "net_version"))
+	assert.False(isMethodAllowed(allowed, "txpoolx_status"))
+	assert.False(isMethodAllowed(nil, "net_peerCount"))
+}
+
+func TestRPCPassthroughDisabled(t *testing.T) {
+	assert := assert.New(t)
+	_, router := newTestRPCPassthroughGateway()
+	res := testRPCPassthrough(router, `{"jsonrpc":"2.0","id":1,"method":"net_peerCount"}`)
+	assert.Equal(404, res.Code)
+}
+
+func TestRPCPassthrough(t *testing.T) {
+	assert := assert.New(t)
+	rpc, router := newTestRPCPassthroughGateway("txpool_*")
+	rpc.On("CallContext", mock.Anything, mock.Anything, "txpool_status", "0x1111").
+		Run(func(args mock.Arguments) {
+			*(args[1].(*json.RawMessage)) = json.RawMessage(`{"pending":"0x1","queued":"0x0"}`)
+		}).
+		Return(nil)
+
+	res := testRPCPassthrough(router, `{"jsonrpc":"2.0","id":"abc","method":"txpool_status","params":["0x1111"]}`)
+	assert.Equal(200, res.Code)
+	assert.JSONEq(`{"jsonrpc":"2.0","id":"abc","result":{"pending":"0x1","queued":"0x0"}}`, res.Body.String())
+	rpc.AssertExpectations(t)
+}
+
+func TestRPCPassthroughNullResult(t *testing.T) {
+	assert := assert.New(t)
+	rpc, router := newTestRPCPassthroughGateway("eth_getTransactionByHash")
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionByHash", "0xaaaa").Return(nil)
+
+	res := testRPCPassthrough(router, `{"jsonrpc":"2.0","id":2,"method":"eth_getTransactionByHash","params":["0xaaaa"]}`)
+	assert.Equal(200, res.Code)
+	assert.JSONEq(`{"jsonrpc":"2.0","id":2,"result":null}`, res.Body.String())
+}
+
+func TestRPCPassthroughNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+	rpc, router := newTestRPCPassthroughGateway("net_peerCount")
+
+	res := testRPCPassthrough(router, `{"jsonrpc":"2.0","id":1,"method":"admin_addPeer","params":["enode://..."]}`)
+	assert.Equal(403, res.Code)
+	assert.Regexp("JSON/RPC method 'admin_addPeer' is not allowed", res.Body.String())
+	rpc.AssertNotCalled(t, "CallContext")
+}
+
+func TestRPCPassthroughBadRequest(t *testing.T) {
+	assert := assert.New(t)
+	_, router := newTestRPCPassthroughGateway("net_peerCount")
+
+	res := testRPCPassthrough(router, `[{"jsonrpc":"2.0","id":1,"method":"net_peerCount"}]`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid JSON/RPC request", res.Body.String())
+
+	res = testRPCPassthrough(router, `{"jsonrpc":"2.0","id":1}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid JSON/RPC request: missing method", res.Body.String())
+}
+
+func TestRPCPassthroughCallFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc, router := newTestRPCPassthroughGateway("net_peerCount")
+	rpc.On("CallContext", mock.Anything, mock.Anything, "net_peerCount").Return(fmt.Errorf("pop"))
+
+	res := testRPCPassthrough(router, `{"jsonrpc":"2.0","id":1,"method":"net_peerCount"}`)
+	assert.Equal(500, res.Code)
+	assert.Regexp("net_peerCount returned: pop", res.Body.String())
+}
+
+func TestRPCPassthroughRequiresAuth(t *testing.T) {
+	assert := assert.New(t)
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	rpc, router := newTestRPCPassthroughGateway("net_peerCount")
+
+	res := testRPCPassthrough(router, `{"jsonrpc":"2.0","id":1,"method":"net_peerCount"}`)
+	assert.Equal(401, res.Code)
+	rpc.AssertNotCalled(t, "CallContext")
+}
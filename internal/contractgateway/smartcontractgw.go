@@ -24,11 +24,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -52,6 +52,12 @@ import (
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 )
 
+const (
+	defaultMaxUploadSizeMB = 100
+	// maxArchiveEntries is the most files and directories an uploaded archive can contain
+	maxArchiveEntries = 10000
+)
+
 var (
 	maxFormParsingMemory   int64 = 32 << 20 // 32 MB
 	errEventSupportMissing       = errors.Errorf(errors.EventSupportNotConfiugred)
@@ -66,6 +72,7 @@ type remoteContractInfo struct {
 
 // SmartContractGateway provides gateway functions for OpenAPI 2.0 processing of Solidity contracts
 type SmartContractGateway interface {
+	Invoker
 	PreDeploy(msg *messages.DeployContract) error
 	PostDeploy(msg *messages.TransactionReceipt) error
 	AddRoutes(router *httprouter.Router)
@@ -76,14 +83,53 @@ type SmartContractGateway interface {
 // SmartContractGatewayConf configuration
 type SmartContractGatewayConf struct {
 	events.SubscriptionManagerConf
-	StoragePath    string                              `json:"storagePath"`
-	BaseURL        string                              `json:"baseURL"`
-	RemoteRegistry contractregistry.RemoteRegistryConf `json:"registry,omitempty"` // JSON only config - no commandline
+	StoragePath       string                               `json:"storagePath"`
+	Store             string                               `json:"store,omitempty"`
+	S3                contractregistry.S3ArtifactStoreConf `json:"s3,omitempty"`
+	PostgreSQL        contractregistry.PostgreSQLIndexConf `json:"postgresql,omitempty"`
+	IndexDBPath       string                               `json:"indexDBPath,omitempty"`
+	PurgeDeletedSec   int                                  `json:"purgeDeletedSec,omitempty"`
+	BaseURL           string                               `json:"baseURL"`
+	MaxUploadSizeMB   int64                                `json:"maxUploadSizeMB,omitempty"`
+	CompileWorkers    int                                  `json:"compileWorkers,omitempty"`
+	ABIImport         ABIImportConf                        `json:"abiImport,omitempty"`
+	Dependencies      DependencyConf                       `json:"dependencies,omitempty"`
+	SyncRequests      SyncRequestConf                      `json:"syncRequests,omitempty"`
+	Idempotency       IdempotencyConf                      `json:"idempotency,omitempty"`
+	ConsensusAdmin    ConsensusAdminConf                   `json:"consensusAdmin,omitempty"`
+	AdminIntegrations bool                                 `json:"adminIntegrations,omitempty"`
+	RPCPassthrough    RPCPassthroughConf                   `json:"rpcPassthrough,omitempty"`
+	RemoteRegistry    contractregistry.RemoteRegistryConf  `json:"registry,omitempty"` // JSON only config - no commandline
 }
 
 // CobraInitContractGateway standard naming for contract gateway command params
 func CobraInitContractGateway(cmd *cobra.Command, conf *SmartContractGatewayConf) {
 	cmd.Flags().StringVarP(&conf.StoragePath, "openapi-path", "I", "", "Path containing ABI + generated OpenAPI/Swagger 2.0 contact definitions")
+	cmd.Flags().StringVarP(&conf.Store, "openapi-store", "", "", "Object store URL for ABI + contract definitions, in place of a local path. Format: s3://bucket/prefix")
+	cmd.Flags().StringVarP(&conf.S3.Endpoint, "openapi-s3-endpoint", "", "", "Endpoint URL for an S3 compatible object store other than AWS")
+	cmd.Flags().StringVarP(&conf.S3.Region, "openapi-s3-region", "", "", "Region of the S3 bucket (default $AWS_REGION or us-east-1)")
+	cmd.Flags().StringVarP(&conf.PostgreSQL.DSN, "openapi-postgres-dsn", "", "", "PostgreSQL connection string for a contract index shared between gateway instances")
+	cmd.Flags().IntVarP(&conf.PostgreSQL.MaxOpenConns, "openapi-postgres-pool", "", 0, "Maximum open connections to the PostgreSQL contract index (default 10)")
+	cmd.Flags().StringVarP(&conf.IndexDBPath, "openapi-index-db", "", "", "Path to a LevelDB to persist the contract index, rather than rebuilding it from the contract definitions on startup")
+	cmd.Flags().IntVarP(&conf.PurgeDeletedSec, "openapi-purge-deleted-sec", "", 0, "Seconds to keep deleted contracts and ABIs for, so they can be restored, before purging them (default 0 to keep forever)")
+	cmd.Flags().Int64VarP(&conf.MaxUploadSizeMB, "openapi-max-upload-mb", "", defaultMaxUploadSizeMB, "Maximum total size in MB of the files uploaded to compile into an ABI")
+	cmd.Flags().IntVarP(&conf.CompileWorkers, "openapi-compile-workers", "", defaultCompileWorkers, "Number of async compile jobs to run in parallel")
+	cmd.Flags().StringVarP(&conf.ABIImport.EtherscanURL, "openapi-etherscan-url", "", "", "Etherscan compatible API used to import verified ABIs (default "+defaultEtherscanURL+")")
+	cmd.Flags().StringVarP(&conf.ABIImport.EtherscanAPIKey, "openapi-etherscan-apikey", "", "", "API key for the Etherscan compatible API used to import verified ABIs")
+	cmd.Flags().StringVarP(&conf.ABIImport.SourcifyURL, "openapi-sourcify-url", "", "", "Sourcify repository used to import verified ABIs (default "+defaultSourcifyURL+")")
+	cmd.Flags().Uint64VarP(&conf.ABIImport.ChainID, "openapi-sourcify-chainid", "", 0, "Chain ID used to import verified ABIs from Sourcify (default 1)")
+	cmd.Flags().StringArrayVarP(&conf.ABIImport.AllowedHosts, "openapi-import-hosts", "", nil, "Hosts that an ABI import request can set as its apiURL, such as api.example.com or *.example.com. The configured sources only when not set")
+	cmd.Flags().StringVarP(&conf.Dependencies.MirrorURL, "openapi-deps-mirror", "", "", "npm registry mirror, such as https://unpkg.com, used to fetch Solidity imports missing from uploads")
+	cmd.Flags().StringVarP(&conf.Dependencies.GitHubURL, "openapi-deps-github", "", "", "Raw content server used to fetch github.com Solidity imports (default "+defaultDependencyGitHubURL+")")
+	cmd.Flags().IntVarP(&conf.SyncRequests.MaxInFlight, "sync-max-inflight", "", 0, "Maximum synchronous (fly-sync) requests to process in parallel (default 0 for no limit)")
+	cmd.Flags().IntVarP(&conf.SyncRequests.MaxQueued, "sync-max-queued", "", 0, "Maximum synchronous requests to queue when sync-max-inflight is reached, before rejecting with a 503")
+	cmd.Flags().IntVarP(&conf.SyncRequests.QueueTimeoutMS, "sync-queue-timeout-ms", "", defaultSyncQueueTimeoutMS, "Maximum time in milliseconds a synchronous request waits in the queue, before rejecting with a 503")
+	cmd.Flags().IntVarP(&conf.SyncRequests.RetryAfterSec, "sync-retry-after-sec", "", defaultSyncRetryAfterSec, "Retry-After seconds returned to clients when a synchronous request is rejected")
+	cmd.Flags().StringVarP(&conf.Idempotency.DBPath, "idempotency-db", "", "", "Path to a LevelDB to store the idempotency keys of transaction submissions (X-Idempotency-Key header or fly-id), so repeats are not submitted twice")
+	cmd.Flags().IntVarP(&conf.Idempotency.RetentionSec, "idempotency-retention-sec", "", defaultIdempotencyRetentionSec, "Seconds to keep each idempotency key for")
+	cmd.Flags().BoolVarP(&conf.AdminIntegrations, "admin-integrations", "", false, "Enable PUT /admin/hdwallet and /admin/addressbook without a security module. They are always enabled when a security module is loaded")
+	cmd.Flags().StringVarP(&conf.ConsensusAdmin.Protocol, "consensus-admin", "", "", "Enable the /admin/validators routes to manage the validators of a Besu chain, with its consensus protocol: qbft or ibft")
+	cmd.Flags().StringArrayVarP(&conf.RPCPassthrough.AllowedMethods, "rpc-passthrough-methods", "", nil, "JSON/RPC methods that can be called with POST /rpc, such as net_peerCount or txpool_*. Disabled when not set")
 	cmd.Flags().StringVarP(&conf.BaseURL, "openapi-baseurl", "U", "", "Base URL for generated OpenAPI/Swagger 2.0 contact definitions")
 	events.CobraInitSubscriptionManager(cmd, &conf.SubscriptionManagerConf)
 }
@@ -104,10 +150,25 @@ func (g *smartContractGW) AddRoutes(router *httprouter.Router) {
 	g.r2e.addRoutes(router)
 	router.GET("/contracts", g.listContractsOrABIs)
 	router.GET("/contracts/:address", g.getContractOrABI)
+	router.DELETE("/contracts/:address", g.deleteOrRestoreContract)
+	router.PUT("/contracts/:address/policy", g.setMethodPolicy)
+	router.DELETE("/contracts/:address/policy", g.setMethodPolicy)
+	router.PUT("/contracts/:address/abi", g.upgradeContract)
+	router.PUT("/contracts/:address/facets", g.addFacet)
+	router.DELETE("/contracts/:address/facets/:abi", g.removeFacet)
 	router.POST("/abis", g.addABI)
 	router.GET("/abis", g.listContractsOrABIs)
 	router.GET("/abis/:abi", g.getContractOrABI)
+	router.DELETE("/abis/:abi", g.deleteOrRestoreABI)
+	router.GET("/projects", g.listProjects)
 	router.POST("/abis/:abi/:address", g.registerContract)
+	router.GET("/compilejobs/:id", g.getCompileJob)
+	router.GET("/solc/versions", g.listSolcVersions)
+	router.GET("/solc/metrics", g.getSolcMetrics)
+	router.GET("/addresses/:address/pending", g.getPendingTransactions)
+	router.GET("/transactions/inflight", g.getInflightTransactions)
+	router.GET("/transactions/inflight/:from", g.getInflightTransactions)
+	router.POST("/admin/nonces/:address/reset", g.resetNonce)
 	router.GET("/instances/:instance_lookup", g.getRemoteRegistrySwaggerOrABI)
 	router.GET("/i/:instance_lookup", g.getRemoteRegistrySwaggerOrABI)
 	router.GET("/gateways/:gateway_lookup", g.getRemoteRegistrySwaggerOrABI)
@@ -119,11 +180,23 @@ func (g *smartContractGW) AddRoutes(router *httprouter.Router) {
 	router.GET(events.SubPathPrefix, g.withEventsAuth(g.listStreamsOrSubs))
 	router.GET(events.StreamPathPrefix+"/:id", g.withEventsAuth(g.getStreamOrSub))
 	router.GET(events.SubPathPrefix+"/:id", g.withEventsAuth(g.getStreamOrSub))
+	router.PATCH(events.SubPathPrefix+"/:id", g.withEventsAuth(g.updateSub))
 	router.DELETE(events.StreamPathPrefix+"/:id", g.withEventsAuth(g.deleteStreamOrSub))
 	router.DELETE(events.SubPathPrefix+"/:id", g.withEventsAuth(g.deleteStreamOrSub))
+	router.POST(events.SubPathPrefix+"/:id", g.withEventsAuth(g.subBatchHandler))
 	router.POST(events.SubPathPrefix+"/:id/reset", g.withEventsAuth(g.resetSub))
+	router.GET(events.SubPathPrefix+"/:id/checkpoint", g.withEventsAuth(g.exportCheckpoint))
+	router.PUT(events.SubPathPrefix+"/:id/checkpoint", g.withEventsAuth(g.importCheckpoint))
+	router.POST(events.StreamPathPrefix+"/:id", g.withEventsAuth(g.streamAllHandler))
 	router.POST(events.StreamPathPrefix+"/:id/suspend", g.withEventsAuth(g.suspendOrResumeStream))
 	router.POST(events.StreamPathPrefix+"/:id/resume", g.withEventsAuth(g.suspendOrResumeStream))
+	router.GET(events.StreamPathPrefix+"/:id/metrics", g.withEventsAuth(g.getStreamMetrics))
+	router.GET(events.StreamPathPrefix+"/:id/deadletters", g.withEventsAuth(g.listDeadLetters))
+	router.POST(events.StreamPathPrefix+"/:id/deadletters/:dlid/requeue", g.withEventsAuth(g.requeueOrDeleteDeadLetter))
+	router.DELETE(events.StreamPathPrefix+"/:id/deadletters/:dlid", g.withEventsAuth(g.requeueOrDeleteDeadLetter))
+	g.addIntegrationRoutes(router)
+	g.addConsensusAdminRoutes(router)
+	g.addRPCPassthroughRoutes(router)
 }
 
 func (g *smartContractGW) SendReply(message interface{}) {
@@ -131,7 +204,7 @@ func (g *smartContractGW) SendReply(message interface{}) {
 }
 
 // NewSmartContractGateway constructor
-func NewSmartContractGateway(conf *SmartContractGatewayConf, txnConf *tx.TxnProcessorConf, rpc eth.RPCClient, processor tx.TxnProcessor, asyncDispatcher REST2EthAsyncDispatcher, ws ws.WebSocketChannels) (SmartContractGateway, error) {
+func NewSmartContractGateway(conf *SmartContractGatewayConf, txnConf *tx.TxnProcessorConf, solc *eth.SolcConf, rpc eth.RPCClient, processor tx.TxnProcessor, asyncDispatcher REST2EthAsyncDispatcher, ws ws.WebSocketChannels) (SmartContractGateway, error) {
 	var baseURL *url.URL
 	var err error
 	if conf.BaseURL != "" {
@@ -143,6 +216,11 @@ func NewSmartContractGateway(conf *SmartContractGatewayConf, txnConf *tx.TxnProc
 		baseURL, _ = url.Parse("http://localhost:8080")
 	}
 	log.Infof("OpenAPI Smart Contract Gateway configured with base URL '%s'", baseURL.String())
+	if conf.ConsensusAdmin.Protocol != "" {
+		if conf.ConsensusAdmin.Protocol, err = eth.ValidateConsensusProtocol(conf.ConsensusAdmin.Protocol); err != nil {
+			return nil, err
+		}
+	}
 	gw := &smartContractGW{
 		conf: conf,
 		baseSwaggerConf: &openapi.ABI2SwaggerConf{
@@ -152,16 +230,26 @@ func NewSmartContractGateway(conf *SmartContractGatewayConf, txnConf *tx.TxnProc
 			OrionPrivateAPI:  txnConf.OrionPrivateAPIS,
 			BasicAuth:        true,
 		},
-		ws: ws,
+		ws:   ws,
+		solc: solc,
 	}
 	rr := contractregistry.NewRemoteRegistry(&conf.RemoteRegistry)
 	gw.cs = contractregistry.NewContractStore(&contractregistry.ContractStoreConf{
 		BaseURL:     conf.BaseURL,
 		StoragePath: conf.StoragePath,
+		Store:       conf.Store,
+		S3:          conf.S3,
+		PostgreSQL:  conf.PostgreSQL,
+		IndexDBPath: conf.IndexDBPath,
+
+		PurgeDeletedAfterSec: conf.PurgeDeletedSec,
 	}, rr)
 	if err = gw.cs.Init(); err != nil {
 		return nil, err
 	}
+	if processor != nil {
+		processor.SetContractABIResolver(gw)
+	}
 	syncDispatcher := newSyncDispatcher(processor)
 	if conf.EventLevelDBPath != "" {
 		gw.sm = events.NewSubscriptionManager(&conf.SubscriptionManagerConf, rpc, gw.cs, gw.ws)
@@ -171,6 +259,15 @@ func NewSmartContractGateway(conf *SmartContractGatewayConf, txnConf *tx.TxnProc
 		}
 	}
 	gw.r2e = newREST2eth(gw, gw.cs, rpc, gw.sm, processor, asyncDispatcher, syncDispatcher)
+	gw.r2e.syncPool = newSyncRequestPool(&conf.SyncRequests)
+	if gw.r2e.idempotency, err = newIdempotencyStore(&conf.Idempotency); err != nil {
+		return nil, err
+	}
+	gw.compileJobs = newCompileJobs(conf.CompileWorkers, conf.WebhooksAllowPrivateIPs, conf.WebhooksAllowedHosts, gw.processABIForm)
+	gw.abiImporter = newABIImporter(&conf.ABIImport, conf.WebhooksAllowPrivateIPs)
+	gw.dependencies = newDependencyResolver(&conf.Dependencies)
+	gw.r2e.abiImport = gw.importABI
+	gw.r2e.contractRestore = gw.deleteOrRestoreContract
 	return gw, nil
 }
 
@@ -181,6 +278,10 @@ type smartContractGW struct {
 	r2e             *rest2eth
 	ws              ws.WebSocketChannels
 	baseSwaggerConf *openapi.ABI2SwaggerConf
+	compileJobs     *compileJobs
+	abiImporter     *abiImporter
+	dependencies    *dependencyResolver
+	solc            *eth.SolcConf
 }
 
 // PostDeploy callback processes the transaction receipt and generates the Swagger
@@ -221,7 +322,7 @@ func (g *smartContractGW) PostDeploy(msg *messages.TransactionReceipt) error {
 				// This was invoked against an existing ABI, so we need to add an instance there
 				abiID = msg.Headers.ReqABIID
 			}
-			_, err = g.cs.AddContract(addrHexNo0x, abiID, registeredName, msg.RegisterAs)
+			_, err = g.cs.AddContract(addrHexNo0x, abiID, registeredName, msg.RegisterAs, nil)
 		}
 		return err
 	}
@@ -275,9 +376,10 @@ func (g *smartContractGW) PreDeploy(msg *messages.DeployContract) (err error) {
 	solidity := msg.Solidity
 	var compiled *eth.CompiledSolidity
 	if solidity != "" {
-		if compiled, err = eth.CompileContract(solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion); err != nil {
+		if compiled, err = eth.CompileContract(g.solc, solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion); err != nil {
 			return err
 		}
+		msg.CompilerSettings = eth.DefaultCompilerSettings(msg.EVMVersion)
 	}
 	if !contractregistry.IsRemote(msg.Headers.CommonHeaders) {
 		_, err = g.storeDeployableABI(msg, compiled)
@@ -308,9 +410,12 @@ func (g *smartContractGW) storeDeployableABI(msg *messages.DeployContract, compi
 	// Generate and store the swagger
 	swagger := g.swaggerForABI(openapi.NewABI2Swagger(g.baseSwaggerConf), requestID, msg.ContractName, false, runtimeABI, msg.DevDoc, "", "")
 	msg.Description = swagger.Info.Description // Swagger generation parses the devdoc
-	info := g.cs.AddABI(requestID, msg, time.Now().UTC())
+	info, err := g.cs.AddABI(requestID, msg, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
 
-	g.writeAbiInfo(requestID, msg)
+	g.cs.StoreABI(requestID, msg)
 
 	// We remove the solidity payload from the message, as we've consumed
 	// it by compiling and there is no need to serialize it again.
@@ -330,27 +435,94 @@ func (g *smartContractGW) gatewayErrReply(res http.ResponseWriter, req *http.Req
 	return
 }
 
-func (g *smartContractGW) writeAbiInfo(requestID string, msg *messages.DeployContract) error {
-	// We store all the details from our compile, or the user-supplied
-	// details, in a file under the message ID.
-	infoFile := path.Join(g.conf.StoragePath, "abi_"+requestID+".deploy.json")
-	infoBytes, _ := json.MarshalIndent(msg, "", "  ")
-	log.Infof("%s: Stashing deployment details to '%s'", requestID, infoFile)
-	if err := ioutil.WriteFile(infoFile, infoBytes, 0664); err != nil {
-		return errors.Errorf(errors.RESTGatewayLocalStoreContractSavePostDeploy, requestID, err)
-	}
-	return nil
-}
-
-// listContractsOrABIs sorts by Title then Address and returns an array
+// listContractsOrABIs returns an array filtered, sorted and paged by the query parameters,
+// with the total number of entries that match the filters in the X-Total-Count header
 func (g *smartContractGW) listContractsOrABIs(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	isContracts := strings.HasSuffix(req.URL.Path, "contracts")
+	opts, err := g.parseListOptions(req, isContracts)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
 	var retval []messages.TimeSortable
-	if strings.HasSuffix(req.URL.Path, "contracts") {
-		retval = g.cs.ListContracts()
+	var total int
+	if isContracts {
+		retval, total, err = g.cs.ListContracts(opts)
 	} else {
-		retval = g.cs.ListABIs()
+		retval, total, err = g.cs.ListABIs(opts)
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("X-Total-Count", strconv.Itoa(total))
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(&retval)
+}
+
+func (g *smartContractGW) parseListOptions(req *http.Request, isContracts bool) (*contractregistry.ListOptions, error) {
+	opts := &contractregistry.ListOptions{
+		Name:    req.FormValue("name"),
+		ABI:     req.FormValue("abi"),
+		Project: req.FormValue("project"),
+		Deleted: strings.ToLower(req.FormValue("deleted")) == "true",
+		Sort:    req.FormValue("sort"),
+	}
+	if !contractregistry.ValidSort(opts.Sort) {
+		return nil, errors.Errorf(errors.RESTGatewayListInvalidParam, "sort", opts.Sort)
+	}
+	for param, val := range map[string]*int{"skip": &opts.Skip, "limit": &opts.Limit} {
+		if str := req.FormValue(param); str != "" {
+			i, err := strconv.Atoi(str)
+			if err != nil || i < 0 {
+				return nil, errors.Errorf(errors.RESTGatewayListInvalidParam, param, str)
+			}
+			*val = i
+		}
+	}
+	if deployedAfter := req.FormValue("deployedAfter"); deployedAfter != "" {
+		t, err := time.Parse(time.RFC3339Nano, deployedAfter)
+		if err != nil {
+			return nil, errors.Errorf(errors.RESTGatewayListInvalidParam, "deployedAfter", deployedAfter)
+		}
+		opts.CreatedAfter = t
+	}
+	// The entry to page after must exist, and is normalized to the ID used in the index
+	if after := req.FormValue("after"); after != "" {
+		if isContracts {
+			info, err := g.cs.GetContractByAddress(after)
+			if err != nil {
+				return nil, errors.Errorf(errors.RESTGatewayListInvalidParam, "after", after)
+			}
+			opts.After = info.Address
+		} else {
+			info, err := g.cs.GetLocalABIInfo(after)
+			if err != nil {
+				return nil, errors.Errorf(errors.RESTGatewayListInvalidParam, "after", after)
+			}
+			opts.After = info.ID
+		}
+	}
+	return opts, nil
+}
+
+// listProjects returns the projects that ABIs and contracts are grouped in, with the number of each
+func (g *smartContractGW) listProjects(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	retval, err := g.cs.ListProjects()
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
 	}
 
 	status := 200
@@ -478,6 +650,13 @@ func (g *smartContractGW) getStreamOrSub(res http.ResponseWriter, req *http.Requ
 	var err error
 	if strings.HasPrefix(req.URL.Path, events.SubPathPrefix) {
 		retval, err = g.sm.SubscriptionByID(req.Context(), params.ByName("id"))
+	} else if params.ByName("id") == "export" {
+		if retval, err = g.sm.ExportEvents(req.Context()); err != nil {
+			g.gatewayErrReply(res, req, err, 500)
+			return
+		}
+	} else if params.ByName("id") == "heartbeat" {
+		retval, err = g.sm.LastHeartbeat(req.Context())
 	} else {
 		retval, err = g.sm.StreamByID(req.Context(), params.ByName("id"))
 	}
@@ -550,6 +729,95 @@ func (g *smartContractGW) addSub(res http.ResponseWriter, req *http.Request, par
 	enc.Encode(retval)
 }
 
+// subBatchHandler passes POST /subscriptions/batch to addSubBatch, as httprouter does
+// not allow a static path segment alongside the :id wildcard
+func (g *smartContractGW) subBatchHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	if params.ByName("id") != "batch" {
+		http.Error(res, http.StatusText(405), 405)
+		return
+	}
+	g.addSubBatch(res, req, params)
+}
+
+// subBatchErrReply is an error reply for a batch of subscriptions, with the result for each
+type subBatchErrReply struct {
+	*errors.RESTError
+	Results []*events.SubscriptionBatchResult `json:"results,omitempty"`
+}
+
+// addSubBatch creates an array of subscriptions over REST, all or nothing
+func (g *smartContractGW) addSubBatch(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
+	}
+
+	var body []*events.SubscriptionCreateDTO
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	results, err := g.sm.AddSubscriptions(req.Context(), body)
+	if err != nil {
+		status := 500
+		if e, ok := err.(errors.EthconnectError); ok && (e.Code() == errors.EventStreamsSubscribeBatchInvalid.Code() || e.Code() == errors.EventStreamsSubscribeBatchEmpty.Code()) {
+			status = 400
+		}
+		log.Errorf("<-- %s %s [%d]: %s", req.Method, req.URL, status, err)
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(status)
+		json.NewEncoder(res).Encode(&subBatchErrReply{
+			RESTError: errors.ToRESTError(err),
+			Results:   results,
+		})
+		return
+	}
+
+	status := 201
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(results)
+}
+
+// updateSub changes the name, stream or filter of a subscription over REST
+func (g *smartContractGW) updateSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
+	}
+
+	subID := params.ByName("id")
+	if _, err := g.sm.SubscriptionByID(req.Context(), subID); err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	var body events.SubscriptionUpdateDTO
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	sub, err := g.sm.UpdateSubscription(req.Context(), subID, &body)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(sub)
+}
+
 // resetSub resets subscription over REST
 func (g *smartContractGW) resetSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
@@ -577,6 +845,55 @@ func (g *smartContractGW) resetSub(res http.ResponseWriter, req *http.Request, p
 	res.WriteHeader(status)
 }
 
+// exportCheckpoint returns the checkpoint of a subscription, to import into another gateway
+func (g *smartContractGW) exportCheckpoint(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
+	}
+
+	cp, err := g.sm.ExportCheckpoint(req.Context(), params.ByName("id"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(cp)
+}
+
+// importCheckpoint moves a subscription to a checkpoint exported from another gateway
+func (g *smartContractGW) importCheckpoint(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
+	}
+
+	var cp events.SubscriptionCheckpoint
+	if err := json.NewDecoder(req.Body).Decode(&cp); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	if err := g.sm.ImportCheckpoint(req.Context(), params.ByName("id"), &cp); err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+}
+
 // suspendOrResumeStream suspends or resumes a stream
 func (g *smartContractGW) suspendOrResumeStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
@@ -603,90 +920,243 @@ func (g *smartContractGW) suspendOrResumeStream(res http.ResponseWriter, req *ht
 	res.WriteHeader(status)
 }
 
-func (g *smartContractGW) isSwaggerRequest(req *http.Request) (swaggerGen *openapi.ABI2Swagger, uiRequest, factoryOnly, abiRequest, refreshABI bool, from string) {
-	req.ParseForm()
-	var swaggerRequest bool
-	if vs := req.Form["swagger"]; len(vs) > 0 {
-		swaggerRequest = strings.ToLower(vs[0]) != "false"
+// streamAllHandler routes the operations on all streams, which share the path of a stream ID
+func (g *smartContractGW) streamAllHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	switch params.ByName("id") {
+	case "suspendall", "resumeall":
+		g.suspendOrResumeAllStreams(res, req, params)
+	case "import":
+		g.importEvents(res, req, params)
+	default:
+		http.Error(res, http.StatusText(405), 405)
 	}
-	if vs := req.Form["openapi"]; len(vs) > 0 {
-		swaggerRequest = strings.ToLower(vs[0]) != "false"
+}
+
+// suspendOrResumeAllStreams suspends or resumes every stream, such as for a maintenance window on the node
+func (g *smartContractGW) suspendOrResumeAllStreams(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
 	}
-	if vs := req.Form["ui"]; len(vs) > 0 {
-		uiRequest = strings.ToLower(vs[0]) != "false"
+
+	var err error
+	if params.ByName("id") == "resumeall" {
+		err = g.sm.ResumeAllStreams(req.Context())
+	} else {
+		err = g.sm.SuspendAllStreams(req.Context())
 	}
-	if vs := req.Form["factory"]; len(vs) > 0 {
-		factoryOnly = strings.ToLower(vs[0]) != "false"
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
 	}
-	if vs := req.Form["abi"]; len(vs) > 0 {
-		abiRequest = strings.ToLower(vs[0]) != "false"
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+}
+
+// importEvents creates the streams, subscriptions and checkpoints exported from another gateway
+func (g *smartContractGW) importEvents(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
 	}
-	if vs := req.Form["refresh"]; len(vs) > 0 {
-		refreshABI = strings.ToLower(vs[0]) != "false"
+
+	var backup events.EventsBackup
+	if err := json.NewDecoder(req.Body).Decode(&backup); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
 	}
-	from = req.FormValue("from")
-	if swaggerRequest {
-		var conf = *g.baseSwaggerConf
-		if vs := req.Form["noauth"]; len(vs) > 0 {
-			conf.BasicAuth = strings.ToLower(vs[0]) == "false"
-		}
-		if vs := req.Form["schemes"]; len(vs) > 0 {
-			requested := strings.Split(vs[0], ",")
-			conf.ExternalSchemes = []string{}
-			for _, scheme := range requested {
-				// Only allow http and https
-				if scheme == "http" || scheme == "https" {
-					conf.ExternalSchemes = append(conf.ExternalSchemes, scheme)
-				} else {
-					log.Warnf("Excluded unknown scheme: %s", scheme)
-				}
+	result, err := g.sm.ImportEvents(req.Context(), &backup)
+	if err != nil {
+		status := 500
+		if e, ok := err.(errors.EthconnectError); ok {
+			switch e.Code() {
+			case errors.EventStreamsBackupInvalidID.Code(),
+				errors.EventStreamsBackupMissingStream.Code(),
+				errors.EventStreamsBackupRedactedSecret.Code(),
+				errors.EventStreamsBackupInvalidStream.Code(),
+				errors.EventStreamsBackupInvalidSubscription.Code():
+				status = 400
 			}
 		}
-		swaggerGen = openapi.NewABI2Swagger(&conf)
+		g.gatewayErrReply(res, req, err, status)
+		return
 	}
-	return
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
 }
 
-func (g *smartContractGW) replyWithSwagger(res http.ResponseWriter, req *http.Request, swagger *spec.Swagger, id, from string) {
-	if from != "" {
-		if swagger.Parameters != nil {
-			if param, exists := swagger.Parameters["fromParam"]; exists {
-				param.SimpleSchema.Default = from
-				swagger.Parameters["fromParam"] = param
-			}
-		}
+// listDeadLetters lists the batches in the dead letter queue of a stream
+// getStreamMetrics returns the delivery metrics of a stream
+func (g *smartContractGW) getStreamMetrics(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
 	}
-	swaggerBytes, _ := json.MarshalIndent(&swagger, "", "  ")
 
-	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
-	res.Header().Set("Content-Type", "application/json")
-	if vs := req.Form["download"]; len(vs) > 0 {
-		res.Header().Set("Content-Disposition", "attachment; filename=\""+id+".swagger.json\"")
+	metrics, err := g.sm.StreamMetrics(req.Context(), params.ByName("id"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
 	}
-	res.WriteHeader(200)
-	res.Write(swaggerBytes)
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(metrics)
 }
 
-func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+func (g *smartContractGW) listDeadLetters(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
-	swaggerGen, uiRequest, factoryOnly, abiRequest, _, from := g.isSwaggerRequest(req)
-	id := strings.TrimPrefix(strings.ToLower(params.ByName("address")), "0x")
-	prefix := "contract"
-	if id == "" {
-		id = strings.ToLower(params.ByName("abi"))
-		prefix = "abi"
-	}
-	// For safety we always check our sanitized address index in memory, before checking the filesystem
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
+	}
+
+	deadLetters, err := g.sm.DeadLetters(req.Context(), params.ByName("id"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(&deadLetters)
+}
+
+// requeueOrDeleteDeadLetter sends a dead letter to its stream again, or discards it
+func (g *smartContractGW) requeueOrDeleteDeadLetter(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errEventSupportMissing, 405)
+		return
+	}
+
+	var err error
+	if req.Method == http.MethodDelete {
+		err = g.sm.DeleteDeadLetter(req.Context(), params.ByName("id"), params.ByName("dlid"))
+	} else {
+		err = g.sm.RequeueDeadLetter(req.Context(), params.ByName("id"), params.ByName("dlid"))
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+}
+
+func (g *smartContractGW) isSwaggerRequest(req *http.Request) (swaggerGen *openapi.ABI2Swagger, uiRequest, factoryOnly, abiRequest, refreshABI bool, from string) {
+	req.ParseForm()
+	var swaggerRequest bool
+	if vs := req.Form["swagger"]; len(vs) > 0 {
+		swaggerRequest = strings.ToLower(vs[0]) != "false"
+	}
+	if vs := req.Form["openapi"]; len(vs) > 0 {
+		swaggerRequest = strings.ToLower(vs[0]) != "false"
+	}
+	if vs := req.Form["ui"]; len(vs) > 0 {
+		uiRequest = strings.ToLower(vs[0]) != "false"
+	}
+	if vs := req.Form["factory"]; len(vs) > 0 {
+		factoryOnly = strings.ToLower(vs[0]) != "false"
+	}
+	if vs := req.Form["abi"]; len(vs) > 0 {
+		abiRequest = strings.ToLower(vs[0]) != "false"
+	}
+	if vs := req.Form["refresh"]; len(vs) > 0 {
+		refreshABI = strings.ToLower(vs[0]) != "false"
+	}
+	from = req.FormValue("from")
+	if swaggerRequest {
+		var conf = *g.baseSwaggerConf
+		if vs := req.Form["noauth"]; len(vs) > 0 {
+			conf.BasicAuth = strings.ToLower(vs[0]) == "false"
+		}
+		if vs := req.Form["schemes"]; len(vs) > 0 {
+			requested := strings.Split(vs[0], ",")
+			conf.ExternalSchemes = []string{}
+			for _, scheme := range requested {
+				// Only allow http and https
+				if scheme == "http" || scheme == "https" {
+					conf.ExternalSchemes = append(conf.ExternalSchemes, scheme)
+				} else {
+					log.Warnf("Excluded unknown scheme: %s", scheme)
+				}
+			}
+		}
+		swaggerGen = openapi.NewABI2Swagger(&conf)
+	}
+	return
+}
+
+func (g *smartContractGW) replyWithSwagger(res http.ResponseWriter, req *http.Request, swagger *spec.Swagger, id, from string) {
+	if from != "" {
+		if swagger.Parameters != nil {
+			if param, exists := swagger.Parameters["fromParam"]; exists {
+				param.SimpleSchema.Default = from
+				swagger.Parameters["fromParam"] = param
+			}
+		}
+	}
+	swaggerBytes, _ := json.MarshalIndent(&swagger, "", "  ")
+
+	if vs := req.Form["download"]; len(vs) > 0 {
+		res.Header().Set("Content-Disposition", "attachment; filename=\""+id+".swagger.json\"")
+	}
+	replyWithETag(res, req, swaggerBytes)
+}
+
+func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	swaggerGen, uiRequest, factoryOnly, abiRequest, _, from := g.isSwaggerRequest(req)
+	id := strings.TrimPrefix(strings.ToLower(params.ByName("address")), "0x")
+	prefix := "contract"
+	if id == "" {
+		id = strings.ToLower(params.ByName("abi"))
+		prefix = "abi"
+	}
+	// For safety we always check our sanitized address index in memory, before checking the filesystem
 	var registeredName string
 	var err error
 	var deployMsg *messages.DeployContract
 	var info messages.TimeSortable
 	var abiID string
+	var methodPolicy *contractregistry.MethodPolicy
 	if prefix == "contract" {
-		if deployMsg, registeredName, info, err = g.resolveAddressOrName(params.ByName("address")); err != nil {
-			g.gatewayErrReply(res, req, err, 404)
+		var contractInfo *contractregistry.ContractInfo
+		if deployMsg, registeredName, contractInfo, err = g.resolveAddressOrName(params.ByName("address")); err != nil {
+			g.gatewayErrReply(res, req, err, lookupErrStatus(err))
 			return
 		}
+		info = contractInfo
+		methodPolicy = contractInfo.MethodPolicy
 	} else {
 		abiID = id
 		info, err = g.cs.GetLocalABIInfo(abiID)
@@ -701,7 +1171,7 @@ func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Re
 			}
 		}
 		if err != nil {
-			g.gatewayErrReply(res, req, err, 404)
+			g.gatewayErrReply(res, req, err, lookupErrStatus(err))
 			return
 		}
 	}
@@ -709,7 +1179,8 @@ func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Re
 		g.writeHTMLForUI(prefix, id, from, (prefix == "abi"), factoryOnly, res)
 	} else if swaggerGen != nil {
 		addr := params.ByName("address")
-		runtimeABI, err := ethbind.API.ABIMarshalingToABIRuntime(deployMsg.ABI)
+		// Methods hidden by the method policy of a contract are left out of its API definition
+		runtimeABI, err := ethbind.API.ABIMarshalingToABIRuntime(methodPolicy.Filter(deployMsg.ABI))
 		if err != nil {
 			g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayInvalidABI, err), 404)
 			return
@@ -717,19 +1188,16 @@ func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Re
 		swagger := g.swaggerForABI(swaggerGen, abiID, deployMsg.ContractName, factoryOnly, runtimeABI, deployMsg.DevDoc, addr, registeredName)
 		g.replyWithSwagger(res, req, swagger, id, from)
 	} else if abiRequest {
-		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
-		res.Header().Set("Content-Type", "application/json")
-		res.WriteHeader(200)
-		enc := json.NewEncoder(res)
-		enc.SetIndent("", "  ")
-		enc.Encode(deployMsg.ABI)
+		replyWithJSONETag(res, req, deployMsg.ABI)
+	} else if vs := req.Form["outputs"]; len(vs) > 0 && strings.ToLower(vs[0]) != "false" {
+		// The extra solc outputs selected when the contract was compiled
+		outputs := deployMsg.CompilerOutputs
+		if outputs == nil {
+			outputs = map[string]json.RawMessage{}
+		}
+		replyWithJSONETag(res, req, outputs)
 	} else {
-		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
-		res.Header().Set("Content-Type", "application/json")
-		res.WriteHeader(200)
-		enc := json.NewEncoder(res)
-		enc.SetIndent("", "  ")
-		enc.Encode(info)
+		replyWithJSONETag(res, req, info)
 	}
 }
 
@@ -790,28 +1258,24 @@ func (g *smartContractGW) getRemoteRegistrySwaggerOrABI(res http.ResponseWriter,
 		swagger := g.swaggerForRemoteRegistry(swaggerGen, id, addr, factoryOnly, runtimeABI, deployMsg.DevDoc, req.URL.Path)
 		g.replyWithSwagger(res, req, swagger, id, from)
 	} else if abiRequest {
-		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
-		res.Header().Set("Content-Type", "application/json")
-		res.WriteHeader(200)
-		enc := json.NewEncoder(res)
-		enc.SetIndent("", "  ")
-		enc.Encode(deployMsg.ABI)
+		replyWithJSONETag(res, req, deployMsg.ABI)
 	} else {
 		ci := &remoteContractInfo{
 			ID:      deployMsg.Headers.ID,
 			ABI:     deployMsg.ABI,
 			Address: addr,
 		}
-		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
-		res.Header().Set("Content-Type", "application/json")
-		res.WriteHeader(200)
-		enc := json.NewEncoder(res)
-		enc.SetIndent("", "  ")
-		enc.Encode(ci)
+		replyWithJSONETag(res, req, ci)
 	}
 }
 
 func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	// httprouter does not allow a static path segment alongside the :address parameter,
+	// and "restore" is never a valid address
+	if params.ByName("address") == "restore" {
+		g.deleteOrRestoreABI(res, req, params)
+		return
+	}
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	addrHexNo0x := strings.ToLower(strings.TrimPrefix(params.ByName("address"), "0x"))
@@ -821,10 +1285,38 @@ func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Re
 		return
 	}
 
-	// Note: there is currently no body payload required for the POST
+	// The body is optional, and can pin defaults for the 'fly' params of requests to the contract,
+	// declare the token decimals of amount parameters, group the contract in a different project to its ABI,
+	// or declare on-chain guards that are checked before transactions are submitted
+	var body struct {
+		ParamDefaults map[string]string               `json:"paramDefaults"`
+		Decimals      map[string]int                  `json:"decimals"`
+		Project       string                          `json:"project"`
+		Guards        []*contractregistry.MethodGuard `json:"guards"`
+	}
+	if b, err := ioutil.ReadAll(req.Body); err == nil && len(bytes.TrimSpace(b)) > 0 {
+		if err := json.Unmarshal(b, &body); err != nil {
+			g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayParamDefaultsInvalid, err), 400)
+			return
+		}
+	}
+	paramDefaults, err := normalizeFlyParamDefaults(body.ParamDefaults)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	decimals, err := normalizeDecimals(body.Decimals)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	if err := contractregistry.ValidateProjectName(body.Project); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
 
 	abiID := params.ByName("abi")
-	_, err := g.cs.GetABI(contractregistry.ABILocation{
+	result, err := g.cs.GetABI(contractregistry.ABILocation{
 		ABIType: contractregistry.LocalABI,
 		Name:    abiID,
 	}, false)
@@ -832,6 +1324,16 @@ func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Re
 		g.gatewayErrReply(res, req, err, 404)
 		return
 	}
+	if result != nil && result.Contract.Deleted != "" {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayABIDeleted, abiID, result.Contract.Deleted), 410)
+		return
+	}
+	if result != nil && len(body.Guards) > 0 {
+		if err := contractregistry.ValidateGuards(body.Guards, result.Contract.ABI); err != nil {
+			g.gatewayErrReply(res, req, err, 400)
+			return
+		}
+	}
 
 	registerAs := getFlyParam("register", req)
 	registeredName := registerAs
@@ -839,9 +1341,15 @@ func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Re
 		registeredName = addrHexNo0x
 	}
 
-	contractInfo, err := g.cs.AddContract(addrHexNo0x, abiID, registeredName, registerAs)
+	// The contract is registered with its options in a single update, so a failure does not leave it partially registered
+	contractInfo, err := g.cs.AddContract(addrHexNo0x, abiID, registeredName, registerAs, &contractregistry.RegistrationOptions{
+		ParamDefaults: paramDefaults,
+		Decimals:      decimals,
+		Project:       body.Project,
+		Guards:        body.Guards,
+	})
 	if err != nil {
-		g.gatewayErrReply(res, req, err, 409)
+		g.gatewayErrReply(res, req, err, registrationErrStatus(err))
 		return
 	}
 
@@ -852,6 +1360,137 @@ func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Re
 	json.NewEncoder(res).Encode(&contractInfo)
 }
 
+// setMethodPolicy replaces the method policy of a registered contract, or removes it for a DELETE
+func (g *smartContractGW) setMethodPolicy(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	deployMsg, _, info, err := g.resolveAddressOrName(params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, lookupErrStatus(err))
+		return
+	}
+
+	var policy *contractregistry.MethodPolicy
+	if req.Method != http.MethodDelete {
+		policy = &contractregistry.MethodPolicy{}
+		if err := json.NewDecoder(req.Body).Decode(policy); err != nil {
+			g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayMethodPolicyInvalid, err), 400)
+			return
+		}
+		// Catch mistyped entries, which would otherwise silently expose the method
+		for _, entry := range append(policy.Allow, policy.Deny...) {
+			if !declaresMethod(deployMsg.ABI, entry) {
+				g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayMethodPolicyUnknownMethod, entry), 400)
+				return
+			}
+		}
+	}
+	if err := auth.AuthRPC(req.Context(), "ethconnect_setMethodPolicy", info.Address, policy); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	info, err = g.cs.SetMethodPolicy(info.Address, policy)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(info)
+}
+
+// deleteOrRestoreContract soft-deletes a contract for a DELETE, or restores a deleted contract
+func (g *smartContractGW) deleteOrRestoreContract(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var info *contractregistry.ContractInfo
+	var err error
+	if req.Method == http.MethodDelete {
+		info, err = g.cs.DeleteContract(params.ByName("address"))
+	} else {
+		info, err = g.cs.RestoreContract(params.ByName("address"))
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, lookupErrStatus(err))
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(info)
+}
+
+// deleteOrRestoreABI soft-deletes an ABI for a DELETE, or restores a deleted ABI
+func (g *smartContractGW) deleteOrRestoreABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	abiID := params.ByName("abi")
+	var info *contractregistry.ABIInfo
+	var err error
+	if req.Method == http.MethodDelete {
+		info, err = g.cs.DeleteABI(abiID)
+	} else {
+		info, err = g.cs.RestoreABI(abiID)
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, lookupErrStatus(err))
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(info)
+}
+
+// registrationErrStatus is the HTTP status for a failure to register a contract, which is
+// 409 Conflict if the name is registered to another contract, or 500 if it could not be stored
+func registrationErrStatus(err error) int {
+	if e, ok := err.(errors.EthconnectError); ok && e.Code() == errors.RESTGatewayFriendlyNameClash.Code() {
+		return 409
+	}
+	return 500
+}
+
+// lookupErrStatus is the HTTP status for a failure to look up a contract or ABI, which is
+// 410 Gone once it has been deleted, or 409 Conflict if its state prevents the update
+func lookupErrStatus(err error) int {
+	if contractregistry.IsDeleted(err) {
+		return 410
+	}
+	if e, ok := err.(errors.EthconnectError); ok {
+		switch e.Code() {
+		case errors.RESTGatewayABIInUse.Code(), errors.RESTGatewayContractABIDeleted.Code(), errors.RESTGatewayContractNotDeleted.Code(), errors.RESTGatewayABINotDeleted.Code():
+			return 409
+		}
+	}
+	return 404
+}
+
+// declaresMethod checks if an ABI declares a function with a name or signature
+func declaresMethod(abi ethbinding.ABIMarshaling, nameOrSignature string) bool {
+	for i := range abi {
+		if abi[i].Type == "function" && (abi[i].Name == nameOrSignature || contractregistry.FunctionSignature(&abi[i]) == nameOrSignature) {
+			return true
+		}
+	}
+	return false
+}
+
 func tempdir() string {
 	dir, _ := ioutil.TempDir("", "fly")
 	log.Infof("tmpdir/create: %s", dir)
@@ -866,21 +1505,17 @@ func cleanup(dir string) {
 func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
-	if err := req.ParseMultipartForm(maxFormParsingMemory); err != nil {
-		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err), 400)
-		return
-	}
-
 	tempdir := tempdir()
-	defer cleanup(tempdir)
-	for name, files := range req.MultipartForm.File {
-		log.Debugf("multi-part form entry '%s'", name)
-		for _, fileHeader := range files {
-			if err := g.extractMultiPartFile(tempdir, fileHeader); err != nil {
-				g.gatewayErrReply(res, req, err, 400)
-				return
-			}
+	queued := false
+	defer func() {
+		// Once queued, the compile job owns the temporary directory
+		if !queued {
+			cleanup(tempdir)
 		}
+	}()
+	if status, err := g.readMultipartForm(req, tempdir); err != nil {
+		g.gatewayErrReply(res, req, err, status)
+		return
 	}
 
 	if vs := req.Form["findsolidity"]; len(vs) > 0 {
@@ -900,57 +1535,152 @@ func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, par
 		return
 	}
 
-	abi, err := g.parseABI(req.Form)
-	if err != nil {
-		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err), 400)
+	if vs := req.Form["async"]; len(vs) > 0 && (vs[0] == "" || strings.EqualFold(vs[0], "true")) {
+		job, status, err := g.compileJobs.submit(tempdir, req.Form, req.FormValue("webhook"))
+		if err != nil {
+			g.gatewayErrReply(res, req, err, status)
+			return
+		}
+		queued = true
+		log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(status)
+		json.NewEncoder(res).Encode(job)
 		return
 	}
 
-	bytecode, err := g.parseBytecode(req.Form)
+	result, status, err := g.processABIForm(tempdir, req.Form, nil)
 	if err != nil {
-		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err), 400)
+		g.gatewayErrReply(res, req, err, status)
 		return
 	}
 
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(result)
+}
+
+// processABIForm compiles and stores the ABI for a POST /abis request, once the form has been read.
+// It runs within the request, or in the background for an async compile job
+func (g *smartContractGW) processABIForm(dir string, form url.Values, job *compileJob) (interface{}, int, error) {
+	project := form.Get("project")
+	if err := contractregistry.ValidateProjectName(project); err != nil {
+		return nil, 400, err
+	}
+
+	abi, err := g.parseABI(form)
+	if err != nil {
+		return nil, 400, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err)
+	}
+
+	bytecode, err := g.parseBytecode(form)
+	if err != nil {
+		return nil, 400, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err)
+	}
+
+	// An ABI that only declares events is stored without bytecode, so it can be
+	// registered against existing addresses to subscribe to their events
+	eventsOnly := abi != nil && bytecode == nil && isEventsOnlyABI(abi)
+
 	var preCompiled map[string]*ethbinding.Contract
-	if bytecode == nil {
-		var err error
-		preCompiled, err = g.compileMultipartFormSolidity(tempdir, req)
+	var compilation *solcCompilation
+	if bytecode == nil && !eventsOnly {
+		job.setStage("compiling")
+		compilation, err = g.compileMultipartFormSolidity(dir, form, job)
 		if err != nil {
-			g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayCompileContractCompileFailed, err), 400)
-			return
+			return nil, eth.CompileErrorStatus(err, 400), errors.Errorf(errors.RESTGatewayCompileContractCompileFailed, err)
 		}
+		preCompiled = compilation.contracts
 	}
 
-	if vs := req.Form["findcontracts"]; len(vs) > 0 {
+	if vs := form["findcontracts"]; len(vs) > 0 {
 		contractNames := make([]string, 0, len(preCompiled))
 		for contractName := range preCompiled {
 			contractNames = append(contractNames, contractName)
 		}
-		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
-		res.Header().Set("Content-Type", "application/json")
-		res.WriteHeader(200)
-		json.NewEncoder(res).Encode(&contractNames)
-		return
+		return contractNames, 200, nil
 	}
 
 	msg := &messages.DeployContract{}
 	msg.Headers.MsgType = messages.MsgTypeSendTransaction
 	msg.Headers.ID = utils.UUIDv4()
+	msg.Project = project
 	var compiled *eth.CompiledSolidity
 	if bytecode == nil && abi == nil {
-		var err error
-		compiled, err = eth.ProcessCompiled(preCompiled, req.FormValue("contract"), false)
+		job.setStage("processing")
+		compiled, err = eth.ProcessCompiled(preCompiled, form.Get("contract"), false)
 		if err != nil {
-			g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayCompileContractPostCompileFailed, err), 400)
-			return
+			return nil, 400, errors.Errorf(errors.RESTGatewayCompileContractPostCompileFailed, err)
 		}
+		msg.CompilerSettings = compilation.settings
+		msg.CompilerOutputs = compilation.outputsFor(form.Get("contract"))
 	} else {
 		msg.ABI = abi
 		msg.Compiled = bytecode
 	}
 
+	job.setStage("storing")
 	info, err := g.storeDeployableABI(msg, compiled)
+	if err != nil {
+		return nil, 500, err
+	}
+	return info, 200, nil
+}
+
+func (g *smartContractGW) getCompileJob(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	job := g.compileJobs.get(params.ByName("id"))
+	if job == nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayCompileJobNotFound, params.ByName("id")), 404)
+		return
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	json.NewEncoder(res).Encode(job)
+}
+
+// listSolcVersions lists the Solidity compilers that are installed, and the releases that can be
+// downloaded when solc downloads are enabled
+func (g *smartContractGW) listSolcVersions(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	versions, err := eth.ListSolcVersions(g.solc)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 502)
+		return
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	json.NewEncoder(res).Encode(versions)
+}
+
+// getSolcMetrics returns the metrics of the Solidity compilations since startup
+func (g *smartContractGW) getSolcMetrics(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	json.NewEncoder(res).Encode(eth.SolcMetrics(g.solc))
+}
+
+// getPendingTransactions returns the transactions the node has queued for an address, merged
+// with the transactions ethconnect has in-flight for it
+func (g *smartContractGW) getPendingTransactions(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	addr, err := utils.StrToAddress("address", params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	pending, err := g.r2e.processor.PendingTransactions(req.Context(), addr.Hex())
 	if err != nil {
 		g.gatewayErrReply(res, req, err, 500)
 		return
@@ -959,7 +1689,82 @@ func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, par
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(200)
-	json.NewEncoder(res).Encode(info)
+	json.NewEncoder(res).Encode(pending)
+}
+
+// getInflightTransactions returns the transactions ethconnect is tracking in-flight, for every
+// address or for a single address, to diagnose transactions stuck behind a nonce
+func (g *smartContractGW) getInflightTransactions(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	from := params.ByName("from")
+	if err := auth.AuthRPC(req.Context(), "ethconnect_inflightTransactions", from); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	inflight, err := g.r2e.processor.InflightTransactions(from)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	if from != "" && len(inflight) > 0 {
+		json.NewEncoder(res).Encode(inflight[0])
+	} else {
+		json.NewEncoder(res).Encode(inflight)
+	}
+}
+
+// resetNonce clears the nonce state of an address, so the next transaction queries the node for
+// its nonce, or uses the nonce supplied in the body or query
+func (g *smartContractGW) resetNonce(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	addr, err := utils.StrToAddress("address", params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	var body struct {
+		Nonce json.Number `json:"nonce"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadParseFailed, err), 400)
+		return
+	}
+	nonceStr := body.Nonce.String()
+	if nonceStr == "" {
+		nonceStr = req.URL.Query().Get("nonce")
+	}
+	var nextNonce *int64
+	if nonceStr != "" {
+		nonce, err := strconv.ParseInt(nonceStr, 10, 64)
+		if err != nil {
+			g.gatewayErrReply(res, req, errors.Errorf(errors.TransactionNonceResetInvalid, nonceStr), 400)
+			return
+		}
+		nextNonce = &nonce
+	}
+	addrHex := strings.ToLower(addr.Hex())
+	if err := auth.AuthRPC(req.Context(), "ethconnect_resetNonce", addrHex, nextNonce); err != nil {
+		log.Errorf("Unauthorized: %s", err)
+		g.gatewayErrReply(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	reset, err := g.r2e.processor.ResetNonce(addrHex, nextNonce)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	json.NewEncoder(res).Encode(reset)
 }
 
 func (g *smartContractGW) parseBytecode(form url.Values) ([]byte, error) {
@@ -991,7 +1796,113 @@ func (g *smartContractGW) parseABI(form url.Values) (ethbinding.ABIMarshaling, e
 	return nil, nil
 }
 
-func (g *smartContractGW) compileMultipartFormSolidity(dir string, req *http.Request) (map[string]*ethbinding.Contract, error) {
+// solcCompilation is the result of compiling the Solidity in a multi-part form, with the settings
+// used and any extra outputs selected from solc, which are keyed by contract name
+type solcCompilation struct {
+	contracts map[string]*ethbinding.Contract
+	settings  *messages.CompilerSettings
+	outputs   map[string]map[string]json.RawMessage
+}
+
+// outputsFor returns the extra outputs of the contract, which can be omitted when only one was compiled
+func (c *solcCompilation) outputsFor(contractName string) map[string]json.RawMessage {
+	if contractName == "" && len(c.outputs) == 1 {
+		for _, outputs := range c.outputs {
+			return outputs
+		}
+	}
+	return c.outputs[contractName]
+}
+
+// solcSettingChecker restricts EVM versions and output names to those solc could accept
+var solcSettingChecker = regexp.MustCompile("^[a-zA-Z][a-zA-Z-]*$")
+
+// parseCompilerSettings reads the solc settings from the form fields or query parameters. The
+// defaults match the compilation of Solidity supplied in a DeployContract message
+func parseCompilerSettings(form url.Values) (*messages.CompilerSettings, error) {
+	evmVersion := form.Get("evmVersion")
+	if evmVersion == "" {
+		evmVersion = form.Get("evm")
+	}
+	if evmVersion != "" && !solcSettingChecker.MatchString(evmVersion) {
+		return nil, errors.Errorf(errors.RESTGatewayCompilerSettingsInvalid, "evmVersion", evmVersion)
+	}
+	settings := eth.DefaultCompilerSettings(evmVersion)
+	if v := form.Get("optimize"); v != "" {
+		optimize, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Errorf(errors.RESTGatewayCompilerSettingsInvalid, "optimize", v)
+		}
+		settings.Optimize = optimize
+	}
+	if v := form.Get("optimize-runs"); v != "" {
+		runs, err := strconv.Atoi(v)
+		if err != nil || runs <= 0 {
+			return nil, errors.Errorf(errors.RESTGatewayCompilerSettingsInvalid, "optimize-runs", v)
+		}
+		if !settings.Optimize {
+			return nil, errors.Errorf(errors.RESTGatewayCompilerSettingsInvalid, "optimize-runs", "the optimizer is disabled")
+		}
+		settings.OptimizeRuns = runs
+	}
+	for _, v := range form["outputs"] {
+		for _, output := range strings.Split(v, ",") {
+			output = strings.TrimSpace(output)
+			if output == "" || eth.IsDefaultSolcOutput(output) {
+				continue
+			}
+			if !solcSettingChecker.MatchString(output) {
+				return nil, errors.Errorf(errors.RESTGatewayCompilerSettingsInvalid, "outputs", output)
+			}
+			settings.Outputs = append(settings.Outputs, output)
+		}
+	}
+	return settings, nil
+}
+
+// selectedSolcOutputs picks the extra outputs from the combined JSON of solc for each contract
+func selectedSolcOutputs(combinedJSON []byte, outputs []string) (map[string]map[string]json.RawMessage, error) {
+	var combined struct {
+		Contracts map[string]map[string]json.RawMessage `json:"contracts"`
+	}
+	if err := json.Unmarshal(combinedJSON, &combined); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]map[string]json.RawMessage, len(combined.Contracts))
+	for contractName, contract := range combined.Contracts {
+		selected[contractName] = make(map[string]json.RawMessage, len(outputs))
+		for _, output := range outputs {
+			if v, ok := contract[output]; ok {
+				selected[contractName][output] = v
+			}
+		}
+	}
+	return selected, nil
+}
+
+func (g *smartContractGW) compileMultipartFormSolidity(dir string, form url.Values, job *compileJob) (*solcCompilation, error) {
+	if standardJSON := form.Get("standardjson"); standardJSON != "" {
+		// The settings for a standard-JSON compilation are in the input itself
+		compiled, err := g.compileStandardJSON(dir, standardJSON, form, job)
+		if err != nil {
+			return nil, err
+		}
+		return &solcCompilation{contracts: compiled}, nil
+	}
+
+	settings, err := parseCompilerSettings(form)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Remappings, err = readRemappings(dir, form); err != nil {
+		return nil, err
+	}
+	if g.dependencies != nil {
+		if err := g.dependencies.resolve(dir, form, settings.Remappings, job); err != nil {
+			return nil, err
+		}
+	}
+
 	solFiles := []string{}
 	rootFiles, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -1005,77 +1916,288 @@ func (g *smartContractGW) compileMultipartFormSolidity(dir string, req *http.Req
 		}
 	}
 
-	evmVersion := req.FormValue("evm")
-	solcArgs := eth.GetSolcArgs(evmVersion)
-	if sourceFiles := req.Form["source"]; len(sourceFiles) > 0 {
-		solcArgs = append(solcArgs, sourceFiles...)
-	} else if len(solFiles) > 0 {
-		solcArgs = append(solcArgs, solFiles...)
-	} else {
+	solcArgs := eth.SolcArgs(settings)
+	sourceFiles := form["source"]
+	if len(sourceFiles) == 0 {
+		sourceFiles = solFiles
+	}
+	if len(sourceFiles) == 0 {
 		return nil, errors.Errorf(errors.RESTGatewayCompileContractNoSOL)
 	}
+	solcArgs = append(solcArgs, sourceFiles...)
 
-	solcVer, err := eth.GetSolc(req.FormValue("compiler"))
+	solcVer, err := eth.GetSolcForSource(g.solc, form.Get("compiler"), readSolidityFiles(dir, sourceFiles)...)
 	if err != nil {
 		return nil, errors.Errorf(errors.RESTGatewayCompileContractSolcVerFail, err)
 	}
 	solOptionsString := strings.Join(append([]string{solcVer.Path}, solcArgs...), " ")
 	log.Infof("Compiling: %s", solOptionsString)
-	cmd := exec.Command(solcVer.Path, solcArgs...)
-
+	job.logf("Compiling: %s", solOptionsString)
 	var stderr, stdout bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	cmd.Dir = dir
-	if err := cmd.Run(); err != nil {
+	if err := eth.RunSolc(g.solc, solcVer.Path, solcArgs, dir, nil, &stdout, &stderr); err != nil {
+		job.logf("%s", stderr.String())
+		if eth.CompileErrorStatus(err, 0) != 0 {
+			return nil, err
+		}
 		return nil, errors.Errorf(errors.RESTGatewayCompileContractCompileFailDetails, err, stderr.String())
 	}
+	if stderr.Len() > 0 {
+		// Warnings from the compiler
+		job.logf("%s", stderr.String())
+	}
 
 	compiled, err := ethbind.API.ParseCombinedJSON(stdout.Bytes(), "", solcVer.Version, solcVer.Version, solOptionsString)
 	if err != nil {
 		return nil, errors.Errorf(errors.RESTGatewayCompileContractSolcOutputProcessFail, err)
 	}
+	compilation := &solcCompilation{
+		contracts: compiled,
+		settings:  settings,
+	}
+	if len(settings.Outputs) > 0 {
+		if compilation.outputs, err = selectedSolcOutputs(stdout.Bytes(), settings.Outputs); err != nil {
+			return nil, errors.Errorf(errors.RESTGatewayCompileContractSolcOutputProcessFail, err)
+		}
+	}
 
-	return compiled, nil
+	return compilation, nil
 }
 
-func (g *smartContractGW) extractMultiPartFile(dir string, file *multipart.FileHeader) error {
-	fileName := file.Filename
-	if strings.ContainsAny(fileName, "/\\") {
-		return errors.Errorf(errors.RESTGatewayCompileContractSlashes)
+// readRemappings returns the import remappings from a remappings.txt in the root of the upload,
+// followed by those in the remappings form fields, one per line
+func readRemappings(dir string, form url.Values) ([]string, error) {
+	var lines []string
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "remappings.txt")); err == nil {
+		lines = append(lines, strings.Split(string(b), "\n")...)
+	}
+	for _, v := range form["remappings"] {
+		lines = append(lines, strings.Split(v, "\n")...)
+	}
+	var remappings []string
+	for _, line := range lines {
+		remapping := strings.TrimSpace(line)
+		if remapping == "" {
+			continue
+		}
+		if !isValidRemapping(remapping) {
+			return nil, errors.Errorf(errors.RESTGatewayCompileContractBadRemapping, remapping)
+		}
+		remappings = append(remappings, remapping)
+	}
+	return remappings, nil
+}
+
+// isValidRemapping checks a remapping has the form [context:]prefix=target, and the target
+// is a relative path within the upload, as solc is only allowed to read files from there
+func isValidRemapping(remapping string) bool {
+	eq := strings.Index(remapping, "=")
+	if eq <= 0 || strings.HasPrefix(remapping, "-") || strings.ContainsAny(remapping, " \t") {
+		return false
+	}
+	target := remapping[eq+1:]
+	if target == "" || filepath.IsAbs(target) {
+		return false
+	}
+	target = filepath.Clean(target)
+	return target != ".." && !strings.HasPrefix(target, "../")
+}
+
+// readSolidityFiles reads the Solidity files to be compiled, so the compiler version can be
+// selected from their version pragmas. Files that cannot be read are left for solc to report
+func readSolidityFiles(dir string, files []string) []string {
+	sources := make([]string, 0, len(files))
+	for _, file := range files {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, filepath.Clean("/"+file))); err == nil {
+			sources = append(sources, string(b))
+		}
 	}
-	in, err := file.Open()
+	return sources
+}
+
+// compileStandardJSON compiles a solc standard-JSON input document uploaded with the form,
+// so the exact compiler settings of a Hardhat or Foundry build can be reproduced
+func (g *smartContractGW) compileStandardJSON(dir, standardJSON string, form url.Values, job *compileJob) (map[string]*ethbinding.Contract, error) {
+	input, err := ioutil.ReadFile(filepath.Join(dir, filepath.Clean("/"+standardJSON)))
+	if err != nil {
+		log.Errorf("Failed to read standard-JSON input '%s': %s", standardJSON, err)
+		return nil, errors.Errorf(errors.RESTGatewayCompileContractStandardJSONMissing, standardJSON)
+	}
+
+	solcVer, err := eth.GetSolcForSource(g.solc, form.Get("compiler"), eth.StandardJSONSources(input)...)
 	if err != nil {
-		log.Errorf("Failed opening '%s' for reading: %s", fileName, err)
-		return errors.Errorf(errors.RESTGatewayCompileContractUnzipRead)
+		return nil, errors.Errorf(errors.RESTGatewayCompileContractSolcVerFail, err)
+	}
+	log.Infof("Compiling: %s --standard-json < %s", solcVer.Path, standardJSON)
+	job.logf("Compiling: %s --standard-json < %s", solcVer.Path, standardJSON)
+	return eth.CompileStandardJSON(g.solc, solcVer, input, dir, func(warning string) {
+		job.logf("%s", warning)
+	})
+}
+
+// readMultipartForm streams each file in the multi-part form directly to disk in the supplied
+// directory, rather than buffering in memory, and sets the other form fields into req.Form.
+// The request is rejected as soon as the files, including the contents of archives once
+// unpacked, exceed the maximum total upload size.
+func (g *smartContractGW) readMultipartForm(req *http.Request, dir string) (int, error) {
+	maxUploadSizeMB := g.conf.MaxUploadSizeMB
+	if maxUploadSizeMB <= 0 {
+		maxUploadSizeMB = defaultMaxUploadSizeMB
+	}
+	remaining := maxUploadSizeMB << 20
+	if req.ContentLength > remaining+maxFormParsingMemory {
+		return 413, errors.Errorf(errors.RESTGatewayCompileContractUploadTooLarge, maxUploadSizeMB)
+	}
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return 400, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err)
+	}
+
+	// Query parameters come first, as with http.Request.ParseMultipartForm
+	form := req.URL.Query()
+	var valuesSize int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 400, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err)
+		}
+		name := part.FormName()
+		if part.FileName() == "" {
+			// Only the other form fields are held in memory
+			value, err := ioutil.ReadAll(io.LimitReader(part, maxFormParsingMemory-valuesSize+1))
+			if err != nil {
+				return 400, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, err)
+			}
+			if valuesSize += int64(len(value)); valuesSize > maxFormParsingMemory {
+				return 400, errors.Errorf(errors.RESTGatewayCompileContractInvalidFormData, multipart.ErrMessageTooLarge)
+			}
+			form[name] = append(form[name], string(value))
+			continue
+		}
+		log.Debugf("multi-part form entry '%s'", name)
+		written, err := g.extractMultiPartFile(dir, part.FileName(), part, remaining)
+		if err != nil {
+			if written > remaining {
+				return 413, errors.Errorf(errors.RESTGatewayCompileContractUploadTooLarge, maxUploadSizeMB)
+			}
+			if e, ok := err.(errors.EthconnectError); ok && e.Code() == errors.RESTGatewayCompileContractUploadTooManyFiles.Code() {
+				return 413, err
+			}
+			return 400, err
+		}
+		remaining -= written
+	}
+	req.Form = form
+	return 200, nil
+}
+
+// readErrCapture records errors from the reader, to distinguish them from errors writing
+type readErrCapture struct {
+	r   io.Reader
+	err error
+}
+
+func (c *readErrCapture) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// extractMultiPartFile writes a file from the form to the directory, and unpacks it if it is an archive.
+// It returns the number of bytes written, including the unpacked contents of an archive
+func (g *smartContractGW) extractMultiPartFile(dir, fileName string, in io.Reader, maxSize int64) (int64, error) {
+	if strings.ContainsAny(fileName, "/\\") {
+		return 0, errors.Errorf(errors.RESTGatewayCompileContractSlashes)
 	}
-	defer in.Close()
 	outFileName := path.Join(dir, fileName)
 	out, err := os.OpenFile(outFileName, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Errorf("Failed opening '%s' for writing: %s", fileName, err)
-		return errors.Errorf(errors.RESTGatewayCompileContractUnzipWrite)
+		return 0, errors.Errorf(errors.RESTGatewayCompileContractUnzipWrite)
+	}
+	// Read one byte more than the limit, so we can detect it has been exceeded
+	src := &readErrCapture{r: io.LimitReader(in, maxSize+1)}
+	written, err := io.Copy(out, src)
+	out.Close()
+	if src.err != nil {
+		log.Errorf("Failed reading '%s' from multi-part form: %s", fileName, src.err)
+		return written, errors.Errorf(errors.RESTGatewayCompileContractUnzipRead)
 	}
-	written, err := io.Copy(out, in)
 	if err != nil {
 		log.Errorf("Failed writing '%s' from multi-part form: %s", fileName, err)
-		return errors.Errorf(errors.RESTGatewayCompileContractUnzipCopy)
+		return written, errors.Errorf(errors.RESTGatewayCompileContractUnzipCopy)
+	}
+	if written > maxSize {
+		log.Errorf("Upload limit exceeded writing '%s' from multi-part form", fileName)
+		return written, errors.Errorf(errors.RESTGatewayCompileContractUploadTooLarge, maxSize>>20)
 	}
 	log.Debugf("multi-part: '%s' [%dKb]", fileName, written/1024)
-	return g.processIfArchive(dir, outFileName)
+	unpacked, err := g.processIfArchive(dir, outFileName, maxSize-written)
+	return written + unpacked, err
 }
 
-func (g *smartContractGW) processIfArchive(dir, fileName string) error {
+// processIfArchive unpacks an archive into the directory, and returns the size of its contents.
+// The archive is walked first, to check its contents fit in what remains of the upload limit,
+// so an archive that unpacks to far more than its own size cannot fill the disk
+func (g *smartContractGW) processIfArchive(dir, fileName string, maxSize int64) (int64, error) {
 	z, err := archiver.ByExtension(fileName)
 	if err != nil {
 		log.Debugf("multi-part: '%s' not an archive: %s", fileName, err)
-		return nil
+		return 0, nil
+	}
+	unpacked, err := archiveSize(z, fileName, maxSize)
+	if err != nil {
+		return unpacked, err
 	}
 	err = z.(archiver.Unarchiver).Unarchive(fileName, dir)
 	if err != nil {
-		return errors.Errorf(errors.RESTGatewayCompileContractUnzip, err)
+		return unpacked, errors.Errorf(errors.RESTGatewayCompileContractUnzip, err)
 	}
-	return nil
+	return unpacked, nil
+}
+
+// archiveSize reads each entry of an archive, without writing it, to count the bytes it unpacks to.
+// It stops as soon as the total exceeds the limit, or the archive has too many entries, rather
+// than trusting the sizes recorded in the archive
+func archiveSize(z interface{}, fileName string, maxSize int64) (int64, error) {
+	walker, ok := z.(archiver.Walker)
+	if !ok {
+		return 0, errors.Errorf(errors.RESTGatewayCompileContractUnzip, "archive format cannot be read")
+	}
+	var total int64
+	var entries int
+	var limitErr error
+	err := walker.Walk(fileName, func(f archiver.File) error {
+		if entries++; entries > maxArchiveEntries {
+			limitErr = errors.Errorf(errors.RESTGatewayCompileContractUploadTooManyFiles, maxArchiveEntries)
+			return limitErr
+		}
+		if f.IsDir() {
+			return nil
+		}
+		// Read one byte more than the limit, so we can detect it has been exceeded
+		n, err := io.Copy(ioutil.Discard, io.LimitReader(f, maxSize-total+1))
+		total += n
+		if err != nil {
+			return err
+		}
+		if total > maxSize {
+			limitErr = errors.Errorf(errors.RESTGatewayCompileContractUploadTooLarge, maxSize>>20)
+			return limitErr
+		}
+		return nil
+	})
+	if limitErr != nil {
+		log.Errorf("Upload limit exceeded unpacking '%s': %s", fileName, limitErr)
+		return total, limitErr
+	}
+	if err != nil {
+		return total, errors.Errorf(errors.RESTGatewayCompileContractUnzip, err)
+	}
+	return total, nil
 }
 
 // Write out a nice little UI for exercising the Swagger
@@ -1194,15 +2316,27 @@ func (g *smartContractGW) Shutdown() {
 	if g.cs != nil {
 		g.cs.Close()
 	}
+	if g.compileJobs != nil {
+		g.compileJobs.close()
+	}
+	if g.r2e != nil {
+		g.r2e.idempotency.close()
+	}
 }
 
 func (g *smartContractGW) resolveAddressOrName(id string) (deployMsg *messages.DeployContract, registeredName string, info *contractregistry.ContractInfo, err error) {
 	info, err = g.cs.GetContractByAddress(id)
 	if err != nil {
+		if contractregistry.IsDeleted(err) {
+			return nil, "", nil, err
+		}
 		var origErr = err
 		registeredName = id
 		if id, err = g.cs.ResolveContractAddress(registeredName); err != nil {
 			log.Infof("%s is not a friendly name: %s", registeredName, err)
+			if contractregistry.IsDeleted(err) {
+				return nil, "", nil, err
+			}
 			return nil, "", nil, origErr
 		}
 		if info, err = g.cs.GetContractByAddress(id); err != nil {
@@ -1216,5 +2350,8 @@ func (g *smartContractGW) resolveAddressOrName(id string) (deployMsg *messages.D
 	if result != nil {
 		deployMsg = result.Contract
 	}
+	if err == nil {
+		deployMsg, err = contractregistry.MergeFacets(g.cs, info, deployMsg)
+	}
 	return deployMsg, registeredName, info, err
 }
@@ -21,12 +21,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/go-openapi/spec"
@@ -34,16 +38,20 @@ import (
 	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
 	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
 	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
 	"github.com/hyperledger/firefly-ethconnect/internal/events"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/hyperledger/firefly-ethconnect/internal/ws"
 	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
 	"github.com/julienschmidt/httprouter"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/mholt/archiver"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 type mockWebSocketServer struct {
@@ -58,6 +66,10 @@ func (m *mockWebSocketServer) SendReply(message interface{}) {
 	m.testChan <- message
 }
 
+func (m *mockWebSocketServer) Connections(topic string) []*ws.ConnectionInfo {
+	return nil
+}
+
 type SolcJson struct {
 	ABI string `json:"abi"`
 	Bin string `json:"bin"`
@@ -90,6 +102,7 @@ func TestNewSmartContractGatewayBadURL(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 }
@@ -108,6 +121,7 @@ func TestNewSmartContractGatewayWithEvents(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	assert.NoError(err)
@@ -130,6 +144,7 @@ func TestNewSmartContractGatewayWithEventsFail(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	assert.Regexp("Event-stream subscription manager", err.Error())
@@ -154,6 +169,7 @@ func TestPreDeployCompileAndPostDeploy(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 
@@ -321,6 +337,7 @@ func TestRegisterExistingContract(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 
@@ -380,6 +397,7 @@ func TestRemoteRegistrySwaggerOrABI(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	iMsg := newTestDeployMsg(t, "0123456789abcdef0123456789abcdef01234567")
@@ -527,6 +545,7 @@ func TestRemoteRegistryBadABI(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	iMsg := newTestDeployMsg(t, "0123456789abcdef0123456789abcdef01234567")
@@ -575,6 +594,7 @@ func TestRegisterContractBadAddress(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	router := &httprouter.Router{}
@@ -603,6 +623,7 @@ func TestRegisterContractNoRegisteredName(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	router := &httprouter.Router{}
@@ -648,6 +669,7 @@ func TestRegisterContractBadABI(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	router := &httprouter.Router{}
@@ -671,6 +693,7 @@ func TestPreDeployCompileFailure(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -692,6 +715,7 @@ func TestPreDeployMsgWrite(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -699,7 +723,7 @@ func TestPreDeployMsgWrite(t *testing.T) {
 		Solidity: simpleEventsSource(),
 	}
 
-	err := scgw.writeAbiInfo("request1", msg)
+	err := scgw.cs.StoreABI("request1", msg)
 	assert.Regexp("Failed to write deployment details", err.Error())
 }
 
@@ -715,6 +739,7 @@ func TestPostDeployNoRegisteredName(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	contractAddr := ethbind.API.HexToAddress("0x0123456789AbcdeF0123456789abCdef01234567")
@@ -756,6 +781,7 @@ func TestPostDeployRemoteRegisteredName(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	mcs := &contractregistrymocks.ContractStore{}
@@ -805,6 +831,7 @@ func TestPostDeployRemoteRegisteredNameNotSuccess(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	mcs := &contractregistrymocks.ContractStore{}
@@ -851,6 +878,7 @@ func TestPostDeployMissingContractAddress(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -879,6 +907,7 @@ func TestGetContractOrABIFail(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	mcs := &contractregistrymocks.ContractStore{}
@@ -907,6 +936,130 @@ func TestGetContractOrABIFail(t *testing.T) {
 	mcs.AssertExpectations(t)
 }
 
+func TestListContractsOrABIsFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw := s.(*smartContractGW)
+	scgw.cs = mcs
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	mcs.On("ListContracts", mock.Anything).Return(nil, 0, fmt.Errorf("pop")).Once()
+	req := httptest.NewRequest("GET", "/contracts", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Result().StatusCode)
+
+	mcs.On("ListABIs", mock.Anything).Return(nil, 0, fmt.Errorf("pop")).Once()
+	req = httptest.NewRequest("GET", "/abis", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Result().StatusCode)
+
+	mcs.AssertExpectations(t)
+}
+
+func TestListContractsOrABIsFilterSortAndPage(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"charlie", "alpha", "bravo"} {
+		_, err := scgw.cs.AddABI(fmt.Sprintf("abi%d", i), &messages.DeployContract{ContractName: name}, created.Add(time.Duration(i)*time.Hour))
+		assert.NoError(err)
+	}
+	_, err := scgw.cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi0", "/contracts/c1", "c1", nil)
+	assert.NoError(err)
+	_, err = scgw.cs.AddContract("123456789abcdef0123456789abcdef012345678", "abi1", "/contracts/c2", "c2", nil)
+	assert.NoError(err)
+
+	list := func(path string) (int, []string, string) {
+		req := httptest.NewRequest("GET", path, bytes.NewReader([]byte{}))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var entries []map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&entries)
+		var ids []string
+		for _, e := range entries {
+			if id, ok := e["id"]; ok {
+				ids = append(ids, id.(string))
+			} else {
+				ids = append(ids, e["address"].(string))
+			}
+		}
+		return res.Code, ids, res.Header().Get("X-Total-Count")
+	}
+
+	status, ids, total := list("/abis")
+	assert.Equal(200, status)
+	assert.Equal([]string{"abi2", "abi1", "abi0"}, ids)
+	assert.Equal("3", total)
+
+	_, ids, total = list("/abis?sort=name&limit=2")
+	assert.Equal([]string{"abi1", "abi2"}, ids)
+	assert.Equal("3", total)
+
+	_, ids, _ = list("/abis?sort=name&skip=1")
+	assert.Equal([]string{"abi2", "abi0"}, ids)
+
+	_, ids, _ = list("/abis?sort=-name&after=abi0")
+	assert.Equal([]string{"abi2", "abi1"}, ids)
+
+	_, ids, total = list("/abis?deployedAfter=2021-01-01T00:30:00Z&sort=created")
+	assert.Equal([]string{"abi1", "abi2"}, ids)
+	assert.Equal("2", total)
+
+	_, ids, total = list("/abis?name=bravo")
+	assert.Equal([]string{"abi2"}, ids)
+	assert.Equal("1", total)
+
+	_, ids, total = list("/contracts?abi=abi1")
+	assert.Equal([]string{"123456789abcdef0123456789abcdef012345678"}, ids)
+	assert.Equal("1", total)
+
+	_, ids, _ = list("/contracts?sort=id&after=0x0123456789abcdef0123456789abcdef01234567")
+	assert.Equal([]string{"123456789abcdef0123456789abcdef012345678"}, ids)
+
+	_, ids, _ = list("/contracts?name=c1")
+	assert.Equal([]string{"0123456789abcdef0123456789abcdef01234567"}, ids)
+
+	for _, path := range []string{
+		"/abis?sort=unknown",
+		"/abis?limit=-1",
+		"/abis?skip=abc",
+		"/abis?deployedAfter=yesterday",
+		"/abis?after=unknown",
+		"/contracts?after=unknown",
+	} {
+		status, _, _ = list(path)
+		assert.Equal(400, status, path)
+	}
+}
+
 func TestGetContractUI(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -919,6 +1072,7 @@ func TestGetContractUI(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	mcs := &contractregistrymocks.ContractStore{}
@@ -959,6 +1113,7 @@ func TestAddABISingleSolidity(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -996,6 +1151,7 @@ func TestAddABISingleSolidityBadContractName(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1028,6 +1184,7 @@ func TestAddABIZipNested(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1069,6 +1226,7 @@ func TestAddABIZipNestedListSolidity(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1111,6 +1269,7 @@ func TestAddABIZipNestedListContracts(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1153,6 +1312,7 @@ func TestAddABIBadZip(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1191,6 +1351,7 @@ func TestAddABIZipNestedNoSource(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1232,6 +1393,7 @@ func TestAddABIZiNotMultipart(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
@@ -1263,11 +1425,12 @@ func TestCompileMultipartFormSolidityBadDir(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 
-	_, err := scgw.compileMultipartFormSolidity(path.Join(dir, "baddir"), nil)
+	_, err := scgw.compileMultipartFormSolidity(path.Join(dir, "baddir"), url.Values{}, nil)
 	assert.Regexp("Failed to read extracted multi-part form data", err)
 }
 
@@ -1284,14 +1447,14 @@ func TestCompileMultipartFormSolidityBadSolc(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 	os.Setenv("FLY_SOLC_0_99", "badness")
 
 	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte(simpleEventsSource()), 0644)
-	req := httptest.NewRequest("POST", "/abis?compiler=0.99", bytes.NewReader([]byte{}))
-	_, err := scgw.compileMultipartFormSolidity(dir, req)
+	_, err := scgw.compileMultipartFormSolidity(dir, url.Values{"compiler": []string{"0.99"}}, nil)
 	assert.Regexp("Failed checking solc version", err.Error())
 	os.Unsetenv("FLY_SOLC_0_99")
 }
@@ -1309,16 +1472,58 @@ func TestCompileMultipartFormSolidityBadCompilerVerReq(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 
 	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte(simpleEventsSource()), 0644)
-	req := httptest.NewRequest("POST", "/abis?compiler=0.99", bytes.NewReader([]byte{}))
-	_, err := scgw.compileMultipartFormSolidity(dir, req)
+	_, err := scgw.compileMultipartFormSolidity(dir, url.Values{"compiler": []string{"0.99"}}, nil)
 	assert.Regexp("Failed checking solc version.*Could not find a configured compiler for requested Solidity major version 0.99", err)
 }
 
+func TestCompileMultipartFormStandardJSONMissing(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+
+	_, err := scgw.compileMultipartFormSolidity(dir, url.Values{"standardjson": []string{"../input.json"}}, nil)
+	assert.Regexp("Standard-JSON input file '../input.json' was not uploaded", err)
+}
+
+func TestCompileMultipartFormStandardJSONBadCompilerVerReq(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+
+	ioutil.WriteFile(path.Join(dir, "input.json"), []byte(`{"language":"Solidity","sources":{"a.sol":{"content":""}}}`), 0644)
+	_, err := scgw.compileMultipartFormSolidity(dir, url.Values{
+		"standardjson": []string{"input.json"},
+		"compiler":     []string{"0.99"},
+	}, nil)
+	assert.Regexp("Failed checking solc version", err)
+}
+
 func TestCompileMultipartFormSolidityBadSolidity(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	assert := assert.New(t)
@@ -1332,16 +1537,191 @@ func TestCompileMultipartFormSolidityBadSolidity(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 
 	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte("this is not the solidity you are looking for"), 0644)
-	req := httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte{}))
-	_, err := scgw.compileMultipartFormSolidity(dir, req)
+	_, err := scgw.compileMultipartFormSolidity(dir, url.Values{}, nil)
 	assert.Regexp("Failed to compile", err.Error())
 }
 
+func TestAddABICompileTimeout(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	// A solc that reports its version, then hangs compiling
+	solcPath := path.Join(dir, "solc")
+	ioutil.WriteFile(solcPath, []byte("#!/bin/sh\n[ \"$1\" = \"--version\" ] && echo 'Version: 0.5.2+commit.1df8f40c' && exit 0\nexec sleep 10\n"), 0755)
+	os.Setenv("FLY_SOLC_0_5", solcPath)
+	defer os.Unsetenv("FLY_SOLC_0_5")
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{TimeoutSec: 1},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormFile("files", "solidity.sol")
+	io.Copy(fw, bytes.NewReader([]byte(simpleEventsSource())))
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis?compiler=0.5", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(408, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Regexp("Solidity compilation exceeded the maximum time of 1s", resBody["error"])
+}
+
+func TestAddABICompilerSettings(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	// A solc that records its arguments, and returns canned combined JSON with an extra output
+	argsFile := path.Join(dir, "args")
+	outputFile := path.Join(dir, "combined.json")
+	ioutil.WriteFile(outputFile, []byte(`{"contracts":{"SimpleEvents.sol:SimpleEvents":{
+		"abi":"[]","bin":"6080","bin-runtime":"6080","srcmap":"","srcmap-runtime":"",
+		"userdoc":"{}","devdoc":"{}","metadata":"{}","storage-layout":{"storage":[]}
+	}},"version":"0.5.2+commit.1df8f40c"}`), 0644)
+	solcPath := path.Join(dir, "solc")
+	ioutil.WriteFile(solcPath, []byte("#!/bin/sh\n[ \"$1\" = \"--version\" ] && echo 'Version: 0.5.2+commit.1df8f40c' && exit 0\necho \"$@\" > "+argsFile+"\ncat "+outputFile+"\n"), 0755)
+	os.Setenv("FLY_SOLC_0_5", solcPath)
+	defer os.Unsetenv("FLY_SOLC_0_5")
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormFile("files", "SimpleEvents.sol")
+	io.Copy(fw, bytes.NewReader([]byte(simpleEventsSource())))
+	fw, _ = writer.CreateFormFile("files", "remappings.txt")
+	fw.Write([]byte("@openzeppelin/=lib/openzeppelin/\n\n"))
+	writer.WriteField("optimize-runs", "1000")
+	writer.WriteField("outputs", "abi,storage-layout")
+	writer.WriteField("remappings", "ds-test/=lib/ds-test/src/")
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis?compiler=0.5&evmVersion=london", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	info := &contractregistry.ABIInfo{}
+	json.NewDecoder(res.Body).Decode(info)
+	assert.Equal(&messages.CompilerSettings{
+		EVMVersion:   "london",
+		Optimize:     true,
+		OptimizeRuns: 1000,
+		Outputs:      []string{"storage-layout"},
+		Remappings:   []string{"@openzeppelin/=lib/openzeppelin/", "ds-test/=lib/ds-test/src/"},
+	}, info.CompilerSettings)
+	args, _ := ioutil.ReadFile(argsFile)
+	assert.Regexp("--combined-json bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata,storage-layout --optimize --optimize-runs 1000 --evm-version london", string(args))
+	assert.Regexp("--allow-paths . @openzeppelin/=lib/openzeppelin/ ds-test/=lib/ds-test/src/ SimpleEvents.sol", string(args))
+
+	req = httptest.NewRequest("GET", "/abis/"+info.ID+"?outputs", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var outputs map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&outputs)
+	assert.Equal(map[string]interface{}{"storage-layout": map[string]interface{}{"storage": []interface{}{}}}, outputs)
+
+	// Invalid settings are rejected before compiling
+	body = &bytes.Buffer{}
+	writer = multipart.NewWriter(body)
+	fw, _ = writer.CreateFormFile("files", "SimpleEvents.sol")
+	io.Copy(fw, bytes.NewReader([]byte(simpleEventsSource())))
+	writer.Close()
+	req = httptest.NewRequest("POST", "/abis?compiler=0.5&optimize=maybe", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Regexp("Invalid compiler setting 'optimize': maybe", resBody["error"])
+}
+
+func TestParseCompilerSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	settings, err := parseCompilerSettings(url.Values{})
+	assert.NoError(err)
+	assert.Equal(&messages.CompilerSettings{EVMVersion: "byzantium", Optimize: true}, settings)
+
+	settings, err = parseCompilerSettings(url.Values{
+		"evm":      []string{"istanbul"},
+		"optimize": []string{"false"},
+		"outputs":  []string{"hashes, metadata", "storage-layout"},
+	})
+	assert.NoError(err)
+	assert.Equal(&messages.CompilerSettings{EVMVersion: "istanbul", Outputs: []string{"hashes", "storage-layout"}}, settings)
+
+	_, err = parseCompilerSettings(url.Values{"evmVersion": []string{"london --bad"}})
+	assert.Regexp("Invalid compiler setting 'evmVersion'", err)
+	_, err = parseCompilerSettings(url.Values{"optimize-runs": []string{"0"}})
+	assert.Regexp("Invalid compiler setting 'optimize-runs': 0", err)
+	_, err = parseCompilerSettings(url.Values{"optimize": []string{"false"}, "optimize-runs": []string{"200"}})
+	assert.Regexp("Invalid compiler setting 'optimize-runs': the optimizer is disabled", err)
+	_, err = parseCompilerSettings(url.Values{"outputs": []string{"abi,ast;rm"}})
+	assert.Regexp("Invalid compiler setting 'outputs': ast;rm", err)
+}
+
+func TestReadRemappings(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	remappings, err := readRemappings(dir, url.Values{})
+	assert.NoError(err)
+	assert.Nil(remappings)
+
+	ioutil.WriteFile(path.Join(dir, "remappings.txt"), []byte("@openzeppelin/=lib/openzeppelin-contracts/\r\nforge-std/=lib/forge-std/src/\n"), 0644)
+	remappings, err = readRemappings(dir, url.Values{"remappings": []string{"a.sol:x/=lib/x/\ny/=./lib/y/"}})
+	assert.NoError(err)
+	assert.Equal([]string{"@openzeppelin/=lib/openzeppelin-contracts/", "forge-std/=lib/forge-std/src/", "a.sol:x/=lib/x/", "y/=./lib/y/"}, remappings)
+
+	for _, bad := range []string{"noequals", "=lib/x/", "x/=", "x/=/etc/", "x/=../outside/", "x/=lib/../..", "--output-dir=out", "x/ =lib/x/"} {
+		_, err = readRemappings(dir, url.Values{"remappings": []string{bad}})
+		assert.Regexp("Invalid import remapping", err, bad)
+	}
+}
+
+func TestSelectedSolcOutputsBadJSON(t *testing.T) {
+	assert := assert.New(t)
+	_, err := selectedSolcOutputs([]byte("!json"), []string{"hashes"})
+	assert.Error(err)
+
+	c := &solcCompilation{outputs: map[string]map[string]json.RawMessage{
+		"a.sol:A": {"hashes": json.RawMessage(`{}`)},
+		"a.sol:B": {},
+	}}
+	assert.Nil(c.outputsFor(""))
+	assert.Equal(map[string]json.RawMessage{"hashes": json.RawMessage(`{}`)}, c.outputsFor("a.sol:A"))
+}
+
 func TestExtractMultiPartFileBadFile(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	assert := assert.New(t)
@@ -1355,13 +1735,12 @@ func TestExtractMultiPartFileBadFile(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 
-	err := scgw.extractMultiPartFile(dir, &multipart.FileHeader{
-		Filename: "/stuff.zip",
-	})
+	_, err := scgw.extractMultiPartFile(dir, "/stuff.zip", bytes.NewReader([]byte{}), 1024)
 	assert.Regexp("Filenames cannot contain slashes. Use a zip file to upload a directory structure", err)
 }
 
@@ -1378,18 +1757,16 @@ func TestExtractMultiPartFileBadInput(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: true,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 
-	err := scgw.extractMultiPartFile(dir, &multipart.FileHeader{
-		Filename: "stuff.zip",
-	})
+	_, err := scgw.extractMultiPartFile(dir, "stuff.zip", iotest.ErrReader(fmt.Errorf("pop")), 1024)
 	assert.Regexp("Failed to read archive", err)
 }
 
-func TestStoreDeployableABIMissingABI(t *testing.T) {
-	log.SetLevel(log.DebugLevel)
+func TestExtractMultiPartFileBadDir(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
 	defer cleanup(dir)
@@ -1398,84 +1775,271 @@ func TestStoreDeployableABIMissingABI(t *testing.T) {
 		&SmartContractGatewayConf{
 			StoragePath: dir,
 		},
-		&tx.TxnProcessorConf{
-			OrionPrivateAPIS: true,
-		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	scgw := s.(*smartContractGW)
 
-	_, err := scgw.storeDeployableABI(&messages.DeployContract{}, nil)
-	assert.Regexp("Must supply ABI to install an existing ABI into the REST Gateway", err)
+	_, err := scgw.extractMultiPartFile(path.Join(dir, "badpath"), "stuff.zip", bytes.NewReader([]byte{}), 1024)
+	assert.Regexp("Failed to process archive", err)
 }
 
-func testGWPath(method, path string, results interface{}, sm *mockSubMgr) (res *httptest.ResponseRecorder) {
-	return testGWPathBody(method, path, results, sm, nil)
-}
+func TestAddABIUploadTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
 
-func testGWPathBody(method, path string, results interface{}, sm *mockSubMgr, body io.Reader) (res *httptest.ResponseRecorder) {
-	req := httptest.NewRequest(method, path, body)
-	res = httptest.NewRecorder()
-	s := &smartContractGW{}
-	if sm != nil {
-		s.sm = sm
-	}
-	r := &httprouter.Router{}
-	s.AddRoutes(r)
-	r.ServeHTTP(res, req)
-	json.NewDecoder(res.Body).Decode(&results)
-	return
-}
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath:     dir,
+			MaxUploadSizeMB: 1,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
 
-func TestAddStreamNoSubMgr(t *testing.T) {
-	assert := assert.New(t)
-	res := testGWPath("POST", events.StreamPathPrefix, nil, nil)
-	assert.Equal(405, res.Result().StatusCode)
-}
+	// Each file is under the limit, but the total is not
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, fileName := range []string{"file1.sol", "file2.sol"} {
+		part, _ := writer.CreateFormFile("files", fileName)
+		part.Write(make([]byte, 600*1024))
+	}
+	writer.Close()
 
-func TestAddStreamOK(t *testing.T) {
-	assert := assert.New(t)
-	spec := &events.StreamInfo{Type: "webhook", Name: "stream-1", Timestamps: true}
-	b, _ := json.Marshal(spec)
-	req := httptest.NewRequest("POST", events.StreamPathPrefix, bytes.NewReader(b))
+	req := httptest.NewRequest("POST", "/abis", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.ContentLength = -1 // unknown, so only detected while streaming
 	res := httptest.NewRecorder()
-	s := &smartContractGW{}
-	s.sm = &mockSubMgr{}
-	r := &httprouter.Router{}
-	s.AddRoutes(r)
-	r.ServeHTTP(res, req)
-	var newSpec events.StreamInfo
-	json.NewDecoder(res.Body).Decode(&newSpec)
-	assert.Equal(200, res.Result().StatusCode)
-	assert.Equal("webhook", newSpec.Type)
-	assert.Equal("stream-1", newSpec.Name)
-	assert.Equal(true, newSpec.Timestamps)
-	s.Shutdown()
-}
+	router.ServeHTTP(res, req)
+	assert.Equal(413, res.Result().StatusCode)
+	errInfo := &errors.RESTError{}
+	json.NewDecoder(res.Body).Decode(errInfo)
+	assert.Regexp("Uploaded files exceed the maximum total size of 1MB", errInfo.Message)
 
-func TestAddStreamDefaultNoTimestamps(t *testing.T) {
-	assert := assert.New(t)
-	spec := &events.StreamInfo{Type: "webhook", Name: "stream-no-timestamps"}
-	b, _ := json.Marshal(spec)
-	req := httptest.NewRequest("POST", events.StreamPathPrefix, bytes.NewReader(b))
-	res := httptest.NewRecorder()
-	s := &smartContractGW{}
-	s.sm = &mockSubMgr{}
-	r := &httprouter.Router{}
-	s.AddRoutes(r)
-	r.ServeHTTP(res, req)
-	var newSpec events.StreamInfo
-	json.NewDecoder(res.Body).Decode(&newSpec)
-	assert.Equal(200, res.Result().StatusCode)
-	assert.Equal("webhook", newSpec.Type)
-	assert.Equal("stream-no-timestamps", newSpec.Name)
-	assert.Equal(false, newSpec.Timestamps)
-	s.Shutdown()
+	// Rejected on the content length, before reading the body
+	req = httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte{}))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.ContentLength = 1<<20 + maxFormParsingMemory + 1
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(413, res.Result().StatusCode)
 }
 
-func TestAddStreamBadData(t *testing.T) {
+func TestAddABIUploadArchiveUnpacksTooLarge(t *testing.T) {
 	assert := assert.New(t)
-	req := httptest.NewRequest("POST", events.StreamPathPrefix, bytes.NewReader([]byte(":bad json")))
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath:     dir,
+			MaxUploadSizeMB: 1,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	// The archive is a few KB, but unpacks to more than the limit
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("files", "solfiles.zip")
+	zipWriter := zip.NewWriter(part)
+	solWriter, _ := zipWriter.Create("solfiles/Big.sol")
+	solWriter.Write(make([]byte, 2<<20))
+	zipWriter.Close()
+	writer.Close()
+	assert.Less(body.Len(), 1<<20)
+
+	req := httptest.NewRequest("POST", "/abis", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(413, res.Result().StatusCode)
+	errInfo := &errors.RESTError{}
+	json.NewDecoder(res.Body).Decode(errInfo)
+	assert.Regexp("Uploaded files exceed the maximum total size of 1MB", errInfo.Message)
+	_, err := os.Stat(path.Join(dir, "solfiles"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestArchiveSizeTooManyFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	fileName := path.Join(dir, "many.zip")
+	f, _ := os.Create(fileName)
+	zipWriter := zip.NewWriter(f)
+	for i := 0; i <= maxArchiveEntries; i++ {
+		zipWriter.Create(fmt.Sprintf("file%d.sol", i))
+	}
+	zipWriter.Close()
+	f.Close()
+
+	z, err := archiver.ByExtension(fileName)
+	assert.NoError(err)
+	_, err = archiveSize(z, fileName, 1<<20)
+	assert.Regexp("Uploaded archive contains more than 10000 files", err)
+
+	_, err = archiveSize(struct{}{}, fileName, 1<<20)
+	assert.Regexp("archive format cannot be read", err)
+}
+
+func TestAddABIFormValueTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("abi", strings.Repeat("x", int(maxFormParsingMemory)+1))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/abis", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Result().StatusCode)
+	errInfo := &errors.RESTError{}
+	json.NewDecoder(res.Body).Decode(errInfo)
+	assert.Regexp("Could not parse supplied multi-part form data: multipart: message too large", errInfo.Message)
+}
+
+func TestAddABIBadMultipartBody(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	req := httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte("not multipart")))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Result().StatusCode)
+}
+
+func TestStoreDeployableABIMissingABI(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{
+			OrionPrivateAPIS: true,
+		},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+
+	_, err := scgw.storeDeployableABI(&messages.DeployContract{}, nil)
+	assert.Regexp("Must supply ABI to install an existing ABI into the REST Gateway", err)
+}
+
+func testGWPath(method, path string, results interface{}, sm *mockSubMgr) (res *httptest.ResponseRecorder) {
+	return testGWPathBody(method, path, results, sm, nil)
+}
+
+func testGWPathBody(method, path string, results interface{}, sm *mockSubMgr, body io.Reader) (res *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, path, body)
+	res = httptest.NewRecorder()
+	s := &smartContractGW{}
+	if sm != nil {
+		s.sm = sm
+	}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(&results)
+	return
+}
+
+func TestAddStreamNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
+	res := testGWPath("POST", events.StreamPathPrefix, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestAddStreamOK(t *testing.T) {
+	assert := assert.New(t)
+	spec := &events.StreamInfo{Type: "webhook", Name: "stream-1", Timestamps: true}
+	b, _ := json.Marshal(spec)
+	req := httptest.NewRequest("POST", events.StreamPathPrefix, bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var newSpec events.StreamInfo
+	json.NewDecoder(res.Body).Decode(&newSpec)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("webhook", newSpec.Type)
+	assert.Equal("stream-1", newSpec.Name)
+	assert.Equal(true, newSpec.Timestamps)
+	s.Shutdown()
+}
+
+func TestAddStreamDefaultNoTimestamps(t *testing.T) {
+	assert := assert.New(t)
+	spec := &events.StreamInfo{Type: "webhook", Name: "stream-no-timestamps"}
+	b, _ := json.Marshal(spec)
+	req := httptest.NewRequest("POST", events.StreamPathPrefix, bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var newSpec events.StreamInfo
+	json.NewDecoder(res.Body).Decode(&newSpec)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("webhook", newSpec.Type)
+	assert.Equal("stream-no-timestamps", newSpec.Name)
+	assert.Equal(false, newSpec.Timestamps)
+	s.Shutdown()
+}
+
+func TestAddStreamBadData(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("POST", events.StreamPathPrefix, bytes.NewReader([]byte(":bad json")))
 	res := httptest.NewRecorder()
 	s := &smartContractGW{}
 	s.sm = &mockSubMgr{}
@@ -1586,6 +2150,80 @@ func TestUpdateStreamSubMgrError(t *testing.T) {
 	assert.Regexp("pop", resError.Message)
 }
 
+func TestUpdateSubNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
+	res := testGWPath("PATCH", events.SubPathPrefix+"/123", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestUpdateSubOK(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := json.Marshal(&events.SubscriptionUpdateDTO{Name: "sub2", Stream: "stream2"})
+	req := httptest.NewRequest("PATCH", events.SubPathPrefix+"/123", bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "123", Name: "sub2", Stream: "stream2"},
+	}
+	s.sm = sm
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var sub events.SubscriptionInfo
+	json.NewDecoder(res.Body).Decode(&sub)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("sub2", sub.Name)
+	assert.Equal("stream2", sm.captureUpdate.Stream)
+	assert.Nil(sm.captureUpdate.Filter)
+}
+
+func TestUpdateSubBadData(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("PATCH", events.SubPathPrefix+"/123", bytes.NewReader([]byte(":bad json")))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var resError errors.RESTError
+	json.NewDecoder(res.Body).Decode(&resError)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Unable to parse as YAML or JSON", resError.Message)
+}
+
+func TestUpdateSubNotFoundError(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("PATCH", events.SubPathPrefix+"/123", bytes.NewReader([]byte("{}")))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{err: fmt.Errorf("pop")}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var resError errors.RESTError
+	json.NewDecoder(res.Body).Decode(&resError)
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Regexp("pop", resError.Message)
+}
+
+func TestUpdateSubSubMgrError(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("PATCH", events.SubPathPrefix+"/123", bytes.NewReader([]byte(`{"filter":{}}`)))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	sm := &mockSubMgr{updateSubErr: fmt.Errorf("pop")}
+	s.sm = sm
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var resError errors.RESTError
+	json.NewDecoder(res.Body).Decode(&resError)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Regexp("pop", resError.Message)
+	assert.NotNil(sm.captureUpdate.Filter)
+}
+
 func TestListStreamsNoSubMgr(t *testing.T) {
 	assert := assert.New(t)
 	res := testGWPath("GET", events.StreamPathPrefix, nil, nil)
@@ -1740,6 +2378,58 @@ func TestAddSubNoSubMgr(t *testing.T) {
 	assert.Equal(405, res.Result().StatusCode)
 }
 
+func TestAddSubBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		batchResults: []*events.SubscriptionBatchResult{
+			{Index: 0, Status: events.SubscriptionBatchCreated, Subscription: &events.SubscriptionInfo{Name: "sub1"}},
+			{Index: 1, Status: events.SubscriptionBatchCreated, Subscription: &events.SubscriptionInfo{Name: "sub2"}},
+		},
+	}
+	var resBody []*events.SubscriptionBatchResult
+	res := testGWPathBody("POST", events.SubPathPrefix+"/batch", &resBody, mockSubMgr, bytes.NewReader([]byte(`[
+      {"name": "sub1", "event": {"name": "Event1"}, "stream": "stream1"},
+      {"name": "sub2", "event": {"name": "Event2"}, "stream": "stream1", "fromBlock": "0"}
+    ]`)))
+	assert.Equal(201, res.Result().StatusCode)
+	assert.Len(resBody, 2)
+	assert.Equal("sub2", resBody[1].Subscription.Name)
+	assert.Len(mockSubMgr.captureSubs, 2)
+	assert.Equal("Event2", mockSubMgr.captureSubs[1].Event.Name)
+	assert.Equal("0", mockSubMgr.captureSubs[1].FromBlock)
+}
+
+func TestAddSubBatchInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		err: errors.Errorf(errors.EventStreamsSubscribeBatchInvalid, 1, 2),
+		batchResults: []*events.SubscriptionBatchResult{
+			{Index: 0, Status: events.SubscriptionBatchNotCreated},
+			{Index: 1, Status: events.SubscriptionBatchFailed, Error: "bad event"},
+		},
+	}
+	var resBody map[string]interface{}
+	res := testGWPathBody("POST", events.SubPathPrefix+"/batch", &resBody, mockSubMgr, bytes.NewReader([]byte(`[{}, {}]`)))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("1 of the 2 subscriptions in the batch are invalid", resBody["error"])
+	assert.Equal("bad event", resBody["results"].([]interface{})[1].(map[string]interface{})["error"])
+
+	mockSubMgr.err = fmt.Errorf("pop")
+	res = testGWPathBody("POST", events.SubPathPrefix+"/batch", &resBody, mockSubMgr, bytes.NewReader([]byte(`[{}]`)))
+	assert.Equal(500, res.Result().StatusCode)
+
+	res = testGWPathBody("POST", events.SubPathPrefix+"/batch", &resBody, mockSubMgr, bytes.NewReader([]byte(`{}`)))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Unable to parse as YAML or JSON", resBody["error"])
+
+	res = testGWPath("POST", events.SubPathPrefix+"/123", nil, mockSubMgr)
+	assert.Equal(405, res.Result().StatusCode)
+	res = testGWPath("POST", events.SubPathPrefix+"/batch", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
 func TestResetSub(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1832,18 +2522,219 @@ func TestSuspendNoSubMgr(t *testing.T) {
 	assert.Equal(405, res.Result().StatusCode)
 }
 
-func TestWithEventsAuthRequiresAuth(t *testing.T) {
+func TestSuspendAndResumeAllStreams(t *testing.T) {
 	assert := assert.New(t)
 
-	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPath("POST", events.StreamPathPrefix+"/suspendall", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.True(mockSubMgr.suspendedAll)
+	res = testGWPath("POST", events.StreamPathPrefix+"/resumeall", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.True(mockSubMgr.resumedAll)
 
-	scgw, _ := NewSmartContractGateway(
-		&SmartContractGatewayConf{
-			BaseURL: "http://localhost/api/v1",
-		},
-		&tx.TxnProcessorConf{
-			OrionPrivateAPIS: false,
+	res = testGWPath("POST", events.StreamPathPrefix+"/other", nil, mockSubMgr)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestSuspendAllStreamsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{err: fmt.Errorf("pop")}
+	var errInfo = errors.RESTError{}
+	res := testGWPath("POST", events.StreamPathPrefix+"/suspendall", &errInfo, mockSubMgr)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+
+	res = testGWPath("POST", events.StreamPathPrefix+"/resumeall", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestExportCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{checkpoint: &events.SubscriptionCheckpoint{SubscriptionID: "sub1", BlockNumber: big.NewInt(12345)}}
+	var cp events.SubscriptionCheckpoint
+	res := testGWPath("GET", events.SubPathPrefix+"/sub1/checkpoint", &cp, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("sub1", cp.SubscriptionID)
+	assert.Equal(int64(12345), cp.BlockNumber.Int64())
+
+	mockSubMgr.err = fmt.Errorf("not found")
+	res = testGWPath("GET", events.SubPathPrefix+"/sub1/checkpoint", nil, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+
+	res = testGWPath("GET", events.SubPathPrefix+"/sub1/checkpoint", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestImportCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPathBody("PUT", events.SubPathPrefix+"/sub2/checkpoint", nil, mockSubMgr, bytes.NewReader([]byte(`{"subscriptionId":"sub1","blockNumber":12345}`)))
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal(int64(12345), mockSubMgr.checkpoint.BlockNumber.Int64())
+
+	var errInfo = errors.RESTError{}
+	res = testGWPathBody("PUT", events.SubPathPrefix+"/sub2/checkpoint", &errInfo, mockSubMgr, bytes.NewReader([]byte(`!json`)))
+	assert.Equal(400, res.Result().StatusCode)
+
+	mockSubMgr.err = fmt.Errorf("pop")
+	res = testGWPathBody("PUT", events.SubPathPrefix+"/sub2/checkpoint", &errInfo, mockSubMgr, bytes.NewReader([]byte(`{"blockNumber":1}`)))
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+
+	res = testGWPathBody("PUT", events.SubPathPrefix+"/sub2/checkpoint", nil, nil, bytes.NewReader([]byte(`{}`)))
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestExportEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{backup: &events.EventsBackup{Streams: []*events.StreamInfo{{ID: "es-1"}}}}
+	var backup events.EventsBackup
+	res := testGWPath("GET", events.StreamPathPrefix+"/export", &backup, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("es-1", backup.Streams[0].ID)
+
+	mockSubMgr.err = fmt.Errorf("pop")
+	var errInfo = errors.RESTError{}
+	res = testGWPath("GET", events.StreamPathPrefix+"/export", &errInfo, mockSubMgr)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+}
+
+func TestGetHeartbeat(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{heartbeat: &events.Heartbeat{ChainHead: big.NewInt(1000), Streams: []*events.HeartbeatStream{{ID: "es-1"}}}}
+	var heartbeat events.Heartbeat
+	res := testGWPath("GET", events.StreamPathPrefix+"/heartbeat", &heartbeat, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(int64(1000), heartbeat.ChainHead.Int64())
+	assert.Equal("es-1", heartbeat.Streams[0].ID)
+
+	mockSubMgr.err = fmt.Errorf("pop")
+	var errInfo = errors.RESTError{}
+	res = testGWPath("GET", events.StreamPathPrefix+"/heartbeat", &errInfo, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+}
+
+func TestImportEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{importResult: &events.EventsImportResult{Streams: 1}}
+	var result events.EventsImportResult
+	res := testGWPathBody("POST", events.StreamPathPrefix+"/import", &result, mockSubMgr, bytes.NewReader([]byte(`{"streams":[{"id":"es-1"}]}`)))
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(1, result.Streams)
+	assert.Equal("es-1", mockSubMgr.backup.Streams[0].ID)
+
+	var errInfo = errors.RESTError{}
+	res = testGWPathBody("POST", events.StreamPathPrefix+"/import", &errInfo, mockSubMgr, bytes.NewReader([]byte(`!json`)))
+	assert.Equal(400, res.Result().StatusCode)
+
+	mockSubMgr.err = fmt.Errorf("pop")
+	res = testGWPathBody("POST", events.StreamPathPrefix+"/import", &errInfo, mockSubMgr, bytes.NewReader([]byte(`{}`)))
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+
+	mockSubMgr.err = errors.Errorf(errors.EventStreamsBackupRedactedSecret, "es-1", "webhook.hmacSecret")
+	res = testGWPathBody("POST", events.StreamPathPrefix+"/import", &errInfo, mockSubMgr, bytes.NewReader([]byte(`{}`)))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("es-1.*webhook.hmacSecret", errInfo.Message)
+
+	res = testGWPathBody("POST", events.StreamPathPrefix+"/import", nil, nil, bytes.NewReader([]byte(`{}`)))
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestGetStreamMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{metrics: &events.StreamMetrics{ID: "123", BatchesDelivered: 5, EventsDelivered: 12, Retries: 2}}
+	var metrics events.StreamMetrics
+	res := testGWPath("GET", events.StreamPathPrefix+"/123/metrics", &metrics, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("123", metrics.ID)
+	assert.Equal(uint64(5), metrics.BatchesDelivered)
+	assert.Equal(uint64(12), metrics.EventsDelivered)
+	assert.Equal(uint64(2), metrics.Retries)
+}
+
+func TestGetStreamMetricsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{err: fmt.Errorf("pop")}
+	var errInfo = errors.RESTError{}
+	res := testGWPath("GET", events.StreamPathPrefix+"/123/metrics", &errInfo, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+
+	res = testGWPath("GET", events.StreamPathPrefix+"/123/metrics", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestListDeadLetters(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{deadLetters: []*events.DeadLetter{{ID: "dl1", StreamID: "123"}}}
+	var results []*events.DeadLetter
+	res := testGWPath("GET", events.StreamPathPrefix+"/123/deadletters", &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(1, len(results))
+	assert.Equal("dl1", results[0].ID)
+}
+
+func TestListDeadLettersFail(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{err: fmt.Errorf("pop")}
+	var errInfo = errors.RESTError{}
+	res := testGWPath("GET", events.StreamPathPrefix+"/123/deadletters", &errInfo, mockSubMgr)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+
+	res = testGWPath("GET", events.StreamPathPrefix+"/123/deadletters", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestRequeueAndDeleteDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPath("POST", events.StreamPathPrefix+"/123/deadletters/dl1/requeue", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal("dl1", mockSubMgr.requeued)
+
+	res = testGWPath("DELETE", events.StreamPathPrefix+"/123/deadletters/dl2", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal("dl2", mockSubMgr.deletedDL)
+
+	mockSubMgr.err = fmt.Errorf("pop")
+	var errInfo = errors.RESTError{}
+	res = testGWPath("POST", events.StreamPathPrefix+"/123/deadletters/dl1/requeue", &errInfo, mockSubMgr)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("pop", errInfo.Message)
+
+	res = testGWPath("DELETE", events.StreamPathPrefix+"/123/deadletters/dl2", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestWithEventsAuthRequiresAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{
+			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 
@@ -1878,6 +2769,7 @@ func TestSendReplyBroadcast(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, ws,
 	)
 
@@ -1900,6 +2792,7 @@ func TestPublishBadABI(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	router := &httprouter.Router{}
@@ -1935,6 +2828,7 @@ func TestPublishBadBytecode(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	router := &httprouter.Router{}
@@ -1970,6 +2864,7 @@ func TestPublishPreCompiled(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	router := &httprouter.Router{}
@@ -2004,6 +2899,56 @@ func TestPublishPreCompiled(t *testing.T) {
 	assert.NotEmpty(deployStash.Compiled)
 }
 
+func TestPublishEventsOnlyABI(t *testing.T) {
+	// writes real files and tests end to end
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{
+			OrionPrivateAPIS: false,
+		},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormField("abi")
+	io.Copy(fw, bytes.NewReader([]byte(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"}],"name":"Logged","type":"event"}]`)))
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/abis", bytes.NewReader(body.Bytes()))
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var info contractregistry.ABIInfo
+	json.NewDecoder(res.Body).Decode(&info)
+
+	req = httptest.NewRequest("GET", "/abis/"+info.ID+"?swagger", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var swagger spec.Swagger
+	json.NewDecoder(res.Body).Decode(&swagger)
+	assert.NotContains(swagger.Paths.Paths, "/")
+	assert.Contains(swagger.Paths.Paths, "/{address}")
+	assert.Contains(swagger.Paths.Paths, "/{address}/Logged/subscribe")
+
+	req = httptest.NewRequest("POST", "/abis/"+info.ID+"/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+}
+
 func TestResolveAddressFail(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -2017,6 +2962,7 @@ func TestResolveAddressFail(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 
@@ -2040,6 +2986,7 @@ func TestResolveAddressGetContractFail(t *testing.T) {
 		&tx.TxnProcessorConf{
 			OrionPrivateAPIS: false,
 		},
+		&eth.SolcConf{},
 		nil, nil, nil, nil,
 	)
 	mcs := &contractregistrymocks.ContractStore{}
@@ -2055,3 +3002,705 @@ func TestResolveAddressGetContractFail(t *testing.T) {
 	assert.Nil(info)
 	assert.Equal("", name)
 }
+
+func newTestMethodPolicyGateway(t *testing.T, dir string) (*smartContractGW, *contractregistrymocks.ContractStore, *httprouter.Router) {
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	mcs := &contractregistrymocks.ContractStore{}
+	scgw := s.(*smartContractGW)
+	scgw.cs = mcs
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	mcs.On("GetContractByAddress", "0123456789abcdef0123456789abcdef01234567").Return(&contractregistry.ContractInfo{
+		Address: "0123456789abcdef0123456789abcdef01234567",
+		ABI:     "abi1",
+		MethodPolicy: &contractregistry.MethodPolicy{
+			Deny: []string{"mint"},
+		},
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{
+			ContractName: "Token",
+			ABI: ethbinding.ABIMarshaling{
+				{Type: "function", Name: "balanceOf", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address"}}},
+				{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+			},
+		},
+	}, nil)
+	return scgw, mcs, router
+}
+
+func TestSetMethodPolicy(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	policy := &contractregistry.MethodPolicy{Allow: []string{"balanceOf(address)"}, Deny: []string{"mint"}}
+	mcs.On("SetMethodPolicy", "0123456789abcdef0123456789abcdef01234567", policy).
+		Return(&contractregistry.ContractInfo{Address: "0123456789abcdef0123456789abcdef01234567", MethodPolicy: policy}, nil)
+	req := httptest.NewRequest("PUT", "/contracts/0123456789abcdef0123456789abcdef01234567/policy",
+		strings.NewReader(`{"allow":["balanceOf(address)"],"deny":["mint"]}`))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var info contractregistry.ContractInfo
+	json.NewDecoder(res.Body).Decode(&info)
+	assert.Equal(policy, info.MethodPolicy)
+
+	mcs.On("SetMethodPolicy", "0123456789abcdef0123456789abcdef01234567", (*contractregistry.MethodPolicy)(nil)).
+		Return(&contractregistry.ContractInfo{Address: "0123456789abcdef0123456789abcdef01234567"}, nil)
+	req = httptest.NewRequest("DELETE", "/contracts/0123456789abcdef0123456789abcdef01234567/policy", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	mcs.AssertExpectations(t)
+}
+
+func TestSetMethodPolicyErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	sendPolicy := func(addr, body string) (int, string) {
+		req := httptest.NewRequest("PUT", "/contracts/"+addr+"/policy", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var errBody map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&errBody)
+		return res.Code, fmt.Sprintf("%v", errBody["error"])
+	}
+
+	mcs.On("GetContractByAddress", "unknown").Return(nil, fmt.Errorf("pop"))
+	mcs.On("ResolveContractAddress", "unknown").Return("", fmt.Errorf("pop"))
+	status, msg := sendPolicy("unknown", `{}`)
+	assert.Equal(404, status)
+	assert.Regexp("pop", msg)
+
+	status, msg = sendPolicy("0123456789abcdef0123456789abcdef01234567", `!json`)
+	assert.Equal(400, status)
+	assert.Regexp("Invalid method policy", msg)
+
+	status, msg = sendPolicy("0123456789abcdef0123456789abcdef01234567", `{"deny":["mint(address)"]}`)
+	assert.Equal(400, status)
+	assert.Regexp("Method 'mint\\(address\\)' in the method policy is not declared by the contract ABI", msg)
+
+	mcs.On("SetMethodPolicy", "0123456789abcdef0123456789abcdef01234567", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	status, msg = sendPolicy("0123456789abcdef0123456789abcdef01234567", `{"deny":["mint"]}`)
+	assert.Equal(500, status)
+	assert.Regexp("pop", msg)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	status, _ = sendPolicy("0123456789abcdef0123456789abcdef01234567", `{"deny":["mint"]}`)
+	assert.Equal(401, status)
+}
+
+func TestMethodPolicyFiltersSwagger(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, _, router := newTestMethodPolicyGateway(t, dir)
+
+	req := httptest.NewRequest("GET", "/contracts/0123456789abcdef0123456789abcdef01234567?swagger", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	swagger := spec.Swagger{}
+	json.NewDecoder(res.Body).Decode(&swagger)
+	assert.Contains(swagger.Paths.Paths, "/balanceOf")
+	assert.NotContains(swagger.Paths.Paths, "/mint")
+
+	// The ABI itself is returned in full
+	req = httptest.NewRequest("GET", "/contracts/0123456789abcdef0123456789abcdef01234567?abi", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Contains(res.Body.String(), `"mint"`)
+}
+
+func TestGetPendingTransactions(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{
+		pending: &tx.PendingTransactions{
+			Address: "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1",
+			Transactions: []*tx.PendingTransaction{
+				{Nonce: "10", Status: tx.PendingStatusQueued, Node: &eth.TxPoolTransaction{Hash: "0xaaaa"}},
+			},
+		},
+	}
+	s := &smartContractGW{r2e: &rest2eth{processor: processor}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	req := httptest.NewRequest("GET", "/addresses/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/pending", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var pending tx.PendingTransactions
+	err := json.NewDecoder(res.Body).Decode(&pending)
+	assert.NoError(err)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", pending.Address)
+	assert.Equal("0xaaaa", pending.Transactions[0].Node.Hash)
+
+	req = httptest.NewRequest("GET", "/addresses/badness/pending", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+
+	processor.err = fmt.Errorf("pop")
+	req = httptest.NewRequest("GET", "/addresses/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/pending", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+	var errBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&errBody)
+	assert.Equal("pop", errBody["error"])
+}
+
+func TestGetInflightTransactions(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{
+		inflight: []*tx.InflightAddress{
+			{
+				Address:      "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1",
+				HighestNonce: "11",
+				Transactions: []*tx.InflightTransactionStatus{{ID: 1, Nonce: "11", Hash: "0xaaaa", Retries: 2}},
+			},
+		},
+	}
+	s := &smartContractGW{r2e: &rest2eth{processor: processor}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	req := httptest.NewRequest("GET", "/transactions/inflight", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var inflight []*tx.InflightAddress
+	err := json.NewDecoder(res.Body).Decode(&inflight)
+	assert.NoError(err)
+	assert.Equal(1, len(inflight))
+	assert.Equal("0xaaaa", inflight[0].Transactions[0].Hash)
+
+	req = httptest.NewRequest("GET", "/transactions/inflight/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var forAddr tx.InflightAddress
+	err = json.NewDecoder(res.Body).Decode(&forAddr)
+	assert.NoError(err)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", forAddr.Address)
+	assert.Equal(2, forAddr.Transactions[0].Retries)
+
+	processor.err = fmt.Errorf("pop")
+	req = httptest.NewRequest("GET", "/transactions/inflight/badness", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var errBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&errBody)
+	assert.Equal("pop", errBody["error"])
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/transactions/inflight", bytes.NewReader([]byte{})))
+	assert.Equal(401, res.Code)
+}
+
+func TestResetNonce(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{
+		nonceReset: &tx.NonceReset{Address: "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", NextNonce: "15", Released: 2},
+	}
+	s := &smartContractGW{r2e: &rest2eth{processor: processor}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	req := httptest.NewRequest("POST", "/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset", bytes.NewReader([]byte(`{"nonce": 15}`)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var reset tx.NonceReset
+	err := json.NewDecoder(res.Body).Decode(&reset)
+	assert.NoError(err)
+	assert.Equal(2, reset.Released)
+	assert.Equal(int64(15), *processor.resetNonce)
+
+	req = httptest.NewRequest("POST", "/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset?nonce=16", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal(int64(16), *processor.resetNonce)
+
+	req = httptest.NewRequest("POST", "/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Nil(processor.resetNonce)
+}
+
+func TestResetNonceFail(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mockProcessor{}
+	s := &smartContractGW{r2e: &rest2eth{processor: processor}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	for _, test := range []struct {
+		path   string
+		body   string
+		status int
+		err    string
+	}{
+		{"/admin/nonces/badness/reset", "", 400, "Supplied value for 'address' is not a valid hex address"},
+		{"/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset", "!json", 400, "Unable to parse as YAML or JSON"},
+		{"/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset?nonce=abc", "", 400, "Invalid nonce 'abc' to reset to"},
+	} {
+		req := httptest.NewRequest("POST", test.path, bytes.NewReader([]byte(test.body)))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(test.status, res.Code)
+		var errBody map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&errBody)
+		assert.Regexp(test.err, errBody["error"])
+	}
+
+	processor.err = fmt.Errorf("pop")
+	req := httptest.NewRequest("POST", "/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("POST", "/admin/nonces/0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1/reset", bytes.NewReader([]byte{})))
+	assert.Equal(401, res.Code)
+}
+
+func TestListSolcVersions(t *testing.T) {
+	assert := assert.New(t)
+	s := &smartContractGW{solc: &eth.SolcConf{}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	os.Setenv("FLY_SOLC_0_6", "solc06")
+	defer os.Unsetenv("FLY_SOLC_0_6")
+	req := httptest.NewRequest("GET", "/solc/versions", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var versions eth.SolcVersions
+	err := json.NewDecoder(res.Body).Decode(&versions)
+	assert.NoError(err)
+	assert.Contains(versions.Installed, &eth.InstalledSolc{Version: "0.6", Path: "solc06", Source: "environment"})
+	assert.Nil(versions.Available)
+}
+
+func TestListSolcVersionsDownloadFailure(t *testing.T) {
+	assert := assert.New(t)
+	s := &smartContractGW{}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	dir := tempdir()
+	defer cleanup(dir)
+	s.solc = &eth.SolcConf{DownloadDir: dir, DownloadURL: "http://localhost:0"}
+	req := httptest.NewRequest("GET", "/solc/versions", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(502, res.Code)
+	var errBody errors.RESTError
+	json.NewDecoder(res.Body).Decode(&errBody)
+	assert.Regexp("Failed to download solc list", errBody.Message)
+}
+
+func TestGetSolcMetrics(t *testing.T) {
+	assert := assert.New(t)
+	s := &smartContractGW{solc: &eth.SolcConf{CacheSize: 10}}
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	req := httptest.NewRequest("GET", "/solc/metrics", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var metrics eth.CompilerMetrics
+	err := json.NewDecoder(res.Body).Decode(&metrics)
+	assert.NoError(err)
+	assert.Equal(10, metrics.CacheSize)
+	assert.NotEmpty(metrics.Since)
+}
+
+func TestRegisterContractParamDefaults(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	defaults := map[string]string{"from": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c", "gas": "100000"}
+	mcs.On("AddContract", "1123456789abcdef0123456789abcdef01234567", "abi1", "ops", "ops", &contractregistry.RegistrationOptions{ParamDefaults: defaults}).
+		Return(&contractregistry.ContractInfo{Address: "1123456789abcdef0123456789abcdef01234567", ParamDefaults: defaults}, nil)
+
+	req := httptest.NewRequest("POST", "/abis/abi1/0x1123456789abcdef0123456789abcdef01234567?fly-register=ops",
+		strings.NewReader(`{"paramDefaults":{"fly-from":"0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c","Gas":"100000"}}`))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	var info contractregistry.ContractInfo
+	json.NewDecoder(res.Body).Decode(&info)
+	assert.Equal(defaults, info.ParamDefaults)
+	mcs.AssertNotCalled(t, "SetParamDefaults", mock.Anything, mock.Anything)
+}
+
+func TestRegisterContractParamDefaultsErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	register := func(addr, body string) (int, string) {
+		req := httptest.NewRequest("POST", "/abis/abi1/0x"+addr, strings.NewReader(body))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var errBody errors.RESTError
+		json.NewDecoder(res.Body).Decode(&errBody)
+		return res.Code, errBody.Message
+	}
+
+	status, msg := register("1123456789abcdef0123456789abcdef01234567", `!json`)
+	assert.Equal(400, status)
+	assert.Regexp("Invalid parameter defaults", msg)
+
+	status, msg = register("1123456789abcdef0123456789abcdef01234567", `{"paramDefaults":{"from-address":"0x12345"}}`)
+	assert.Equal(400, status)
+	assert.Regexp("invalid parameter name 'from-address'", msg)
+
+	status, msg = register("1123456789abcdef0123456789abcdef01234567", `{"paramDefaults":{"gas":"1","fly-gas":"2"}}`)
+	assert.Equal(400, status)
+	assert.Regexp("duplicate parameter 'gas'", msg)
+
+	mcs.On("AddContract", "2123456789abcdef0123456789abcdef01234567", "abi1", "2123456789abcdef0123456789abcdef01234567", "",
+		&contractregistry.RegistrationOptions{ParamDefaults: map[string]string{"gas": "1"}}).
+		Return(nil, fmt.Errorf("pop"))
+	status, msg = register("2123456789abcdef0123456789abcdef01234567", `{"paramDefaults":{"gas":"1"}}`)
+	assert.Equal(500, status)
+	assert.Regexp("pop", msg)
+
+	mcs.On("AddContract", "3123456789abcdef0123456789abcdef01234567", "abi1", "3123456789abcdef0123456789abcdef01234567", "", mock.Anything).
+		Return(nil, errors.Errorf(errors.RESTGatewayFriendlyNameClash, "0123456789abcdef0123456789abcdef01234567", "3123456789abcdef0123456789abcdef01234567"))
+	status, msg = register("3123456789abcdef0123456789abcdef01234567", ``)
+	assert.Equal(409, status)
+	assert.Regexp("already registered", msg)
+}
+
+func TestRegisterContractDecimals(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	decimals := map[string]int{"amount": 18, "transfer.value": 6}
+	mcs.On("AddContract", "1123456789abcdef0123456789abcdef01234567", "abi1", "1123456789abcdef0123456789abcdef01234567", "", &contractregistry.RegistrationOptions{ParamDefaults: map[string]string{}, Decimals: decimals}).
+		Return(&contractregistry.ContractInfo{Address: "1123456789abcdef0123456789abcdef01234567", Decimals: decimals}, nil)
+
+	register := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/abis/abi1/0x1123456789abcdef0123456789abcdef01234567", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var errBody errors.RESTError
+		json.NewDecoder(res.Body).Decode(&errBody)
+		return res.Code, errBody.Message
+	}
+
+	status, _ := register(`{"decimals":{"amount":18,"transfer.value":6}}`)
+	assert.Equal(201, status)
+
+	status, msg := register(`{"decimals":{"amount-in":18}}`)
+	assert.Equal(400, status)
+	assert.Regexp("invalid parameter name 'amount-in'", msg)
+
+	status, msg = register(`{"decimals":{"amount":78}}`)
+	assert.Equal(400, status)
+	assert.Regexp("parameter 'amount' must have between 0 and 77 decimals", msg)
+}
+
+func TestRegisterContractGuards(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	guards := []*contractregistry.MethodGuard{{Methods: []string{"mint"}, Function: "hasRole(bytes32,address)", Params: []string{"0x01", "${from}"}}}
+	mcs.On("AddContract", "1123456789abcdef0123456789abcdef01234567", "abi1", "1123456789abcdef0123456789abcdef01234567", "", &contractregistry.RegistrationOptions{ParamDefaults: map[string]string{}, Guards: guards}).
+		Return(&contractregistry.ContractInfo{Address: "1123456789abcdef0123456789abcdef01234567", Guards: guards}, nil)
+
+	register := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/abis/abi1/0x1123456789abcdef0123456789abcdef01234567", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var errBody errors.RESTError
+		json.NewDecoder(res.Body).Decode(&errBody)
+		return res.Code, errBody.Message
+	}
+
+	status, _ := register(`{"guards":[{"methods":["mint"],"function":"hasRole(bytes32,address)","params":["0x01","${from}"]}]}`)
+	assert.Equal(201, status)
+
+	status, msg := register(`{"guards":[{"methods":["burn"],"function":"paused()"}]}`)
+	assert.Equal(400, status)
+	assert.Regexp("method 'burn' is not declared by the contract ABI", msg)
+
+	status, msg = register(`{"guards":[{"function":"hasRole(bytes32,address)"}]}`)
+	assert.Equal(400, status)
+	assert.Regexp("requires a param for each input", msg)
+}
+
+func TestProjectsEndToEnd(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	publish := func(project string) (int, *contractregistry.ABIInfo) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		fw, _ := writer.CreateFormField("abi")
+		io.Copy(fw, bytes.NewReader([]byte(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"}],"name":"Logged","type":"event"}]`)))
+		fw, _ = writer.CreateFormField("project")
+		io.Copy(fw, strings.NewReader(project))
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/abis", bytes.NewReader(body.Bytes()))
+		req.Header.Add("Content-Type", writer.FormDataContentType())
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var info contractregistry.ABIInfo
+		json.NewDecoder(res.Body).Decode(&info)
+		return res.Code, &info
+	}
+
+	status, _ := publish("bad project")
+	assert.Equal(400, status)
+
+	status, abi1 := publish("payments")
+	assert.Equal(200, status)
+	assert.Equal("payments", abi1.Project)
+
+	req := httptest.NewRequest("POST", "/abis/"+abi1.ID+"/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	var contract contractregistry.ContractInfo
+	json.NewDecoder(res.Body).Decode(&contract)
+	assert.Equal("payments", contract.Project)
+
+	req = httptest.NewRequest("POST", "/abis/"+abi1.ID+"/0x1123456789abcdef0123456789abcdef01234567", strings.NewReader(`{"project":"audit"}`))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	json.NewDecoder(res.Body).Decode(&contract)
+	assert.Equal("audit", contract.Project)
+
+	req = httptest.NewRequest("POST", "/abis/"+abi1.ID+"/0x2123456789abcdef0123456789abcdef01234567", strings.NewReader(`{"project":"-audit"}`))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+
+	req = httptest.NewRequest("GET", "/projects", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var projects []*contractregistry.ProjectInfo
+	json.NewDecoder(res.Body).Decode(&projects)
+	assert.Equal([]*contractregistry.ProjectInfo{
+		{Name: "audit", Contracts: 1},
+		{Name: "payments", ABIs: 1, Contracts: 1},
+	}, projects)
+
+	req = httptest.NewRequest("GET", "/contracts?project=audit", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var contracts []*contractregistry.ContractInfo
+	json.NewDecoder(res.Body).Decode(&contracts)
+	assert.Equal(1, len(contracts))
+	assert.Equal("1123456789abcdef0123456789abcdef01234567", contracts[0].Address)
+}
+
+func TestListProjectsFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	mcs.On("ListProjects").Return(nil, fmt.Errorf("pop"))
+	req := httptest.NewRequest("GET", "/projects", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+}
+
+func TestRegisterContractWithProject(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	mcs.On("AddContract", "1123456789abcdef0123456789abcdef01234567", "abi1", "1123456789abcdef0123456789abcdef01234567", "",
+		&contractregistry.RegistrationOptions{ParamDefaults: map[string]string{}, Project: "audit"}).
+		Return(&contractregistry.ContractInfo{Address: "1123456789abcdef0123456789abcdef01234567", Project: "audit"}, nil)
+	req := httptest.NewRequest("POST", "/abis/abi1/0x1123456789abcdef0123456789abcdef01234567", strings.NewReader(`{"project":"audit"}`))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	mcs.AssertNotCalled(t, "SetProject", mock.Anything, mock.Anything)
+}
+
+func TestSoftDeleteEndToEnd(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		&eth.SolcConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte{}))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormField("abi")
+	io.Copy(fw, bytes.NewReader([]byte(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"}],"name":"Logged","type":"event"}]`)))
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/abis", bytes.NewReader(body.Bytes()))
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var abi1 contractregistry.ABIInfo
+	json.NewDecoder(res.Body).Decode(&abi1)
+
+	res = do("POST", "/abis/"+abi1.ID+"/0x0123456789abcdef0123456789abcdef01234567?fly-register=c1")
+	assert.Equal(201, res.Code)
+
+	res = do("DELETE", "/abis/"+abi1.ID)
+	assert.Equal(409, res.Code)
+	res = do("DELETE", "/contracts/c1")
+	assert.Equal(200, res.Code)
+	var contract contractregistry.ContractInfo
+	json.NewDecoder(res.Body).Decode(&contract)
+	assert.NotEmpty(contract.Deleted)
+	res = do("DELETE", "/contracts/c1")
+	assert.Equal(410, res.Code)
+	res = do("DELETE", "/contracts/unknown")
+	assert.Equal(404, res.Code)
+
+	res = do("GET", "/contracts/0x0123456789abcdef0123456789abcdef01234567")
+	assert.Equal(410, res.Code)
+	assert.Regexp("was deleted at", res.Body.String())
+	res = do("GET", "/contracts/c1?swagger")
+	assert.Equal(410, res.Code)
+	res = do("POST", "/contracts/c1/anyMethod")
+	assert.Equal(410, res.Code)
+	res = do("PUT", "/contracts/c1/policy")
+	assert.Equal(410, res.Code)
+	var contracts []*contractregistry.ContractInfo
+	res = do("GET", "/contracts")
+	json.NewDecoder(res.Body).Decode(&contracts)
+	assert.Empty(contracts)
+	res = do("GET", "/contracts?deleted=true")
+	json.NewDecoder(res.Body).Decode(&contracts)
+	assert.Equal(1, len(contracts))
+
+	res = do("DELETE", "/abis/"+abi1.ID)
+	assert.Equal(200, res.Code)
+	res = do("GET", "/abis/"+abi1.ID)
+	assert.Equal(410, res.Code)
+	res = do("POST", "/abis/"+abi1.ID+"/0x1123456789abcdef0123456789abcdef01234567")
+	assert.Equal(410, res.Code)
+	res = do("POST", "/abis/"+abi1.ID)
+	assert.Equal(410, res.Code)
+
+	res = do("POST", "/contracts/c1/restore")
+	assert.Equal(409, res.Code)
+	res = do("POST", "/abis/"+abi1.ID+"/restore")
+	assert.Equal(200, res.Code)
+	res = do("POST", "/abis/"+abi1.ID+"/restore")
+	assert.Equal(409, res.Code)
+	res = do("POST", "/contracts/0x0123456789abcdef0123456789abcdef01234567/restore")
+	assert.Equal(200, res.Code)
+	var restored contractregistry.ContractInfo
+	json.NewDecoder(res.Body).Decode(&restored)
+	assert.Empty(restored.Deleted)
+
+	res = do("GET", "/contracts/c1")
+	assert.Equal(200, res.Code)
+	res = do("GET", "/abis/"+abi1.ID)
+	assert.Equal(200, res.Code)
+}
+
+func TestDeleteContractOrABIFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, mcs, router := newTestMethodPolicyGateway(t, dir)
+
+	mcs.On("DeleteContract", "c1").Return(nil, fmt.Errorf("pop"))
+	mcs.On("DeleteABI", "abi1").Return(nil, errors.Errorf(errors.RESTGatewayABIInUse, "abi1", 1))
+	req := httptest.NewRequest("DELETE", "/contracts/c1", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+	req = httptest.NewRequest("DELETE", "/abis/abi1", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(409, res.Code)
+}
+
+func TestLookupErrStatus(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(410, lookupErrStatus(errors.Errorf(errors.RESTGatewayContractDeleted, "c1", "2021-01-01T00:00:00Z")))
+	assert.Equal(410, lookupErrStatus(errors.Errorf(errors.RESTGatewayABIDeleted, "abi1", "2021-01-01T00:00:00Z")))
+	assert.Equal(409, lookupErrStatus(errors.Errorf(errors.RESTGatewayContractABIDeleted, "abi1")))
+	assert.Equal(409, lookupErrStatus(errors.Errorf(errors.RESTGatewayContractNotDeleted, "c1")))
+	assert.Equal(404, lookupErrStatus(errors.Errorf(errors.RESTGatewayLocalStoreContractNotFound, "c1")))
+	assert.Equal(404, lookupErrStatus(fmt.Errorf("pop")))
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// speedUpHandler asks the processor tracking an in-flight transaction to resend it with the same
+// nonce and a higher gas price. The sender is looked up on the node, so the request is keyed
+// the same way as the transactions sent from the address, and reaches the same processor
+func (r *rest2eth) speedUpHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	txHash := params.ByName("hash")
+	info, status, err := r.pendingTransaction(req.Context(), txHash)
+	if err != nil {
+		r.restErrReply(res, req, err, status)
+		return
+	}
+
+	msg := &messages.SpeedUpTransaction{}
+	r.assignMessageID(&msg.Headers, req)
+	msg.Headers.MsgType = messages.MsgTypeSpeedUpTransaction
+	msg.From = strings.ToLower(info.From.Hex())
+	msg.TransactionHash = txHash
+	msg.GasPrice = json.Number(getFlyParam("gasprice", req))
+	msg.MaxFeePerGas = json.Number(getFlyParam("maxfee", req))
+	msg.MaxPriorityFeePerGas = json.Number(getFlyParam("priorityfee", req))
+	r.dispatchReplacement(res, req, msg)
+}
+
+// cancelHandler asks the processor tracking an in-flight transaction to replace it with a
+// zero-value transfer from the sender to itself. The reply is sent once either is mined
+func (r *rest2eth) cancelHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	txHash := params.ByName("hash")
+	info, status, err := r.pendingTransaction(req.Context(), txHash)
+	if err != nil {
+		r.restErrReply(res, req, err, status)
+		return
+	}
+
+	msg := &messages.CancelTransaction{}
+	r.assignMessageID(&msg.Headers, req)
+	msg.Headers.MsgType = messages.MsgTypeCancelTransaction
+	msg.From = strings.ToLower(info.From.Hex())
+	msg.TransactionHash = txHash
+	msg.GasPrice = json.Number(getFlyParam("gasprice", req))
+	msg.MaxFeePerGas = json.Number(getFlyParam("maxfee", req))
+	msg.MaxPriorityFeePerGas = json.Number(getFlyParam("priorityfee", req))
+	r.dispatchReplacement(res, req, msg)
+}
+
+// dispatchReplacement sends a speed-up or cancel request asynchronously, as the processor
+// replies from the goroutine tracking the transaction
+func (r *rest2eth) dispatchReplacement(res http.ResponseWriter, req *http.Request, msg interface{}) {
+	msgBytes, _ := json.Marshal(msg)
+	var mapMsg map[string]interface{}
+	json.Unmarshal(msgBytes, &mapMsg)
+	ack := !getFlyParamBool("noack", req)
+	if asyncResponse, status, err := r.asyncDispatcher.DispatchMsgAsync(req.Context(), mapMsg, ack, false); err != nil {
+		r.restErrReply(res, req, err, status)
+	} else {
+		r.restAsyncReply(res, req, asyncResponse)
+	}
+}
+
+// pendingTransaction returns a transaction that the node has not yet mined
+func (r *rest2eth) pendingTransaction(ctx context.Context, txHash string) (*eth.TxnInfo, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var info *eth.TxnInfo
+	if err := r.rpc.CallContext(ctx, &info, "eth_getTransactionByHash", txHash); err != nil {
+		return nil, 500, ethconnecterrors.Errorf(ethconnecterrors.RPCCallReturnedError, "eth_getTransactionByHash", err)
+	}
+	if info == nil || info.From == nil {
+		return nil, 404, ethconnecterrors.Errorf(ethconnecterrors.TransactionSpeedUpNotFound, txHash)
+	}
+	if info.BlockNumber != nil {
+		return nil, 409, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySpeedUpMined, txHash, info.BlockNumber.ToInt().Text(10))
+	}
+	return info, 0, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testSpeedUpHash = "0x3e9c6a0a2a2b5e6ae4a40e3d2c4fbb9dda4df2d9cf2f6e8bcb42b1dc4cb5a2b1"
+
+func expectSpeedUpLookup(mockRPC *ethmocks.RPCClient, info *eth.TxnInfo, err error) {
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionByHash", testSpeedUpHash).
+		Run(func(args mock.Arguments) {
+			*(args[1].(**eth.TxnInfo)) = info
+		}).Return(err).Once()
+}
+
+func TestSpeedUpTransaction(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	from := ethbind.API.HexToAddress("0x66C5fE653e7A9EBB628a6D40f0452d1e358BaEE8")
+	expectSpeedUpLookup(r.rpc.(*ethmocks.RPCClient), &eth.TxnInfo{From: &from}, nil)
+
+	req := httptest.NewRequest("POST", "/transactions/"+testSpeedUpHash+"/speedup?fly-gasprice=2000000000", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	msg := dispatcher.asyncDispatchMsg
+	assert.Equal(messages.MsgTypeSpeedUpTransaction, msg["headers"].(map[string]interface{})["type"])
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", msg["from"])
+	assert.Equal(testSpeedUpHash, msg["transactionHash"])
+	assert.Equal(float64(2000000000), msg["gasPrice"])
+	assert.Nil(msg["maxFeePerGas"])
+	assert.True(dispatcher.asyncDispatchAck)
+}
+
+func TestSpeedUpTransactionDispatchFail(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchStatus: 500,
+		asyncDispatchError:  fmt.Errorf("pop"),
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	from := ethbind.API.HexToAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	expectSpeedUpLookup(r.rpc.(*ethmocks.RPCClient), &eth.TxnInfo{From: &from}, nil)
+
+	req := httptest.NewRequest("POST", "/transactions/"+testSpeedUpHash+"/speedup", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+}
+
+func TestCancelTransaction(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	r, router := newTestREST2Eth(dispatcher)
+	from := ethbind.API.HexToAddress("0x66C5fE653e7A9EBB628a6D40f0452d1e358BaEE8")
+	expectSpeedUpLookup(r.rpc.(*ethmocks.RPCClient), &eth.TxnInfo{From: &from}, nil)
+
+	req := httptest.NewRequest("POST", "/transactions/"+testSpeedUpHash+"/cancel?fly-maxfee=3000000000&fly-noack", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	msg := dispatcher.asyncDispatchMsg
+	assert.Equal(messages.MsgTypeCancelTransaction, msg["headers"].(map[string]interface{})["type"])
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", msg["from"])
+	assert.Equal(testSpeedUpHash, msg["transactionHash"])
+	assert.Equal(float64(3000000000), msg["maxFeePerGas"])
+	assert.Nil(msg["gasPrice"])
+	assert.False(dispatcher.asyncDispatchAck)
+}
+
+func TestCancelTransactionMined(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	from := ethbind.API.HexToAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	expectSpeedUpLookup(r.rpc.(*ethmocks.RPCClient), &eth.TxnInfo{From: &from, BlockNumber: &blockNumber}, nil)
+
+	req := httptest.NewRequest("POST", "/transactions/"+testSpeedUpHash+"/cancel", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(409, res.Code)
+}
+
+func TestSpeedUpTransactionLookupErrors(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mockRPC := r.rpc.(*ethmocks.RPCClient)
+	from := ethbind.API.HexToAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	expectSpeedUpLookup(mockRPC, nil, fmt.Errorf("pop"))
+	expectSpeedUpLookup(mockRPC, nil, nil)
+	expectSpeedUpLookup(mockRPC, &eth.TxnInfo{From: &from, BlockNumber: &blockNumber}, nil)
+
+	speedUp := func() (int, string) {
+		req := httptest.NewRequest("POST", "/transactions/"+testSpeedUpHash+"/speedup", nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var errBody errors.RESTError
+		json.NewDecoder(res.Body).Decode(&errBody)
+		return res.Code, errBody.Message
+	}
+
+	status, msg := speedUp()
+	assert.Equal(500, status)
+	assert.Regexp("eth_getTransactionByHash returned: pop", msg)
+
+	status, msg = speedUp()
+	assert.Equal(404, status)
+	assert.Regexp("Transaction "+testSpeedUpHash+" is not in-flight", msg)
+
+	status, msg = speedUp()
+	assert.Equal(409, status)
+	assert.Regexp("Transaction "+testSpeedUpHash+" has already been mined in block 12345", msg)
+}
@@ -82,7 +82,13 @@ func (t *syncTxInflight) SendErrorReplyWithGapFill(status int, err error, gapFil
 }
 
 func (t *syncTxInflight) SendErrorReplyWithTX(status int, err error, txHash string) {
-	t.SendErrorReply(status, errors.Errorf(errors.RESTGatewaySyncWrapErrorWithTXDetail, txHash, err))
+	err = errors.Errorf(errors.RESTGatewaySyncWrapErrorWithTXDetail, txHash, err)
+	if txHash == "" {
+		t.SendErrorReply(status, err)
+		return
+	}
+	// The transaction has been sent, so the reply processor must not treat it as safe to resubmit
+	t.replyProcessor.ReplyWithTXError(err, txHash)
 }
 
 func (t *syncTxInflight) Reply(replyMessage messages.ReplyWithHeaders) {
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/tx"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +34,16 @@ type mockProcessor struct {
 	unmarshalErr error
 	badUnmarshal bool
 	resolvedFrom string
+	pending      *tx.PendingTransactions
+	inflight     []*tx.InflightAddress
+	nonceReset   *tx.NonceReset
+	resetNonce   *int64
+	abiResolver  tx.ContractABIResolver
+
+	integrationUpdate *tx.IntegrationUpdate
+	integrationProbe  string
+	hdWalletConf      *tx.HDWalletConf
+	addressBookConf   *tx.AddressBookConf
 }
 
 func (p *mockProcessor) ResolveAddress(from string) (resolvedFrom string, err error) {
@@ -58,9 +69,43 @@ func (p *mockProcessor) OnMessage(c tx.TxnContext) {
 	}
 }
 func (p *mockProcessor) Init(eth.RPCClient) {}
+func (p *mockProcessor) PendingTransactions(ctx context.Context, addr string) (*tx.PendingTransactions, error) {
+	return p.pending, p.err
+}
+func (p *mockProcessor) InflightTransactions(addr string) ([]*tx.InflightAddress, error) {
+	return p.inflight, p.err
+}
+func (p *mockProcessor) ResetNonce(addr string, nextNonce *int64) (*tx.NonceReset, error) {
+	p.resetNonce = nextNonce
+	return p.nonceReset, p.err
+}
+
+func (p *mockProcessor) RecoverInflight(store kvstore.KVStore, newContext tx.RecoveryContextFactory) (*tx.RecoveryResult, error) {
+	return &tx.RecoveryResult{}, p.err
+}
+
+func (p *mockProcessor) UpdateHDWallet(conf *tx.HDWalletConf, probe string) (*tx.IntegrationUpdate, error) {
+	p.hdWalletConf = conf
+	p.integrationProbe = probe
+	return p.integrationUpdate, p.err
+}
+
+func (p *mockProcessor) UpdateAddressBook(ctx context.Context, conf *tx.AddressBookConf, probe string) (*tx.IntegrationUpdate, error) {
+	p.addressBookConf = conf
+	p.integrationProbe = probe
+	return p.integrationUpdate, p.err
+}
+
+func (p *mockProcessor) AddLifecycleSink(sink tx.LifecycleSink) {
+}
+
+func (p *mockProcessor) SetContractABIResolver(resolver tx.ContractABIResolver) {
+	p.abiResolver = resolver
+}
 
 type mockReplyProcessor struct {
 	err     error
+	txHash  string
 	receipt messages.ReplyWithHeaders
 }
 
@@ -68,6 +113,11 @@ func (p *mockReplyProcessor) ReplyWithError(err error) {
 	p.err = err
 }
 
+func (p *mockReplyProcessor) ReplyWithTXError(err error, txHash string) {
+	p.err = err
+	p.txHash = txHash
+}
+
 func (p *mockReplyProcessor) ReplyWithReceipt(receipt messages.ReplyWithHeaders) {
 	p.receipt = receipt
 }
@@ -142,4 +192,16 @@ func TestDispatchSendTransactionError(t *testing.T) {
 	d.DispatchSendTransactionSync(context.Background(), sendTx, r)
 
 	assert.Regexp("TX hash1: pop", r.err)
+	assert.Equal("hash1", r.txHash)
+}
+
+func TestSendErrorReplyWithoutTX(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &mockReplyProcessor{}
+	c := &syncTxInflight{replyProcessor: r, sendMsg: &messages.SendTransaction{}}
+	c.SendErrorReplyWithTX(500, fmt.Errorf("pop"), "")
+
+	assert.Regexp("pop", r.err)
+	assert.Empty(r.txHash)
 }
@@ -0,0 +1,105 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSyncQueueTimeoutMS = 30000
+	defaultSyncRetryAfterSec  = 5
+)
+
+// SyncRequestConf limits the number of synchronous (fly-sync) requests that hold a
+// connection open while waiting for a transaction to be mined
+type SyncRequestConf struct {
+	MaxInFlight    int `json:"maxInFlight,omitempty"`
+	MaxQueued      int `json:"maxQueued,omitempty"`
+	QueueTimeoutMS int `json:"queueTimeoutMS,omitempty"`
+	RetryAfterSec  int `json:"retryAfterSec,omitempty"`
+}
+
+// syncRequestPool bounds the synchronous requests being processed at any one time.
+// Requests beyond the limit wait in a bounded queue for a slot, and are rejected
+// once the queue is full, or they have waited longer than the queue timeout.
+// A nil pool places no limit on synchronous requests
+type syncRequestPool struct {
+	slots        chan struct{}
+	queue        chan struct{}
+	queueTimeout time.Duration
+	retryAfter   int
+}
+
+func newSyncRequestPool(conf *SyncRequestConf) *syncRequestPool {
+	if conf.MaxInFlight <= 0 {
+		return nil
+	}
+	if conf.MaxQueued < 0 {
+		conf.MaxQueued = 0
+	}
+	if conf.QueueTimeoutMS <= 0 {
+		conf.QueueTimeoutMS = defaultSyncQueueTimeoutMS
+	}
+	if conf.RetryAfterSec <= 0 {
+		conf.RetryAfterSec = defaultSyncRetryAfterSec
+	}
+	log.Infof("Synchronous requests limited to %d in flight, with %d queued for up to %dms", conf.MaxInFlight, conf.MaxQueued, conf.QueueTimeoutMS)
+	return &syncRequestPool{
+		slots:        make(chan struct{}, conf.MaxInFlight),
+		queue:        make(chan struct{}, conf.MaxQueued),
+		queueTimeout: time.Duration(conf.QueueTimeoutMS) * time.Millisecond,
+		retryAfter:   conf.RetryAfterSec,
+	}
+}
+
+// acquire reserves an in-flight slot, waiting in the queue if all slots are in use.
+// Every successful acquire must be followed by a release
+func (p *syncRequestPool) acquire(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	select {
+	case p.queue <- struct{}{}:
+		defer func() { <-p.queue }()
+	default:
+		return errors.Errorf(errors.RESTGatewaySyncRequestsSaturated, p.retryAfter)
+	}
+	timer := time.NewTimer(p.queueTimeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errors.Errorf(errors.RESTGatewaySyncRequestQueueTimeout, p.queueTimeout.Seconds(), p.retryAfter)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *syncRequestPool) release() {
+	if p != nil {
+		<-p.slots
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncRequestPoolUnlimited(t *testing.T) {
+	assert := assert.New(t)
+	p := newSyncRequestPool(&SyncRequestConf{})
+	assert.Nil(p)
+	assert.NoError(p.acquire(context.Background()))
+	p.release()
+}
+
+func TestSyncRequestPoolDefaults(t *testing.T) {
+	assert := assert.New(t)
+	conf := &SyncRequestConf{MaxInFlight: 2, MaxQueued: -1}
+	p := newSyncRequestPool(conf)
+	assert.Equal(0, conf.MaxQueued)
+	assert.Equal(defaultSyncQueueTimeoutMS, conf.QueueTimeoutMS)
+	assert.Equal(defaultSyncRetryAfterSec, p.retryAfter)
+	assert.Equal(2, cap(p.slots))
+}
+
+func TestSyncRequestPoolNoQueue(t *testing.T) {
+	assert := assert.New(t)
+	p := newSyncRequestPool(&SyncRequestConf{MaxInFlight: 1})
+	assert.NoError(p.acquire(context.Background()))
+	err := p.acquire(context.Background())
+	assert.Regexp("Too many synchronous requests in flight. Retry after 5 seconds", err)
+	p.release()
+	assert.NoError(p.acquire(context.Background()))
+	p.release()
+}
+
+func TestSyncRequestPoolQueued(t *testing.T) {
+	assert := assert.New(t)
+	p := newSyncRequestPool(&SyncRequestConf{MaxInFlight: 1, MaxQueued: 1})
+	assert.NoError(p.acquire(context.Background()))
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- p.acquire(context.Background())
+	}()
+	for len(p.queue) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	err := p.acquire(context.Background())
+	assert.Regexp("Too many synchronous requests in flight", err)
+
+	p.release()
+	assert.NoError(<-acquired)
+	assert.Equal(0, len(p.queue))
+	p.release()
+}
+
+func TestSyncRequestPoolQueueTimeout(t *testing.T) {
+	assert := assert.New(t)
+	p := newSyncRequestPool(&SyncRequestConf{MaxInFlight: 1, MaxQueued: 1, QueueTimeoutMS: 1, RetryAfterSec: 3})
+	assert.NoError(p.acquire(context.Background()))
+	err := p.acquire(context.Background())
+	assert.Regexp("Timed out after 0.00s waiting to process synchronous request. Retry after 3 seconds", err)
+	assert.Equal(0, len(p.queue))
+}
+
+func TestSyncRequestPoolContextCancelled(t *testing.T) {
+	assert := assert.New(t)
+	p := newSyncRequestPool(&SyncRequestConf{MaxInFlight: 1, MaxQueued: 1})
+	assert.NoError(p.acquire(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.acquire(ctx)
+	assert.Regexp("context canceled", err)
+}
@@ -0,0 +1,289 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+const (
+	defaultTokenListLimit = 100
+	maxTokenListLimit     = 1000
+)
+
+// tokenMethodsABI declares the standard token functions called by the token routes, with
+// the output names we return. We call these rather than the functions in the contract's
+// own ABI, so the results are consistent for every contract
+const tokenMethodsABI = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"balance","type":"uint256"}]},
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"decimals","type":"uint8"}]},
+	{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"owner","type":"address"}]},
+	{"type":"function","name":"tokenOfOwnerByIndex","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"index","type":"uint256"}],"outputs":[{"name":"tokenId","type":"uint256"}]},
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}],"outputs":[{"name":"balance","type":"uint256"}]}
+]`
+
+var tokenMethods = parseTokenMethods()
+
+func parseTokenMethods() map[string]*ethbinding.ABIMethod {
+	var abi ethbinding.ABIMarshaling
+	if err := json.Unmarshal([]byte(tokenMethodsABI), &abi); err != nil {
+		panic(err)
+	}
+	methods := make(map[string]*ethbinding.ABIMethod)
+	for i := range abi {
+		method, err := ethbind.API.ABIElementMarshalingToABIMethod(&abi[i])
+		if err != nil {
+			panic(err)
+		}
+		methods[contractregistry.FunctionSignature(&abi[i])] = method
+	}
+	return methods
+}
+
+type erc20Balance struct {
+	Holder    string `json:"holder"`
+	Balance   string `json:"balance"`
+	Decimals  *int   `json:"decimals,omitempty"`
+	Formatted string `json:"formatted"`
+}
+
+type erc721Tokens struct {
+	Owner   string   `json:"owner"`
+	Balance string   `json:"balance"`
+	Tokens  []string `json:"tokens"`
+}
+
+type erc721Owner struct {
+	TokenID string `json:"tokenId"`
+	Owner   string `json:"owner"`
+}
+
+type erc1155Balance struct {
+	Holder  string `json:"holder"`
+	ID      string `json:"id"`
+	Balance string `json:"balance"`
+}
+
+// declaresFunction checks if the contract's own ABI declares a function, for optional parts of a standard
+func declaresFunction(abi ethbinding.ABIMarshaling, signature string) bool {
+	for i := range abi {
+		if abi[i].Type == "function" && contractregistry.FunctionSignature(&abi[i]) == signature {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTokenAmount formats an integer token amount as a decimal, using the decimals of the token
+func formatTokenAmount(amount string, decimals int) string {
+	if decimals <= 0 {
+		return amount
+	}
+	if len(amount) <= decimals {
+		amount = strings.Repeat("0", decimals-len(amount)+1) + amount
+	}
+	whole, fraction := amount[:len(amount)-decimals], strings.TrimRight(amount[len(amount)-decimals:], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+func validTokenNumber(s string) bool {
+	_, ok := new(big.Int).SetString(s, 10)
+	return ok
+}
+
+// callTokenMethod calls one of the standard token functions, and returns the named output
+func (r *rest2eth) callTokenMethod(ctx context.Context, addr, signature, output, blocknumber string, params ...interface{}) (string, error) {
+	result, err := eth.CallMethod(ctx, r.rpc, nil, "", addr, "", tokenMethods[signature], params, blocknumber, nil)
+	if err == nil && result["error"] != nil {
+		err = fmt.Errorf("%s", result["error"])
+	}
+	if err != nil {
+		return "", errors.Errorf(errors.RESTGatewayTokenCallFailed, signature, err)
+	}
+	return fmt.Sprintf("%v", result[output]), nil
+}
+
+func (r *rest2eth) getERC20Balance(ctx context.Context, addr string, abi ethbinding.ABIMarshaling, holder, blocknumber string) (interface{}, int, error) {
+	if !ethbind.API.IsHexAddress(holder) {
+		return nil, 400, errors.Errorf(errors.RESTGatewayTokenInvalidParam, "holder", holder)
+	}
+	balance, err := r.callTokenMethod(ctx, addr, "balanceOf(address)", "balance", blocknumber, holder)
+	if err != nil {
+		return nil, 500, err
+	}
+	result := &erc20Balance{
+		Holder:    holder,
+		Balance:   balance,
+		Formatted: balance,
+	}
+	// The decimals are optional in ERC-20, so the balance is only formatted if they are declared
+	if declaresFunction(abi, "decimals()") {
+		decimalsStr, err := r.callTokenMethod(ctx, addr, "decimals()", "decimals", blocknumber)
+		if err != nil {
+			return nil, 500, err
+		}
+		decimals, _ := strconv.Atoi(decimalsStr)
+		result.Decimals = &decimals
+		result.Formatted = formatTokenAmount(balance, decimals)
+	}
+	return result, 200, nil
+}
+
+func (r *rest2eth) getERC721Tokens(ctx context.Context, addr string, abi ethbinding.ABIMarshaling, owner, blocknumber string, req *http.Request) (interface{}, int, error) {
+	if !ethbind.API.IsHexAddress(owner) {
+		return nil, 400, errors.Errorf(errors.RESTGatewayTokenInvalidParam, "owner", owner)
+	}
+	limit := defaultTokenListLimit
+	if limitStr := req.FormValue("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 || limit > maxTokenListLimit {
+			return nil, 400, errors.Errorf(errors.RESTGatewayTokenInvalidParam, "limit", limitStr)
+		}
+	}
+	// Listing the tokens requires the optional enumeration extension
+	if !declaresFunction(abi, "tokenOfOwnerByIndex(address,uint256)") {
+		return nil, 400, errors.Errorf(errors.RESTGatewayTokenNotEnumerable, addr)
+	}
+	balance, err := r.callTokenMethod(ctx, addr, "balanceOf(address)", "balance", blocknumber, owner)
+	if err != nil {
+		return nil, 500, err
+	}
+	result := &erc721Tokens{
+		Owner:   owner,
+		Balance: balance,
+		Tokens:  []string{},
+	}
+	count, err := tokenCount(addr, balance, limit)
+	if err != nil {
+		return nil, 500, err
+	}
+	for i := 0; i < count; i++ {
+		tokenID, err := r.callTokenMethod(ctx, addr, "tokenOfOwnerByIndex(address,uint256)", "tokenId", blocknumber, owner, strconv.Itoa(i))
+		if err != nil {
+			return nil, 500, err
+		}
+		result.Tokens = append(result.Tokens, tokenID)
+	}
+	return result, 200, nil
+}
+
+// tokenCount parses a uint256 balance, capping it at the limit so it always fits in an int
+func tokenCount(addr, balance string, limit int) (int, error) {
+	count, ok := new(big.Int).SetString(balance, 10)
+	if !ok || count.Sign() < 0 {
+		return 0, errors.Errorf(errors.RESTGatewayTokenInvalidBalance, addr, balance)
+	}
+	if count.Cmp(big.NewInt(int64(limit))) < 0 {
+		return int(count.Int64()), nil
+	}
+	return limit, nil
+}
+
+func (r *rest2eth) getERC721Owner(ctx context.Context, addr, tokenID, blocknumber string) (interface{}, int, error) {
+	if !validTokenNumber(tokenID) {
+		return nil, 400, errors.Errorf(errors.RESTGatewayTokenInvalidParam, "tokenId", tokenID)
+	}
+	owner, err := r.callTokenMethod(ctx, addr, "ownerOf(uint256)", "owner", blocknumber, tokenID)
+	if err != nil {
+		return nil, 500, err
+	}
+	return &erc721Owner{TokenID: tokenID, Owner: owner}, 200, nil
+}
+
+func (r *rest2eth) getERC1155Balance(ctx context.Context, addr, holder, id, blocknumber string) (interface{}, int, error) {
+	if !ethbind.API.IsHexAddress(holder) {
+		return nil, 400, errors.Errorf(errors.RESTGatewayTokenInvalidParam, "holder", holder)
+	}
+	if !validTokenNumber(id) {
+		return nil, 400, errors.Errorf(errors.RESTGatewayTokenInvalidParam, "id", id)
+	}
+	balance, err := r.callTokenMethod(ctx, addr, "balanceOf(address,uint256)", "balance", blocknumber, holder, id)
+	if err != nil {
+		return nil, 500, err
+	}
+	return &erc1155Balance{Holder: holder, ID: id, Balance: balance}, 200, nil
+}
+
+// tokenHandler serves the convenience routes for contracts that implement the
+// ERC-20, ERC-721 and ERC-1155 token standards, such as
+// /contracts/:address/erc20/balance/:holder
+func (r *rest2eth) tokenHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	// The route shares its wildcards with the other contract routes
+	standard := strings.ToLower(params.ByName("method"))
+	route := params.ByName("subcommand")
+	arg := params.ByName("arg")
+
+	c := &restCmd{}
+	abi, _, err := r.resolveABI(res, req, params, c, params.ByName("address"))
+	if err != nil {
+		return
+	}
+	// Functions hidden by the method policy of the contract are not used by the token routes
+	abi = c.methodPolicy.Filter(abi)
+	implemented := false
+	for _, s := range contractregistry.DetectTokenStandards(abi) {
+		implemented = implemented || s == standard
+	}
+	if !implemented {
+		r.restErrReply(res, req, errors.Errorf(errors.RESTGatewayTokenStandardNotImplemented, c.addr, standard), 404)
+		return
+	}
+
+	ctx := req.Context()
+	blocknumber := getFlyParam("blocknumber", req)
+	var result interface{}
+	var status int
+	switch standard + "/" + route {
+	case contractregistry.TokenStandardERC20 + "/balance":
+		result, status, err = r.getERC20Balance(ctx, c.addr, abi, arg, blocknumber)
+	case contractregistry.TokenStandardERC721 + "/tokens":
+		result, status, err = r.getERC721Tokens(ctx, c.addr, abi, arg, blocknumber, req)
+	case contractregistry.TokenStandardERC721 + "/owner":
+		result, status, err = r.getERC721Owner(ctx, c.addr, arg, blocknumber)
+	case contractregistry.TokenStandardERC1155 + "/balance":
+		result, status, err = r.getERC1155Balance(ctx, c.addr, arg, req.FormValue("id"), blocknumber)
+	default:
+		status, err = 404, errors.Errorf(errors.RESTGatewayTokenRouteNotFound, standard, route)
+	}
+	if err != nil {
+		r.restErrReply(res, req, err, status)
+		return
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(result)
+}
@@ -0,0 +1,335 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+const testTokenAddress = "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+const testTokenHolder = "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+
+// testTokenABI builds an ABI declaring the functions with the signatures provided
+func testTokenABI(signatures ...string) ethbinding.ABIMarshaling {
+	var abi ethbinding.ABIMarshaling
+	for _, sig := range signatures {
+		name := sig[:strings.Index(sig, "(")]
+		element := ethbinding.ABIElementMarshaling{Type: "function", Name: name}
+		if types := strings.TrimSuffix(sig[len(name)+1:], ")"); types != "" {
+			for _, t := range strings.Split(types, ",") {
+				element.Inputs = append(element.Inputs, ethbinding.ABIArgumentMarshaling{Type: t})
+			}
+		}
+		abi = append(abi, element)
+	}
+	return abi
+}
+
+var testERC20Functions = []string{
+	"totalSupply()",
+	"balanceOf(address)",
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"allowance(address,address)",
+}
+
+var testERC721Functions = []string{
+	"balanceOf(address)",
+	"ownerOf(uint256)",
+	"safeTransferFrom(address,address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"setApprovalForAll(address,bool)",
+	"getApproved(uint256)",
+	"isApprovedForAll(address,address)",
+}
+
+func newTestTokenREST2Eth(abi ethbinding.ABIMarshaling) (*rest2eth, *httprouter.Router, *ethmocks.RPCClient) {
+	return newTestTokenREST2EthWithPolicy(abi, nil)
+}
+
+func newTestTokenREST2EthWithPolicy(abi ethbinding.ABIMarshaling, policy *contractregistry.MethodPolicy) (*rest2eth, *httprouter.Router, *ethmocks.RPCClient) {
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("GetContractByAddress", strings.TrimPrefix(testTokenAddress, "0x")).
+		Return(&contractregistry.ContractInfo{ABI: "abi1", MethodPolicy: policy}, nil)
+	mcr.On("GetABI", contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    "abi1",
+	}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: abi},
+	}, nil)
+	return r, router, r.rpc.(*ethmocks.RPCClient)
+}
+
+func expectTokenCall(mockRPC *ethmocks.RPCClient, blocknumber, result string) {
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, blocknumber).
+		Run(func(args mock.Arguments) {
+			*(args[1].(*string)) = result
+		}).
+		Return(nil).Once()
+}
+
+func getTokenRoute(router *httprouter.Router, path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest("GET", path, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	return res, reply
+}
+
+func TestFormatTokenAmount(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("12345", formatTokenAmount("12345", 0))
+	assert.Equal("123.45", formatTokenAmount("12345", 2))
+	assert.Equal("0.012345", formatTokenAmount("12345", 6))
+	assert.Equal("0.00012345", formatTokenAmount("12345", 8))
+	assert.Equal("1", formatTokenAmount("1000000000000000000", 18))
+	assert.Equal("1.5", formatTokenAmount("1500000000000000000", 18))
+	assert.Equal("0", formatTokenAmount("0", 18))
+}
+
+func TestERC20BalanceWithDecimals(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(append(testERC20Functions, "decimals()")...))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 1234500000))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 6))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/balance/"+testTokenHolder)
+	assert.Equal(200, res.Code)
+	assert.Equal(testTokenHolder, reply["holder"])
+	assert.Equal("1234500000", reply["balance"])
+	assert.Equal(float64(6), reply["decimals"])
+	assert.Equal("1234.5", reply["formatted"])
+	mockRPC.AssertExpectations(t)
+}
+
+func TestERC20BalanceNoDecimalsAtBlock(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(testERC20Functions...))
+	expectTokenCall(mockRPC, "0x3039", fmt.Sprintf("0x%064x", 12345))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/ERC20/balance/"+testTokenHolder+"?fly-blocknumber=12345")
+	assert.Equal(200, res.Code)
+	assert.Equal("12345", reply["balance"])
+	assert.Nil(reply["decimals"])
+	assert.Equal("12345", reply["formatted"])
+}
+
+func TestERC20BalanceErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(append(testERC20Functions, "decimals()")...))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/balance/badness")
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid holder: 'badness'", reply["error"])
+
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(fmt.Errorf("pop")).Once()
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/balance/"+testTokenHolder)
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to call balanceOf\\(address\\)", reply["error"])
+
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 12345))
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(fmt.Errorf("pop")).Once()
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/balance/"+testTokenHolder)
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to call decimals\\(\\)", reply["error"])
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/allowance/"+testTokenHolder)
+	assert.Equal(404, res.Code)
+	assert.Regexp("Unknown erc20 token route 'allowance'", reply["error"])
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/owner/1")
+	assert.Equal(404, res.Code)
+	assert.Regexp("Contract 567a417717cb6c59ddc1035705f02c0fd1ab1872 does not implement erc721", reply["error"])
+}
+
+func TestERC721Tokens(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(append(testERC721Functions, "tokenOfOwnerByIndex(address,uint256)")...))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 3))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 10))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 20))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/"+testTokenHolder+"?limit=2")
+	assert.Equal(200, res.Code)
+	assert.Equal(testTokenHolder, reply["owner"])
+	assert.Equal("3", reply["balance"])
+	assert.Equal([]interface{}{"10", "20"}, reply["tokens"])
+	mockRPC.AssertExpectations(t)
+}
+
+func TestERC721TokensLargeBalanceCappedAtLimit(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(append(testERC721Functions, "tokenOfOwnerByIndex(address,uint256)")...))
+	expectTokenCall(mockRPC, "latest", "0x"+strings.Repeat("f", 64))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 10))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/"+testTokenHolder+"?limit=1")
+	assert.Equal(200, res.Code)
+	assert.Regexp("^115792089237316195423570985008687907853269984665640564039457584007913129639935$", reply["balance"])
+	assert.Equal([]interface{}{"10"}, reply["tokens"])
+	mockRPC.AssertExpectations(t)
+}
+
+func TestTokenCount(t *testing.T) {
+	assert := assert.New(t)
+	count, err := tokenCount(testTokenAddress, "3", 10)
+	assert.NoError(err)
+	assert.Equal(3, count)
+
+	count, err = tokenCount(testTokenAddress, "115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+	assert.NoError(err)
+	assert.Equal(10, count)
+
+	_, err = tokenCount(testTokenAddress, "0x10", 10)
+	assert.Regexp("FFEC100403.*invalid balance '0x10'", err)
+
+	_, err = tokenCount(testTokenAddress, "-1", 10)
+	assert.Regexp("FFEC100403.*invalid balance '-1'", err)
+}
+
+func TestERC721TokensErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(testERC721Functions...))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/"+testTokenHolder)
+	assert.Equal(400, res.Code)
+	assert.Regexp("does not implement tokenOfOwnerByIndex", reply["error"])
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/"+testTokenHolder+"?limit=0")
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid limit: '0'", reply["error"])
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/badness")
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid owner: 'badness'", reply["error"])
+
+	_, router, mockRPC = newTestTokenREST2Eth(testTokenABI(append(testERC721Functions, "tokenOfOwnerByIndex(address,uint256)")...))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 1))
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(fmt.Errorf("pop")).Once()
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/"+testTokenHolder)
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to call tokenOfOwnerByIndex", reply["error"])
+
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(fmt.Errorf("pop")).Once()
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/tokens/"+testTokenHolder)
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to call balanceOf", reply["error"])
+}
+
+func TestERC721Owner(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(testERC721Functions...))
+	expectTokenCall(mockRPC, "latest", "0x000000000000000000000000"+strings.TrimPrefix(testTokenHolder, "0x"))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/owner/42")
+	assert.Equal(200, res.Code)
+	assert.Equal("42", reply["tokenId"])
+	assert.Equal(testTokenHolder, strings.ToLower(reply["owner"].(string)))
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/owner/badness")
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid tokenId: 'badness'", reply["error"])
+
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(fmt.Errorf("pop")).Once()
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc721/owner/42")
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to call ownerOf", reply["error"])
+}
+
+func TestERC1155Balance(t *testing.T) {
+	assert := assert.New(t)
+	_, router, mockRPC := newTestTokenREST2Eth(testTokenABI(
+		"balanceOf(address,uint256)",
+		"balanceOfBatch(address[],uint256[])",
+		"setApprovalForAll(address,bool)",
+		"isApprovedForAll(address,address)",
+		"safeTransferFrom(address,address,uint256,uint256,bytes)",
+		"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+	))
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 500))
+
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc1155/balance/"+testTokenHolder+"?id=7")
+	assert.Equal(200, res.Code)
+	assert.Equal("7", reply["id"])
+	assert.Equal("500", reply["balance"])
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc1155/balance/"+testTokenHolder)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid id: ''", reply["error"])
+
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc1155/balance/badness?id=7")
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid holder: 'badness'", reply["error"])
+
+	mockRPC.On("CallContext", mock.Anything, mock.Anything, "eth_call", mock.Anything, "latest").
+		Return(fmt.Errorf("pop")).Once()
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc1155/balance/"+testTokenHolder+"?id=7")
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to call balanceOf\\(address,uint256\\)", reply["error"])
+}
+
+func TestTokenRouteUnknownContract(t *testing.T) {
+	assert := assert.New(t)
+	r, router := newTestREST2Eth(&mockREST2EthDispatcher{})
+	mcr := r.cr.(*contractregistrymocks.ContractStore)
+	mcr.On("ResolveContractAddress", "unknown").Return("", fmt.Errorf("not found"))
+
+	res, reply := getTokenRoute(router, "/contracts/unknown/erc20/balance/"+testTokenHolder)
+	assert.Equal(404, res.Code)
+	assert.Regexp("not found", reply["error"])
+}
+
+func TestTokenRoutesRespectMethodPolicy(t *testing.T) {
+	assert := assert.New(t)
+	abi := testTokenABI(append(testERC20Functions, "decimals()")...)
+
+	// The balance is not formatted when the decimals are hidden
+	_, router, mockRPC := newTestTokenREST2EthWithPolicy(abi, &contractregistry.MethodPolicy{Deny: []string{"decimals"}})
+	expectTokenCall(mockRPC, "latest", fmt.Sprintf("0x%064x", 12345))
+	res, reply := getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/balance/"+testTokenHolder)
+	assert.Equal(200, res.Code)
+	assert.Equal("12345", reply["formatted"])
+	assert.Nil(reply["decimals"])
+	mockRPC.AssertExpectations(t)
+
+	// The route is not available when the balance is hidden
+	_, router, _ = newTestTokenREST2EthWithPolicy(abi, &contractregistry.MethodPolicy{Deny: []string{"balanceOf"}})
+	res, reply = getTokenRoute(router, "/contracts/"+testTokenAddress+"/erc20/balance/"+testTokenHolder)
+	assert.Equal(404, res.Code)
+	assert.Regexp("does not implement erc20", reply["error"])
+}
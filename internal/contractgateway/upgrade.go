@@ -0,0 +1,103 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// contractUpgrade is the body of a request to re-point a contract to the ABI of a new implementation
+type contractUpgrade struct {
+	ABI       string      `json:"abi"`
+	FromBlock json.Number `json:"fromBlock"`
+}
+
+// upgradeContract re-points a registered contract to the ABI of a new implementation, from a block
+// onwards. Subscriptions to the contract decode the events it emitted before that block with the
+// ABI it had at the time, and their filters are recreated to match the events of the new ABI
+func (g *smartContractGW) upgradeContract(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	_, _, info, err := g.resolveAddressOrName(params.ByName("address"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, lookupErrStatus(err))
+		return
+	}
+
+	var upgrade contractUpgrade
+	if err := json.NewDecoder(req.Body).Decode(&upgrade); err != nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayUpgradeInvalid, err), 400)
+		return
+	}
+	if upgrade.ABI == "" {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayUpgradeABIMissing), 400)
+		return
+	}
+	fromBlock, ok := new(big.Int).SetString(upgrade.FromBlock.String(), 10)
+	if !ok || fromBlock.Sign() < 0 {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayUpgradeInvalidBlock, upgrade.FromBlock), 400)
+		return
+	}
+
+	result, err := g.cs.GetABI(contractregistry.ABILocation{
+		ABIType: contractregistry.LocalABI,
+		Name:    upgrade.ABI,
+	}, false)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	if result == nil {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayLocalStoreABINotFound, upgrade.ABI), 404)
+		return
+	}
+	if result.Contract.Deleted != "" {
+		g.gatewayErrReply(res, req, errors.Errorf(errors.RESTGatewayABIDeleted, upgrade.ABI, result.Contract.Deleted), 410)
+		return
+	}
+
+	info, err = g.cs.UpgradeContract(info.Address, upgrade.ABI, fromBlock)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, upgradeErrStatus(err))
+		return
+	}
+	if g.sm != nil {
+		g.sm.ContractUpgraded(req.Context(), "0x"+info.Address)
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(info)
+}
+
+// upgradeErrStatus is the HTTP status for a failure to upgrade a contract, which is 400 if the
+// upgrade does not apply after the current ABI of the contract, or 500 if it could not be stored
+func upgradeErrStatus(err error) int {
+	if e, ok := err.(errors.EthconnectError); ok && e.Code() == errors.ContractRegistryUpgradeBlockNotAfter.Code() {
+		return 400
+	}
+	return 500
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractgateway
+
+import (
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUpgradeAddr = "123456789abcdef0123456789abcdef012345678"
+
+func TestUpgradeContract(t *testing.T) {
+	assert := assert.New(t)
+	scgw, mcs, router := newTestETagGateway()
+	sm := &mockSubMgr{}
+	scgw.sm = sm
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi2"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{},
+	}, nil)
+	mcs.On("UpgradeContract", testUpgradeAddr, "abi2", big.NewInt(100)).Return(&contractregistry.ContractInfo{
+		Address: testUpgradeAddr,
+		ABI:     "abi2",
+		ABIVersions: []*contractregistry.ABIVersion{
+			{ABI: "abi1", FromBlock: "0"},
+			{ABI: "abi2", FromBlock: "100"},
+		},
+	}, nil)
+
+	req := httptest.NewRequest("PUT", "/contracts/"+testUpgradeAddr+"/abi", strings.NewReader(`{"abi":"abi2","fromBlock":100}`))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Regexp(`"abiVersions"`, res.Body.String())
+	assert.Equal("0x"+testUpgradeAddr, sm.upgraded)
+	mcs.AssertExpectations(t)
+}
+
+func TestUpgradeContractErrors(t *testing.T) {
+	assert := assert.New(t)
+	scgw, mcs, router := newTestETagGateway()
+	mcs.On("GetContractByAddress", "unknown").Return(nil, fmt.Errorf("not found"))
+	mcs.On("ResolveContractAddress", "unknown").Return("", fmt.Errorf("not found"))
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "missing"}, false).Return(nil, fmt.Errorf("pop"))
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "nil"}, false).Return(nil, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "deleted"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{Deleted: "2021-01-01T00:00:00Z"},
+	}, nil)
+	mcs.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi2"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{},
+	}, nil)
+	mcs.On("UpgradeContract", testUpgradeAddr, "abi2", big.NewInt(10)).Return(nil, errors.Errorf(errors.ContractRegistryUpgradeBlockNotAfter, testUpgradeAddr, "100"))
+	mcs.On("UpgradeContract", testUpgradeAddr, "abi2", big.NewInt(200)).Return(nil, fmt.Errorf("pop"))
+	scgw.sm = nil
+
+	upgrade := func(addr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/contracts/"+addr+"/abi", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res := upgrade("unknown", `{"abi":"abi2","fromBlock":100}`)
+	assert.Equal(404, res.Code)
+	res = upgrade(testUpgradeAddr, `!json`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid contract upgrade", res.Body.String())
+	res = upgrade(testUpgradeAddr, `{"fromBlock":100}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Must supply the abi", res.Body.String())
+	res = upgrade(testUpgradeAddr, `{"abi":"abi2"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid fromBlock", res.Body.String())
+	res = upgrade(testUpgradeAddr, `{"abi":"abi2","fromBlock":-1}`)
+	assert.Equal(400, res.Code)
+	res = upgrade(testUpgradeAddr, `{"abi":"missing","fromBlock":100}`)
+	assert.Equal(404, res.Code)
+	res = upgrade(testUpgradeAddr, `{"abi":"nil","fromBlock":100}`)
+	assert.Equal(404, res.Code)
+	assert.Regexp("No ABI found with ID nil", res.Body.String())
+	res = upgrade(testUpgradeAddr, `{"abi":"deleted","fromBlock":100}`)
+	assert.Equal(410, res.Code)
+	res = upgrade(testUpgradeAddr, `{"abi":"abi2","fromBlock":"10"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("must apply from a block after 100", res.Body.String())
+	res = upgrade(testUpgradeAddr, `{"abi":"abi2","fromBlock":200}`)
+	assert.Equal(500, res.Code)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"math/big"
+	"time"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ABIVersion is an ABI that a contract was registered with, from a block onwards. A contract
+// that is upgraded behind a proxy keeps its address, so the events it emitted before the upgrade
+// must still be decoded with the ABI of the implementation at the time
+type ABIVersion struct {
+	ABI       string `json:"abi"`
+	FromBlock string `json:"fromBlock"`
+	Created   string `json:"created"`
+}
+
+// ABIAtBlock returns the ID of the ABI the contract was registered with at a block
+func (i *ContractInfo) ABIAtBlock(blockNumber *big.Int) string {
+	for idx := len(i.ABIVersions) - 1; idx >= 0; idx-- {
+		fromBlock, ok := new(big.Int).SetString(i.ABIVersions[idx].FromBlock, 10)
+		if ok && fromBlock.Cmp(blockNumber) <= 0 {
+			return i.ABIVersions[idx].ABI
+		}
+	}
+	return i.ABI
+}
+
+// ABIVersionIDs returns the IDs of every ABI the contract has been registered with
+func (i *ContractInfo) ABIVersionIDs() []string {
+	if len(i.ABIVersions) == 0 {
+		return []string{i.ABI}
+	}
+	ids := make([]string, len(i.ABIVersions))
+	for idx, v := range i.ABIVersions {
+		ids[idx] = v.ABI
+	}
+	return ids
+}
+
+// usesABI is true if the contract is registered with the ABI, as its current ABI or a facet,
+// or was before an upgrade, as the ABI is still needed to decode the events it emitted before the upgrade
+func (i *ContractInfo) usesABI(abiID string) bool {
+	if i.isFacet(abiID) {
+		return true
+	}
+	for _, id := range i.ABIVersionIDs() {
+		if id == abiID {
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeContract re-points a contract to the ABI of a new implementation, from a block onwards.
+// The ABI it was registered with before is kept in its version history, which starts from block
+// zero on the first upgrade
+func (cs *contractStore) UpgradeContract(addrHexNo0x, abiID string, fromBlock *big.Int) (*ContractInfo, error) {
+	existing, err := cs.getContract(addrHexNo0x)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(existing.ABIVersions); n > 0 {
+		current, _ := new(big.Int).SetString(existing.ABIVersions[n-1].FromBlock, 10)
+		if current != nil && fromBlock.Cmp(current) <= 0 {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractRegistryUpgradeBlockNotAfter, addrHexNo0x, existing.ABIVersions[n-1].FromBlock)
+		}
+	} else if fromBlock.Sign() <= 0 {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractRegistryUpgradeBlockNotAfter, addrHexNo0x, "0")
+	}
+	deployMsg, err := cs.loadDeployMsg(abiID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := cs.updateContractInfo(addrHexNo0x, func(info *ContractInfo) {
+		versions := make([]*ABIVersion, 0, len(info.ABIVersions)+2)
+		if len(info.ABIVersions) == 0 {
+			versions = append(versions, &ABIVersion{ABI: info.ABI, FromBlock: "0", Created: info.CreatedISO8601})
+		}
+		versions = append(versions, info.ABIVersions...)
+		info.ABIVersions = append(versions, &ABIVersion{
+			ABI:       abiID,
+			FromBlock: fromBlock.Text(10),
+			Created:   time.Now().UTC().Format(time.RFC3339),
+		})
+		info.ABI = abiID
+		info.Standards = DetectTokenStandards(deployMsg.ABI)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Upgraded contract %s to ABI %s from block %s", addrHexNo0x, abiID, fromBlock.Text(10))
+	return info, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestABIAtBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	info := &ContractInfo{ABI: "abi1"}
+	assert.Equal("abi1", info.ABIAtBlock(big.NewInt(100)))
+	assert.Equal([]string{"abi1"}, info.ABIVersionIDs())
+
+	info = &ContractInfo{
+		ABI: "abi3",
+		ABIVersions: []*ABIVersion{
+			{ABI: "abi1", FromBlock: "0"},
+			{ABI: "abi2", FromBlock: "100"},
+			{ABI: "abi3", FromBlock: "200"},
+		},
+	}
+	assert.Equal("abi1", info.ABIAtBlock(big.NewInt(0)))
+	assert.Equal("abi1", info.ABIAtBlock(big.NewInt(99)))
+	assert.Equal("abi2", info.ABIAtBlock(big.NewInt(100)))
+	assert.Equal("abi2", info.ABIAtBlock(big.NewInt(199)))
+	assert.Equal("abi3", info.ABIAtBlock(big.NewInt(200)))
+	assert.Equal([]string{"abi1", "abi2", "abi3"}, info.ABIVersionIDs())
+	assert.True(info.usesABI("abi1"))
+	assert.False(info.usesABI("abi4"))
+}
+
+func TestUpgradeContract(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	cs.StoreABI("abi1", &messages.DeployContract{})
+	cs.StoreABI("abi2", &messages.DeployContract{ABI: ethbinding.ABIMarshaling{
+		{Type: "function", Name: "balanceOf", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}}, Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "uint256"}}},
+	}})
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+
+	_, err = cs.UpgradeContract("0123456789abcdef0123456789abcdef01234567", "abi2", big.NewInt(0))
+	assert.Regexp("FFEC100362", err)
+	_, err = cs.UpgradeContract("0123456789abcdef0123456789abcdef01234567", "abi3", big.NewInt(100))
+	assert.Error(err)
+	_, err = cs.UpgradeContract("1123456789abcdef0123456789abcdef01234567", "abi2", big.NewInt(100))
+	assert.Regexp("No contract instance registered with address", err)
+
+	info, err := cs.UpgradeContract("0123456789abcdef0123456789abcdef01234567", "abi2", big.NewInt(100))
+	assert.NoError(err)
+	assert.Equal("abi2", info.ABI)
+	assert.Equal("c1", info.RegisteredAs)
+	assert.Equal(2, len(info.ABIVersions))
+	assert.Equal("abi1", info.ABIVersions[0].ABI)
+	assert.Equal("0", info.ABIVersions[0].FromBlock)
+	assert.Equal(info.CreatedISO8601, info.ABIVersions[0].Created)
+	assert.Equal("abi2", info.ABIVersions[1].ABI)
+	assert.Equal("100", info.ABIVersions[1].FromBlock)
+
+	_, err = cs.UpgradeContract("0123456789abcdef0123456789abcdef01234567", "abi1", big.NewInt(100))
+	assert.Regexp("must apply from a block after 100", err)
+	info, err = cs.UpgradeContract("0123456789abcdef0123456789abcdef01234567", "abi1", big.NewInt(200))
+	assert.NoError(err)
+	assert.Equal(3, len(info.ABIVersions))
+	cs.Close()
+
+	// The version history is persisted with the contract, and the name still resolves to it
+	cs = NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err = cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	info, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal("abi1", info.ABI)
+	assert.Equal("abi2", info.ABIAtBlock(big.NewInt(150)))
+	addr, err := cs.ResolveContractAddress("c1")
+	assert.NoError(err)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", addr)
+}
+
+func TestDeleteABIUsedByPreviousVersion(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	for _, id := range []string{"abi1", "abi2"} {
+		_, err = cs.AddABI(id, &messages.DeployContract{}, time.Now())
+		assert.NoError(err)
+		cs.StoreABI(id, &messages.DeployContract{})
+	}
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+	_, err = cs.UpgradeContract("0123456789abcdef0123456789abcdef01234567", "abi2", big.NewInt(100))
+	assert.NoError(err)
+
+	// The previous ABI is still needed to decode the events from before the upgrade
+	_, err = cs.DeleteABI("abi1")
+	assert.Regexp("FFEC100283", err)
+}
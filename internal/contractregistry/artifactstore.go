@@ -0,0 +1,124 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"time"
+)
+
+// ArtifactType is the kind of artifact persisted by the local contract registry
+type ArtifactType int
+
+const (
+	// ContractInstanceArtifact is the JSON ContractInfo for a contract instance, keyed by address
+	ContractInstanceArtifact ArtifactType = iota
+	// ABIDeployArtifact is the JSON DeployContract message for an ABI, keyed by ABI ID
+	ABIDeployArtifact
+	// LegacySwaggerArtifact is a pre-instance-file Swagger definition, keyed by address. Only read for migration
+	LegacySwaggerArtifact
+)
+
+// ArtifactEntry is returned when listing artifacts
+type ArtifactEntry struct {
+	ID       string
+	Modified time.Time
+}
+
+// ArtifactStore is the persistence layer behind the local contract registry.
+// The default implementation is a directory on the local filesystem, but
+// alternative backends can be plugged in without changing the registry logic.
+type ArtifactStore interface {
+	Get(artifactType ArtifactType, id string) ([]byte, error)
+	Put(artifactType ArtifactType, id string, data []byte) error
+	List(artifactType ArtifactType) ([]*ArtifactEntry, error)
+	Delete(artifactType ArtifactType, id string) error
+}
+
+type artifactFileFormat struct {
+	prefix  string
+	suffix  string
+	matcher *regexp.Regexp
+}
+
+var artifactFileFormats = map[ArtifactType]*artifactFileFormat{
+	ContractInstanceArtifact: {
+		prefix:  "contract_",
+		suffix:  ".instance.json",
+		matcher: regexp.MustCompile(`^contract_([0-9a-z]{40})\.instance\.json$`),
+	},
+	ABIDeployArtifact: {
+		prefix:  "abi_",
+		suffix:  ".deploy.json",
+		matcher: regexp.MustCompile(`^abi_([0-9a-z-]+)\.deploy.json$`),
+	},
+	LegacySwaggerArtifact: {
+		prefix:  "contract_",
+		suffix:  ".swagger.json",
+		matcher: regexp.MustCompile(`^contract_([0-9a-z]{40})\.swagger\.json$`),
+	},
+}
+
+func (f *artifactFileFormat) name(id string) string {
+	return f.prefix + id + f.suffix
+}
+
+type fsArtifactStore struct {
+	storagePath string
+}
+
+// NewFSArtifactStore constructs an artifact store backed by files in a single directory
+func NewFSArtifactStore(storagePath string) ArtifactStore {
+	return &fsArtifactStore{
+		storagePath: storagePath,
+	}
+}
+
+func (fs *fsArtifactStore) fileName(artifactType ArtifactType, id string) string {
+	return path.Join(fs.storagePath, artifactFileFormats[artifactType].name(id))
+}
+
+func (fs *fsArtifactStore) Get(artifactType ArtifactType, id string) ([]byte, error) {
+	return ioutil.ReadFile(fs.fileName(artifactType, id))
+}
+
+func (fs *fsArtifactStore) Put(artifactType ArtifactType, id string, data []byte) error {
+	return ioutil.WriteFile(fs.fileName(artifactType, id), data, 0664)
+}
+
+func (fs *fsArtifactStore) List(artifactType ArtifactType) ([]*ArtifactEntry, error) {
+	files, err := ioutil.ReadDir(fs.storagePath)
+	if err != nil {
+		return nil, err
+	}
+	matcher := artifactFileFormats[artifactType].matcher
+	entries := make([]*ArtifactEntry, 0, len(files))
+	for _, file := range files {
+		if groups := matcher.FindStringSubmatch(file.Name()); groups != nil {
+			entries = append(entries, &ArtifactEntry{
+				ID:       groups[1],
+				Modified: file.ModTime(),
+			})
+		}
+	}
+	return entries, nil
+}
+
+func (fs *fsArtifactStore) Delete(artifactType ArtifactType, id string) error {
+	return os.Remove(fs.fileName(artifactType, id))
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSArtifactStorePutGetListDelete(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	store := NewFSArtifactStore(dir)
+	addr := "0123456789abcdef0123456789abcdef01234567"
+	err := store.Put(ContractInstanceArtifact, addr, []byte(`{"address":"`+addr+`"}`))
+	assert.NoError(err)
+	err = store.Put(ABIDeployArtifact, "840b629f-2e46-413b-9671-553a886ca7bb", []byte(`{}`))
+	assert.NoError(err)
+	ioutil.WriteFile(path.Join(dir, "unrelated.json"), []byte(`{}`), 0644)
+
+	_, err = ioutil.ReadFile(path.Join(dir, "contract_"+addr+".instance.json"))
+	assert.NoError(err)
+
+	data, err := store.Get(ContractInstanceArtifact, addr)
+	assert.NoError(err)
+	assert.Equal(`{"address":"`+addr+`"}`, string(data))
+
+	entries, err := store.List(ContractInstanceArtifact)
+	assert.NoError(err)
+	assert.Equal(1, len(entries))
+	assert.Equal(addr, entries[0].ID)
+	assert.False(entries[0].Modified.IsZero())
+
+	entries, err = store.List(ABIDeployArtifact)
+	assert.NoError(err)
+	assert.Equal(1, len(entries))
+	assert.Equal("840b629f-2e46-413b-9671-553a886ca7bb", entries[0].ID)
+
+	entries, err = store.List(LegacySwaggerArtifact)
+	assert.NoError(err)
+	assert.Empty(entries)
+
+	err = store.Delete(ContractInstanceArtifact, addr)
+	assert.NoError(err)
+	_, err = store.Get(ContractInstanceArtifact, addr)
+	assert.Error(err)
+}
+
+func TestFSArtifactStoreListBadDir(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	store := NewFSArtifactStore(path.Join(dir, "badpath"))
+	_, err := store.List(ABIDeployArtifact)
+	assert.Error(err)
+}
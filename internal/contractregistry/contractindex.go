@@ -0,0 +1,160 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+// ContractIndex is the queryable index of contract instances, their registered
+// friendly names, and ABIs, for the local contract registry.
+// The default index is held in memory, and built from the artifact store on startup.
+// A database index can instead be shared by multiple gateway instances.
+// The Get functions return nil without an error if the entry is not found.
+type ContractIndex interface {
+	Init() error
+	Close()
+	IsEmpty() (bool, error)
+	AddContract(info *ContractInfo) error
+	UpdateContract(info *ContractInfo) error
+	GetContract(address string) (*ContractInfo, error)
+	GetRegistration(name string) (*ContractInfo, error)
+	ListContracts() ([]*ContractInfo, error)
+	DeleteContract(info *ContractInfo) error
+	AddABI(info *ABIInfo) error
+	GetABI(id string) (*ABIInfo, error)
+	ListABIs() ([]*ABIInfo, error)
+	DeleteABI(id string) error
+}
+
+type memoryContractIndex struct {
+	lock          sync.Mutex
+	contracts     map[string]*ContractInfo
+	registrations map[string]*ContractInfo
+	abis          map[string]*ABIInfo
+}
+
+func newMemoryContractIndex() ContractIndex {
+	return &memoryContractIndex{
+		contracts:     make(map[string]*ContractInfo),
+		registrations: make(map[string]*ContractInfo),
+		abis:          make(map[string]*ABIInfo),
+	}
+}
+
+func (m *memoryContractIndex) Init() error {
+	return nil
+}
+
+func (m *memoryContractIndex) Close() {}
+
+func (m *memoryContractIndex) IsEmpty() (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.contracts) == 0 && len(m.abis) == 0, nil
+}
+
+func (m *memoryContractIndex) AddContract(info *ContractInfo) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if info.RegisteredAs != "" {
+		// Protect against overwrite
+		if existing, exists := m.registrations[info.RegisteredAs]; exists {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFriendlyNameClash, existing.Address, info.RegisteredAs)
+		}
+		log.Infof("Registering %s as '%s'", info.Address, info.RegisteredAs)
+		m.registrations[info.RegisteredAs] = info
+	}
+	m.contracts[info.Address] = info
+	return nil
+}
+
+// UpdateContract replaces the entry for a contract that has already been added, keeping its registration
+func (m *memoryContractIndex) UpdateContract(info *ContractInfo) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if info.RegisteredAs != "" {
+		m.registrations[info.RegisteredAs] = info
+	}
+	m.contracts[info.Address] = info
+	return nil
+}
+
+func (m *memoryContractIndex) GetContract(address string) (*ContractInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.contracts[address], nil
+}
+
+func (m *memoryContractIndex) GetRegistration(name string) (*ContractInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.registrations[name], nil
+}
+
+func (m *memoryContractIndex) ListContracts() ([]*ContractInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	retval := make([]*ContractInfo, 0, len(m.contracts))
+	for _, info := range m.contracts {
+		retval = append(retval, info)
+	}
+	return retval, nil
+}
+
+// DeleteContract removes a contract, and releases its registered name
+func (m *memoryContractIndex) DeleteContract(info *ContractInfo) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if info.RegisteredAs != "" {
+		delete(m.registrations, info.RegisteredAs)
+	}
+	delete(m.contracts, info.Address)
+	return nil
+}
+
+func (m *memoryContractIndex) AddABI(info *ABIInfo) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.abis[info.ID] = info
+	return nil
+}
+
+func (m *memoryContractIndex) GetABI(id string) (*ABIInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.abis[id], nil
+}
+
+func (m *memoryContractIndex) ListABIs() ([]*ABIInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	retval := make([]*ABIInfo, 0, len(m.abis))
+	for _, info := range m.abis {
+		retval = append(retval, info)
+	}
+	return retval, nil
+}
+
+func (m *memoryContractIndex) DeleteABI(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.abis, id)
+	return nil
+}
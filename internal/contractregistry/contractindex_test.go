@@ -0,0 +1,74 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryContractIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	idx := newMemoryContractIndex()
+	assert.NoError(idx.Init())
+	defer idx.Close()
+	empty, err := idx.IsEmpty()
+	assert.NoError(err)
+	assert.True(empty)
+
+	err = idx.AddContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1"})
+	assert.NoError(err)
+	err = idx.AddContract(&ContractInfo{Address: "addr2", RegisteredAs: "name1"})
+	assert.Regexp("Contract address addr1 is already registered for name 'name1'", err)
+	err = idx.UpdateContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1", MethodPolicy: &MethodPolicy{Allow: []string{"get"}}})
+	assert.NoError(err)
+	err = idx.AddABI(&ABIInfo{ID: "abi1"})
+	assert.NoError(err)
+
+	empty, err = idx.IsEmpty()
+	assert.NoError(err)
+	assert.False(empty)
+
+	info, err := idx.GetRegistration("name1")
+	assert.NoError(err)
+	assert.Equal("addr1", info.Address)
+	assert.Equal([]string{"get"}, info.MethodPolicy.Allow)
+	info, err = idx.GetContract("addr2")
+	assert.NoError(err)
+	assert.Nil(info)
+	contracts, err := idx.ListContracts()
+	assert.NoError(err)
+	assert.Equal(1, len(contracts))
+
+	abiInfo, err := idx.GetABI("abi1")
+	assert.NoError(err)
+	assert.Equal("abi1", abiInfo.ID)
+	abis, err := idx.ListABIs()
+	assert.NoError(err)
+	assert.Equal(1, len(abis))
+
+	err = idx.DeleteContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1"})
+	assert.NoError(err)
+	info, err = idx.GetRegistration("name1")
+	assert.NoError(err)
+	assert.Nil(info)
+	err = idx.DeleteABI("abi1")
+	assert.NoError(err)
+	empty, err = idx.IsEmpty()
+	assert.NoError(err)
+	assert.True(empty)
+}
@@ -15,16 +15,10 @@
 package contractregistry
 
 import (
-	"bufio"
 	"encoding/json"
-	"io/ioutil"
+	"math/big"
 	"net/url"
-	"os"
-	"path"
-	"regexp"
-	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-openapi/spec"
@@ -51,36 +45,56 @@ type ContractStore interface {
 	ContractResolver
 	Init() error
 	Close()
-	AddContract(addrHexNo0x, abiID, pathName, registerAs string) (*ContractInfo, error)
-	AddABI(id string, deployMsg *messages.DeployContract, createdTime time.Time) *ABIInfo
+	AddContract(addrHexNo0x, abiID, pathName, registerAs string, opts *RegistrationOptions) (*ContractInfo, error)
+	SetMethodPolicy(addrHexNo0x string, policy *MethodPolicy) (*ContractInfo, error)
+	SetParamDefaults(addrHexNo0x string, defaults map[string]string) (*ContractInfo, error)
+	SetProject(addrHexNo0x, project string) (*ContractInfo, error)
+	UpgradeContract(addrHexNo0x, abiID string, fromBlock *big.Int) (*ContractInfo, error)
+	AddFacet(addrHexNo0x, abiID string) (*ContractInfo, error)
+	RemoveFacet(addrHexNo0x, abiID string) (*ContractInfo, error)
+	AddABI(id string, deployMsg *messages.DeployContract, createdTime time.Time) (*ABIInfo, error)
+	StoreABI(id string, deployMsg *messages.DeployContract) error
 	AddRemoteInstance(lookupStr, address string) error
 	GetLocalABIInfo(abiID string) (*ABIInfo, error)
-	ListContracts() []messages.TimeSortable
-	ListABIs() []messages.TimeSortable
+	ListContracts(opts *ListOptions) ([]messages.TimeSortable, int, error)
+	ListABIs(opts *ListOptions) ([]messages.TimeSortable, int, error)
+	ListProjects() ([]*ProjectInfo, error)
+	DeleteContract(addrHexOrName string) (*ContractInfo, error)
+	RestoreContract(addrHexOrName string) (*ContractInfo, error)
+	DeleteABI(abiID string) (*ABIInfo, error)
+	RestoreABI(abiID string) (*ABIInfo, error)
 }
 
 type ContractStoreConf struct {
-	StoragePath string `json:"storagePath"`
-	BaseURL     string `json:"baseURL"`
+	StoragePath string              `json:"storagePath"`
+	BaseURL     string              `json:"baseURL"`
+	Store       string              `json:"store,omitempty"`
+	S3          S3ArtifactStoreConf `json:"s3,omitempty"`
+	PostgreSQL  PostgreSQLIndexConf `json:"postgresql,omitempty"`
+	IndexDBPath string              `json:"indexDBPath,omitempty"`
+	// PurgeDeletedAfterSec is how long deleted contracts and ABIs are kept for, so they can be restored.
+	// Zero keeps them forever
+	PurgeDeletedAfterSec int `json:"purgeDeletedAfterSec,omitempty"`
 }
 
 type contractStore struct {
-	conf                  *ContractStoreConf
-	rr                    RemoteRegistry
-	contractIndex         map[string]messages.TimeSortable
-	contractRegistrations map[string]*ContractInfo
-	idxLock               sync.Mutex
-	abiIndex              map[string]messages.TimeSortable
-	abiCache              *lru.Cache
+	conf          *ContractStoreConf
+	rr            RemoteRegistry
+	storage       ArtifactStore
+	index         ContractIndex
+	abiCache      *lru.Cache
+	purgeInterval time.Duration
+	purgeStop     chan struct{}
+	purgeDone     chan struct{}
 }
 
 func NewContractStore(conf *ContractStoreConf, rr RemoteRegistry) ContractStore {
 	return &contractStore{
-		conf:                  conf,
-		rr:                    rr,
-		contractIndex:         make(map[string]messages.TimeSortable),
-		contractRegistrations: make(map[string]*ContractInfo),
-		abiIndex:              make(map[string]messages.TimeSortable),
+		conf:          conf,
+		rr:            rr,
+		storage:       NewFSArtifactStore(conf.StoragePath),
+		index:         newMemoryContractIndex(),
+		purgeInterval: defaultPurgeInterval,
 	}
 }
 
@@ -88,23 +102,47 @@ func NewContractStore(conf *ContractStoreConf, rr RemoteRegistry) ContractStore
 // ONLY used for local registry. Remote registry handles its own storage/caching
 type ContractInfo struct {
 	messages.TimeSorted
-	Address      string `json:"address"`
-	Path         string `json:"path"`
-	ABI          string `json:"abi"`
-	SwaggerURL   string `json:"openapi"`
-	RegisteredAs string `json:"registeredAs"`
+	Address       string            `json:"address"`
+	Path          string            `json:"path"`
+	ABI           string            `json:"abi"`
+	SwaggerURL    string            `json:"openapi"`
+	RegisteredAs  string            `json:"registeredAs"`
+	Standards     []string          `json:"standards,omitempty"`
+	MethodPolicy  *MethodPolicy     `json:"methodPolicy,omitempty"`
+	ParamDefaults map[string]string `json:"paramDefaults,omitempty"`
+	Decimals      map[string]int    `json:"decimals,omitempty"`
+	Guards        []*MethodGuard    `json:"guards,omitempty"`
+	ABIVersions   []*ABIVersion     `json:"abiVersions,omitempty"`
+	Facets        []string          `json:"facets,omitempty"`
+	Project       string            `json:"project,omitempty"`
+	Deleted       string            `json:"deleted,omitempty"`
 }
 
 // ABIInfo is the minimal data structure we keep in memory, indexed by our own UUID
 type ABIInfo struct {
 	messages.TimeSorted
-	ID              string `json:"id"`
-	Name            string `json:"name"`
-	Description     string `json:"description"`
-	Path            string `json:"path"`
-	Deployable      bool   `json:"deployable"`
-	SwaggerURL      string `json:"openapi"`
-	CompilerVersion string `json:"compilerVersion"`
+	ID               string                     `json:"id"`
+	Name             string                     `json:"name"`
+	Description      string                     `json:"description"`
+	Path             string                     `json:"path"`
+	Deployable       bool                       `json:"deployable"`
+	SwaggerURL       string                     `json:"openapi"`
+	CompilerVersion  string                     `json:"compilerVersion"`
+	CompilerSettings *messages.CompilerSettings `json:"compilerSettings,omitempty"`
+	Project          string                     `json:"project,omitempty"`
+	Deleted          string                     `json:"deleted,omitempty"`
+}
+
+// RegistrationOptions are the optional settings of a contract that are stored with its registration,
+// so a contract is never left registered without them
+type RegistrationOptions struct {
+	ParamDefaults map[string]string
+	// Decimals declares the token decimals of amount parameters, keyed by parameter name or method.parameter
+	Decimals map[string]int
+	// Guards are checked on-chain before a transaction is submitted to the contract
+	Guards []*MethodGuard
+	// Project replaces the project inherited from the ABI, if set
+	Project string
 }
 
 func (i *ContractInfo) GetID() string {
@@ -140,7 +178,7 @@ func IsRemote(msg messages.CommonHeaders) bool {
 	return false
 }
 
-func (cs *contractStore) AddContract(addrHexNo0x, abiID, pathName, registerAs string) (*ContractInfo, error) {
+func (cs *contractStore) AddContract(addrHexNo0x, abiID, pathName, registerAs string, opts *RegistrationOptions) (*ContractInfo, error) {
 	contractInfo := &ContractInfo{
 		Address:      addrHexNo0x,
 		ABI:          abiID,
@@ -151,20 +189,112 @@ func (cs *contractStore) AddContract(addrHexNo0x, abiID, pathName, registerAs st
 			CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
 		},
 	}
+	// Detect the token standards implemented by the contract, for the token routes.
+	// The contract is grouped in the same project as its ABI, unless it is changed later
+	if deployMsg, err := cs.loadDeployMsg(abiID); err == nil {
+		contractInfo.Standards = DetectTokenStandards(deployMsg.ABI)
+		contractInfo.Project = deployMsg.Project
+	}
+	if opts != nil {
+		if len(opts.ParamDefaults) > 0 {
+			contractInfo.ParamDefaults = opts.ParamDefaults
+		}
+		if len(opts.Decimals) > 0 {
+			contractInfo.Decimals = opts.Decimals
+		}
+		if len(opts.Guards) > 0 {
+			contractInfo.Guards = opts.Guards
+		}
+		if opts.Project != "" {
+			contractInfo.Project = opts.Project
+		}
+	}
 	if err := cs.storeContractInfo(contractInfo); err != nil {
 		return nil, err
 	}
 	return contractInfo, nil
 }
 
+// SetMethodPolicy replaces the method policy of a contract. A nil policy removes all restrictions
+func (cs *contractStore) SetMethodPolicy(addrHexNo0x string, policy *MethodPolicy) (*ContractInfo, error) {
+	return cs.updateContractInfo(addrHexNo0x, func(info *ContractInfo) {
+		if policy.IsEmpty() {
+			policy = nil
+		}
+		info.MethodPolicy = policy
+	})
+}
+
+// SetParamDefaults replaces the default values of the special REST parameters (such as 'from' or 'gas')
+// applied to requests for a contract. Empty defaults remove them
+func (cs *contractStore) SetParamDefaults(addrHexNo0x string, defaults map[string]string) (*ContractInfo, error) {
+	return cs.updateContractInfo(addrHexNo0x, func(info *ContractInfo) {
+		if len(defaults) == 0 {
+			defaults = nil
+		}
+		info.ParamDefaults = defaults
+	})
+}
+
+// SetProject moves a contract to a different project. An empty project removes it from its project
+func (cs *contractStore) SetProject(addrHexNo0x, project string) (*ContractInfo, error) {
+	return cs.updateContractInfo(addrHexNo0x, func(info *ContractInfo) {
+		info.Project = project
+	})
+}
+
+func (cs *contractStore) updateContractInfo(addrHexNo0x string, update func(info *ContractInfo)) (*ContractInfo, error) {
+	existing, err := cs.getContract(addrHexNo0x)
+	if err != nil {
+		return nil, err
+	}
+	// The index may hold the existing entry in memory, so it is updated with a copy
+	contractInfo := *existing
+	update(&contractInfo)
+	if err := cs.index.UpdateContract(&contractInfo); err != nil {
+		return nil, err
+	}
+	if err := cs.putContractInfo(&contractInfo); err != nil {
+		return nil, err
+	}
+	return &contractInfo, nil
+}
+
+// storeContractInfo adds the contract to the index, which reserves its registered name, and then
+// stores the contract instance. If the instance cannot be stored the index is rolled back, so a
+// failed registration does not leave a name reserved that is lost on restart
 func (cs *contractStore) storeContractInfo(info *ContractInfo) error {
-	if err := cs.addToContractIndex(info); err != nil {
+	previous, err := cs.index.GetContract(info.Address)
+	if err != nil {
 		return err
 	}
-	infoFile := path.Join(cs.conf.StoragePath, "contract_"+info.Address+".instance.json")
+	if err := cs.index.AddContract(info); err != nil {
+		return err
+	}
+	if err := cs.putContractInfo(info); err != nil {
+		cs.rollbackContractInfo(info, previous)
+		return err
+	}
+	return nil
+}
+
+// rollbackContractInfo restores the index entry for a contract that was replaced, or removes a new one
+func (cs *contractStore) rollbackContractInfo(info, previous *ContractInfo) {
+	var err error
+	if previous != nil {
+		err = cs.index.UpdateContract(previous)
+	} else {
+		err = cs.index.DeleteContract(info)
+	}
+	if err != nil {
+		log.Errorf("Failed to roll back the contract index for %s: %s", info.Address, err)
+	}
+}
+
+func (cs *contractStore) putContractInfo(info *ContractInfo) error {
 	instanceBytes, _ := json.MarshalIndent(info, "", "  ")
-	log.Infof("%s: Storing contract instance JSON to '%s'", info.ABI, infoFile)
-	if err := ioutil.WriteFile(infoFile, instanceBytes, 0664); err != nil {
+	log.Infof("%s: Storing contract instance JSON for '%s'", info.ABI, info.Address)
+	if err := cs.storage.Put(ContractInstanceArtifact, info.Address, instanceBytes); err != nil {
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractSave, err)
 	}
 	return nil
@@ -172,21 +302,42 @@ func (cs *contractStore) storeContractInfo(info *ContractInfo) error {
 
 func (cs *contractStore) ResolveContractAddress(registeredName string) (string, error) {
 	nameUnescaped, _ := url.QueryUnescape(registeredName)
-	info, exists := cs.contractRegistrations[nameUnescaped]
-	if !exists {
+	info, err := cs.index.GetRegistration(nameUnescaped)
+	if err != nil {
+		return "", err
+	}
+	if info == nil {
 		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractLoad, registeredName)
 	}
+	if info.Deleted != "" {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayContractDeleted, registeredName, info.Deleted)
+	}
 	log.Infof("%s -> 0x%s", registeredName, info.Address)
 	return info.Address, nil
 }
 
-func (cs *contractStore) GetContractByAddress(addrHex string) (*ContractInfo, error) {
+// getContract returns a contract from the index, including one that has been deleted
+func (cs *contractStore) getContract(addrHex string) (*ContractInfo, error) {
 	addrHexNo0x := strings.TrimPrefix(strings.ToLower(addrHex), "0x")
-	info, exists := cs.contractIndex[addrHexNo0x]
-	if !exists {
+	info, err := cs.index.GetContract(addrHexNo0x)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
 		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x)
 	}
-	return info.(*ContractInfo), nil
+	return info, nil
+}
+
+func (cs *contractStore) GetContractByAddress(addrHex string) (*ContractInfo, error) {
+	info, err := cs.getContract(addrHex)
+	if err != nil {
+		return nil, err
+	}
+	if info.Deleted != "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayContractDeleted, info.Address, info.Deleted)
+	}
+	return info, nil
 }
 
 func (cs *contractStore) GetABI(location ABILocation, refresh bool) (deployMsg *DeployContractWithAddress, err error) {
@@ -223,8 +374,9 @@ func (cs *contractStore) GetABI(location ABILocation, refresh bool) (deployMsg *
 	return deployMsg, nil
 }
 
+// getLocalABI also loads deleted ABIs, as existing event subscriptions continue to use them
 func (cs *contractStore) getLocalABI(abiID string) (*messages.DeployContract, *ABIInfo, error) {
-	info, err := cs.GetLocalABIInfo(abiID)
+	info, err := cs.getABIInfo(abiID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -237,18 +389,42 @@ func (cs *contractStore) getLocalABI(abiID string) (*messages.DeployContract, *A
 	return msg, info, nil
 }
 
-func (cs *contractStore) GetLocalABIInfo(abiID string) (*ABIInfo, error) {
-	ts, exists := cs.abiIndex[abiID]
-	if !exists {
+// getABIInfo returns an ABI from the index, including one that has been deleted
+func (cs *contractStore) getABIInfo(abiID string) (*ABIInfo, error) {
+	info, err := cs.index.GetABI(abiID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
 		log.Infof("ABI with ID %s not found locally", abiID)
 		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABINotFound, abiID)
 	}
-	return ts.(*ABIInfo), nil
+	return info, nil
+}
+
+func (cs *contractStore) GetLocalABIInfo(abiID string) (*ABIInfo, error) {
+	info, err := cs.getABIInfo(abiID)
+	if err != nil {
+		return nil, err
+	}
+	if info.Deleted != "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayABIDeleted, abiID, info.Deleted)
+	}
+	return info, nil
+}
+
+// StoreABI persists the full deployment message for an ABI, so it can be reloaded on restart
+func (cs *contractStore) StoreABI(id string, deployMsg *messages.DeployContract) error {
+	deployBytes, _ := json.MarshalIndent(deployMsg, "", "  ")
+	log.Infof("%s: Stashing deployment details", id)
+	if err := cs.storage.Put(ABIDeployArtifact, id, deployBytes); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractSavePostDeploy, id, err)
+	}
+	return nil
 }
 
 func (cs *contractStore) loadDeployMsg(abiID string) (*messages.DeployContract, error) {
-	deployFile := path.Join(cs.conf.StoragePath, "abi_"+abiID+".deploy.json")
-	deployBytes, err := ioutil.ReadFile(deployFile)
+	deployBytes, err := cs.storage.Get(ABIDeployArtifact, abiID)
 	if err != nil {
 		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABILoad, abiID, err)
 	}
@@ -261,57 +437,99 @@ func (cs *contractStore) loadDeployMsg(abiID string) (*messages.DeployContract,
 
 func (cs *contractStore) buildIndex() {
 	log.Infof("Building installed smart contract index")
-	legacyContractMatcher, _ := regexp.Compile(`^contract_([0-9a-z]{40})\.swagger\.json$`)
-	instanceMatcher, _ := regexp.Compile(`^contract_([0-9a-z]{40})\.instance\.json$`)
-	abiMatcher, _ := regexp.Compile(`^abi_([0-9a-z-]+)\.deploy.json$`)
-	files, err := ioutil.ReadDir(cs.conf.StoragePath)
+	// The instance list is read before migrating legacy contracts, as migration creates new instances
+	instances, err := cs.storage.List(ContractInstanceArtifact)
 	if err != nil {
-		log.Errorf("Failed to read directory %s: %s", cs.conf.StoragePath, err)
+		log.Errorf("Failed to list contract instances in %s: %s", cs.storeLocation(), err)
 		return
 	}
-	for _, file := range files {
-		fileName := file.Name()
-		legacyContractGroups := legacyContractMatcher.FindStringSubmatch(fileName)
-		abiGroups := abiMatcher.FindStringSubmatch(fileName)
-		instanceGroups := instanceMatcher.FindStringSubmatch(fileName)
-		if legacyContractGroups != nil {
-			cs.migrateLegacyContract(legacyContractGroups[1], path.Join(cs.conf.StoragePath, fileName), file.ModTime())
-		} else if instanceGroups != nil {
-			cs.addFileToContractIndex(instanceGroups[1], path.Join(cs.conf.StoragePath, fileName))
-		} else if abiGroups != nil {
-			cs.addFileToABIIndex(abiGroups[1], path.Join(cs.conf.StoragePath, fileName), file.ModTime())
-		}
+	legacyContracts, err := cs.storage.List(LegacySwaggerArtifact)
+	if err != nil {
+		log.Errorf("Failed to list legacy contracts in %s: %s", cs.storeLocation(), err)
+		return
+	}
+	abis, err := cs.storage.List(ABIDeployArtifact)
+	if err != nil {
+		log.Errorf("Failed to list ABIs in %s: %s", cs.storeLocation(), err)
+		return
+	}
+	for _, entry := range instances {
+		cs.loadContractInstance(entry.ID)
+	}
+	for _, entry := range legacyContracts {
+		cs.migrateLegacyContract(entry.ID, entry.Modified)
+	}
+	for _, entry := range abis {
+		cs.loadABIDeployMsg(entry.ID, entry.Modified)
 	}
-	log.Infof("Smart contract index built. %d entries", len(cs.contractIndex))
+	log.Infof("Smart contract index built. %d entries", len(instances)+len(legacyContracts))
 }
 
 func (cs *contractStore) Init() (err error) {
 	if cs.abiCache, err = lru.New(DefaultABICacheSize); err != nil {
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayResourceErr, err)
 	}
-	cs.buildIndex()
+	if cs.conf.Store != "" {
+		// An object store URL replaces the local storage path
+		if cs.storage, err = NewS3ArtifactStore(cs.conf.Store, &cs.conf.S3); err != nil {
+			return err
+		}
+	}
+	if cs.conf.PostgreSQL.DSN != "" {
+		cs.index = newPostgreSQLContractIndex(&cs.conf.PostgreSQL)
+	} else if cs.conf.IndexDBPath != "" {
+		cs.index = newLevelDBContractIndex(cs.conf.IndexDBPath)
+	}
+	if err = cs.index.Init(); err != nil {
+		return err
+	}
+	// A persistent index is only built from the artifacts the first time it is used
+	empty, err := cs.index.IsEmpty()
+	if err != nil {
+		return err
+	}
+	if empty {
+		cs.buildIndex()
+	}
+	if cs.conf.PurgeDeletedAfterSec > 0 {
+		cs.purgeStop = make(chan struct{})
+		cs.purgeDone = make(chan struct{})
+		go cs.purgeLoop()
+	}
 	return cs.rr.Init()
 }
 
+func (cs *contractStore) storeLocation() string {
+	if cs.conf.Store != "" {
+		return cs.conf.Store
+	}
+	return cs.conf.StoragePath
+}
+
 func (cs *contractStore) Close() {
+	if cs.purgeStop != nil {
+		close(cs.purgeStop)
+		<-cs.purgeDone
+		cs.purgeStop = nil
+	}
+	cs.index.Close()
 	cs.rr.Close()
 }
 
-func (cs *contractStore) migrateLegacyContract(address, fileName string, createdTime time.Time) {
-	swaggerFile, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+func (cs *contractStore) migrateLegacyContract(address string, createdTime time.Time) {
+	swaggerBytes, err := cs.storage.Get(LegacySwaggerArtifact, address)
 	if err != nil {
-		log.Errorf("Failed to load Swagger file %s: %s", fileName, err)
+		log.Errorf("Failed to load Swagger for %s: %s", address, err)
 		return
 	}
-	defer swaggerFile.Close()
 	var swagger spec.Swagger
-	err = json.NewDecoder(bufio.NewReader(swaggerFile)).Decode(&swagger)
+	err = json.Unmarshal(swaggerBytes, &swagger)
 	if err != nil {
-		log.Errorf("Failed to parse Swagger file %s: %s", fileName, err)
+		log.Errorf("Failed to parse Swagger for %s: %s", address, err)
 		return
 	}
 	if swagger.Info == nil {
-		log.Errorf("Failed to migrate invalid Swagger file %s", fileName)
+		log.Errorf("Failed to migrate invalid Swagger for %s", address)
 		return
 	}
 	var registeredAs string
@@ -319,55 +537,55 @@ func (cs *contractStore) migrateLegacyContract(address, fileName string, created
 		registeredAs = ext.(string)
 	}
 	if ext, exists := swagger.Info.Extensions["x-firefly-deployment-id"]; exists {
-		_, err := cs.AddContract(address, ext.(string), address, registeredAs)
+		_, err := cs.AddContract(address, ext.(string), address, registeredAs, nil)
 		if err != nil {
 			log.Errorf("Failed to write migrated instance file: %s", err)
 			return
 		}
 
-		if err := os.Remove(fileName); err != nil {
-			log.Errorf("Failed to clean-up migrated file %s: %s", fileName, err)
+		if err := cs.storage.Delete(LegacySwaggerArtifact, address); err != nil {
+			log.Errorf("Failed to clean-up migrated Swagger for %s: %s", address, err)
 		}
 
 	} else {
-		log.Warnf("Swagger cannot be migrated due to missing 'x-firefly-deployment-id' extension: %s", fileName)
+		log.Warnf("Swagger cannot be migrated due to missing 'x-firefly-deployment-id' extension: %s", address)
 	}
 
 }
 
-func (cs *contractStore) addFileToContractIndex(address, fileName string) {
-	contractFile, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+func (cs *contractStore) loadContractInstance(address string) {
+	contractBytes, err := cs.storage.Get(ContractInstanceArtifact, address)
 	if err != nil {
-		log.Errorf("Failed to load contract instance file %s: %s", fileName, err)
+		log.Errorf("Failed to load contract instance %s: %s", address, err)
 		return
 	}
-	defer contractFile.Close()
 	var contractInfo ContractInfo
-	err = json.NewDecoder(bufio.NewReader(contractFile)).Decode(&contractInfo)
+	err = json.Unmarshal(contractBytes, &contractInfo)
 	if err != nil {
-		log.Errorf("Failed to parse contract instance deployment file %s: %s", fileName, err)
+		log.Errorf("Failed to parse contract instance %s: %s", address, err)
 		return
 	}
-	err = cs.addToContractIndex(&contractInfo)
+	err = cs.index.AddContract(&contractInfo)
 	if err != nil {
-		log.Errorf("Failed to add to contract index %s: %s", fileName, err)
+		log.Errorf("Failed to add to contract index %s: %s", address, err)
 	}
 }
 
-func (cs *contractStore) addFileToABIIndex(id, fileName string, createdTime time.Time) {
-	deployFile, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+func (cs *contractStore) loadABIDeployMsg(id string, createdTime time.Time) {
+	deployBytes, err := cs.storage.Get(ABIDeployArtifact, id)
 	if err != nil {
-		log.Errorf("Failed to load ABI deployment file %s: %s", fileName, err)
+		log.Errorf("Failed to load ABI deployment %s: %s", id, err)
 		return
 	}
-	defer deployFile.Close()
 	var deployMsg messages.DeployContract
-	err = json.NewDecoder(bufio.NewReader(deployFile)).Decode(&deployMsg)
+	err = json.Unmarshal(deployBytes, &deployMsg)
 	if err != nil {
-		log.Errorf("Failed to parse ABI deployment file %s: %s", fileName, err)
+		log.Errorf("Failed to parse ABI deployment %s: %s", id, err)
 		return
 	}
-	cs.AddABI(id, &deployMsg, createdTime)
+	if _, err = cs.AddABI(id, &deployMsg, createdTime); err != nil {
+		log.Errorf("Failed to index ABI deployment %s: %s", id, err)
+	}
 }
 
 func (cs *contractStore) CheckNameAvailable(registerAs string, isRemote bool) error {
@@ -380,76 +598,64 @@ func (cs *contractStore) CheckNameAvailable(registerAs string, isRemote bool) er
 		}
 		return nil
 	}
-	if existing, exists := cs.contractRegistrations[registerAs]; exists {
-		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFriendlyNameClash, existing.Address, registerAs)
+	existing, err := cs.index.GetRegistration(registerAs)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-func (cs *contractStore) addToContractIndex(info *ContractInfo) error {
-	cs.idxLock.Lock()
-	defer cs.idxLock.Unlock()
-	if info.RegisteredAs != "" {
-		// Protect against overwrite
-		if err := cs.CheckNameAvailable(info.RegisteredAs, false); err != nil {
-			return err
-		}
-		log.Infof("Registering %s as '%s'", info.Address, info.RegisteredAs)
-		cs.contractRegistrations[info.RegisteredAs] = info
+	if existing != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFriendlyNameClash, existing.Address, registerAs)
 	}
-	cs.contractIndex[info.Address] = info
 	return nil
 }
 
-func (cs *contractStore) AddABI(id string, deployMsg *messages.DeployContract, createdTime time.Time) *ABIInfo {
-	cs.idxLock.Lock()
+func (cs *contractStore) AddABI(id string, deployMsg *messages.DeployContract, createdTime time.Time) (*ABIInfo, error) {
 	info := &ABIInfo{
-		ID:              id,
-		Name:            deployMsg.ContractName,
-		Description:     deployMsg.Description,
-		Deployable:      len(deployMsg.Compiled) > 0,
-		CompilerVersion: deployMsg.CompilerVersion,
-		Path:            "/abis/" + id,
-		SwaggerURL:      cs.conf.BaseURL + "/abis/" + id + "?swagger",
+		ID:               id,
+		Name:             deployMsg.ContractName,
+		Description:      deployMsg.Description,
+		Deployable:       len(deployMsg.Compiled) > 0,
+		CompilerVersion:  deployMsg.CompilerVersion,
+		CompilerSettings: deployMsg.CompilerSettings,
+		Project:          deployMsg.Project,
+		Deleted:          deployMsg.Deleted,
+		Path:             "/abis/" + id,
+		SwaggerURL:       cs.conf.BaseURL + "/abis/" + id + "?swagger",
 		TimeSorted: messages.TimeSorted{
 			CreatedISO8601: createdTime.UTC().Format(time.RFC3339),
 		},
 	}
-	cs.abiIndex[id] = info
-	cs.idxLock.Unlock()
-	return info
+	if err := cs.index.AddABI(info); err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
 func (cs *contractStore) AddRemoteInstance(lookupStr, address string) error {
 	return cs.rr.RegisterInstance(lookupStr, address)
 }
 
-func (cs *contractStore) ListContracts() []messages.TimeSortable {
-	cs.idxLock.Lock()
-	retval := make([]messages.TimeSortable, 0, len(cs.contractIndex))
-	for _, info := range cs.contractIndex {
-		retval = append(retval, info)
+func (cs *contractStore) ListContracts(opts *ListOptions) ([]messages.TimeSortable, int, error) {
+	contracts, err := cs.index.ListContracts()
+	if err != nil {
+		return nil, 0, err
 	}
-	cs.idxLock.Unlock()
-
-	// Do the sort by Title then Address
-	sort.Slice(retval, func(i, j int) bool {
-		return retval[i].IsLessThan(retval[i], retval[j])
-	})
-	return retval
+	entries := make([]listable, 0, len(contracts))
+	for _, info := range contracts {
+		entries = append(entries, info)
+	}
+	retval, total := opts.apply(entries)
+	return retval, total, nil
 }
 
-func (cs *contractStore) ListABIs() []messages.TimeSortable {
-	cs.idxLock.Lock()
-	retval := make([]messages.TimeSortable, 0, len(cs.abiIndex))
-	for _, info := range cs.abiIndex {
-		retval = append(retval, info)
+func (cs *contractStore) ListABIs(opts *ListOptions) ([]messages.TimeSortable, int, error) {
+	abis, err := cs.index.ListABIs()
+	if err != nil {
+		return nil, 0, err
 	}
-	cs.idxLock.Unlock()
-
-	// Do the sort by Title then Address
-	sort.Slice(retval, func(i, j int) bool {
-		return retval[i].IsLessThan(retval[i], retval[j])
-	})
-	return retval
+	entries := make([]listable, 0, len(abis))
+	for _, info := range abis {
+		entries = append(entries, info)
+	}
+	retval, total := opts.apply(entries)
+	return retval, total, nil
 }
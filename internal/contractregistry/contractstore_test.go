@@ -18,10 +18,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-openapi/spec"
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
@@ -59,7 +61,7 @@ func simpleEventsSource() string {
 }
 
 func newTestDeployMsg(t *testing.T, addr string) *DeployContractWithAddress {
-	compiled, err := eth.CompileContract(simpleEventsSource(), "SimpleEvents", "", "")
+	compiled, err := eth.CompileContract(&eth.SolcConf{}, simpleEventsSource(), "SimpleEvents", "", "")
 	assert.NoError(t, err)
 	return &DeployContractWithAddress{
 		Contract: &messages.DeployContract{ABI: compiled.ABI},
@@ -79,7 +81,7 @@ func TestLoadDeployMsgOK(t *testing.T) {
 
 	goodMsg := &messages.DeployContract{}
 	deployBytes, _ := json.Marshal(goodMsg)
-	cs.(*contractStore).abiIndex["abi1"] = &ABIInfo{}
+	cs.(*contractStore).index.AddABI(&ABIInfo{ID: "abi1"})
 	ioutil.WriteFile(deployFile, deployBytes, 0644)
 	_, err = cs.GetABI(ABILocation{
 		ABIType: LocalABI,
@@ -122,7 +124,7 @@ func TestLoadDeployMsgFileMissing(t *testing.T) {
 	err := cs.Init()
 	assert.NoError(err)
 
-	cs.(*contractStore).abiIndex["abi1"] = &ABIInfo{}
+	cs.(*contractStore).index.AddABI(&ABIInfo{ID: "abi1"})
 	_, err = cs.GetABI(ABILocation{
 		ABIType: LocalABI,
 		Name:    "abi1",
@@ -139,7 +141,7 @@ func TestLoadDeployMsgFailure(t *testing.T) {
 	err := cs.Init()
 	assert.NoError(err)
 
-	cs.(*contractStore).abiIndex["abi1"] = &ABIInfo{}
+	cs.(*contractStore).index.AddABI(&ABIInfo{ID: "abi1"})
 	ioutil.WriteFile(path.Join(dir, "abi_abi1.deploy.json"), []byte(":bad json"), 0644)
 	_, err = cs.GetABI(ABILocation{
 		ABIType: LocalABI,
@@ -180,6 +182,101 @@ func TestStoreABIWriteFail(t *testing.T) {
 	assert.Regexp("Failed to write ABI JSON", err.Error())
 }
 
+func TestStoreContractInfoWriteFailRollsBack(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: path.Join(dir, "badpath")}, &mockRR{}).(*contractStore)
+	err := cs.Init()
+	assert.NoError(err)
+
+	// A new registration is removed, so the name can be registered again
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.Regexp("Failed to write ABI JSON", err)
+	_, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.Regexp("No contract instance registered", err)
+	assert.NoError(cs.CheckNameAvailable("c1", false))
+
+	// An existing contract is restored to its previous state
+	previous := &ContractInfo{Address: "1123456789abcdef0123456789abcdef01234567", ABI: "abi1"}
+	cs.index.AddContract(previous)
+	err = cs.storeContractInfo(&ContractInfo{Address: "1123456789abcdef0123456789abcdef01234567", ABI: "abi2"})
+	assert.Regexp("Failed to write ABI JSON", err)
+	info, err := cs.GetContractByAddress("1123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal("abi1", info.ABI)
+}
+
+func TestStoreContractInfoIndexFail(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	cs := &contractStore{index: idx, storage: NewFSArtifactStore("badpath")}
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WillReturnRows(sqlmock.NewRows(testContractColumns))
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WillReturnRows(sqlmock.NewRows(testContractColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("pop"))
+
+	info := &ContractInfo{Address: "addr1"}
+	err := cs.storeContractInfo(info)
+	assert.Regexp("pop", err)
+	err = cs.storeContractInfo(info)
+	assert.Regexp("pop", err)
+	// The failure to roll back is logged, and the original error returned
+	err = cs.storeContractInfo(info)
+	assert.Regexp("Failed to write ABI JSON", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestAddContractWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	_, err = cs.AddABI("abi1", &messages.DeployContract{Project: "payments"}, time.Now())
+	assert.NoError(err)
+	cs.StoreABI("abi1", &messages.DeployContract{Project: "payments"})
+
+	info, err := cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", &RegistrationOptions{
+		ParamDefaults: map[string]string{"gas": "100000"},
+		Decimals:      map[string]int{"amount": 18},
+		Guards:        []*MethodGuard{{Function: "paused()"}},
+	})
+	assert.NoError(err)
+	assert.Equal("payments", info.Project)
+	assert.Equal(map[string]string{"gas": "100000"}, info.ParamDefaults)
+	assert.Equal(map[string]int{"amount": 18}, info.Decimals)
+	assert.Equal("paused()", info.Guards[0].Function)
+
+	info, err = cs.AddContract("1123456789abcdef0123456789abcdef01234567", "abi1", "c2", "c2", &RegistrationOptions{
+		ParamDefaults: map[string]string{},
+		Project:       "audit",
+	})
+	assert.NoError(err)
+	assert.Equal("audit", info.Project)
+	assert.Nil(info.ParamDefaults)
+
+	// The options are stored with the contract instance, so are kept when the index is rebuilt
+	cs2 := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err = cs2.Init()
+	assert.NoError(err)
+	defer cs2.Close()
+	info, err = cs2.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"gas": "100000"}, info.ParamDefaults)
+	assert.Equal(map[string]int{"amount": 18}, info.Decimals)
+	assert.Equal("paused()", info.Guards[0].Function)
+}
+
 func TestLoadABIForInstanceUnknown(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -210,27 +307,246 @@ func TestLoadABIBadData(t *testing.T) {
 	assert.Regexp("No ABI found with ID badness", err.Error())
 }
 
-func TestAddFileToContractIndexBadFileSwallowsError(t *testing.T) {
+func TestLoadContractInstanceBadFileSwallowsError(t *testing.T) {
 	dir := tempdir()
 	defer cleanup(dir)
 	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, nil)
-	cs.(*contractStore).addFileToContractIndex("", "badness")
+	cs.(*contractStore).loadContractInstance("badness")
 }
 
-func TestAddFileToContractIndexBadDataSwallowsError(t *testing.T) {
+func TestLoadContractInstanceBadDataSwallowsError(t *testing.T) {
 	dir := tempdir()
 	defer cleanup(dir)
 	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, nil)
-	fileName := path.Join(dir, "badness")
+	fileName := path.Join(dir, "contract_badness.instance.json")
 	ioutil.WriteFile(fileName, []byte("!JSON"), 0644)
-	cs.(*contractStore).addFileToContractIndex("", fileName)
+	cs.(*contractStore).loadContractInstance("badness")
+}
+
+func TestLoadABIDeployMsgBadFileSwallowsError(t *testing.T) {
+	dir := tempdir()
+	defer cleanup(dir)
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, nil)
+	cs.(*contractStore).loadABIDeployMsg("badness", time.Now().UTC())
 }
 
-func TestAddFileToABIIndexBadFileSwallowsError(t *testing.T) {
+func TestStoreABIDeployMsg(t *testing.T) {
+	assert := assert.New(t)
 	dir := tempdir()
 	defer cleanup(dir)
 	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, nil)
-	cs.(*contractStore).addFileToABIIndex("", "badness", time.Now().UTC())
+	err := cs.StoreABI("abi1", &messages.DeployContract{ContractName: "test"})
+	assert.NoError(err)
+
+	deployMsg, err := cs.(*contractStore).loadDeployMsg("abi1")
+	assert.NoError(err)
+	assert.Equal("test", deployMsg.ContractName)
+}
+
+func TestInitS3StoreBuildsIndex(t *testing.T) {
+	assert := assert.New(t)
+	s3, server := newTestS3Server()
+	defer server.Close()
+	s3.objects["prefix/abi_abi1.deploy.json"] = []byte(`{"contractName":"test"}`)
+
+	cs := NewContractStore(&ContractStoreConf{
+		Store: "s3://testbucket/prefix",
+		S3: S3ArtifactStoreConf{
+			Endpoint:        server.URL,
+			AccessKeyID:     "testkey",
+			SecretAccessKey: "testsecret",
+		},
+	}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+
+	abiInfo, err := cs.GetLocalABIInfo("abi1")
+	assert.NoError(err)
+	assert.Equal("test", abiInfo.Name)
+	err = cs.StoreABI("abi2", &messages.DeployContract{ContractName: "test2"})
+	assert.NoError(err)
+	assert.Contains(s3.objects, "prefix/abi_abi2.deploy.json")
+}
+
+func TestInitS3StoreBadURL(t *testing.T) {
+	assert := assert.New(t)
+
+	cs := NewContractStore(&ContractStoreConf{Store: "ftp://testbucket"}, &mockRR{})
+	err := cs.Init()
+	assert.Regexp("Invalid contract store URL", err)
+}
+
+func TestInitSkipsBuildForPopulatedIndex(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	ioutil.WriteFile(path.Join(dir, "abi_abi1.deploy.json"), []byte(`{"contractName":"test"}`), 0644)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	cs.(*contractStore).index.AddABI(&ABIInfo{ID: "abi2"})
+	err := cs.Init()
+	assert.NoError(err)
+
+	abis, _, err := cs.ListABIs(nil)
+	assert.NoError(err)
+	assert.Equal(1, len(abis))
+	assert.Equal("abi2", abis[0].GetID())
+}
+
+func TestInitPostgreSQLIndexFail(t *testing.T) {
+	assert := assert.New(t)
+
+	cs := NewContractStore(&ContractStoreConf{
+		PostgreSQL: PostgreSQLIndexConf{
+			DSN: "postgres://user@127.0.0.1:1/ethconnect?sslmode=disable&connect_timeout=1",
+		},
+	}, &mockRR{})
+	err := cs.Init()
+	assert.Regexp("Failed to initialize contract index database", err)
+	cs.Close()
+}
+
+func TestInitLevelDBIndexPersists(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	storageDir := path.Join(dir, "contracts")
+	indexDir := path.Join(dir, "index")
+	os.Mkdir(storageDir, 0755)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: storageDir, IndexDBPath: indexDir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "/contracts/c1", "c1", nil)
+	assert.NoError(err)
+	cs.Close()
+
+	// The artifacts are not scanned again on restart
+	os.RemoveAll(storageDir)
+	cs = NewContractStore(&ContractStoreConf{StoragePath: storageDir, IndexDBPath: indexDir}, &mockRR{})
+	err = cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	addr, err := cs.ResolveContractAddress("c1")
+	assert.NoError(err)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", addr)
+}
+
+func TestAddContractDetectsTokenStandards(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	err = cs.StoreABI("abi1", &messages.DeployContract{ABI: testERC20ABI()})
+	assert.NoError(err)
+
+	info, err := cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+	assert.Equal([]string{TokenStandardERC20}, info.Standards)
+
+	// The ABI is not required to register a contract
+	info, err = cs.AddContract("1123456789abcdef0123456789abcdef01234567", "abi2", "c2", "c2", nil)
+	assert.NoError(err)
+	assert.Empty(info.Standards)
+}
+
+func TestSetMethodPolicy(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+
+	info, err := cs.SetMethodPolicy("0123456789abcdef0123456789abcdef01234567", &MethodPolicy{Deny: []string{"mint"}})
+	assert.NoError(err)
+	assert.Equal([]string{"mint"}, info.MethodPolicy.Deny)
+	info, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal([]string{"mint"}, info.MethodPolicy.Deny)
+	cs.Close()
+
+	// The policy is persisted with the contract, and can be removed
+	cs = NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err = cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	info, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal([]string{"mint"}, info.MethodPolicy.Deny)
+	info, err = cs.SetMethodPolicy("0123456789abcdef0123456789abcdef01234567", &MethodPolicy{})
+	assert.NoError(err)
+	assert.Nil(info.MethodPolicy)
+
+	_, err = cs.SetMethodPolicy("1123456789abcdef0123456789abcdef01234567", nil)
+	assert.Regexp("No contract instance registered with address", err)
+}
+
+func TestSetParamDefaults(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+
+	info, err := cs.SetParamDefaults("0123456789abcdef0123456789abcdef01234567", map[string]string{"from": "0x12345"})
+	assert.NoError(err)
+	assert.Equal(map[string]string{"from": "0x12345"}, info.ParamDefaults)
+	cs.Close()
+
+	// The defaults are persisted with the contract, and can be removed
+	cs = NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err = cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	info, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"from": "0x12345"}, info.ParamDefaults)
+	info, err = cs.SetParamDefaults("0123456789abcdef0123456789abcdef01234567", map[string]string{})
+	assert.NoError(err)
+	assert.Nil(info.ParamDefaults)
+
+	_, err = cs.SetParamDefaults("1123456789abcdef0123456789abcdef01234567", nil)
+	assert.Regexp("No contract instance registered with address", err)
+}
+
+func TestSetProject(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	_, err = cs.AddABI("abi1", &messages.DeployContract{Project: "payments"}, time.Now())
+	assert.NoError(err)
+	cs.StoreABI("abi1", &messages.DeployContract{Project: "payments"})
+
+	// The contract is grouped in the project of its ABI, until it is moved
+	info, err := cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+	assert.Equal("payments", info.Project)
+	info, err = cs.SetProject("0123456789abcdef0123456789abcdef01234567", "audit")
+	assert.NoError(err)
+	assert.Equal("audit", info.Project)
+	info, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal("audit", info.Project)
+
+	_, err = cs.SetProject("1123456789abcdef0123456789abcdef01234567", "audit")
+	assert.Regexp("No contract instance registered with address", err)
 }
 
 func TestCheckNameAvailableRRDuplicate(t *testing.T) {
@@ -335,7 +651,8 @@ func TestBuildIndex(t *testing.T) {
 	err := cs.Init()
 	assert.NoError(err)
 
-	contracts := cs.ListContracts()
+	contracts, _, err := cs.ListContracts(nil)
+	assert.NoError(err)
 	assert.Equal(4, len(contracts))
 	assert.Equal("123456789abcdef0123456789abcdef012345678", contracts[0].(*ContractInfo).Address)
 	assert.Equal("23456789abcdef0123456789abcdef0123456789", contracts[1].(*ContractInfo).Address)
@@ -354,7 +671,8 @@ func TestBuildIndex(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal("23456789abcdef0123456789abcdef0123456789", migratedcontractAddr)
 
-	abis := cs.ListABIs()
+	abis, _, err := cs.ListABIs(nil)
+	assert.NoError(err)
 	assert.Equal(2, len(abis))
 	assert.Equal("840b629f-2e46-413b-9671-553a886ca7bb", abis[0].(*ABIInfo).ID)
 	assert.Equal("e27be4cf-6ae2-411e-8088-db2992618938", abis[1].(*ABIInfo).ID)
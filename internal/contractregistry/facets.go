@@ -0,0 +1,212 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// FacetCollision is a method or event of a facet that has the same name as one with a different
+// definition in an ABI registered before it against the contract. Routes are generated by name,
+// so only one of the two could be called under the contract path
+type FacetCollision struct {
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	ABI           string `json:"abi"`
+	RegisteredABI string `json:"registeredABI"`
+}
+
+func (c *FacetCollision) String() string {
+	return fmt.Sprintf("%s %s (declared differently by ABI %s)", c.Type, c.Name, c.RegisteredABI)
+}
+
+// routedABIs returns the IDs of the ABIs the routes of the contract are generated from,
+// which is the ABI it was registered with followed by its facets
+func (i *ContractInfo) routedABIs() []string {
+	return append([]string{i.ABI}, i.Facets...)
+}
+
+// isFacet is true if the ABI is registered as a facet of the contract
+func (i *ContractInfo) isFacet(abiID string) bool {
+	for _, id := range i.Facets {
+		if id == abiID {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeFacetABIs merges the ABIs registered against a diamond contract (EIP-2535), in order, into
+// the one ABI its routes are generated from. Functions and events declared identically by more than
+// one ABI, such as a supportsInterface shared by facets, are merged. Those that share a name with a
+// different definition from an earlier ABI collide, and the earlier definition is kept. Constructors,
+// fallback and receive functions only apply from the first ABI
+func MergeFacetABIs(abiIDs []string, abis []ethbinding.ABIMarshaling) (ethbinding.ABIMarshaling, []*FacetCollision) {
+	type declared struct {
+		abiID string
+		defs  map[string]bool
+	}
+	byName := make(map[string]*declared)
+	errorDefs := make(map[string]bool)
+	merged := ethbinding.ABIMarshaling{}
+	var collisions []*FacetCollision
+	for idx, abi := range abis {
+		for _, element := range abi {
+			def, _ := json.Marshal(&element)
+			if element.Type == "error" {
+				// Errors are decoded by selector rather than routed by name, so only duplicates are dropped
+				if !errorDefs[string(def)] {
+					errorDefs[string(def)] = true
+					merged = append(merged, element)
+				}
+				continue
+			} else if element.Type != "function" && element.Type != "event" {
+				if idx == 0 {
+					merged = append(merged, element)
+				}
+				continue
+			}
+			key := element.Type + ":" + element.Name
+			d := byName[key]
+			switch {
+			case d == nil:
+				byName[key] = &declared{abiID: abiIDs[idx], defs: map[string]bool{string(def): true}}
+			case d.defs[string(def)]:
+				// Declared identically before, so the facet shares it
+				continue
+			case d.abiID == abiIDs[idx]:
+				// An overload within the same ABI
+				d.defs[string(def)] = true
+			default:
+				collisions = append(collisions, &FacetCollision{
+					Type:          element.Type,
+					Name:          element.Name,
+					ABI:           abiIDs[idx],
+					RegisteredABI: d.abiID,
+				})
+				continue
+			}
+			merged = append(merged, element)
+		}
+	}
+	return merged, collisions
+}
+
+// MergeFacets returns the deploy message of a contract with the ABIs of its facets merged into its
+// ABI, or the deploy message unchanged if the contract has no facets
+func MergeFacets(cr ContractResolver, info *ContractInfo, deployMsg *messages.DeployContract) (*messages.DeployContract, error) {
+	if info == nil || deployMsg == nil || len(info.Facets) == 0 {
+		return deployMsg, nil
+	}
+	abis := []ethbinding.ABIMarshaling{deployMsg.ABI}
+	for _, abiID := range info.Facets {
+		facet, err := cr.GetABI(ABILocation{ABIType: LocalABI, Name: abiID}, false)
+		if err != nil {
+			return nil, err
+		}
+		if facet == nil || facet.Contract == nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABINotFound, abiID)
+		}
+		abis = append(abis, facet.Contract.ABI)
+	}
+	merged := *deployMsg
+	merged.ABI, _ = MergeFacetABIs(info.routedABIs(), abis)
+	return &merged, nil
+}
+
+// mergeStoredABIs loads the ABIs from the store, and merges them as the ABIs of a diamond contract
+func (cs *contractStore) mergeStoredABIs(abiIDs []string) (ethbinding.ABIMarshaling, []*FacetCollision, error) {
+	abis := make([]ethbinding.ABIMarshaling, len(abiIDs))
+	for idx, abiID := range abiIDs {
+		deployMsg, err := cs.loadDeployMsg(abiID)
+		if err != nil {
+			return nil, nil, err
+		}
+		abis[idx] = deployMsg.ABI
+	}
+	merged, collisions := MergeFacetABIs(abiIDs, abis)
+	return merged, collisions, nil
+}
+
+// AddFacet registers an additional ABI against a contract, for diamond contracts that expose the
+// methods of many facets at one address. The facet is rejected if any of its methods or events
+// collide with those of the ABIs already registered against the contract
+func (cs *contractStore) AddFacet(addrHexNo0x, abiID string) (*ContractInfo, error) {
+	existing, err := cs.getContract(addrHexNo0x)
+	if err != nil {
+		return nil, err
+	}
+	if existing.ABI == abiID || existing.isFacet(abiID) {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractRegistryFacetExists, abiID, addrHexNo0x)
+	}
+	merged, collisions, err := cs.mergeStoredABIs(append(existing.routedABIs(), abiID))
+	if err != nil {
+		return nil, err
+	}
+	if len(collisions) > 0 {
+		names := make([]string, len(collisions))
+		for idx, c := range collisions {
+			names[idx] = c.String()
+		}
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractRegistryFacetCollision, abiID, addrHexNo0x, strings.Join(names, ", "))
+	}
+	info, err := cs.updateContractInfo(addrHexNo0x, func(info *ContractInfo) {
+		info.Facets = append(info.Facets, abiID)
+		info.Standards = DetectTokenStandards(merged)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Added facet %s to contract %s", abiID, addrHexNo0x)
+	return info, nil
+}
+
+// RemoveFacet removes an ABI that was registered as a facet of a contract, when the facet
+// is cut from the diamond
+func (cs *contractStore) RemoveFacet(addrHexNo0x, abiID string) (*ContractInfo, error) {
+	existing, err := cs.getContract(addrHexNo0x)
+	if err != nil {
+		return nil, err
+	}
+	if !existing.isFacet(abiID) {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractRegistryFacetNotFound, abiID, addrHexNo0x)
+	}
+	var facets []string
+	for _, id := range existing.Facets {
+		if id != abiID {
+			facets = append(facets, id)
+		}
+	}
+	merged, _, err := cs.mergeStoredABIs(append([]string{existing.ABI}, facets...))
+	if err != nil {
+		return nil, err
+	}
+	info, err := cs.updateContractInfo(addrHexNo0x, func(info *ContractInfo) {
+		info.Facets = facets
+		info.Standards = DetectTokenStandards(merged)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Removed facet %s from contract %s", abiID, addrHexNo0x)
+	return info, nil
+}
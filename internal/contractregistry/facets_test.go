@@ -0,0 +1,153 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDiamondABI = ethbinding.ABIMarshaling{
+	{Type: "constructor", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address"}}},
+	{Type: "fallback"},
+	{Type: "function", Name: "facets", StateMutability: "view", Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "address[]"}}},
+	{Type: "function", Name: "supportsInterface", StateMutability: "view", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "bytes4"}}, Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "bool"}}},
+	{Type: "event", Name: "DiamondCut", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "init", Type: "address"}}},
+	{Type: "error", Name: "NotOwner"},
+}
+
+var testTokenFacetABI = ethbinding.ABIMarshaling{
+	{Type: "constructor"},
+	{Type: "function", Name: "balanceOf", StateMutability: "view", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}}, Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "uint256"}}},
+	{Type: "function", Name: "transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}, {Type: "uint256"}}, Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "bool"}}},
+	{Type: "function", Name: "transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}, {Type: "uint256"}, {Type: "bytes"}}, Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "bool"}}},
+	{Type: "function", Name: "supportsInterface", StateMutability: "view", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "bytes4"}}, Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "bool"}}},
+	{Type: "event", Name: "Transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address", Indexed: true}, {Name: "to", Type: "address", Indexed: true}, {Name: "value", Type: "uint256"}}},
+	{Type: "error", Name: "NotOwner"},
+}
+
+var testCollidingFacetABI = ethbinding.ABIMarshaling{
+	{Type: "function", Name: "owner", StateMutability: "view", Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}}},
+	{Type: "function", Name: "facets", StateMutability: "view", Outputs: []ethbinding.ABIArgumentMarshaling{{Type: "bytes4[]"}}},
+	{Type: "event", Name: "DiamondCut", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "init", Type: "address", Indexed: true}}},
+}
+
+func TestMergeFacetABIs(t *testing.T) {
+	assert := assert.New(t)
+
+	merged, collisions := MergeFacetABIs([]string{"diamond", "token"}, []ethbinding.ABIMarshaling{testDiamondABI, testTokenFacetABI})
+	assert.Empty(collisions)
+	var names []string
+	for _, element := range merged {
+		names = append(names, element.Type+":"+element.Name)
+	}
+	assert.Equal([]string{
+		"constructor:", "fallback:", "function:facets", "function:supportsInterface", "event:DiamondCut", "error:NotOwner",
+		"function:balanceOf", "function:transfer", "function:transfer", "event:Transfer",
+	}, names)
+
+	merged, collisions = MergeFacetABIs([]string{"diamond", "token", "colliding"}, []ethbinding.ABIMarshaling{testDiamondABI, testTokenFacetABI, testCollidingFacetABI})
+	assert.Equal(11, len(merged))
+	assert.Equal([]*FacetCollision{
+		{Type: "function", Name: "facets", ABI: "colliding", RegisteredABI: "diamond"},
+		{Type: "event", Name: "DiamondCut", ABI: "colliding", RegisteredABI: "diamond"},
+	}, collisions)
+	assert.Equal("function facets (declared differently by ABI diamond)", collisions[0].String())
+}
+
+func TestAddRemoveFacet(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	cs.StoreABI("diamond", &messages.DeployContract{ABI: testDiamondABI})
+	cs.StoreABI("token", &messages.DeployContract{ABI: testTokenFacetABI})
+	cs.StoreABI("colliding", &messages.DeployContract{ABI: testCollidingFacetABI})
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "diamond", "d1", "d1", nil)
+	assert.NoError(err)
+
+	_, err = cs.AddFacet("1123456789abcdef0123456789abcdef01234567", "token")
+	assert.Regexp("No contract instance registered with address", err)
+	_, err = cs.AddFacet("0123456789abcdef0123456789abcdef01234567", "diamond")
+	assert.Regexp("FFEC100372", err)
+	_, err = cs.AddFacet("0123456789abcdef0123456789abcdef01234567", "unknown")
+	assert.Error(err)
+	_, err = cs.AddFacet("0123456789abcdef0123456789abcdef01234567", "colliding")
+	assert.Regexp("FFEC100374.*function facets.*event DiamondCut", err)
+
+	info, err := cs.AddFacet("0123456789abcdef0123456789abcdef01234567", "token")
+	assert.NoError(err)
+	assert.Equal([]string{"token"}, info.Facets)
+	assert.Equal("diamond", info.ABI)
+	_, err = cs.AddFacet("0123456789abcdef0123456789abcdef01234567", "token")
+	assert.Regexp("FFEC100372", err)
+	cs.Close()
+
+	// The facets are persisted with the contract
+	cs = NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err = cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	info, err = cs.GetContractByAddress("0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal([]string{"token"}, info.Facets)
+	deployMsg, err := cs.GetABI(ABILocation{ABIType: LocalABI, Name: "diamond"}, false)
+	assert.NoError(err)
+	merged, err := MergeFacets(cs, info, deployMsg.Contract)
+	assert.NoError(err)
+	assert.Equal(10, len(merged.ABI))
+	assert.Equal(len(testDiamondABI), len(deployMsg.Contract.ABI))
+
+	_, err = cs.RemoveFacet("0123456789abcdef0123456789abcdef01234567", "diamond")
+	assert.Regexp("FFEC100373", err)
+	_, err = cs.RemoveFacet("1123456789abcdef0123456789abcdef01234567", "token")
+	assert.Regexp("No contract instance registered with address", err)
+	info, err = cs.RemoveFacet("0123456789abcdef0123456789abcdef01234567", "token")
+	assert.NoError(err)
+	assert.Empty(info.Facets)
+	merged, err = MergeFacets(cs, info, deployMsg.Contract)
+	assert.NoError(err)
+	assert.Equal(deployMsg.Contract, merged)
+}
+
+func TestDeleteABIUsedByFacet(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+	for _, id := range []string{"diamond", "token"} {
+		_, err = cs.AddABI(id, &messages.DeployContract{}, time.Now())
+		assert.NoError(err)
+		cs.StoreABI(id, &messages.DeployContract{})
+	}
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "diamond", "d1", "d1", nil)
+	assert.NoError(err)
+	_, err = cs.AddFacet("0123456789abcdef0123456789abcdef01234567", "token")
+	assert.NoError(err)
+
+	_, err = cs.DeleteABI("token")
+	assert.Regexp("FFEC100283", err)
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"regexp"
+	"strings"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// GuardFromParam is replaced by the address sending the transaction, in the params of a guard
+const GuardFromParam = "${from}"
+
+var (
+	guardSignatureCheck = regexp.MustCompile(`^([a-zA-Z_$][a-zA-Z0-9_$]*)\(([a-z0-9\[\],]*)\)$`)
+	guardAddressCheck   = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{40}$`)
+)
+
+// MethodGuard is an on-chain check the gateway makes with eth_call before it submits a
+// transaction to a registered contract, such as hasRole(bytes32,address) returning true for
+// the sender. A transaction the guard does not permit is rejected immediately, rather than
+// being submitted only to revert on-chain
+type MethodGuard struct {
+	// Methods lists the methods the guard applies to, by name or signature. All methods when empty
+	Methods []string `json:"methods,omitempty"`
+	// Function is the signature of a function that returns a bool, such as hasRole(bytes32,address)
+	Function string `json:"function"`
+	// Params are the inputs to the function, where ${from} is the address sending the transaction
+	Params []string `json:"params,omitempty"`
+	// Address is the contract the function is called on, when it is not the registered contract
+	Address string `json:"address,omitempty"`
+	// Reason is returned when the guard does not permit a transaction
+	Reason string `json:"reason,omitempty"`
+}
+
+// AppliesTo returns true if the guard checks transactions that call the method
+func (g *MethodGuard) AppliesTo(method *ethbinding.ABIElementMarshaling) bool {
+	if len(g.Methods) == 0 {
+		return true
+	}
+	signature := FunctionSignature(method)
+	for _, entry := range g.Methods {
+		if entry == method.Name || entry == signature {
+			return true
+		}
+	}
+	return false
+}
+
+// FunctionABI returns the ABI of the guard function, which returns a single bool
+func (g *MethodGuard) FunctionABI() (*ethbinding.ABIElementMarshaling, error) {
+	match := guardSignatureCheck.FindStringSubmatch(strings.ReplaceAll(g.Function, " ", ""))
+	if match == nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardInvalid, "invalid function signature '"+g.Function+"'")
+	}
+	inputs := []ethbinding.ABIArgumentMarshaling{}
+	if match[2] != "" {
+		for _, t := range strings.Split(match[2], ",") {
+			inputs = append(inputs, ethbinding.ABIArgumentMarshaling{Type: t})
+		}
+	}
+	return &ethbinding.ABIElementMarshaling{
+		Type:            "function",
+		Name:            match[1],
+		StateMutability: "view",
+		Inputs:          inputs,
+		Outputs:         []ethbinding.ABIArgumentMarshaling{{Type: "bool"}},
+	}, nil
+}
+
+// CallParams returns the params to call the guard function with, for a transaction from the address
+func (g *MethodGuard) CallParams(from string) []interface{} {
+	params := make([]interface{}, len(g.Params))
+	for i, p := range g.Params {
+		if p == GuardFromParam {
+			params[i] = from
+		} else {
+			params[i] = p
+		}
+	}
+	return params
+}
+
+// ValidateGuards checks each guard declares a valid function, with a param for each of its
+// inputs, and only names methods that are declared by the ABI of the contract
+func ValidateGuards(guards []*MethodGuard, abi ethbinding.ABIMarshaling) error {
+	methods := make(map[string]bool)
+	for i := range abi {
+		if abi[i].Type == "function" {
+			methods[abi[i].Name] = true
+			methods[FunctionSignature(&abi[i])] = true
+		}
+	}
+	for _, g := range guards {
+		if g == nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardInvalid, "empty guard")
+		}
+		element, err := g.FunctionABI()
+		if err != nil {
+			return err
+		}
+		if _, err := ethbind.API.ABIElementMarshalingToABIMethod(element); err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardInvalid, "invalid function signature '"+g.Function+"': "+err.Error())
+		}
+		if len(g.Params) != len(element.Inputs) {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardInvalid, "function '"+g.Function+"' requires a param for each input")
+		}
+		if g.Address != "" && !guardAddressCheck.MatchString(g.Address) {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardInvalid, "invalid address '"+g.Address+"'")
+		}
+		for _, m := range g.Methods {
+			if !methods[m] {
+				return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayGuardInvalid, "method '"+m+"' is not declared by the contract ABI")
+			}
+		}
+	}
+	return nil
+}
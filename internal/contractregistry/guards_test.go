@@ -0,0 +1,95 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+var testGuardABI = ethbinding.ABIMarshaling{
+	{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+	{Type: "function", Name: "burn", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "amount", Type: "uint256"}}},
+	{Type: "event", Name: "Minted"},
+}
+
+func TestMethodGuardAppliesTo(t *testing.T) {
+	assert := assert.New(t)
+
+	g := &MethodGuard{}
+	assert.True(g.AppliesTo(&testGuardABI[0]))
+	g.Methods = []string{"mint"}
+	assert.True(g.AppliesTo(&testGuardABI[0]))
+	assert.False(g.AppliesTo(&testGuardABI[1]))
+	g.Methods = []string{"burn(uint256)"}
+	assert.False(g.AppliesTo(&testGuardABI[0]))
+	assert.True(g.AppliesTo(&testGuardABI[1]))
+}
+
+func TestMethodGuardFunctionABI(t *testing.T) {
+	assert := assert.New(t)
+
+	element, err := (&MethodGuard{Function: "hasRole(bytes32, address)"}).FunctionABI()
+	assert.NoError(err)
+	assert.Equal("hasRole", element.Name)
+	assert.Equal("view", element.StateMutability)
+	assert.Equal(2, len(element.Inputs))
+	assert.Equal("address", element.Inputs[1].Type)
+	assert.Equal("bool", element.Outputs[0].Type)
+
+	element, err = (&MethodGuard{Function: "paused()"}).FunctionABI()
+	assert.NoError(err)
+	assert.Empty(element.Inputs)
+
+	_, err = (&MethodGuard{Function: "hasRole"}).FunctionABI()
+	assert.Regexp("Invalid guard: invalid function signature 'hasRole'", err)
+}
+
+func TestMethodGuardCallParams(t *testing.T) {
+	assert := assert.New(t)
+
+	g := &MethodGuard{Params: []string{"0x01", GuardFromParam}}
+	assert.Equal([]interface{}{"0x01", "0xaaaa"}, g.CallParams("0xaaaa"))
+}
+
+func TestValidateGuards(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ValidateGuards([]*MethodGuard{
+		{Function: "hasRole(bytes32,address)", Params: []string{"0x01", GuardFromParam}, Methods: []string{"mint", "burn(uint256)"}},
+		{Function: "isActive()", Address: "0x0123456789abcdef0123456789abcdef01234567"},
+	}, testGuardABI)
+	assert.NoError(err)
+
+	err = ValidateGuards([]*MethodGuard{nil}, testGuardABI)
+	assert.Regexp("Invalid guard: empty guard", err)
+
+	err = ValidateGuards([]*MethodGuard{{Function: "bad"}}, testGuardABI)
+	assert.Regexp("Invalid guard: invalid function signature 'bad'", err)
+
+	err = ValidateGuards([]*MethodGuard{{Function: "check(badtype)", Params: []string{"a"}}}, testGuardABI)
+	assert.Regexp("Invalid guard: invalid function signature 'check\\(badtype\\)'", err)
+
+	err = ValidateGuards([]*MethodGuard{{Function: "check(address)"}}, testGuardABI)
+	assert.Regexp("Invalid guard: function 'check\\(address\\)' requires a param for each input", err)
+
+	err = ValidateGuards([]*MethodGuard{{Function: "paused()", Address: "0x1234"}}, testGuardABI)
+	assert.Regexp("Invalid guard: invalid address '0x1234'", err)
+
+	err = ValidateGuards([]*MethodGuard{{Function: "paused()", Methods: []string{"Minted"}}}, testGuardABI)
+	assert.Regexp("Invalid guard: method 'Minted' is not declared by the contract ABI", err)
+}
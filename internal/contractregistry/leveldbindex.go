@@ -0,0 +1,222 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"encoding/json"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+)
+
+const (
+	levelDBContractPrefix     = "contracts/"
+	levelDBRegistrationPrefix = "registrations/"
+	levelDBABIPrefix          = "abis/"
+)
+
+// levelDBContractIndex persists the index in a local LevelDB, so it does not need
+// to be rebuilt from every artifact when the gateway restarts
+type levelDBContractIndex struct {
+	path string
+	// Serializes updates, so checking and adding a registration is atomic
+	lock sync.Mutex
+	db   kvstore.KVStore
+}
+
+func newLevelDBContractIndex(path string) ContractIndex {
+	return &levelDBContractIndex{
+		path: path,
+	}
+}
+
+func (l *levelDBContractIndex) Init() (err error) {
+	if l.db, err = kvstore.NewLDBKeyValueStore(l.path); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexInit, err)
+	}
+	return nil
+}
+
+func (l *levelDBContractIndex) Close() {
+	if l.db != nil {
+		l.db.Close()
+	}
+}
+
+func (l *levelDBContractIndex) IsEmpty() (bool, error) {
+	itr := l.db.NewIterator()
+	defer itr.Release()
+	return !itr.Next(), nil
+}
+
+func (l *levelDBContractIndex) get(key string, info interface{}) (bool, error) {
+	b, err := l.db.Get(key)
+	if err == kvstore.ErrorNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	if err = json.Unmarshal(b, info); err != nil {
+		return false, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	return true, nil
+}
+
+func (l *levelDBContractIndex) put(key string, info interface{}) error {
+	b, _ := json.Marshal(info)
+	if err := l.db.Put(key, b); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
+
+// list calls the supplied function to unmarshal each entry with the prefix
+func (l *levelDBContractIndex) list(prefix string, add func(b []byte) error) error {
+	itr := l.db.NewIteratorWithRange(util.BytesPrefix([]byte(prefix)))
+	defer itr.Release()
+	for itr.Next() {
+		if err := add(itr.Value()); err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	return nil
+}
+
+func (l *levelDBContractIndex) AddContract(info *ContractInfo) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if info.RegisteredAs != "" {
+		// Protect against overwrite
+		existing, err := l.getRegistration(info.RegisteredAs)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Address != info.Address {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFriendlyNameClash, existing.Address, info.RegisteredAs)
+		}
+		log.Infof("Registering %s as '%s'", info.Address, info.RegisteredAs)
+	}
+	// The contract is written before the registration that refers to it
+	if err := l.put(levelDBContractPrefix+info.Address, info); err != nil {
+		return err
+	}
+	if info.RegisteredAs != "" {
+		if err := l.db.Put(levelDBRegistrationPrefix+info.RegisteredAs, []byte(info.Address)); err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+		}
+	}
+	return nil
+}
+
+// UpdateContract replaces the entry for a contract that has already been added. The
+// registration refers to the contract by address, so does not need to be updated
+func (l *levelDBContractIndex) UpdateContract(info *ContractInfo) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.put(levelDBContractPrefix+info.Address, info)
+}
+
+func (l *levelDBContractIndex) GetContract(address string) (*ContractInfo, error) {
+	info := &ContractInfo{}
+	found, err := l.get(levelDBContractPrefix+address, info)
+	if !found {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (l *levelDBContractIndex) getRegistration(name string) (*ContractInfo, error) {
+	address, err := l.db.Get(levelDBRegistrationPrefix + name)
+	if err == kvstore.ErrorNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	return l.GetContract(string(address))
+}
+
+func (l *levelDBContractIndex) GetRegistration(name string) (*ContractInfo, error) {
+	return l.getRegistration(name)
+}
+
+func (l *levelDBContractIndex) ListContracts() ([]*ContractInfo, error) {
+	retval := make([]*ContractInfo, 0)
+	err := l.list(levelDBContractPrefix, func(b []byte) error {
+		info := &ContractInfo{}
+		retval = append(retval, info)
+		return json.Unmarshal(b, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retval, nil
+}
+
+// DeleteContract removes a contract, and releases its registered name.
+// The registration is removed before the contract it refers to
+func (l *levelDBContractIndex) DeleteContract(info *ContractInfo) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if info.RegisteredAs != "" {
+		if err := l.db.Delete(levelDBRegistrationPrefix + info.RegisteredAs); err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+		}
+	}
+	if err := l.db.Delete(levelDBContractPrefix + info.Address); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
+
+func (l *levelDBContractIndex) AddABI(info *ABIInfo) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.put(levelDBABIPrefix+info.ID, info)
+}
+
+func (l *levelDBContractIndex) GetABI(id string) (*ABIInfo, error) {
+	info := &ABIInfo{}
+	found, err := l.get(levelDBABIPrefix+id, info)
+	if !found {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (l *levelDBContractIndex) ListABIs() ([]*ABIInfo, error) {
+	retval := make([]*ABIInfo, 0)
+	err := l.list(levelDBABIPrefix, func(b []byte) error {
+		info := &ABIInfo{}
+		retval = append(retval, info)
+		return json.Unmarshal(b, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retval, nil
+}
+
+func (l *levelDBContractIndex) DeleteABI(id string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.db.Delete(levelDBABIPrefix + id); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
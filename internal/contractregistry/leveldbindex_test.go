@@ -0,0 +1,157 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelDBContractIndex(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	idx := newLevelDBContractIndex(path.Join(dir, "index"))
+	assert.NoError(idx.Init())
+	empty, err := idx.IsEmpty()
+	assert.NoError(err)
+	assert.True(empty)
+
+	err = idx.AddContract(&ContractInfo{Address: "addr1", ABI: "abi1", RegisteredAs: "name1"})
+	assert.NoError(err)
+	err = idx.AddContract(&ContractInfo{Address: "addr1", ABI: "abi2", RegisteredAs: "name1"})
+	assert.NoError(err)
+	err = idx.AddContract(&ContractInfo{Address: "addr2", RegisteredAs: "name1"})
+	assert.Regexp("Contract address addr1 is already registered for name 'name1'", err)
+	err = idx.AddContract(&ContractInfo{Address: "addr3"})
+	assert.NoError(err)
+	err = idx.UpdateContract(&ContractInfo{Address: "addr1", ABI: "abi2", RegisteredAs: "name1", MethodPolicy: &MethodPolicy{Deny: []string{"mint"}}})
+	assert.NoError(err)
+	err = idx.AddABI(&ABIInfo{ID: "abi1", Name: "test"})
+	assert.NoError(err)
+	idx.Close()
+
+	// Reopen, and check everything was persisted
+	idx = newLevelDBContractIndex(path.Join(dir, "index"))
+	assert.NoError(idx.Init())
+	defer idx.Close()
+	empty, err = idx.IsEmpty()
+	assert.NoError(err)
+	assert.False(empty)
+
+	info, err := idx.GetRegistration("name1")
+	assert.NoError(err)
+	assert.Equal("addr1", info.Address)
+	assert.Equal("abi2", info.ABI)
+	assert.Equal([]string{"mint"}, info.MethodPolicy.Deny)
+	info, err = idx.GetRegistration("name2")
+	assert.NoError(err)
+	assert.Nil(info)
+	info, err = idx.GetContract("addr2")
+	assert.NoError(err)
+	assert.Nil(info)
+	contracts, err := idx.ListContracts()
+	assert.NoError(err)
+	assert.Equal(2, len(contracts))
+
+	abiInfo, err := idx.GetABI("abi1")
+	assert.NoError(err)
+	assert.Equal("test", abiInfo.Name)
+	abiInfo, err = idx.GetABI("abi2")
+	assert.NoError(err)
+	assert.Nil(abiInfo)
+	abis, err := idx.ListABIs()
+	assert.NoError(err)
+	assert.Equal(1, len(abis))
+
+	err = idx.DeleteContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1"})
+	assert.NoError(err)
+	err = idx.DeleteContract(&ContractInfo{Address: "addr3"})
+	assert.NoError(err)
+	info, err = idx.GetRegistration("name1")
+	assert.NoError(err)
+	assert.Nil(info)
+	err = idx.DeleteABI("abi1")
+	assert.NoError(err)
+	empty, err = idx.IsEmpty()
+	assert.NoError(err)
+	assert.True(empty)
+}
+
+func TestLevelDBContractIndexInitFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	ioutil.WriteFile(path.Join(dir, "index"), []byte("not a db"), 0644)
+
+	idx := newLevelDBContractIndex(path.Join(dir, "index"))
+	err := idx.Init()
+	assert.Regexp("Failed to initialize contract index database", err)
+	idx.Close()
+}
+
+func TestLevelDBContractIndexBadData(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	idx := newLevelDBContractIndex(path.Join(dir, "index"))
+	assert.NoError(idx.Init())
+	defer idx.Close()
+	ldb := idx.(*levelDBContractIndex)
+	ldb.db.Put(levelDBContractPrefix+"addr1", []byte("!json"))
+	ldb.db.Put(levelDBRegistrationPrefix+"name1", []byte("addr1"))
+	ldb.db.Put(levelDBABIPrefix+"abi1", []byte("!json"))
+
+	_, err := idx.GetContract("addr1")
+	assert.Regexp("Failed to query contract index", err)
+	err = idx.AddContract(&ContractInfo{Address: "addr2", RegisteredAs: "name1"})
+	assert.Regexp("Failed to query contract index", err)
+	_, err = idx.ListContracts()
+	assert.Regexp("Failed to query contract index", err)
+	_, err = idx.ListABIs()
+	assert.Regexp("Failed to query contract index", err)
+}
+
+func TestLevelDBContractIndexClosed(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	idx := newLevelDBContractIndex(path.Join(dir, "index"))
+	assert.NoError(idx.Init())
+	idx.Close()
+
+	_, err := idx.GetABI("abi1")
+	assert.Regexp("Failed to query contract index", err)
+	_, err = idx.GetRegistration("name1")
+	assert.Regexp("Failed to query contract index", err)
+	err = idx.AddABI(&ABIInfo{ID: "abi1"})
+	assert.Regexp("Failed to update contract index", err)
+	err = idx.AddContract(&ContractInfo{Address: "addr1"})
+	assert.Regexp("Failed to update contract index", err)
+	err = idx.UpdateContract(&ContractInfo{Address: "addr1"})
+	assert.Regexp("Failed to update contract index", err)
+	err = idx.DeleteContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1"})
+	assert.Regexp("Failed to update contract index", err)
+	err = idx.DeleteContract(&ContractInfo{Address: "addr1"})
+	assert.Regexp("Failed to update contract index", err)
+	err = idx.DeleteABI("abi1")
+	assert.Regexp("Failed to update contract index", err)
+}
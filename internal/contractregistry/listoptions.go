@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+)
+
+const (
+	// SortByCreated sorts oldest first, or newest first with the "-" prefix (the default)
+	SortByCreated = "created"
+	// SortByName sorts by the registered name of contracts, or the name of ABIs
+	SortByName = "name"
+	// SortByID sorts by the address of contracts, or the ID of ABIs
+	SortByID = "id"
+)
+
+// ListOptions filters, sorts and pages the contracts or ABIs listed from the local registry.
+// The zero value lists everything that has not been deleted, newest first.
+type ListOptions struct {
+	// Name matches the registered name of contracts, or the name of ABIs
+	Name string
+	// ABI matches the ABI ID of contracts, or the ID of ABIs
+	ABI string
+	// Project matches the project contracts or ABIs are grouped in
+	Project string
+	// Deleted lists only the entries that have been deleted, and not yet purged, instead of the others
+	Deleted bool
+	// CreatedAfter excludes entries created at or before the time
+	CreatedAfter time.Time
+	// Sort is one of the SortBy fields, with an optional "-" prefix for descending order
+	Sort string
+	// After returns the entries that follow the entry with this address or ID in the sort order
+	After string
+	Skip  int
+	Limit int
+}
+
+// listable is implemented by ContractInfo and ABIInfo to support ListOptions
+type listable interface {
+	messages.TimeSortable
+	getName() string
+	getABI() string
+	getProject() string
+	isDeleted() bool
+}
+
+func (i *ContractInfo) getName() string {
+	return i.RegisteredAs
+}
+
+func (i *ContractInfo) getABI() string {
+	return i.ABI
+}
+
+func (i *ContractInfo) getProject() string {
+	return i.Project
+}
+
+func (i *ContractInfo) isDeleted() bool {
+	return i.Deleted != ""
+}
+
+func (i *ABIInfo) getName() string {
+	return i.Name
+}
+
+func (i *ABIInfo) getABI() string {
+	return i.ID
+}
+
+func (i *ABIInfo) getProject() string {
+	return i.Project
+}
+
+func (i *ABIInfo) isDeleted() bool {
+	return i.Deleted != ""
+}
+
+// ValidSort checks the sort option is one that is supported
+func ValidSort(sortOption string) bool {
+	switch strings.TrimPrefix(sortOption, "-") {
+	case "", SortByCreated, SortByName, SortByID:
+		return true
+	default:
+		return false
+	}
+}
+
+func (o *ListOptions) less(i, j listable) bool {
+	field := o.Sort
+	if field == "" {
+		field = "-" + SortByCreated
+	}
+	descending := strings.HasPrefix(field, "-")
+	var vi, vj string
+	switch strings.TrimPrefix(field, "-") {
+	case SortByName:
+		vi, vj = i.getName(), j.getName()
+	case SortByID:
+		vi, vj = i.GetID(), j.GetID()
+	default:
+		vi, vj = i.GetISO8601(), j.GetISO8601()
+	}
+	if vi != vj {
+		return (vi < vj) != descending
+	}
+	// IDs are unique, so this gives a stable order for paging with After
+	return i.GetID() < j.GetID()
+}
+
+func (o *ListOptions) matches(entry listable) bool {
+	if entry.isDeleted() != o.Deleted {
+		return false
+	}
+	if o.Name != "" && entry.getName() != o.Name {
+		return false
+	}
+	if o.ABI != "" && entry.getABI() != o.ABI {
+		return false
+	}
+	if o.Project != "" && entry.getProject() != o.Project {
+		return false
+	}
+	if !o.CreatedAfter.IsZero() {
+		created, err := time.Parse(time.RFC3339, entry.GetISO8601())
+		if err != nil || !created.After(o.CreatedAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the requested page of entries, and the total number of entries that match the filters
+func (o *ListOptions) apply(entries []listable) ([]messages.TimeSortable, int) {
+	if o == nil {
+		o = &ListOptions{}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return o.less(entries[i], entries[j])
+	})
+
+	total := 0
+	afterFound := o.After == ""
+	skipped := 0
+	retval := make([]messages.TimeSortable, 0)
+	for _, entry := range entries {
+		if !o.matches(entry) {
+			if !afterFound && entry.GetID() == o.After {
+				afterFound = true
+			}
+			continue
+		}
+		total++
+		if !afterFound {
+			afterFound = entry.GetID() == o.After
+			continue
+		}
+		if skipped < o.Skip {
+			skipped++
+			continue
+		}
+		if o.Limit <= 0 || len(retval) < o.Limit {
+			retval = append(retval, entry)
+		}
+	}
+	return retval, total
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+)
+
+func testListEntries() []listable {
+	return []listable{
+		&ContractInfo{Address: "addr1", ABI: "abi1", RegisteredAs: "b", TimeSorted: messages.TimeSorted{CreatedISO8601: "2021-01-01T00:00:00Z"}},
+		&ContractInfo{Address: "addr2", ABI: "abi2", RegisteredAs: "a", Project: "p1", TimeSorted: messages.TimeSorted{CreatedISO8601: "2021-01-02T00:00:00Z"}},
+		&ContractInfo{Address: "addr3", ABI: "abi1", RegisteredAs: "c", Project: "p1", TimeSorted: messages.TimeSorted{CreatedISO8601: "2021-01-02T00:00:00Z"}},
+		&ContractInfo{Address: "addr4", ABI: "abi1", TimeSorted: messages.TimeSorted{CreatedISO8601: "not a time"}},
+	}
+}
+
+func ids(entries []messages.TimeSortable) []string {
+	retval := make([]string, len(entries))
+	for i, e := range entries {
+		retval[i] = e.GetID()
+	}
+	return retval
+}
+
+func TestListOptionsDefaultSortNewestFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	var opts *ListOptions
+	entries, total := opts.apply(testListEntries())
+	assert.Equal([]string{"addr4", "addr2", "addr3", "addr1"}, ids(entries))
+	assert.Equal(4, total)
+}
+
+func TestListOptionsFilterAndPage(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := &ListOptions{ABI: "abi1", Sort: SortByName, Limit: 1}
+	entries, total := opts.apply(testListEntries())
+	assert.Equal([]string{"addr4"}, ids(entries))
+	assert.Equal(3, total)
+
+	opts = &ListOptions{ABI: "abi1", Sort: SortByName, Skip: 1, Limit: 1}
+	entries, _ = opts.apply(testListEntries())
+	assert.Equal([]string{"addr1"}, ids(entries))
+
+	// Paging after an entry that does not itself match the filter
+	opts = &ListOptions{ABI: "abi1", Sort: SortByID, After: "addr2"}
+	entries, total = opts.apply(testListEntries())
+	assert.Equal([]string{"addr3", "addr4"}, ids(entries))
+	assert.Equal(3, total)
+
+	// Entries with an unparsable time never match a time filter
+	opts = &ListOptions{CreatedAfter: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Sort: "-" + SortByID}
+	entries, total = opts.apply(testListEntries())
+	assert.Equal([]string{"addr3", "addr2"}, ids(entries))
+	assert.Equal(2, total)
+
+	opts = &ListOptions{Name: "a"}
+	entries, _ = opts.apply(testListEntries())
+	assert.Equal([]string{"addr2"}, ids(entries))
+
+	opts = &ListOptions{Project: "p1", ABI: "abi1"}
+	entries, total = opts.apply(testListEntries())
+	assert.Equal([]string{"addr3"}, ids(entries))
+	assert.Equal(1, total)
+}
+
+func TestListOptionsDeleted(t *testing.T) {
+	assert := assert.New(t)
+
+	entries := append(testListEntries(), &ContractInfo{Address: "addr5", ABI: "abi1", Deleted: "2021-01-03T00:00:00Z"})
+	opts := &ListOptions{ABI: "abi1", Sort: SortByID}
+	listed, total := opts.apply(entries)
+	assert.Equal([]string{"addr1", "addr3", "addr4"}, ids(listed))
+	assert.Equal(3, total)
+
+	opts = &ListOptions{ABI: "abi1", Deleted: true}
+	listed, total = opts.apply(entries)
+	assert.Equal([]string{"addr5"}, ids(listed))
+	assert.Equal(1, total)
+}
+
+func TestValidSort(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(ValidSort(""))
+	assert.True(ValidSort("-created"))
+	assert.True(ValidSort("name"))
+	assert.True(ValidSort("-id"))
+	assert.False(ValidSort("address"))
+}
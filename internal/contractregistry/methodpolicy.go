@@ -0,0 +1,68 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// MethodPolicy restricts the methods of a registered contract that are exposed through
+// the generated REST API. Entries are either a method name, such as mint, or a signature
+// such as mint(address,uint256) to select a single overload
+type MethodPolicy struct {
+	// Allow lists the only methods exposed, when set
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists methods that are never exposed, and takes precedence over Allow
+	Deny []string `json:"deny,omitempty"`
+}
+
+// IsEmpty returns true if the policy does not restrict any methods
+func (p *MethodPolicy) IsEmpty() bool {
+	return p == nil || (len(p.Allow) == 0 && len(p.Deny) == 0)
+}
+
+// Permits returns true if the method is exposed by the policy. A nil policy permits all methods
+func (p *MethodPolicy) Permits(method *ethbinding.ABIElementMarshaling) bool {
+	if p.IsEmpty() {
+		return true
+	}
+	signature := FunctionSignature(method)
+	matches := func(entries []string) bool {
+		for _, entry := range entries {
+			if entry == method.Name || entry == signature {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(p.Deny) {
+		return false
+	}
+	return len(p.Allow) == 0 || matches(p.Allow)
+}
+
+// Filter returns the ABI with the functions the policy does not permit removed
+func (p *MethodPolicy) Filter(abi ethbinding.ABIMarshaling) ethbinding.ABIMarshaling {
+	if p.IsEmpty() {
+		return abi
+	}
+	filtered := make(ethbinding.ABIMarshaling, 0, len(abi))
+	for i := range abi {
+		if abi[i].Type != "function" || p.Permits(&abi[i]) {
+			filtered = append(filtered, abi[i])
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPolicyABI() ethbinding.ABIMarshaling {
+	return ethbinding.ABIMarshaling{
+		{Type: "function", Name: "balanceOf", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}}},
+		{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "address"}, {Type: "uint256"}}},
+		{Type: "function", Name: "mint", Inputs: []ethbinding.ABIArgumentMarshaling{{Type: "uint256"}}},
+		{Type: "event", Name: "Transfer"},
+	}
+}
+
+func TestMethodPolicyNil(t *testing.T) {
+	assert := assert.New(t)
+	var p *MethodPolicy
+	abi := testPolicyABI()
+	assert.True(p.IsEmpty())
+	assert.True(p.Permits(&abi[1]))
+	assert.Equal(abi, p.Filter(abi))
+}
+
+func TestMethodPolicyDeny(t *testing.T) {
+	assert := assert.New(t)
+	p := &MethodPolicy{Deny: []string{"mint(address,uint256)"}}
+	abi := testPolicyABI()
+	assert.True(p.Permits(&abi[0]))
+	assert.False(p.Permits(&abi[1]))
+	assert.True(p.Permits(&abi[2]))
+
+	filtered := p.Filter(abi)
+	assert.Equal(3, len(filtered))
+	assert.Equal("uint256", filtered[1].Inputs[0].Type)
+	assert.Equal("Transfer", filtered[2].Name)
+}
+
+func TestMethodPolicyAllow(t *testing.T) {
+	assert := assert.New(t)
+	p := &MethodPolicy{Allow: []string{"balanceOf", "mint"}, Deny: []string{"mint(uint256)"}}
+	abi := testPolicyABI()
+	assert.True(p.Permits(&abi[0]))
+	assert.True(p.Permits(&abi[1]))
+	assert.False(p.Permits(&abi[2]))
+
+	p = &MethodPolicy{Allow: []string{"balanceOf"}}
+	filtered := p.Filter(abi)
+	assert.Equal(2, len(filtered))
+	assert.Equal("balanceOf", filtered[0].Name)
+	assert.Equal("event", filtered[1].Type)
+}
@@ -0,0 +1,421 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	// Registers the postgres driver with database/sql
+	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+)
+
+const (
+	defaultPostgreSQLMaxOpenConns = 10
+	// Arbitrary key for the advisory lock that serializes migrations across gateway instances
+	postgresqlMigrationLockKey = 0x657468636f6e6e
+)
+
+// PostgreSQLIndexConf configures a PostgreSQL database to hold the contract index,
+// so it can be shared by multiple gateway instances
+type PostgreSQLIndexConf struct {
+	DSN          string `json:"dsn,omitempty"`
+	MaxOpenConns int    `json:"maxOpenConns,omitempty"`
+	MaxIdleConns int    `json:"maxIdleConns,omitempty"`
+}
+
+// The migrations are applied in order on startup, and the number applied is recorded
+// in the database. Never change a migration once released - only add new ones to the end.
+var postgresqlIndexMigrations = []string{
+	`CREATE TABLE abis (
+		id               VARCHAR(64) PRIMARY KEY,
+		name             TEXT NOT NULL,
+		description      TEXT NOT NULL,
+		path             TEXT NOT NULL,
+		deployable       BOOLEAN NOT NULL,
+		openapi          TEXT NOT NULL,
+		compiler_version TEXT NOT NULL,
+		created          TEXT NOT NULL
+	)`,
+	`CREATE TABLE contracts (
+		address       CHAR(40) PRIMARY KEY,
+		abi           VARCHAR(64) NOT NULL,
+		path          TEXT NOT NULL,
+		openapi       TEXT NOT NULL,
+		registered_as TEXT NOT NULL,
+		created       TEXT NOT NULL
+	)`,
+	`CREATE TABLE registrations (
+		name    TEXT PRIMARY KEY,
+		address CHAR(40) NOT NULL REFERENCES contracts (address)
+	)`,
+	`ALTER TABLE contracts ADD COLUMN standards TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN method_policy TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN param_defaults TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE abis ADD COLUMN compiler_settings TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE abis ADD COLUMN project TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN project TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE abis ADD COLUMN deleted TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN deleted TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN decimals TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN guards TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN abi_versions TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE contracts ADD COLUMN facets TEXT NOT NULL DEFAULT ''`,
+}
+
+const (
+	postgresqlContractColumns = `c.address, c.abi, c.path, c.openapi, c.registered_as, c.created, c.standards, c.method_policy, c.param_defaults, c.project, c.deleted, c.decimals, c.guards, c.abi_versions, c.facets`
+	postgresqlABIColumns      = `id, name, description, path, deployable, openapi, compiler_version, created, compiler_settings, project, deleted`
+)
+
+type postgresqlContractIndex struct {
+	conf       *PostgreSQLIndexConf
+	driverName string
+	db         *sql.DB
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func newPostgreSQLContractIndex(conf *PostgreSQLIndexConf) ContractIndex {
+	return &postgresqlContractIndex{
+		conf:       conf,
+		driverName: "postgres",
+	}
+}
+
+func (p *postgresqlContractIndex) Init() (err error) {
+	if p.db, err = sql.Open(p.driverName, p.conf.DSN); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexInit, err)
+	}
+	maxOpenConns := p.conf.MaxOpenConns
+	if maxOpenConns <= 0 {
+		maxOpenConns = defaultPostgreSQLMaxOpenConns
+	}
+	p.db.SetMaxOpenConns(maxOpenConns)
+	if p.conf.MaxIdleConns > 0 {
+		p.db.SetMaxIdleConns(p.conf.MaxIdleConns)
+	}
+	if err = p.db.Ping(); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexInit, err)
+	}
+	if err = p.migrate(); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexInit, err)
+	}
+	return nil
+}
+
+// migrate runs in a single transaction, holding an advisory lock so that
+// gateway instances starting at the same time do not race
+func (p *postgresqlContractIndex) migrate() error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresqlMigrationLockKey); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`CREATE TABLE IF NOT EXISTS contract_index_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM contract_index_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(postgresqlIndexMigrations); version++ {
+		log.Infof("Applying contract index migration %d", version+1)
+		if _, err = tx.Exec(postgresqlIndexMigrations[version]); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`INSERT INTO contract_index_migrations (version) VALUES ($1)`, version+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *postgresqlContractIndex) Close() {
+	if p.db != nil {
+		p.db.Close()
+	}
+}
+
+func (p *postgresqlContractIndex) IsEmpty() (bool, error) {
+	var count int
+	err := p.db.QueryRow(`SELECT (SELECT COUNT(*) FROM contracts) + (SELECT COUNT(*) FROM abis)`).Scan(&count)
+	if err != nil {
+		return false, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	return count == 0, nil
+}
+
+// AddContract upserts the contract, and inserts the registration if there is one.
+// Registering a name that is already registered to the same address is allowed,
+// so multiple gateway instances can safely build the index at the same time.
+func (p *postgresqlContractIndex) AddContract(info *ContractInfo) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO contracts (address, abi, path, openapi, registered_as, created, standards, method_policy, param_defaults, project, deleted, decimals, guards, abi_versions, facets) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (address) DO UPDATE SET abi = EXCLUDED.abi, path = EXCLUDED.path, openapi = EXCLUDED.openapi,
+		registered_as = EXCLUDED.registered_as, created = EXCLUDED.created, standards = EXCLUDED.standards, method_policy = EXCLUDED.method_policy,
+		param_defaults = EXCLUDED.param_defaults, project = EXCLUDED.project, deleted = EXCLUDED.deleted, decimals = EXCLUDED.decimals,
+		guards = EXCLUDED.guards, abi_versions = EXCLUDED.abi_versions, facets = EXCLUDED.facets`,
+		info.Address, info.ABI, info.Path, info.SwaggerURL, info.RegisteredAs, info.CreatedISO8601, strings.Join(info.Standards, ","), methodPolicyColumn(info), paramDefaultsColumn(info), info.Project, info.Deleted, decimalsColumn(info), guardsColumn(info), abiVersionsColumn(info), strings.Join(info.Facets, ","))
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	if info.RegisteredAs != "" {
+		// The no-op update on conflict returns the address of the existing registration
+		var registeredAddress string
+		err = tx.QueryRow(`INSERT INTO registrations (name, address) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING address`,
+			info.RegisteredAs, info.Address).Scan(&registeredAddress)
+		if err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+		}
+		if registeredAddress != info.Address {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFriendlyNameClash, registeredAddress, info.RegisteredAs)
+		}
+		log.Infof("Registering %s as '%s'", info.Address, info.RegisteredAs)
+	}
+	if err = tx.Commit(); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
+
+// UpdateContract replaces the columns of a contract that has already been added. The
+// registration refers to the contract by address, so does not need to be updated
+func (p *postgresqlContractIndex) UpdateContract(info *ContractInfo) error {
+	_, err := p.db.Exec(`UPDATE contracts SET abi = $2, path = $3, openapi = $4, registered_as = $5, created = $6, standards = $7, method_policy = $8,
+		param_defaults = $9, project = $10, deleted = $11, decimals = $12, guards = $13, abi_versions = $14, facets = $15 WHERE address = $1`,
+		info.Address, info.ABI, info.Path, info.SwaggerURL, info.RegisteredAs, info.CreatedISO8601, strings.Join(info.Standards, ","), methodPolicyColumn(info), paramDefaultsColumn(info), info.Project, info.Deleted, decimalsColumn(info), guardsColumn(info), abiVersionsColumn(info), strings.Join(info.Facets, ","))
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
+
+// DeleteContract removes a contract, and releases its registered name.
+// The registration is removed before the contract it refers to
+func (p *postgresqlContractIndex) DeleteContract(info *ContractInfo) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`DELETE FROM registrations WHERE address = $1`, info.Address); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	if _, err = tx.Exec(`DELETE FROM contracts WHERE address = $1`, info.Address); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
+
+// methodPolicyColumn serializes the method policy of a contract as JSON, or empty if there is none
+func methodPolicyColumn(info *ContractInfo) string {
+	if info.MethodPolicy == nil {
+		return ""
+	}
+	b, _ := json.Marshal(info.MethodPolicy)
+	return string(b)
+}
+
+// paramDefaultsColumn serializes the parameter defaults of a contract as JSON, or empty if there are none
+func paramDefaultsColumn(info *ContractInfo) string {
+	if len(info.ParamDefaults) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(info.ParamDefaults)
+	return string(b)
+}
+
+// decimalsColumn serializes the token decimals of a contract as JSON, or empty if there are none
+func decimalsColumn(info *ContractInfo) string {
+	if len(info.Decimals) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(info.Decimals)
+	return string(b)
+}
+
+// guardsColumn serializes the guards of a contract as JSON, or empty if there are none
+func guardsColumn(info *ContractInfo) string {
+	if len(info.Guards) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(info.Guards)
+	return string(b)
+}
+
+// abiVersionsColumn serializes the ABI version history of a contract as JSON, or empty if it has not been upgraded
+func abiVersionsColumn(info *ContractInfo) string {
+	if len(info.ABIVersions) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(info.ABIVersions)
+	return string(b)
+}
+
+func (p *postgresqlContractIndex) scanContract(row rowScanner) (*ContractInfo, error) {
+	info := &ContractInfo{}
+	var standards, methodPolicy, paramDefaults, decimals, guards, abiVersions, facets string
+	err := row.Scan(&info.Address, &info.ABI, &info.Path, &info.SwaggerURL, &info.RegisteredAs, &info.CreatedISO8601, &standards, &methodPolicy, &paramDefaults, &info.Project, &info.Deleted, &decimals, &guards, &abiVersions, &facets)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	if standards != "" {
+		info.Standards = strings.Split(standards, ",")
+	}
+	if methodPolicy != "" {
+		info.MethodPolicy = &MethodPolicy{}
+		if err := json.Unmarshal([]byte(methodPolicy), info.MethodPolicy); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	if paramDefaults != "" {
+		if err := json.Unmarshal([]byte(paramDefaults), &info.ParamDefaults); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	if decimals != "" {
+		if err := json.Unmarshal([]byte(decimals), &info.Decimals); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	if guards != "" {
+		if err := json.Unmarshal([]byte(guards), &info.Guards); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	if abiVersions != "" {
+		if err := json.Unmarshal([]byte(abiVersions), &info.ABIVersions); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	if facets != "" {
+		info.Facets = strings.Split(facets, ",")
+	}
+	return info, nil
+}
+
+func (p *postgresqlContractIndex) GetContract(address string) (*ContractInfo, error) {
+	return p.scanContract(p.db.QueryRow(`SELECT `+postgresqlContractColumns+` FROM contracts c WHERE c.address = $1`, address))
+}
+
+func (p *postgresqlContractIndex) GetRegistration(name string) (*ContractInfo, error) {
+	return p.scanContract(p.db.QueryRow(`SELECT `+postgresqlContractColumns+` FROM registrations r
+		JOIN contracts c ON c.address = r.address WHERE r.name = $1`, name))
+}
+
+func (p *postgresqlContractIndex) ListContracts() ([]*ContractInfo, error) {
+	rows, err := p.db.Query(`SELECT ` + postgresqlContractColumns + ` FROM contracts c`)
+	if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	defer rows.Close()
+	retval := make([]*ContractInfo, 0)
+	for rows.Next() {
+		info, err := p.scanContract(rows)
+		if err != nil {
+			return nil, err
+		}
+		retval = append(retval, info)
+	}
+	return retval, nil
+}
+
+func (p *postgresqlContractIndex) AddABI(info *ABIInfo) error {
+	_, err := p.db.Exec(`INSERT INTO abis (`+postgresqlABIColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description, path = EXCLUDED.path,
+		deployable = EXCLUDED.deployable, openapi = EXCLUDED.openapi, compiler_version = EXCLUDED.compiler_version, created = EXCLUDED.created,
+		compiler_settings = EXCLUDED.compiler_settings, project = EXCLUDED.project, deleted = EXCLUDED.deleted, decimals = EXCLUDED.decimals`,
+		info.ID, info.Name, info.Description, info.Path, info.Deployable, info.SwaggerURL, info.CompilerVersion, info.CreatedISO8601, compilerSettingsColumn(info), info.Project, info.Deleted)
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
+
+// compilerSettingsColumn serializes the compiler settings of an ABI as JSON, or empty if there are none
+func compilerSettingsColumn(info *ABIInfo) string {
+	if info.CompilerSettings == nil {
+		return ""
+	}
+	b, _ := json.Marshal(info.CompilerSettings)
+	return string(b)
+}
+
+func (p *postgresqlContractIndex) scanABI(row rowScanner) (*ABIInfo, error) {
+	info := &ABIInfo{}
+	var compilerSettings string
+	err := row.Scan(&info.ID, &info.Name, &info.Description, &info.Path, &info.Deployable, &info.SwaggerURL, &info.CompilerVersion, &info.CreatedISO8601, &compilerSettings, &info.Project, &info.Deleted)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	if compilerSettings != "" {
+		info.CompilerSettings = &messages.CompilerSettings{}
+		if err := json.Unmarshal([]byte(compilerSettings), info.CompilerSettings); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+		}
+	}
+	return info, nil
+}
+
+func (p *postgresqlContractIndex) GetABI(id string) (*ABIInfo, error) {
+	return p.scanABI(p.db.QueryRow(`SELECT `+postgresqlABIColumns+` FROM abis WHERE id = $1`, id))
+}
+
+func (p *postgresqlContractIndex) ListABIs() ([]*ABIInfo, error) {
+	rows, err := p.db.Query(`SELECT ` + postgresqlABIColumns + ` FROM abis`)
+	if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexQuery, err)
+	}
+	defer rows.Close()
+	retval := make([]*ABIInfo, 0)
+	for rows.Next() {
+		info, err := p.scanABI(rows)
+		if err != nil {
+			return nil, err
+		}
+		retval = append(retval, info)
+	}
+	return retval, nil
+}
+
+func (p *postgresqlContractIndex) DeleteABI(id string) error {
+	if _, err := p.db.Exec(`DELETE FROM abis WHERE id = $1`, id); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreIndexUpdate, err)
+	}
+	return nil
+}
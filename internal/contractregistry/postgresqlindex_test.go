@@ -0,0 +1,463 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+var testContractColumns = []string{"address", "abi", "path", "openapi", "registered_as", "created", "standards", "method_policy", "param_defaults", "project", "deleted", "decimals", "guards", "abi_versions", "facets"}
+var testABIColumns = []string{"id", "name", "description", "path", "deployable", "openapi", "compiler_version", "created", "compiler_settings", "project", "deleted"}
+
+func newTestPostgreSQLIndex(t *testing.T) (*postgresqlContractIndex, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	idx := newPostgreSQLContractIndex(&PostgreSQLIndexConf{}).(*postgresqlContractIndex)
+	idx.db = db
+	return idx, mock
+}
+
+func TestPostgreSQLIndexInitMigrates(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.NewWithDSN("postgresql-index-init", sqlmock.MonitorPingsOption(true))
+	assert.NoError(err)
+	defer db.Close()
+	mock.ExpectPing()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS contract_index_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec("CREATE TABLE contracts").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CREATE TABLE registrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN standards").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN method_policy").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN param_defaults").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(6).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE abis ADD COLUMN compiler_settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE abis ADD COLUMN project").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN project").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE abis ADD COLUMN deleted").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN deleted").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(11).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN decimals").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(12).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN guards").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(13).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN abi_versions").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(14).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE contracts ADD COLUMN facets").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO contract_index_migrations").WithArgs(15).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	idx := newPostgreSQLContractIndex(&PostgreSQLIndexConf{
+		DSN:          "postgresql-index-init",
+		MaxIdleConns: 1,
+	}).(*postgresqlContractIndex)
+	idx.driverName = "sqlmock"
+	err = idx.Init()
+	assert.NoError(err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexInitBadDriver(t *testing.T) {
+	assert := assert.New(t)
+
+	idx := newPostgreSQLContractIndex(&PostgreSQLIndexConf{DSN: "any"}).(*postgresqlContractIndex)
+	idx.driverName = "unknown"
+	err := idx.Init()
+	assert.Regexp("Failed to initialize contract index database", err)
+	idx.Close()
+}
+
+func TestPostgreSQLIndexInitPingFail(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.NewWithDSN("postgresql-index-pingfail", sqlmock.MonitorPingsOption(true))
+	assert.NoError(err)
+	defer db.Close()
+	mock.ExpectPing().WillReturnError(fmt.Errorf("pop"))
+
+	idx := newPostgreSQLContractIndex(&PostgreSQLIndexConf{DSN: "postgresql-index-pingfail"}).(*postgresqlContractIndex)
+	idx.driverName = "sqlmock"
+	err = idx.Init()
+	assert.Regexp("Failed to initialize contract index database: pop", err)
+}
+
+func TestPostgreSQLIndexMigrateFail(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS contract_index_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+	mock.ExpectExec("CREATE TABLE abis").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+
+	err := idx.migrate()
+	assert.Regexp("pop", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexIsEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT").WillReturnError(fmt.Errorf("pop"))
+
+	empty, err := idx.IsEmpty()
+	assert.NoError(err)
+	assert.True(empty)
+	_, err = idx.IsEmpty()
+	assert.Regexp("Failed to query contract index: pop", err)
+}
+
+func TestPostgreSQLIndexAddContractWithRegistration(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").
+		WithArgs("addr1", "abi1", "/contracts/name1", "http://localhost/contracts/name1?swagger", "name1", "2021-01-01T00:00:00Z", "erc20", `{"deny":["mint"]}`, "", "", "", "", "", "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO registrations").WithArgs("name1", "addr1").
+		WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow("addr1"))
+	mock.ExpectCommit()
+
+	info := &ContractInfo{
+		Address:      "addr1",
+		ABI:          "abi1",
+		Path:         "/contracts/name1",
+		SwaggerURL:   "http://localhost/contracts/name1?swagger",
+		RegisteredAs: "name1",
+		Standards:    []string{"erc20"},
+		MethodPolicy: &MethodPolicy{Deny: []string{"mint"}},
+	}
+	info.CreatedISO8601 = "2021-01-01T00:00:00Z"
+	err := idx.AddContract(info)
+	assert.NoError(err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexAddContractNameClash(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO registrations").
+		WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow("addr2"))
+	mock.ExpectRollback()
+
+	err := idx.AddContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1"})
+	assert.Regexp("Contract address addr2 is already registered for name 'name1'", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexAddContractFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("pop1"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").WillReturnError(fmt.Errorf("pop2"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO registrations").WillReturnError(fmt.Errorf("pop3"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO contracts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("pop4"))
+
+	for i := 1; i <= 3; i++ {
+		err := idx.AddContract(&ContractInfo{Address: "addr1", RegisteredAs: "name1"})
+		assert.Regexp(fmt.Sprintf("Failed to update contract index: pop%d", i), err)
+	}
+	err := idx.AddContract(&ContractInfo{Address: "addr1"})
+	assert.Regexp("Failed to update contract index: pop4", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetContracts(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "", "", "", "", "", "", "", ""))
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr2").
+		WillReturnRows(sqlmock.NewRows(testContractColumns))
+	mock.ExpectQuery("SELECT .* FROM registrations r").WithArgs("name1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr3", "abi1", "/contracts/name1", "", "name1", "2021-01-01T00:00:00Z", "erc721,erc1155", `{"allow":["balanceOf"]}`, `{"gas":"100000"}`, "proj1", "", `{"transfer.amount":18}`, `[{"function":"hasRole(bytes32,address)","params":["0x01","${from}"]}]`, `[{"abi":"abi0","fromBlock":"0"},{"abi":"abi1","fromBlock":"100"}]`, "facet1,facet2"))
+	mock.ExpectQuery("SELECT .* FROM registrations r").WithArgs("name2").
+		WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).
+			AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "", "", "", "", "", "", "", "").
+			AddRow("addr3", "abi1", "/contracts/name1", "", "name1", "2021-01-01T00:00:00Z", "erc721,erc1155", `{"allow":["balanceOf"]}`, "", "proj1", "", "", "", "", ""))
+	mock.ExpectQuery("SELECT .* FROM contracts c").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c").
+		WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow("addr1"))
+
+	info, err := idx.GetContract("addr1")
+	assert.NoError(err)
+	assert.Equal("abi1", info.ABI)
+	assert.Equal("2021-01-01T00:00:00Z", info.CreatedISO8601)
+	info, err = idx.GetContract("addr2")
+	assert.NoError(err)
+	assert.Nil(info)
+	info, err = idx.GetRegistration("name1")
+	assert.NoError(err)
+	assert.Equal("addr3", info.Address)
+	assert.Equal([]string{"erc721", "erc1155"}, info.Standards)
+	assert.Equal(&MethodPolicy{Allow: []string{"balanceOf"}}, info.MethodPolicy)
+	assert.Equal(map[string]string{"gas": "100000"}, info.ParamDefaults)
+	assert.Equal(map[string]int{"transfer.amount": 18}, info.Decimals)
+	assert.Equal([]*MethodGuard{{Function: "hasRole(bytes32,address)", Params: []string{"0x01", "${from}"}}}, info.Guards)
+	assert.Equal([]*ABIVersion{{ABI: "abi0", FromBlock: "0"}, {ABI: "abi1", FromBlock: "100"}}, info.ABIVersions)
+	assert.Equal([]string{"facet1", "facet2"}, info.Facets)
+	assert.Equal("proj1", info.Project)
+	_, err = idx.GetRegistration("name2")
+	assert.Regexp("Failed to query contract index: pop", err)
+
+	contracts, err := idx.ListContracts()
+	assert.NoError(err)
+	assert.Equal(2, len(contracts))
+	assert.Equal("name1", contracts[1].RegisteredAs)
+	_, err = idx.ListContracts()
+	assert.Regexp("Failed to query contract index: pop", err)
+	_, err = idx.ListContracts()
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexABIs(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectExec("INSERT INTO abis").
+		WithArgs("abi1", "simple", "desc", "/abis/abi1", true, "http://localhost/abis/abi1?swagger", "0.8.0", "2021-01-01T00:00:00Z", `{"evmVersion":"london","optimize":true,"optimizeRuns":1000}`, "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO abis").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM abis WHERE id").WithArgs("abi1").
+		WillReturnRows(sqlmock.NewRows(testABIColumns).AddRow("abi1", "simple", "desc", "/abis/abi1", true, "", "0.8.0", "2021-01-01T00:00:00Z", `{"evmVersion":"london","optimize":true}`, "proj1", ""))
+	mock.ExpectQuery("SELECT .* FROM abis WHERE id").WithArgs("abi2").
+		WillReturnRows(sqlmock.NewRows(testABIColumns))
+	mock.ExpectQuery("SELECT .* FROM abis").
+		WillReturnRows(sqlmock.NewRows(testABIColumns).AddRow("abi1", "simple", "desc", "/abis/abi1", true, "", "0.8.0", "2021-01-01T00:00:00Z", "", "", ""))
+	mock.ExpectQuery("SELECT .* FROM abis").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM abis").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("abi1"))
+
+	info := &ABIInfo{
+		ID:              "abi1",
+		Name:            "simple",
+		Description:     "desc",
+		Path:            "/abis/abi1",
+		Deployable:      true,
+		SwaggerURL:      "http://localhost/abis/abi1?swagger",
+		CompilerVersion: "0.8.0",
+		CompilerSettings: &messages.CompilerSettings{
+			EVMVersion:   "london",
+			Optimize:     true,
+			OptimizeRuns: 1000,
+		},
+	}
+	info.CreatedISO8601 = "2021-01-01T00:00:00Z"
+	err := idx.AddABI(info)
+	assert.NoError(err)
+	err = idx.AddABI(info)
+	assert.Regexp("Failed to update contract index: pop", err)
+
+	abiInfo, err := idx.GetABI("abi1")
+	assert.NoError(err)
+	assert.True(abiInfo.Deployable)
+	assert.Equal("london", abiInfo.CompilerSettings.EVMVersion)
+	assert.Equal("proj1", abiInfo.Project)
+	abiInfo, err = idx.GetABI("abi2")
+	assert.NoError(err)
+	assert.Nil(abiInfo)
+
+	abis, err := idx.ListABIs()
+	assert.NoError(err)
+	assert.Equal(1, len(abis))
+	assert.Nil(abis[0].CompilerSettings)
+	_, err = idx.ListABIs()
+	assert.Regexp("Failed to query contract index: pop", err)
+	_, err = idx.ListABIs()
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetContractBadMethodPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "!json", "", "", "", "", "", "", ""))
+
+	_, err := idx.GetContract("addr1")
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetContractBadParamDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "", "!json", "", "", "", "", "", ""))
+
+	_, err := idx.GetContract("addr1")
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetContractBadDecimals(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "", "", "", "", "!json", "", "", ""))
+
+	_, err := idx.GetContract("addr1")
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetContractBadGuards(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "", "", "", "", "", "!json", "", ""))
+
+	_, err := idx.GetContract("addr1")
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetContractBadABIVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WithArgs("addr1").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "/contracts/addr1", "", "", "2021-01-01T00:00:00Z", "", "", "", "", "", "", "", "!json", ""))
+
+	_, err := idx.GetContract("addr1")
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexGetABIBadCompilerSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectQuery("SELECT .* FROM abis WHERE id").WithArgs("abi1").
+		WillReturnRows(sqlmock.NewRows(testABIColumns).AddRow("abi1", "simple", "desc", "/abis/abi1", true, "", "0.8.0", "2021-01-01T00:00:00Z", "!json", "", ""))
+
+	_, err := idx.GetABI("abi1")
+	assert.Regexp("Failed to query contract index", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexUpdateContract(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectExec("UPDATE contracts").
+		WithArgs("addr1", "abi1", "/contracts/name1", "", "name1", "", "", `{"deny":["mint"]}`, `{"from":"0x12345"}`, "proj1", "2021-02-01T00:00:00Z", `{"transfer.amount":18}`, "", `[{"abi":"abi0","fromBlock":"0","created":""},{"abi":"abi1","fromBlock":"100","created":""}]`, "facet1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE contracts").WillReturnError(fmt.Errorf("pop"))
+
+	info := &ContractInfo{
+		Address:       "addr1",
+		ABI:           "abi1",
+		Path:          "/contracts/name1",
+		RegisteredAs:  "name1",
+		MethodPolicy:  &MethodPolicy{Deny: []string{"mint"}},
+		ParamDefaults: map[string]string{"from": "0x12345"},
+		Decimals:      map[string]int{"transfer.amount": 18},
+		ABIVersions:   []*ABIVersion{{ABI: "abi0", FromBlock: "0"}, {ABI: "abi1", FromBlock: "100"}},
+		Facets:        []string{"facet1"},
+		Project:       "proj1",
+		Deleted:       "2021-02-01T00:00:00Z",
+	}
+	err := idx.UpdateContract(info)
+	assert.NoError(err)
+	err = idx.UpdateContract(info)
+	assert.Regexp("Failed to update contract index: pop", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexDeleteContract(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM registrations").WithArgs("addr1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM contracts").WithArgs("addr1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM registrations").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM registrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM contracts").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM registrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM contracts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("pop"))
+
+	info := &ContractInfo{Address: "addr1", RegisteredAs: "name1"}
+	err := idx.DeleteContract(info)
+	assert.NoError(err)
+	for i := 0; i < 4; i++ {
+		err = idx.DeleteContract(info)
+		assert.Regexp("Failed to update contract index: pop", err)
+	}
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLIndexDeleteABI(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	mock.ExpectExec("DELETE FROM abis").WithArgs("abi1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM abis").WillReturnError(fmt.Errorf("pop"))
+
+	err := idx.DeleteABI("abi1")
+	assert.NoError(err)
+	err = idx.DeleteABI("abi1")
+	assert.Regexp("Failed to update contract index: pop", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"regexp"
+	"sort"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+var projectNameCheck = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// ProjectInfo summarizes the ABIs and contracts grouped under a project, so the
+// registry can be browsed by application
+type ProjectInfo struct {
+	Name      string `json:"name"`
+	ABIs      int    `json:"abis"`
+	Contracts int    `json:"contracts"`
+}
+
+// ValidateProjectName checks a project name can be used in a path or query string
+// without escaping. An empty name is valid, and means no project
+func ValidateProjectName(project string) error {
+	if project != "" && !projectNameCheck.MatchString(project) {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidProjectName, project)
+	}
+	return nil
+}
+
+// ListProjects returns the projects that have at least one ABI or contract that is not deleted, sorted by name
+func (cs *contractStore) ListProjects() ([]*ProjectInfo, error) {
+	abis, err := cs.index.ListABIs()
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := cs.index.ListContracts()
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string]*ProjectInfo)
+	project := func(name string) *ProjectInfo {
+		p, exists := projects[name]
+		if !exists {
+			p = &ProjectInfo{Name: name}
+			projects[name] = p
+		}
+		return p
+	}
+	for _, info := range abis {
+		if info.Project != "" && info.Deleted == "" {
+			project(info.Project).ABIs++
+		}
+	}
+	for _, info := range contracts {
+		if info.Project != "" && info.Deleted == "" {
+			project(info.Project).Contracts++
+		}
+	}
+	retval := make([]*ProjectInfo, 0, len(projects))
+	for _, p := range projects {
+		retval = append(retval, p)
+	}
+	sort.Slice(retval, func(i, j int) bool { return retval[i].Name < retval[j].Name })
+	return retval, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateProjectName(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(ValidateProjectName(""))
+	assert.NoError(ValidateProjectName("payments"))
+	assert.NoError(ValidateProjectName("Team_1.payments-v2"))
+	assert.Regexp("Invalid project name '-payments'", ValidateProjectName("-payments"))
+	assert.Regexp("Invalid project name 'a b'", ValidateProjectName("a b"))
+	assert.Regexp("Invalid project name 'a/b'", ValidateProjectName("a/b"))
+}
+
+func TestListProjects(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{})
+	err := cs.Init()
+	assert.NoError(err)
+	defer cs.Close()
+
+	projects, err := cs.ListProjects()
+	assert.NoError(err)
+	assert.Empty(projects)
+
+	_, err = cs.AddABI("abi1", &messages.DeployContract{ContractName: "c1", Project: "payments"}, time.Now())
+	assert.NoError(err)
+	_, err = cs.AddABI("abi2", &messages.DeployContract{ContractName: "c2"}, time.Now())
+	assert.NoError(err)
+	_, err = cs.AddContract("0123456789abcdef0123456789abcdef01234567", "abi1", "c1", "c1", nil)
+	assert.NoError(err)
+	_, err = cs.AddContract("1123456789abcdef0123456789abcdef01234567", "abi2", "c2", "c2", nil)
+	assert.NoError(err)
+	_, err = cs.SetProject("1123456789abcdef0123456789abcdef01234567", "audit")
+	assert.NoError(err)
+
+	projects, err = cs.ListProjects()
+	assert.NoError(err)
+	assert.Equal([]*ProjectInfo{
+		{Name: "audit", Contracts: 1},
+		{Name: "payments", ABIs: 1},
+	}, projects)
+}
+
+func TestListProjectsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	cs := &contractStore{index: idx}
+	mock.ExpectQuery("SELECT .* FROM abis").WillReturnError(fmt.Errorf("pop"))
+	_, err := cs.ListProjects()
+	assert.Regexp("pop", err)
+
+	mock.ExpectQuery("SELECT .* FROM abis").WillReturnRows(sqlmock.NewRows(testABIColumns))
+	mock.ExpectQuery("SELECT .* FROM contracts c").WillReturnError(fmt.Errorf("pop"))
+	_, err = cs.ListProjects()
+	assert.Regexp("pop", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,282 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+const (
+	defaultS3Region    = "us-east-1"
+	defaultS3TimeoutMS = 30000
+	awsDateTimeFormat  = "20060102T150405Z"
+	awsDateFormat      = "20060102"
+)
+
+// S3ArtifactStoreConf configures an S3 compatible object store for the local contract registry.
+// The bucket and prefix are part of the store URL. Credentials and region fall back to
+// the standard AWS environment variables when not set.
+// The endpoint only needs to be set for S3 compatible stores other than AWS, such as MinIO,
+// in which case path style addressing is used for the bucket.
+type S3ArtifactStoreConf struct {
+	Endpoint        string `json:"endpoint,omitempty"`
+	Region          string `json:"region,omitempty"`
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+type s3ArtifactStore struct {
+	conf    S3ArtifactStoreConf
+	baseURL *url.URL
+	prefix  string
+	client  *http.Client
+	now     func() time.Time
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+	}
+}
+
+// NewS3ArtifactStore constructs an artifact store backed by objects in an S3 compatible
+// bucket, from a store URL of the form s3://bucket/prefix
+func NewS3ArtifactStore(storeURL string, conf *S3ArtifactStoreConf) (ArtifactStore, error) {
+	u, err := url.Parse(storeURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ConfigRESTGatewayS3StoreURL, storeURL)
+	}
+	s := &s3ArtifactStore{
+		conf:   *conf,
+		client: &http.Client{Timeout: defaultS3TimeoutMS * time.Millisecond},
+		now:    time.Now,
+	}
+	if s.conf.Region == "" {
+		s.conf.Region = os.Getenv("AWS_REGION")
+	}
+	if s.conf.Region == "" {
+		s.conf.Region = defaultS3Region
+	}
+	if s.conf.AccessKeyID == "" {
+		s.conf.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.conf.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.conf.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	bucket := u.Host
+	baseURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, s.conf.Region)
+	if s.conf.Endpoint != "" {
+		baseURL = strings.TrimSuffix(s.conf.Endpoint, "/") + "/" + bucket
+	}
+	if s.baseURL, err = url.Parse(baseURL); err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ConfigRESTGatewayS3StoreURL, baseURL)
+	}
+	if s.prefix = strings.Trim(u.Path, "/"); s.prefix != "" {
+		s.prefix += "/"
+	}
+	log.Infof("Contract store using S3 bucket '%s' at %s with prefix '%s'", bucket, s.baseURL, s.prefix)
+	return s, nil
+}
+
+func (s *s3ArtifactStore) objectKey(artifactType ArtifactType, id string) string {
+	return s.prefix + artifactFileFormats[artifactType].name(id)
+}
+
+func (s *s3ArtifactStore) Get(artifactType ArtifactType, id string) ([]byte, error) {
+	return s.do(http.MethodGet, s.objectKey(artifactType, id), nil, nil)
+}
+
+func (s *s3ArtifactStore) Put(artifactType ArtifactType, id string, data []byte) error {
+	_, err := s.do(http.MethodPut, s.objectKey(artifactType, id), nil, data)
+	return err
+}
+
+func (s *s3ArtifactStore) List(artifactType ArtifactType) ([]*ArtifactEntry, error) {
+	format := artifactFileFormats[artifactType]
+	entries := make([]*ArtifactEntry, 0)
+	query := url.Values{
+		"list-type": []string{"2"},
+		"prefix":    []string{s.prefix + format.prefix},
+	}
+	for {
+		resBody, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListBucketResult
+		if err = xml.Unmarshal(resBody, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			if groups := format.matcher.FindStringSubmatch(strings.TrimPrefix(object.Key, s.prefix)); groups != nil {
+				entries = append(entries, &ArtifactEntry{
+					ID:       groups[1],
+					Modified: object.LastModified,
+				})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return entries, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *s3ArtifactStore) Delete(artifactType ArtifactType, id string) error {
+	_, err := s.do(http.MethodDelete, s.objectKey(artifactType, id), nil, nil)
+	return err
+}
+
+func (s *s3ArtifactStore) do(method, key string, query url.Values, body []byte) ([]byte, error) {
+	u := *s.baseURL
+	u.Path = s.baseURL.Path + "/" + key
+	u.RawPath = awsURIEncode(u.Path, false)
+	// SigV4 requires spaces encoded as %20 in the canonical query
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	req, _ := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if s.conf.AccessKeyID != "" {
+		payloadHash := sha256Hex(body)
+		req.Header.Set("x-amz-date", s.now().UTC().Format(awsDateTimeFormat))
+		req.Header.Set("x-amz-content-sha256", payloadHash)
+		if s.conf.SessionToken != "" {
+			req.Header.Set("x-amz-security-token", s.conf.SessionToken)
+		}
+		signV4(req, payloadHash, s.conf.Region, "s3", s.conf.AccessKeyID, s.conf.SecretAccessKey)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreS3Request, method, key, 0, err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreS3Request, method, key, res.StatusCode, string(resBody))
+	}
+	return resBody, err
+}
+
+// signV4 adds an AWS Signature Version 4 authorization header to the request,
+// signing the host and every header already set on the request.
+// The x-amz-date header must have been set before calling.
+func signV4(req *http.Request, payloadHash, region, service, accessKeyID, secretAccessKey string) {
+	amzDateTime := req.Header.Get("x-amz-date")
+	t, _ := time.Parse(awsDateTimeFormat, amzDateTime)
+	scope := strings.Join([]string{t.Format(awsDateFormat), region, service, "aws4_request"}, "/")
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.TrimSpace(v)
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDateTime,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), t.Format(awsDateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(query))
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode encodes everything except the RFC 3986 unreserved characters
+func awsURIEncode(s string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9'),
+			b == '-', b == '_', b == '.', b == '~',
+			b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
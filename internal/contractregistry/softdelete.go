@@ -0,0 +1,213 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ethconnecterrors "github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+const defaultPurgeInterval = 1 * time.Hour
+
+// IsDeleted is true for the error returned when accessing a contract or ABI that has been soft-deleted
+func IsDeleted(err error) bool {
+	if e, ok := err.(ethconnecterrors.EthconnectError); ok {
+		return e.Code() == ethconnecterrors.RESTGatewayContractDeleted.Code() || e.Code() == ethconnecterrors.RESTGatewayABIDeleted.Code()
+	}
+	return false
+}
+
+// getContractByAddressOrName returns a contract by address, or by registered name, including one that has been deleted
+func (cs *contractStore) getContractByAddressOrName(addrHexOrName string) (*ContractInfo, error) {
+	info, err := cs.index.GetContract(strings.TrimPrefix(strings.ToLower(addrHexOrName), "0x"))
+	if err != nil || info != nil {
+		return info, err
+	}
+	nameUnescaped, _ := url.QueryUnescape(addrHexOrName)
+	if info, err = cs.index.GetRegistration(nameUnescaped); err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexOrName)
+	}
+	return info, nil
+}
+
+// DeleteContract marks a contract as deleted, so it is hidden from listings and cannot be called,
+// until it is restored or purged. The registered name of the contract stays reserved until it is purged
+func (cs *contractStore) DeleteContract(addrHexOrName string) (*ContractInfo, error) {
+	existing, err := cs.getContractByAddressOrName(addrHexOrName)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Deleted != "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayContractDeleted, addrHexOrName, existing.Deleted)
+	}
+	log.Infof("Deleting contract %s", existing.Address)
+	return cs.updateContractInfo(existing.Address, func(info *ContractInfo) {
+		info.Deleted = time.Now().UTC().Format(time.RFC3339)
+	})
+}
+
+// RestoreContract clears the deletion of a contract. The ABI of the contract must not be deleted
+func (cs *contractStore) RestoreContract(addrHexOrName string) (*ContractInfo, error) {
+	existing, err := cs.getContractByAddressOrName(addrHexOrName)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Deleted == "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayContractNotDeleted, addrHexOrName)
+	}
+	abiInfo, err := cs.getABIInfo(existing.ABI)
+	if err != nil {
+		return nil, err
+	}
+	if abiInfo.Deleted != "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayContractABIDeleted, existing.ABI)
+	}
+	log.Infof("Restoring contract %s", existing.Address)
+	return cs.updateContractInfo(existing.Address, func(info *ContractInfo) {
+		info.Deleted = ""
+	})
+}
+
+// DeleteABI marks an ABI as deleted, so it is hidden from listings and cannot be deployed or
+// registered against, until it is restored or purged. An ABI can only be deleted once no contracts
+// are registered against it, although existing event subscriptions continue to use it
+func (cs *contractStore) DeleteABI(abiID string) (*ABIInfo, error) {
+	existing, err := cs.GetLocalABIInfo(abiID)
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := cs.index.ListContracts()
+	if err != nil {
+		return nil, err
+	}
+	inUse := 0
+	for _, info := range contracts {
+		if info.Deleted == "" && info.usesABI(abiID) {
+			inUse++
+		}
+	}
+	if inUse > 0 {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayABIInUse, abiID, inUse)
+	}
+	log.Infof("Deleting ABI %s", abiID)
+	return cs.setABIDeleted(existing, time.Now().UTC().Format(time.RFC3339))
+}
+
+// RestoreABI clears the deletion of an ABI
+func (cs *contractStore) RestoreABI(abiID string) (*ABIInfo, error) {
+	existing, err := cs.getABIInfo(abiID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Deleted == "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayABINotDeleted, abiID)
+	}
+	log.Infof("Restoring ABI %s", abiID)
+	return cs.setABIDeleted(existing, "")
+}
+
+// setABIDeleted records the deletion in the stored deployment message, which the index is built
+// from, as well as in the index
+func (cs *contractStore) setABIDeleted(existing *ABIInfo, deleted string) (*ABIInfo, error) {
+	deployMsg, err := cs.loadDeployMsg(existing.ID)
+	if err != nil {
+		return nil, err
+	}
+	deployMsg.Deleted = deleted
+	if err := cs.StoreABI(existing.ID, deployMsg); err != nil {
+		return nil, err
+	}
+	// The index may hold the existing entry in memory, so it is updated with a copy
+	info := *existing
+	info.Deleted = deleted
+	if err := cs.index.AddABI(&info); err != nil {
+		return nil, err
+	}
+	cs.abiCache.Remove(ABILocation{ABIType: LocalABI, Name: existing.ID})
+	return &info, nil
+}
+
+// isPurgeable is true for an entry deleted before the cutoff
+func isPurgeable(deleted string, cutoff time.Time) bool {
+	if deleted == "" {
+		return false
+	}
+	deletedTime, err := time.Parse(time.RFC3339, deleted)
+	return err == nil && deletedTime.Before(cutoff)
+}
+
+// purgeDeleted permanently removes the contracts and ABIs that were deleted longer ago than
+// the configured retention, from the index and the artifact store
+func (cs *contractStore) purgeDeleted() {
+	cutoff := time.Now().Add(-time.Duration(cs.conf.PurgeDeletedAfterSec) * time.Second)
+	contracts, err := cs.index.ListContracts()
+	if err != nil {
+		log.Errorf("Failed to list contracts to purge: %s", err)
+		return
+	}
+	for _, info := range contracts {
+		if isPurgeable(info.Deleted, cutoff) {
+			log.Infof("Purging contract %s deleted at %s", info.Address, info.Deleted)
+			if err := cs.index.DeleteContract(info); err != nil {
+				log.Errorf("Failed to purge contract %s from the index: %s", info.Address, err)
+				continue
+			}
+			if err := cs.storage.Delete(ContractInstanceArtifact, info.Address); err != nil {
+				log.Errorf("Failed to purge contract %s from %s: %s", info.Address, cs.storeLocation(), err)
+			}
+		}
+	}
+	abis, err := cs.index.ListABIs()
+	if err != nil {
+		log.Errorf("Failed to list ABIs to purge: %s", err)
+		return
+	}
+	for _, info := range abis {
+		if isPurgeable(info.Deleted, cutoff) {
+			log.Infof("Purging ABI %s deleted at %s", info.ID, info.Deleted)
+			if err := cs.index.DeleteABI(info.ID); err != nil {
+				log.Errorf("Failed to purge ABI %s from the index: %s", info.ID, err)
+				continue
+			}
+			if err := cs.storage.Delete(ABIDeployArtifact, info.ID); err != nil {
+				log.Errorf("Failed to purge ABI %s from %s: %s", info.ID, cs.storeLocation(), err)
+			}
+			cs.abiCache.Remove(ABILocation{ABIType: LocalABI, Name: info.ID})
+		}
+	}
+}
+
+// purgeLoop purges deleted entries periodically, until the store is closed
+func (cs *contractStore) purgeLoop() {
+	defer close(cs.purgeDone)
+	ticker := time.NewTicker(cs.purgeInterval)
+	defer ticker.Stop()
+	for {
+		cs.purgeDeleted()
+		select {
+		case <-ticker.C:
+		case <-cs.purgeStop:
+			return
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSoftDeleteAddr = "0123456789abcdef0123456789abcdef01234567"
+
+func newTestSoftDeleteStore(t *testing.T, dir string) *contractStore {
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir}, &mockRR{}).(*contractStore)
+	assert.NoError(t, cs.Init())
+	deployMsg := &messages.DeployContract{ContractName: "c1"}
+	assert.NoError(t, cs.StoreABI("abi1", deployMsg))
+	_, err := cs.AddABI("abi1", deployMsg, time.Now())
+	assert.NoError(t, err)
+	_, err = cs.AddContract(testSoftDeleteAddr, "abi1", "/contracts/c1", "c1", nil)
+	assert.NoError(t, err)
+	return cs
+}
+
+func TestDeleteAndRestoreContractAndABI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	cs := newTestSoftDeleteStore(t, dir)
+	defer cs.Close()
+
+	_, err := cs.DeleteABI("abi1")
+	assert.Regexp("ABI abi1 cannot be deleted, as 1 contracts are registered against it", err)
+
+	info, err := cs.DeleteContract("c1")
+	assert.NoError(err)
+	assert.NotEmpty(info.Deleted)
+	_, err = cs.DeleteContract(testSoftDeleteAddr)
+	assert.Regexp("Contract .* was deleted at", err)
+	_, err = cs.GetContractByAddress(testSoftDeleteAddr)
+	assert.Regexp("Contract 0123456789abcdef0123456789abcdef01234567 was deleted at", err)
+	assert.True(IsDeleted(err))
+	_, err = cs.ResolveContractAddress("c1")
+	assert.Regexp("Contract c1 was deleted at", err)
+	assert.True(IsDeleted(err))
+	err = cs.CheckNameAvailable("c1", false)
+	assert.Regexp("already registered for name 'c1'", err)
+
+	contracts, total, err := cs.ListContracts(&ListOptions{})
+	assert.NoError(err)
+	assert.Equal(0, total)
+	assert.Empty(contracts)
+	contracts, total, err = cs.ListContracts(&ListOptions{Deleted: true})
+	assert.NoError(err)
+	assert.Equal(1, total)
+	assert.Equal(testSoftDeleteAddr, contracts[0].GetID())
+
+	abiInfo, err := cs.DeleteABI("abi1")
+	assert.NoError(err)
+	assert.NotEmpty(abiInfo.Deleted)
+	_, err = cs.GetLocalABIInfo("abi1")
+	assert.Regexp("ABI abi1 was deleted at", err)
+	assert.True(IsDeleted(err))
+	// The ABI is still available to the subscriptions that use it, and records it was deleted
+	deployMsg, err := cs.GetABI(ABILocation{ABIType: LocalABI, Name: "abi1"}, false)
+	assert.NoError(err)
+	assert.Equal(abiInfo.Deleted, deployMsg.Contract.Deleted)
+	abis, _, err := cs.ListABIs(&ListOptions{})
+	assert.NoError(err)
+	assert.Empty(abis)
+
+	_, err = cs.RestoreContract(testSoftDeleteAddr)
+	assert.Regexp("The ABI abi1 of the contract is deleted, and must be restored first", err)
+	abiInfo, err = cs.RestoreABI("abi1")
+	assert.NoError(err)
+	assert.Empty(abiInfo.Deleted)
+	_, err = cs.RestoreABI("abi1")
+	assert.Regexp("ABI abi1 is not deleted", err)
+	info, err = cs.RestoreContract("c1")
+	assert.NoError(err)
+	assert.Empty(info.Deleted)
+	_, err = cs.RestoreContract(testSoftDeleteAddr)
+	assert.Regexp("Contract 0123456789abcdef0123456789abcdef01234567 is not deleted", err)
+
+	address, err := cs.ResolveContractAddress("c1")
+	assert.NoError(err)
+	assert.Equal(testSoftDeleteAddr, address)
+	deployMsg, err = cs.GetABI(ABILocation{ABIType: LocalABI, Name: "abi1"}, false)
+	assert.NoError(err)
+	assert.Empty(deployMsg.Contract.Deleted)
+}
+
+func TestDeleteAndRestoreNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	cs := newTestSoftDeleteStore(t, dir)
+	defer cs.Close()
+
+	_, err := cs.DeleteContract("unknown")
+	assert.Regexp("No contract instance registered with address unknown", err)
+	assert.False(IsDeleted(err))
+	_, err = cs.RestoreContract("unknown")
+	assert.Regexp("No contract instance registered with address unknown", err)
+	_, err = cs.DeleteABI("unknown")
+	assert.Regexp("No ABI found with ID unknown", err)
+	_, err = cs.RestoreABI("unknown")
+	assert.Regexp("No ABI found with ID unknown", err)
+	assert.False(IsDeleted(fmt.Errorf("pop")))
+}
+
+func TestDeleteABIStorageFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	cs := newTestSoftDeleteStore(t, dir)
+	defer cs.Close()
+
+	_, err := cs.AddABI("abi2", &messages.DeployContract{}, time.Now())
+	assert.NoError(err)
+	_, err = cs.DeleteABI("abi2")
+	assert.Regexp("Failed to load ABI with ID abi2", err)
+}
+
+func TestDeleteIndexFail(t *testing.T) {
+	assert := assert.New(t)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	cs := &contractStore{index: idx}
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").WillReturnRows(sqlmock.NewRows(testContractColumns))
+	mock.ExpectQuery("SELECT .* FROM registrations r").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM abis WHERE id").
+		WillReturnRows(sqlmock.NewRows(testABIColumns).AddRow("abi1", "", "", "", false, "", "", "", "", "", ""))
+	mock.ExpectQuery("SELECT .* FROM contracts c").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c WHERE c.address").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "", "", "", "", "", "", "", "", "2021-01-01T00:00:00Z", "", "", "", ""))
+	mock.ExpectQuery("SELECT .* FROM abis WHERE id").WillReturnError(fmt.Errorf("pop"))
+
+	_, err := cs.DeleteContract("addr1")
+	assert.Regexp("pop", err)
+	_, err = cs.DeleteContract("name1")
+	assert.Regexp("pop", err)
+	_, err = cs.DeleteABI("abi1")
+	assert.Regexp("pop", err)
+	_, err = cs.RestoreContract("addr1")
+	assert.Regexp("pop", err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	cs := newTestSoftDeleteStore(t, dir)
+	defer cs.Close()
+	cs.conf.PurgeDeletedAfterSec = 3600
+
+	_, err := cs.DeleteContract(testSoftDeleteAddr)
+	assert.NoError(err)
+	_, err = cs.DeleteABI("abi1")
+	assert.NoError(err)
+
+	// Only entries deleted before the retention are purged
+	cs.purgeDeleted()
+	_, err = cs.RestoreContract(testSoftDeleteAddr)
+	assert.Regexp("must be restored first", err)
+
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	_, err = cs.updateContractInfo(testSoftDeleteAddr, func(info *ContractInfo) { info.Deleted = old })
+	assert.NoError(err)
+	abiInfo, err := cs.getABIInfo("abi1")
+	assert.NoError(err)
+	_, err = cs.setABIDeleted(abiInfo, old)
+	assert.NoError(err)
+
+	cs.purgeDeleted()
+	_, err = cs.RestoreContract(testSoftDeleteAddr)
+	assert.Regexp("No contract instance registered", err)
+	_, err = cs.RestoreABI("abi1")
+	assert.Regexp("No ABI found with ID abi1", err)
+	_, err = cs.storage.Get(ContractInstanceArtifact, testSoftDeleteAddr)
+	assert.Error(err)
+	_, err = cs.storage.Get(ABIDeployArtifact, "abi1")
+	assert.Error(err)
+	// The registered name is available again once purged
+	assert.NoError(cs.CheckNameAvailable("c1", false))
+}
+
+func TestPurgeDeletedFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := tempdir()
+	defer cleanup(dir)
+
+	idx, mock := newTestPostgreSQLIndex(t)
+	cs := &contractStore{conf: &ContractStoreConf{}, index: idx, storage: NewFSArtifactStore(dir)}
+	old := "2021-01-01T00:00:00Z"
+	mock.ExpectQuery("SELECT .* FROM contracts c").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c").
+		WillReturnRows(sqlmock.NewRows(testContractColumns).AddRow("addr1", "abi1", "", "", "", "", "", "", "", "", old, "", "", "", ""))
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM abis").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectQuery("SELECT .* FROM contracts c").WillReturnRows(sqlmock.NewRows(testContractColumns))
+	mock.ExpectQuery("SELECT .* FROM abis").
+		WillReturnRows(sqlmock.NewRows(testABIColumns).AddRow("abi1", "", "", "", false, "", "", "", "", "", old))
+	mock.ExpectExec("DELETE FROM abis").WillReturnError(fmt.Errorf("pop"))
+
+	cs.purgeDeleted()
+	cs.purgeDeleted()
+	cs.purgeDeleted()
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPurgeLoopStopsOnClose(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	cs := NewContractStore(&ContractStoreConf{StoragePath: dir, PurgeDeletedAfterSec: 1}, &mockRR{}).(*contractStore)
+	cs.purgeInterval = 1 * time.Millisecond
+	assert.NoError(cs.Init())
+	time.Sleep(5 * time.Millisecond)
+	cs.Close()
+	assert.Nil(cs.purgeStop)
+}
+
+func TestIsPurgeable(t *testing.T) {
+	assert := assert.New(t)
+	cutoff := time.Now()
+	assert.False(isPurgeable("", cutoff))
+	assert.False(isPurgeable("!time", cutoff))
+	assert.False(isPurgeable(cutoff.Add(1*time.Hour).UTC().Format(time.RFC3339), cutoff))
+	assert.True(isPurgeable(cutoff.Add(-1*time.Hour).UTC().Format(time.RFC3339), cutoff))
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+const (
+	// TokenStandardERC20 is a fungible token
+	TokenStandardERC20 = "erc20"
+	// TokenStandardERC721 is a non-fungible token
+	TokenStandardERC721 = "erc721"
+	// TokenStandardERC1155 is a multi-token
+	TokenStandardERC1155 = "erc1155"
+)
+
+// tokenStandards lists the functions a contract must declare to implement each standard.
+// ERC-20 and ERC-721 share some functions, so the differences are important
+var tokenStandards = []struct {
+	name      string
+	functions []string
+}{
+	{TokenStandardERC20, []string{
+		"totalSupply()",
+		"balanceOf(address)",
+		"transfer(address,uint256)",
+		"transferFrom(address,address,uint256)",
+		"approve(address,uint256)",
+		"allowance(address,address)",
+	}},
+	{TokenStandardERC721, []string{
+		"balanceOf(address)",
+		"ownerOf(uint256)",
+		"safeTransferFrom(address,address,uint256)",
+		"transferFrom(address,address,uint256)",
+		"approve(address,uint256)",
+		"setApprovalForAll(address,bool)",
+		"getApproved(uint256)",
+		"isApprovedForAll(address,address)",
+	}},
+	{TokenStandardERC1155, []string{
+		"balanceOf(address,uint256)",
+		"balanceOfBatch(address[],uint256[])",
+		"setApprovalForAll(address,bool)",
+		"isApprovedForAll(address,address)",
+		"safeTransferFrom(address,address,uint256,uint256,bytes)",
+		"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+	}},
+}
+
+// FunctionSignature returns the canonical signature of a function in an ABI, such as balanceOf(address)
+func FunctionSignature(element *ethbinding.ABIElementMarshaling) string {
+	types := make([]string, len(element.Inputs))
+	for i, input := range element.Inputs {
+		types[i] = input.Type
+	}
+	return element.Name + "(" + strings.Join(types, ",") + ")"
+}
+
+// DetectTokenStandards returns the token standards implemented by a contract, by matching
+// the functions declared in its ABI against the functions required by each standard
+func DetectTokenStandards(abi ethbinding.ABIMarshaling) []string {
+	declared := make(map[string]bool)
+	for i := range abi {
+		if abi[i].Type == "function" {
+			declared[FunctionSignature(&abi[i])] = true
+		}
+	}
+	var standards []string
+	for _, standard := range tokenStandards {
+		implemented := true
+		for _, f := range standard.functions {
+			if !declared[f] {
+				implemented = false
+				break
+			}
+		}
+		if implemented {
+			standards = append(standards, standard.name)
+		}
+	}
+	return standards
+}
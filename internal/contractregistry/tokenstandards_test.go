@@ -0,0 +1,94 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contractregistry
+
+import (
+	"encoding/json"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTokenABI builds an ABI declaring each of the supplied function signatures
+func testTokenABI(signatures map[string][]string) ethbinding.ABIMarshaling {
+	abi := ethbinding.ABIMarshaling{}
+	for name, types := range signatures {
+		inputs := make([]ethbinding.ABIArgumentMarshaling, len(types))
+		for i, t := range types {
+			inputs[i] = ethbinding.ABIArgumentMarshaling{Type: t}
+		}
+		abi = append(abi, ethbinding.ABIElementMarshaling{Type: "function", Name: name, Inputs: inputs})
+	}
+	return abi
+}
+
+func testERC20ABI() ethbinding.ABIMarshaling {
+	return testTokenABI(map[string][]string{
+		"totalSupply":  {},
+		"balanceOf":    {"address"},
+		"transfer":     {"address", "uint256"},
+		"transferFrom": {"address", "address", "uint256"},
+		"approve":      {"address", "uint256"},
+		"allowance":    {"address", "address"},
+		"decimals":     {},
+	})
+}
+
+func TestDetectTokenStandardsERC20(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{TokenStandardERC20}, DetectTokenStandards(testERC20ABI()))
+}
+
+func TestDetectTokenStandardsERC721(t *testing.T) {
+	assert := assert.New(t)
+	abi := testTokenABI(map[string][]string{
+		"balanceOf":         {"address"},
+		"ownerOf":           {"uint256"},
+		"safeTransferFrom":  {"address", "address", "uint256"},
+		"transferFrom":      {"address", "address", "uint256"},
+		"approve":           {"address", "uint256"},
+		"setApprovalForAll": {"address", "bool"},
+		"getApproved":       {"uint256"},
+		"isApprovedForAll":  {"address", "address"},
+		"totalSupply":       {},
+	})
+	assert.Equal([]string{TokenStandardERC721}, DetectTokenStandards(abi))
+}
+
+func TestDetectTokenStandardsERC1155(t *testing.T) {
+	assert := assert.New(t)
+	var abi ethbinding.ABIMarshaling
+	err := json.Unmarshal([]byte(`[
+		{"type":"function","name":"balanceOf","inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}]},
+		{"type":"function","name":"balanceOfBatch","inputs":[{"type":"address[]"},{"type":"uint256[]"}]},
+		{"type":"function","name":"setApprovalForAll","inputs":[{"type":"address"},{"type":"bool"}]},
+		{"type":"function","name":"isApprovedForAll","inputs":[{"type":"address"},{"type":"address"}]},
+		{"type":"function","name":"safeTransferFrom","inputs":[{"type":"address"},{"type":"address"},{"type":"uint256"},{"type":"uint256"},{"type":"bytes"}]},
+		{"type":"function","name":"safeBatchTransferFrom","inputs":[{"type":"address"},{"type":"address"},{"type":"uint256[]"},{"type":"uint256[]"},{"type":"bytes"}]},
+		{"type":"event","name":"TransferSingle","inputs":[]}
+	]`), &abi)
+	assert.NoError(err)
+	assert.Equal([]string{TokenStandardERC1155}, DetectTokenStandards(abi))
+}
+
+func TestDetectTokenStandardsNone(t *testing.T) {
+	assert := assert.New(t)
+	abi := testERC20ABI()
+	// An event with the same name as a required function does not count
+	abi[0].Type = "event"
+	assert.Empty(DetectTokenStandards(abi))
+	assert.Empty(DetectTokenStandards(nil))
+}
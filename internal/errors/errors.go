@@ -91,7 +91,7 @@ var (
 	// ConfigRESTGatewayRequiredReceiptStore need to enable params for REST Gatewya
 	ConfigRESTGatewayRequiredReceiptStore = e(100020, "MongoDB URL, Database and Collection name must be specified to enable the receipt store")
 	// ConfigRESTGatewayRequiredRPC and RPC stuff
-	ConfigRESTGatewayRequiredRPC = e(100021, "RPC URL and Storage Path must be supplied to enable the Open API REST Gateway")
+	ConfigRESTGatewayRequiredRPC = e(100021, "RPC URL and Storage Path or Store URL must be supplied to enable the Open API REST Gateway")
 	// ConfigWebhooksDirectRPC for webhooks direct
 	ConfigWebhooksDirectRPC = e(100022, "No JSON/RPC URL set for ethereum node")
 	// ConfigTLSCertOrKey incomplete TLS config
@@ -487,6 +487,621 @@ var (
 
 	// EventSupportNotConfiugred is returned when event support is not configured
 	EventSupportNotConfiugred = e(100207, "Event support is not configured on this gateway")
+
+	// ConfigRESTGatewayS3StoreURL is returned when the S3 URL for the contract store cannot be parsed
+	ConfigRESTGatewayS3StoreURL = e(100208, "Invalid contract store URL '%s'. Must be of the form s3://bucket/prefix")
+
+	// RESTGatewayLocalStoreS3Request is returned when a request to the S3 contract store fails
+	RESTGatewayLocalStoreS3Request = e(100209, "S3 %s request for '%s' failed [%d]: %s")
+
+	// RESTGatewayLocalStoreIndexInit is returned when the contract index database cannot be opened or migrated
+	RESTGatewayLocalStoreIndexInit = e(100210, "Failed to initialize contract index database: %s")
+
+	// RESTGatewayLocalStoreIndexQuery is returned when a query against the contract index fails
+	RESTGatewayLocalStoreIndexQuery = e(100211, "Failed to query contract index: %s")
+
+	// RESTGatewayLocalStoreIndexUpdate is returned when an update to the contract index fails
+	RESTGatewayLocalStoreIndexUpdate = e(100212, "Failed to update contract index: %s")
+
+	// RESTGatewayCompileContractUploadTooLarge is returned when the files uploaded for compilation exceed the configured limit
+	RESTGatewayCompileContractUploadTooLarge = e(100213, "Uploaded files exceed the maximum total size of %dMB")
+
+	// RESTGatewayCompileJobInvalidWebhook is returned when the webhook to notify on completion of a compile job is not a valid HTTP URL
+	RESTGatewayCompileJobInvalidWebhook = e(100214, "Invalid webhook URL for compile job notification: %s")
+
+	// RESTGatewayCompileJobQueueFull is returned when the queue of background compile jobs is full
+	RESTGatewayCompileJobQueueFull = e(100215, "The compile job queue is full. Please try again later")
+
+	// RESTGatewayCompileJobNotFound is returned when the requested compile job does not exist, or has expired
+	RESTGatewayCompileJobNotFound = e(100216, "Compile job %s not found")
+
+	// RESTGatewayListInvalidParam is returned when a query parameter for listing contracts or ABIs is invalid
+	RESTGatewayListInvalidParam = e(100217, "Invalid '%s' query parameter: %s")
+
+	// CompilerTimeout is returned when solc is killed for exceeding the configured timeout
+	CompilerTimeout = e(100218, "Solidity compilation exceeded the maximum time of %ds")
+
+	// CompilerCPULimit is returned when solc is killed for exceeding the configured CPU time limit
+	CompilerCPULimit = e(100219, "Solidity compilation exceeded the maximum CPU time of %ds: %s")
+
+	// CompilerTooManyCompiles is returned when the configured number of concurrent compilations are already running
+	CompilerTooManyCompiles = e(100220, "Too many concurrent Solidity compilations (maximum %d). Please try again later")
+
+	// EventStreamsAlertInvalidURL is returned when the alert URL of an event stream cannot be parsed
+	EventStreamsAlertInvalidURL = e(100221, "Invalid URL in alertURL of event stream")
+
+	// EventStreamsFailureThresholdReached is recorded on a stream suspended after too many consecutive delivery failures
+	EventStreamsFailureThresholdReached = e(100222, "Suspended after %d consecutive delivery failures: %s")
+
+	// RESTGatewayABIImportInvalidRequest is returned when the body of a request to import a verified ABI is invalid
+	RESTGatewayABIImportInvalidRequest = e(100223, "Invalid ABI import request: %s")
+
+	// RESTGatewayABIImportUnknownSource is returned when a request to import a verified ABI names an unknown source
+	RESTGatewayABIImportUnknownSource = e(100224, "Unknown ABI import source '%s'. Valid sources are: 'etherscan' and 'sourcify'")
+
+	// RESTGatewayABIImportFetchFailed is returned when the verified ABI could not be fetched from the source
+	RESTGatewayABIImportFetchFailed = e(100225, "Failed to fetch the verified ABI for %s from %s: %s")
+
+	// RESTGatewayABIImportNotVerified is returned when the source does not have a verified ABI for the address
+	RESTGatewayABIImportNotVerified = e(100226, "Contract %s is not verified on %s")
+
+	// RESTGatewayTokenStandardNotImplemented is returned when a token route is called on a contract that does not implement the standard
+	RESTGatewayTokenStandardNotImplemented = e(100227, "Contract %s does not implement %s")
+
+	// RESTGatewayTokenRouteNotFound is returned for an unknown token route
+	RESTGatewayTokenRouteNotFound = e(100228, "Unknown %s token route '%s'")
+
+	// RESTGatewayTokenInvalidParam is returned when a token route parameter is invalid
+	RESTGatewayTokenInvalidParam = e(100229, "Invalid %s: '%s'")
+
+	// RESTGatewayTokenNotEnumerable is returned when listing the tokens of an ERC-721 contract that does not implement enumeration
+	RESTGatewayTokenNotEnumerable = e(100230, "ERC-721 contract %s does not implement tokenOfOwnerByIndex, so the tokens cannot be listed")
+
+	// RESTGatewayTokenCallFailed is returned when a call to a token function fails
+	RESTGatewayTokenCallFailed = e(100231, "Failed to call %s: %s")
+
+	// MigrateNothingToMigrate is returned when the migrate command is run without a legacy location
+	MigrateNothingToMigrate = e(100232, "No legacy contracts path or events database to migrate")
+
+	// MigrateMissingTarget is returned when a legacy location is set without the location to migrate it to
+	MigrateMissingTarget = e(100233, "The --%s must be migrated to an --%s")
+
+	// MigrateSameLocation is returned when the legacy and new locations are the same
+	MigrateSameLocation = e(100234, "Cannot migrate %s to itself")
+
+	// MigrateFailed is returned when a legacy location cannot be read, or a new location written
+	MigrateFailed = e(100235, "Migration failed for %s: %s")
+
+	// ReplyProfileUnknown is returned when a reply profile is configured that does not exist
+	ReplyProfileUnknown = e(100236, "Unknown reply profile '%s'")
+
+	// CompilerStandardJSONInvalid is returned when a solc standard-JSON input document cannot be used
+	CompilerStandardJSONInvalid = e(100237, "Invalid solc standard-JSON input: %s")
+
+	// CompilerStandardJSONOutputInvalid is returned when the standard-JSON output of solc cannot be parsed
+	CompilerStandardJSONOutputInvalid = e(100238, "Failed to parse solc standard-JSON output: %s")
+
+	// CompilerStandardJSONFailed is returned when solc reports errors compiling a standard-JSON input document
+	CompilerStandardJSONFailed = e(100239, "Solidity compilation failed: %s")
+
+	// RESTGatewayCompileContractStandardJSONMissing is returned when the standard-JSON input file named in the form was not uploaded
+	RESTGatewayCompileContractStandardJSONMissing = e(100240, "Standard-JSON input file '%s' was not uploaded")
+
+	// RESTGatewayMethodPolicyInvalid is returned when the method policy of a contract cannot be parsed
+	RESTGatewayMethodPolicyInvalid = e(100241, "Invalid method policy: %s")
+
+	// RESTGatewayMethodPolicyUnknownMethod is returned when a method policy names a method the contract does not declare
+	RESTGatewayMethodPolicyUnknownMethod = e(100242, "Method '%s' in the method policy is not declared by the contract ABI")
+
+	// RESTGatewayMethodNotExposed is returned when the method policy of a contract hides the requested method
+	RESTGatewayMethodNotExposed = e(100243, "Method '%s' is not exposed for contract %s")
+
+	// SolcDownloadFailed is returned when a solc release cannot be downloaded
+	SolcDownloadFailed = e(100244, "Failed to download solc %s: %s")
+
+	// SolcDownloadChecksum is returned when a downloaded solc release does not match its published checksum
+	SolcDownloadChecksum = e(100245, "Downloaded solc %s failed checksum verification (expected=%s actual=%s)")
+
+	// SolcVersionUnavailable is returned when a requested solc version has not been released
+	SolcVersionUnavailable = e(100246, "Solidity compiler version %s is not available for download")
+
+	// SolcPragmaUnsatisfied is returned when no released solc version satisfies the version pragma of the source
+	SolcPragmaUnsatisfied = e(100247, "No released Solidity compiler version satisfies the pragma '%s'")
+
+	// RESTGatewayParamDefaultsInvalid is returned when the parameter defaults supplied when registering a contract are invalid
+	RESTGatewayParamDefaultsInvalid = e(100248, "Invalid parameter defaults: %s")
+
+	// EventStreamsWebhookHostNotAllowed is returned when a webhook URL is not on the list of allowed hosts
+	EventStreamsWebhookHostNotAllowed = e(100249, "Webhook host '%s' is not in the list of allowed hosts")
+
+	// EventStreamsWebhookUnresolvable is returned when the host of a webhook URL cannot be resolved
+	EventStreamsWebhookUnresolvable = e(100250, "Cannot resolve webhook host '%s': %s")
+
+	// EventStreamsWebhookProbeFailed is returned when the connectivity probe of a webhook fails at stream creation
+	EventStreamsWebhookProbeFailed = e(100251, "Webhook probe %s %s failed: %s")
+
+	// EventStreamsWebhookInvalidProbe is returned when an unknown webhook probe type is requested
+	EventStreamsWebhookInvalidProbe = e(100252, "Invalid webhook probe '%s'. Must be one of: dns, head, options, post")
+
+	// RESTGatewayCompilerSettingsInvalid is returned when a compiler setting supplied when compiling Solidity is invalid
+	RESTGatewayCompilerSettingsInvalid = e(100253, "Invalid compiler setting '%s': %s")
+
+	// EventStreamsSubscribeBatchEmpty is returned when a batch of subscriptions to create is empty
+	EventStreamsSubscribeBatchEmpty = e(100254, "No subscriptions supplied in the batch")
+
+	// EventStreamsSubscribeBatchInvalid is returned when subscriptions in a batch are invalid, so none were created
+	EventStreamsSubscribeBatchInvalid = e(100255, "%d of the %d subscriptions in the batch are invalid. No subscriptions were created")
+
+	// EventStreamsSubscribeBatchNilEntry is returned for an empty entry in a batch of subscriptions
+	EventStreamsSubscribeBatchNilEntry = e(100256, "Subscription missing from the batch entry")
+
+	// RESTGatewayCompileContractBadRemapping is returned when an import remapping supplied for compilation is invalid
+	RESTGatewayCompileContractBadRemapping = e(100257, "Invalid import remapping '%s'. Must be [context:]prefix=target, with a relative target path")
+
+	// RESTGatewayDependencyFetchFailed is returned when a Solidity dependency cannot be fetched from the mirror
+	RESTGatewayDependencyFetchFailed = e(100258, "Failed to fetch Solidity dependency '%s' from %s: %s")
+
+	// RESTGatewayDependencyInvalid is returned when a Solidity import or dependency version cannot be resolved safely
+	RESTGatewayDependencyInvalid = e(100259, "Invalid Solidity dependency '%s'")
+
+	// RESTGatewayDependencyLimit is returned when resolving the Solidity dependencies fetches too many files
+	RESTGatewayDependencyLimit = e(100260, "Resolving Solidity dependencies exceeded the limit of %d files")
+
+	// KafkaBatchDeliveryFailed is returned when messages in a batch sent to Kafka were not acknowledged
+	KafkaBatchDeliveryFailed = e(100261, "Failed to deliver %d of %d messages to Kafka topic '%s': %s")
+
+	// EventStreamsKafkaNotConfigured is returned when a Kafka event stream is created without Kafka brokers configured for events
+	EventStreamsKafkaNotConfigured = e(100262, "Kafka brokers must be configured for events to create a Kafka event stream")
+
+	// EventStreamsKafkaNoTopic is returned when a Kafka event stream does not have a topic
+	EventStreamsKafkaNoTopic = e(100263, "Must specify kafka.topic for action type 'kafka'")
+
+	// EventStreamsKafkaInvalidKey is returned when the key selection of a Kafka event stream is invalid
+	EventStreamsKafkaInvalidKey = e(100264, "Invalid kafka.keyBy '%s'. Must be 'address', 'arg' with a keyArg, or 'none'")
+
+	// EventStreamsKafkaConnectFailed is returned when the producer for Kafka event streams cannot connect
+	EventStreamsKafkaConnectFailed = e(100265, "Failed to connect to Kafka for event streams: %s")
+
+	// RESTGatewayZeroFromNotQuery is returned when the zero address is used as the sender of a transaction
+	RESTGatewayZeroFromNotQuery = e(100266, "A '%s-from' of 'zero' can only be used to query a contract")
+
+	// RESTGatewayEventsOnlyNotDeployable is returned when deploying an ABI that only declares events
+	RESTGatewayEventsOnlyNotDeployable = e(100267, "The ABI only declares events, and has no bytecode to deploy")
+
+	// RESTGatewayInvalidProjectName is returned when a project name contains characters that are not allowed
+	RESTGatewayInvalidProjectName = e(100268, "Invalid project name '%s'. Must be up to 64 letters, numbers, '.', '_' or '-' characters")
+
+	// EventStreamsMQTTNoBrokerURL is returned when an MQTT event stream does not have a broker URL
+	EventStreamsMQTTNoBrokerURL = e(100269, "Must specify mqtt.brokerURL for action type 'mqtt'")
+
+	// EventStreamsMQTTInvalidBrokerURL is returned when the broker URL of an MQTT event stream cannot be used
+	EventStreamsMQTTInvalidBrokerURL = e(100270, "Invalid mqtt.brokerURL '%s'. Must be a tcp, ssl, tls, mqtt, mqtts, ws or wss URL")
+
+	// EventStreamsMQTTNoTopic is returned when an MQTT event stream does not have a topic
+	EventStreamsMQTTNoTopic = e(100271, "Must specify mqtt.topic for action type 'mqtt'")
+
+	// EventStreamsMQTTInvalidTopic is returned when the topic of an MQTT event stream contains wildcards
+	EventStreamsMQTTInvalidTopic = e(100272, "Invalid mqtt.topic '%s'. Events cannot be published to a topic containing '+' or '#' wildcards")
+
+	// EventStreamsMQTTConnectFailed is returned when an MQTT event stream cannot connect to its broker
+	EventStreamsMQTTConnectFailed = e(100273, "Failed to connect to MQTT broker '%s': %s")
+
+	// EventStreamsMQTTPublishFailed is returned when a batch of events is not acknowledged by the MQTT broker
+	EventStreamsMQTTPublishFailed = e(100274, "Failed to publish events to MQTT topic '%s': %s")
+
+	// EventStreamsMQTTTimeout is returned when the MQTT broker does not respond within the request timeout of the stream
+	EventStreamsMQTTTimeout = e(100275, "Timed out after %ds waiting for the MQTT broker")
+
+	// EventStreamsNATSNotConfigured is returned when a NATS event stream is created without a NATS server configured for events
+	EventStreamsNATSNotConfigured = e(100276, "A NATS server must be configured for events to create a NATS event stream")
+
+	// EventStreamsNATSNoSubject is returned when a NATS event stream does not have a subject
+	EventStreamsNATSNoSubject = e(100277, "Must specify nats.subject for action type 'nats'")
+
+	// EventStreamsNATSInvalidSubject is returned when the subject of a NATS event stream contains wildcards or whitespace
+	EventStreamsNATSInvalidSubject = e(100278, "Invalid nats.subject '%s'. Events cannot be published to a subject containing wildcards or whitespace")
+
+	// EventStreamsNATSConnectFailed is returned when the connection for NATS event streams cannot be established
+	EventStreamsNATSConnectFailed = e(100279, "Failed to connect to NATS JetStream for event streams: %s")
+
+	// EventStreamsNATSPublishFailed is returned when an event is not acknowledged by JetStream
+	EventStreamsNATSPublishFailed = e(100280, "Failed to publish event to NATS subject '%s': %s")
+
+	// RESTGatewayContractDeleted is returned when a contract that has been soft-deleted is accessed
+	RESTGatewayContractDeleted = e(100281, "Contract %s was deleted at %s")
+
+	// RESTGatewayABIDeleted is returned when an ABI that has been soft-deleted is accessed
+	RESTGatewayABIDeleted = e(100282, "ABI %s was deleted at %s")
+
+	// RESTGatewayABIInUse is returned when deleting an ABI that contracts are still registered against
+	RESTGatewayABIInUse = e(100283, "ABI %s cannot be deleted, as %d contracts are registered against it")
+
+	// RESTGatewayContractABIDeleted is returned when restoring a contract whose ABI is deleted
+	RESTGatewayContractABIDeleted = e(100284, "The ABI %s of the contract is deleted, and must be restored first")
+
+	// RESTGatewayContractNotDeleted is returned when restoring a contract that is not deleted
+	RESTGatewayContractNotDeleted = e(100285, "Contract %s is not deleted")
+
+	// RESTGatewayABINotDeleted is returned when restoring an ABI that is not deleted
+	RESTGatewayABINotDeleted = e(100286, "ABI %s is not deleted")
+
+	// RESTGatewaySyncRequestsSaturated is returned when the maximum number of synchronous requests are in flight, and the queue is full
+	RESTGatewaySyncRequestsSaturated = e(100287, "Too many synchronous requests in flight. Retry after %d seconds")
+
+	// RESTGatewaySyncRequestQueueTimeout is returned when a synchronous request waited too long in the queue for an in-flight slot
+	RESTGatewaySyncRequestQueueTimeout = e(100288, "Timed out after %.2fs waiting to process synchronous request. Retry after %d seconds")
+
+	// EventStreamsWebhookSecretUnresolved is returned when a webhook secret refers to an environment variable or file that cannot be read
+	EventStreamsWebhookSecretUnresolved = e(100289, "Cannot resolve webhook secret '%s': %s")
+
+	// ConfigKafkaTenantNoReplyTopic is returned when a tenant is configured on the Kafka bridge with an empty reply topic
+	ConfigKafkaTenantNoReplyTopic = e(100290, "No reply topic configured for tenant '%s'")
+
+	// TransactionLifecycleWebhookFailed is returned when the transaction lifecycle webhook does not accept a batch of events
+	TransactionLifecycleWebhookFailed = e(100291, "Transaction lifecycle webhook %s failed with status=%d")
+
+	// EventStreamsWebhookTLSInvalid is returned when the client certificate, key or CA bundle of a webhook cannot be loaded
+	EventStreamsWebhookTLSInvalid = e(100292, "Invalid TLS configuration for webhook: %s")
+
+	// EventStreamsDeadLetterInvalidType is returned when the dead letter queue of a stream is not a supported type
+	EventStreamsDeadLetterInvalidType = e(100293, "Invalid deadLetter.type '%s'. Must be 'leveldb' or 'kafka'")
+
+	// EventStreamsDeadLetterNoTopic is returned when a Kafka dead letter queue is configured without a topic
+	EventStreamsDeadLetterNoTopic = e(100294, "Must specify deadLetter.topic for a dead letter queue of type 'kafka'")
+
+	// EventStreamsDeadLetterNotFound is returned when a dead letter does not exist on a stream
+	EventStreamsDeadLetterNotFound = e(100295, "Dead letter '%s' not found on event stream '%s'")
+
+	// EventStreamsCheckpointInvalid is returned when an imported checkpoint does not have a valid block number
+	EventStreamsCheckpointInvalid = e(100296, "Checkpoint must include a blockNumber of 0 or more")
+
+	// EventStreamsCatchupInvalid is returned when the catchup throttling for a stream or subscription is negative
+	EventStreamsCatchupInvalid = e(100297, "Catchup maxBlocksPerQuery and maxQueriesPerSec must not be negative")
+
+	// EventStreamsSubscribeNoContractEvents is returned when subscribing to all the events of a contract whose ABI has no events that can be matched
+	EventStreamsSubscribeNoContractEvents = e(100298, "The ABI does not declare any events that are not anonymous")
+
+	// EventStreamsLogDecodeUnknownEvent is returned when a log received by a subscription to all the events of a contract does not match any of them
+	EventStreamsLogDecodeUnknownEvent = e(100299, "%s: Log topic %s does not match any event in the ABI")
+
+	// EventStreamsSubscribeFilterNotIndexed is returned when a subscription filter names an argument that is not an indexed argument of the event
+	EventStreamsSubscribeFilterNotIndexed = e(100300, "Filter argument '%s' is not an indexed argument of event '%s'")
+
+	// EventStreamsSubscribeFilterBadValue is returned when a subscription filter value cannot be converted to a topic for the type of the indexed argument
+	EventStreamsSubscribeFilterBadValue = e(100301, "Invalid filter value for indexed argument '%s' of type %s: %v")
+
+	// EventStreamsSubscribeFilterMultipleEvents is returned when a subscription to all the events of a contract has a filter on indexed arguments
+	EventStreamsSubscribeFilterMultipleEvents = e(100302, "A filter on indexed arguments can only be used when subscribing to a single event")
+
+	// RESTGatewayInvalidTimeout is returned when the timeout of a request is not a positive number of seconds
+	RESTGatewayInvalidTimeout = e(100303, "Invalid %s-timeout '%s': must be a positive number of seconds")
+
+	// TransactionSendReceiptCheckAborted is returned when a synchronous request is cancelled, or reaches its deadline, while waiting for the receipt of a submitted transaction
+	TransactionSendReceiptCheckAborted = e(100304, "Stopped waiting for transaction receipt, as the request was cancelled or reached its deadline: %s")
+
+	// WebhooksKafkaAckAborted is returned when a request is cancelled, or reaches its deadline, while waiting for Kafka to acknowledge a message
+	WebhooksKafkaAckAborted = e(100305, "Stopped waiting for Kafka to acknowledge the message, as the request was cancelled or reached its deadline: %s")
+
+	// EventStreamsSubscribeInvalidType is returned when the type of a subscription is not one of the supported types
+	EventStreamsSubscribeInvalidType = e(100306, "Invalid subscription type '%s'. Must be 'events', 'blocks' or 'pendingTransactions'")
+
+	// EventStreamsSubscribeBlocksWithEvent is returned when a subscription to blocks has an address, event or filter, which only apply to events
+	EventStreamsSubscribeBlocksWithEvent = e(100307, "A subscription to blocks cannot have an address, event or filter")
+
+	// ConsensusAdminInvalidProtocol is returned when the consensus protocol configured for validator management is not supported
+	ConsensusAdminInvalidProtocol = e(100308, "Invalid consensus protocol '%s' for validator management. Must be 'qbft' or 'ibft'")
+
+	// ConsensusAdminInvalidVote is returned when a validator vote is not to add or remove a validator
+	ConsensusAdminInvalidVote = e(100309, "Invalid validator vote '%s'. Must be 'add' or 'remove'")
+
+	// ConsensusAdminVoteRejected is returned when the node does not accept a validator vote or discard
+	ConsensusAdminVoteRejected = e(100310, "The node did not accept %s for validator %s")
+
+	// ConsensusAdminInvalidBlock is returned when the block number to get the validators at is not a number or tag
+	ConsensusAdminInvalidBlock = e(100311, "Invalid block number '%s'. Must be a number, or 'latest', 'earliest' or 'pending'")
+
+	// RPCPassthroughInvalidRequest is returned when the body of a request to the JSON/RPC passthrough is not a single JSON/RPC request
+	RPCPassthroughInvalidRequest = e(100312, "Invalid JSON/RPC request: %s")
+
+	// RPCPassthroughMethodNotAllowed is returned when a JSON/RPC method is not in the allow-list of the passthrough
+	RPCPassthroughMethodNotAllowed = e(100313, "JSON/RPC method '%s' is not allowed")
+
+	// EventStreamsSubscribePendingWithEvent is returned when a subscription to pending transactions has an address or event, which only apply to events
+	EventStreamsSubscribePendingWithEvent = e(100314, "A subscription to pending transactions cannot have an address or event. Use a filter on 'to' or 'from'")
+
+	// EventStreamsSubscribePendingBadFilter is returned when the filter of a subscription to pending transactions is not a 'to' or 'from' address, or list of addresses
+	EventStreamsSubscribePendingBadFilter = e(100315, "Invalid filter '%s' for pending transactions. Must be an address, or a list of addresses, for 'to' or 'from'")
+
+	// RESTGatewayDecimalsInvalid is returned when the token decimals supplied when registering a contract are invalid
+	RESTGatewayDecimalsInvalid = e(100316, "Invalid decimals: %s")
+
+	// RESTGatewayDecimalsInvalidAmount is returned when an amount cannot be converted to base units using the decimals of its parameter
+	RESTGatewayDecimalsInvalidAmount = e(100317, "Invalid amount '%v' for parameter '%s' with %d decimals")
+
+	// TransactionSendFeeBumpMaxGasPrice is returned when a transaction cannot be resent with a higher gas price, as it has reached the configured maximum
+	TransactionSendFeeBumpMaxGasPrice = e(100318, "Gas price %s has reached the maximum of %s for resending the transaction")
+
+	// TransactionSendFeeBumpBadMaxGasPrice is returned when the maximum gas price configured for resending transactions is not an integer
+	TransactionSendFeeBumpBadMaxGasPrice = e(100319, "Invalid maximum gas price '%s' for resending transactions")
+
+	// EventStreamsBackupInvalidID is returned when a stream or subscription in an imported backup does not have a valid ID
+	EventStreamsBackupInvalidID = e(100320, "Invalid ID '%s' in event streams backup")
+
+	// EventStreamsBackupMissingStream is returned when a subscription in an imported backup is for a stream that does not exist
+	EventStreamsBackupMissingStream = e(100321, "Subscription '%s' in event streams backup is for stream '%s' that does not exist")
+
+	// EventStreamsBackupNoDB is returned when the events export or import command is run without a database location
+	EventStreamsBackupNoDB = e(100322, "The --events-db location of the event streams database must be specified")
+
+	// EventStreamsBackupFileFailed is returned when an event streams backup file cannot be read or written
+	EventStreamsBackupFileFailed = e(100323, "Failed to access event streams backup file %s: %s")
+
+	// TransactionSendMsgTypeNotAllowed is returned when a message is of a type the instance is not configured to process
+	TransactionSendMsgTypeNotAllowed = e(100324, "Message type '%s' is not enabled on this instance")
+
+	// ConfigInvalidMessageType is returned when the message types to process include a type that is not supported
+	ConfigInvalidMessageType = e(100325, "Invalid message type '%s'. Must be one of: %s")
+
+	// EventStreamsSubscribeAnonymousNoAddress is returned when subscribing to an anonymous event without the address of a contract
+	EventStreamsSubscribeAnonymousNoAddress = e(100326, "An address is required to subscribe to anonymous event '%s', as its logs do not include an event ID")
+
+	// RESTGatewayEventOverrideInvalid is returned when the event definition supplied to override the installed ABI cannot be parsed
+	RESTGatewayEventOverrideInvalid = e(100327, "Invalid event definition: %s")
+
+	// EventStreamsInactivityInvalidTimeout is returned when an inactivity policy has no timeout, or a warning period that is not shorter than the timeout
+	EventStreamsInactivityInvalidTimeout = e(100328, "Inactivity policies must have a timeoutSec or a noConsumerSec, and any warningSec must be less than the timeoutSec")
+
+	// EventStreamsInactivityInvalidAction is returned when an inactivity policy has an unknown action, or an action not supported on subscriptions
+	EventStreamsInactivityInvalidAction = e(100329, "Invalid inactivity action '%s'. Streams can be 'suspend' or 'delete', and subscriptions can be 'delete'")
+
+	// EventStreamsInactivityTimeout is the reason recorded on a stream suspended by its inactivity policy
+	EventStreamsInactivityTimeout = e(100330, "Suspended after no events for %s")
+
+	// TransactionRecoveryNotFound is returned when a transaction in-flight before a restart is neither mined nor known to the node
+	TransactionRecoveryNotFound = e(100331, "Transaction %s was in-flight before a restart, and is no longer known to the node")
+
+	// RESTGatewayInflightDBOpenFailed is returned when the store of in-flight transactions cannot be opened
+	RESTGatewayInflightDBOpenFailed = e(100332, "Failed to open the in-flight transactions database: %s")
+
+	// TransactionSendBadMaxFee is returned when a user-supplied maxFeePerGas cannot be converted to a big integer
+	TransactionSendBadMaxFee = e(100333, "Converting supplied 'maxFeePerGas' to big integer")
+
+	// TransactionSendBadPriorityFee is returned when a user-supplied maxPriorityFeePerGas cannot be converted to a big integer
+	TransactionSendBadPriorityFee = e(100334, "Converting supplied 'maxPriorityFeePerGas' to big integer")
+
+	// TransactionSendMissingMaxFee is returned when a priority fee is supplied without a maximum fee
+	TransactionSendMissingMaxFee = e(100335, "'maxFeePerGas' must be supplied with 'maxPriorityFeePerGas'")
+
+	// TransactionSendGasPriceAndMaxFee is returned when a transaction is supplied with both a legacy gas price, and dynamic fees
+	TransactionSendGasPriceAndMaxFee = e(100336, "'gasPrice' cannot be supplied with 'maxFeePerGas'")
+
+	// TransactionSendPriorityFeeAboveMaxFee is returned when the priority fee is higher than the maximum fee
+	TransactionSendPriorityFeeAboveMaxFee = e(100337, "'maxPriorityFeePerGas' %s is higher than 'maxFeePerGas' %s")
+
+	// TransactionSendDynamicFeeWithExternalSigner is returned when a dynamic fee transaction is sent with a signer other than the node
+	TransactionSendDynamicFeeWithExternalSigner = e(100338, "Dynamic fee transactions are not supported with the '%s' signer")
+
+	// TransactionSendGasEstimateExceedsMax is returned when the estimated gas for a transaction is over the configured maximum
+	TransactionSendGasEstimateExceedsMax = e(100339, "Estimated gas %d exceeds the maximum of %d")
+
+	// RESTGatewayGuardInvalid is returned when a guard supplied when registering a contract is invalid
+	RESTGatewayGuardInvalid = e(100340, "Invalid guard: %s")
+
+	// RESTGatewayGuardDenied is returned when a guard of a contract does not permit the sender to submit a transaction
+	RESTGatewayGuardDenied = e(100341, "Transaction from %s to %s was not permitted: %s")
+
+	// RESTGatewayGuardCheckFailed is returned when the call to check a guard of a contract fails
+	RESTGatewayGuardCheckFailed = e(100342, "Failed to check guard %s: %s")
+
+	// TransactionSpeedUpMissingHash is returned when a speed-up or cancel request does not identify the transaction
+	TransactionSpeedUpMissingHash = e(100343, "Must supply the transactionHash of the in-flight transaction")
+
+	// TransactionSpeedUpInvalidFee is returned when a speed-up or cancel request has a fee that is not an integer
+	TransactionSpeedUpInvalidFee = e(100344, "Invalid %s '%s' for the replacement transaction")
+
+	// TransactionSpeedUpNotFound is returned when the transaction to speed up is not in-flight in this processor
+	TransactionSpeedUpNotFound = e(100345, "Transaction %s is not in-flight")
+
+	// TransactionSpeedUpNotReplaceable is returned when the transaction to speed up or cancel cannot be replaced with the same nonce
+	TransactionSpeedUpNotReplaceable = e(100346, "Transaction %s cannot be replaced, as its nonce is not managed by the gateway")
+
+	// TransactionSpeedUpInProgress is returned when a speed-up or cancel of the transaction is already being processed
+	TransactionSpeedUpInProgress = e(100347, "A replacement of transaction %s is already in progress")
+
+	// TransactionSpeedUpCompleted is returned when the transaction was mined, or timed out, before the speed-up or cancel was processed
+	TransactionSpeedUpCompleted = e(100348, "Transaction %s completed before it could be replaced")
+
+	// RESTGatewaySpeedUpMined is returned when the transaction to speed up has already been mined
+	RESTGatewaySpeedUpMined = e(100349, "Transaction %s has already been mined in block %s")
+
+	// WebSocketUnauthorized is returned when the security module rejects a WebSocket upgrade request
+	WebSocketUnauthorized = e(100350, "WebSocket connection not authorized: %s")
+
+	// WebSocketTopicUnauthorized is returned when the security module rejects a WebSocket listening on a topic
+	WebSocketTopicUnauthorized = e(100351, "Not authorized to listen on WebSocket topic '%s': %s")
+
+	// EventStreamsMaxRetryInvalidDuration is returned when a max retry policy is configured without a duration
+	EventStreamsMaxRetryInvalidDuration = e(100352, "Must specify maxRetry.durationSec greater than zero")
+
+	// EventStreamsMaxRetryInvalidAction is returned when the action of a max retry policy is not supported
+	EventStreamsMaxRetryInvalidAction = e(100353, "Invalid maxRetry.action '%s'. Must be 'suspend' or 'skip'")
+
+	// EventStreamsMaxRetryExceeded is recorded on a stream suspended after retrying a batch for the max retry duration
+	EventStreamsMaxRetryExceeded = e(100354, "Suspended after retrying batch %d for %s: %s")
+
+	// TransactionCancelPrivate is returned when cancelling a private transaction, which cannot be replaced by a public transfer
+	TransactionCancelPrivate = e(100355, "Transaction %s cannot be cancelled, as it is a private transaction")
+
+	// TransactionCancelInProgress is returned when the transaction has already been cancelled
+	TransactionCancelInProgress = e(100356, "Transaction %s has already been cancelled by %s")
+
+	// TransactionCancelled is returned to the original request when the cancellation was mined instead of the transaction
+	TransactionCancelled = e(100357, "Transaction %s was cancelled by %s, mined in block %s")
+
+	// TransactionCancelNotMined is returned when tracking stops before either the transaction or the cancellation is mined
+	TransactionCancelNotMined = e(100358, "Neither transaction %s nor the cancellation %s was mined before the gateway stopped waiting")
+
+	// RESTGatewayUpgradeInvalid is returned when the body of a request to upgrade a contract cannot be parsed
+	RESTGatewayUpgradeInvalid = e(100359, "Invalid contract upgrade: %s")
+
+	// RESTGatewayUpgradeABIMissing is returned when a contract upgrade does not specify the ABI of the new implementation
+	RESTGatewayUpgradeABIMissing = e(100360, "Must supply the abi of the new implementation of the contract")
+
+	// RESTGatewayUpgradeInvalidBlock is returned when the block an upgrade applies from is not a valid block number
+	RESTGatewayUpgradeInvalidBlock = e(100361, "Invalid fromBlock '%s' for the contract upgrade. Must be a block number")
+
+	// ContractRegistryUpgradeBlockNotAfter is returned when an upgrade does not apply after the current ABI version of a contract
+	ContractRegistryUpgradeBlockNotAfter = e(100362, "The upgrade of contract %s must apply from a block after %s, where its current ABI applies from")
+
+	// EventStreamsABIVersionNotFound is returned when an ABI version of an upgraded contract cannot be loaded to decode its events
+	EventStreamsABIVersionNotFound = e(100363, "ABI version %s of the contract was not found")
+
+	// TransactionSendCallFailedRevertError is returned when a call reverts with a panic, or a custom error of the contract
+	TransactionSendCallFailedRevertError = e(100364, "EVM reverted: %s")
+
+	// RESTGatewayInvokeParamsInvalid is returned when the parameters of a programmatic invocation cannot be serialized
+	RESTGatewayInvokeParamsInvalid = e(100365, "Invalid parameters for method '%s': %s")
+
+	// RESTGatewayInvokeTransactionFailed is returned by a programmatic invocation when the receipt of the transaction is a failure
+	RESTGatewayInvokeTransactionFailed = e(100366, "Transaction %s failed")
+
+	// EventStreamsHeartbeatNotEnabled is returned when the heartbeat is requested, but no heartbeat interval is configured
+	EventStreamsHeartbeatNotEnabled = e(100367, "The event processing heartbeat is not enabled")
+
+	// EventStreamsHeartbeatNotRecorded is returned when the heartbeat is requested before the first heartbeat is recorded
+	EventStreamsHeartbeatNotRecorded = e(100368, "No event processing heartbeat has been recorded yet")
+
+	// EventStreamsHeartbeatKafkaNotConfigured is returned when a heartbeat topic is configured without Kafka brokers for events
+	EventStreamsHeartbeatKafkaNotConfigured = e(100369, "Kafka brokers must be configured for events to send heartbeats to topic '%s'")
+
+	// TransactionNonceResetInvalid is returned when the nonce to reset an address to is not a non-negative integer
+	TransactionNonceResetInvalid = e(100370, "Invalid nonce '%s' to reset to")
+
+	// RESTGatewayFacetABIMissing is returned when a request to add a facet to a contract does not specify its ABI
+	RESTGatewayFacetABIMissing = e(100371, "Must supply the abi of the facet to add to the contract")
+
+	// ContractRegistryFacetExists is returned when an ABI is already registered against a contract, as its main ABI or a facet
+	ContractRegistryFacetExists = e(100372, "ABI %s is already registered against contract %s")
+
+	// ContractRegistryFacetNotFound is returned when removing an ABI that is not a facet of a contract
+	ContractRegistryFacetNotFound = e(100373, "ABI %s is not a facet of contract %s")
+
+	// ContractRegistryFacetCollision is returned when the methods or events of a facet collide with those of the ABIs already registered against a contract
+	ContractRegistryFacetCollision = e(100374, "ABI %s cannot be added as a facet of contract %s, as it collides with: %s")
+
+	// AddressResolverPluginSymbol is returned when an address resolver plugin does not export an 'AddressResolver' symbol
+	AddressResolverPluginSymbol = e(100375, "Failed to load 'AddressResolver' symbol from '%s': %s")
+
+	// RESTGatewayAddressResolveFailed is returned when an identifier supplied for an address parameter cannot be resolved to an address
+	RESTGatewayAddressResolveFailed = e(100376, "Failed to resolve '%s' supplied for parameter '%s' to an address: %s")
+
+	// IdentifierResolvedInvalidAddress is returned when an address resolver returns something other than a hex address
+	IdentifierResolvedInvalidAddress = e(100377, "The resolver for '%s' returned '%s', which is not a valid address")
+
+	// IdentifierDIDEthrInvalid is returned when a did:ethr DID does not identify an address
+	IdentifierDIDEthrInvalid = e(100378, "'%s' is not a did:ethr DID of an address")
+
+	// RedisBadURL is returned when the URL of a Redis server cannot be parsed
+	RedisBadURL = e(100379, "Invalid Redis URL '%s': %s")
+
+	// RedisRequestFailed is returned when a request to Redis fails, or Redis returns an error
+	RedisRequestFailed = e(100380, "Redis request failed: %s")
+
+	// RedisUnexpectedReply is returned when Redis returns a reply that is not understood
+	RedisUnexpectedReply = e(100381, "Unexpected reply from Redis: %v")
+
+	// TransactionNonceAllocatorUnknown is returned when the configured nonce allocator is not one of the supported types
+	TransactionNonceAllocatorUnknown = e(100382, "Unknown nonce allocator '%s'")
+
+	// RESTGatewayAfterTxInvalid is returned when the transaction a query is to wait for is not a valid transaction hash
+	RESTGatewayAfterTxInvalid = e(100383, "Invalid %s-aftertx '%s': must be a transaction hash")
+
+	// RESTGatewayAfterTxTimeout is returned when the transaction a query is waiting for is not mined within the wait
+	RESTGatewayAfterTxTimeout = e(100384, "Timed out after %.2fs waiting for transaction %s to be mined")
+
+	// HDWalletUpdateBadTemplate is returned when the URL template of an updated HD wallet configuration does not parse
+	HDWalletUpdateBadTemplate = e(100385, "Invalid HD wallet URL template: %s")
+
+	// HDWalletUpdateBadChainID is returned when the chain ID of an updated HD wallet configuration is not a number
+	HDWalletUpdateBadChainID = e(100386, "Invalid HD wallet chain ID '%s'")
+
+	// AddressBookUpdateBadURL is returned when the URL prefix of an updated address book configuration is not an absolute URL
+	AddressBookUpdateBadURL = e(100387, "Invalid address book URL prefix '%s'")
+
+	// IntegrationUpdateProbeRequired is returned when an integration update does not supply the probe used to validate it
+	IntegrationUpdateProbeRequired = e(100388, "A probe %s is required to validate the %s configuration")
+
+	// IntegrationUpdateProbeFailed is returned when the validation probe of an updated integration fails, and the update is not applied
+	IntegrationUpdateProbeFailed = e(100389, "Validation probe of the %s configuration failed: %s")
+
+	// RPCCircuitBreakerOpen is returned when the JSON/RPC circuit breaker has tripped, until a probe of the node succeeds
+	RPCCircuitBreakerOpen = e(100390, "JSON/RPC circuit breaker is open after %d consecutive failures calling the node: %s")
+
+	// ZeroGasPriceBadPolicy is returned when the zero gas price policy is not one of the supported values
+	ZeroGasPriceBadPolicy = e(100391, "Invalid zero gas price policy '%s' - must be 'override' or 'reject'")
+
+	// ZeroGasPriceRejected is returned when a transaction is submitted with fees, to a chain that requires a gas price of zero
+	ZeroGasPriceRejected = e(100392, "Transactions must be sent with a gas price of zero on this chain: %s=%s")
+
+	// TransactionSpeedUpZeroGasPrice is returned when speeding up or cancelling a transaction, on a chain that requires a gas price of zero
+	TransactionSpeedUpZeroGasPrice = e(100393, "Transaction %s cannot be replaced, as transactions are sent with a gas price of zero")
+
+	// RESTGatewayIdempotencyDBOpenFailed is returned when the store of idempotency keys cannot be opened
+	RESTGatewayIdempotencyDBOpenFailed = e(100394, "Failed to open the idempotency key store: %s")
+
+	// RESTGatewayIdempotencyKeyInProgress is returned when a request repeats the idempotency key of a request that has not yet completed
+	RESTGatewayIdempotencyKeyInProgress = e(100395, "A request with idempotency key '%s' is already in progress as request %s")
+
+	// RemoteSignerSignFailed is returned when the remote signer fails to sign a transaction
+	RemoteSignerSignFailed = e(100396, "Remote signer failed to sign the transaction from %s: %s")
+
+	// RemoteSignerBadResponse is returned when the remote signer returns a signed transaction that cannot be decoded
+	RemoteSignerBadResponse = e(100397, "Remote signer returned an invalid signed transaction for %s: %s")
+
+	// EventStreamsWebhookSecretNotPermitted is returned when a webhook secret refers to a file outside the secrets directory, or an environment variable without the configured prefix
+	EventStreamsWebhookSecretNotPermitted = e(100398, "Webhook secret '%s' is not permitted. Files must be in the configured secrets directory, and environment variables must have the configured prefix")
+
+	// RESTGatewayABIImportURLNotAllowed is returned when the apiURL of an ABI import is not an allowed host
+	RESTGatewayABIImportURLNotAllowed = e(100399, "Cannot import an ABI from '%s': %s")
+
+	// RESTGatewayIdempotencyKeyMismatch is returned when an idempotency key is repeated with a different request
+	RESTGatewayIdempotencyKeyMismatch = e(100400, "Idempotency key '%s' was used by request %s, with different parameters")
+
+	// RPCMethodNotFound is returned when the node reports that it does not support a JSON/RPC method
+	RPCMethodNotFound = e(100401, "%s is not supported by the node: %s")
+
+	// EventStreamsWebhookTLSNotPermitted is returned when a webhook refers to a TLS file outside of the directory configured by the operator
+	EventStreamsWebhookTLSNotPermitted = e(100402, "Webhook TLS file '%s' is not permitted. Files must be in the configured webhook TLS directory")
+
+	// RESTGatewayTokenInvalidBalance is returned when the balance returned by a token contract cannot be parsed
+	RESTGatewayTokenInvalidBalance = e(100403, "Token contract %s returned an invalid balance '%s'")
+
+	// EventStreamsInactivityNoConsumerNotWebSocket is returned when a no-consumer inactivity policy is set on anything other than a WebSocket stream
+	EventStreamsInactivityNoConsumerNotWebSocket = e(100404, "Inactivity noConsumerSec is only supported on WebSocket streams")
+
+	// EventStreamsInactivityNoConsumer is the reason recorded on a stream suspended by its inactivity policy, as no consumer was connected
+	EventStreamsInactivityNoConsumer = e(100405, "Suspended after no consumer was connected for %s")
+
+	// SolcPlatformUnsupported is returned when solc releases are not published for the platform the server is running on
+	SolcPlatformUnsupported = e(100406, "Downloading solc is not supported on %s/%s. Configure the compilers with FLY_SOLC_<major>_<minor> environment variables instead")
+
+	// EventStreamsBackupRedactedSecret is returned when a stream in an imported backup still has a secret that was redacted on export
+	EventStreamsBackupRedactedSecret = e(100407, "Stream '%s' in event streams backup has the redacted value '***' for %s. Set the secret, or a reference to it, before importing")
+
+	// EventStreamsBackupInvalidStream is returned when a stream in an imported backup fails validation
+	EventStreamsBackupInvalidStream = e(100408, "Stream '%s' in event streams backup is invalid: %s")
+
+	// EventStreamsBackupInvalidSubscription is returned when a subscription in an imported backup fails validation
+	EventStreamsBackupInvalidSubscription = e(100409, "Subscription '%s' in event streams backup is invalid: %s")
+
+	// EventStreamsMQTTTLSInvalid is returned when the TLS settings of an MQTT event stream cannot be loaded
+	EventStreamsMQTTTLSInvalid = e(100410, "Invalid mqtt.tls configuration: %s")
+
+	// RESTGatewayCompileContractUploadTooManyFiles is returned when an archive uploaded for compilation contains too many files
+	RESTGatewayCompileContractUploadTooManyFiles = e(100411, "Uploaded archive contains more than %d files")
+
+	// KafkaReplyTopicNotPermitted is returned when a request on the Kafka bridge sets a reply topic it cannot use
+	KafkaReplyTopicNotPermitted = e(100412, "Reply topic '%s' is not permitted")
 )
 
 type EthconnectError interface {
@@ -517,9 +1132,28 @@ func (e *ethconnectError) String() string {
 	return e.Error()
 }
 
+// RevertedError is returned when a transaction or call reverts, with the human readable
+// reason decoded from the revert data. The reason is empty if the data could not be decoded
+type RevertedError interface {
+	EthconnectError
+	RevertReason() string
+}
+
+type revertedError struct {
+	ethconnectError
+	reason string
+}
+
+func (e *revertedError) RevertReason() string {
+	return e.reason
+}
+
 type RESTError struct {
-	Message string `json:"error"`
-	Code    string `json:"code,omitempty"`
+	Message      string `json:"error"`
+	Code         string `json:"code,omitempty"`
+	ErrorType    string `json:"errorType,omitempty"`
+	Retryable    *bool  `json:"retryable,omitempty"`
+	RevertReason string `json:"revertReason,omitempty"`
 }
 
 func ToRESTError(err error) *RESTError {
@@ -532,10 +1166,23 @@ func ToRESTError(err error) *RESTError {
 	default:
 		errorMessage = err.Error()
 	}
-	return &RESTError{Message: errorMessage, Code: errorCode}
+	restErr := &RESTError{Message: errorMessage, Code: errorCode}
+	if errorType, retryable, ok := ClassifyNodeError(err); ok {
+		restErr.ErrorType = string(errorType)
+		restErr.Retryable = &retryable
+	}
+	if revertErr, ok := err.(RevertedError); ok {
+		restErr.RevertReason = revertErr.RevertReason()
+	}
+	return restErr
 }
 
 // Errorf creates an error (not yet translated, but an extensible interface for that using simple sprintf formatting rather than named i18n inserts)
 func Errorf(msg ErrorID, inserts ...interface{}) EthconnectError {
 	return &ethconnectError{msg.(*errorID), inserts}
 }
+
+// Reverted creates an error for a transaction or call that reverted, with the reason decoded from the revert data
+func Reverted(msg ErrorID, reason string, inserts ...interface{}) RevertedError {
+	return &revertedError{ethconnectError{msg.(*errorID), inserts}, reason}
+}
@@ -43,6 +43,18 @@ func TestToRESTErrorOtherErr(t *testing.T) {
 
 }
 
+func TestToRESTErrorReverted(t *testing.T) {
+
+	err := Reverted(TransactionSendCallFailedRevertMessage, "Muppetry detected", "Muppetry detected")
+	assert.Equal(t, "FFEC100149: Muppetry detected", err.Error())
+	restErr := ToRESTError(err)
+	assert.Equal(t, "Muppetry detected", restErr.Message)
+	assert.Equal(t, "FFEC100149", restErr.Code)
+	assert.Equal(t, "Muppetry detected", restErr.RevertReason)
+	assert.Equal(t, "reverted", restErr.ErrorType)
+
+}
+
 func TestDuplicate(t *testing.T) {
 	assert.Panics(t, func() {
 		e(100000, "dup")
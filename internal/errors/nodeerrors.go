@@ -0,0 +1,87 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import "strings"
+
+// NodeErrorType is the type of a common error returned by an Ethereum node when
+// submitting a transaction, so the caller can decide whether to retry it
+type NodeErrorType string
+
+const (
+	// NodeErrorNonceTooLow the nonce has already been used by a mined transaction
+	NodeErrorNonceTooLow NodeErrorType = "nonceTooLow"
+	// NodeErrorNonceTooHigh the nonce is too far ahead of the next nonce of the sender
+	NodeErrorNonceTooHigh NodeErrorType = "nonceTooHigh"
+	// NodeErrorReplacementUnderpriced a pending transaction with the same nonce can only be replaced with a higher gas price
+	NodeErrorReplacementUnderpriced NodeErrorType = "replacementUnderpriced"
+	// NodeErrorUnderpriced the gas price is below the minimum accepted by the node
+	NodeErrorUnderpriced NodeErrorType = "underpriced"
+	// NodeErrorAlreadyKnown the transaction is already in the pool of the node
+	NodeErrorAlreadyKnown NodeErrorType = "alreadyKnown"
+	// NodeErrorTxPoolFull the pool of the node cannot accept more transactions
+	NodeErrorTxPoolFull NodeErrorType = "txPoolFull"
+	// NodeErrorInsufficientFunds the sender cannot pay for the gas and value of the transaction
+	NodeErrorInsufficientFunds NodeErrorType = "insufficientFunds"
+	// NodeErrorGasLimit the gas limit is too low for the transaction, or above the block gas limit
+	NodeErrorGasLimit NodeErrorType = "gasLimit"
+	// NodeErrorReverted the transaction reverted when it was estimated or executed
+	NodeErrorReverted NodeErrorType = "reverted"
+	// NodeErrorUnavailable the node could not be reached, or did not respond in time
+	NodeErrorUnavailable NodeErrorType = "nodeUnavailable"
+)
+
+// nodeErrorClass matches the messages for a type of node error, in lower case
+type nodeErrorClass struct {
+	errorType NodeErrorType
+	retryable bool
+	matches   []string
+}
+
+// nodeErrorClasses are the messages of geth, Besu and Quorum nodes. More specific
+// messages are listed before the messages they contain
+var nodeErrorClasses = []nodeErrorClass{
+	{NodeErrorAlreadyKnown, false, []string{"already known", "known transaction"}},
+	{NodeErrorNonceTooLow, true, []string{"nonce too low"}},
+	{NodeErrorNonceTooHigh, true, []string{"nonce too high", "nonce too distant"}},
+	{NodeErrorReplacementUnderpriced, true, []string{"replacement transaction underpriced"}},
+	{NodeErrorUnderpriced, true, []string{"transaction underpriced", "gas price below configured minimum", "max fee per gas less than block base fee"}},
+	{NodeErrorTxPoolFull, true, []string{"txpool is full", "transaction pool is full"}},
+	{NodeErrorInsufficientFunds, false, []string{"insufficient funds", "upfront cost exceeds account balance"}},
+	{NodeErrorGasLimit, false, []string{"exceeds block gas limit", "intrinsic gas too low", "intrinsic gas exceeds gas limit", "out of gas"}},
+	{NodeErrorReverted, false, []string{"execution reverted", "transaction reverted"}},
+	{NodeErrorUnavailable, true, []string{"connection refused", "connection reset", "context deadline exceeded", "i/o timeout"}},
+}
+
+// ClassifyNodeError returns the type of a common node error, and whether the transaction
+// can be retried, for example with a new nonce or a higher gas price. The error is
+// matched on its message, so errors wrapping a node error are also classified
+func ClassifyNodeError(err error) (errorType NodeErrorType, retryable bool, ok bool) {
+	if err == nil {
+		return "", false, false
+	}
+	if _, ok := err.(RevertedError); ok {
+		return NodeErrorReverted, false, true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, class := range nodeErrorClasses {
+		for _, match := range class.matches {
+			if strings.Contains(msg, match) {
+				return class.errorType, class.retryable, true
+			}
+		}
+	}
+	return "", false, false
+}
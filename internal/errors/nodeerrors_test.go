@@ -0,0 +1,76 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyNodeError(t *testing.T) {
+	assert := assert.New(t)
+
+	for msg, expected := range map[string]NodeErrorType{
+		"nonce too low": NodeErrorNonceTooLow,
+		"Nonce too low": NodeErrorNonceTooLow,
+		"Nonce too distant from current sender nonce":          NodeErrorNonceTooHigh,
+		"replacement transaction underpriced":                  NodeErrorReplacementUnderpriced,
+		"Replacement transaction underpriced":                  NodeErrorReplacementUnderpriced,
+		"transaction underpriced":                              NodeErrorUnderpriced,
+		"Gas price below configured minimum gas price":         NodeErrorUnderpriced,
+		"already known":                                        NodeErrorAlreadyKnown,
+		"Known transaction":                                    NodeErrorAlreadyKnown,
+		"txpool is full":                                       NodeErrorTxPoolFull,
+		"insufficient funds for gas * price + value":           NodeErrorInsufficientFunds,
+		"Upfront cost exceeds account balance":                 NodeErrorInsufficientFunds,
+		"exceeds block gas limit":                              NodeErrorGasLimit,
+		"Intrinsic gas exceeds gas limit":                      NodeErrorGasLimit,
+		"execution reverted: not allowed":                      NodeErrorReverted,
+		"dial tcp 127.0.0.1:8545: connect: connection refused": NodeErrorUnavailable,
+	} {
+		errorType, _, ok := ClassifyNodeError(fmt.Errorf("%s", msg))
+		assert.True(ok, msg)
+		assert.Equal(expected, errorType, msg)
+	}
+
+	errorType, retryable, ok := ClassifyNodeError(fmt.Errorf("nonce too low"))
+	assert.True(ok)
+	assert.True(retryable)
+	assert.Equal(NodeErrorNonceTooLow, errorType)
+
+	errorType, retryable, ok = ClassifyNodeError(Errorf(RESTGatewaySyncWrapErrorWithTXDetail, "0x12345", fmt.Errorf("insufficient funds for transfer")))
+	assert.True(ok)
+	assert.False(retryable)
+	assert.Equal(NodeErrorInsufficientFunds, errorType)
+
+	_, _, ok = ClassifyNodeError(fmt.Errorf("pop"))
+	assert.False(ok)
+	_, _, ok = ClassifyNodeError(nil)
+	assert.False(ok)
+}
+
+func TestToRESTErrorNodeError(t *testing.T) {
+	assert := assert.New(t)
+
+	restErr := ToRESTError(fmt.Errorf("replacement transaction underpriced"))
+	assert.Equal("replacementUnderpriced", restErr.ErrorType)
+	assert.True(*restErr.Retryable)
+
+	restErr = ToRESTError(fmt.Errorf("pop"))
+	assert.Empty(restErr.ErrorType)
+	assert.Nil(restErr.Retryable)
+}
@@ -18,13 +18,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
-	"os/exec"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	log "github.com/sirupsen/logrus"
@@ -33,6 +34,8 @@ import (
 const (
 	// DefaultEVMVersion is the EVMVersion to be used when not specified explicitly
 	defaultEVMVersion = "byzantium"
+	// solcCombinedOutputs are always selected, as they are needed to deploy and document a contract
+	solcCombinedOutputs = "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata"
 )
 
 // CompiledSolidity wraps solc compilation of solidity and ABI generation
@@ -47,7 +50,7 @@ type CompiledSolidity struct {
 var solcVerChecker *regexp.Regexp
 var defaultSolc string
 
-func getSolcExecutable(requestedVersion string) (string, error) {
+func getSolcExecutable(conf *SolcConf, requestedVersion string) (string, error) {
 	log.Infof("Solidity compiler requested: %s", requestedVersion)
 	if solcVerChecker == nil {
 		solcVerChecker, _ = regexp.Compile("^([0-9]+)\\.?([0-9]+)")
@@ -56,7 +59,14 @@ func getSolcExecutable(requestedVersion string) (string, error) {
 	solc := defaultSolc
 	if v := solcVerChecker.FindStringSubmatch(requestedVersion); v != nil {
 		envVarName := utils.GetenvOrDefaultUpperCase("PREFIX_SHORT", "fly") + "_SOLC_" + v[1] + "_" + v[2]
-		if envVar := os.Getenv(envVarName); envVar != "" {
+		envVar := os.Getenv(envVarName)
+		downloaded, err := managedSolcExecutable(conf, requestedVersion, envVar != "")
+		if err != nil {
+			return "", err
+		}
+		if downloaded != "" {
+			solc = downloaded
+		} else if envVar != "" {
 			solc = envVar
 		} else {
 			return "", errors.Errorf(errors.CompilerVersionNotFound, v[1], v[2])
@@ -70,42 +80,89 @@ func getSolcExecutable(requestedVersion string) (string, error) {
 
 // GetSolc returns the appropriate solc command based on the combination of env vars, and message-specific request
 // parameters passed in
-func GetSolc(requestedVersion string) (*ethbinding.Solidity, error) {
-	solc, err := getSolcExecutable(requestedVersion)
+func GetSolc(conf *SolcConf, requestedVersion string) (*ethbinding.Solidity, error) {
+	solc, err := getSolcExecutable(conf, requestedVersion)
 	if err != nil {
 		return nil, err
 	}
 	return ethbind.API.SolidityVersion(solc)
 }
 
+// DefaultCompilerSettings returns the settings used to compile a contract, when no others are requested
+func DefaultCompilerSettings(evmVersion string) *messages.CompilerSettings {
+	if evmVersion == "" {
+		evmVersion = defaultEVMVersion
+	}
+	return &messages.CompilerSettings{
+		EVMVersion: evmVersion,
+		Optimize:   true,
+	}
+}
+
+// IsDefaultSolcOutput returns true if the combined JSON output is always selected
+func IsDefaultSolcOutput(output string) bool {
+	for _, o := range strings.Split(solcCombinedOutputs, ",") {
+		if o == output {
+			return true
+		}
+	}
+	return false
+}
+
 // GetSolcArgs get the correct solc args
 func GetSolcArgs(evmVersion string) []string {
+	return SolcArgs(DefaultCompilerSettings(evmVersion))
+}
+
+// SolcArgs returns the solc args for the compiler settings
+func SolcArgs(settings *messages.CompilerSettings) []string {
+	outputs := solcCombinedOutputs
+	if len(settings.Outputs) > 0 {
+		outputs += "," + strings.Join(settings.Outputs, ",")
+	}
+	args := []string{"--combined-json", outputs}
+	if settings.Optimize {
+		args = append(args, "--optimize")
+		if settings.OptimizeRuns > 0 {
+			args = append(args, "--optimize-runs", strconv.Itoa(settings.OptimizeRuns))
+		}
+	}
+	evmVersion := settings.EVMVersion
 	if evmVersion == "" {
 		evmVersion = defaultEVMVersion
 	}
-	return []string{
-		"--combined-json", "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata",
-		"--optimize",
+	args = append(args,
 		"--evm-version", evmVersion,
 		"--allow-paths", ".",
+	)
+	// Import remappings are passed to solc alongside the source files
+	return append(args, settings.Remappings...)
+}
+
+// GetSolcForSource returns the solc command for the requested version, or when no version is
+// requested and solc downloads are enabled, for the version pragmas of the Solidity sources
+func GetSolcForSource(conf *SolcConf, requestedVersion string, sources ...string) (*ethbinding.Solidity, error) {
+	version, err := SolcVersionForSource(conf, requestedVersion, sources...)
+	if err != nil {
+		return nil, err
 	}
+	return GetSolc(conf, version)
 }
 
 // CompileContract uses solc to compile the Solidity source and
-func CompileContract(soliditySource, contractName, requestedVersion, evmVersion string) (*CompiledSolidity, error) {
+func CompileContract(conf *SolcConf, soliditySource, contractName, requestedVersion, evmVersion string) (*CompiledSolidity, error) {
 	// Compile the solidity
-	s, err := GetSolc(requestedVersion)
+	s, err := GetSolcForSource(conf, requestedVersion, soliditySource)
 	if err != nil {
 		return nil, err
 	}
 
 	solcArgs := GetSolcArgs(evmVersion)
-	cmd := exec.Command(s.Path, append(solcArgs, "--", "-")...)
-	cmd.Stdin = strings.NewReader(soliditySource)
 	var stderr, stdout bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	if err := cmd.Run(); err != nil {
+	if err := RunSolc(conf, s.Path, append(solcArgs, "--", "-"), "", strings.NewReader(soliditySource), &stdout, &stderr); err != nil {
+		if CompileErrorStatus(err, 0) != 0 {
+			return nil, err
+		}
 		return nil, errors.Errorf(errors.CompilerFailedSolc, err, stderr.String())
 	}
 	c, _ := ethbind.API.ParseCombinedJSON(stdout.Bytes(), soliditySource, s.Version, s.Version, strings.Join(solcArgs, " "))
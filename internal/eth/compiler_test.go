@@ -18,6 +18,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/stretchr/testify/assert"
 )
@@ -102,7 +103,7 @@ func TestSolcDefaultVersion(t *testing.T) {
 	assert := assert.New(t)
 	os.Setenv("FLY_SOLC_DEFAULT", "")
 	defaultSolc = ""
-	solc, err := getSolcExecutable("")
+	solc, err := getSolcExecutable(&SolcConf{}, "")
 	assert.NoError(err)
 	assert.Equal("solc", solc)
 	os.Unsetenv("FLY_SOLC_DEFAULT")
@@ -112,7 +113,7 @@ func TestSolcDefaultVersionEnvVar(t *testing.T) {
 	assert := assert.New(t)
 	os.Setenv("FLY_SOLC_DEFAULT", "solc123")
 	defaultSolc = ""
-	solc, err := getSolcExecutable("")
+	solc, err := getSolcExecutable(&SolcConf{}, "")
 	assert.NoError(err)
 	assert.Equal("solc123", solc)
 	os.Unsetenv("FLY_SOLC_DEFAULT")
@@ -122,7 +123,7 @@ func TestSolcCustomVersionValidMajor(t *testing.T) {
 	assert := assert.New(t)
 	os.Setenv("FLY_SOLC_0_4", "solc04")
 	defaultSolc = ""
-	solc, err := getSolcExecutable("0.4")
+	solc, err := getSolcExecutable(&SolcConf{}, "0.4")
 	assert.NoError(err)
 	assert.Equal("solc04", solc)
 }
@@ -131,7 +132,7 @@ func TestSolcCustomVersionValidMinor(t *testing.T) {
 	assert := assert.New(t)
 	os.Setenv("FLY_SOLC_0_4", "solc04")
 	defaultSolc = ""
-	solc, err := getSolcExecutable("0.4.23.some interesting things")
+	solc, err := getSolcExecutable(&SolcConf{}, "0.4.23.some interesting things")
 	assert.NoError(err)
 	assert.Equal("solc04", solc)
 }
@@ -139,20 +140,44 @@ func TestSolcCustomVersionValidMinor(t *testing.T) {
 func TestSolcCustomVersionUnknown(t *testing.T) {
 	assert := assert.New(t)
 	defaultSolc = ""
-	_, err := getSolcExecutable("0.5")
+	_, err := getSolcExecutable(&SolcConf{}, "0.5")
 	assert.Regexp("Could not find a configured compiler for requested Solidity major version 0.5", err)
 }
 
 func TestSolcCustomVersionInvalid(t *testing.T) {
 	assert := assert.New(t)
 	defaultSolc = ""
-	_, err := getSolcExecutable("0.")
+	_, err := getSolcExecutable(&SolcConf{}, "0.")
 	assert.Regexp("Invalid Solidity version requested for compiler. Ensure the string starts with two dot separated numbers, such as 0.5", err)
 }
 
 func TestSolcCompileInvalidVersion(t *testing.T) {
 	assert := assert.New(t)
 	defaultSolc = ""
-	_, err := CompileContract("", "", "zero.four", "")
+	_, err := CompileContract(&SolcConf{}, "", "", "zero.four", "")
 	assert.Regexp("Invalid Solidity version requested for compiler. Ensure the string starts with two dot separated numbers, such as 0.5", err)
 }
+
+func TestSolcArgs(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		"--combined-json", "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata",
+		"--optimize",
+		"--evm-version", "byzantium",
+		"--allow-paths", ".",
+	}, GetSolcArgs(""))
+	assert.Equal([]string{
+		"--combined-json", "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata,storage-layout",
+		"--optimize", "--optimize-runs", "1000",
+		"--evm-version", "london",
+		"--allow-paths", ".",
+		"@openzeppelin/=lib/openzeppelin/",
+	}, SolcArgs(&messages.CompilerSettings{EVMVersion: "london", Optimize: true, OptimizeRuns: 1000, Outputs: []string{"storage-layout"}, Remappings: []string{"@openzeppelin/=lib/openzeppelin/"}}))
+	assert.Equal([]string{
+		"--combined-json", "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata",
+		"--evm-version", "byzantium",
+		"--allow-paths", ".",
+	}, SolcArgs(&messages.CompilerSettings{OptimizeRuns: 1000}))
+	assert.True(IsDefaultSolcOutput("metadata"))
+	assert.False(IsDefaultSolcOutput("hashes"))
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+const (
+	// ConsensusProtocolQBFT is the QBFT consensus protocol of Hyperledger Besu, with the qbft_ JSON/RPC methods
+	ConsensusProtocolQBFT = "qbft"
+	// ConsensusProtocolIBFT is the IBFT 2.0 consensus protocol of Hyperledger Besu, with the ibft_ JSON/RPC methods
+	ConsensusProtocolIBFT = "ibft"
+)
+
+const (
+	// ValidatorVoteAdd is a vote to add a validator
+	ValidatorVoteAdd = "add"
+	// ValidatorVoteRemove is a vote to remove a validator
+	ValidatorVoteRemove = "remove"
+)
+
+// ValidatorVote is a vote the node has pending to add or remove a validator, which it
+// includes in the blocks it proposes until the vote is discarded
+type ValidatorVote struct {
+	Address string `json:"address"`
+	Vote    string `json:"vote"`
+}
+
+// ValidateConsensusProtocol checks the consensus protocol is one with validator management methods,
+// and returns it in lower case
+func ValidateConsensusProtocol(protocol string) (string, error) {
+	protocol = strings.ToLower(protocol)
+	switch protocol {
+	case ConsensusProtocolQBFT, ConsensusProtocolIBFT:
+		return protocol, nil
+	default:
+		return "", errors.Errorf(errors.ConsensusAdminInvalidProtocol, protocol)
+	}
+}
+
+// GetValidators gets the validators at a block number, or "latest", using
+// qbft_getValidatorsByBlockNumber or ibft_getValidatorsByBlockNumber
+func GetValidators(ctx context.Context, rpc RPCClient, protocol, blockNumber string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	method := protocol + "_getValidatorsByBlockNumber"
+	validators := []string{}
+	if err := rpc.CallContext(ctx, &validators, method, blockNumber); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, method, err)
+	}
+	return validators, nil
+}
+
+// GetValidatorVotes gets the votes the node has pending, sorted by address
+func GetValidatorVotes(ctx context.Context, rpc RPCClient, protocol string) ([]*ValidatorVote, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	method := protocol + "_getPendingVotes"
+	var pending map[string]bool
+	if err := rpc.CallContext(ctx, &pending, method); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, method, err)
+	}
+	votes := make([]*ValidatorVote, 0, len(pending))
+	for addr, add := range pending {
+		vote := &ValidatorVote{Address: addr, Vote: ValidatorVoteRemove}
+		if add {
+			vote.Vote = ValidatorVoteAdd
+		}
+		votes = append(votes, vote)
+	}
+	sort.Slice(votes, func(i, j int) bool { return votes[i].Address < votes[j].Address })
+	return votes, nil
+}
+
+// ProposeValidatorVote asks the node to vote to add or remove a validator
+func ProposeValidatorVote(ctx context.Context, rpc RPCClient, protocol, addr, vote string) error {
+	var add bool
+	switch vote {
+	case ValidatorVoteAdd:
+		add = true
+	case ValidatorVoteRemove:
+		add = false
+	default:
+		return errors.Errorf(errors.ConsensusAdminInvalidVote, vote)
+	}
+	return validatorVoteCall(ctx, rpc, protocol+"_proposeValidatorVote", addr, add)
+}
+
+// DiscardValidatorVote asks the node to discard its pending vote for a validator
+func DiscardValidatorVote(ctx context.Context, rpc RPCClient, protocol, addr string) error {
+	return validatorVoteCall(ctx, rpc, protocol+"_discardValidatorVote", addr)
+}
+
+func validatorVoteCall(ctx context.Context, rpc RPCClient, method, addr string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var accepted bool
+	if err := rpc.CallContext(ctx, &accepted, method, append([]interface{}{addr}, args...)...); err != nil {
+		return errors.Errorf(errors.RPCCallReturnedError, method, err)
+	}
+	if !accepted {
+		return errors.Errorf(errors.ConsensusAdminVoteRejected, method, addr)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConsensusProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := ValidateConsensusProtocol("QBFT")
+	assert.NoError(err)
+	assert.Equal(ConsensusProtocolQBFT, p)
+	p, err = ValidateConsensusProtocol("ibft")
+	assert.NoError(err)
+	assert.Equal(ConsensusProtocolIBFT, p)
+	_, err = ValidateConsensusProtocol("clique")
+	assert.Regexp("Invalid consensus protocol 'clique'", err)
+}
+
+func TestGetValidators(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			json.Unmarshal([]byte(`["0x1111", "0x2222"]`), result)
+		},
+	}
+
+	validators, err := GetValidators(context.Background(), &r, ConsensusProtocolQBFT, "latest")
+	assert.NoError(err)
+	assert.Equal("qbft_getValidatorsByBlockNumber", r.capturedMethod)
+	assert.Equal([]interface{}{"latest"}, r.capturedArgs)
+	assert.Equal([]string{"0x1111", "0x2222"}, validators)
+}
+
+func TestGetValidatorsErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{mockError: fmt.Errorf("pop")}
+	_, err := GetValidators(context.Background(), &r, ConsensusProtocolIBFT, "0x10")
+	assert.Regexp("ibft_getValidatorsByBlockNumber returned: pop", err)
+}
+
+func TestGetValidatorVotes(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			json.Unmarshal([]byte(`{"0x2222": false, "0x1111": true}`), result)
+		},
+	}
+
+	votes, err := GetValidatorVotes(context.Background(), &r, ConsensusProtocolQBFT)
+	assert.NoError(err)
+	assert.Equal("qbft_getPendingVotes", r.capturedMethod)
+	assert.Equal([]*ValidatorVote{
+		{Address: "0x1111", Vote: ValidatorVoteAdd},
+		{Address: "0x2222", Vote: ValidatorVoteRemove},
+	}, votes)
+}
+
+func TestGetValidatorVotesErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{mockError: fmt.Errorf("pop")}
+	_, err := GetValidatorVotes(context.Background(), &r, ConsensusProtocolQBFT)
+	assert.Regexp("qbft_getPendingVotes returned: pop", err)
+}
+
+func TestProposeValidatorVote(t *testing.T) {
+	assert := assert.New(t)
+
+	accept := func(result interface{}) { *(result.(*bool)) = true }
+	r := testRPCClient{resultWrangler: accept}
+	err := ProposeValidatorVote(context.Background(), &r, ConsensusProtocolQBFT, "0x1111", ValidatorVoteAdd)
+	assert.NoError(err)
+	assert.Equal("qbft_proposeValidatorVote", r.capturedMethod)
+	assert.Equal([]interface{}{"0x1111", true}, r.capturedArgs)
+
+	r = testRPCClient{resultWrangler: accept}
+	err = ProposeValidatorVote(context.Background(), &r, ConsensusProtocolIBFT, "0x1111", ValidatorVoteRemove)
+	assert.NoError(err)
+	assert.Equal("ibft_proposeValidatorVote", r.capturedMethod)
+	assert.Equal([]interface{}{"0x1111", false}, r.capturedArgs)
+
+	err = ProposeValidatorVote(context.Background(), &r, ConsensusProtocolQBFT, "0x1111", "maybe")
+	assert.Regexp("Invalid validator vote 'maybe'", err)
+}
+
+func TestProposeValidatorVoteRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{}
+	err := ProposeValidatorVote(context.Background(), &r, ConsensusProtocolQBFT, "0x1111", ValidatorVoteAdd)
+	assert.Regexp("The node did not accept qbft_proposeValidatorVote for validator 0x1111", err)
+
+	r = testRPCClient{mockError: fmt.Errorf("pop")}
+	err = ProposeValidatorVote(context.Background(), &r, ConsensusProtocolQBFT, "0x1111", ValidatorVoteAdd)
+	assert.Regexp("qbft_proposeValidatorVote returned: pop", err)
+}
+
+func TestDiscardValidatorVote(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{resultWrangler: func(result interface{}) { *(result.(*bool)) = true }}
+	err := DiscardValidatorVote(context.Background(), &r, ConsensusProtocolQBFT, "0x1111")
+	assert.NoError(err)
+	assert.Equal("qbft_discardValidatorVote", r.capturedMethod)
+	assert.Equal([]interface{}{"0x1111"}, r.capturedArgs)
+}
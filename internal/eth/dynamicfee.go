@@ -0,0 +1,114 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+type blockFeeInfo struct {
+	BaseFeePerGas *ethbinding.HexBigInt `json:"baseFeePerGas"`
+}
+
+// SetDynamicFees parses the EIP-1559 fees supplied on a message. When a maximum fee is set
+// the transaction is sent as a dynamic fee (type 2) transaction, rather than with a gasPrice.
+// If the priority fee is not set, it is left for the node to suggest
+func (tx *Txn) SetDynamicFees(msgMaxFee, msgPriorityFee json.Number) error {
+	if msgMaxFee == "" {
+		if msgPriorityFee != "" {
+			return errors.Errorf(errors.TransactionSendMissingMaxFee)
+		}
+		return nil
+	}
+	if gasPrice := tx.EthTX.GasPrice(); gasPrice != nil && gasPrice.Sign() != 0 {
+		return errors.Errorf(errors.TransactionSendGasPriceAndMaxFee)
+	}
+	maxFee, ok := new(big.Int).SetString(msgMaxFee.String(), 10)
+	if !ok {
+		return errors.Errorf(errors.TransactionSendBadMaxFee)
+	}
+	var priorityFee *big.Int
+	if msgPriorityFee != "" {
+		if priorityFee, ok = new(big.Int).SetString(msgPriorityFee.String(), 10); !ok {
+			return errors.Errorf(errors.TransactionSendBadPriorityFee)
+		}
+		if priorityFee.Cmp(maxFee) > 0 {
+			return errors.Errorf(errors.TransactionSendPriorityFeeAboveMaxFee, priorityFee.String(), maxFee.String())
+		}
+	}
+	tx.MaxFeePerGas = maxFee
+	tx.MaxPriorityFeePerGas = priorityFee
+	return nil
+}
+
+// IsDynamicFee returns true if the transaction is sent with EIP-1559 fees
+func (tx *Txn) IsDynamicFee() bool {
+	return tx.MaxFeePerGas != nil
+}
+
+// UseLegacyFees converts a dynamic fee transaction to a legacy transaction, for a chain
+// that does not support EIP-1559. The maximum fee is offered as the gas price
+func (tx *Txn) UseLegacyFees() {
+	if tx.MaxFeePerGas != nil {
+		tx.SetGasPrice(tx.MaxFeePerGas)
+		tx.MaxFeePerGas = nil
+		tx.MaxPriorityFeePerGas = nil
+	}
+}
+
+// setFeeArgs sets either the legacy gasPrice, or the dynamic fees, on the JSON/RPC arguments
+func (tx *Txn) setFeeArgs(txArgs *SendTXArgs) {
+	if tx.IsDynamicFee() {
+		txArgs.MaxFeePerGas = (*ethbinding.HexBigInt)(tx.MaxFeePerGas)
+		txArgs.MaxPriorityFeePerGas = (*ethbinding.HexBigInt)(tx.MaxPriorityFeePerGas)
+		return
+	}
+	txArgs.GasPrice = (*ethbinding.HexBigInt)(tx.EthTX.GasPrice())
+}
+
+// SupportsDynamicFees checks whether the chain supports EIP-1559 transactions, by
+// checking for a base fee in the latest block
+func SupportsDynamicFees(ctx context.Context, rpc RPCClient) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var block *blockFeeInfo
+	if err := rpc.CallContext(ctx, &block, "eth_getBlockByNumber", "latest", false); err != nil {
+		return false, errors.Errorf(errors.RPCCallReturnedError, "eth_getBlockByNumber", err)
+	}
+	supported := block != nil && block.BaseFeePerGas != nil
+	log.Debugf("Dynamic fee transactions supported=%t", supported)
+	return supported, nil
+}
+
+// GetMaxPriorityFee gets the priority fee the node suggests for new dynamic fee transactions
+func GetMaxPriorityFee(ctx context.Context, rpc RPCClient) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var priorityFee ethbinding.HexBigInt
+	if err := rpc.CallContext(ctx, &priorityFee, "eth_maxPriorityFeePerGas"); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, "eth_maxPriorityFeePerGas", err)
+	}
+	log.Debugf("eth_maxPriorityFeePerGas=%s", priorityFee.ToInt().String())
+	return priorityFee.ToInt(), nil
+}
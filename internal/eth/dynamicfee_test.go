@@ -0,0 +1,218 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDynamicFeeSendMsg() *messages.SendTransaction {
+	msg := &messages.SendTransaction{}
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Gas = "456"
+	msg.MaxFeePerGas = "2000"
+	msg.MaxPriorityFeePerGas = "100"
+	return msg
+}
+
+func TestNewSendTxnDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+
+	tx, err := NewSendTxn(testDynamicFeeSendMsg(), nil)
+	assert.NoError(err)
+	assert.True(tx.IsDynamicFee())
+	assert.Equal(int64(2000), tx.MaxFeePerGas.Int64())
+	assert.Equal(int64(100), tx.MaxPriorityFeePerGas.Int64())
+}
+
+func TestSetDynamicFeesValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testDynamicFeeSendMsg()
+	msg.GasPrice = "789"
+	_, err := NewSendTxn(msg, nil)
+	assert.Regexp("'gasPrice' cannot be supplied with 'maxFeePerGas'", err)
+
+	msg = testDynamicFeeSendMsg()
+	msg.MaxFeePerGas = ""
+	_, err = NewSendTxn(msg, nil)
+	assert.Regexp("'maxFeePerGas' must be supplied with 'maxPriorityFeePerGas'", err)
+
+	msg = testDynamicFeeSendMsg()
+	msg.MaxFeePerGas = "abc"
+	_, err = NewSendTxn(msg, nil)
+	assert.Regexp("Converting supplied 'maxFeePerGas' to big integer", err)
+
+	msg = testDynamicFeeSendMsg()
+	msg.MaxPriorityFeePerGas = "abc"
+	_, err = NewSendTxn(msg, nil)
+	assert.Regexp("Converting supplied 'maxPriorityFeePerGas' to big integer", err)
+
+	msg = testDynamicFeeSendMsg()
+	msg.MaxPriorityFeePerGas = "2001"
+	_, err = NewSendTxn(msg, nil)
+	assert.Regexp("'maxPriorityFeePerGas' 2001 is higher than 'maxFeePerGas' 2000", err)
+}
+
+func TestSetDynamicFeesNoPriorityFee(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testDynamicFeeSendMsg()
+	msg.MaxPriorityFeePerGas = ""
+	tx, err := NewSendTxn(msg, nil)
+	assert.NoError(err)
+	assert.True(tx.IsDynamicFee())
+	assert.Nil(tx.MaxPriorityFeePerGas)
+}
+
+func TestSendDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+
+	tx, err := NewSendTxn(testDynamicFeeSendMsg(), nil)
+	assert.NoError(err)
+
+	rpc := testRPCClient{}
+	err = tx.Send(context.Background(), &rpc)
+	assert.NoError(err)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+	txArgs := rpc.capturedArgs[0].(*SendTXArgs)
+	assert.Nil(txArgs.GasPrice)
+	assert.Equal(int64(2000), txArgs.MaxFeePerGas.ToInt().Int64())
+	assert.Equal(int64(100), txArgs.MaxPriorityFeePerGas.ToInt().Int64())
+}
+
+func TestSendLegacyFees(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testDynamicFeeSendMsg()
+	msg.MaxFeePerGas = ""
+	msg.MaxPriorityFeePerGas = ""
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(msg, nil)
+	assert.NoError(err)
+	assert.False(tx.IsDynamicFee())
+
+	rpc := testRPCClient{}
+	err = tx.Send(context.Background(), &rpc)
+	assert.NoError(err)
+	txArgs := rpc.capturedArgs[0].(*SendTXArgs)
+	assert.Equal(int64(789), txArgs.GasPrice.ToInt().Int64())
+	assert.Nil(txArgs.MaxFeePerGas)
+	assert.Nil(txArgs.MaxPriorityFeePerGas)
+}
+
+func TestSendDynamicFeesWithTXSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	signer := &mockTXSigner{
+		signed: []byte("testbytes"),
+		from:   "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	}
+	tx, err := NewSendTxn(testDynamicFeeSendMsg(), signer)
+	assert.NoError(err)
+
+	rpc := testRPCClient{}
+	err = tx.Send(context.Background(), &rpc)
+	assert.Regexp("Dynamic fee transactions are not supported with the 'mock signer' signer", err)
+	assert.Nil(signer.capturedTX)
+}
+
+func TestUseLegacyFees(t *testing.T) {
+	assert := assert.New(t)
+
+	tx, err := NewSendTxn(testDynamicFeeSendMsg(), nil)
+	assert.NoError(err)
+	tx.UseLegacyFees()
+	assert.False(tx.IsDynamicFee())
+	assert.Nil(tx.MaxPriorityFeePerGas)
+	assert.Equal(int64(2000), tx.EthTX.GasPrice().Int64())
+	assert.Equal(uint64(456), tx.EthTX.Gas())
+}
+
+func TestSupportsDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(**blockFeeInfo)) = &blockFeeInfo{BaseFeePerGas: (*ethbinding.HexBigInt)(big.NewInt(7))}
+		},
+	}
+	supported, err := SupportsDynamicFees(context.Background(), &r)
+	assert.NoError(err)
+	assert.True(supported)
+	assert.Equal("eth_getBlockByNumber", r.capturedMethod)
+	assert.Equal([]interface{}{"latest", false}, r.capturedArgs)
+}
+
+func TestSupportsDynamicFeesNoBaseFee(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(**blockFeeInfo)) = &blockFeeInfo{}
+		},
+	}
+	supported, err := SupportsDynamicFees(context.Background(), &r)
+	assert.NoError(err)
+	assert.False(supported)
+
+	supported, err = SupportsDynamicFees(context.Background(), &testRPCClient{})
+	assert.NoError(err)
+	assert.False(supported)
+}
+
+func TestSupportsDynamicFeesErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+	_, err := SupportsDynamicFees(context.Background(), &r)
+	assert.Regexp("eth_getBlockByNumber returned: pop", err)
+}
+
+func TestGetMaxPriorityFee(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			result.(*ethbinding.HexBigInt).ToInt().SetInt64(150)
+		},
+	}
+	priorityFee, err := GetMaxPriorityFee(context.Background(), &r)
+	assert.NoError(err)
+	assert.Equal("eth_maxPriorityFeePerGas", r.capturedMethod)
+	assert.Equal(int64(150), priorityFee.Int64())
+}
+
+func TestGetMaxPriorityFeeErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+	_, err := GetMaxPriorityFee(context.Background(), &r)
+	assert.Regexp("eth_maxPriorityFeePerGas returned: pop", err)
+}
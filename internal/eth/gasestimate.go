@@ -0,0 +1,55 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+const (
+	// DefaultGasEstimateFactor is the buffer applied to gas estimates, for variation as the
+	// chain changes between estimation and submission
+	DefaultGasEstimateFactor = 1.2
+)
+
+// GasEstimateConf configures how the gas for a transaction is set, when it is estimated
+// because the request did not supply it
+type GasEstimateConf struct {
+	Factor float64 `json:"factor,omitempty"`
+	MaxGas uint64  `json:"maxGas,omitempty"`
+}
+
+// gasLimit applies the safety factor to a gas estimate, capped at the maximum gas if configured.
+// An estimate that is already over the maximum fails, as the transaction would run out of gas
+func (c *GasEstimateConf) gasLimit(estimate uint64) (uint64, error) {
+	factor := DefaultGasEstimateFactor
+	var maxGas uint64
+	if c != nil {
+		if c.Factor > 0 {
+			factor = c.Factor
+		}
+		maxGas = c.MaxGas
+	}
+	if maxGas > 0 && estimate > maxGas {
+		return 0, errors.Errorf(errors.TransactionSendGasEstimateExceedsMax, estimate, maxGas)
+	}
+	gas := uint64(math.Ceil(float64(estimate) * factor))
+	if maxGas > 0 && gas > maxGas {
+		gas = maxGas
+	}
+	return gas, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGasLimitDefaultFactor(t *testing.T) {
+	assert := assert.New(t)
+
+	var c *GasEstimateConf
+	gas, err := c.gasLimit(100000)
+	assert.NoError(err)
+	assert.Equal(uint64(120000), gas)
+
+	gas, err = (&GasEstimateConf{}).gasLimit(21001)
+	assert.NoError(err)
+	assert.Equal(uint64(25202), gas)
+}
+
+func TestGasLimitFactorAndCap(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &GasEstimateConf{Factor: 1.5, MaxGas: 160000}
+	gas, err := c.gasLimit(100000)
+	assert.NoError(err)
+	assert.Equal(uint64(150000), gas)
+
+	gas, err = c.gasLimit(150000)
+	assert.NoError(err)
+	assert.Equal(uint64(160000), gas)
+
+	_, err = c.gasLimit(160001)
+	assert.Regexp("Estimated gas 160001 exceeds the maximum of 160000", err)
+}
+
+func testGasEstimateRPC(estimate uint64) *testRPCClient {
+	return &testRPCClient{
+		resultWrangler: func(result interface{}) {
+			if gas, ok := result.(**ethbinding.HexUint64); ok {
+				**gas = ethbinding.HexUint64(estimate)
+			}
+		},
+	}
+}
+
+func testGasEstimateSendMsg() *messages.SendTransaction {
+	msg := &messages.SendTransaction{}
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	return msg
+}
+
+func TestSendEstimatesGas(t *testing.T) {
+	assert := assert.New(t)
+
+	tx, err := NewSendTxn(testGasEstimateSendMsg(), nil)
+	assert.NoError(err)
+	tx.GasEstimate = &GasEstimateConf{Factor: 2}
+
+	rpc := testGasEstimateRPC(30000)
+	err = tx.Send(context.Background(), rpc)
+	assert.NoError(err)
+	assert.Equal("eth_estimateGas", rpc.capturedMethod)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod2)
+	assert.Equal(uint64(30000), tx.EstimatedGas)
+	txArgs := rpc.capturedArgs2[0].(*SendTXArgs)
+	assert.Equal(ethbinding.HexUint64(60000), *txArgs.Gas)
+}
+
+func TestSendEstimatedGasOverMax(t *testing.T) {
+	assert := assert.New(t)
+
+	tx, err := NewSendTxn(testGasEstimateSendMsg(), nil)
+	assert.NoError(err)
+	tx.GasEstimate = &GasEstimateConf{MaxGas: 25000}
+
+	rpc := testGasEstimateRPC(30000)
+	err = tx.Send(context.Background(), rpc)
+	assert.Regexp("Estimated gas 30000 exceeds the maximum of 25000", err)
+	assert.Equal("", rpc.capturedMethod2)
+}
+
+func TestSendSuppliedGasNotEstimated(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testGasEstimateSendMsg()
+	msg.Gas = "50000"
+	tx, err := NewSendTxn(msg, nil)
+	assert.NoError(err)
+	tx.GasEstimate = &GasEstimateConf{MaxGas: 25000}
+
+	rpc := testGasEstimateRPC(30000)
+	err = tx.Send(context.Background(), rpc)
+	assert.NoError(err)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+	assert.Equal(uint64(0), tx.EstimatedGas)
+}
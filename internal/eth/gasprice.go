@@ -0,0 +1,60 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetGasPrice gets the gas price the node suggests for new transactions
+func GetGasPrice(ctx context.Context, rpc RPCClient) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var gasPrice ethbinding.HexBigInt
+	if err := rpc.CallContext(ctx, &gasPrice, "eth_gasPrice"); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, "eth_gasPrice", err)
+	}
+	log.Debugf("eth_gasPrice=%s", gasPrice.ToInt().String())
+	return gasPrice.ToInt(), nil
+}
+
+// BumpGasPrice returns a gas price the given percentage higher, and at least one wei
+// higher, so a node accepts it as the replacement for a transaction with the same nonce
+func BumpGasPrice(gasPrice *big.Int, percent int) *big.Int {
+	bumped := new(big.Int).Mul(gasPrice, big.NewInt(int64(100+percent)))
+	bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(gasPrice) <= 0 {
+		bumped.Add(gasPrice, big.NewInt(1))
+	}
+	return bumped
+}
+
+// SetGasPrice re-encodes the transaction with a new gas price, keeping the nonce, gas
+// and data, so it can be sent again as a replacement for the original transaction
+func (tx *Txn) SetGasPrice(gasPrice *big.Int) {
+	if to := tx.EthTX.To(); to != nil {
+		tx.EthTX = ethbind.API.NewTransaction(tx.EthTX.Nonce(), *to, tx.EthTX.Value(), tx.EthTX.Gas(), gasPrice, tx.EthTX.Data())
+	} else {
+		tx.EthTX = ethbind.API.NewContractCreation(tx.EthTX.Nonce(), tx.EthTX.Value(), tx.EthTX.Gas(), gasPrice, tx.EthTX.Data())
+	}
+}
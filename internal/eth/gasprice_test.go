@@ -0,0 +1,80 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			result.(*ethbinding.HexBigInt).ToInt().SetInt64(1000)
+		},
+	}
+	gasPrice, err := GetGasPrice(context.Background(), &r)
+	assert.NoError(err)
+	assert.Equal("eth_gasPrice", r.capturedMethod)
+	assert.Equal(int64(1000), gasPrice.Int64())
+}
+
+func TestGetGasPriceErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+	_, err := GetGasPrice(context.Background(), &r)
+	assert.Regexp("eth_gasPrice returned: pop", err)
+}
+
+func TestBumpGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(int64(1100), BumpGasPrice(big.NewInt(1000), 10).Int64())
+	assert.Equal(int64(1500), BumpGasPrice(big.NewInt(1000), 50).Int64())
+	assert.Equal(int64(2), BumpGasPrice(big.NewInt(1), 10).Int64())
+	assert.Equal(int64(1), BumpGasPrice(big.NewInt(0), 10).Int64())
+}
+
+func TestSetGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	to := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	tx := &Txn{EthTX: ethbind.API.NewTransaction(5, to, big.NewInt(10), 21000, big.NewInt(1000), []byte{0x01})}
+	originalHash := tx.EthTX.Hash()
+	tx.SetGasPrice(big.NewInt(1100))
+	assert.Equal(int64(1100), tx.EthTX.GasPrice().Int64())
+	assert.Equal(uint64(5), tx.EthTX.Nonce())
+	assert.Equal(uint64(21000), tx.EthTX.Gas())
+	assert.Equal(to, *tx.EthTX.To())
+	assert.Equal([]byte{0x01}, tx.EthTX.Data())
+	assert.NotEqual(originalHash, tx.EthTX.Hash())
+
+	tx = &Txn{EthTX: ethbind.API.NewContractCreation(6, big.NewInt(0), 500000, big.NewInt(1000), []byte{0x02})}
+	tx.SetGasPrice(big.NewInt(2000))
+	assert.Equal(int64(2000), tx.EthTX.GasPrice().Int64())
+	assert.Equal(uint64(6), tx.EthTX.Nonce())
+	assert.Nil(tx.EthTX.To())
+}
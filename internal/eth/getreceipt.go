@@ -16,9 +16,11 @@ package eth
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -45,3 +47,53 @@ func (tx *Txn) GetTXReceipt(ctx context.Context, rpc RPCClient) (bool, error) {
 
 	return isMined, nil
 }
+
+// GetBlockNumber gets the current block height of the chain
+func GetBlockNumber(ctx context.Context, rpc RPCClient) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var blockNumber ethbinding.HexUint64
+	if err := rpc.CallContext(ctx, &blockNumber, "eth_blockNumber"); err != nil {
+		return 0, errors.Errorf(errors.RPCCallReturnedError, "eth_blockNumber", err)
+	}
+	return uint64(blockNumber), nil
+}
+
+// methodNotFoundCode is the JSON/RPC error code for a method the node does not implement
+const methodNotFoundCode = -32601
+
+// methodNotFound reports whether the node rejected a call because it does not implement the method
+func methodNotFound(err error) bool {
+	if e, ok := err.(interface{ ErrorCode() int }); ok && e.ErrorCode() == methodNotFoundCode {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "method not found")
+}
+
+// IsMethodNotFound reports whether an error returned by GetBlockReceipts means the node does not
+// support the method, rather than the call failing
+func IsMethodNotFound(err error) bool {
+	e, ok := err.(errors.EthconnectError)
+	return ok && e.Code() == errors.RPCMethodNotFound.Code()
+}
+
+// GetBlockReceipts gets the receipts for every transaction in a block with a single call.
+// The method is eth_getBlockReceipts or parity_getBlockReceipts, depending on the node.
+func GetBlockReceipts(ctx context.Context, rpc RPCClient, method string, blockNumber uint64) ([]*TxnReceipt, error) {
+	start := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var receipts []*TxnReceipt
+	if err := rpc.CallContext(ctx, &receipts, method, ethbinding.HexUint64(blockNumber)); err != nil {
+		if methodNotFound(err) {
+			return nil, errors.Errorf(errors.RPCMethodNotFound, method, err)
+		}
+		return nil, errors.Errorf(errors.RPCCallReturnedError, method, err)
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("%s(%d)=%d [%.2fs]", method, blockNumber, len(receipts), callTime.Seconds())
+	return receipts, nil
+}
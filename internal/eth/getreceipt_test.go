@@ -128,3 +128,85 @@ func TestGetTXReceiptOrionTXFail(t *testing.T) {
 	assert.Equal("priv_getTransactionReceipt", r.capturedMethod2)
 	assert.Equal(false, isMined)
 }
+
+func TestGetBlockNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*ethbinding.HexUint64)) = 12345
+		},
+	}
+
+	blockNumber, err := GetBlockNumber(context.Background(), &r)
+	assert.NoError(err)
+	assert.Equal("eth_blockNumber", r.capturedMethod)
+	assert.Equal(uint64(12345), blockNumber)
+}
+
+func TestGetBlockNumberErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	_, err := GetBlockNumber(context.Background(), &r)
+	assert.Regexp("pop", err)
+}
+
+func TestGetBlockReceipts(t *testing.T) {
+	assert := assert.New(t)
+
+	txHash := ethbinding.Hash{0x01}
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*[]*TxnReceipt)) = []*TxnReceipt{{TransactionHash: &txHash}}
+		},
+	}
+
+	receipts, err := GetBlockReceipts(context.Background(), &r, "parity_getBlockReceipts", 10)
+	assert.NoError(err)
+	assert.Equal("parity_getBlockReceipts", r.capturedMethod)
+	assert.Equal(ethbinding.HexUint64(10), r.capturedArgs[0])
+	assert.Equal(1, len(receipts))
+	assert.Equal(txHash, *receipts[0].TransactionHash)
+}
+
+func TestGetBlockReceiptsErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	_, err := GetBlockReceipts(context.Background(), &r, "eth_getBlockReceipts", 10)
+	assert.Regexp("pop", err)
+}
+
+type testMethodNotFoundError struct{}
+
+func (e *testMethodNotFoundError) Error() string {
+	return "the method eth_getBlockReceipts does not exist/is not available"
+}
+func (e *testMethodNotFoundError) ErrorCode() int { return -32601 }
+
+func TestGetBlockReceiptsMethodNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: &testMethodNotFoundError{},
+	}
+
+	_, err := GetBlockReceipts(context.Background(), &r, "eth_getBlockReceipts", 10)
+	assert.Regexp("FFEC100401", err)
+	assert.True(IsMethodNotFound(err))
+
+	r = testRPCClient{mockError: fmt.Errorf("Method not found")}
+	_, err = GetBlockReceipts(context.Background(), &r, "eth_getBlockReceipts", 10)
+	assert.True(IsMethodNotFound(err))
+
+	r = testRPCClient{mockError: fmt.Errorf("dial tcp 127.0.0.1:8545: connect: connection refused")}
+	_, err = GetBlockReceipts(context.Background(), &r, "eth_getBlockReceipts", 10)
+	assert.False(IsMethodNotFound(err))
+}
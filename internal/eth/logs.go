@@ -0,0 +1,113 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// TxnLog is a log emitted by a transaction, as included in its receipt
+type TxnLog struct {
+	Address  *ethbinding.Address `json:"address"`
+	Topics   []*ethbinding.Hash  `json:"topics"`
+	Data     ethbinding.HexBytes `json:"data"`
+	LogIndex *ethbinding.HexUint `json:"logIndex"`
+}
+
+// ABIEvents returns the events declared in an ABI that can be matched to a log, keyed by ID.
+// Anonymous events are excluded, as the first topic of their logs is not the ID of the event
+func ABIEvents(a ethbinding.ABIMarshaling) map[ethbinding.Hash]*ethbinding.ABIEvent {
+	events := make(map[ethbinding.Hash]*ethbinding.ABIEvent)
+	for _, element := range a {
+		if element.Type != "event" || element.Anonymous {
+			continue
+		}
+		event, err := ethbind.API.ABIElementMarshalingToABIEvent(&element)
+		if err != nil {
+			log.Warnf("Skipping invalid event %s in ABI: %s", element.Name, err)
+			continue
+		}
+		events[event.ID] = event
+	}
+	return events
+}
+
+// DecodeLog decodes a log against the events of an ABI, returning the matching event and its
+// arguments. The indexed arguments are decoded from the topics, and the others from the data.
+// Returns a nil event if none of the events match the log
+func DecodeLog(events map[ethbinding.Hash]*ethbinding.ABIEvent, txLog *TxnLog) (*ethbinding.ABIEvent, map[string]interface{}) {
+	if len(txLog.Topics) == 0 || txLog.Topics[0] == nil {
+		return nil, nil
+	}
+	event, ok := events[*txLog.Topics[0]]
+	if !ok {
+		return nil, nil
+	}
+	args := make(map[string]interface{})
+	topicIdx := 1 // first topic is the ID of the event
+	dataArgs := make(ethbinding.ABIArguments, 0, len(event.Inputs))
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			dataArgs = append(dataArgs, input)
+			continue
+		}
+		if topicIdx >= len(txLog.Topics) {
+			log.Warnf("Log %s does not have a topic for indexed argument %s of %s", txLog.LogIndex, input.Name, ethbind.API.ABIEventSignature(event))
+			return nil, nil
+		}
+		topic := txLog.Topics[topicIdx]
+		topicIdx++
+		if topic != nil {
+			args[input.Name] = TopicToValue(topic, &input)
+		} else {
+			args[input.Name] = nil
+		}
+	}
+	if len(dataArgs) > 0 {
+		for k, v := range ProcessRLPBytes(dataArgs, txLog.Data) {
+			args[k] = v
+		}
+	}
+	return event, args
+}
+
+// TopicToValue decodes an indexed argument of an event from a topic of the log
+func TopicToValue(topic *ethbinding.Hash, input *ethbinding.ABIArgument) interface{} {
+	switch input.Type.T {
+	case ethbinding.IntTy, ethbinding.UintTy, ethbinding.BoolTy:
+		h := ethbinding.HexBigInt{}
+		_ = h.UnmarshalText([]byte(topic.Hex()))
+		bI, _ := ethbind.API.ParseBig256(topic.Hex())
+		if input.Type.T == ethbinding.IntTy {
+			// It will be a two's complement number, so needs to be interpretted
+			bI = ethbind.API.S256(bI)
+			return bI.String()
+		} else if input.Type.T == ethbinding.BoolTy {
+			return (bI.Uint64() != 0)
+		}
+		return bI.String()
+	case ethbinding.AddressTy:
+		topicBytes := topic.Bytes()
+		addrBytes := topicBytes[len(topicBytes)-20:]
+		return ethbind.API.BytesToAddress(addrBytes)
+	default:
+		// For all other types it is just a hash of the output for indexing, so we can only
+		// logically return it as a hex string. The Solidity developer has to include
+		// the same data a second type non-indexed to get the real value.
+		return topic.String()
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+var testChangedABI = ethbinding.ABIMarshaling{
+	{
+		Type: "event", Name: "Changed",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "from", Type: "address", Indexed: true},
+			{Name: "i", Type: "uint256"},
+			{Name: "s", Type: "string"},
+		},
+	},
+	{
+		Type: "event", Name: "Anon", Anonymous: true,
+	},
+	{
+		Type: "event", Name: "Bad",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "badness"}},
+	},
+	{
+		Type: "function", Name: "set",
+	},
+}
+
+func testChangedLog(t *testing.T) (*ethbinding.ABIEvent, *TxnLog) {
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&testChangedABI[0])
+	assert.NoError(t, err)
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(12345), "testing")
+	assert.NoError(t, err)
+	addr := ethbind.API.HexToAddress("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832")
+	fromTopic := ethbind.API.HexToHash("0x000000000000000000000000aa983ad2a0e0ed8ac639277f37be42f2a5d2618c")
+	logIndex := ethbinding.HexUint(3)
+	return event, &TxnLog{
+		Address:  &addr,
+		Topics:   []*ethbinding.Hash{&event.ID, &fromTopic},
+		Data:     data,
+		LogIndex: &logIndex,
+	}
+}
+
+func TestABIEvents(t *testing.T) {
+	assert := assert.New(t)
+	event, _ := testChangedLog(t)
+	events := ABIEvents(testChangedABI)
+	assert.Len(events, 1)
+	assert.Equal("Changed", events[event.ID].Name)
+}
+
+func TestDecodeLog(t *testing.T) {
+	assert := assert.New(t)
+	_, txLog := testChangedLog(t)
+
+	event, args := DecodeLog(ABIEvents(testChangedABI), txLog)
+	assert.Equal("Changed(address,uint256,string)", ethbind.API.ABIEventSignature(event))
+	assert.Equal(ethbind.API.HexToAddress("0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"), args["from"])
+	assert.Equal("12345", args["i"])
+	assert.Equal("testing", args["s"])
+}
+
+func TestDecodeLogNilTopic(t *testing.T) {
+	assert := assert.New(t)
+	_, txLog := testChangedLog(t)
+	txLog.Topics[1] = nil
+
+	event, args := DecodeLog(ABIEvents(testChangedABI), txLog)
+	assert.NotNil(event)
+	assert.Nil(args["from"])
+	assert.Equal("12345", args["i"])
+}
+
+func TestDecodeLogNoMatch(t *testing.T) {
+	assert := assert.New(t)
+	_, txLog := testChangedLog(t)
+
+	event, _ := DecodeLog(ABIEvents(nil), txLog)
+	assert.Nil(event)
+
+	txLog.Topics = nil
+	event, _ = DecodeLog(ABIEvents(testChangedABI), txLog)
+	assert.Nil(event)
+}
+
+func TestDecodeLogInsufficientTopics(t *testing.T) {
+	assert := assert.New(t)
+	_, txLog := testChangedLog(t)
+	txLog.Topics = txLog.Topics[0:1]
+
+	event, _ := DecodeLog(ABIEvents(testChangedABI), txLog)
+	assert.Nil(event)
+}
+
+func TestTopicToValue(t *testing.T) {
+	assert := assert.New(t)
+
+	h := ethbind.API.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffcfc7")
+	v := TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("int64")})
+	assert.Equal("-12345", v)
+
+	h = ethbind.API.HexToHash("0x000000000000000000000000000000000000000001d2d490d572353317a01f8d")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("uint256")})
+	assert.Equal("564363245346346345353453453", v)
+
+	h = ethbind.API.HexToHash("0x0000000000000000000000003924d1d6423f88148a4fcc0417a33b27a61d595f")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("address")})
+	assert.Equal(ethbind.API.HexToAddress("0x3924d1D6423F88148A4fcc0417A33B27a61d595f"), v)
+
+	h = ethbind.API.HexToHash("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("string")})
+	assert.Equal("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19", v)
+
+	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
+	assert.Equal(false, v)
+
+	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000001")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
+	assert.Equal(true, v)
+
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	panicFunctionSelector = "0x4e487b71" // the signature of Panic(uint256), raised by the compiler for failed asserts, overflows etc.
+)
+
+// panicReasons describes the codes of Panic(uint256) per
+// https://docs.soliditylang.org/en/latest/control-structures.html#panic-via-assert-and-error-via-require
+var panicReasons = map[uint64]string{
+	0x01: "assertion failed",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "invalid storage byte array encoding",
+	0x31: "pop from an empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to an uninitialized function",
+}
+
+// ABIErrors returns the custom errors declared in an ABI, to decode the reason a transaction reverts with
+func ABIErrors(a ethbinding.ABIMarshaling) (errorABIs ethbinding.ABIMarshaling) {
+	for _, element := range a {
+		if element.Type == "error" {
+			errorABIs = append(errorABIs, element)
+		}
+	}
+	return errorABIs
+}
+
+// rpcErrorData returns the revert data of a JSON/RPC error. geth returns the hex data
+// on its own, whereas other nodes prefix it with a description of the revert
+func rpcErrorData(err error) string {
+	dataErr, ok := err.(interface{ ErrorData() interface{} })
+	if !ok {
+		return ""
+	}
+	data, _ := dataErr.ErrorData().(string)
+	if idx := strings.Index(data, "0x"); idx >= 0 {
+		return data[idx:]
+	}
+	return ""
+}
+
+// revertError returns the error for the data a call reverted with, or nil if it is not revert data.
+// Custom errors are only decoded from the data of a JSON/RPC error, as the result of a successful
+// call could start with the selector of a custom error
+func (tx *Txn) revertError(hexString string, customErrors bool) errors.RevertedError {
+	switch {
+	case strings.HasPrefix(hexString, errorFunctionSelector) && len(hexString) > 138:
+		return decodeErrorString(hexString)
+	case strings.HasPrefix(hexString, panicFunctionSelector) && len(hexString) == 74:
+		return decodePanic(hexString)
+	case customErrors:
+		return tx.decodeCustomError(hexString)
+	}
+	return nil
+}
+
+// decodeErrorString decodes Error(string), leniently reading up to the end of the data
+// if the length of the string is beyond it
+func decodeErrorString(hexString string) errors.RevertedError {
+	retStrLen := uint64(len(hexString))
+	dataOffsetHex := new(big.Int)
+	dataOffsetHex.SetString(hexString[10:74], 16)
+	errorStringLen := new(big.Int)
+	errorStringLen.SetString(hexString[74:138], 16)
+	hexStringEnd := errorStringLen.Uint64()*2 + 138
+	if hexStringEnd > retStrLen {
+		hexStringEnd = retStrLen
+	}
+	errorStringHex := hexString[138:hexStringEnd]
+	errorStringBytes, err := hex.DecodeString(errorStringHex)
+	log.Warnf("EVM Reverted. Message='%s' Offset='%s'", errorStringBytes, dataOffsetHex.Text(10))
+	if err != nil {
+		return errors.Reverted(errors.TransactionSendCallFailedRevertNoMessage, "")
+	}
+	return errors.Reverted(errors.TransactionSendCallFailedRevertMessage, string(errorStringBytes), errorStringBytes)
+}
+
+// decodePanic decodes Panic(uint256), with a description of the code
+func decodePanic(hexString string) errors.RevertedError {
+	code := new(big.Int)
+	code.SetString(hexString[10:], 16)
+	reason := fmt.Sprintf("Panic(0x%02x)", code)
+	if description, ok := panicReasons[code.Uint64()]; ok {
+		reason = fmt.Sprintf("%s: %s", reason, description)
+	}
+	log.Warnf("EVM Reverted. %s", reason)
+	return errors.Reverted(errors.TransactionSendCallFailedRevertError, reason, reason)
+}
+
+// decodeCustomError decodes the data against the custom errors of the contract, matching
+// the selector. The reason is the name of the error, with its arguments as JSON
+func (tx *Txn) decodeCustomError(hexString string) errors.RevertedError {
+	data, err := ethbind.API.HexDecode(hexString)
+	if err != nil || len(data) < 4 {
+		return nil
+	}
+	for _, element := range tx.Errors {
+		errorABI, err := ethbind.API.ABIElementMarshalingToABIMethod(&element)
+		if err != nil || !bytes.Equal(errorABI.ID, data[:4]) {
+			continue
+		}
+		args := make(map[string]interface{})
+		rawArgs, err := errorABI.Inputs.UnpackValues(data[4:])
+		if err == nil {
+			err = processOutputs(errorABI.Inputs, rawArgs, args)
+		}
+		if err != nil {
+			log.Warnf("EVM Reverted. Failed to decode custom error %s: %s", element.Name, err)
+			return errors.Reverted(errors.TransactionSendCallFailedRevertNoMessage, "")
+		}
+		argBytes, _ := json.Marshal(args)
+		reason := fmt.Sprintf("%s(%s)", element.Name, argBytes)
+		log.Warnf("EVM Reverted. %s", reason)
+		return errors.Reverted(errors.TransactionSendCallFailedRevertError, reason, reason)
+	}
+	log.Warnf("EVM Reverted. Unknown error data: %s", hexString)
+	return errors.Reverted(errors.TransactionSendCallFailedRevertNoMessage, "")
+}
+
+// RevertReason replays a mined transaction that failed as a call against the state before
+// its block, to obtain the reason it reverted. Returns an empty string if it did not revert
+// on replay, as the state could have been changed by an earlier transaction in the block
+func (tx *Txn) RevertReason(ctx context.Context, rpc RPCClient, blockNumber *big.Int) string {
+	callOption := "latest"
+	if blockNumber != nil && blockNumber.Sign() > 0 {
+		callOption = ethbind.API.EncodeBig(new(big.Int).Sub(blockNumber, big.NewInt(1)))
+	}
+	if _, err := tx.Call(ctx, rpc, callOption); err != nil {
+		if revertErr, ok := err.(errors.RevertedError); ok {
+			return revertErr.RevertReason()
+		}
+		log.Warnf("Failed to replay transaction %s to obtain the revert reason: %s", tx.Hash, err)
+	}
+	return ""
+}
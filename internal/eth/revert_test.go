@@ -0,0 +1,196 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+type testDataError struct {
+	data interface{}
+}
+
+func (e *testDataError) Error() string {
+	return "execution reverted"
+}
+
+func (e *testDataError) ErrorData() interface{} {
+	return e.data
+}
+
+var testInsufficientBalance = ethbinding.ABIElementMarshaling{
+	Type: "error",
+	Name: "InsufficientBalance",
+	Inputs: []ethbinding.ABIArgumentMarshaling{
+		{Name: "available", Type: "uint256"},
+		{Name: "required", Type: "uint256"},
+	},
+}
+
+func testCustomErrorData(t *testing.T, element ethbinding.ABIElementMarshaling, args ...interface{}) string {
+	errorABI, err := ethbind.API.ABIElementMarshalingToABIMethod(&element)
+	assert.NoError(t, err)
+	packed, err := errorABI.Inputs.Pack(args...)
+	assert.NoError(t, err)
+	return ethbind.API.HexEncode(append(errorABI.ID, packed...))
+}
+
+func testCallRevert(result string, rpcErr error, errorABIs ethbinding.ABIMarshaling) error {
+	rpc := &testRPCClient{
+		mockError: rpcErr,
+		resultWrangler: func(retString interface{}) {
+			reflect.ValueOf(retString).Elem().Set(reflect.ValueOf(result))
+		},
+	}
+	_, err := CallMethod(context.Background(), rpc, nil,
+		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
+		"", &ethbinding.ABIMethod{Name: "testFunc"}, []interface{}{}, "", errorABIs)
+	return err
+}
+
+func TestABIErrors(t *testing.T) {
+	assert := assert.New(t)
+	errorABIs := ABIErrors(ethbinding.ABIMarshaling{
+		{Type: "function", Name: "transfer"},
+		testInsufficientBalance,
+		{Type: "event", Name: "Transfer"},
+	})
+	assert.Equal(ethbinding.ABIMarshaling{testInsufficientBalance}, errorABIs)
+}
+
+func TestCallMethodRevertPanic(t *testing.T) {
+	assert := assert.New(t)
+	err := testCallRevert("0x4e487b710000000000000000000000000000000000000000000000000000000000000011", nil, nil)
+	assert.Regexp("FFEC100364.*Panic\\(0x11\\): arithmetic underflow or overflow", err)
+	assert.Equal("Panic(0x11): arithmetic underflow or overflow", err.(errors.RevertedError).RevertReason())
+
+	err = testCallRevert("0x4e487b7100000000000000000000000000000000000000000000000000000000000000ff", nil, nil)
+	assert.Equal("Panic(0xff)", err.(errors.RevertedError).RevertReason())
+}
+
+func TestCallMethodRevertCustomError(t *testing.T) {
+	assert := assert.New(t)
+	data := testCustomErrorData(t, testInsufficientBalance, big.NewInt(10), big.NewInt(20))
+	err := testCallRevert("", &testDataError{data: data}, ethbinding.ABIMarshaling{
+		{Type: "error", Name: "Unauthorized"},
+		testInsufficientBalance,
+	})
+	assert.Regexp("FFEC100364", err)
+	assert.Equal(`InsufficientBalance({"available":"10","required":"20"})`, err.(errors.RevertedError).RevertReason())
+	errorType, retryable, ok := errors.ClassifyNodeError(err)
+	assert.True(ok)
+	assert.False(retryable)
+	assert.Equal(errors.NodeErrorReverted, errorType)
+}
+
+func TestCallMethodRevertCustomErrorPrefixed(t *testing.T) {
+	assert := assert.New(t)
+	data := testCustomErrorData(t, testInsufficientBalance, big.NewInt(10), big.NewInt(20))
+	err := testCallRevert("", &testDataError{data: "Reverted " + data}, ethbinding.ABIMarshaling{testInsufficientBalance})
+	assert.Equal(`InsufficientBalance({"available":"10","required":"20"})`, err.(errors.RevertedError).RevertReason())
+}
+
+func TestCallMethodRevertErrorStringInRPCError(t *testing.T) {
+	assert := assert.New(t)
+	data := "0x08c379a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000114d75707065747279206465746563746564000000000000000000000000000000"
+	err := testCallRevert("", &testDataError{data: data}, nil)
+	assert.Regexp("FFEC100149.*Muppetry detected", err)
+	assert.Equal("Muppetry detected", err.(errors.RevertedError).RevertReason())
+}
+
+func TestCallMethodRevertCustomErrorUnknown(t *testing.T) {
+	assert := assert.New(t)
+	data := testCustomErrorData(t, testInsufficientBalance, big.NewInt(10), big.NewInt(20))
+	err := testCallRevert("", &testDataError{data: data}, nil)
+	assert.Regexp("FFEC100150", err)
+	assert.Empty(err.(errors.RevertedError).RevertReason())
+}
+
+func TestCallMethodRevertCustomErrorBadData(t *testing.T) {
+	assert := assert.New(t)
+	data := testCustomErrorData(t, testInsufficientBalance, big.NewInt(10), big.NewInt(20))
+	err := testCallRevert("", &testDataError{data: data[0:20]}, ethbinding.ABIMarshaling{testInsufficientBalance})
+	assert.Regexp("FFEC100150", err)
+}
+
+func TestCallMethodRevertNoData(t *testing.T) {
+	assert := assert.New(t)
+	err := testCallRevert("", &testDataError{data: "0x"}, nil)
+	assert.Regexp("FFEC100148.*execution reverted", err)
+	_, ok := err.(errors.RevertedError)
+	assert.False(ok)
+
+	err = testCallRevert("", &testDataError{data: 12345}, nil)
+	assert.Regexp("FFEC100148", err)
+
+	err = testCallRevert("", fmt.Errorf("pop"), nil)
+	assert.Regexp("FFEC100148.*pop", err)
+}
+
+func TestCallMethodCustomErrorSelectorInResult(t *testing.T) {
+	assert := assert.New(t)
+	// A successful call is not decoded as a custom error, even if it starts with its selector
+	data := testCustomErrorData(t, testInsufficientBalance, big.NewInt(10), big.NewInt(20))
+	err := testCallRevert(data, nil, ethbinding.ABIMarshaling{testInsufficientBalance})
+	assert.NoError(err)
+}
+
+func TestRevertReason(t *testing.T) {
+	assert := assert.New(t)
+	data := testCustomErrorData(t, testInsufficientBalance, big.NewInt(10), big.NewInt(20))
+	rpc := &testRPCClient{
+		mockError: &testDataError{data: data},
+	}
+	tx, err := buildTX(nil, "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c", "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", "", "", "", "", &ethbinding.ABIMethod{Name: "testFunc"}, []interface{}{})
+	assert.NoError(err)
+	tx.Errors = ethbinding.ABIMarshaling{testInsufficientBalance}
+
+	reason := tx.RevertReason(context.Background(), rpc, big.NewInt(12345))
+	assert.Equal(`InsufficientBalance({"available":"10","required":"20"})`, reason)
+	assert.Equal("eth_call", rpc.capturedMethod)
+	assert.Equal("0x3038", rpc.capturedArgs[1])
+}
+
+func TestRevertReasonNotReverted(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &testRPCClient{}
+	tx, err := buildTX(nil, "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c", "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", "", "", "", "", &ethbinding.ABIMethod{Name: "testFunc"}, []interface{}{})
+	assert.NoError(err)
+
+	assert.Empty(tx.RevertReason(context.Background(), rpc, nil))
+	assert.Equal("latest", rpc.capturedArgs[1])
+}
+
+func TestRevertReasonCallFailed(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+	tx, err := buildTX(nil, "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c", "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", "", "", "", "", &ethbinding.ABIMethod{Name: "testFunc"}, []interface{}{})
+	assert.NoError(err)
+
+	assert.Empty(tx.RevertReason(context.Background(), rpc, big.NewInt(1)))
+	assert.Equal("0x0", rpc.capturedArgs[1])
+}
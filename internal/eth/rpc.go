@@ -38,7 +38,8 @@ type RPCConf struct {
 
 // RPCConnOpts configuration params
 type RPCConnOpts struct {
-	URL string `json:"url"`
+	URL            string         `json:"url"`
+	CircuitBreaker RPCBreakerConf `json:"circuitBreaker,omitempty"`
 }
 
 // RPCConnect wraps rpc.Dial with useful logging, avoiding logging username/password
@@ -53,12 +54,14 @@ func RPCConnect(conf *RPCConnOpts) (RPCClientAll, error) {
 	}
 	log.Infof("New JSON/RPC connection established")
 	log.Debugf("JSON/RPC connected to %s", u)
-	return &rpcWrapper{rpc: rpcClient}, nil
+	return NewRPCCircuitBreaker(&rpcWrapper{rpc: rpcClient}, &conf.CircuitBreaker), nil
 }
 
 // CobraInitRPC sets the standard command-line parameters for RPC
 func CobraInitRPC(cmd *cobra.Command, rconf *RPCConf) {
 	cmd.Flags().StringVarP(&rconf.RPC.URL, "rpc-url", "r", os.Getenv("ETH_RPC_URL"), "JSON/RPC URL for Ethereum node")
+	cmd.Flags().IntVarP(&rconf.RPC.CircuitBreaker.FailureThreshold, "rpc-breaker-failures", "", 0, "Consecutive JSON/RPC failures that trip the circuit breaker, pausing new transactions until the node responds (0 disables)")
+	cmd.Flags().IntVarP(&rconf.RPC.CircuitBreaker.ProbeIntervalSec, "rpc-breaker-probe-sec", "", defaultRPCBreakerProbeIntervalSec, "Interval in seconds to probe the node while the JSON/RPC circuit breaker is open")
 	return
 }
 
@@ -0,0 +1,279 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRPCBreakerProbeIntervalSec = 5
+	rpcBreakerProbeTimeout            = 10 * time.Second
+)
+
+// RPCBreakerConf configures a circuit breaker on the JSON/RPC connection, that trips after a
+// number of consecutive failures to call the node. Disabled when FailureThreshold is zero
+type RPCBreakerConf struct {
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	ProbeIntervalSec int `json:"probeIntervalSec,omitempty"`
+}
+
+// RPCBreakerState is the state of the circuit breaker, as reported on the status endpoint
+type RPCBreakerState struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	FailureThreshold    int    `json:"failureThreshold"`
+	Trips               int64  `json:"trips"`
+	LastError           string `json:"lastError,omitempty"`
+	LastTripped         string `json:"lastTripped,omitempty"`
+	LastReset           string `json:"lastReset,omitempty"`
+	LastProbe           string `json:"lastProbe,omitempty"`
+	LastProbeError      string `json:"lastProbeError,omitempty"`
+}
+
+// RPCCircuitBreaker is implemented by an RPC client with a circuit breaker, so work that
+// depends on the node can be stopped while the breaker is open
+type RPCCircuitBreaker interface {
+	Check() error
+	WaitClosed(ctx context.Context) error
+	State() *RPCBreakerState
+}
+
+// Circuit breaker states
+const (
+	RPCBreakerClosed = "closed"
+	RPCBreakerOpen   = "open"
+)
+
+// rpcCircuitBreaker counts the consecutive calls that fail to get a response from the node.
+// Once the threshold is reached the breaker opens, and the node is probed with net_version
+// until it responds, at which point the breaker closes again. Calls are still passed through
+// to the node while the breaker is open - it is the callers that check the breaker before
+// starting new work
+type rpcCircuitBreaker struct {
+	rpc           RPCClientAll
+	threshold     int
+	probeInterval time.Duration
+	mux           sync.Mutex
+	failures      int
+	trips         int64
+	lastErr       error
+	lastTripped   time.Time
+	lastReset     time.Time
+	lastProbe     time.Time
+	lastProbeErr  error
+	closedChan    chan struct{} // closed while the breaker is closed, and replaced each time it trips
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+}
+
+// NewRPCCircuitBreaker wraps an RPC client with a circuit breaker, when one is configured
+func NewRPCCircuitBreaker(rpc RPCClientAll, conf *RPCBreakerConf) RPCClientAll {
+	if conf.FailureThreshold <= 0 {
+		return rpc
+	}
+	probeIntervalSec := conf.ProbeIntervalSec
+	if probeIntervalSec <= 0 {
+		probeIntervalSec = defaultRPCBreakerProbeIntervalSec
+	}
+	b := &rpcCircuitBreaker{
+		rpc:           rpc,
+		threshold:     conf.FailureThreshold,
+		probeInterval: time.Duration(probeIntervalSec) * time.Second,
+		closedChan:    make(chan struct{}),
+		stopChan:      make(chan struct{}),
+	}
+	close(b.closedChan)
+	log.Infof("JSON/RPC circuit breaker enabled: failures=%d probeInterval=%ds", conf.FailureThreshold, probeIntervalSec)
+	return b
+}
+
+// CircuitBreakerFor returns the circuit breaker of an RPC client, or nil if it does not have one
+func CircuitBreakerFor(rpc RPCClient) RPCCircuitBreaker {
+	if b, ok := rpc.(RPCCircuitBreaker); ok {
+		return b
+	}
+	return nil
+}
+
+// nodeResponded reports whether the node returned a response to a call, including a JSON/RPC error
+func nodeResponded(err error) bool {
+	if err == nil {
+		return true
+	}
+	_, ok := err.(interface{ ErrorCode() int })
+	return ok
+}
+
+// rpcFailure reports whether the error from a call means the node could not be reached, or did
+// not respond. Calls that were cancelled, or rejected before they reached the node, are not failures
+func rpcFailure(err error) bool {
+	if nodeResponded(err) || err == context.Canceled {
+		return false
+	}
+	_, ok := err.(errors.EthconnectError)
+	return !ok
+}
+
+func (b *rpcCircuitBreaker) isOpen() bool {
+	select {
+	case <-b.closedChan:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *rpcCircuitBreaker) record(err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.isOpen() {
+		return
+	}
+	if nodeResponded(err) {
+		b.failures = 0
+		return
+	}
+	if !rpcFailure(err) {
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.failures >= b.threshold {
+		b.trips++
+		b.lastTripped = time.Now()
+		b.closedChan = make(chan struct{})
+		log.Errorf("JSON/RPC circuit breaker tripped after %d consecutive failures: %s", b.failures, err)
+		go b.probeLoop()
+	}
+}
+
+// probeLoop runs while the breaker is open, probing the node until it responds
+func (b *rpcCircuitBreaker) probeLoop() {
+	ticker := time.NewTicker(b.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopChan:
+			return
+		case <-ticker.C:
+		}
+		if b.probe() {
+			return
+		}
+	}
+}
+
+func (b *rpcCircuitBreaker) probe() bool {
+	ctx, cancel := context.WithTimeout(auth.NewSystemAuthContext(), rpcBreakerProbeTimeout)
+	defer cancel()
+	var netID string
+	err := b.rpc.CallContext(ctx, &netID, "net_version")
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.lastProbe = time.Now()
+	b.lastProbeErr = err
+	if err != nil {
+		log.Warnf("JSON/RPC circuit breaker probe failed: %s", err)
+		return false
+	}
+	b.failures = 0
+	b.lastReset = time.Now()
+	close(b.closedChan)
+	log.Infof("JSON/RPC circuit breaker reset after %.2fs", b.lastReset.Sub(b.lastTripped).Seconds())
+	return true
+}
+
+// Check returns an error while the breaker is open
+func (b *rpcCircuitBreaker) Check() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.isOpen() {
+		return errors.Errorf(errors.RPCCircuitBreakerOpen, b.failures, b.lastErr)
+	}
+	return nil
+}
+
+// WaitClosed blocks while the breaker is open, until it closes or the context is done
+func (b *rpcCircuitBreaker) WaitClosed(ctx context.Context) error {
+	b.mux.Lock()
+	closedChan := b.closedChan
+	b.mux.Unlock()
+	select {
+	case <-closedChan:
+		return nil
+	case <-b.stopChan:
+		return b.Check()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// State returns a snapshot of the breaker state
+func (b *rpcCircuitBreaker) State() *RPCBreakerState {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	state := &RPCBreakerState{
+		State:               RPCBreakerClosed,
+		ConsecutiveFailures: b.failures,
+		FailureThreshold:    b.threshold,
+		Trips:               b.trips,
+	}
+	if b.isOpen() {
+		state.State = RPCBreakerOpen
+	}
+	if b.lastErr != nil {
+		state.LastError = b.lastErr.Error()
+	}
+	if b.lastProbeErr != nil {
+		state.LastProbeError = b.lastProbeErr.Error()
+	}
+	for _, t := range []struct {
+		v   time.Time
+		str *string
+	}{
+		{b.lastTripped, &state.LastTripped},
+		{b.lastReset, &state.LastReset},
+		{b.lastProbe, &state.LastProbe},
+	} {
+		if !t.v.IsZero() {
+			*t.str = t.v.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return state
+}
+
+func (b *rpcCircuitBreaker) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	err := b.rpc.CallContext(ctx, result, method, args...)
+	b.record(err)
+	return err
+}
+
+func (b *rpcCircuitBreaker) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (RPCClientSubscription, error) {
+	return b.rpc.Subscribe(ctx, namespace, channel, args...)
+}
+
+func (b *rpcCircuitBreaker) Close() {
+	b.stopOnce.Do(func() { close(b.stopChan) })
+	b.rpc.Close()
+}
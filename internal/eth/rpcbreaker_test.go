@@ -0,0 +1,189 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBreakerRPC struct {
+	mux    sync.Mutex
+	err    error
+	calls  []string
+	closed bool
+}
+
+func (r *testBreakerRPC) setErr(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.err = err
+}
+
+func (r *testBreakerRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.calls = append(r.calls, method)
+	return r.err
+}
+
+func (r *testBreakerRPC) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (RPCClientSubscription, error) {
+	return nil, fmt.Errorf("pop")
+}
+
+func (r *testBreakerRPC) Close() {
+	r.closed = true
+}
+
+type testNodeError struct{}
+
+func (e *testNodeError) Error() string  { return "nonce too low" }
+func (e *testNodeError) ErrorCode() int { return -32000 }
+
+func newTestRPCCircuitBreaker(threshold int) (*rpcCircuitBreaker, *testBreakerRPC) {
+	rpc := &testBreakerRPC{}
+	b := NewRPCCircuitBreaker(rpc, &RPCBreakerConf{FailureThreshold: threshold}).(*rpcCircuitBreaker)
+	b.probeInterval = 1 * time.Millisecond
+	return b, rpc
+}
+
+func TestRPCCircuitBreakerDisabled(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &testBreakerRPC{}
+	wrapped := NewRPCCircuitBreaker(rpc, &RPCBreakerConf{})
+	assert.Equal(rpc, wrapped)
+	assert.Nil(CircuitBreakerFor(wrapped))
+}
+
+func TestRPCCircuitBreakerTripAndReset(t *testing.T) {
+	assert := assert.New(t)
+	b, rpc := newTestRPCCircuitBreaker(3)
+	defer b.Close()
+	ctx := context.Background()
+
+	rpc.setErr(fmt.Errorf("connection refused"))
+	b.CallContext(ctx, nil, "eth_getTransactionReceipt")
+	b.CallContext(ctx, nil, "eth_getTransactionReceipt")
+	assert.Equal(2, b.State().ConsecutiveFailures)
+	rpc.setErr(nil)
+	b.CallContext(ctx, nil, "eth_getTransactionReceipt")
+	assert.Equal(0, b.State().ConsecutiveFailures)
+	assert.NoError(b.Check())
+
+	rpc.setErr(fmt.Errorf("connection refused"))
+	for i := 0; i < 3; i++ {
+		b.CallContext(ctx, nil, "eth_sendTransaction")
+	}
+	assert.Regexp("JSON/RPC circuit breaker is open after 3 consecutive failures calling the node: connection refused", b.Check())
+	state := b.State()
+	assert.Equal(RPCBreakerOpen, state.State)
+	assert.Equal(int64(1), state.Trips)
+	assert.Equal("connection refused", state.LastError)
+	assert.NotEmpty(state.LastTripped)
+
+	// Calls while open are passed through, but do not change the state
+	err := b.CallContext(ctx, nil, "eth_blockNumber")
+	assert.Regexp("connection refused", err)
+	assert.Equal(3, b.State().ConsecutiveFailures)
+
+	// Probes fail until the node responds
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, b.WaitClosed(waitCtx))
+	state = b.State()
+	assert.Equal(RPCBreakerOpen, state.State)
+	assert.Equal("connection refused", state.LastProbeError)
+
+	rpc.setErr(nil)
+	assert.NoError(b.WaitClosed(ctx))
+	state = b.State()
+	assert.Equal(RPCBreakerClosed, state.State)
+	assert.Equal(0, state.ConsecutiveFailures)
+	assert.NotEmpty(state.LastProbe)
+	assert.NotEmpty(state.LastReset)
+	assert.Empty(state.LastProbeError)
+	assert.NoError(b.Check())
+	rpc.mux.Lock()
+	assert.Contains(rpc.calls, "net_version")
+	rpc.mux.Unlock()
+}
+
+func TestRPCCircuitBreakerNotFailures(t *testing.T) {
+	assert := assert.New(t)
+	b, rpc := newTestRPCCircuitBreaker(2)
+	defer b.Close()
+	ctx := context.Background()
+
+	rpc.setErr(fmt.Errorf("connection refused"))
+	b.CallContext(ctx, nil, "eth_call")
+	rpc.setErr(context.Canceled)
+	b.CallContext(ctx, nil, "eth_call")
+	rpc.setErr(errors.Errorf(errors.Unauthorized))
+	b.CallContext(ctx, nil, "eth_call")
+	assert.Equal(1, b.State().ConsecutiveFailures)
+	assert.NoError(b.Check())
+
+	rpc.setErr(&testNodeError{})
+	b.CallContext(ctx, nil, "eth_sendRawTransaction")
+	assert.Equal(0, b.State().ConsecutiveFailures)
+}
+
+func TestRPCCircuitBreakerClose(t *testing.T) {
+	assert := assert.New(t)
+	b, rpc := newTestRPCCircuitBreaker(1)
+	b.probeInterval = 1 * time.Hour
+
+	rpc.setErr(fmt.Errorf("connection refused"))
+	b.CallContext(context.Background(), nil, "eth_call")
+	assert.Error(b.Check())
+
+	_, err := b.Subscribe(context.Background(), "eth", nil)
+	assert.Regexp("pop", err)
+
+	b.Close()
+	assert.True(rpc.closed)
+	assert.Regexp("circuit breaker is open", b.WaitClosed(context.Background()))
+}
+
+func TestRPCConnectCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	testSvr := httptest.NewServer(&httprouter.Router{})
+	defer testSvr.Close()
+
+	rconf := &RPCConf{}
+	cmd := &cobra.Command{}
+	CobraInitRPC(cmd, rconf)
+	cmd.ParseFlags([]string{
+		"-r", testSvr.URL,
+		"--rpc-breaker-failures", "5",
+	})
+	assert.Equal(5, rconf.RPC.CircuitBreaker.FailureThreshold)
+	assert.Equal(5, rconf.RPC.CircuitBreaker.ProbeIntervalSec)
+
+	rpc, err := RPCConnect(&rconf.RPC)
+	assert.NoError(err)
+	defer rpc.Close()
+	assert.NotNil(CircuitBreakerFor(rpc))
+	assert.Equal(RPCBreakerClosed, CircuitBreakerFor(rpc).State().State)
+}
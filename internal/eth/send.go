@@ -16,9 +16,6 @@ package eth
 
 import (
 	"context"
-	"encoding/hex"
-	"math/big"
-	"strings"
 	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
@@ -33,7 +30,7 @@ const (
 )
 
 // calculateGas uses eth_estimateGas to estimate the gas required, providing a buffer
-// of 20% for variation as the chain changes between estimation and submission.
+// (20% by default) for variation as the chain changes between estimation and submission.
 func (tx *Txn) calculateGas(ctx context.Context, rpc RPCClient, txArgs *SendTXArgs, gas *ethbinding.HexUint64) (err error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -48,7 +45,12 @@ func (tx *Txn) calculateGas(ctx context.Context, rpc RPCClient, txArgs *SendTXAr
 		// If the call succeeds, after estimate completed - we still need to fail with the estimate error
 		return estError
 	}
-	*gas = ethbinding.HexUint64(float64(*gas) * 1.2)
+	tx.EstimatedGas = uint64(*gas)
+	gasLimit, err := tx.GasEstimate.gasLimit(tx.EstimatedGas)
+	if err != nil {
+		return err
+	}
+	*gas = ethbinding.HexUint64(gasLimit)
 	return nil
 }
 
@@ -57,7 +59,7 @@ func (tx *Txn) Call(ctx context.Context, rpc RPCClient, blocknumber string) (res
 	data := ethbinding.HexBytes(tx.EthTX.Data())
 	txArgs := &SendTXArgs{
 		From:     tx.From.Hex(),
-		GasPrice: ethbinding.HexBigInt(*tx.EthTX.GasPrice()),
+		GasPrice: (*ethbinding.HexBigInt)(tx.EthTX.GasPrice()),
 		Value:    ethbinding.HexBigInt(*tx.EthTX.Value()),
 		Data:     &data,
 	}
@@ -71,29 +73,17 @@ func (tx *Txn) Call(ctx context.Context, rpc RPCClient, blocknumber string) (res
 
 	var hexString string
 	if err = rpc.CallContext(ctx, &hexString, "eth_call", txArgs, blocknumber); err != nil {
+		if revertErr := tx.revertError(rpcErrorData(err), true); revertErr != nil {
+			return nil, revertErr
+		}
 		return nil, errors.Errorf(errors.TransactionSendCallFailedNoRevert, err)
 	}
 	if len(hexString) == 0 || hexString == "0x" {
 		return nil, nil
 	}
-	retStrLen := uint64(len(hexString))
-	if strings.HasPrefix(hexString, errorFunctionSelector) && retStrLen > 138 {
-		// The call reverted. Process the error response
-		dataOffsetHex := new(big.Int)
-		dataOffsetHex.SetString(hexString[10:74], 16)
-		errorStringLen := new(big.Int)
-		errorStringLen.SetString(hexString[74:138], 16)
-		hexStringEnd := errorStringLen.Uint64()*2 + 138
-		if hexStringEnd > retStrLen {
-			hexStringEnd = retStrLen
-		}
-		errorStringHex := hexString[138:hexStringEnd]
-		errorStringBytes, err := hex.DecodeString(errorStringHex)
-		log.Warnf("EVM Reverted. Message='%s' Offset='%s'", errorStringBytes, dataOffsetHex.Text(10))
-		if err != nil {
-			return nil, errors.Errorf(errors.TransactionSendCallFailedRevertNoMessage)
-		}
-		return nil, errors.Errorf(errors.TransactionSendCallFailedRevertMessage, errorStringBytes)
+	if revertErr := tx.revertError(hexString, false); revertErr != nil {
+		// The call reverted, with the revert data returned as the result
+		return nil, revertErr
 	}
 	log.Debugf("eth_call response: %s", hexString)
 	res = ethbind.API.FromHex(hexString)
@@ -107,11 +97,11 @@ func (tx *Txn) Send(ctx context.Context, rpc RPCClient) (err error) {
 	gas := ethbinding.HexUint64(tx.EthTX.Gas())
 	data := ethbinding.HexBytes(tx.EthTX.Data())
 	txArgs := &SendTXArgs{
-		From:     tx.From.Hex(),
-		GasPrice: ethbinding.HexBigInt(*tx.EthTX.GasPrice()),
-		Value:    ethbinding.HexBigInt(*tx.EthTX.Value()),
-		Data:     &data,
+		From:  tx.From.Hex(),
+		Value: ethbinding.HexBigInt(*tx.EthTX.Value()),
+		Data:  &data,
 	}
+	tx.setFeeArgs(txArgs)
 	var to = tx.EthTX.To()
 	if to != nil {
 		txArgs.To = to.Hex()
@@ -150,9 +140,12 @@ type SendTXArgs struct {
 	From     string                `json:"from"`
 	To       string                `json:"to,omitempty"`
 	Gas      *ethbinding.HexUint64 `json:"gas,omitempty"`
-	GasPrice ethbinding.HexBigInt  `json:"gasPrice,omitempty"`
+	GasPrice *ethbinding.HexBigInt `json:"gasPrice,omitempty"`
 	Value    ethbinding.HexBigInt  `json:"value,omitempty"`
 	Data     *ethbinding.HexBytes  `json:"data"`
+	// EIP-1559 dynamic fees, set instead of gasPrice
+	MaxFeePerGas         *ethbinding.HexBigInt `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *ethbinding.HexBigInt `json:"maxPriorityFeePerGas,omitempty"`
 	// EEA spec extensions
 	PrivateFrom    string   `json:"privateFrom,omitempty"`
 	PrivateFor     []string `json:"privateFor,omitempty"`
@@ -196,6 +189,9 @@ func (tx *Txn) submitTXtoNode(ctx context.Context, rpc RPCClient, txArgs *SendTX
 		if isPrivate {
 			return "", errors.Errorf(errors.TransactionSendPrivateTXWithExternalSigner, tx.Signer.Type())
 		}
+		if tx.IsDynamicFee() {
+			return "", errors.Errorf(errors.TransactionSendDynamicFeeWithExternalSigner, tx.Signer.Type())
+		}
 		// Sign the transaction and get the bytes, which we pass to eth_sendRawTransaction
 		jsonRPCMethod = "eth_sendRawTransaction"
 		signed, err := tx.Signer.Sign(tx.EthTX)
@@ -0,0 +1,233 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// CompilerMetrics reports the executions of solc, and the use of the cache of compiled output.
+// The counts are held in memory since the process started, so are reset by a restart
+type CompilerMetrics struct {
+	Since              string  `json:"since"`
+	Compilations       uint64  `json:"compilations"`
+	Failures           uint64  `json:"failures"`
+	Rejected           uint64  `json:"rejected"`
+	FailureRate        float64 `json:"failureRate"`
+	TotalDurationSec   float64 `json:"totalDurationSec"`
+	AverageDurationSec float64 `json:"averageDurationSec"`
+	MaxDurationSec     float64 `json:"maxDurationSec"`
+	CacheHits          uint64  `json:"cacheHits"`
+	CacheEntries       int     `json:"cacheEntries"`
+	CacheSize          int     `json:"cacheSize"`
+}
+
+type solcOutput struct {
+	key    string
+	stdout []byte
+	stderr []byte
+}
+
+// solcOutputCache holds the output of the most recent successful executions of solc, keyed by a hash
+// of everything solc reads, so identical sources compiled again with the same settings skip solc
+type solcOutputCache struct {
+	lock         sync.Mutex
+	size         int
+	entries      map[string]*list.Element
+	lru          *list.List
+	since        time.Time
+	compilations uint64
+	failures     uint64
+	rejected     uint64
+	totalTime    time.Duration
+	maxTime      time.Duration
+	hits         uint64
+}
+
+func newSolcOutputCache(size int) *solcOutputCache {
+	return &solcOutputCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		since:   time.Now(),
+	}
+}
+
+// RunSolc executes solc within the configured limits, unless the same compilation is in the cache,
+// in which case the output of the earlier compilation is written instead
+func RunSolc(conf *SolcConf, solcPath string, args []string, dir string, stdin io.Reader, stdout, stderr io.Writer) error {
+	solcCache := conf.runtime().cache
+	key := ""
+	if solcCache.enabled() {
+		var err error
+		if key, stdin, err = solcCacheKey(solcPath, args, dir, stdin); err != nil {
+			log.Warnf("Unable to cache compilation: %s", err)
+		} else if cached := solcCache.get(key); cached != nil {
+			log.Infof("Compilation %s served from the cache", key)
+			stdout.Write(cached.stdout)
+			stderr.Write(cached.stderr)
+			return nil
+		}
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	if key != "" {
+		stdout = io.MultiWriter(stdout, &outBuf)
+		stderr = io.MultiWriter(stderr, &errBuf)
+	}
+	start := time.Now()
+	err := runSolcWithLimits(conf, solcPath, args, dir, stdin, stdout, stderr)
+	solcCache.record(time.Since(start), err)
+	if err == nil && key != "" {
+		solcCache.put(&solcOutput{key: key, stdout: outBuf.Bytes(), stderr: errBuf.Bytes()})
+	}
+	return err
+}
+
+// SolcMetrics returns the metrics of the executions of solc since the process started
+func SolcMetrics(conf *SolcConf) *CompilerMetrics {
+	return conf.runtime().cache.metrics()
+}
+
+// solcCacheKey hashes the solc command, its input, and the files in the directory it runs in, as
+// those are the sources it can import. The input is read in full, so a new reader is returned for it
+func solcCacheKey(solcPath string, args []string, dir string, stdin io.Reader) (string, io.Reader, error) {
+	h := sha256.New()
+	writeField := func(b []byte) {
+		h.Write([]byte(strconv.Itoa(len(b))))
+		h.Write([]byte{':'})
+		h.Write(b)
+	}
+	writeField([]byte(solcPath))
+	for _, arg := range args {
+		writeField([]byte(arg))
+	}
+	if stdin != nil {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", bytes.NewReader(b), err
+		}
+		writeField(b)
+		stdin = bytes.NewReader(b)
+	}
+	if dir != "" {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			writeField([]byte(rel))
+			writeField(b)
+			return nil
+		})
+		if err != nil {
+			return "", stdin, err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), stdin, nil
+}
+
+func (c *solcOutputCache) enabled() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.size > 0
+}
+
+func (c *solcOutputCache) evict() {
+	for c.lru.Len() > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*solcOutput).key)
+	}
+}
+
+func (c *solcOutputCache) get(key string) *solcOutput {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	c.hits++
+	return elem.Value.(*solcOutput)
+}
+
+func (c *solcOutputCache) put(output *solcOutput) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[output.key]; ok {
+		c.lru.Remove(elem)
+	}
+	c.entries[output.key] = c.lru.PushFront(output)
+	c.evict()
+}
+
+// record counts an execution of solc. A compilation rejected because too many are running is not
+// counted as a compilation
+func (c *solcOutputCache) record(duration time.Duration, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := err.(errors.EthconnectError); ok && e.Code() == errors.CompilerTooManyCompiles.Code() {
+		c.rejected++
+		return
+	}
+	c.compilations++
+	if err != nil {
+		c.failures++
+	}
+	c.totalTime += duration
+	if duration > c.maxTime {
+		c.maxTime = duration
+	}
+}
+
+func (c *solcOutputCache) metrics() *CompilerMetrics {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := &CompilerMetrics{
+		Since:            c.since.UTC().Format(time.RFC3339Nano),
+		Compilations:     c.compilations,
+		Failures:         c.failures,
+		Rejected:         c.rejected,
+		TotalDurationSec: c.totalTime.Seconds(),
+		MaxDurationSec:   c.maxTime.Seconds(),
+		CacheHits:        c.hits,
+		CacheEntries:     c.lru.Len(),
+		CacheSize:        c.size,
+	}
+	if c.compilations > 0 {
+		m.FailureRate = float64(c.failures) / float64(c.compilations)
+		m.AverageDurationSec = m.TotalDurationSec / float64(c.compilations)
+	}
+	return m
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSolcCached(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `cat; echo "$@"; echo warning >&2`)
+	defer done()
+	conf := &SolcConf{CacheSize: 10}
+
+	for i := 0; i < 3; i++ {
+		var stdout, stderr bytes.Buffer
+		err := RunSolc(conf, solcPath, []string{"--a", "b c"}, "", strings.NewReader("input\n"), &stdout, &stderr)
+		assert.NoError(err)
+		assert.Equal("input\n--a b c\n", stdout.String())
+		assert.Equal("warning\n", stderr.String())
+	}
+
+	// Different input is compiled
+	var stdout bytes.Buffer
+	err := RunSolc(conf, solcPath, []string{"--a", "b c"}, "", strings.NewReader("other\n"), &stdout, ioutil.Discard)
+	assert.NoError(err)
+	assert.Equal("other\n--a b c\n", stdout.String())
+
+	m := SolcMetrics(conf)
+	assert.Equal(uint64(2), m.Compilations)
+	assert.Equal(uint64(2), m.CacheHits)
+	assert.Equal(2, m.CacheEntries)
+	assert.Equal(10, m.CacheSize)
+	assert.NotEmpty(m.Since)
+	assert.True(m.AverageDurationSec > 0)
+	assert.True(m.MaxDurationSec >= m.AverageDurationSec)
+}
+
+func TestRunSolcCachedDir(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `cat a.sol lib/b.sol`)
+	defer done()
+	conf := &SolcConf{CacheSize: 10}
+	dir, _ := ioutil.TempDir("", "solcdir")
+	defer os.RemoveAll(dir)
+	os.Mkdir(path.Join(dir, "lib"), 0755)
+	ioutil.WriteFile(path.Join(dir, "a.sol"), []byte("a\n"), 0644)
+	ioutil.WriteFile(path.Join(dir, "lib", "b.sol"), []byte("b\n"), 0644)
+
+	compile := func() string {
+		var stdout bytes.Buffer
+		err := RunSolc(conf, solcPath, []string{"a.sol"}, dir, nil, &stdout, ioutil.Discard)
+		assert.NoError(err)
+		return stdout.String()
+	}
+	assert.Equal("a\nb\n", compile())
+	assert.Equal("a\nb\n", compile())
+	// A change to an imported file is compiled again
+	ioutil.WriteFile(path.Join(dir, "lib", "b.sol"), []byte("c\n"), 0644)
+	assert.Equal("a\nc\n", compile())
+
+	m := SolcMetrics(conf)
+	assert.Equal(uint64(2), m.Compilations)
+	assert.Equal(uint64(1), m.CacheHits)
+}
+
+func TestRunSolcCacheFailuresNotCached(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `echo error >&2; exit 1`)
+	defer done()
+	conf := &SolcConf{CacheSize: 10}
+
+	for i := 0; i < 2; i++ {
+		var stderr bytes.Buffer
+		err := RunSolc(conf, solcPath, []string{}, "", strings.NewReader("input\n"), ioutil.Discard, &stderr)
+		assert.Error(err)
+		assert.Equal("error\n", stderr.String())
+	}
+
+	m := SolcMetrics(conf)
+	assert.Equal(uint64(2), m.Compilations)
+	assert.Equal(uint64(2), m.Failures)
+	assert.Equal(float64(1), m.FailureRate)
+	assert.Equal(0, m.CacheEntries)
+}
+
+func TestRunSolcCacheBadDir(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `echo ok`)
+	defer done()
+	conf := &SolcConf{CacheSize: 10}
+
+	err := RunSolc(conf, solcPath, []string{}, "/does/not/exist", nil, ioutil.Discard, ioutil.Discard)
+	assert.Error(err)
+	assert.Equal(0, SolcMetrics(conf).CacheEntries)
+}
+
+func TestSolcCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+	solcCache := (&SolcConf{CacheSize: 2}).runtime().cache
+
+	solcCache.put(&solcOutput{key: "a"})
+	solcCache.put(&solcOutput{key: "b"})
+	assert.NotNil(solcCache.get("a"))
+	solcCache.put(&solcOutput{key: "c"})
+	solcCache.put(&solcOutput{key: "c"})
+	assert.Nil(solcCache.get("b"))
+	assert.NotNil(solcCache.get("a"))
+	assert.NotNil(solcCache.get("c"))
+	assert.Equal(2, solcCache.metrics().CacheEntries)
+}
+
+func TestSolcMetricsRejected(t *testing.T) {
+	assert := assert.New(t)
+	conf := &SolcConf{CacheSize: 0}
+
+	conf.runtime().cache.record(0, errors.Errorf(errors.CompilerTooManyCompiles, 1))
+	conf.runtime().cache.record(0, fmt.Errorf("pop"))
+	m := SolcMetrics(conf)
+	assert.Equal(uint64(1), m.Rejected)
+	assert.Equal(uint64(1), m.Compilations)
+	assert.Equal(uint64(1), m.Failures)
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// SolcConf limits the resources used by each execution of solc, so that pathological
+// Solidity source cannot consume the resources of the server. When a Sandbox container
+// CLI is configured, solc runs isolated in a container.
+// One configuration is created for the process, and passed to everything that runs solc,
+// so the limit on concurrent compilations and the cache of their output are shared.
+type SolcConf struct {
+	TimeoutSec    int    `json:"timeoutSec,omitempty"`
+	MaxConcurrent int    `json:"maxConcurrent,omitempty"`
+	MaxCPUSec     int    `json:"maxCPUSec,omitempty"`
+	MaxMemoryMB   int    `json:"maxMemoryMB,omitempty"`
+	Sandbox       string `json:"sandbox,omitempty"`
+	SandboxImage  string `json:"sandboxImage,omitempty"`
+	DownloadDir   string `json:"downloadDir,omitempty"`
+	DownloadURL   string `json:"downloadURL,omitempty"`
+	CacheSize     int    `json:"cacheSize,omitempty"`
+	state         *solcState
+}
+
+// solcState is the state shared by every execution of solc with a configuration
+type solcState struct {
+	slots chan struct{}
+	cache *solcOutputCache
+}
+
+var solcStateLock sync.Mutex
+
+// runtime returns the state of the configuration, creating it on first use
+func (conf *SolcConf) runtime() *solcState {
+	solcStateLock.Lock()
+	defer solcStateLock.Unlock()
+	if conf.state == nil {
+		log.Debugf("Solidity compiler limits: timeout=%ds maxConcurrent=%d maxCPU=%ds maxMemory=%dMB sandbox=%s cacheSize=%d",
+			conf.TimeoutSec, conf.MaxConcurrent, conf.MaxCPUSec, conf.MaxMemoryMB, conf.Sandbox, conf.CacheSize)
+		state := &solcState{cache: newSolcOutputCache(conf.CacheSize)}
+		if conf.MaxConcurrent > 0 {
+			state.slots = make(chan struct{}, conf.MaxConcurrent)
+		}
+		conf.state = state
+	}
+	return conf.state
+}
+
+// CobraInitSolc sets the standard command-line parameters for running solc
+func CobraInitSolc(cmd *cobra.Command, conf *SolcConf) {
+	cmd.Flags().IntVarP(&conf.TimeoutSec, "solc-timeout", "", 0, "Maximum time for a Solidity compilation before solc is killed (seconds)")
+	cmd.Flags().IntVarP(&conf.MaxConcurrent, "solc-max-concurrent", "", 0, "Maximum number of concurrent Solidity compilations")
+	cmd.Flags().IntVarP(&conf.CacheSize, "solc-cache-size", "", 100, "Number of compilations to cache, so identical Solidity compiled again skips solc (0=disabled)")
+	cmd.Flags().IntVarP(&conf.MaxCPUSec, "solc-max-cpu", "", 0, "Maximum CPU time for a Solidity compilation (seconds)")
+	cmd.Flags().IntVarP(&conf.MaxMemoryMB, "solc-max-memory-mb", "", 0, "Maximum virtual memory for a Solidity compilation (MB)")
+	cmd.Flags().StringVarP(&conf.Sandbox, "solc-sandbox", "", "", "Container CLI used to run solc isolated in a container, such as docker or podman")
+	cmd.Flags().StringVarP(&conf.SandboxImage, "solc-sandbox-image", "", DefaultSolcSandboxImage, "Container image to run solc in, when sandboxed")
+	cmd.Flags().StringVarP(&conf.DownloadDir, "solc-download-dir", "", "", "Cache directory for solc releases downloaded on demand. Enables automatic download of the requested compiler version")
+	cmd.Flags().StringVarP(&conf.DownloadURL, "solc-download-url", "", DefaultSolcDownloadURL, "Repository to download solc releases from")
+}
+
+// CompileErrorStatus returns the HTTP status for an error caused by exceeding
+// the solc limits, or the default status for any other compilation error
+func CompileErrorStatus(err error, defaultStatus int) int {
+	if e, ok := err.(errors.EthconnectError); ok {
+		switch e.Code() {
+		case errors.CompilerTimeout.Code(), errors.CompilerCPULimit.Code():
+			return 408
+		case errors.CompilerTooManyCompiles.Code():
+			return 429
+		}
+	}
+	return defaultStatus
+}
+
+// solcCommand builds the command, applying the CPU and memory limits with the shell's
+// ulimit, as Go cannot set the resource limits of a child process directly.
+// The shell replaces itself with solc, so the limits and any signals apply to solc.
+func solcCommand(ctx context.Context, conf *SolcConf, solcPath string, args []string) *exec.Cmd {
+	if conf.MaxCPUSec <= 0 && conf.MaxMemoryMB <= 0 {
+		return exec.CommandContext(ctx, solcPath, args...)
+	}
+	script := ""
+	if conf.MaxCPUSec > 0 {
+		script += fmt.Sprintf("ulimit -t %d; ", conf.MaxCPUSec)
+	}
+	if conf.MaxMemoryMB > 0 {
+		script += fmt.Sprintf("ulimit -v %d; ", conf.MaxMemoryMB*1024)
+	}
+	script += `exec "$0" "$@"`
+	return exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", script, solcPath}, args...)...)
+}
+
+// runSolcWithLimits executes solc within the configured limits. It fails immediately if
+// the maximum number of concurrent compilations are already running, and kills solc
+// if it exceeds the timeout.
+func runSolcWithLimits(conf *SolcConf, solcPath string, args []string, dir string, stdin io.Reader, stdout, stderr io.Writer) error {
+	slots := conf.runtime().slots
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		default:
+			return errors.Errorf(errors.CompilerTooManyCompiles, cap(slots))
+		}
+	}
+
+	ctx := context.Background()
+	if conf.TimeoutSec > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(conf.TimeoutSec)*time.Second)
+		defer cancel()
+	}
+	var cmd *exec.Cmd
+	var sandbox string
+	if conf.Sandbox != "" {
+		sandbox = "solc-" + utils.UUIDv4()
+		var err error
+		if cmd, err = sandboxCommand(ctx, conf, sandbox, solcPath, args, dir); err != nil {
+			return err
+		}
+	} else {
+		cmd = solcCommand(ctx, conf, solcPath, args)
+		cmd.Dir = dir
+	}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			if sandbox != "" {
+				removeSandbox(conf, sandbox)
+			}
+			return errors.Errorf(errors.CompilerTimeout, conf.TimeoutSec)
+		}
+		// The CPU limit is enforced by the kernel with a signal. The container CLI
+		// reports a signal in the container as an exit code of 128 plus the signal
+		if exitErr, ok := err.(*exec.ExitError); ok && conf.MaxCPUSec > 0 {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				return errors.Errorf(errors.CompilerCPULimit, conf.MaxCPUSec, status.Signal())
+			} else if sandbox != "" && exitErr.ExitCode() > 128 {
+				return errors.Errorf(errors.CompilerCPULimit, conf.MaxCPUSec, syscall.Signal(exitErr.ExitCode()-128))
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestSolcScript(t *testing.T, script string) (string, func()) {
+	dir, _ := ioutil.TempDir("", "solclimits")
+	solcPath := path.Join(dir, "solc")
+	err := ioutil.WriteFile(solcPath, []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	assert.NoError(t, err)
+	return solcPath, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRunSolcNoLimits(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `cat; echo "$@"; echo warning >&2`)
+	defer done()
+
+	var stdout, stderr bytes.Buffer
+	err := RunSolc(&SolcConf{}, solcPath, []string{"--a", "b c"}, "", strings.NewReader("input\n"), &stdout, &stderr)
+	assert.NoError(err)
+	assert.Equal("input\n--a b c\n", stdout.String())
+	assert.Equal("warning\n", stderr.String())
+}
+
+func TestRunSolcResourceLimitsApplied(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `ulimit -t; ulimit -v; echo "$@"; pwd`)
+	defer done()
+	dir, _ := ioutil.TempDir("", "solcdir")
+	defer os.RemoveAll(dir)
+
+	conf := &SolcConf{MaxCPUSec: 10, MaxMemoryMB: 2048}
+	var stdout bytes.Buffer
+	err := RunSolc(conf, solcPath, []string{"--a", "b c"}, dir, nil, &stdout, ioutil.Discard)
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal("10", lines[0])
+	assert.Equal("2097152", lines[1])
+	assert.Equal("--a b c", lines[2])
+	assert.Equal(path.Base(dir), path.Base(lines[3]))
+}
+
+func TestRunSolcTimeout(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `exec sleep 10`)
+	defer done()
+
+	conf := &SolcConf{TimeoutSec: 1}
+	start := time.Now()
+	err := RunSolc(conf, solcPath, []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("Solidity compilation exceeded the maximum time of 1s", err)
+	assert.True(time.Since(start) < 5*time.Second)
+	assert.Equal(408, CompileErrorStatus(err, 400))
+}
+
+func TestRunSolcCPULimit(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `while :; do :; done`)
+	defer done()
+
+	conf := &SolcConf{MaxCPUSec: 1, TimeoutSec: 20}
+	err := RunSolc(conf, solcPath, []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("Solidity compilation exceeded the maximum CPU time of 1s", err)
+	assert.Equal(408, CompileErrorStatus(err, 400))
+}
+
+func TestRunSolcTooManyConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `read line`)
+	defer done()
+
+	conf := &SolcConf{MaxConcurrent: 1}
+	stdinReader, stdinWriter := io.Pipe()
+	firstDone := make(chan error)
+	go func() {
+		firstDone <- RunSolc(conf, solcPath, []string{}, "", stdinReader, ioutil.Discard, ioutil.Discard)
+	}()
+	for len(conf.runtime().slots) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	err := RunSolc(conf, solcPath, []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("Too many concurrent Solidity compilations \\(maximum 1\\)", err)
+	assert.Equal(429, CompileErrorStatus(err, 400))
+
+	fmt.Fprintln(stdinWriter, "done")
+	stdinWriter.Close()
+	assert.NoError(<-firstDone)
+	assert.Equal(0, len(conf.runtime().slots))
+}
+
+func TestCompileErrorStatusDefault(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(400, CompileErrorStatus(errors.Errorf(errors.CompilerFailedSolc, "pop", ""), 400))
+	assert.Equal(500, CompileErrorStatus(fmt.Errorf("pop"), 500))
+}
+
+func TestSolcConfLimitsNotShared(t *testing.T) {
+	assert := assert.New(t)
+	solcPath, done := writeTestSolcScript(t, `read line`)
+	defer done()
+
+	limited := &SolcConf{MaxConcurrent: 1}
+	limited.runtime().slots <- struct{}{}
+	err := RunSolc(limited, solcPath, []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("Too many concurrent Solidity compilations", err)
+
+	// Another configuration is not affected by the limits of the first
+	err = RunSolc(&SolcConf{}, solcPath, []string{}, "", strings.NewReader("done\n"), ioutil.Discard, ioutil.Discard)
+	assert.NoError(err)
+}
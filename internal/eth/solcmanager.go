@@ -0,0 +1,415 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSolcDownloadURL is the repository of solc releases published by the Solidity project
+	DefaultSolcDownloadURL  = "https://binaries.soliditylang.org"
+	solcDownloadTimeout     = 5 * time.Minute
+	solcListRefreshInterval = 10 * time.Minute
+)
+
+var exactSolcVersion = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)\.([0-9]+)$`)
+var solidityPragma = regexp.MustCompile(`pragma\s+solidity\s+([^;]+);`)
+var pragmaTerm = regexp.MustCompile(`(\^|~|>=|<=|>|<|=)?\s*v?([0-9]+(?:\.[0-9]+){0,2})`)
+
+// SolcVersions lists the compilers that are installed, and the releases that can be downloaded
+type SolcVersions struct {
+	Default   string           `json:"default"`
+	Installed []*InstalledSolc `json:"installed"`
+	Available []string         `json:"available,omitempty"`
+}
+
+// InstalledSolc is a compiler configured with an environment variable, or previously downloaded
+type InstalledSolc struct {
+	Version string `json:"version"`
+	Path    string `json:"path"`
+	Source  string `json:"source"`
+}
+
+type solcBuild struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+type solcBuildList struct {
+	Builds   []*solcBuild      `json:"builds"`
+	Releases map[string]string `json:"releases"`
+}
+
+// solcDownloads caches the list of releases, and serializes downloads
+var solcDownloads struct {
+	lock    sync.Mutex
+	list    *solcBuildList
+	fetched time.Time
+}
+
+// solcPlatform returns the platform directory of the release repository for this server
+func solcPlatform() (string, error) {
+	return solcPlatformFor(runtime.GOOS, runtime.GOARCH)
+}
+
+// solcPlatformFor maps an OS and architecture to a platform directory of the release repository.
+// Releases are only published for amd64, apart from macOS where they also run on arm64
+func solcPlatformFor(goos, goarch string) (string, error) {
+	switch {
+	case goos == "darwin" && (goarch == "amd64" || goarch == "arm64"):
+		return "macosx-amd64", nil
+	case (goos == "linux" || goos == "windows") && goarch == "amd64":
+		return goos + "-amd64", nil
+	default:
+		return "", errors.Errorf(errors.SolcPlatformUnsupported, goos, goarch)
+	}
+}
+
+// solcDownloadPath is the location a release is downloaded to in the cache directory
+func solcDownloadPath(conf *SolcConf, version string) string {
+	return filepath.Join(conf.DownloadDir, "solc-v"+version)
+}
+
+func solcDownloadURL(conf *SolcConf) string {
+	if conf.DownloadURL != "" {
+		return strings.TrimSuffix(conf.DownloadURL, "/")
+	}
+	return DefaultSolcDownloadURL
+}
+
+// fetchSolcBuildList returns the list of releases, which is only fetched again if a
+// version is requested that was not released when the list was last fetched. So that
+// requests for versions that do not exist cannot hammer the repository, the list is
+// refreshed at most once per interval
+func fetchSolcBuildList(conf *SolcConf, refresh bool) (*solcBuildList, error) {
+	if solcDownloads.list != nil && (!refresh || time.Since(solcDownloads.fetched) < solcListRefreshInterval) {
+		return solcDownloads.list, nil
+	}
+	platform, err := solcPlatform()
+	if err != nil {
+		return nil, err
+	}
+	url := solcDownloadURL(conf) + "/" + platform + "/list.json"
+	client := &http.Client{Timeout: solcDownloadTimeout}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Errorf(errors.SolcDownloadFailed, "list", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, errors.Errorf(errors.SolcDownloadFailed, "list", fmt.Sprintf("%s returned %d", url, res.StatusCode))
+	}
+	var list solcBuildList
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, errors.Errorf(errors.SolcDownloadFailed, "list", err)
+	}
+	solcDownloads.list = &list
+	solcDownloads.fetched = time.Now()
+	return &list, nil
+}
+
+// findSolcBuild finds a release in the list, fetching the list again if it is not found and
+// the list has not been refreshed recently
+func findSolcBuild(conf *SolcConf, version string) (*solcBuild, error) {
+	for _, refresh := range []bool{false, true} {
+		list, err := fetchSolcBuildList(conf, refresh)
+		if err != nil {
+			return nil, err
+		}
+		if file, ok := list.Releases[version]; ok {
+			for _, build := range list.Builds {
+				if build.Path == file {
+					return build, nil
+				}
+			}
+		}
+	}
+	return nil, errors.Errorf(errors.SolcVersionUnavailable, version)
+}
+
+// downloadSolc returns the path to an exact release of solc in the cache directory,
+// downloading it and verifying its checksum if it is not already there
+func downloadSolc(conf *SolcConf, version string) (string, error) {
+	solcDownloads.lock.Lock()
+	defer solcDownloads.lock.Unlock()
+
+	target := solcDownloadPath(conf, version)
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+	build, err := findSolcBuild(conf, version)
+	if err != nil {
+		return "", err
+	}
+	platform, err := solcPlatform()
+	if err != nil {
+		return "", err
+	}
+	url := solcDownloadURL(conf) + "/" + platform + "/" + build.Path
+	log.Infof("Downloading solc %s from %s", version, url)
+	if err := os.MkdirAll(conf.DownloadDir, 0755); err != nil {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, err)
+	}
+	client := &http.Client{Timeout: solcDownloadTimeout}
+	res, err := client.Get(url)
+	if err != nil {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, fmt.Sprintf("%s returned %d", url, res.StatusCode))
+	}
+
+	// Download to a temporary file in the same directory, so the binary is only
+	// moved into place once it is complete and the checksum has been verified
+	tmp, err := ioutil.TempFile(conf.DownloadDir, "download-")
+	if err != nil {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, err)
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), res.Body)
+	tmp.Close()
+	if err != nil {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, err)
+	}
+	expected := strings.TrimPrefix(strings.ToLower(build.SHA256), "0x")
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return "", errors.Errorf(errors.SolcDownloadChecksum, version, expected, actual)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", errors.Errorf(errors.SolcDownloadFailed, version, err)
+	}
+	log.Infof("Downloaded solc %s to %s", version, target)
+	return target, nil
+}
+
+// latestSolcRelease returns the latest release that satisfies the supplied check
+func latestSolcRelease(conf *SolcConf, check func(v []int) bool) (string, bool, error) {
+	solcDownloads.lock.Lock()
+	list, err := fetchSolcBuildList(conf, false)
+	solcDownloads.lock.Unlock()
+	if err != nil {
+		return "", false, err
+	}
+	var latest []int
+	for version := range list.Releases {
+		v := parseSolcVersion(version)
+		if v != nil && check(v) && (latest == nil || compareSolcVersions(v, latest) > 0) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return "", false, nil
+	}
+	return fmt.Sprintf("%d.%d.%d", latest[0], latest[1], latest[2]), true, nil
+}
+
+// parseSolcVersion parses a version of up to three numbers, with any missing numbers as zero
+func parseSolcVersion(version string) []int {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) > 3 {
+		return nil
+	}
+	v := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		v[i] = n
+	}
+	return v
+}
+
+func compareSolcVersions(a, b []int) int {
+	for i := 0; i < 3; i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+// satisfiesPragma checks a version against the constraint of a Solidity version pragma,
+// such as ^0.8.0 or >=0.6.0 <0.9.0, with alternatives separated by ||
+func satisfiesPragma(v []int, constraint string) bool {
+	for _, alternative := range strings.Split(constraint, "||") {
+		terms := pragmaTerm.FindAllStringSubmatch(alternative, -1)
+		satisfied := len(terms) > 0
+		for _, term := range terms {
+			bound := parseSolcVersion(term[2])
+			if bound == nil {
+				satisfied = false
+				break
+			}
+			cmp := compareSolcVersions(v, bound)
+			switch term[1] {
+			case "^":
+				// Compatible with the first non-zero number, as with npm
+				satisfied = cmp >= 0 && v[0] == bound[0] && (bound[0] > 0 || v[1] == bound[1])
+			case "~":
+				satisfied = cmp >= 0 && v[0] == bound[0] && v[1] == bound[1]
+			case ">=":
+				satisfied = cmp >= 0
+			case "<=":
+				satisfied = cmp <= 0
+			case ">":
+				satisfied = cmp > 0
+			case "<":
+				satisfied = cmp < 0
+			default:
+				satisfied = cmp == 0
+			}
+			if !satisfied {
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// SolcVersionForSource returns the latest release of solc that satisfies the version pragmas of
+// all the supplied Solidity sources, when downloads are enabled and no version was requested.
+// Otherwise the requested version is returned unchanged
+func SolcVersionForSource(conf *SolcConf, requestedVersion string, sources ...string) (string, error) {
+	if requestedVersion != "" || conf.DownloadDir == "" {
+		return requestedVersion, nil
+	}
+	var constraints []string
+	for _, source := range sources {
+		for _, match := range solidityPragma.FindAllStringSubmatch(source, -1) {
+			constraints = append(constraints, strings.TrimSpace(match[1]))
+		}
+	}
+	if len(constraints) == 0 {
+		return "", nil
+	}
+	version, found, err := latestSolcRelease(conf, func(v []int) bool {
+		for _, c := range constraints {
+			if !satisfiesPragma(v, c) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errors.Errorf(errors.SolcPragmaUnsatisfied, strings.Join(constraints, "; "))
+	}
+	log.Infof("Solidity compiler %s selected for pragma '%s'", version, strings.Join(constraints, "; "))
+	return version, nil
+}
+
+// managedSolcExecutable returns a downloaded solc for a requested version when downloads are
+// enabled. An exact version is always downloaded, and a major.minor version is only downloaded
+// when no compiler is configured for it. It returns an empty string if the compiler should be
+// found from the environment
+func managedSolcExecutable(conf *SolcConf, requestedVersion string, configured bool) (string, error) {
+	if conf.DownloadDir == "" {
+		return "", nil
+	}
+	version := ""
+	if v := exactSolcVersion.FindStringSubmatch(requestedVersion); v != nil {
+		version = v[1] + "." + v[2] + "." + v[3]
+	} else if !configured {
+		requested := parseSolcVersion(requestedVersion)
+		if requested == nil {
+			return "", nil
+		}
+		var found bool
+		var err error
+		version, found, err = latestSolcRelease(conf, func(v []int) bool {
+			return v[0] == requested[0] && v[1] == requested[1]
+		})
+		if err != nil || !found {
+			return "", err
+		}
+	}
+	if version == "" {
+		return "", nil
+	}
+	return downloadSolc(conf, version)
+}
+
+// ListSolcVersions returns the compilers configured in the environment and downloaded
+// to the cache directory, and the releases available for download if downloads are enabled
+func ListSolcVersions(conf *SolcConf) (*SolcVersions, error) {
+	prefix := utils.GetenvOrDefaultUpperCase("PREFIX_SHORT", "fly") + "_SOLC_"
+	versions := &SolcVersions{
+		Default:   utils.GetenvOrDefaultLowerCase(prefix+"DEFAULT", "solc"),
+		Installed: []*InstalledSolc{},
+	}
+	configuredVersion := regexp.MustCompile("^" + prefix + "([0-9]+)_([0-9]+)=(.+)$")
+	for _, env := range os.Environ() {
+		if v := configuredVersion.FindStringSubmatch(env); v != nil {
+			versions.Installed = append(versions.Installed, &InstalledSolc{Version: v[1] + "." + v[2], Path: v[3], Source: "environment"})
+		}
+	}
+	if conf.DownloadDir != "" {
+		files, _ := ioutil.ReadDir(conf.DownloadDir)
+		for _, f := range files {
+			if v := exactSolcVersion.FindStringSubmatch(strings.TrimPrefix(f.Name(), "solc-")); v != nil {
+				versions.Installed = append(versions.Installed, &InstalledSolc{
+					Version: v[1] + "." + v[2] + "." + v[3],
+					Path:    filepath.Join(conf.DownloadDir, f.Name()),
+					Source:  "download",
+				})
+			}
+		}
+		solcDownloads.lock.Lock()
+		list, err := fetchSolcBuildList(conf, false)
+		solcDownloads.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		for version := range list.Releases {
+			versions.Available = append(versions.Available, version)
+		}
+		sort.Slice(versions.Available, func(i, j int) bool {
+			return compareSolcVersions(parseSolcVersion(versions.Available[i]), parseSolcVersion(versions.Available[j])) > 0
+		})
+	}
+	return versions, nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSolcBinary = "#!/bin/sh\necho solc\n"
+
+// newTestSolcRepository serves a release list and solc binaries, with the checksum of
+// 0.8.1 deliberately wrong
+func newTestSolcRepository(t *testing.T) (*httptest.Server, string, *int, *SolcConf, func()) {
+	sum := sha256.Sum256([]byte(testSolcBinary))
+	list := &solcBuildList{
+		Builds: []*solcBuild{
+			{Path: "solc-v0.6.12", Version: "0.6.12", SHA256: "0x" + hex.EncodeToString(sum[:])},
+			{Path: "solc-v0.8.0", Version: "0.8.0", SHA256: "0x" + hex.EncodeToString(sum[:])},
+			{Path: "solc-v0.8.1", Version: "0.8.1", SHA256: "0x1234"},
+		},
+		Releases: map[string]string{
+			"0.6.12": "solc-v0.6.12",
+			"0.8.0":  "solc-v0.8.0",
+			"0.8.1":  "solc-v0.8.1",
+		},
+	}
+	listFetches := 0
+	platform, _ := solcPlatform()
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/"+platform+"/list.json":
+			listFetches++
+			json.NewEncoder(res).Encode(list)
+		case strings.HasPrefix(req.URL.Path, "/"+platform+"/solc-v"):
+			res.Write([]byte(testSolcBinary))
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	dir, _ := ioutil.TempDir("", "solcdownloads")
+	conf := &SolcConf{DownloadDir: dir, DownloadURL: server.URL + "/"}
+	return server, dir, &listFetches, conf, func() {
+		server.Close()
+		os.RemoveAll(dir)
+		solcDownloads.list = nil
+	}
+}
+
+func TestSolcDownloadExactVersion(t *testing.T) {
+	assert := assert.New(t)
+	_, dir, listFetches, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	solc, err := getSolcExecutable(conf, "0.8.0")
+	assert.NoError(err)
+	assert.Equal(path.Join(dir, "solc-v0.8.0"), solc)
+	b, _ := ioutil.ReadFile(solc)
+	assert.Equal(testSolcBinary, string(b))
+	info, _ := os.Stat(solc)
+	assert.Equal(os.FileMode(0755), info.Mode().Perm())
+
+	// A second request uses the cached binary
+	solc, err = getSolcExecutable(conf, "0.8.0")
+	assert.NoError(err)
+	assert.Equal(path.Join(dir, "solc-v0.8.0"), solc)
+	assert.Equal(1, *listFetches)
+}
+
+func TestSolcDownloadMinorVersion(t *testing.T) {
+	assert := assert.New(t)
+	_, dir, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	solc, err := getSolcExecutable(conf, "0.6")
+	assert.NoError(err)
+	assert.Equal(path.Join(dir, "solc-v0.6.12"), solc)
+}
+
+func TestSolcDownloadMinorVersionPrefersEnvVar(t *testing.T) {
+	assert := assert.New(t)
+	_, _, listFetches, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	os.Setenv("FLY_SOLC_0_6", "solc06")
+	defer os.Unsetenv("FLY_SOLC_0_6")
+	solc, err := getSolcExecutable(conf, "0.6")
+	assert.NoError(err)
+	assert.Equal("solc06", solc)
+	assert.Equal(0, *listFetches)
+}
+
+func TestSolcDownloadMinorVersionNotReleased(t *testing.T) {
+	assert := assert.New(t)
+	_, _, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	_, err := getSolcExecutable(conf, "0.5")
+	assert.Regexp("Could not find a configured compiler for requested Solidity major version 0.5", err)
+}
+
+func TestSolcDownloadChecksumMismatch(t *testing.T) {
+	assert := assert.New(t)
+	_, dir, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	_, err := getSolcExecutable(conf, "0.8.1")
+	assert.Regexp("Downloaded solc 0.8.1 failed checksum verification", err)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(files)
+}
+
+func TestSolcDownloadVersionUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	_, _, listFetches, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	// The list was only just fetched, so it is not fetched again for an unknown version
+	_, err := getSolcExecutable(conf, "0.9.0")
+	assert.Regexp("Solidity compiler version 0.9.0 is not available for download", err)
+	assert.Equal(1, *listFetches)
+	_, err = getSolcExecutable(conf, "0.9.1")
+	assert.Regexp("Solidity compiler version 0.9.1 is not available for download", err)
+	assert.Equal(1, *listFetches)
+
+	// Once the list is older than the refresh interval, an unknown version fetches it again
+	solcDownloads.fetched = time.Now().Add(-solcListRefreshInterval)
+	_, err = getSolcExecutable(conf, "0.9.0")
+	assert.Regexp("Solidity compiler version 0.9.0 is not available for download", err)
+	assert.Equal(2, *listFetches)
+	_, err = getSolcExecutable(conf, "0.9.0")
+	assert.Regexp("Solidity compiler version 0.9.0 is not available for download", err)
+	assert.Equal(2, *listFetches)
+}
+
+func TestSolcPlatform(t *testing.T) {
+	assert := assert.New(t)
+
+	platform, err := solcPlatformFor("linux", "amd64")
+	assert.NoError(err)
+	assert.Equal("linux-amd64", platform)
+
+	platform, err = solcPlatformFor("windows", "amd64")
+	assert.NoError(err)
+	assert.Equal("windows-amd64", platform)
+
+	platform, err = solcPlatformFor("darwin", "arm64")
+	assert.NoError(err)
+	assert.Equal("macosx-amd64", platform)
+
+	_, err = solcPlatformFor("linux", "arm64")
+	assert.Regexp("FFEC100406.*linux/arm64", err)
+}
+
+func TestSolcDownloadListFailure(t *testing.T) {
+	assert := assert.New(t)
+	_, _, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	conf = &SolcConf{DownloadDir: "/tmp", DownloadURL: "http://localhost:0"}
+	_, err := getSolcExecutable(conf, "0.8.0")
+	assert.Regexp("Failed to download solc list", err)
+}
+
+func TestSolcDownloadListBadStatus(t *testing.T) {
+	assert := assert.New(t)
+	server, _, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	conf = &SolcConf{DownloadDir: "/tmp", DownloadURL: server.URL + "/missing"}
+	_, err := getSolcExecutable(conf, "0.8.0")
+	assert.Regexp("Failed to download solc list.*404", err)
+}
+
+func TestSolcVersionForSource(t *testing.T) {
+	assert := assert.New(t)
+	_, _, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	version, err := SolcVersionForSource(conf, "", "pragma solidity ^0.8.0;\ncontract A {}", "pragma solidity >=0.6.0 <0.9.0;")
+	assert.NoError(err)
+	assert.Equal("0.8.1", version)
+
+	version, err = SolcVersionForSource(conf, "", "pragma solidity 0.8.0;")
+	assert.NoError(err)
+	assert.Equal("0.8.0", version)
+
+	version, err = SolcVersionForSource(conf, "", "pragma solidity ~0.6.2 || ^0.7.0;")
+	assert.NoError(err)
+	assert.Equal("0.6.12", version)
+
+	version, err = SolcVersionForSource(conf, "0.4", "pragma solidity ^0.8.0;")
+	assert.NoError(err)
+	assert.Equal("0.4", version)
+
+	version, err = SolcVersionForSource(conf, "", "contract A {}")
+	assert.NoError(err)
+	assert.Equal("", version)
+
+	_, err = SolcVersionForSource(conf, "", "pragma solidity ^0.7.0;")
+	assert.Regexp("No released Solidity compiler version satisfies the pragma '\\^0.7.0'", err)
+}
+
+func TestSolcVersionForSourceDisabled(t *testing.T) {
+	assert := assert.New(t)
+	version, err := SolcVersionForSource(&SolcConf{}, "", "pragma solidity ^0.8.0;")
+	assert.NoError(err)
+	assert.Equal("", version)
+}
+
+func TestSatisfiesPragma(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(satisfiesPragma([]int{0, 8, 4}, "^0.8.0"))
+	assert.False(satisfiesPragma([]int{0, 9, 0}, "^0.8.0"))
+	assert.True(satisfiesPragma([]int{1, 9, 0}, "^1.2"))
+	assert.False(satisfiesPragma([]int{2, 0, 0}, "^1.2"))
+	assert.True(satisfiesPragma([]int{0, 6, 12}, "~0.6.2"))
+	assert.False(satisfiesPragma([]int{0, 6, 1}, "~0.6.2"))
+	assert.True(satisfiesPragma([]int{0, 7, 0}, ">0.6.0 <=0.7.0"))
+	assert.False(satisfiesPragma([]int{0, 6, 0}, ">0.6.0 <=0.7.0"))
+	assert.True(satisfiesPragma([]int{0, 5, 0}, "=0.5.0"))
+	assert.True(satisfiesPragma([]int{0, 4, 26}, "0.4.26 || ^0.8"))
+	assert.False(satisfiesPragma([]int{0, 4, 25}, "0.4.26 || ^0.8"))
+	assert.False(satisfiesPragma([]int{0, 8, 0}, "latest"))
+}
+
+func TestListSolcVersions(t *testing.T) {
+	assert := assert.New(t)
+	_, dir, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	os.Setenv("FLY_SOLC_0_6", "solc06")
+	defer os.Unsetenv("FLY_SOLC_0_6")
+	_, err := getSolcExecutable(conf, "0.8.0")
+	assert.NoError(err)
+
+	versions, err := ListSolcVersions(conf)
+	assert.NoError(err)
+	assert.Equal("solc", versions.Default)
+	assert.Contains(versions.Installed, &InstalledSolc{Version: "0.6", Path: "solc06", Source: "environment"})
+	assert.Contains(versions.Installed, &InstalledSolc{Version: "0.8.0", Path: path.Join(dir, "solc-v0.8.0"), Source: "download"})
+	assert.Equal([]string{"0.8.1", "0.8.0", "0.6.12"}, versions.Available)
+}
+
+func TestListSolcVersionsDisabled(t *testing.T) {
+	assert := assert.New(t)
+	versions, err := ListSolcVersions(&SolcConf{})
+	assert.NoError(err)
+	assert.Nil(versions.Available)
+}
+
+func TestListSolcVersionsListFailure(t *testing.T) {
+	assert := assert.New(t)
+	_, _, _, conf, done := newTestSolcRepository(t)
+	defer done()
+
+	conf = &SolcConf{DownloadDir: "/tmp", DownloadURL: "http://localhost:0"}
+	_, err := ListSolcVersions(conf)
+	assert.Regexp("Failed to download solc list", err)
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSolcSandboxImage is the image solc runs in when sandboxed. The solc binary is
+	// mounted from the host, so the image only needs to provide the C library
+	DefaultSolcSandboxImage = "debian:bullseye-slim"
+	// solcSandboxPids limits the processes in the container, as solc is single threaded
+	solcSandboxPids = 64
+	solcSandboxPath = "/usr/local/bin/solc"
+	solcSandboxDir  = "/src"
+)
+
+// sandboxCommand builds the command to run solc in a container, using the container CLI
+// configured as the sandbox (such as docker or podman). The container has no network,
+// a read-only root filesystem, no capabilities, and runs as the user of the server.
+// The source directory is mounted read-only, and the CPU and memory limits are applied
+// to the container.
+func sandboxCommand(ctx context.Context, conf *SolcConf, name, solcPath string, args []string, dir string) (*exec.Cmd, error) {
+	solcPath, err := exec.LookPath(solcPath)
+	if err == nil {
+		solcPath, err = filepath.Abs(solcPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	image := conf.SandboxImage
+	if image == "" {
+		image = DefaultSolcSandboxImage
+	}
+	runArgs := []string{
+		"run", "--rm", "-i",
+		"--name", name,
+		"--network", "none",
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--pids-limit", fmt.Sprintf("%d", solcSandboxPids),
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}
+	if conf.MaxCPUSec > 0 {
+		runArgs = append(runArgs, "--ulimit", fmt.Sprintf("cpu=%d:%d", conf.MaxCPUSec, conf.MaxCPUSec))
+	}
+	if conf.MaxMemoryMB > 0 {
+		runArgs = append(runArgs, "--memory", fmt.Sprintf("%dm", conf.MaxMemoryMB), "--memory-swap", fmt.Sprintf("%dm", conf.MaxMemoryMB))
+	}
+	runArgs = append(runArgs, "-v", solcPath+":"+solcSandboxPath+":ro")
+	if dir != "" {
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		runArgs = append(runArgs, "-v", dir+":"+solcSandboxDir+":ro", "-w", solcSandboxDir)
+	} else {
+		runArgs = append(runArgs, "-w", "/tmp")
+	}
+	runArgs = append(runArgs, "--entrypoint", solcSandboxPath, image)
+	return exec.CommandContext(ctx, conf.Sandbox, append(runArgs, args...)...), nil
+}
+
+// removeSandbox forcibly removes a sandbox container. Killing the container CLI when
+// the compilation times out does not stop the container itself
+func removeSandbox(conf *SolcConf, name string) {
+	if out, err := exec.Command(conf.Sandbox, "rm", "-f", name).CombinedOutput(); err != nil {
+		log.Warnf("Failed to remove solc sandbox container %s: %s %s", name, err, out)
+	}
+}
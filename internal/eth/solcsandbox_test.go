@@ -0,0 +1,125 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestSandboxScript writes a fake container CLI, which records its arguments
+func writeTestSandboxScript(t *testing.T, script string) (string, string, func()) {
+	dir, _ := ioutil.TempDir("", "solcsandbox")
+	sandboxPath := path.Join(dir, "docker")
+	logPath := path.Join(dir, "args.log")
+	err := ioutil.WriteFile(sandboxPath, []byte("#!/bin/sh\necho \"$@\" >> "+logPath+"\n"+script+"\n"), 0755)
+	assert.NoError(t, err)
+	ioutil.WriteFile(path.Join(dir, "solc"), []byte{}, 0755)
+	return sandboxPath, logPath, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRunSolcSandbox(t *testing.T) {
+	assert := assert.New(t)
+	sandboxPath, logPath, done := writeTestSandboxScript(t, `cat; echo warning >&2`)
+	defer done()
+	srcDir, _ := ioutil.TempDir("", "solcdir")
+	defer os.RemoveAll(srcDir)
+	solcPath := path.Join(path.Dir(sandboxPath), "solc")
+
+	conf := &SolcConf{Sandbox: sandboxPath, MaxCPUSec: 10, MaxMemoryMB: 2048}
+	var stdout, stderr bytes.Buffer
+	err := RunSolc(conf, solcPath, []string{"--a", "b"}, srcDir, strings.NewReader("input\n"), &stdout, &stderr)
+	assert.NoError(err)
+	assert.Equal("input\n", stdout.String())
+	assert.Equal("warning\n", stderr.String())
+
+	b, _ := ioutil.ReadFile(logPath)
+	args := strings.TrimSpace(string(b))
+	assert.Regexp("^run --rm -i --name solc-[0-9a-f-]+ --network none --read-only --tmpfs /tmp --cap-drop ALL --security-opt no-new-privileges", args)
+	assert.Contains(args, fmt.Sprintf("--user %d:%d", os.Getuid(), os.Getgid()))
+	assert.Contains(args, "--ulimit cpu=10:10 --memory 2048m --memory-swap 2048m")
+	assert.Contains(args, "-v "+solcPath+":/usr/local/bin/solc:ro -v "+srcDir+":/src:ro -w /src")
+	assert.True(strings.HasSuffix(args, "--entrypoint /usr/local/bin/solc debian:bullseye-slim --a b"))
+}
+
+func TestRunSolcSandboxNoDir(t *testing.T) {
+	assert := assert.New(t)
+	sandboxPath, logPath, done := writeTestSandboxScript(t, ``)
+	defer done()
+
+	conf := &SolcConf{Sandbox: sandboxPath, SandboxImage: "solc-base:1"}
+	err := RunSolc(conf, path.Join(path.Dir(sandboxPath), "solc"), []string{"--version"}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.NoError(err)
+
+	b, _ := ioutil.ReadFile(logPath)
+	args := strings.TrimSpace(string(b))
+	assert.NotContains(args, "--ulimit")
+	assert.NotContains(args, "--memory")
+	assert.True(strings.HasSuffix(args, "-w /tmp --entrypoint /usr/local/bin/solc solc-base:1 --version"))
+}
+
+func TestRunSolcSandboxMissingSolc(t *testing.T) {
+	assert := assert.New(t)
+	sandboxPath, _, done := writeTestSandboxScript(t, ``)
+	defer done()
+
+	conf := &SolcConf{Sandbox: sandboxPath}
+	err := RunSolc(conf, "missing-solc-binary", []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("executable file not found", err)
+}
+
+func TestRunSolcSandboxTimeout(t *testing.T) {
+	assert := assert.New(t)
+	sandboxPath, logPath, done := writeTestSandboxScript(t, `[ "$1" = "run" ] && exec sleep 10`)
+	defer done()
+
+	conf := &SolcConf{Sandbox: sandboxPath, TimeoutSec: 1}
+	start := time.Now()
+	err := RunSolc(conf, path.Join(path.Dir(sandboxPath), "solc"), []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("Solidity compilation exceeded the maximum time of 1s", err)
+	assert.True(time.Since(start) < 5*time.Second)
+
+	// The container is removed, as killing the CLI does not stop it
+	b, _ := ioutil.ReadFile(logPath)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(2, len(lines))
+	assert.Regexp("^rm -f solc-[0-9a-f-]+$", lines[1])
+	assert.Contains(lines[0], strings.TrimPrefix(lines[1], "rm -f "))
+}
+
+func TestRunSolcSandboxCPULimit(t *testing.T) {
+	assert := assert.New(t)
+	sandboxPath, _, done := writeTestSandboxScript(t, `exit 152`)
+	defer done()
+
+	conf := &SolcConf{Sandbox: sandboxPath, MaxCPUSec: 1}
+	err := RunSolc(conf, path.Join(path.Dir(sandboxPath), "solc"), []string{}, "", nil, ioutil.Discard, ioutil.Discard)
+	assert.Regexp("Solidity compilation exceeded the maximum CPU time of 1s", err)
+	assert.Equal(408, CompileErrorStatus(err, 400))
+}
+
+func TestRemoveSandboxFail(t *testing.T) {
+	removeSandbox(&SolcConf{Sandbox: "missing-container-cli"}, "solc-1")
+}
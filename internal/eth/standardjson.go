@@ -0,0 +1,164 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+const standardJSONOption = "--standard-json"
+
+// standardJSONOutputSelection is the output we require from solc for every contract. The output
+// selection is not part of the contract metadata, so replacing it does not affect the bytecode
+var standardJSONOutputSelection = map[string]interface{}{
+	"*": map[string]interface{}{
+		"*": []string{"abi", "devdoc", "userdoc", "metadata", "evm.bytecode.object", "evm.deployedBytecode.object"},
+	},
+}
+
+type standardJSONError struct {
+	Severity         string `json:"severity"`
+	FormattedMessage string `json:"formattedMessage"`
+	Message          string `json:"message"`
+}
+
+type standardJSONContract struct {
+	ABI      interface{} `json:"abi"`
+	DevDoc   interface{} `json:"devdoc"`
+	UserDoc  interface{} `json:"userdoc"`
+	Metadata string      `json:"metadata"`
+	EVM      struct {
+		Bytecode struct {
+			Object string `json:"object"`
+		} `json:"bytecode"`
+		DeployedBytecode struct {
+			Object string `json:"object"`
+		} `json:"deployedBytecode"`
+	} `json:"evm"`
+}
+
+type standardJSONOutput struct {
+	Errors    []*standardJSONError                        `json:"errors"`
+	Contracts map[string]map[string]*standardJSONContract `json:"contracts"`
+}
+
+// PrepareStandardJSONInput validates a solc standard-JSON input document, and sets the
+// output selection so that solc returns everything needed to deploy each contract.
+// The sources and all other settings are passed to solc unchanged
+func PrepareStandardJSONInput(input []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(input))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, errors.Errorf(errors.CompilerStandardJSONInvalid, err)
+	}
+	if lang, ok := doc["language"].(string); !ok || lang != "Solidity" {
+		return nil, errors.Errorf(errors.CompilerStandardJSONInvalid, "language must be 'Solidity'")
+	}
+	if sources, ok := doc["sources"].(map[string]interface{}); !ok || len(sources) == 0 {
+		return nil, errors.Errorf(errors.CompilerStandardJSONInvalid, "no sources")
+	}
+	settings, ok := doc["settings"].(map[string]interface{})
+	if !ok {
+		settings = map[string]interface{}{}
+		doc["settings"] = settings
+	}
+	settings["outputSelection"] = standardJSONOutputSelection
+	return json.Marshal(doc)
+}
+
+// StandardJSONSources returns the content of the sources embedded in a standard-JSON input document
+func StandardJSONSources(input []byte) []string {
+	var doc struct {
+		Sources map[string]struct {
+			Content string `json:"content"`
+		} `json:"sources"`
+	}
+	_ = json.Unmarshal(input, &doc)
+	sources := make([]string, 0, len(doc.Sources))
+	for _, source := range doc.Sources {
+		sources = append(sources, source.Content)
+	}
+	return sources
+}
+
+// CompileStandardJSON runs solc with a standard-JSON input document, from the supplied directory
+// so that sources referenced by URL can be resolved relative to it. Warnings reported by the
+// compiler are passed to the supplied function
+func CompileStandardJSON(conf *SolcConf, solc *ethbinding.Solidity, input []byte, dir string, warn func(string)) (map[string]*ethbinding.Contract, error) {
+	input, err := PrepareStandardJSONInput(input)
+	if err != nil {
+		return nil, err
+	}
+	var stderr, stdout bytes.Buffer
+	if err := RunSolc(conf, solc.Path, []string{standardJSONOption, "--allow-paths", "."}, dir, bytes.NewReader(input), &stdout, &stderr); err != nil {
+		if CompileErrorStatus(err, 0) != 0 {
+			return nil, err
+		}
+		return nil, errors.Errorf(errors.CompilerFailedSolc, err, stderr.String())
+	}
+	return ProcessStandardJSONOutput(stdout.Bytes(), solc.Version, warn)
+}
+
+// ProcessStandardJSONOutput converts solc standard-JSON output into the same form as the
+// combined JSON output, with each contract keyed by "source:ContractName"
+func ProcessStandardJSONOutput(output []byte, version string, warn func(string)) (map[string]*ethbinding.Contract, error) {
+	var out standardJSONOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return nil, errors.Errorf(errors.CompilerStandardJSONOutputInvalid, err)
+	}
+	var compileErrors []string
+	for _, e := range out.Errors {
+		msg := e.FormattedMessage
+		if msg == "" {
+			msg = e.Message
+		}
+		if e.Severity == "error" {
+			compileErrors = append(compileErrors, msg)
+		} else if warn != nil {
+			warn(msg)
+		}
+	}
+	if len(compileErrors) > 0 {
+		return nil, errors.Errorf(errors.CompilerStandardJSONFailed, strings.Join(compileErrors, "\n"))
+	}
+
+	contracts := make(map[string]*ethbinding.Contract)
+	for source, sourceContracts := range out.Contracts {
+		for name, c := range sourceContracts {
+			contracts[source+":"+name] = &ethbinding.Contract{
+				Code:        "0x" + c.EVM.Bytecode.Object,
+				RuntimeCode: "0x" + c.EVM.DeployedBytecode.Object,
+				Info: ethbinding.ContractInfo{
+					Source:          source,
+					Language:        "Solidity",
+					LanguageVersion: version,
+					CompilerVersion: version,
+					CompilerOptions: standardJSONOption,
+					AbiDefinition:   c.ABI,
+					UserDoc:         c.UserDoc,
+					DeveloperDoc:    c.DevDoc,
+					Metadata:        c.Metadata,
+				},
+			}
+		}
+	}
+	return contracts, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testStandardJSONOutput = `{
+	"errors": [
+		{"severity": "warning", "formattedMessage": "Warning: SPDX license identifier not provided"}
+	],
+	"contracts": {
+		"contracts/Store.sol": {
+			"Store": {
+				"abi": [{"type":"function","name":"get","inputs":[],"outputs":[{"name":"","type":"uint256"}]}],
+				"devdoc": {"methods":{}},
+				"userdoc": {"methods":{}},
+				"metadata": "{\"compiler\":{\"version\":\"0.8.10\"}}",
+				"evm": {
+					"bytecode": {"object": "6080"},
+					"deployedBytecode": {"object": "6081"}
+				}
+			}
+		}
+	}
+}`
+
+func TestPrepareStandardJSONInput(t *testing.T) {
+	assert := assert.New(t)
+	input, err := PrepareStandardJSONInput([]byte(`{
+		"language": "Solidity",
+		"sources": {"Store.sol": {"content": "contract Store {}"}},
+		"settings": {
+			"optimizer": {"enabled": true, "runs": 1000000000000000000000},
+			"evmVersion": "london",
+			"remappings": ["@oz/=lib/oz/"],
+			"outputSelection": {"*": {"*": ["abi"]}}
+		}
+	}`))
+	assert.NoError(err)
+	var doc map[string]interface{}
+	json.Unmarshal(input, &doc)
+	settings := doc["settings"].(map[string]interface{})
+	assert.Equal("london", settings["evmVersion"])
+	assert.Equal([]interface{}{"@oz/=lib/oz/"}, settings["remappings"])
+	assert.Contains(string(input), `"runs":1000000000000000000000`)
+	assert.Contains(string(input), `"evm.deployedBytecode.object"`)
+
+	input, err = PrepareStandardJSONInput([]byte(`{"language":"Solidity","sources":{"Store.sol":{"content":""}}}`))
+	assert.NoError(err)
+	assert.Contains(string(input), `"outputSelection"`)
+}
+
+func TestPrepareStandardJSONInputBad(t *testing.T) {
+	assert := assert.New(t)
+	_, err := PrepareStandardJSONInput([]byte(`!json`))
+	assert.Regexp("Invalid solc standard-JSON input", err)
+	_, err = PrepareStandardJSONInput([]byte(`{"language":"Vyper","sources":{"a.vy":{}}}`))
+	assert.Regexp("language must be 'Solidity'", err)
+	_, err = PrepareStandardJSONInput([]byte(`{"language":"Solidity","sources":{}}`))
+	assert.Regexp("no sources", err)
+}
+
+func TestProcessStandardJSONOutput(t *testing.T) {
+	assert := assert.New(t)
+	var warnings []string
+	compiled, err := ProcessStandardJSONOutput([]byte(testStandardJSONOutput), "0.8.10", func(w string) {
+		warnings = append(warnings, w)
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"Warning: SPDX license identifier not provided"}, warnings)
+	c := compiled["contracts/Store.sol:Store"]
+	assert.NotNil(c)
+	assert.Equal("0x6080", c.Code)
+	assert.Equal("0x6081", c.RuntimeCode)
+	assert.Equal("0.8.10", c.Info.CompilerVersion)
+	assert.Equal("--standard-json", c.Info.CompilerOptions)
+	assert.Equal(`{"compiler":{"version":"0.8.10"}}`, c.Info.Metadata)
+
+	packed, err := ProcessCompiled(compiled, "contracts/Store.sol:Store", false)
+	assert.NoError(err)
+	assert.Equal("Store", packed.ContractName)
+	assert.Equal([]byte{0x60, 0x80}, packed.Compiled)
+	assert.Equal("get", packed.ABI[0].Name)
+}
+
+func TestProcessStandardJSONOutputErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := ProcessStandardJSONOutput([]byte(`{"errors":[
+		{"severity":"warning","formattedMessage":"a warning"},
+		{"severity":"error","formattedMessage":"ParserError: Expected ';'"},
+		{"severity":"error","message":"Source not found"}
+	]}`), "0.8.10", nil)
+	assert.Regexp("Solidity compilation failed: ParserError: Expected ';'\nSource not found", err)
+
+	_, err = ProcessStandardJSONOutput([]byte(`!json`), "0.8.10", nil)
+	assert.Regexp("Failed to parse solc standard-JSON output", err)
+}
+
+func TestCompileStandardJSONBadInput(t *testing.T) {
+	assert := assert.New(t)
+	_, err := CompileStandardJSON(&SolcConf{}, &ethbinding.Solidity{Path: "solc"}, []byte(`!json`), "", nil)
+	assert.Regexp("Invalid solc standard-JSON input", err)
+}
+
+func TestCompileStandardJSONBadSolc(t *testing.T) {
+	assert := assert.New(t)
+	_, err := CompileStandardJSON(&SolcConf{}, &ethbinding.Solidity{Path: "badness"}, []byte(`{"language":"Solidity","sources":{"a.sol":{"content":""}}}`), "", nil)
+	assert.Regexp("Solidity compilation failed: solc", err)
+}
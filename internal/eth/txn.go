@@ -47,6 +47,14 @@ type Txn struct {
 	PrivateFor       []string
 	PrivacyGroupID   string
 	Signer           TXSigner
+	// MaxFeePerGas and MaxPriorityFeePerGas are set for an EIP-1559 dynamic fee transaction
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	// GasEstimate configures the gas when it is estimated, and EstimatedGas records the estimate
+	GasEstimate  *GasEstimateConf
+	EstimatedGas uint64
+	// Errors are the custom errors of the contract, to decode the reason the transaction reverts with
+	Errors ethbinding.ABIMarshaling
 }
 
 // TxnReceipt is the receipt obtained over JSON/RPC from the ethereum client
@@ -61,6 +69,8 @@ type TxnReceipt struct {
 	Status            *ethbinding.HexBigInt `json:"status"`
 	To                *ethbinding.Address   `json:"to"`
 	TransactionIndex  *ethbinding.HexUint   `json:"transactionIndex"`
+	EffectiveGasPrice *ethbinding.HexBigInt `json:"effectiveGasPrice"`
+	Logs              []*TxnLog             `json:"logs"`
 }
 
 // TxnInfo is the detailed transaction info returned by eth_getTransactionByXXXXX
@@ -79,8 +89,8 @@ type TxnInfo struct {
 }
 
 // NewContractDeployTxn builds a new ethereum transaction from the supplied
-// SendTranasction message
-func NewContractDeployTxn(msg *messages.DeployContract, signer TXSigner) (tx *Txn, err error) {
+// SendTranasction message. Solidity source is compiled within the limits of the solc configuration
+func NewContractDeployTxn(solc *SolcConf, msg *messages.DeployContract, signer TXSigner) (tx *Txn, err error) {
 
 	tx = &Txn{Signer: signer}
 
@@ -93,7 +103,7 @@ func NewContractDeployTxn(msg *messages.DeployContract, signer TXSigner) (tx *Tx
 		}
 	} else if msg.Solidity != "" {
 		// Compile the solidity contract
-		if compiled, err = CompileContract(msg.Solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion); err != nil {
+		if compiled, err = CompileContract(solc, msg.Solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion); err != nil {
 			return
 		}
 	} else {
@@ -131,21 +141,26 @@ func NewContractDeployTxn(msg *messages.DeployContract, signer TXSigner) (tx *Tx
 	if err = tx.genEthTransaction(from, "", msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, data); err != nil {
 		return
 	}
+	if err = tx.SetDynamicFees(msg.MaxFeePerGas, msg.MaxPriorityFeePerGas); err != nil {
+		return
+	}
 
 	// retain private transaction fields
 	tx.PrivateFrom = msg.PrivateFrom
 	tx.PrivateFor = msg.PrivateFor
 	tx.PrivacyGroupID = msg.PrivacyGroupID
+	tx.Errors = ABIErrors(compiled.ABI)
 	return
 }
 
 // CallMethod performs eth_call to return data from the chain
-func CallMethod(ctx context.Context, rpc RPCClient, signer TXSigner, from, addr string, value json.Number, methodABI *ethbinding.ABIMethod, msgParams []interface{}, blocknumber string) (map[string]interface{}, error) {
+func CallMethod(ctx context.Context, rpc RPCClient, signer TXSigner, from, addr string, value json.Number, methodABI *ethbinding.ABIMethod, msgParams []interface{}, blocknumber string, errorABIs ethbinding.ABIMarshaling) (map[string]interface{}, error) {
 	log.Debugf("Calling method. ABI: %+v Params: %+v", methodABI, msgParams)
 	tx, err := buildTX(signer, from, addr, "", value, "", "", methodABI, msgParams)
 	if err != nil {
 		return nil, err
 	}
+	tx.Errors = errorABIs
 	callOption := "latest"
 	// only allowed values are "earliest/latest/pending", "", a number string "12345" or a hex number "0xab23"
 	// "latest" and "" (no fly-blocknumber given) are equivalent
@@ -369,10 +384,14 @@ func NewSendTxn(msg *messages.SendTransaction, signer TXSigner) (tx *Txn, err er
 	if tx, err = buildTX(signer, msg.From, msg.To, msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, methodABI, msg.Parameters); err != nil {
 		return
 	}
+	if err = tx.SetDynamicFees(msg.MaxFeePerGas, msg.MaxPriorityFeePerGas); err != nil {
+		return
+	}
 
 	// retain private transaction fields
 	tx.PrivateFrom = msg.PrivateFrom
 	tx.PrivateFor = msg.PrivateFor
+	tx.Errors = msg.Errors
 	return
 }
 
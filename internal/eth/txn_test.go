@@ -74,7 +74,7 @@ func TestNewContractDeployTxnSimpleStorage(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -104,7 +104,7 @@ func TestNewContractDeployTxnSimpleStorageCalcGas(t *testing.T) {
 	msg.Nonce = "123"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -137,7 +137,7 @@ func TestNewContractDeployTxnSimpleStoragePrivate(t *testing.T) {
 	msg.GasPrice = "0"
 	msg.PrivateFrom = "oD76ZRgu6py/WKrsXbtF9++Mf1mxVxzqficE1Uiw6S8="
 	msg.PrivateFor = []string{"s6a3mQ8I+rI2ZgHqHZlJaELiJs10HxlZNIwNd669FH4="}
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -167,7 +167,7 @@ func TestNewContractDeployTxnSimpleStoragePrivateOrion(t *testing.T) {
 	msg.Value = "678"
 	msg.GasPrice = "0"
 	msg.PrivateFrom = "oD76ZRgu6py/WKrsXbtF9++Mf1mxVxzqficE1Uiw6S8="
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	tx.PrivacyGroupID = "P8SxRUussJKqZu4+nUkMJpscQeWOR3HqbAXLakatsk8="
 	rpc := testRPCClient{}
@@ -197,7 +197,7 @@ func TestNewContractDeployTxnSimpleStoragePrivateOrionMissingPrivateFrom(t *test
 	msg.Nonce = "123"
 	msg.Value = "678"
 	msg.GasPrice = "0"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	tx.OrionPrivateAPIS = true
 	tx.PrivacyGroupID = "s6a3mQ8I+rI2ZgHqHZlJaELiJs10HxlZNIwNd669FH4="
@@ -216,7 +216,7 @@ func TestNewContractDeployTxnSimpleStorageCalcGasFailAndCallSucceeds(t *testing.
 	msg.Nonce = "123"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -235,7 +235,7 @@ func TestNewContractDeployTxnSimpleStorageCalcGasFailAndCallFailsAsExpected(t *t
 	msg.Nonce = "123"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -255,14 +255,14 @@ func TestNewContractDeployMissingCompiledOrSolidity(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Missing Compiled Code \\+ ABI, or Solidity", err)
 }
 
 func TestNewContractDeployPrecompiledSimpleStorage(t *testing.T) {
 	assert := assert.New(t)
 
-	c, err := CompileContract(simpleStorage, "simplestorage", "", "")
+	c, err := CompileContract(&SolcConf{}, simpleStorage, "simplestorage", "", "")
 	assert.NoError(err)
 
 	var msg messages.DeployContract
@@ -274,7 +274,7 @@ func TestNewContractDeployPrecompiledSimpleStorage(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -305,7 +305,7 @@ func TestNewContractDeployTxnBadNonce(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Converting supplied 'nonce' to integer", err.Error())
 }
 
@@ -320,7 +320,7 @@ func TestNewContractDeployBadValue(t *testing.T) {
 	msg.Value = "zzz"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Converting supplied 'value' to big integer", err.Error())
 }
 
@@ -335,7 +335,7 @@ func TestNewContractDeployBadGas(t *testing.T) {
 	msg.Value = "111"
 	msg.Gas = "abc"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Converting supplied 'gas' to integer", err.Error())
 }
 
@@ -350,7 +350,7 @@ func TestNewContractDeployBadGasPrice(t *testing.T) {
 	msg.Value = "111"
 	msg.Gas = "456"
 	msg.GasPrice = "abc"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Converting supplied 'gasPrice' to big integer", err.Error())
 }
 
@@ -359,7 +359,7 @@ func TestNewContractDeployTxnBadContract(t *testing.T) {
 
 	var msg messages.DeployContract
 	msg.Solidity = "badness"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Solidity compilation failed", err.Error())
 }
 
@@ -374,7 +374,7 @@ func TestNewContractDeployStringForNumber(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 }
 
@@ -384,7 +384,7 @@ func TestNewContractDeployTxnBadContractName(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.ContractName = "wrongun"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Contract '<stdin>:wrongun' not found in Solidity source", err.Error())
 }
 func TestNewContractDeploySpecificContractName(t *testing.T) {
@@ -399,7 +399,7 @@ func TestNewContractDeploySpecificContractName(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Nil(err)
 }
 
@@ -408,7 +408,7 @@ func TestNewContractDeployMissingNameMultipleContracts(t *testing.T) {
 
 	var msg messages.DeployContract
 	msg.Solidity = twoContracts
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("More than one contract in Solidity file", err.Error())
 }
 
@@ -418,7 +418,7 @@ func TestNewContractDeployBadNumber(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{"ABCD"}
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Could not be converted to a number", err.Error())
 }
 
@@ -428,7 +428,7 @@ func TestNewContractDeployBadTypeForNumber(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{false}
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Must supply a number or a string", err.Error())
 }
 
@@ -438,7 +438,7 @@ func TestNewContractDeployMissingParam(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{}
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 	assert.Regexp("Requires 1 args \\(supplied=0\\)", err.Error())
 }
 
@@ -453,7 +453,7 @@ func testComplexParam(t *testing.T, solidityType string, val interface{}, expect
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&SolcConf{}, &msg, nil)
 
 	if expectedErr == "" {
 		assert.Nil(err)
@@ -783,7 +783,7 @@ func TestCallMethod(t *testing.T) {
 	res, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "")
+		json.Number("12345"), genMethod(params), params, "", nil)
 	assert.NoError(err)
 	assert.Equal(map[string]interface{}{
 		"retval1": "1",
@@ -804,7 +804,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "pending")
+		json.Number("12345"), genMethod(params), params, "pending", nil)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("pending", rpc.capturedArgs2[1])
@@ -812,7 +812,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "earliest")
+		json.Number("12345"), genMethod(params), params, "earliest", nil)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("earliest", rpc.capturedArgs2[1])
@@ -820,7 +820,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "0x1234")
+		json.Number("12345"), genMethod(params), params, "0x1234", nil)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("0x1234", rpc.capturedArgs2[1])
@@ -828,7 +828,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "12345")
+		json.Number("12345"), genMethod(params), params, "12345", nil)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("0x3039", rpc.capturedArgs2[1])
@@ -836,7 +836,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "0")
+		json.Number("12345"), genMethod(params), params, "0", nil)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("0x0", rpc.capturedArgs2[1])
@@ -857,7 +857,7 @@ func TestCallMethodFail(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", nil)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	assert.Regexp("Call failed: pop", err)
@@ -865,7 +865,7 @@ func TestCallMethodFail(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "ab2345")
+		json.Number("12345"), method, params, "ab2345", nil)
 	assert.Regexp("Invalid blocknumber. Failed to parse into big integer", err)
 }
 
@@ -887,7 +887,7 @@ func TestCallMethodRevert(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", nil)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	assert.Regexp("Muppetry detected", err)
@@ -911,7 +911,7 @@ func TestCallMethodRevertBadStrLen(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", nil)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	// Should read up to the end of the padding, and not panic
@@ -936,7 +936,7 @@ func TestCallMethodRevertBadBytes(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", nil)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	assert.Regexp("EVM reverted. Failed to decode error message", err)
@@ -949,7 +949,7 @@ func TestCallMethodBadArgs(t *testing.T) {
 		mockError: fmt.Errorf("pop"),
 	}
 
-	_, err := CallMethod(context.Background(), rpc, nil, "badness", "", json.Number(""), &ethbinding.ABIMethod{}, []interface{}{}, "")
+	_, err := CallMethod(context.Background(), rpc, nil, "badness", "", json.Number(""), &ethbinding.ABIMethod{}, []interface{}{}, "", nil)
 
 	assert.Regexp("Supplied value for 'from' is not a valid hex address", err)
 }
@@ -1141,7 +1141,7 @@ func TestNewContractWithTXSignerOK(t *testing.T) {
 	msg.GasPrice = "789"
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{"12345"}
-	tx, err := NewContractDeployTxn(&msg, signer)
+	tx, err := NewContractDeployTxn(&SolcConf{}, &msg, signer)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -0,0 +1,81 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// TxPoolTransaction is a transaction in the transaction pool of the node
+type TxPoolTransaction struct {
+	Hash     string                `json:"hash"`
+	Nonce    ethbinding.HexUint64  `json:"nonce"`
+	To       string                `json:"to,omitempty"`
+	Gas      ethbinding.HexUint64  `json:"gas"`
+	GasPrice *ethbinding.HexBigInt `json:"gasPrice,omitempty"`
+}
+
+// TxPoolContent is the pending and queued transactions of an address in the transaction
+// pool of the node, in nonce order
+type TxPoolContent struct {
+	Pending []*TxPoolTransaction
+	Queued  []*TxPoolTransaction
+}
+
+// GetTxPoolContent gets the transactions the node has in its transaction pool for an address,
+// using txpool_content. The txpool namespace is not supported by all nodes
+func GetTxPoolContent(ctx context.Context, rpc RPCClient, addr string) (*TxPoolContent, error) {
+	start := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var content map[string]map[string]map[string]*TxPoolTransaction
+	if err := rpc.CallContext(ctx, &content, "txpool_content"); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, "txpool_content", err)
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("txpool_content [%.2fs]", callTime.Seconds())
+
+	return &TxPoolContent{
+		Pending: txPoolTransactionsFor(content["pending"], addr),
+		Queued:  txPoolTransactionsFor(content["queued"], addr),
+	}, nil
+}
+
+func txPoolTransactionsFor(byAddress map[string]map[string]*TxPoolTransaction, addr string) []*TxPoolTransaction {
+	txns := []*TxPoolTransaction{}
+	for a, byNonce := range byAddress {
+		// The node returns checksum addresses
+		if !strings.EqualFold(a, addr) {
+			continue
+		}
+		for _, txn := range byNonce {
+			if txn != nil {
+				txns = append(txns, txn)
+			}
+		}
+	}
+	sort.Slice(txns, func(i, j int) bool { return txns[i].Nonce < txns[j].Nonce })
+	return txns
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTxPoolContent(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			json.Unmarshal([]byte(`{
+				"pending": {
+					"0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C": {
+						"6": {"hash": "0x66", "nonce": "0x6", "gas": "0x5208", "gasPrice": "0x0"},
+						"5": {"hash": "0x55", "nonce": "0x5", "to": "0x1234", "gas": "0x5208"}
+					},
+					"0x0000000000000000000000000000000000000001": {
+						"1": {"hash": "0x11", "nonce": "0x1", "gas": "0x5208"}
+					}
+				},
+				"queued": {
+					"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c": {
+						"9": {"hash": "0x99", "nonce": "0x9", "gas": "0x5208"}
+					}
+				}
+			}`), result)
+		},
+	}
+
+	content, err := GetTxPoolContent(context.Background(), &r, "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c")
+	assert.NoError(err)
+	assert.Equal("txpool_content", r.capturedMethod)
+	assert.Equal(2, len(content.Pending))
+	assert.Equal("0x55", content.Pending[0].Hash)
+	assert.Equal("0x1234", content.Pending[0].To)
+	assert.Equal("0x66", content.Pending[1].Hash)
+	assert.Equal(1, len(content.Queued))
+	assert.Equal(uint64(9), uint64(content.Queued[0].Nonce))
+}
+
+func TestGetTxPoolContentErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("the method txpool_content does not exist/is not available"),
+	}
+
+	_, err := GetTxPoolContent(context.Background(), &r, "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c")
+	assert.Regexp("txpool_content returned: the method txpool_content does not exist", err)
+}
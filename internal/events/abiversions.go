@@ -0,0 +1,172 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// upgradedContract returns the registration of a contract that has been upgraded to a new
+// implementation, so its logs are decoded with the ABI it had at the block of each log
+func (s *subscription) upgradedContract(address string) *contractregistry.ContractInfo {
+	if s.cr == nil {
+		return nil
+	}
+	info, err := s.cr.GetContractByAddress(strings.ToLower(address))
+	if err != nil || info == nil || len(info.ABIVersions) == 0 {
+		return nil
+	}
+	return info
+}
+
+// versionEvents returns the events of an ABI version keyed by ID. They are cached, as the ABI
+// stored with an ID does not change
+func (s *subscription) versionEvents(abiID string) (map[ethbinding.Hash]*ethbinding.ABIEvent, error) {
+	s.versionsMux.Lock()
+	defer s.versionsMux.Unlock()
+	if events, ok := s.versionCache[abiID]; ok {
+		return events, nil
+	}
+	deployMsg, err := s.cr.GetABI(contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: abiID}, false)
+	if err != nil {
+		return nil, err
+	}
+	if deployMsg == nil || deployMsg.Contract == nil {
+		return nil, errors.Errorf(errors.EventStreamsABIVersionNotFound, abiID)
+	}
+	events := make(map[ethbinding.Hash]*ethbinding.ABIEvent)
+	for idx := range deployMsg.Contract.ABI {
+		if deployMsg.Contract.ABI[idx].Type != "event" {
+			continue
+		}
+		e, err := ethbind.API.ABIElementMarshalingToABIEvent(&deployMsg.Contract.ABI[idx])
+		if err != nil {
+			return nil, err
+		}
+		if e != nil && !e.Anonymous {
+			events[e.ID] = e
+		}
+	}
+	if s.versionCache == nil {
+		s.versionCache = make(map[string]map[ethbinding.Hash]*ethbinding.ABIEvent)
+	}
+	s.versionCache[abiID] = events
+	return events, nil
+}
+
+// matchesVersionedEvent is true if an event of an ABI version is one the subscription
+// listens for - any event for a subscription to all the events of a contract, otherwise
+// an event with the same name as the event of the subscription
+func (s *subscription) matchesVersionedEvent(event *ethbinding.ABIEvent) bool {
+	if s.lp.events != nil {
+		return true
+	}
+	return s.lp.event != nil && !s.lp.event.Anonymous && event.Name == s.lp.event.Name
+}
+
+// versionedEvent returns the event to decode a log with, from the ABI of the contract that emitted
+// it at the block of the log. Nil if the contract has not been upgraded, or that ABI does not declare
+// a matching event, in which case the log is decoded with the event of the subscription
+func (s *subscription) versionedEvent(entry *logEntry) *ethbinding.ABIEvent {
+	if len(entry.Topics) == 0 || entry.Topics[0] == nil {
+		return nil
+	}
+	info := s.upgradedContract(entry.Address.String())
+	if info == nil {
+		return nil
+	}
+	abiID := info.ABIAtBlock(entry.BlockNumber.ToInt())
+	events, err := s.versionEvents(abiID)
+	if err != nil {
+		log.Warnf("%s: Failed to load ABI %s of %s: %s", s.logName, abiID, entry.Address.String(), err)
+		return nil
+	}
+	if event, ok := events[*entry.Topics[0]]; ok && s.matchesVersionedEvent(event) {
+		return event
+	}
+	return nil
+}
+
+// versionedFilter returns the filter of the subscription, with the IDs of the matching events of
+// every ABI version of the contracts it is filtered to added to the first topic. Logs emitted
+// before or after an upgrade that changed the definition of an event still match the filter
+func (s *subscription) versionedFilter() persistedFilter {
+	f := s.info.Filter
+	if len(f.Topics) == 0 || len(f.Addresses) == 0 || (s.lp.events == nil && (s.lp.event == nil || s.lp.event.Anonymous)) {
+		return f
+	}
+	seen := make(map[ethbinding.Hash]bool)
+	for _, id := range f.Topics[0] {
+		seen[id] = true
+	}
+	var added []ethbinding.Hash
+	for _, addr := range f.Addresses {
+		info := s.upgradedContract(addr.String())
+		if info == nil {
+			continue
+		}
+		for _, abiID := range info.ABIVersionIDs() {
+			events, err := s.versionEvents(abiID)
+			if err != nil {
+				log.Warnf("%s: Failed to load ABI %s of %s: %s", s.logName, abiID, addr.String(), err)
+				continue
+			}
+			for id, event := range events {
+				if !seen[id] && s.matchesVersionedEvent(event) {
+					seen[id] = true
+					added = append(added, id)
+				}
+			}
+		}
+	}
+	if len(added) == 0 {
+		return f
+	}
+	sort.Slice(added, func(a, b int) bool { return added[a].Hex() < added[b].Hex() })
+	topics := make([][]ethbinding.Hash, len(f.Topics))
+	copy(topics, f.Topics)
+	topics[0] = append(append([]ethbinding.Hash{}, f.Topics[0]...), added...)
+	f.Topics = topics
+	return f
+}
+
+// filtersAddress is true if the subscription is filtered to the address of a contract
+func (s *subscription) filtersAddress(address string) bool {
+	for _, addr := range s.info.Filter.Addresses {
+		if strings.EqualFold(strings.TrimPrefix(addr.String(), "0x"), strings.TrimPrefix(address, "0x")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContractUpgraded recreates the filters of the subscriptions to a contract that has been upgraded,
+// so they match the events of the new implementation from the next polling cycle
+func (s *subscriptionMGR) ContractUpgraded(ctx context.Context, address string) {
+	for _, sub := range s.allSubscriptions() {
+		if !sub.isBlocks() && !sub.isPendingTransactions() && sub.filtersAddress(address) {
+			log.Infof("%s: Recreating filter for upgraded contract %s", sub.logName, address)
+			_ = sub.unsubscribe(ctx, false)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testUpgradedAddr = "0x19e75d0d337e17835dc5246f007a1fb17f0bac89"
+
+var (
+	testChangedV1 = ethbinding.ABIElementMarshaling{
+		Type: "event", Name: "Changed",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256", Indexed: true}},
+	}
+	testChangedV2 = ethbinding.ABIElementMarshaling{
+		Type: "event", Name: "Changed",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "uint256", Indexed: true}, {Name: "by", Type: "address", Indexed: true}},
+	}
+	testPausedV2 = ethbinding.ABIElementMarshaling{Type: "event", Name: "Paused"}
+)
+
+func testABIEvent(t *testing.T, e ethbinding.ABIElementMarshaling) *ethbinding.ABIEvent {
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&e)
+	assert.NoError(t, err)
+	return event
+}
+
+func newTestUpgradedContractResolver() *contractregistrymocks.ContractStore {
+	cr := &contractregistrymocks.ContractStore{}
+	cr.On("GetContractByAddress", testUpgradedAddr).Return(&contractregistry.ContractInfo{
+		Address: testUpgradedAddr[2:],
+		ABI:     "abi2",
+		ABIVersions: []*contractregistry.ABIVersion{
+			{ABI: "abi1", FromBlock: "0"},
+			{ABI: "abi2", FromBlock: "100"},
+		},
+	}, nil)
+	cr.On("GetContractByAddress", mock.Anything).Return(nil, fmt.Errorf("not found"))
+	cr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{testChangedV1, {Type: "function", Name: "set"}}},
+	}, nil)
+	cr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi2"}, false).Return(&contractregistry.DeployContractWithAddress{
+		Contract: &messages.DeployContract{ABI: ethbinding.ABIMarshaling{testChangedV2, testPausedV2}},
+	}, nil)
+	return cr
+}
+
+func testUpgradedLog(blockNumber int64, topic ethbinding.Hash, address string) *logEntry {
+	entry := &logEntry{
+		Address: ethbind.API.HexToAddress(address),
+		Topics:  []*ethbinding.Hash{&topic},
+	}
+	entry.BlockNumber.ToInt().SetInt64(blockNumber)
+	return entry
+}
+
+func TestVersionedEvent(t *testing.T) {
+	assert := assert.New(t)
+	cr := newTestUpgradedContractResolver()
+	v1 := testABIEvent(t, testChangedV1)
+	v2 := testABIEvent(t, testChangedV2)
+	s := &subscription{cr: cr, lp: newLogProcessor("sub1", v1, nil)}
+
+	event := s.versionedEvent(testUpgradedLog(50, v1.ID, testUpgradedAddr))
+	assert.Equal(v1.ID, event.ID)
+	event = s.versionedEvent(testUpgradedLog(150, v2.ID, testUpgradedAddr))
+	assert.Equal(v2.ID, event.ID)
+	assert.Equal(2, len(event.Inputs))
+
+	// Decoding uses the resolved event, rather than the event of the subscription
+	entry := testUpgradedLog(150, v2.ID, testUpgradedAddr)
+	entry.event = event
+	event, err := s.lp.logEvent("sub1", entry)
+	assert.NoError(err)
+	assert.Equal(v2.ID, event.ID)
+
+	// The event of the version at the block must match the topic
+	assert.Nil(s.versionedEvent(testUpgradedLog(50, v2.ID, testUpgradedAddr)))
+	// Other events are not decoded for a subscription to one event
+	assert.Nil(s.versionedEvent(testUpgradedLog(150, testABIEvent(t, testPausedV2).ID, testUpgradedAddr)))
+	// Contracts that are not registered, or not upgraded, use the event of the subscription
+	assert.Nil(s.versionedEvent(testUpgradedLog(150, v2.ID, "0x0123456789abcdef0123456789abcdef01234567")))
+	assert.Nil(s.versionedEvent(&logEntry{}))
+	assert.Nil((&subscription{lp: s.lp}).versionedEvent(testUpgradedLog(150, v2.ID, testUpgradedAddr)))
+
+	// The ABI of each version is only loaded once
+	cr.AssertNumberOfCalls(t, "GetABI", 2)
+}
+
+func TestVersionedEventAllEvents(t *testing.T) {
+	assert := assert.New(t)
+	cr := newTestUpgradedContractResolver()
+	v1 := testABIEvent(t, testChangedV1)
+	s := &subscription{cr: cr, lp: newLogProcessor("sub1", nil, nil)}
+	s.lp.events = map[ethbinding.Hash]*ethbinding.ABIEvent{v1.ID: v1}
+
+	paused := testABIEvent(t, testPausedV2)
+	event := s.versionedEvent(testUpgradedLog(150, paused.ID, testUpgradedAddr))
+	assert.Equal("Paused", event.Name)
+}
+
+func TestVersionedEventLoadABIFail(t *testing.T) {
+	assert := assert.New(t)
+	cr := &contractregistrymocks.ContractStore{}
+	cr.On("GetContractByAddress", testUpgradedAddr).Return(&contractregistry.ContractInfo{
+		ABI:         "abi2",
+		ABIVersions: []*contractregistry.ABIVersion{{ABI: "abi1", FromBlock: "0"}, {ABI: "abi2", FromBlock: "100"}},
+	}, nil)
+	cr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi1"}, false).Return(nil, fmt.Errorf("pop"))
+	cr.On("GetABI", contractregistry.ABILocation{ABIType: contractregistry.LocalABI, Name: "abi2"}, false).Return(nil, nil)
+	v1 := testABIEvent(t, testChangedV1)
+	s := &subscription{cr: cr, lp: newLogProcessor("sub1", v1, nil)}
+
+	assert.Nil(s.versionedEvent(testUpgradedLog(50, v1.ID, testUpgradedAddr)))
+	_, err := s.versionEvents("abi2")
+	assert.Regexp("FFEC100363", err)
+
+	s.info = &SubscriptionInfo{Filter: persistedFilter{
+		Addresses: []ethbinding.Address{ethbind.API.HexToAddress(testUpgradedAddr)},
+		Topics:    [][]ethbinding.Hash{{v1.ID}},
+	}}
+	assert.Equal(s.info.Filter, s.versionedFilter())
+}
+
+func TestVersionedFilter(t *testing.T) {
+	assert := assert.New(t)
+	cr := newTestUpgradedContractResolver()
+	v1 := testABIEvent(t, testChangedV1)
+	v2 := testABIEvent(t, testChangedV2)
+	paused := testABIEvent(t, testPausedV2)
+	indexed := ethbind.API.HexToHash("0x01")
+	s := &subscription{
+		cr: cr,
+		lp: newLogProcessor("sub1", v1, nil),
+		info: &SubscriptionInfo{Filter: persistedFilter{
+			Addresses: []ethbinding.Address{ethbind.API.HexToAddress(testUpgradedAddr)},
+			Topics:    [][]ethbinding.Hash{{v1.ID}, {indexed}},
+		}},
+	}
+
+	f := s.versionedFilter()
+	assert.Equal([]ethbinding.Hash{v1.ID, v2.ID}, f.Topics[0])
+	assert.Equal([]ethbinding.Hash{indexed}, f.Topics[1])
+	// The persisted filter is not changed
+	assert.Equal([]ethbinding.Hash{v1.ID}, s.info.Filter.Topics[0])
+
+	// A subscription to all events matches every event of every version
+	s.lp = newLogProcessor("sub1", nil, nil)
+	s.lp.events = map[ethbinding.Hash]*ethbinding.ABIEvent{v1.ID: v1}
+	s.info.Filter.Topics = [][]ethbinding.Hash{{v1.ID}}
+	f = s.versionedFilter()
+	assert.Equal(3, len(f.Topics[0]))
+	assert.Contains(f.Topics[0], v2.ID)
+	assert.Contains(f.Topics[0], paused.ID)
+
+	// Subscriptions to any address are not changed
+	s.info.Filter.Addresses = nil
+	assert.Equal([]ethbinding.Hash{v1.ID}, s.versionedFilter().Topics[0])
+	s.info.Filter.Addresses = []ethbinding.Address{ethbind.API.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")}
+	assert.Equal([]ethbinding.Hash{v1.ID}, s.versionedFilter().Topics[0])
+}
+
+func TestContractUpgradedRecreatesFilters(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_uninstallFilter", mock.Anything).Return(nil)
+	newSub := func(addr string) *subscription {
+		s := &subscription{
+			rpc:     rpc,
+			logName: addr,
+			info: &SubscriptionInfo{Filter: persistedFilter{
+				Addresses: []ethbinding.Address{ethbind.API.HexToAddress(addr)},
+			}},
+		}
+		s.filterID.ToInt().SetInt64(1)
+		return s
+	}
+	upgraded := newSub(testUpgradedAddr)
+	other := newSub("0x0123456789abcdef0123456789abcdef01234567")
+	sm := &subscriptionMGR{subscriptions: map[string]*subscription{"sub1": upgraded, "sub2": other}}
+
+	sm.ContractUpgraded(context.Background(), "0x19E75D0D337E17835DC5246F007A1FB17F0BAC89")
+	assert.True(upgraded.filterStale)
+	assert.False(other.filterStale)
+	rpc.AssertNumberOfCalls(t, "CallContext", 1)
+	assert.Equal(big.NewInt(1), upgraded.filterID.ToInt())
+}
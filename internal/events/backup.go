@@ -0,0 +1,353 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// EventsBackup is a single document with the definitions of all event streams and subscriptions,
+// and the block each subscription has processed up to on each stream. It is exported from one
+// gateway and imported into a fresh one, to rebuild it without replaying all events
+type EventsBackup struct {
+	Streams       []*StreamInfo                  `json:"streams"`
+	Subscriptions []*SubscriptionInfo            `json:"subscriptions"`
+	Checkpoints   map[string]map[string]*big.Int `json:"checkpoints"`
+}
+
+// EventsImportResult summarizes the records imported from a backup
+type EventsImportResult struct {
+	Streams       int `json:"streams"`
+	Subscriptions int `json:"subscriptions"`
+	Checkpoints   int `json:"checkpoints"`
+	Existing      int `json:"existing"`
+}
+
+// EventsBackupConf configures an export or import of the event streams database, while the gateway is stopped
+type EventsBackupConf struct {
+	EventsDBPath string `json:"eventsDB"`
+	File         string `json:"file,omitempty"`
+}
+
+// EventsBackupTool exports and imports the event streams database from the commandline
+type EventsBackupTool struct {
+	conf EventsBackupConf
+}
+
+// NewEventsBackupTool constructor
+func NewEventsBackupTool() *EventsBackupTool {
+	return &EventsBackupTool{}
+}
+
+// ExportEvents returns the definitions and checkpoints of all streams and subscriptions.
+// Literal webhook secrets are redacted, as the export is returned by the API, and must
+// be set again before the backup can be imported
+func (s *subscriptionMGR) ExportEvents(ctx context.Context) (*EventsBackup, error) {
+	backup, err := exportEvents(s.db)
+	if err != nil {
+		return nil, err
+	}
+	for i, spec := range backup.Streams {
+		backup.Streams[i] = redactStreamSecrets(spec)
+	}
+	return backup, nil
+}
+
+// ImportEvents creates the streams and subscriptions in a backup that do not already exist,
+// keeping their IDs. Subscriptions continue from the block in their checkpoint.
+// Every stream and subscription is validated before any of them is stored, so an invalid
+// backup is rejected without leaving records behind that fail again on every restart
+func (s *subscriptionMGR) ImportEvents(ctx context.Context, backup *EventsBackup) (*EventsImportResult, error) {
+	result, specs, infos, err := planImport(s.db, backup)
+	if err != nil {
+		return nil, err
+	}
+	streams := make(map[string]*eventStream, len(specs))
+	for _, spec := range specs {
+		stream, err := buildEventStream(s, spec, s.wsChannels)
+		if err != nil {
+			return nil, errors.Errorf(errors.EventStreamsBackupInvalidStream, spec.ID, err)
+		}
+		streams[spec.ID] = stream
+	}
+	subs := make([]*subscription, 0, len(infos))
+	for _, info := range infos {
+		stream, exists := streams[info.Stream]
+		if !exists {
+			if stream, err = s.streamByID(info.Stream); err != nil {
+				return nil, errors.Errorf(errors.EventStreamsBackupInvalidSubscription, info.ID, err)
+			}
+		}
+		sub, err := restoreSubscriptionOnStream(s, s.rpc, s.cr, stream, info)
+		if err != nil {
+			return nil, errors.Errorf(errors.EventStreamsBackupInvalidSubscription, info.ID, err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := storeImport(s.db, backup, specs, infos); err != nil {
+		return nil, err
+	}
+	for _, spec := range specs {
+		stream := streams[spec.ID]
+		stream.startEventHandlers(false)
+		s.putStream(stream)
+	}
+	for _, sub := range subs {
+		s.putSubscription(sub)
+	}
+	log.Infof("Imported %d streams, %d subscriptions and %d checkpoints. Existing=%d", result.Streams, result.Subscriptions, result.Checkpoints, result.Existing)
+	return result, nil
+}
+
+func exportEvents(db kvstore.KVStore) (*EventsBackup, error) {
+	backup := &EventsBackup{
+		Streams:       []*StreamInfo{},
+		Subscriptions: []*SubscriptionInfo{},
+		Checkpoints:   make(map[string]map[string]*big.Int),
+	}
+	it := db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		k := it.Key()
+		var err error
+		switch {
+		case strings.HasPrefix(k, streamIDPrefix):
+			var spec StreamInfo
+			if err = json.Unmarshal(it.Value(), &spec); err == nil {
+				backup.Streams = append(backup.Streams, &spec)
+			}
+		case strings.HasPrefix(k, subIDPrefix):
+			var info SubscriptionInfo
+			if err = json.Unmarshal(it.Value(), &info); err == nil {
+				backup.Subscriptions = append(backup.Subscriptions, &info)
+			}
+		case strings.HasPrefix(k, checkpointIDPrefix):
+			var checkpoint map[string]*big.Int
+			if err = json.Unmarshal(it.Value(), &checkpoint); err == nil {
+				backup.Checkpoints[strings.TrimPrefix(k, checkpointIDPrefix)] = checkpoint
+			}
+		}
+		if err != nil {
+			log.Errorf("Failed to export '%s': %s", k, err)
+			return nil, err
+		}
+	}
+	log.Infof("Exported %d streams and %d subscriptions", len(backup.Streams), len(backup.Subscriptions))
+	return backup, nil
+}
+
+func existsInDB(db kvstore.KVStore, id string) bool {
+	_, err := db.Get(id)
+	return err == nil
+}
+
+// importEvents stores the streams and subscriptions in a backup that are not already in the database,
+// and returns them
+func importEvents(db kvstore.KVStore, backup *EventsBackup) (*EventsImportResult, []*StreamInfo, []*SubscriptionInfo, error) {
+	result, streams, subs, err := planImport(db, backup)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := storeImport(db, backup, streams, subs); err != nil {
+		return nil, nil, nil, err
+	}
+	log.Infof("Imported %d streams, %d subscriptions and %d checkpoints. Existing=%d", result.Streams, result.Subscriptions, result.Checkpoints, result.Existing)
+	return result, streams, subs, nil
+}
+
+// planImport checks the IDs and secrets in a backup, and returns the streams and subscriptions
+// that are not already in the database. Subscriptions added to an existing stream start from
+// their checkpoint block
+func planImport(db kvstore.KVStore, backup *EventsBackup) (*EventsImportResult, []*StreamInfo, []*SubscriptionInfo, error) {
+	streamIDs := make(map[string]bool)
+	for _, spec := range backup.Streams {
+		if !strings.HasPrefix(spec.ID, streamIDPrefix) {
+			return nil, nil, nil, errors.Errorf(errors.EventStreamsBackupInvalidID, spec.ID)
+		}
+		if field := redactedSecretField(spec); field != "" {
+			return nil, nil, nil, errors.Errorf(errors.EventStreamsBackupRedactedSecret, spec.ID, field)
+		}
+		streamIDs[spec.ID] = true
+	}
+	for _, info := range backup.Subscriptions {
+		if !strings.HasPrefix(info.ID, subIDPrefix) {
+			return nil, nil, nil, errors.Errorf(errors.EventStreamsBackupInvalidID, info.ID)
+		}
+		if !streamIDs[info.Stream] && !existsInDB(db, info.Stream) {
+			return nil, nil, nil, errors.Errorf(errors.EventStreamsBackupMissingStream, info.ID, info.Stream)
+		}
+	}
+
+	result := &EventsImportResult{}
+	streams := make([]*StreamInfo, 0, len(backup.Streams))
+	newStreams := make(map[string]bool)
+	for _, spec := range backup.Streams {
+		if existsInDB(db, spec.ID) {
+			log.Infof("Stream %s already exists", spec.ID)
+			result.Existing++
+			continue
+		}
+		result.Checkpoints += len(backup.Checkpoints[spec.ID])
+		newStreams[spec.ID] = true
+		streams = append(streams, spec)
+		result.Streams++
+	}
+
+	subs := make([]*SubscriptionInfo, 0, len(backup.Subscriptions))
+	for _, info := range backup.Subscriptions {
+		if existsInDB(db, info.ID) {
+			log.Infof("Subscription %s already exists", info.ID)
+			result.Existing++
+			continue
+		}
+		if blockHeight, exists := backup.Checkpoints[info.Stream][info.ID]; exists && !newStreams[info.Stream] && blockHeight != nil {
+			info.FromBlock = blockHeight.Text(10)
+		}
+		subs = append(subs, info)
+		result.Subscriptions++
+	}
+	return result, streams, subs, nil
+}
+
+// storeImport writes the planned streams and subscriptions of a backup to the database.
+// The checkpoint of each new stream is stored before the stream, so its poller starts
+// from the checkpoint
+func storeImport(db kvstore.KVStore, backup *EventsBackup, streams []*StreamInfo, subs []*SubscriptionInfo) error {
+	for _, spec := range streams {
+		if checkpoint := backup.Checkpoints[spec.ID]; len(checkpoint) > 0 {
+			b, _ := json.MarshalIndent(&checkpoint, "", "  ")
+			if err := db.Put(checkpointIDPrefix+spec.ID, b); err != nil {
+				return err
+			}
+		}
+		b, _ := json.MarshalIndent(spec, "", "  ")
+		if err := db.Put(spec.ID, b); err != nil {
+			return errors.Errorf(errors.EventStreamsCreateStreamStoreFailed, err)
+		}
+	}
+	for _, info := range subs {
+		b, _ := json.MarshalIndent(info, "", "  ")
+		if err := db.Put(info.ID, b); err != nil {
+			return errors.Errorf(errors.EventStreamsSubscribeStoreFailed, err)
+		}
+	}
+	return nil
+}
+
+// CobraInit initializes the events command, with export and import subcommands
+func (t *EventsBackupTool) CobraInit() (cmd *cobra.Command) {
+	cmd = &cobra.Command{
+		Use:   "events",
+		Short: "Export or import the event streams, subscriptions and checkpoints of a stopped gateway",
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all event streams, subscriptions and checkpoints as a single JSON document",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			return t.Export()
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			return t.ValidateConf()
+		},
+	}
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import the event streams, subscriptions and checkpoints from an exported JSON document",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			_, err = t.Import()
+			return
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			return t.ValidateConf()
+		},
+	}
+	for _, subCmd := range []*cobra.Command{exportCmd, importCmd} {
+		subCmd.Flags().StringVarP(&t.conf.EventsDBPath, "events-db", "", "", "Level DB location of the event streams")
+		subCmd.Flags().StringVarP(&t.conf.File, "file", "f", "", "JSON file of the backup (default stdout for export, stdin for import)")
+		cmd.AddCommand(subCmd)
+	}
+	return
+}
+
+// SetConf sets the configuration
+func (t *EventsBackupTool) SetConf(conf *EventsBackupConf) {
+	t.conf = *conf
+}
+
+// ValidateConf validates the configuration
+func (t *EventsBackupTool) ValidateConf() error {
+	if t.conf.EventsDBPath == "" {
+		return errors.Errorf(errors.EventStreamsBackupNoDB)
+	}
+	return nil
+}
+
+// Export writes the backup of the event streams database to the file, or stdout
+func (t *EventsBackupTool) Export() error {
+	db, err := kvstore.NewLDBKeyValueStore(t.conf.EventsDBPath)
+	if err != nil {
+		return errors.Errorf(errors.EventStreamsDBLoad, t.conf.EventsDBPath, err)
+	}
+	defer db.Close()
+	backup, err := exportEvents(db)
+	if err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(backup, "", "  ")
+	if t.conf.File == "" {
+		_, err = os.Stdout.Write(append(b, '\n'))
+		return err
+	}
+	if err := ioutil.WriteFile(t.conf.File, b, 0600); err != nil {
+		return errors.Errorf(errors.EventStreamsBackupFileFailed, t.conf.File, err)
+	}
+	return nil
+}
+
+// Import reads a backup from the file, or stdin, into the event streams database
+func (t *EventsBackupTool) Import() (*EventsImportResult, error) {
+	var b []byte
+	var err error
+	if t.conf.File == "" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(t.conf.File)
+	}
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsBackupFileFailed, t.conf.File, err)
+	}
+	var backup EventsBackup
+	if err := json.Unmarshal(b, &backup); err != nil {
+		return nil, errors.Errorf(errors.EventStreamsBackupFileFailed, t.conf.File, err)
+	}
+	db, err := kvstore.NewLDBKeyValueStore(t.conf.EventsDBPath)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsDBLoad, t.conf.EventsDBPath, err)
+	}
+	defer db.Close()
+	result, _, _, err := importEvents(db, &backup)
+	return result, err
+}
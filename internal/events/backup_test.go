@@ -0,0 +1,243 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportEvents(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestCheckpointSubscription(assert)
+	defer sm.Close(false)
+	ctx := context.Background()
+	sm.storeCheckpoint(stream.ID, map[string]*big.Int{sub.ID: big.NewInt(12345)})
+
+	backup, err := sm.ExportEvents(ctx)
+	assert.NoError(err)
+	assert.Equal(1, len(backup.Streams))
+	assert.Equal(stream.ID, backup.Streams[0].ID)
+	assert.Equal(1, len(backup.Subscriptions))
+	assert.Equal(sub.ID, backup.Subscriptions[0].ID)
+	assert.Equal(int64(12345), backup.Checkpoints[stream.ID][sub.ID].Int64())
+
+	sm2 := newTestSubscriptionManager()
+	defer sm2.Close(false)
+	result, err := sm2.ImportEvents(ctx, backup)
+	assert.NoError(err)
+	assert.Equal(&EventsImportResult{Streams: 1, Subscriptions: 1, Checkpoints: 1}, result)
+	assert.NotNil(sm2.streams[stream.ID])
+	assert.NotNil(sm2.subscriptions[sub.ID])
+	assert.Equal(stream.ID, sm2.subscriptions[sub.ID].info.Stream)
+	checkpoint, err := sm2.loadCheckpoint(stream.ID)
+	assert.NoError(err)
+	assert.Equal(int64(12345), checkpoint[sub.ID].Int64())
+
+	result, err = sm2.ImportEvents(ctx, backup)
+	assert.NoError(err)
+	assert.Equal(&EventsImportResult{Existing: 2}, result)
+}
+
+func TestExportImportEventsRedactedSecret(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close(false)
+	ctx := context.Background()
+	spec := &StreamInfo{
+		ID:      "es-webhook",
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://example.com", HMACSecret: "secret1"},
+	}
+	b, _ := json.Marshal(spec)
+	sm.db.Put(spec.ID, b)
+
+	backup, err := sm.ExportEvents(ctx)
+	assert.NoError(err)
+	assert.Equal("***", backup.Streams[0].Webhook.HMACSecret)
+
+	sm2 := newTestSubscriptionManager()
+	defer sm2.Close(false)
+	_, err = sm2.ImportEvents(ctx, backup)
+	assert.Regexp("FFEC100407.*es-webhook.*webhook.hmacSecret", err)
+	assert.Nil(sm2.streams[spec.ID])
+	_, err = sm2.db.Get(spec.ID)
+	assert.Error(err)
+
+	backup.Streams[0].Webhook.HMACSecret = "secret1"
+	result, err := sm2.ImportEvents(ctx, backup)
+	assert.NoError(err)
+	assert.Equal(1, result.Streams)
+	assert.Equal("secret1", sm2.streams[spec.ID].spec.Webhook.HMACSecret)
+}
+
+func TestImportEventsExistingStream(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestCheckpointSubscription(assert)
+	defer sm.Close(false)
+	ctx := context.Background()
+
+	backup := &EventsBackup{
+		Subscriptions: []*SubscriptionInfo{
+			{ID: "sb-imported", Stream: stream.ID, Event: &ethbinding.ABIElementMarshaling{Name: "ping"}},
+		},
+		Checkpoints: map[string]map[string]*big.Int{
+			stream.ID: {"sb-imported": big.NewInt(12345)},
+		},
+	}
+	result, err := sm.ImportEvents(ctx, backup)
+	assert.NoError(err)
+	assert.Equal(&EventsImportResult{Subscriptions: 1}, result)
+	assert.Equal("12345", sm.subscriptions["sb-imported"].info.FromBlock)
+}
+
+func TestImportEventsInvalid(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close(false)
+	ctx := context.Background()
+
+	_, err := sm.ImportEvents(ctx, &EventsBackup{Streams: []*StreamInfo{{ID: "bad"}}})
+	assert.Regexp("Invalid ID 'bad' in event streams backup", err)
+
+	_, err = sm.ImportEvents(ctx, &EventsBackup{Subscriptions: []*SubscriptionInfo{{ID: "bad"}}})
+	assert.Regexp("Invalid ID 'bad' in event streams backup", err)
+
+	_, err = sm.ImportEvents(ctx, &EventsBackup{Subscriptions: []*SubscriptionInfo{{ID: "sb-1", Stream: "es-1"}}})
+	assert.Regexp("Subscription 'sb-1' in event streams backup is for stream 'es-1' that does not exist", err)
+
+	_, err = sm.ImportEvents(ctx, &EventsBackup{Streams: []*StreamInfo{{ID: "es-1", Type: "wrong"}}})
+	assert.Regexp("Stream 'es-1' in event streams backup is invalid.*Unknown action type 'wrong'", err)
+	assert.False(existsInDB(sm.db, "es-1"))
+
+	_, err = sm.ImportEvents(ctx, &EventsBackup{
+		Streams: []*StreamInfo{{ID: "es-1", Type: "webhook", Webhook: &webhookActionInfo{URL: "http://example.com"}}},
+		Subscriptions: []*SubscriptionInfo{{ID: "sb-1", Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{
+			Name:   "ping",
+			Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "badtype"}},
+		}}},
+		Checkpoints: map[string]map[string]*big.Int{"es-1": {"sb-1": big.NewInt(1)}},
+	})
+	assert.Regexp("Subscription 'sb-1' in event streams backup is invalid", err)
+	assert.False(existsInDB(sm.db, "es-1"))
+	assert.False(existsInDB(sm.db, checkpointIDPrefix+"es-1"))
+	assert.Nil(sm.streams["es-1"])
+
+	sm.db.Put("es-2", []byte("{}"))
+	_, err = sm.ImportEvents(ctx, &EventsBackup{Subscriptions: []*SubscriptionInfo{{ID: "sb-1", Stream: "es-2"}}})
+	assert.Regexp("Subscription 'sb-1' in event streams backup is invalid.*not found", err)
+	assert.False(existsInDB(sm.db, "sb-1"))
+}
+
+func TestImportEventsStoreFail(t *testing.T) {
+	assert := assert.New(t)
+	db := kvstore.NewMockKV(fmt.Errorf("pop"))
+
+	_, _, _, err := importEvents(db, &EventsBackup{
+		Streams:     []*StreamInfo{{ID: "es-1"}},
+		Checkpoints: map[string]map[string]*big.Int{"es-1": {"sb-1": big.NewInt(1)}},
+	})
+	assert.Regexp("pop", err)
+
+	_, _, _, err = importEvents(db, &EventsBackup{Streams: []*StreamInfo{{ID: "es-1"}}})
+	assert.Regexp("Failed to store stream: pop", err)
+
+	db.KVS["es-1"] = []byte("{}")
+	db.LoadErr = nil
+	_, _, _, err = importEvents(db, &EventsBackup{Subscriptions: []*SubscriptionInfo{{ID: "sb-1", Stream: "es-1"}}})
+	assert.Regexp("Failed to store subscription: pop", err)
+}
+
+func TestExportEventsBadRecord(t *testing.T) {
+	assert := assert.New(t)
+	for _, id := range []string{"es-1", "sb-1", "cp-es-1"} {
+		db := kvstore.NewMockKV(nil)
+		db.KVS[id] = []byte("!json")
+		_, err := exportEvents(db)
+		assert.Regexp("invalid character", err)
+	}
+}
+
+func TestEventsBackupToolExportImport(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, err := kvstore.NewLDBKeyValueStore(path.Join(dir, "source"))
+	assert.NoError(err)
+	db.Put("es-1", []byte(`{"id":"es-1","type":"webhook"}`))
+	db.Put("sb-1", []byte(`{"id":"sb-1","stream":"es-1"}`))
+	db.Put("cp-es-1", []byte(`{"sb-1":12345}`))
+	db.Close()
+
+	tool := NewEventsBackupTool()
+	tool.SetConf(&EventsBackupConf{EventsDBPath: path.Join(dir, "source"), File: path.Join(dir, "backup.json")})
+	err = tool.Export()
+	assert.NoError(err)
+
+	tool.SetConf(&EventsBackupConf{EventsDBPath: path.Join(dir, "target"), File: path.Join(dir, "backup.json")})
+	result, err := tool.Import()
+	assert.NoError(err)
+	assert.Equal(&EventsImportResult{Streams: 1, Subscriptions: 1, Checkpoints: 1}, result)
+
+	db, err = kvstore.NewLDBKeyValueStore(path.Join(dir, "target"))
+	assert.NoError(err)
+	defer db.Close()
+	b, err := db.Get("cp-es-1")
+	assert.NoError(err)
+	assert.JSONEq(`{"sb-1":12345}`, string(b))
+	_, err = db.Get("sb-1")
+	assert.NoError(err)
+}
+
+func TestEventsBackupToolErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	tool := NewEventsBackupTool()
+	cmd := tool.CobraInit()
+	assert.Equal(2, len(cmd.Commands()))
+	assert.Regexp("The --events-db location of the event streams database must be specified", tool.ValidateConf())
+
+	tool.SetConf(&EventsBackupConf{EventsDBPath: path.Join(dir, "db"), File: path.Join(dir, "missing", "backup.json")})
+	assert.NoError(tool.ValidateConf())
+	err := tool.Export()
+	assert.Regexp("Failed to access event streams backup file", err)
+	_, err = tool.Import()
+	assert.Regexp("Failed to access event streams backup file", err)
+
+	ioutil.WriteFile(path.Join(dir, "bad.json"), []byte("!json"), 0600)
+	tool.SetConf(&EventsBackupConf{EventsDBPath: path.Join(dir, "db"), File: path.Join(dir, "bad.json")})
+	_, err = tool.Import()
+	assert.Regexp("Failed to access event streams backup file", err)
+
+	ioutil.WriteFile(path.Join(dir, "notadir"), []byte("{}"), 0600)
+	tool.SetConf(&EventsBackupConf{EventsDBPath: path.Join(dir, "notadir"), File: path.Join(dir, "bad.json")})
+	err = tool.Export()
+	assert.Regexp("Failed to open DB", err)
+	ioutil.WriteFile(path.Join(dir, "bad.json"), []byte("{}"), 0600)
+	_, err = tool.Import()
+	assert.Regexp("Failed to open DB", err)
+}
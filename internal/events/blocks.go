@@ -0,0 +1,136 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SubscriptionTypeEvents is the default type of subscription, which delivers the events that match its filter
+	SubscriptionTypeEvents = "events"
+	// SubscriptionTypeBlocks is a subscription that delivers the header of every block, in order
+	SubscriptionTypeBlocks = "blocks"
+)
+
+// blockHeader is the subset of the fields of a block that are delivered for a subscription to blocks
+type blockHeader struct {
+	Number       ethbinding.HexBigInt `json:"number"`
+	Hash         ethbinding.Hash      `json:"hash"`
+	ParentHash   ethbinding.Hash      `json:"parentHash"`
+	Timestamp    ethbinding.HexBigInt `json:"timestamp"`
+	GasUsed      ethbinding.HexBigInt `json:"gasUsed"`
+	GasLimit     ethbinding.HexBigInt `json:"gasLimit"`
+	Transactions []ethbinding.Hash    `json:"transactions"`
+}
+
+// validateSubscriptionType checks the type of a subscription, and that a subscription to blocks or
+// pending transactions does not have any of the address and event that only apply to a subscription to events
+func validateSubscriptionType(i *SubscriptionInfo, addr *ethbinding.Address) error {
+	switch strings.ToLower(i.Type) {
+	case "", SubscriptionTypeEvents:
+		i.Type = strings.ToLower(i.Type)
+		return nil
+	case SubscriptionTypeBlocks:
+		i.Type = SubscriptionTypeBlocks
+		if addr != nil || i.Event != nil || len(i.Events) > 0 || len(i.IndexedFilter) > 0 {
+			return errors.Errorf(errors.EventStreamsSubscribeBlocksWithEvent)
+		}
+		return nil
+	case strings.ToLower(SubscriptionTypePendingTransactions):
+		i.Type = SubscriptionTypePendingTransactions
+		if addr != nil || i.Event != nil || len(i.Events) > 0 {
+			return errors.Errorf(errors.EventStreamsSubscribePendingWithEvent)
+		}
+		return nil
+	default:
+		return errors.Errorf(errors.EventStreamsSubscribeInvalidType, i.Type)
+	}
+}
+
+func (s *subscription) isBlocks() bool {
+	return s.info != nil && s.info.Type == SubscriptionTypeBlocks
+}
+
+// processNewBlocks delivers the header of each block from the next block of the subscription up
+// to the head of the chain. A subscription that is behind catches up a page of blocks on each poll
+func (s *subscription) processNewBlocks(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	head := ethbinding.HexBigInt{}
+	if err := s.rpc.CallContext(ctx, &head, "eth_blockNumber"); err != nil {
+		return errors.Errorf(errors.RPCCallReturnedError, "eth_blockNumber", err)
+	}
+	pageSize := s.catchupPageSize()
+	if pageSize <= 0 {
+		pageSize = 1
+	}
+	endBlock := new(big.Int).Add(s.nextBlock, big.NewInt(pageSize-1))
+	if endBlock.Cmp(head.ToInt()) > 0 {
+		endBlock.Set(head.ToInt())
+	}
+	for s.nextBlock.Cmp(endBlock) <= 0 {
+		var hdr *blockHeader
+		if err := s.rpc.CallContext(ctx, &hdr, "eth_getBlockByNumber", "0x"+s.nextBlock.Text(16), false); err != nil {
+			return errors.Errorf(errors.RPCCallReturnedError, "eth_getBlockByNumber", err)
+		}
+		if hdr == nil {
+			// The block is not available yet from the node that served the request, such as
+			// a node behind a load balancer that is behind the one that served eth_blockNumber
+			log.Debugf("%s: block %s not found", s.logName, s.nextBlock.String())
+			break
+		}
+		s.lp.processBlockHeader(s.logName, hdr)
+		s.nextBlock.Add(s.nextBlock, big.NewInt(1))
+	}
+	return nil
+}
+
+// processBlockHeader dispatches the header of a block as an event, with the fields of the header as the data
+func (lp *logProcessor) processBlockHeader(subInfo string, hdr *blockHeader) {
+	blockNumber := hdr.Number.ToInt()
+	result := &eventData{
+		BlockNumber: blockNumber.String(),
+		BlockHash:   hdr.Hash.String(),
+		SubID:       lp.subID,
+		Timestamp:   hdr.Timestamp.ToInt().String(),
+		Data: map[string]interface{}{
+			"number":           blockNumber.String(),
+			"hash":             hdr.Hash.String(),
+			"parentHash":       hdr.ParentHash.String(),
+			"timestamp":        hdr.Timestamp.ToInt().String(),
+			"gasUsed":          hdr.GasUsed.ToInt().String(),
+			"gasLimit":         hdr.GasLimit.ToInt().String(),
+			"transactionCount": strconv.Itoa(len(hdr.Transactions)),
+		},
+		batchComplete: lp.batchComplete,
+	}
+	log.Infof("%s: Dispatching block. BlockNumber=%s Hash=%s", subInfo, result.BlockNumber, result.BlockHash)
+	lp.hwnSync.Lock()
+	if blockNumber.Cmp(&lp.highestDispatched) > 0 {
+		lp.highestDispatched.Set(blockNumber)
+	}
+	lp.hwnSync.Unlock()
+	lp.dispatch(result)
+}
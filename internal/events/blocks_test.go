@@ -0,0 +1,224 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestBlocksSubscription(rpc *ethmocks.RPCClient) (*subscription, chan *eventData) {
+	events := make(chan *eventData, 10)
+	stream := &eventStream{spec: &StreamInfo{ID: "123"}, eventStream: events}
+	s := &subscription{
+		info:                &SubscriptionInfo{ID: "sub1", Type: SubscriptionTypeBlocks},
+		rpc:                 rpc,
+		lp:                  newLogProcessor("sub1", nil, stream),
+		logName:             "sub1:blocks",
+		filterStale:         true,
+		catchupModePageSize: 10,
+	}
+	return s, events
+}
+
+func mockBlockHeaders(rpc *ethmocks.RPCClient, head int64, headers map[string]*blockHeader) {
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Run(func(args mock.Arguments) {
+			res := args[1].(*ethbinding.HexBigInt)
+			res.ToInt().SetInt64(head)
+		}).
+		Return(nil)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getBlockByNumber", mock.Anything, false).
+		Run(func(args mock.Arguments) {
+			res := args[1].(**blockHeader)
+			*res = headers[args[3].(string)]
+		}).
+		Return(nil)
+}
+
+func testBlockHeader(number int64, txCount int) *blockHeader {
+	hdr := &blockHeader{
+		Hash:         ethbind.API.HexToHash(fmt.Sprintf("0x%064x", number)),
+		ParentHash:   ethbind.API.HexToHash(fmt.Sprintf("0x%064x", number-1)),
+		Transactions: make([]ethbinding.Hash, txCount),
+	}
+	hdr.Number.ToInt().SetInt64(number)
+	hdr.Timestamp.ToInt().SetInt64(1600000000 + number)
+	hdr.GasUsed.ToInt().SetInt64(21000 * int64(txCount))
+	hdr.GasLimit.ToInt().SetInt64(8000000)
+	return hdr
+}
+
+func TestCreateSubscriptionBlocks(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := &SubscriptionInfo{ID: "test", Stream: "streamID", Type: "Blocks"}
+	s, err := newSubscription(m, nil, nil, nil, i)
+	assert.NoError(err)
+	assert.Equal(SubscriptionTypeBlocks, s.info.Type)
+	assert.Equal("*:blocks", s.info.Summary)
+	assert.Equal("*:blocks", s.info.Name)
+	assert.Empty(s.info.Filter.Topics)
+	assert.True(s.isBlocks())
+
+	restored, err := restoreSubscription(m, nil, nil, s.info)
+	assert.NoError(err)
+	assert.True(restored.isBlocks())
+	assert.Equal("test:blocks", restored.logName)
+}
+
+func TestCreateSubscriptionBlocksWithEvent(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := testSubInfo(&ethbinding.ABIElementMarshaling{Name: "devent"})
+	i.Type = SubscriptionTypeBlocks
+	_, err := newSubscription(m, nil, nil, nil, i)
+	assert.Regexp("A subscription to blocks cannot have an address, event or filter", err)
+
+	addr := ethbind.API.HexToAddress("0x0123456789abcDEF0123456789abCDef01234567")
+	i = &SubscriptionInfo{ID: "test", Stream: "streamID", Type: SubscriptionTypeBlocks}
+	_, err = newSubscription(m, nil, nil, &addr, i)
+	assert.Regexp("A subscription to blocks cannot have an address, event or filter", err)
+}
+
+func TestCreateSubscriptionBadType(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := &SubscriptionInfo{ID: "test", Stream: "streamID", Type: "wrong"}
+	_, err := newSubscription(m, nil, nil, nil, i)
+	assert.Regexp("Invalid subscription type 'wrong'", err)
+}
+
+func TestAddSubscriptionDirectBlocks(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	rpc := &ethmocks.RPCClient{}
+	mockBlockHeaders(rpc, 0, map[string]*blockHeader{})
+	sm.rpc = rpc
+	sm.db, _ = kvstore.NewLDBKeyValueStore(path.Join(dir, "db"))
+	defer sm.db.Close()
+
+	ctx := context.Background()
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	})
+	assert.NoError(err)
+	defer sm.Close(false)
+
+	sub, err := sm.AddSubscriptionDirect(ctx, &SubscriptionCreateDTO{
+		Type:      "blocks",
+		Stream:    stream.ID,
+		FromBlock: "0",
+	})
+	assert.NoError(err)
+	assert.Equal(SubscriptionTypeBlocks, sub.Type)
+	assert.Equal("*:blocks", sub.Name)
+}
+
+func TestProcessNewBlocks(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	mockBlockHeaders(rpc, 101, map[string]*blockHeader{
+		"0x64": testBlockHeader(100, 2),
+		"0x65": testBlockHeader(101, 0),
+	})
+	s, events := newTestBlocksSubscription(rpc)
+
+	err := s.restartFilter(context.Background(), big.NewInt(100))
+	assert.NoError(err)
+	assert.False(s.filterStale)
+	err = s.processNewEvents(context.Background())
+	assert.NoError(err)
+	assert.Equal(int64(102), s.nextBlock.Int64())
+
+	assert.Equal(2, len(events))
+	e := <-events
+	assert.Equal("100", e.BlockNumber)
+	assert.Equal(fmt.Sprintf("0x%064x", 100), e.BlockHash)
+	assert.Equal("sub1", e.SubID)
+	assert.Equal("1600000100", e.Timestamp)
+	assert.Equal(fmt.Sprintf("0x%064x", 99), e.Data["parentHash"])
+	assert.Equal("42000", e.Data["gasUsed"])
+	assert.Equal("8000000", e.Data["gasLimit"])
+	assert.Equal("2", e.Data["transactionCount"])
+	e = <-events
+	assert.Equal("101", e.BlockNumber)
+	assert.Equal("0", e.Data["transactionCount"])
+
+	// Unsubscribing does not uninstall a filter on the node
+	err = s.unsubscribe(context.Background(), false)
+	assert.NoError(err)
+	assert.True(s.filterStale)
+	rpc.AssertExpectations(t)
+}
+
+func TestProcessNewBlocksPageAndNotFound(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	mockBlockHeaders(rpc, 1000, map[string]*blockHeader{
+		"0x1": testBlockHeader(1, 0),
+	})
+	s, events := newTestBlocksSubscription(rpc)
+	s.catchupModePageSize = 5
+
+	err := s.restartFilter(context.Background(), big.NewInt(1))
+	assert.NoError(err)
+	err = s.processNewBlocks(context.Background())
+	assert.NoError(err)
+	// Stops at the first block the node does not return, to retry it on the next poll
+	assert.Equal(int64(2), s.nextBlock.Int64())
+	assert.Equal(1, len(events))
+	rpc.AssertNumberOfCalls(t, "CallContext", 3)
+}
+
+func TestProcessNewBlocksBlockNumberFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Return(fmt.Errorf("pop"))
+	s, _ := newTestBlocksSubscription(rpc)
+	s.nextBlock = big.NewInt(0)
+
+	err := s.processNewBlocks(context.Background())
+	assert.Regexp("eth_blockNumber returned: pop", err)
+}
+
+func TestProcessNewBlocksGetBlockFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Return(nil)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getBlockByNumber", "0x0", false).
+		Return(fmt.Errorf("pop"))
+	s, _ := newTestBlocksSubscription(rpc)
+	s.nextBlock = big.NewInt(0)
+
+	err := s.processNewBlocks(context.Background())
+	assert.Regexp("eth_getBlockByNumber returned: pop", err)
+	assert.Equal(int64(0), s.nextBlock.Int64())
+}
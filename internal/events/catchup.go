@@ -0,0 +1,125 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// catchupInfo throttles the eth_getLogs queries a subscription makes while it is catching up
+// with historical blocks. It can be set on a stream, and overridden on each subscription
+type catchupInfo struct {
+	MaxBlocksPerQuery int64   `json:"maxBlocksPerQuery,omitempty"`
+	MaxQueriesPerSec  float64 `json:"maxQueriesPerSec,omitempty"`
+}
+
+// CatchupProgress reports how far a subscription in catchup mode has got through the historical blocks
+type CatchupProgress struct {
+	StartBlock      *big.Int `json:"startBlock"`
+	NextBlock       *big.Int `json:"nextBlock"`
+	TargetBlock     *big.Int `json:"targetBlock"`
+	PercentComplete float64  `json:"percentComplete"`
+}
+
+func validateCatchup(spec *catchupInfo) error {
+	if spec != nil && (spec.MaxBlocksPerQuery < 0 || spec.MaxQueriesPerSec < 0) {
+		return errors.Errorf(errors.EventStreamsCatchupInvalid)
+	}
+	return nil
+}
+
+// streamCatchup returns the catchup settings of the stream, if any
+func (s *subscription) streamCatchup() *catchupInfo {
+	if s.lp == nil || s.lp.stream == nil || s.lp.stream.spec == nil {
+		return nil
+	}
+	return s.lp.stream.spec.Catchup
+}
+
+// catchupPageSize returns the number of blocks to query at a time, from the subscription,
+// then the stream, then the global configuration
+func (s *subscription) catchupPageSize() int64 {
+	if c := s.info.Catchup; c != nil && c.MaxBlocksPerQuery > 0 {
+		return c.MaxBlocksPerQuery
+	}
+	if c := s.streamCatchup(); c != nil && c.MaxBlocksPerQuery > 0 {
+		return c.MaxBlocksPerQuery
+	}
+	return s.catchupModePageSize
+}
+
+// catchupThrottled returns true if the next catchup query must wait, to keep within the
+// maximum queries per second from the subscription or the stream. There is no limit by default
+func (s *subscription) catchupThrottled() bool {
+	maxQPS := float64(0)
+	if c := s.info.Catchup; c != nil && c.MaxQueriesPerSec > 0 {
+		maxQPS = c.MaxQueriesPerSec
+	} else if c := s.streamCatchup(); c != nil && c.MaxQueriesPerSec > 0 {
+		maxQPS = c.MaxQueriesPerSec
+	}
+	if maxQPS > 0 {
+		interval := time.Duration(float64(time.Second) / maxQPS)
+		if wait := interval - time.Since(s.lastCatchupQuery); wait > 0 {
+			log.Debugf("%s: catchup throttled for %.2fs", s.logName, wait.Seconds())
+			return true
+		}
+	}
+	s.lastCatchupQuery = time.Now()
+	return false
+}
+
+// updateCatchupProgress records the progress through catchup mode, or clears it once the
+// subscription has caught up. The target block is updated if the chain head is supplied
+func (s *subscription) updateCatchupProgress(head *big.Int) {
+	s.catchupMux.Lock()
+	defer s.catchupMux.Unlock()
+	if s.catchupBlock == nil {
+		s.catchupProgress = nil
+		return
+	}
+	p := s.catchupProgress
+	if p == nil {
+		p = &CatchupProgress{StartBlock: new(big.Int).Set(s.catchupBlock)}
+	} else {
+		p = &CatchupProgress{StartBlock: p.StartBlock, TargetBlock: p.TargetBlock}
+	}
+	p.NextBlock = new(big.Int).Set(s.catchupBlock)
+	if head != nil {
+		p.TargetBlock = new(big.Int).Set(head)
+	}
+	if p.TargetBlock != nil {
+		total := new(big.Int).Sub(p.TargetBlock, p.StartBlock)
+		done := new(big.Int).Sub(p.NextBlock, p.StartBlock)
+		if total.Sign() <= 0 || done.Cmp(total) >= 0 {
+			p.PercentComplete = 100
+		} else {
+			pct, _ := new(big.Float).Quo(new(big.Float).SetInt(done), new(big.Float).SetInt(total)).Float64()
+			p.PercentComplete = math.Floor(pct*10000) / 100
+		}
+	}
+	s.catchupProgress = p
+}
+
+// catchupStatus returns the progress through catchup mode, or nil if the subscription is not catching up
+func (s *subscription) catchupStatus() *CatchupProgress {
+	s.catchupMux.Lock()
+	defer s.catchupMux.Unlock()
+	return s.catchupProgress
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCatchupValidation(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, err := newEventStream(sm, &StreamInfo{
+		ID:      "123",
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+		Catchup: &catchupInfo{MaxBlocksPerQuery: -1},
+	}, nil)
+	assert.Regexp("Catchup maxBlocksPerQuery and maxQueriesPerSec must not be negative", err)
+
+	_, err = sm.newSubscriptionFromDTO(nil, &SubscriptionCreateDTO{
+		Catchup: &catchupInfo{MaxQueriesPerSec: -0.5},
+	})
+	assert.Regexp("Catchup maxBlocksPerQuery and maxQueriesPerSec must not be negative", err)
+
+	assert.NoError(validateCatchup(nil))
+	assert.NoError(validateCatchup(&catchupInfo{MaxBlocksPerQuery: 10, MaxQueriesPerSec: 0.5}))
+}
+
+func TestCatchupStreamUpdate(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream()
+	defer stream.stop(false)
+
+	_, err := stream.update(&StreamInfo{Catchup: &catchupInfo{MaxBlocksPerQuery: -1}})
+	assert.Regexp("Catchup maxBlocksPerQuery and maxQueriesPerSec must not be negative", err)
+
+	spec, err := stream.update(&StreamInfo{Catchup: &catchupInfo{MaxBlocksPerQuery: 10}})
+	assert.NoError(err)
+	assert.Equal(int64(10), spec.Catchup.MaxBlocksPerQuery)
+}
+
+func TestCatchupPageSizePrecedence(t *testing.T) {
+	assert := assert.New(t)
+	stream := &eventStream{spec: &StreamInfo{ID: "es-1"}}
+	s := &subscription{
+		info:                &SubscriptionInfo{},
+		lp:                  newLogProcessor("sb-1", nil, stream),
+		catchupModePageSize: 250,
+	}
+	assert.Equal(int64(250), s.catchupPageSize())
+
+	stream.spec.Catchup = &catchupInfo{MaxBlocksPerQuery: 100}
+	assert.Equal(int64(100), s.catchupPageSize())
+
+	s.info.Catchup = &catchupInfo{MaxBlocksPerQuery: 10}
+	assert.Equal(int64(10), s.catchupPageSize())
+}
+
+func TestCatchupThrottled(t *testing.T) {
+	assert := assert.New(t)
+	stream := &eventStream{spec: &StreamInfo{ID: "es-1"}}
+	s := &subscription{
+		info: &SubscriptionInfo{},
+		lp:   newLogProcessor("sb-1", nil, stream),
+	}
+	assert.False(s.catchupThrottled())
+	assert.False(s.catchupThrottled())
+
+	stream.spec.Catchup = &catchupInfo{MaxQueriesPerSec: 0.1}
+	assert.True(s.catchupThrottled())
+
+	s.info.Catchup = &catchupInfo{MaxQueriesPerSec: 1000}
+	time.Sleep(2 * time.Millisecond)
+	assert.False(s.catchupThrottled())
+
+	s.info.Catchup = nil
+	s.lastCatchupQuery = time.Now().Add(-20 * time.Second)
+	assert.False(s.catchupThrottled())
+	assert.True(s.catchupThrottled())
+}
+
+func TestCatchupThrottledSkipsQuery(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	s := &subscription{
+		info:             &SubscriptionInfo{Catchup: &catchupInfo{MaxQueriesPerSec: 1}},
+		rpc:              rpc,
+		catchupBlock:     big.NewInt(12345),
+		lastCatchupQuery: time.Now(),
+	}
+	err := s.processCatchupBlocks(context.Background())
+	assert.NoError(err)
+	assert.Equal(int64(12345), s.catchupBlock.Int64())
+	rpc.AssertNotCalled(t, "CallContext", mock.Anything, mock.Anything, "eth_getLogs", mock.Anything)
+}
+
+func TestCatchupProgress(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Run(func(args mock.Arguments) {
+			args[1].(*ethbinding.HexBigInt).ToInt().SetInt64(1000)
+		}).
+		Return(nil)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getLogs", mock.Anything).Return(nil)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_newFilter", mock.Anything).Return(nil)
+	sm := newTestSubscriptionManager()
+	stream := &eventStream{spec: &StreamInfo{ID: "es-1", Catchup: &catchupInfo{MaxBlocksPerQuery: 300}}}
+	s := &subscription{
+		info:                &SubscriptionInfo{ID: "sb-1", Catchup: &catchupInfo{MaxBlocksPerQuery: 250}},
+		rpc:                 rpc,
+		lp:                  newLogProcessor("sb-1", nil, stream),
+		catchupModeBlockGap: 100,
+		catchupModePageSize: 500,
+		filterStale:         true,
+	}
+	sm.subscriptions["sb-1"] = s
+	ctx := context.Background()
+
+	info, err := sm.SubscriptionByID(ctx, "sb-1")
+	assert.NoError(err)
+	assert.Nil(info.CatchupProgress)
+
+	err = s.restartFilter(ctx, big.NewInt(0))
+	assert.NoError(err)
+	progress := s.catchupStatus()
+	assert.Equal(int64(0), progress.StartBlock.Int64())
+	assert.Equal(int64(0), progress.NextBlock.Int64())
+	assert.Equal(int64(1000), progress.TargetBlock.Int64())
+	assert.Equal(float64(0), progress.PercentComplete)
+
+	err = s.processCatchupBlocks(ctx)
+	assert.NoError(err)
+	info, err = sm.SubscriptionByID(ctx, "sb-1")
+	assert.NoError(err)
+	assert.Equal(int64(250), info.CatchupProgress.NextBlock.Int64())
+	assert.Equal(float64(25), info.CatchupProgress.PercentComplete)
+	assert.Nil(s.info.CatchupProgress)
+
+	s.catchupBlock = big.NewInt(950)
+	err = s.restartFilter(ctx, big.NewInt(0))
+	assert.NoError(err)
+	assert.Nil(s.catchupStatus())
+	assert.Nil(s.catchupBlock)
+}
+
+func TestCatchupProgressComplete(t *testing.T) {
+	assert := assert.New(t)
+	s := &subscription{catchupBlock: big.NewInt(100)}
+	s.updateCatchupProgress(big.NewInt(100))
+	assert.Equal(float64(100), s.catchupStatus().PercentComplete)
+
+	s.catchupBlock = big.NewInt(150)
+	s.updateCatchupProgress(nil)
+	assert.Equal(int64(100), s.catchupStatus().StartBlock.Int64())
+	assert.Equal(float64(100), s.catchupStatus().PercentComplete)
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubscriptionCheckpoint is the position of a subscription, exported from one gateway and
+// imported into another, to move an event consumer between environments
+type SubscriptionCheckpoint struct {
+	SubscriptionID string   `json:"subscriptionId,omitempty"`
+	StreamID       string   `json:"streamId,omitempty"`
+	BlockNumber    *big.Int `json:"blockNumber"`
+	InFlight       uint64   `json:"inFlight"`
+	Suspended      bool     `json:"suspended"`
+}
+
+// ExportCheckpoint returns the block a subscription has processed up to, along with the
+// number of events the stream has dispatched that are not yet acknowledged. Those events
+// are delivered again by a gateway that imports the checkpoint
+func (s *subscriptionMGR) ExportCheckpoint(ctx context.Context, id string) (*SubscriptionCheckpoint, error) {
+	sub, err := s.subscriptionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := s.streamByID(sub.info.Stream)
+	if err != nil {
+		return nil, err
+	}
+	cp := &SubscriptionCheckpoint{
+		SubscriptionID: sub.info.ID,
+		StreamID:       sub.info.Stream,
+		BlockNumber:    s.currentBlock(sub, make(map[string]map[string]*big.Int)),
+	}
+	stream.batchCond.L.Lock()
+	cp.InFlight = stream.inFlight
+	cp.Suspended = stream.spec.Suspended
+	stream.batchCond.L.Unlock()
+	if cp.BlockNumber == nil {
+		cp.BlockNumber = big.NewInt(0)
+	}
+	return cp, nil
+}
+
+// ImportCheckpoint moves a subscription to the block in a checkpoint exported from another
+// gateway. The subscription continues from that block on the next polling cycle
+func (s *subscriptionMGR) ImportCheckpoint(ctx context.Context, id string, cp *SubscriptionCheckpoint) error {
+	sub, err := s.subscriptionByID(id)
+	if err != nil {
+		return err
+	}
+	if cp == nil || cp.BlockNumber == nil || cp.BlockNumber.Sign() < 0 {
+		return errors.Errorf(errors.EventStreamsCheckpointInvalid)
+	}
+	log.Infof("%s: Importing checkpoint at block %s from subscription '%s'", sub.logName, cp.BlockNumber.String(), cp.SubscriptionID)
+	return s.resetSubscription(ctx, sub, cp.BlockNumber.Text(10))
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCheckpointSubscription(assert *assert.Assertions) (*subscriptionMGR, *StreamInfo, *SubscriptionInfo) {
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type:      "webhook",
+		Suspended: true,
+		Webhook:   &webhookActionInfo{URL: "http://test.invalid"},
+	})
+	assert.NoError(err)
+	sub, err := sm.AddSubscriptionDirect(ctx, &SubscriptionCreateDTO{
+		Stream: stream.ID,
+		Event:  &ethbinding.ABIElementMarshaling{Name: "ping"},
+	})
+	assert.NoError(err)
+	return sm, stream, sub
+}
+
+func TestExportCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestCheckpointSubscription(assert)
+	defer sm.Close(false)
+	ctx := context.Background()
+
+	cp, err := sm.ExportCheckpoint(ctx, sub.ID)
+	assert.NoError(err)
+	assert.Equal(int64(0), cp.BlockNumber.Int64())
+
+	sm.storeCheckpoint(stream.ID, map[string]*big.Int{sub.ID: big.NewInt(12345)})
+	sm.streams[stream.ID].inFlight = 3
+	cp, err = sm.ExportCheckpoint(ctx, sub.ID)
+	assert.NoError(err)
+	assert.Equal(sub.ID, cp.SubscriptionID)
+	assert.Equal(stream.ID, cp.StreamID)
+	assert.Equal(int64(12345), cp.BlockNumber.Int64())
+	assert.Equal(uint64(3), cp.InFlight)
+	assert.True(cp.Suspended)
+
+	_, err = sm.ExportCheckpoint(ctx, "nope")
+	assert.Regexp("Subscription with ID 'nope' not found", err)
+
+	delete(sm.streams, stream.ID)
+	_, err = sm.ExportCheckpoint(ctx, sub.ID)
+	assert.Regexp("Stream with ID '.*' not found", err)
+}
+
+func TestImportCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, sub := newTestCheckpointSubscription(assert)
+	defer sm.Close(false)
+	ctx := context.Background()
+
+	err := sm.ImportCheckpoint(ctx, sub.ID, &SubscriptionCheckpoint{SubscriptionID: "sb-other", BlockNumber: big.NewInt(12345)})
+	assert.NoError(err)
+	assert.Equal("12345", sm.subscriptions[sub.ID].info.FromBlock)
+	assert.True(sm.subscriptions[sub.ID].resetRequested)
+
+	err = sm.ImportCheckpoint(ctx, sub.ID, &SubscriptionCheckpoint{})
+	assert.Regexp("Checkpoint must include a blockNumber", err)
+	err = sm.ImportCheckpoint(ctx, sub.ID, &SubscriptionCheckpoint{BlockNumber: big.NewInt(-1)})
+	assert.Regexp("Checkpoint must include a blockNumber", err)
+	err = sm.ImportCheckpoint(ctx, "nope", &SubscriptionCheckpoint{BlockNumber: big.NewInt(1)})
+	assert.Regexp("Subscription with ID 'nope' not found", err)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// CircuitClosed is the state of a stream that is delivering normally
+	CircuitClosed = "closed"
+	// CircuitOpen is the state of a stream that is waiting before its next delivery attempt,
+	// as the receiver asked it to with Retry-After, or has failed too many times in a row
+	CircuitOpen = "open"
+	// CircuitHalfOpen is the state of a stream making a trial delivery after the circuit was open
+	CircuitHalfOpen = "halfOpen"
+
+	defaultCircuitCooldownSec = 60
+	// maxRetryAfter caps the delay a receiver can request, so a bad header cannot stall a stream indefinitely
+	maxRetryAfter = 10 * time.Minute
+)
+
+type circuitBreakerInfo struct {
+	Threshold   uint64 `json:"threshold,omitempty"`
+	CooldownSec uint64 `json:"cooldownSec,omitempty"`
+}
+
+// CircuitStatus reports the circuit state of a stream. It is calculated for the stream APIs, and not persisted
+type CircuitStatus struct {
+	State               string `json:"state"`
+	ConsecutiveFailures uint64 `json:"consecutiveFailures"`
+	OpenUntil           string `json:"openUntil,omitempty"`
+	LastError           string `json:"lastError,omitempty"`
+}
+
+// retryAfterError is a delivery failure where the receiver asked for the next attempt to be delayed
+type retryAfterError struct {
+	error
+	retryAfter time.Duration
+}
+
+// parseRetryAfter returns the delay requested by a Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	var d time.Duration
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+// circuitOpenFor returns how long is left before the next delivery attempt can be made
+func (a *eventStream) circuitOpenFor() time.Duration {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.circuitState != CircuitOpen {
+		return 0
+	}
+	return time.Until(a.circuitOpenUntil)
+}
+
+// updateCircuit records the result of a delivery attempt. The circuit opens for the delay
+// requested by the receiver, or for the cooldown once the threshold of consecutive failures
+// is reached, and the next attempt after it opens is a trial that closes it again on success
+func (a *eventStream) updateCircuit(err error) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if err == nil {
+		if a.circuitState != CircuitClosed && a.circuitState != "" {
+			log.Infof("%s: Circuit closed", a.spec.ID)
+		}
+		a.circuitState = CircuitClosed
+		a.circuitLastError = ""
+		return
+	}
+	a.circuitLastError = err.Error()
+	var openFor time.Duration
+	if ra, ok := err.(*retryAfterError); ok {
+		openFor = ra.retryAfter
+	}
+	if cb := a.spec.CircuitBreaker; cb != nil && cb.Threshold > 0 &&
+		(a.circuitState == CircuitHalfOpen || a.consecutiveFailures >= cb.Threshold) {
+		if cooldown := time.Duration(cb.CooldownSec) * time.Second; cooldown > openFor {
+			openFor = cooldown
+		}
+	}
+	if openFor > 0 {
+		a.circuitState = CircuitOpen
+		a.circuitOpenUntil = time.Now().Add(openFor)
+		log.Warnf("%s: Circuit open for %.2fs after %d consecutive failures: %s", a.spec.ID, openFor.Seconds(), a.consecutiveFailures, err)
+	} else if a.circuitState != CircuitHalfOpen {
+		a.circuitState = CircuitClosed
+	}
+}
+
+// circuitTrial moves an open circuit to half open, once the wait is over and a trial delivery is about to be made
+func (a *eventStream) circuitTrial() {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.circuitState == CircuitOpen && !time.Now().Before(a.circuitOpenUntil) {
+		a.circuitState = CircuitHalfOpen
+	}
+}
+
+// circuitStatus returns the circuit state of the stream, or nil if it is closed with no failures
+func (a *eventStream) circuitStatus() *CircuitStatus {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if (a.circuitState == "" || a.circuitState == CircuitClosed) && a.consecutiveFailures == 0 {
+		return nil
+	}
+	status := &CircuitStatus{
+		State:               a.circuitState,
+		ConsecutiveFailures: a.consecutiveFailures,
+		LastError:           a.circuitLastError,
+	}
+	if status.State == "" {
+		status.State = CircuitClosed
+	}
+	if status.State == CircuitOpen {
+		status.OpenUntil = a.circuitOpenUntil.UTC().Format(time.RFC3339Nano)
+	}
+	return status
+}
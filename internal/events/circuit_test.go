@@ -0,0 +1,152 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	assert.Equal(5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(30*time.Second, parseRetryAfter(now.Add(30*time.Second).UTC().Format(http.TimeFormat), now.Truncate(time.Second)))
+	assert.Equal(time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("-5", now))
+	assert.Equal(maxRetryAfter, parseRetryAfter("100000", now))
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+	assert := assert.New(t)
+	a := &eventStream{
+		spec:      &StreamInfo{ID: "123", CircuitBreaker: &circuitBreakerInfo{Threshold: 2, CooldownSec: 60}},
+		batchCond: sync.NewCond(&sync.Mutex{}),
+	}
+	assert.Nil(a.circuitStatus())
+
+	a.consecutiveFailures = 1
+	a.updateCircuit(fmt.Errorf("pop"))
+	assert.Equal(CircuitClosed, a.circuitStatus().State)
+	assert.Equal(time.Duration(0), a.circuitOpenFor())
+
+	a.consecutiveFailures = 2
+	a.updateCircuit(fmt.Errorf("pop"))
+	status := a.circuitStatus()
+	assert.Equal(CircuitOpen, status.State)
+	assert.Equal(uint64(2), status.ConsecutiveFailures)
+	assert.Equal("pop", status.LastError)
+	assert.NotEmpty(status.OpenUntil)
+	assert.True(a.circuitOpenFor() > 59*time.Second)
+
+	// Still open until the cooldown is over
+	a.circuitTrial()
+	assert.Equal(CircuitOpen, a.circuitState)
+	a.circuitOpenUntil = time.Now()
+	a.circuitTrial()
+	assert.Equal(CircuitHalfOpen, a.circuitState)
+
+	// A failed trial opens it again
+	a.consecutiveFailures = 3
+	a.updateCircuit(fmt.Errorf("pop"))
+	assert.Equal(CircuitOpen, a.circuitState)
+
+	a.circuitOpenUntil = time.Now()
+	a.circuitTrial()
+	a.consecutiveFailures = 0
+	a.updateCircuit(nil)
+	assert.Equal(CircuitClosed, a.circuitState)
+	assert.Nil(a.circuitStatus())
+}
+
+func TestCircuitRetryAfterWithoutBreaker(t *testing.T) {
+	assert := assert.New(t)
+	a := &eventStream{
+		spec:      &StreamInfo{ID: "123"},
+		batchCond: sync.NewCond(&sync.Mutex{}),
+	}
+
+	a.consecutiveFailures = 10
+	a.updateCircuit(fmt.Errorf("pop"))
+	assert.Equal(CircuitClosed, a.circuitState)
+
+	a.updateCircuit(&retryAfterError{error: fmt.Errorf("pop"), retryAfter: 5 * time.Second})
+	assert.Equal(CircuitOpen, a.circuitState)
+	assert.True(a.circuitOpenFor() > 4*time.Second)
+}
+
+func TestWebhookRetryAfterHonored(t *testing.T) {
+	assert := assert.New(t)
+
+	var attempts []time.Time
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			res.Header().Set("Retry-After", "1")
+			res.WriteHeader(503)
+			return
+		}
+		res.WriteHeader(200)
+	}))
+	defer svr.Close()
+
+	sm := newTestSubscriptionManager()
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").Return(nil)
+	sm.rpc = rpc
+	spec, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type:            "webhook",
+		BatchSize:       1,
+		RetryTimeoutSec: 60,
+		Webhook:         &webhookActionInfo{URL: svr.URL},
+	})
+	assert.NoError(err)
+	stream := sm.streams[spec.ID]
+	defer stream.stop(false)
+	stream.initialRetryDelay = 1 * time.Millisecond
+
+	complete := make(chan bool, 1)
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		batchComplete: func(*eventData) { complete <- true },
+	})
+	for {
+		if s, _ := sm.StreamByID(context.Background(), spec.ID); s.Circuit != nil {
+			assert.Equal(CircuitOpen, s.Circuit.State)
+			assert.Regexp("status=503", s.Circuit.LastError)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	streams := sm.Streams(context.Background())
+	assert.Equal(CircuitOpen, streams[0].Circuit.State)
+	<-complete
+
+	assert.Equal(2, len(attempts))
+	assert.True(attempts[1].Sub(attempts[0]) >= 900*time.Millisecond)
+	s, _ := sm.StreamByID(context.Background(), spec.ID)
+	assert.Nil(s.Circuit)
+}
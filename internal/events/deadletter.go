@@ -0,0 +1,200 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	// DeadLetterLevelDB stores batches that cannot be delivered in the events database, where they can be listed and requeued
+	DeadLetterLevelDB = "leveldb"
+	// DeadLetterKafka sends batches that cannot be delivered to a Kafka topic
+	DeadLetterKafka = "kafka"
+
+	deadLetterIDPrefix = "dl-"
+)
+
+type deadLetterInfo struct {
+	Type  string `json:"type,omitempty"`
+	Topic string `json:"topic,omitempty"`
+}
+
+// DeadLetter is a batch of events that could not be delivered by an event stream
+type DeadLetter struct {
+	ID          string       `json:"id"`
+	StreamID    string       `json:"streamId"`
+	BatchNumber uint64       `json:"batchNumber"`
+	Error       string       `json:"error"`
+	Created     string       `json:"created"`
+	Terminal    bool         `json:"terminal,omitempty"` // Recorded after retrying for the max retry duration
+	Events      []*eventData `json:"events"`
+}
+
+func validateDeadLetter(sm subscriptionManager, spec *deadLetterInfo) error {
+	spec.Type = strings.ToLower(spec.Type)
+	switch spec.Type {
+	case "":
+		spec.Type = DeadLetterLevelDB
+	case DeadLetterLevelDB:
+	case DeadLetterKafka:
+		if len(sm.config().Kafka.Brokers) == 0 {
+			return errors.Errorf(errors.EventStreamsKafkaNotConfigured)
+		}
+		if spec.Topic == "" {
+			return errors.Errorf(errors.EventStreamsDeadLetterNoTopic)
+		}
+	default:
+		return errors.Errorf(errors.EventStreamsDeadLetterInvalidType, spec.Type)
+	}
+	return nil
+}
+
+func deadLetterKey(streamID, id string) string {
+	return deadLetterIDPrefix + streamID + "/" + id
+}
+
+// deadLetter writes a batch that could not be delivered to the dead letter queue of the
+// stream, so the stream can move on to the next batch without losing the events
+func (a *eventStream) deadLetter(batchNumber uint64, events []*eventData, deliveryErr error) error {
+	dl := a.newDeadLetter(batchNumber, events, deliveryErr)
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	if a.spec.DeadLetter.Type == DeadLetterKafka {
+		producer, err := a.sm.kafkaProducer()
+		if err != nil {
+			return err
+		}
+		log.Infof("%s: Sending batch %d of %d events to dead letter topic '%s'", a.spec.ID, batchNumber, len(events), a.spec.DeadLetter.Topic)
+		return producer.SendBatch(a.spec.DeadLetter.Topic, []*kafka.KafkaBatchMessage{
+			{Key: a.spec.ID, Value: b},
+		})
+	}
+	log.Infof("%s: Storing batch %d of %d events as dead letter %s", a.spec.ID, batchNumber, len(events), dl.ID)
+	return a.sm.storeDeadLetter(dl.StreamID, dl.ID, b)
+}
+
+func (a *eventStream) newDeadLetter(batchNumber uint64, events []*eventData, deliveryErr error) *DeadLetter {
+	return &DeadLetter{
+		// Zero padded so the dead letters of a stream are listed in the order they failed
+		ID:          fmt.Sprintf("%020d", time.Now().UnixNano()),
+		StreamID:    a.spec.ID,
+		BatchNumber: batchNumber,
+		Error:       deliveryErr.Error(),
+		Created:     time.Now().UTC().Format(time.RFC3339Nano),
+		Events:      events,
+	}
+}
+
+// requeue adds the events of a dead letter to the batch queue of the stream, so they are
+// delivered in turn with new batches. The dead letter is removed once they have been
+// processed, so it is not lost if the stream stops first
+func (a *eventStream) requeue(dl *DeadLetter, processed func()) {
+	for _, event := range dl.Events {
+		event.batchComplete = func(*eventData) { processed() }
+	}
+	a.batchCond.L.Lock()
+	a.inFlight += uint64(len(dl.Events))
+	a.batchQueue.PushBack(dl.Events)
+	a.batchCond.Broadcast()
+	a.batchCond.L.Unlock()
+}
+
+func (s *subscriptionMGR) storeDeadLetter(streamID, id string, b []byte) error {
+	return s.db.Put(deadLetterKey(streamID, id), b)
+}
+
+func (s *subscriptionMGR) loadDeadLetter(streamID, id string) (*DeadLetter, error) {
+	b, err := s.db.Get(deadLetterKey(streamID, id))
+	if err == leveldb.ErrNotFound {
+		return nil, errors.Errorf(errors.EventStreamsDeadLetterNotFound, id, streamID)
+	} else if err != nil {
+		return nil, err
+	}
+	var dl DeadLetter
+	if err = json.Unmarshal(b, &dl); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// DeadLetters lists the batches stored in the dead letter queue of a stream, oldest first
+func (s *subscriptionMGR) DeadLetters(ctx context.Context, streamID string) ([]*DeadLetter, error) {
+	if _, err := s.streamByID(streamID); err != nil {
+		return nil, err
+	}
+	prefix := deadLetterKey(streamID, "")
+	deadLetters := make([]*DeadLetter, 0)
+	it := s.db.NewIterator()
+	defer it.Release()
+	for ok := it.Seek(prefix); ok && strings.HasPrefix(it.Key(), prefix); ok = it.Next() {
+		var dl DeadLetter
+		if err := json.Unmarshal(it.Value(), &dl); err != nil {
+			log.Errorf("Failed to load dead letter '%s': %s", it.Key(), err)
+			continue
+		}
+		deadLetters = append(deadLetters, &dl)
+	}
+	return deadLetters, nil
+}
+
+// RequeueDeadLetter sends the events of a dead letter to the stream again
+func (s *subscriptionMGR) RequeueDeadLetter(ctx context.Context, streamID, id string) error {
+	stream, err := s.streamByID(streamID)
+	if err != nil {
+		return err
+	}
+	dl, err := s.loadDeadLetter(streamID, id)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: Requeuing dead letter %s with %d events", streamID, id, len(dl.Events))
+	stream.requeue(dl, func() {
+		_ = s.db.Delete(deadLetterKey(streamID, id))
+	})
+	return nil
+}
+
+// DeleteDeadLetter discards a dead letter
+func (s *subscriptionMGR) DeleteDeadLetter(ctx context.Context, streamID, id string) error {
+	if _, err := s.loadDeadLetter(streamID, id); err != nil {
+		return err
+	}
+	return s.db.Delete(deadLetterKey(streamID, id))
+}
+
+func (s *subscriptionMGR) deleteDeadLetters(streamID string) {
+	prefix := deadLetterKey(streamID, "")
+	var keys []string
+	it := s.db.NewIterator()
+	for ok := it.Seek(prefix); ok && strings.HasPrefix(it.Key(), prefix); ok = it.Next() {
+		keys = append(keys, it.Key())
+	}
+	it.Release()
+	for _, k := range keys {
+		_ = s.db.Delete(k)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func waitForDeadLetters(sm *subscriptionMGR, streamID string, count int) []*DeadLetter {
+	for {
+		deadLetters, _ := sm.DeadLetters(context.Background(), streamID)
+		if len(deadLetters) == count {
+			return deadLetters
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeadLetterLevelDBAndRequeue(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:            1,
+			Webhook:              &webhookActionInfo{},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 1,
+			DeadLetter:           &deadLetterInfo{},
+		}, db, 404, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop(false)
+	assert.Equal(DeadLetterLevelDB, stream.spec.DeadLetter.Type)
+
+	complete := make(chan bool, 1)
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		Address:       "0x1111",
+		batchComplete: func(*eventData) { complete <- true },
+	})
+	<-eventStream
+	// The blocking stream moves on once the batch is dead lettered
+	<-complete
+
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 1)
+	assert.Equal(stream.spec.ID, deadLetters[0].StreamID)
+	assert.Regexp("404", deadLetters[0].Error)
+	assert.Equal("0x1111", deadLetters[0].Events[0].Address)
+
+	err := sm.RequeueDeadLetter(context.Background(), stream.spec.ID, deadLetters[0].ID)
+	assert.NoError(err)
+	events := <-eventStream
+	assert.Equal("0x1111", events[0].Address)
+	waitForDeadLetters(sm, stream.spec.ID, 0)
+}
+
+func TestDeadLetterDeleteAndNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:  1,
+			Webhook:    &webhookActionInfo{},
+			DeadLetter: &deadLetterInfo{Type: "LevelDB"},
+		}, db, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	ctx := context.Background()
+
+	b, _ := json.Marshal(&DeadLetter{ID: "dl1", StreamID: stream.spec.ID})
+	sm.storeDeadLetter(stream.spec.ID, "dl1", b)
+	sm.storeDeadLetter(stream.spec.ID, "dl2", []byte("!json"))
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 1)
+	assert.Equal("dl1", deadLetters[0].ID)
+
+	err := sm.RequeueDeadLetter(ctx, stream.spec.ID, "dl3")
+	assert.Regexp("Dead letter 'dl3' not found", err)
+	err = sm.RequeueDeadLetter(ctx, "es-nope", "dl1")
+	assert.Regexp("Stream with ID 'es-nope' not found", err)
+	_, err = sm.loadDeadLetter(stream.spec.ID, "dl2")
+	assert.Error(err)
+
+	err = sm.DeleteDeadLetter(ctx, stream.spec.ID, "dl1")
+	assert.NoError(err)
+	err = sm.DeleteDeadLetter(ctx, stream.spec.ID, "dl1")
+	assert.Regexp("Dead letter 'dl1' not found", err)
+
+	err = sm.DeleteStream(ctx, stream.spec.ID)
+	assert.NoError(err)
+	_, err = db.Get(deadLetterKey(stream.spec.ID, "dl2"))
+	assert.Error(err)
+	_, err = sm.DeadLetters(ctx, stream.spec.ID)
+	assert.Regexp("Stream with ID '.*' not found", err)
+}
+
+func TestDeadLetterKafka(t *testing.T) {
+	assert := assert.New(t)
+	p := &testKafkaProducer{}
+	stream := &eventStream{
+		sm:   &mockSubMgr{kafka: p},
+		spec: &StreamInfo{ID: "123", DeadLetter: &deadLetterInfo{Type: DeadLetterKafka, Topic: "dlq"}},
+	}
+
+	err := stream.deadLetter(5, []*eventData{{Address: "0x1111"}}, fmt.Errorf("pop"))
+	assert.NoError(err)
+	assert.Equal("dlq", p.topic)
+	assert.Equal("123", p.msgs[0].Key)
+	var dl DeadLetter
+	json.Unmarshal(p.msgs[0].Value, &dl)
+	assert.Equal(uint64(5), dl.BatchNumber)
+	assert.Equal("pop", dl.Error)
+	assert.Equal("0x1111", dl.Events[0].Address)
+
+	stream.sm = &mockSubMgr{err: fmt.Errorf("no producer")}
+	err = stream.deadLetter(6, []*eventData{{Address: "0x1111"}}, fmt.Errorf("pop"))
+	assert.Regexp("no producer", err)
+}
+
+func TestValidateDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestKafkaSubscriptionManager()
+
+	err := validateDeadLetter(sm, &deadLetterInfo{Type: "wrong"})
+	assert.Regexp("Invalid deadLetter.type 'wrong'", err)
+
+	err = validateDeadLetter(sm, &deadLetterInfo{Type: "Kafka"})
+	assert.Regexp("Must specify deadLetter.topic", err)
+
+	err = validateDeadLetter(sm, &deadLetterInfo{Type: "kafka", Topic: "dlq"})
+	assert.NoError(err)
+
+	sm.config().Kafka.Brokers = nil
+	err = validateDeadLetter(sm, &deadLetterInfo{Type: "kafka", Topic: "dlq"})
+	assert.Regexp("Kafka brokers must be configured for events", err)
+
+	_, err = newEventStream(sm, &StreamInfo{
+		ID:         "123",
+		Type:       "webhook",
+		Webhook:    &webhookActionInfo{URL: "http://test.invalid"},
+		DeadLetter: &deadLetterInfo{Type: "wrong"},
+	}, nil)
+	assert.Regexp("Invalid deadLetter.type 'wrong'", err)
+}
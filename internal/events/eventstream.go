@@ -15,10 +15,13 @@
 package events
 
 import (
+	"bytes"
 	"container/list"
 	"context"
+	"encoding/json"
 	"math/big"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
 	"sync"
@@ -27,6 +30,7 @@ import (
 	"github.com/hyperledger/firefly-ethconnect/internal/auth"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 	"github.com/hyperledger/firefly-ethconnect/internal/ws"
 
 	lru "github.com/hashicorp/golang-lru"
@@ -72,9 +76,37 @@ type StreamInfo struct {
 	BlockedRetryDelaySec uint64               `json:"blockedReryDelaySec,omitempty"`
 	Webhook              *webhookActionInfo   `json:"webhook,omitempty"`
 	WebSocket            *webSocketActionInfo `json:"websocket,omitempty"`
+	Kafka                *kafkaActionInfo     `json:"kafka,omitempty"`
+	MQTT                 *mqttActionInfo      `json:"mqtt,omitempty"`
+	NATS                 *natsActionInfo      `json:"nats,omitempty"`
 	Timestamps           bool                 `json:"timestamps,omitempty"` // Include block timestamps in the events generated
 	TimestampCacheSize   int                  `json:"timestampCacheSize,omitempty"`
 	Inputs               bool                 `json:"inputs,omitempty"` // Include input args in the events generated
+	FailureThreshold     uint64               `json:"failureThreshold,omitempty"`
+	AlertURL             string               `json:"alertURL,omitempty"`
+	SuspendedReason      string               `json:"suspendedReason,omitempty"`
+	DeadLetter           *deadLetterInfo      `json:"deadLetter,omitempty"`
+	MaxRetry             *maxRetryInfo        `json:"maxRetry,omitempty"`
+	CircuitBreaker       *circuitBreakerInfo  `json:"circuitBreaker,omitempty"`
+	Circuit              *CircuitStatus       `json:"circuit,omitempty"`
+	Catchup              *catchupInfo         `json:"catchup,omitempty"`
+	Inactivity           *inactivityInfo      `json:"inactivity,omitempty"`
+	Connections          []*ws.ConnectionInfo `json:"connections,omitempty"`
+	SyncStatus
+}
+
+// streamAlert is the payload sent to the alert URL when a stream is automatically suspended,
+// or a stream or subscription is about to be, or has been, cleaned up after inactivity
+type streamAlert struct {
+	Type                string `json:"type"`
+	StreamID            string `json:"streamId"`
+	SubscriptionID      string `json:"subscriptionId,omitempty"`
+	Name                string `json:"name,omitempty"`
+	ConsecutiveFailures uint64 `json:"consecutiveFailures"`
+	Error               string `json:"error"`
+	Action              string `json:"action,omitempty"`
+	InactiveSec         uint64 `json:"inactiveSec,omitempty"`
+	Timestamp           string `json:"timestamp"`
 }
 
 type webhookActionInfo struct {
@@ -82,6 +114,25 @@ type webhookActionInfo struct {
 	Headers           map[string]string `json:"headers,omitempty"`
 	TLSkipHostVerify  bool              `json:"tlsSkipHostVerify,omitempty"`
 	RequestTimeoutSec uint32            `json:"requestTimeoutSec,omitempty"`
+	Probe             string            `json:"probe,omitempty"`
+	HMACSecret        string            `json:"hmacSecret,omitempty"`
+	BasicAuth         *webhookBasicAuth `json:"basicAuth,omitempty"`
+	TLS               *webhookTLSInfo   `json:"tls,omitempty"`
+	Gzip              bool              `json:"gzip,omitempty"`
+	GzipMinSize       uint32            `json:"gzipMinSize,omitempty"`
+	Metadata          bool              `json:"metadata,omitempty"`
+}
+
+type webhookBasicAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// webhookTLSInfo is the client certificate and CA bundle for a webhook that requires mutual TLS
+type webhookTLSInfo struct {
+	ClientCertsFile string `json:"clientCertsFile,omitempty"`
+	ClientKeyFile   string `json:"clientKeyFile,omitempty"`
+	CACertsFile     string `json:"caCertsFile,omitempty"`
 }
 
 type webSocketActionInfo struct {
@@ -92,6 +143,7 @@ type webSocketActionInfo struct {
 type eventStream struct {
 	sm                  subscriptionManager
 	allowPrivateIPs     bool
+	allowedHosts        []string
 	spec                *StreamInfo
 	eventStream         chan *eventData
 	stopped             bool
@@ -103,20 +155,44 @@ type eventStream struct {
 	initialRetryDelay   time.Duration
 	backoffFactor       float64
 	updateInProgress    bool
-	updateInterrupt     chan struct{} // a zero-sized struct used only for signaling (hand rolled alternative to context)
+	consecutiveFailures uint64
+	circuitState        string
+	circuitOpenUntil    time.Time
+	circuitLastError    string
+	metrics             streamMetrics
+	delivery            *batchDelivery // the batch being delivered, only accessed by the batch dispatcher
+	updateInterrupt     chan struct{}  // a zero-sized struct used only for signaling (hand rolled alternative to context)
 	blockTimestampCache *lru.Cache
 	action              eventStreamAction
 	wsChannels          ws.WebSocketChannels
+	activeSince         time.Time // when the handlers were last started, which restarts the inactivity timeout
+	inactivity          inactivityState
+	consumerSeen        time.Time // when a consumer was last seen connected to a WebSocket stream
 
 	eventPollerDone     chan struct{}
 	batchProcessorDone  chan struct{}
 	batchDispatcherDone chan struct{}
 }
 
+// batchDelivery tracks the attempts to deliver a batch, across all the retries
+// and blocked retries of the batch
+type batchDelivery struct {
+	number       uint64
+	id           string
+	attempts     uint64
+	firstAttempt time.Time
+}
+
 type eventStreamAction interface {
 	attemptBatch(batchNumber, attempt uint64, events []*eventData) error
 }
 
+// closeableAction is implemented by actions that hold a connection, which is closed
+// whenever the batch processor exits for a stop, suspend or update of the stream
+type closeableAction interface {
+	close()
+}
+
 func validateWebSocket(w *webSocketActionInfo) error {
 	if w.DistributionMode != "" && w.DistributionMode != DistributionModeBroadcast && w.DistributionMode != DistributionModeWLD {
 		return errors.Errorf(errors.EventStreamsInvalidDistributionMode, w.DistributionMode)
@@ -129,6 +205,16 @@ func validateWebSocket(w *webSocketActionInfo) error {
 // initialied to that supplied (zero on initial, or the
 // value from the checkpoint)
 func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebSocketChannels) (a *eventStream, err error) {
+	if a, err = buildEventStream(sm, spec, wsChannels); err != nil {
+		return nil, err
+	}
+	a.startEventHandlers(false)
+	return a, nil
+}
+
+// buildEventStream validates a stream and applies its defaults, without starting
+// its handlers, so a stream can be checked before it is stored
+func buildEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebSocketChannels) (a *eventStream, err error) {
 	if spec == nil || spec.GetID() == "" {
 		return nil, errors.Errorf(errors.EventStreamsNoID)
 	}
@@ -152,11 +238,36 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 	if spec.TimestampCacheSize == 0 {
 		spec.TimestampCacheSize = DefaultTimestampCacheSize
 	}
+	if spec.AlertURL != "" {
+		if _, err = url.Parse(spec.AlertURL); err != nil {
+			return nil, errors.Errorf(errors.EventStreamsAlertInvalidURL)
+		}
+	}
+	if spec.DeadLetter != nil {
+		if err = validateDeadLetter(sm, spec.DeadLetter); err != nil {
+			return nil, err
+		}
+	}
+	if err = validateMaxRetry(spec.MaxRetry); err != nil {
+		return nil, err
+	}
+	if err = validateCatchup(spec.Catchup); err != nil {
+		return nil, err
+	}
+	if err = validateInactivity(spec.Inactivity, false, strings.EqualFold(spec.Type, "websocket")); err != nil {
+		return nil, err
+	}
+	if spec.CircuitBreaker != nil && spec.CircuitBreaker.CooldownSec == 0 {
+		spec.CircuitBreaker.CooldownSec = defaultCircuitCooldownSec
+	}
+	spec.Circuit = nil
+	spec.Connections = nil
 
 	a = &eventStream{
 		sm:                sm,
 		spec:              spec,
 		allowPrivateIPs:   sm.config().WebhooksAllowPrivateIPs,
+		allowedHosts:      sm.config().WebhooksAllowedHosts,
 		eventStream:       make(chan *eventData),
 		batchCond:         sync.NewCond(&sync.Mutex{}),
 		batchQueue:        list.New(),
@@ -164,6 +275,7 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		backoffFactor:     DefaultExponentialBackoffFactor,
 		pollingInterval:   time.Duration(sm.config().EventPollingIntervalSec) * time.Second,
 		wsChannels:        wsChannels,
+		metrics:           streamMetrics{since: time.Now()},
 	}
 
 	if a.blockTimestampCache, err = lru.New(spec.TimestampCacheSize); err != nil {
@@ -191,11 +303,21 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		if a.action, err = newWebSocketAction(a, spec.WebSocket); err != nil {
 			return nil, err
 		}
+	case "kafka":
+		if a.action, err = newKafkaAction(a, spec.Kafka); err != nil {
+			return nil, err
+		}
+	case "mqtt":
+		if a.action, err = newMQTTAction(a, spec.MQTT); err != nil {
+			return nil, err
+		}
+	case "nats":
+		if a.action, err = newNATSAction(a, spec.NATS); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.Errorf(errors.EventStreamsInvalidActionType, spec.Type)
 	}
-
-	a.startEventHandlers(false)
 	return a, nil
 }
 
@@ -203,6 +325,9 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 func (a *eventStream) startEventHandlers(resume bool) {
 	// create a context that can be used to indicate an update to the eventstream
 	a.updateInterrupt = make(chan struct{})
+	a.activeSince = time.Now()
+	a.consumerSeen = a.activeSince
+	a.inactivity = inactivityState{}
 	a.eventPollerDone = make(chan struct{})
 	go a.eventPoller()
 	a.batchProcessorDone = make(chan struct{})
@@ -256,6 +381,13 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 	<-a.batchDispatcherDone
 	defer a.postUpdateStream()
 
+	// The batches that were in-flight are discarded, rather than delivered after the update. They have not
+	// been checkpointed, and the subscriptions restart from the checkpoint, so they are delivered again
+	a.batchCond.L.Lock()
+	a.batchQueue.Init()
+	a.inFlight = 0
+	a.batchCond.L.Unlock()
+
 	if newSpec.Type != "" && newSpec.Type != a.spec.Type {
 		return nil, errors.Errorf(errors.EventStreamsCannotUpdateType)
 	}
@@ -266,6 +398,15 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 		if _, err = url.Parse(newSpec.Webhook.URL); err != nil {
 			return nil, errors.Errorf(errors.EventStreamsWebhookInvalidURL)
 		}
+		if err = validateWebhookProbe(newSpec.Webhook.Probe); err != nil {
+			return nil, err
+		}
+		if err = validateWebhookSecrets(a.sm.config(), newSpec.Webhook); err != nil {
+			return nil, err
+		}
+		if _, err = webhookTLSConfig(a.sm.config(), newSpec.Webhook); err != nil {
+			return nil, err
+		}
 		if newSpec.Webhook.RequestTimeoutSec == 0 {
 			newSpec.Webhook.RequestTimeoutSec = 120
 		}
@@ -273,6 +414,12 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 		a.spec.Webhook.RequestTimeoutSec = newSpec.Webhook.RequestTimeoutSec
 		a.spec.Webhook.TLSkipHostVerify = newSpec.Webhook.TLSkipHostVerify
 		a.spec.Webhook.Headers = newSpec.Webhook.Headers
+		a.spec.Webhook.Probe = newSpec.Webhook.Probe
+		a.spec.Webhook.HMACSecret = newSpec.Webhook.HMACSecret
+		a.spec.Webhook.BasicAuth = newSpec.Webhook.BasicAuth
+		a.spec.Webhook.TLS = newSpec.Webhook.TLS
+		a.spec.Webhook.Gzip = newSpec.Webhook.Gzip
+		a.spec.Webhook.GzipMinSize = newSpec.Webhook.GzipMinSize
 	}
 	if a.spec.Type == "websocket" && newSpec.WebSocket != nil {
 		a.spec.WebSocket.Topic = newSpec.WebSocket.Topic
@@ -281,6 +428,26 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 		}
 		a.spec.WebSocket.DistributionMode = newSpec.WebSocket.DistributionMode
 	}
+	if a.spec.Type == "kafka" && newSpec.Kafka != nil {
+		if err := validateKafka(a.sm, newSpec.Kafka); err != nil {
+			return nil, err
+		}
+		a.spec.Kafka.Topic = newSpec.Kafka.Topic
+		a.spec.Kafka.KeyBy = newSpec.Kafka.KeyBy
+		a.spec.Kafka.KeyArg = newSpec.Kafka.KeyArg
+	}
+	if a.spec.Type == "mqtt" && newSpec.MQTT != nil {
+		if err := validateMQTT(a.sm.config(), a.spec.ID, newSpec.MQTT); err != nil {
+			return nil, err
+		}
+		*a.spec.MQTT = *newSpec.MQTT
+	}
+	if a.spec.Type == "nats" && newSpec.NATS != nil {
+		if err := validateNATS(a.sm, newSpec.NATS); err != nil {
+			return nil, err
+		}
+		*a.spec.NATS = *newSpec.NATS
+	}
 
 	if a.spec.BatchSize != newSpec.BatchSize && newSpec.BatchSize != 0 && newSpec.BatchSize < MaxBatchSize {
 		a.spec.BatchSize = newSpec.BatchSize
@@ -291,9 +458,12 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 	if a.spec.BlockedRetryDelaySec != newSpec.BlockedRetryDelaySec && newSpec.BlockedRetryDelaySec != 0 {
 		a.spec.BlockedRetryDelaySec = newSpec.BlockedRetryDelaySec
 	}
+	if a.spec.RetryTimeoutSec != newSpec.RetryTimeoutSec && newSpec.RetryTimeoutSec != 0 {
+		a.spec.RetryTimeoutSec = newSpec.RetryTimeoutSec
+	}
 	if strings.ToLower(newSpec.ErrorHandling) == ErrorHandlingBlock {
 		a.spec.ErrorHandling = ErrorHandlingBlock
-	} else {
+	} else if newSpec.ErrorHandling != "" {
 		a.spec.ErrorHandling = ErrorHandlingSkip
 	}
 	if newSpec.Name != "" && a.spec.Name != newSpec.Name {
@@ -305,6 +475,45 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 	if a.spec.Inputs != newSpec.Inputs {
 		a.spec.Inputs = newSpec.Inputs
 	}
+	if newSpec.AlertURL != "" && a.spec.AlertURL != newSpec.AlertURL {
+		if _, err = url.Parse(newSpec.AlertURL); err != nil {
+			return nil, errors.Errorf(errors.EventStreamsAlertInvalidURL)
+		}
+		a.spec.AlertURL = newSpec.AlertURL
+	}
+	if a.spec.FailureThreshold != newSpec.FailureThreshold && newSpec.FailureThreshold != 0 {
+		a.spec.FailureThreshold = newSpec.FailureThreshold
+	}
+	if newSpec.DeadLetter != nil {
+		if err = validateDeadLetter(a.sm, newSpec.DeadLetter); err != nil {
+			return nil, err
+		}
+		a.spec.DeadLetter = newSpec.DeadLetter
+	}
+	if newSpec.MaxRetry != nil {
+		if err = validateMaxRetry(newSpec.MaxRetry); err != nil {
+			return nil, err
+		}
+		a.spec.MaxRetry = newSpec.MaxRetry
+	}
+	if newSpec.CircuitBreaker != nil {
+		if newSpec.CircuitBreaker.CooldownSec == 0 {
+			newSpec.CircuitBreaker.CooldownSec = defaultCircuitCooldownSec
+		}
+		a.spec.CircuitBreaker = newSpec.CircuitBreaker
+	}
+	if newSpec.Catchup != nil {
+		if err = validateCatchup(newSpec.Catchup); err != nil {
+			return nil, err
+		}
+		a.spec.Catchup = newSpec.Catchup
+	}
+	if newSpec.Inactivity != nil {
+		if err = validateInactivity(newSpec.Inactivity, false, a.spec.Type == "websocket"); err != nil {
+			return nil, err
+		}
+		a.spec.Inactivity = newSpec.Inactivity
+	}
 	return a.spec, nil
 }
 
@@ -368,6 +577,8 @@ func (a *eventStream) resume() error {
 		return errors.Errorf(errors.EventStreamsWebhookResumeActive, a.spec.Suspended)
 	}
 	a.spec.Suspended = false
+	a.spec.SuspendedReason = ""
+	a.consecutiveFailures = 0
 
 	a.startEventHandlers(true)
 	a.batchCond.Broadcast()
@@ -464,6 +675,9 @@ func (a *eventStream) eventPoller() {
 				blockUpdatedFilterStale = false
 			}
 		}
+		if a.checkInactivity(ctx, subs) {
+			break
+		}
 		// the event poller reacts to notification about a stream update, else it starts
 		// another round of polling after completion of the pollingInterval
 		select {
@@ -561,6 +775,9 @@ func (a *eventStream) suspendOrStop() bool {
 // it might be blocked for very large periods of time
 func (a *eventStream) batchProcessor() {
 	defer close(a.batchProcessorDone)
+	if closeable, ok := a.action.(closeableAction); ok {
+		defer closeable.close()
+	}
 
 	for {
 		// Wait for the next batch, or to be stopped
@@ -602,6 +819,9 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 	}
 	processed := false
 	attempt := 0
+	delivery := &batchDelivery{number: batchNumber, id: utils.UUIDv4()}
+	a.delivery = delivery
+	defer func() { a.delivery = nil }()
 	for !a.suspendOrStop() && !processed {
 		if attempt > 0 {
 			select {
@@ -613,15 +833,28 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 			}
 		}
 		attempt++
-		log.Infof("%s: Batch %d initiated with %d events. FirstBlock=%s LastBlock=%s", a.spec.ID, batchNumber, len(events), events[0].BlockNumber, events[len(events)-1].BlockNumber)
-		err := a.performActionWithRetry(batchNumber, events)
+		log.Infof("%s: Batch %d initiated with %d events. BatchID=%s FirstBlock=%s LastBlock=%s", a.spec.ID, batchNumber, len(events), delivery.id, events[0].BlockNumber, events[len(events)-1].BlockNumber)
+		err := a.performActionWithRetry(delivery, events)
 		// If we got an error after all of the internal retries within the event
 		// handler failed, then the ErrorHandling strategy kicks in
 		processed = (err == nil)
 		if !processed {
 			log.Errorf("%s: Batch %d attempt %d failed. ErrorHandling=%s BlockedRetryDelay=%ds err=%s",
 				a.spec.ID, batchNumber, attempt, a.spec.ErrorHandling, a.spec.BlockedRetryDelaySec, err)
-			processed = (a.spec.ErrorHandling == ErrorHandlingSkip)
+			// With a dead letter queue, the stream moves on once the batch is safely stored,
+			// whatever the ErrorHandling strategy
+			if a.spec.DeadLetter != nil && !a.suspendOrStop() {
+				if dlErr := a.deadLetter(batchNumber, events, err); dlErr != nil {
+					log.Errorf("%s: Failed to dead letter batch %d: %s", a.spec.ID, batchNumber, dlErr)
+				} else {
+					processed = true
+				}
+			}
+			processed = processed || (a.spec.ErrorHandling == ErrorHandlingSkip)
+			// A blocking stream only retries for up to the max retry duration, if one is set
+			if !processed && a.maxRetryExceeded(delivery) && !a.suspendOrStop() {
+				processed = a.terminalFailure(delivery, events, err)
+			}
 		}
 	}
 
@@ -650,41 +883,124 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 }
 
 // performActionWithRetry performs an action, with exponential backoff retry up
-// to a given threshold
-func (a *eventStream) performActionWithRetry(batchNumber uint64, events []*eventData) (err error) {
+// to a given threshold. The attempts are numbered across all the calls for a batch
+func (a *eventStream) performActionWithRetry(delivery *batchDelivery, events []*eventData) (err error) {
 	startTime := time.Now()
 	endTime := startTime.Add(time.Duration(a.spec.RetryTimeoutSec) * time.Second)
 	delay := a.initialRetryDelay
+	batchNumber := delivery.number
 	var attempt uint64
 	complete := false
 
 	for !a.suspendOrStop() && !complete {
+		// The wait is the longer of the backoff and the time left with the circuit open
+		var wait time.Duration
 		if attempt > 0 {
-			log.Infof("%s: Waiting %.2fs before re-attempting batch %d", a.spec.ID, delay.Seconds(), batchNumber)
+			wait = delay
+			delay = time.Duration(float64(delay) * a.backoffFactor)
+		}
+		if openFor := a.circuitOpenFor(); openFor > wait {
+			wait = openFor
+		}
+		if wait > 0 {
+			log.Infof("%s: Waiting %.2fs before re-attempting batch %d", a.spec.ID, wait.Seconds(), batchNumber)
 			select {
 			case <-a.updateInterrupt:
 				// we were notified by the caller about an ongoing update, no need to continue
 				log.Infof("%s: Notified of an ongoing stream update, terminating perform action for batch number: %d", a.spec.ID, batchNumber)
 				return
-			case <-time.After(delay): //fall through and continue
+			case <-time.After(wait): //fall through and continue
 			}
-			delay = time.Duration(float64(delay) * a.backoffFactor)
 		}
+		a.circuitTrial()
 		attempt++
-		err = a.action.attemptBatch(batchNumber, attempt, events)
+		delivery.attempts++
+		if delivery.firstAttempt.IsZero() {
+			delivery.firstAttempt = time.Now()
+		}
+		err = a.action.attemptBatch(batchNumber, delivery.attempts, events)
+		a.recordDeliveryMetrics(len(events), delivery.attempts > 1, err)
+		a.recordDeliveryResult(err)
+		a.updateCircuit(err)
 		complete = err == nil || time.Until(endTime) < 0
 	}
 	return err
 }
 
-// isAddressSafe checks for local IPs
-func (a *eventStream) isAddressUnsafe(ip *net.IPAddr) bool {
+// recordDeliveryResult tracks consecutive delivery failures, and suspends the stream
+// once the failure threshold is reached, so a dead consumer is not masked by
+// retrying forever
+func (a *eventStream) recordDeliveryResult(err error) {
+	a.batchCond.L.Lock()
+	if err == nil {
+		a.consecutiveFailures = 0
+		a.batchCond.L.Unlock()
+		return
+	}
+	a.consecutiveFailures++
+	failures := a.consecutiveFailures
+	threshold := a.spec.FailureThreshold
+	suspend := threshold > 0 && failures >= threshold && !a.suspendOrStop()
+	if suspend {
+		a.spec.Suspended = true
+		a.spec.SuspendedReason = errors.Errorf(errors.EventStreamsFailureThresholdReached, failures, err).Error()
+		a.batchCond.Broadcast()
+	}
+	a.batchCond.L.Unlock()
+	if !suspend {
+		return
+	}
+
+	log.Errorf("%s: Suspending after %d consecutive delivery failures: %s", a.spec.ID, failures, err)
+	if _, storeErr := a.sm.storeStream(a.spec); storeErr != nil {
+		log.Errorf("%s: Failed to persist suspended stream: %s", a.spec.ID, storeErr)
+	}
+	if a.spec.AlertURL != "" {
+		if alertErr := a.sendAlert(&streamAlert{
+			Type:                "streamSuspended",
+			StreamID:            a.spec.ID,
+			Name:                a.spec.Name,
+			ConsecutiveFailures: failures,
+			Error:               err.Error(),
+			Timestamp:           time.Now().UTC().Format(time.RFC3339Nano),
+		}); alertErr != nil {
+			log.Errorf("%s: Failed to send alert to %s: %s", a.spec.ID, a.spec.AlertURL, alertErr)
+		}
+	}
+}
+
+// sendAlert POSTs an alert to the alert URL configured on the stream
+func (a *eventStream) sendAlert(alert *streamAlert) error {
+	u, err := url.Parse(a.spec.AlertURL)
+	if err != nil {
+		return err
+	}
+	if _, err := ResolveWebhookAddress(a.allowPrivateIPs, a.allowedHosts, u); err != nil {
+		return err
+	}
+	reqBytes, _ := json.Marshal(alert)
+	client := &http.Client{Timeout: 30 * time.Second}
+	log.Infof("%s: POST alert --> %s", a.spec.ID, u.String())
+	res, err := client.Post(u.String(), "application/json", bytes.NewReader(reqBytes))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, a.spec.ID, res.StatusCode)
+	}
+	return nil
+}
+
+// isAddressUnsafe checks for local, private and link-local IPs
+func isAddressUnsafe(allowPrivateIPs bool, ip *net.IPAddr) bool {
 	ip4 := ip.IP.To4()
-	return !a.allowPrivateIPs &&
+	return !allowPrivateIPs &&
 		(ip4[0] == 0 ||
 			ip4[0] >= 224 ||
 			ip4[0] == 127 ||
 			ip4[0] == 10 ||
+			(ip4[0] == 169 && ip4[1] == 254) ||
 			(ip4[0] == 172 && ip4[1] >= 16 && ip4[1] < 32) ||
 			(ip4[0] == 192 && ip4[1] == 168))
 }
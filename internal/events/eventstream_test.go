@@ -32,6 +32,7 @@ import (
 	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
 	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/ws"
 	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
 	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
@@ -64,6 +65,34 @@ func TestConstructorMissingWebhook(t *testing.T) {
 	assert.Regexp("Must specify webhook.url for action type 'webhook'", err)
 }
 
+func TestConstructorUnresolvedWebhookSecret(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	sm.conf.WebhooksSecretsEnvPrefix = "ETHCONNECT_TEST_"
+	_, err := newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:     "http://test.invalid",
+			Headers: map[string]string{"Authorization": "${env:ETHCONNECT_TEST_MISSING}"},
+		},
+	}, nil)
+	assert.Regexp("Cannot resolve webhook secret", err)
+}
+
+func TestConstructorWebhookSecretNotPermitted(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:   "123",
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:        "http://test.invalid",
+			HMACSecret: "${file:/proc/self/environ}",
+		},
+	}, nil)
+	assert.Regexp("FFEC100398", err)
+}
+
 func TestConstructorBadWebhookURL(t *testing.T) {
 	assert := assert.New(t)
 	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
@@ -338,6 +367,129 @@ func TestBackoffRetry(t *testing.T) {
 	}
 }
 
+func TestFailureThresholdSuspendsAndAlerts(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	alerts := make(chan *streamAlert, 1)
+	alertSvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var alert streamAlert
+		json.NewDecoder(req.Body).Decode(&alert)
+		alerts <- &alert
+		res.WriteHeader(204)
+	}))
+	defer alertSvr.Close()
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:            1,
+			Name:                 "stream1",
+			Webhook:              &webhookActionInfo{},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 1,
+			FailureThreshold:     2,
+			AlertURL:             alertSvr.URL,
+		}, db, 404)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop(false)
+	stream.spec.BlockedRetryDelaySec = 0
+
+	go func() {
+		for range eventStream {
+		}
+	}()
+	complete := false
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		batchComplete: func(*eventData) { complete = true },
+	})
+
+	alert := <-alerts
+	assert.Equal("streamSuspended", alert.Type)
+	assert.Equal(stream.spec.ID, alert.StreamID)
+	assert.Equal("stream1", alert.Name)
+	assert.Equal(uint64(2), alert.ConsecutiveFailures)
+	assert.Regexp("404", alert.Error)
+
+	<-stream.batchProcessorDone
+	assert.False(complete)
+	assert.True(stream.spec.Suspended)
+	assert.Regexp("Suspended after 2 consecutive delivery failures", stream.spec.SuspendedReason)
+
+	// The suspension is persisted
+	b, err := db.Get(stream.spec.ID)
+	assert.NoError(err)
+	var stored StreamInfo
+	json.Unmarshal(b, &stored)
+	assert.True(stored.Suspended)
+
+	// Resuming resets the failure count
+	<-stream.eventPollerDone
+	err = sm.ResumeStream(context.Background(), stream.spec.ID)
+	assert.NoError(err)
+	assert.False(stream.spec.Suspended)
+	assert.Empty(stream.spec.SuspendedReason)
+	assert.Equal(uint64(0), stream.consecutiveFailures)
+}
+
+func TestFailureThresholdResetOnSuccess(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream()
+	defer stream.stop(false)
+	stream.spec.FailureThreshold = 2
+
+	stream.recordDeliveryResult(fmt.Errorf("pop"))
+	stream.recordDeliveryResult(nil)
+	stream.recordDeliveryResult(fmt.Errorf("pop"))
+	assert.False(stream.spec.Suspended)
+	assert.Equal(uint64(1), stream.consecutiveFailures)
+}
+
+func TestFailureThresholdAlertFails(t *testing.T) {
+	assert := assert.New(t)
+	alertSvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer alertSvr.Close()
+
+	stream := newTestStream()
+	defer stream.stop(false)
+	stream.spec.FailureThreshold = 1
+	stream.spec.AlertURL = alertSvr.URL
+
+	stream.allowPrivateIPs = false
+	err := stream.sendAlert(&streamAlert{})
+	assert.Regexp("Cannot send Webhook POST to address", err)
+
+	stream.allowPrivateIPs = true
+	err = stream.sendAlert(&streamAlert{})
+	assert.Regexp("status=500", err)
+
+	stream.spec.AlertURL = "http://badhost.example.invalid"
+	err = stream.sendAlert(&streamAlert{})
+	assert.Error(err)
+
+	// Failures to alert do not prevent the suspension
+	stream.recordDeliveryResult(fmt.Errorf("pop"))
+	assert.True(stream.spec.Suspended)
+}
+
+func TestConstructorBadAlertURL(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:   "123",
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL: "http://hello.example.com/world",
+		},
+		AlertURL: ":badurl",
+	}, nil)
+	assert.Regexp("Invalid URL in alertURL of event stream", err)
+}
+
 func TestBlockedAddresses(t *testing.T) {
 	assert := assert.New(t)
 	_, stream, svr, eventStream := newTestStreamForBatching(
@@ -521,7 +673,7 @@ func setupTestSubscriptionWithRPCHandler(assert *assert.Assertions, sm *subscrip
 		ABIType: contractregistry.LocalABI,
 		Name:    "test-abi",
 	}
-	s, err := sm.AddSubscription(ctx, &addr, loc, event, stream.spec.ID, "", subscriptionName)
+	s, err := sm.AddSubscription(ctx, &addr, loc, event, nil, stream.spec.ID, "", subscriptionName)
 	assert.NoError(err)
 	return s
 }
@@ -605,7 +757,7 @@ func setupCatchupTestSubscription(assert *assert.Assertions, sm *subscriptionMGR
 	}
 	addr := ethbind.API.HexToAddress("0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca")
 	ctx := context.Background()
-	s, _ := sm.AddSubscription(ctx, &addr, nil, event, stream.spec.ID, "0", subscriptionName)
+	s, _ := sm.AddSubscription(ctx, &addr, nil, event, nil, stream.spec.ID, "0", subscriptionName)
 	return s
 }
 
@@ -1035,6 +1187,38 @@ func TestInterruptWebSocketReceive(t *testing.T) {
 	wg.Wait()
 }
 
+func TestWebSocketConnectionsInStreamStatus(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	wsChannels := sm.wsChannels.(*mockWebSocket)
+	wsChannels.connections = []*ws.ConnectionInfo{
+		{ID: "conn1", RemoteAddr: "127.0.0.1:12345", Connected: "2021-01-01T00:00:00Z"},
+	}
+	ctx := context.Background()
+
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type:      "websocket",
+		WebSocket: &webSocketActionInfo{Topic: "topic1"},
+	})
+	assert.NoError(err)
+	assert.Nil(stream.Connections)
+
+	retStream, err := sm.StreamByID(ctx, stream.ID)
+	assert.NoError(err)
+	assert.Equal("topic1", wsChannels.capturedNamespace)
+	assert.Equal("conn1", retStream.Connections[0].ID)
+	assert.Nil(sm.streams[stream.ID].spec.Connections)
+
+	sm.rpc.(*ethmocks.RPCClient).On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").Return(fmt.Errorf("pop"))
+	streams := sm.Streams(ctx)
+	assert.Equal(1, len(streams))
+	assert.Equal("127.0.0.1:12345", streams[0].Connections[0].RemoteAddr)
+
+	err = sm.DeleteStream(ctx, stream.ID)
+	assert.NoError(err)
+	sm.Close(true)
+}
+
 func TestCheckpointRecovery(t *testing.T) {
 	assert := assert.New(t)
 	sm, stream, svr, eventStream := newTestStreamForBatching(
@@ -1284,6 +1468,7 @@ func TestUpdateStream(t *testing.T) {
 		BatchSize:            4,
 		BatchTimeoutMS:       10000,
 		BlockedRetryDelaySec: 5,
+		RetryTimeoutSec:      30,
 		ErrorHandling:        ErrorHandlingBlock,
 		Name:                 "new-name",
 		Webhook: &webhookActionInfo{
@@ -1291,9 +1476,12 @@ func TestUpdateStream(t *testing.T) {
 			Headers:           headers,
 			TLSkipHostVerify:  true,
 			RequestTimeoutSec: 0,
+			HMACSecret:        "secret1",
 		},
-		Timestamps: true,
-		Inputs:     true,
+		Timestamps:       true,
+		Inputs:           true,
+		FailureThreshold: 50,
+		AlertURL:         "http://alert.url",
 	}
 	updatedStream, err := sm.UpdateStream(ctx, stream.spec.ID, updateSpec)
 	assert.Equal(updatedStream.Name, "new-name")
@@ -1302,11 +1490,51 @@ func TestUpdateStream(t *testing.T) {
 	assert.Equal(updatedStream.BatchSize, uint64(4))
 	assert.Equal(updatedStream.BatchTimeoutMS, uint64(10000))
 	assert.Equal(updatedStream.BlockedRetryDelaySec, uint64(5))
+	assert.Equal(updatedStream.RetryTimeoutSec, uint64(30))
 	assert.Equal(updatedStream.ErrorHandling, ErrorHandlingBlock)
 	assert.Equal(updatedStream.Webhook.URL, "http://foo.url")
-	assert.Equal(updatedStream.Webhook.Headers["test-h1"], "val1")
+	assert.Equal(updatedStream.Webhook.Headers["test-h1"], "***")
+	assert.Equal(stream.spec.Webhook.Headers["test-h1"], "val1")
+	assert.Equal(updatedStream.Webhook.HMACSecret, "***")
+	assert.Equal(stream.spec.Webhook.HMACSecret, "secret1")
+	assert.Equal(updatedStream.FailureThreshold, uint64(50))
+	assert.Equal(updatedStream.AlertURL, "http://alert.url")
+
+	assert.NoError(err)
+}
+
+func TestUpdateStreamPartial(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling:   ErrorHandlingBlock,
+			BatchSize:       5,
+			RetryTimeoutSec: 60,
+			Webhook:         &webhookActionInfo{},
+		}, db, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop(false)
+
+	// Events in a partially filled batch are discarded, and do not leave the stream blocked
+	for i := 0; i < 3; i++ {
+		stream.handleEvent(testEvent(fmt.Sprintf("sub%d", i)))
+	}
+	updatedStream, err := sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{BatchSize: 2})
+	assert.NoError(err)
+	assert.Equal(uint64(2), updatedStream.BatchSize)
+	assert.Equal(ErrorHandlingBlock, updatedStream.ErrorHandling)
+	assert.Equal(uint64(60), updatedStream.RetryTimeoutSec)
+	assert.Equal(svr.URL, updatedStream.Webhook.URL)
+	assert.False(stream.isBlocked())
 
+	updatedStream, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{ErrorHandling: "SKIP"})
 	assert.NoError(err)
+	assert.Equal(ErrorHandlingSkip, updatedStream.ErrorHandling)
 }
 
 func TestUpdateStreamFail(t *testing.T) {
@@ -1519,6 +1747,32 @@ func TestUpdateStreamInvalidWebhookURL(t *testing.T) {
 	sm.Close(true)
 }
 
+func TestUpdateStreamUnresolvedWebhookSecret(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, _ := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling: ErrorHandlingBlock,
+			Webhook:       &webhookActionInfo{},
+		}, db, 200)
+	defer svr.Close()
+	defer sm.Close(true)
+	sm.conf.WebhooksSecretsDir = dir
+
+	updateSpec := &StreamInfo{
+		Webhook: &webhookActionInfo{
+			URL:       "http://test.invalid",
+			BasicAuth: &webhookBasicAuth{Username: "user1", Password: "${file:does-not-exist}"},
+		},
+	}
+	_, err := sm.UpdateStream(context.Background(), stream.spec.ID, updateSpec)
+	assert.Regexp(errors.EventStreamsWebhookSecretUnresolved.Code(), err)
+	assert.Nil(stream.spec.Webhook.BasicAuth)
+}
+
 func TestUpdateStreamDuplicateCall(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
+	log "github.com/sirupsen/logrus"
+)
+
+// HeartbeatConf configures a periodic record of the chain head and the checkpoints of every
+// stream, as an external audit trail that event processing was live and current over time.
+// The latest heartbeat is always available from the API, and is optionally sent to a
+// webhook and/or a Kafka topic
+type HeartbeatConf struct {
+	IntervalSec uint64 `json:"intervalSec,omitempty"`
+	WebhookURL  string `json:"webhookURL,omitempty"`
+	KafkaTopic  string `json:"kafkaTopic,omitempty"`
+}
+
+// Heartbeat is the view of the gateway of the chain, and of the progress of each stream, at a point in time
+type Heartbeat struct {
+	Timestamp string             `json:"timestamp"`
+	ChainHead *big.Int           `json:"chainHead,omitempty"`
+	Streams   []*HeartbeatStream `json:"streams"`
+}
+
+// HeartbeatStream is the progress of a stream in a heartbeat. The checkpoints are the
+// persisted block of each subscription on the stream, by subscription ID
+type HeartbeatStream struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name,omitempty"`
+	Suspended   bool                `json:"suspended"`
+	Checkpoints map[string]*big.Int `json:"checkpoints"`
+	SyncStatus
+}
+
+func (s *subscriptionMGR) startHeartbeat() error {
+	conf := &s.conf.Heartbeat
+	if conf.IntervalSec == 0 {
+		return nil
+	}
+	if conf.KafkaTopic != "" && len(s.conf.Kafka.Brokers) == 0 {
+		return errors.Errorf(errors.EventStreamsHeartbeatKafkaNotConfigured, conf.KafkaTopic)
+	}
+	log.Infof("Recording the event processing heartbeat every %ds", conf.IntervalSec)
+	s.heartbeatStop = make(chan struct{})
+	s.heartbeatDone = make(chan struct{})
+	go s.heartbeatLoop(time.Duration(conf.IntervalSec) * time.Second)
+	return nil
+}
+
+func (s *subscriptionMGR) stopHeartbeat() {
+	if s.heartbeatStop != nil {
+		close(s.heartbeatStop)
+		<-s.heartbeatDone
+		s.heartbeatStop = nil
+	}
+}
+
+func (s *subscriptionMGR) heartbeatLoop(interval time.Duration) {
+	defer close(s.heartbeatDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.recordHeartbeat(context.Background())
+		case <-s.heartbeatStop:
+			return
+		}
+	}
+}
+
+// newHeartbeat captures the chain head, and the checkpoint and sync status of each stream
+func (s *subscriptionMGR) newHeartbeat(ctx context.Context) *Heartbeat {
+	streams := s.allStreams()
+	hb := &Heartbeat{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		ChainHead: s.chainHead(ctx),
+		Streams:   make([]*HeartbeatStream, 0, len(streams)),
+	}
+	checkpoints := make(map[string]map[string]*big.Int)
+	for _, stream := range streams {
+		id := stream.spec.ID
+		checkpoint, err := s.loadCheckpoint(id)
+		if err != nil {
+			log.Warnf("%s: Failed to load checkpoint for the heartbeat: %s", id, err)
+		}
+		checkpoints[id] = checkpoint
+		hs := &HeartbeatStream{
+			ID:          id,
+			Name:        stream.spec.Name,
+			Suspended:   stream.spec.Suspended,
+			Checkpoints: make(map[string]*big.Int, len(checkpoint)),
+			SyncStatus:  s.streamSyncStatus(id, hb.ChainHead, checkpoints),
+		}
+		for subID, block := range checkpoint {
+			hs.Checkpoints[subID] = block
+		}
+		hb.Streams = append(hb.Streams, hs)
+	}
+	sort.Slice(hb.Streams, func(i, j int) bool { return hb.Streams[i].ID < hb.Streams[j].ID })
+	return hb
+}
+
+// recordHeartbeat keeps the latest heartbeat for the API, and sends it to the configured sinks.
+// A failure to send is logged, and does not affect event processing
+func (s *subscriptionMGR) recordHeartbeat(ctx context.Context) {
+	hb := s.newHeartbeat(ctx)
+	s.heartbeatMux.Lock()
+	s.heartbeat = hb
+	s.heartbeatMux.Unlock()
+
+	conf := &s.conf.Heartbeat
+	b, _ := json.Marshal(hb)
+	if conf.WebhookURL != "" {
+		if err := s.postHeartbeat(ctx, conf.WebhookURL, b); err != nil {
+			log.Errorf("Failed to send heartbeat to %s: %s", conf.WebhookURL, err)
+		}
+	}
+	if conf.KafkaTopic != "" {
+		producer, err := s.kafkaProducer()
+		if err == nil {
+			err = producer.SendBatch(conf.KafkaTopic, []*kafka.KafkaBatchMessage{{Value: b}})
+		}
+		if err != nil {
+			log.Errorf("Failed to send heartbeat to Kafka topic '%s': %s", conf.KafkaTopic, err)
+		}
+	}
+}
+
+func (s *subscriptionMGR) postHeartbeat(ctx context.Context, url string, b []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	log.Debugf("POST heartbeat --> %s", url)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, "heartbeat", res.StatusCode)
+	}
+	return nil
+}
+
+// LastHeartbeat returns the latest heartbeat that was recorded
+func (s *subscriptionMGR) LastHeartbeat(ctx context.Context) (*Heartbeat, error) {
+	if s.conf.Heartbeat.IntervalSec == 0 {
+		return nil, errors.Errorf(errors.EventStreamsHeartbeatNotEnabled)
+	}
+	s.heartbeatMux.Lock()
+	defer s.heartbeatMux.Unlock()
+	if s.heartbeat == nil {
+		return nil, errors.Errorf(errors.EventStreamsHeartbeatNotRecorded)
+	}
+	return s.heartbeat, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestHeartbeatSubscriptionManager(assert *assert.Assertions) (*subscriptionMGR, *StreamInfo, *SubscriptionInfo) {
+	sm, stream, sub := newTestCheckpointSubscription(assert)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Run(func(args mock.Arguments) {
+			args[1].(*ethbinding.HexBigInt).ToInt().SetInt64(1000)
+		}).
+		Return(nil)
+	sm.rpc = rpc
+	sm.config().Heartbeat.IntervalSec = 60
+	sm.storeCheckpoint(stream.ID, map[string]*big.Int{sub.ID: big.NewInt(990)})
+	return sm, stream, sub
+}
+
+func TestHeartbeatDisabled(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close(false)
+
+	assert.NoError(sm.startHeartbeat())
+	assert.Nil(sm.heartbeatStop)
+	_, err := sm.LastHeartbeat(context.Background())
+	assert.Regexp("The event processing heartbeat is not enabled", err)
+}
+
+func TestHeartbeatKafkaNotConfigured(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close(false)
+	sm.config().Heartbeat = HeartbeatConf{IntervalSec: 1, KafkaTopic: "heartbeats"}
+
+	err := sm.startHeartbeat()
+	assert.Regexp("Kafka brokers must be configured for events to send heartbeats to topic 'heartbeats'", err)
+}
+
+func TestRecordHeartbeat(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestHeartbeatSubscriptionManager(assert)
+	defer sm.Close(false)
+
+	received := make(chan []byte, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		received <- b
+		res.WriteHeader(204)
+	}))
+	defer svr.Close()
+	p := &testKafkaProducer{}
+	sm.kafka = p
+	sm.config().Heartbeat.WebhookURL = svr.URL
+	sm.config().Heartbeat.KafkaTopic = "heartbeats"
+
+	_, err := sm.LastHeartbeat(context.Background())
+	assert.Regexp("No event processing heartbeat has been recorded yet", err)
+
+	sm.recordHeartbeat(context.Background())
+
+	hb, err := sm.LastHeartbeat(context.Background())
+	assert.NoError(err)
+	assert.NotEmpty(hb.Timestamp)
+	assert.Equal(int64(1000), hb.ChainHead.Int64())
+	assert.Equal(1, len(hb.Streams))
+	assert.Equal(stream.ID, hb.Streams[0].ID)
+	assert.True(hb.Streams[0].Suspended)
+	assert.Equal(int64(990), hb.Streams[0].Checkpoints[sub.ID].Int64())
+	assert.Equal(int64(990), hb.Streams[0].CurrentBlock.Int64())
+	assert.Equal(int64(10), hb.Streams[0].BlocksBehind.Int64())
+
+	var posted Heartbeat
+	err = json.Unmarshal(<-received, &posted)
+	assert.NoError(err)
+	assert.Equal(hb.Timestamp, posted.Timestamp)
+	assert.Equal(int64(990), posted.Streams[0].Checkpoints[sub.ID].Int64())
+
+	assert.Equal("heartbeats", p.topic)
+	assert.Equal(1, len(p.msgs))
+	var sent Heartbeat
+	err = json.Unmarshal(p.msgs[0].Value, &sent)
+	assert.NoError(err)
+	assert.Equal(hb.Timestamp, sent.Timestamp)
+}
+
+func TestRecordHeartbeatSendFailures(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, _ := newTestHeartbeatSubscriptionManager(assert)
+	defer sm.Close(false)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer svr.Close()
+	sm.kafka = &testKafkaProducer{err: fmt.Errorf("pop")}
+	sm.config().Heartbeat.WebhookURL = svr.URL
+	sm.config().Heartbeat.KafkaTopic = "heartbeats"
+
+	sm.recordHeartbeat(context.Background())
+
+	hb, err := sm.LastHeartbeat(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, len(hb.Streams))
+
+	err = sm.postHeartbeat(context.Background(), svr.URL, []byte("{}"))
+	assert.Regexp("heartbeat: Failed with status=500", err)
+	err = sm.postHeartbeat(context.Background(), ":badurl", []byte("{}"))
+	assert.Error(err)
+	err = sm.postHeartbeat(context.Background(), "http://localhost:0", []byte("{}"))
+	assert.Error(err)
+}
+
+func TestHeartbeatLoop(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, _ := newTestHeartbeatSubscriptionManager(assert)
+
+	assert.NoError(sm.startHeartbeat())
+	sm.stopHeartbeat()
+	assert.Nil(sm.heartbeatStop)
+
+	sm.heartbeatStop = make(chan struct{})
+	sm.heartbeatDone = make(chan struct{})
+	go sm.heartbeatLoop(1 * time.Millisecond)
+	for {
+		if _, err := sm.LastHeartbeat(context.Background()); err == nil {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	sm.Close(false)
+	assert.Nil(sm.heartbeatStop)
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// InactivityActionSuspend suspends a stream once it has been inactive for the timeout
+	InactivityActionSuspend = "suspend"
+	// InactivityActionDelete deletes a stream or subscription once it has been inactive for the timeout
+	InactivityActionDelete = "delete"
+)
+
+// inactivityInfo is a policy to clean up an abandoned stream or subscription, after no events
+// have been detected for it for the timeout, or for a WebSocket stream after no consumer has been
+// connected to its topic for the no-consumer timeout. An alert is sent to the alert URL of the
+// stream when the warning period is reached, and again when the action is taken
+type inactivityInfo struct {
+	TimeoutSec    uint64 `json:"timeoutSec,omitempty"`
+	NoConsumerSec uint64 `json:"noConsumerSec,omitempty"` // Time with no consumer connected to a WebSocket stream
+	Action        string `json:"action,omitempty"`
+	WarningSec    uint64 `json:"warningSec,omitempty"` // Time before the timeout to send the warning alert
+}
+
+// inactivityState tracks whether the warning has been sent, since the last activity
+type inactivityState struct {
+	warned bool
+}
+
+func validateInactivity(spec *inactivityInfo, forSubscription, webSocket bool) error {
+	if spec == nil {
+		return nil
+	}
+	if (spec.TimeoutSec == 0 && spec.NoConsumerSec == 0) || (spec.WarningSec > 0 && spec.WarningSec >= spec.TimeoutSec) {
+		return errors.Errorf(errors.EventStreamsInactivityInvalidTimeout)
+	}
+	if spec.NoConsumerSec > 0 && (forSubscription || !webSocket) {
+		return errors.Errorf(errors.EventStreamsInactivityNoConsumerNotWebSocket)
+	}
+	spec.Action = strings.ToLower(spec.Action)
+	switch spec.Action {
+	case "":
+		if forSubscription {
+			spec.Action = InactivityActionDelete
+		} else {
+			spec.Action = InactivityActionSuspend
+		}
+	case InactivityActionDelete:
+	case InactivityActionSuspend:
+		if forSubscription {
+			return errors.Errorf(errors.EventStreamsInactivityInvalidAction, spec.Action)
+		}
+	default:
+		return errors.Errorf(errors.EventStreamsInactivityInvalidAction, spec.Action)
+	}
+	return nil
+}
+
+// check returns whether the warning is due, for the first time since the last activity,
+// and whether the timeout has been reached
+func (st *inactivityState) check(spec *inactivityInfo, idle time.Duration) (warn, expired bool) {
+	if spec.TimeoutSec == 0 {
+		return false, false
+	}
+	timeout := time.Duration(spec.TimeoutSec) * time.Second
+	if idle >= timeout {
+		return false, true
+	}
+	if spec.WarningSec > 0 && idle >= timeout-time.Duration(spec.WarningSec)*time.Second {
+		warn = !st.warned
+		st.warned = true
+		return warn, false
+	}
+	st.warned = false
+	return false, false
+}
+
+// lastActivity is the time an event was last detected for the subscription, or the
+// subscription was started on the stream
+func (lp *logProcessor) getLastActivity() time.Time {
+	lp.hwnSync.Lock()
+	defer lp.hwnSync.Unlock()
+	return lp.lastActivity
+}
+
+// dispatch passes an event to the stream, recording the activity on the subscription
+func (lp *logProcessor) dispatch(event *eventData) {
+	lp.hwnSync.Lock()
+	lp.lastActivity = time.Now()
+	lp.hwnSync.Unlock()
+	lp.stream.handleEvent(event)
+}
+
+// checkInactivity applies the inactivity policies of the stream, and its subscriptions.
+// It is called on the event poller, and returns true if the stream has been suspended
+// or deleted, so polling should stop
+func (a *eventStream) checkInactivity(ctx context.Context, subs []*subscription) bool {
+	now := time.Now()
+	streamActivity := a.activeSince
+	for _, sub := range subs {
+		if sub.lp == nil || sub.deleting {
+			continue
+		}
+		subActivity := sub.lp.getLastActivity()
+		if subActivity.After(streamActivity) {
+			streamActivity = subActivity
+		}
+		spec := sub.info.Inactivity
+		if spec == nil {
+			continue
+		}
+		if a.activeSince.After(subActivity) {
+			subActivity = a.activeSince
+		}
+		idle := now.Sub(subActivity)
+		warn, expired := sub.inactivity.check(spec, idle)
+		if warn {
+			log.Warnf("%s: No events for %s, subscription will be deleted in %ds", sub.logName, idle.Round(time.Second), spec.TimeoutSec-uint64(idle.Seconds()))
+			a.sendInactivityAlert("inactivityWarning", sub.info.ID, spec.Action, idle)
+		} else if expired {
+			log.Warnf("%s: Deleting subscription after no events for %s", sub.logName, idle.Round(time.Second))
+			if err := a.sm.DeleteSubscription(ctx, sub.info.ID); err != nil {
+				log.Errorf("%s: Failed to delete inactive subscription: %s", sub.logName, err)
+			}
+			a.sendInactivityAlert("inactivityExpired", sub.info.ID, spec.Action, idle)
+		}
+	}
+
+	spec := a.spec.Inactivity
+	if spec == nil {
+		return false
+	}
+	if spec.NoConsumerSec > 0 && a.spec.Type == "websocket" {
+		if len(a.webSocketConnections()) > 0 {
+			a.consumerSeen = now
+		}
+		disconnected := now.Sub(a.consumerSeen)
+		if disconnected >= time.Duration(spec.NoConsumerSec)*time.Second {
+			log.Warnf("%s: Stream is being %sd after no consumer was connected for %s", a.spec.ID, spec.Action, disconnected.Round(time.Second))
+			return a.expireStream(ctx, spec, disconnected, errors.Errorf(errors.EventStreamsInactivityNoConsumer, disconnected.Round(time.Second)))
+		}
+	}
+	idle := now.Sub(streamActivity)
+	warn, expired := a.inactivity.check(spec, idle)
+	if warn {
+		log.Warnf("%s: No events for %s, stream will be %sd in %ds", a.spec.ID, idle.Round(time.Second), spec.Action, spec.TimeoutSec-uint64(idle.Seconds()))
+		a.sendInactivityAlert("inactivityWarning", "", spec.Action, idle)
+		return false
+	}
+	if !expired {
+		return false
+	}
+	log.Warnf("%s: Stream is being %sd after no events for %s", a.spec.ID, spec.Action, idle.Round(time.Second))
+	return a.expireStream(ctx, spec, idle, errors.Errorf(errors.EventStreamsInactivityTimeout, idle.Round(time.Second)))
+}
+
+// expireStream takes the action of the inactivity policy of the stream, recording the reason
+// on a suspended stream, and returns true if the stream has been suspended or deleted
+func (a *eventStream) expireStream(ctx context.Context, spec *inactivityInfo, idle time.Duration, reason error) bool {
+	if spec.Action == InactivityActionDelete {
+		if err := a.sm.DeleteStream(ctx, a.spec.ID); err != nil {
+			log.Errorf("%s: Failed to delete inactive stream: %s", a.spec.ID, err)
+			return false
+		}
+	} else {
+		a.batchCond.L.Lock()
+		a.spec.Suspended = true
+		a.spec.SuspendedReason = reason.Error()
+		a.batchCond.Broadcast()
+		a.batchCond.L.Unlock()
+		if _, err := a.sm.storeStream(a.spec); err != nil {
+			log.Errorf("%s: Failed to persist suspended stream: %s", a.spec.ID, err)
+		}
+	}
+	a.sendInactivityAlert("inactivityExpired", "", spec.Action, idle)
+	return true
+}
+
+func (a *eventStream) sendInactivityAlert(alertType, subID, action string, idle time.Duration) {
+	if a.spec.AlertURL == "" {
+		return
+	}
+	if err := a.sendAlert(&streamAlert{
+		Type:           alertType,
+		StreamID:       a.spec.ID,
+		SubscriptionID: subID,
+		Name:           a.spec.Name,
+		Action:         action,
+		InactiveSec:    uint64(idle.Seconds()),
+		Timestamp:      time.Now().UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		log.Errorf("%s: Failed to send alert to %s: %s", a.spec.ID, a.spec.AlertURL, err)
+	}
+}
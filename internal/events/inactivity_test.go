@@ -0,0 +1,344 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/ws"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestInactivityStream(sm subscriptionManager, spec *inactivityInfo) (*eventStream, chan *streamAlert, func()) {
+	alerts := make(chan *streamAlert, 10)
+	alertSvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var alert streamAlert
+		json.NewDecoder(req.Body).Decode(&alert)
+		alerts <- &alert
+		res.WriteHeader(204)
+	}))
+	stream := &eventStream{
+		sm:              sm,
+		spec:            &StreamInfo{ID: "stream1", Name: "test", AlertURL: alertSvr.URL, Inactivity: spec},
+		allowPrivateIPs: true,
+		batchCond:       sync.NewCond(&sync.Mutex{}),
+		activeSince:     time.Now(),
+	}
+	return stream, alerts, alertSvr.Close
+}
+
+func TestValidateInactivity(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateInactivity(nil, false, false))
+
+	err := validateInactivity(&inactivityInfo{}, false, false)
+	assert.Regexp("Inactivity policies must have a timeoutSec", err)
+
+	err = validateInactivity(&inactivityInfo{TimeoutSec: 10, WarningSec: 10}, false, false)
+	assert.Regexp("Inactivity policies must have a timeoutSec", err)
+
+	spec := &inactivityInfo{TimeoutSec: 10}
+	assert.NoError(validateInactivity(spec, false, false))
+	assert.Equal(InactivityActionSuspend, spec.Action)
+
+	spec = &inactivityInfo{TimeoutSec: 10}
+	assert.NoError(validateInactivity(spec, true, false))
+	assert.Equal(InactivityActionDelete, spec.Action)
+
+	spec = &inactivityInfo{TimeoutSec: 10, Action: "Delete"}
+	assert.NoError(validateInactivity(spec, false, false))
+	assert.Equal(InactivityActionDelete, spec.Action)
+
+	err = validateInactivity(&inactivityInfo{TimeoutSec: 10, Action: "suspend"}, true, false)
+	assert.Regexp("Invalid inactivity action 'suspend'", err)
+
+	err = validateInactivity(&inactivityInfo{TimeoutSec: 10, Action: "wrong"}, false, false)
+	assert.Regexp("Invalid inactivity action 'wrong'", err)
+
+	spec = &inactivityInfo{NoConsumerSec: 10}
+	assert.NoError(validateInactivity(spec, false, true))
+	assert.Equal(InactivityActionSuspend, spec.Action)
+
+	err = validateInactivity(&inactivityInfo{NoConsumerSec: 10, WarningSec: 5}, false, true)
+	assert.Regexp("Inactivity policies must have a timeoutSec", err)
+
+	err = validateInactivity(&inactivityInfo{NoConsumerSec: 10}, false, false)
+	assert.Regexp("FFEC100404", err)
+
+	err = validateInactivity(&inactivityInfo{TimeoutSec: 10, NoConsumerSec: 10}, true, false)
+	assert.Regexp("FFEC100404", err)
+}
+
+func TestInactivityStateCheck(t *testing.T) {
+	assert := assert.New(t)
+	spec := &inactivityInfo{TimeoutSec: 10, WarningSec: 5}
+	st := &inactivityState{}
+
+	warn, expired := st.check(spec, 1*time.Second)
+	assert.False(warn)
+	assert.False(expired)
+
+	warn, expired = st.check(spec, 6*time.Second)
+	assert.True(warn)
+	assert.False(expired)
+
+	warn, expired = st.check(spec, 7*time.Second)
+	assert.False(warn)
+	assert.False(expired)
+
+	// Activity resets the warning
+	warn, _ = st.check(spec, 1*time.Second)
+	assert.False(warn)
+	warn, _ = st.check(spec, 6*time.Second)
+	assert.True(warn)
+
+	warn, expired = st.check(spec, 10*time.Second)
+	assert.False(warn)
+	assert.True(expired)
+
+	// A policy with only a no-consumer timeout never expires on idle time
+	warn, expired = st.check(&inactivityInfo{NoConsumerSec: 10}, 1000*time.Second)
+	assert.False(warn)
+	assert.False(expired)
+}
+
+func TestCheckInactivityStreamSuspend(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{TimeoutSec: 1, Action: InactivityActionSuspend})
+	defer done()
+	stream.activeSince = time.Now().Add(-2 * time.Second)
+
+	assert.True(stream.checkInactivity(context.Background(), nil))
+	assert.True(stream.spec.Suspended)
+	assert.Regexp("Suspended after no events for 2s", stream.spec.SuspendedReason)
+
+	alert := <-alerts
+	assert.Equal("inactivityExpired", alert.Type)
+	assert.Equal("stream1", alert.StreamID)
+	assert.Equal("suspend", alert.Action)
+	assert.Equal(uint64(2), alert.InactiveSec)
+	assert.Empty(m.deletedStream)
+}
+
+func TestCheckInactivityStreamWarnThenDelete(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{TimeoutSec: 10, WarningSec: 5, Action: InactivityActionDelete})
+	defer done()
+	stream.activeSince = time.Now().Add(-6 * time.Second)
+
+	assert.False(stream.checkInactivity(context.Background(), nil))
+	alert := <-alerts
+	assert.Equal("inactivityWarning", alert.Type)
+	assert.Equal("delete", alert.Action)
+
+	// The warning is only sent once
+	assert.False(stream.checkInactivity(context.Background(), nil))
+	assert.Empty(alerts)
+
+	stream.activeSince = time.Now().Add(-11 * time.Second)
+	assert.True(stream.checkInactivity(context.Background(), nil))
+	assert.Equal("stream1", m.deletedStream)
+	alert = <-alerts
+	assert.Equal("inactivityExpired", alert.Type)
+	assert.False(stream.spec.Suspended)
+}
+
+func TestCheckInactivityNoConsumerSuspend(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{NoConsumerSec: 1, Action: InactivityActionSuspend})
+	defer done()
+	wsChannels := &mockWebSocket{connections: []*ws.ConnectionInfo{{ID: "conn1"}}}
+	stream.spec.Type = "websocket"
+	stream.spec.WebSocket = &webSocketActionInfo{Topic: "topic1"}
+	stream.wsChannels = wsChannels
+	stream.consumerSeen = time.Now().Add(-2 * time.Second)
+
+	// Events keep flowing, but the stream is only kept while a consumer is connected
+	assert.False(stream.checkInactivity(context.Background(), nil))
+	assert.Equal("topic1", wsChannels.capturedNamespace)
+	assert.False(stream.spec.Suspended)
+
+	wsChannels.connections = nil
+	assert.False(stream.checkInactivity(context.Background(), nil))
+	stream.consumerSeen = time.Now().Add(-2 * time.Second)
+	assert.True(stream.checkInactivity(context.Background(), nil))
+	assert.True(stream.spec.Suspended)
+	assert.Regexp("Suspended after no consumer was connected for 2s", stream.spec.SuspendedReason)
+
+	alert := <-alerts
+	assert.Equal("inactivityExpired", alert.Type)
+	assert.Equal("suspend", alert.Action)
+	assert.Equal(uint64(2), alert.InactiveSec)
+}
+
+func TestCheckInactivityNoConsumerDelete(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{TimeoutSec: 3600, NoConsumerSec: 1, Action: InactivityActionDelete})
+	defer done()
+	stream.spec.Type = "websocket"
+	stream.wsChannels = &mockWebSocket{}
+	stream.consumerSeen = time.Now().Add(-2 * time.Second)
+
+	assert.True(stream.checkInactivity(context.Background(), nil))
+	assert.Equal("stream1", m.deletedStream)
+	alert := <-alerts
+	assert.Equal("inactivityExpired", alert.Type)
+	assert.Equal("delete", alert.Action)
+}
+
+func TestCheckInactivityStreamDeleteFail(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{err: fmt.Errorf("pop")}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{TimeoutSec: 1, Action: InactivityActionDelete})
+	defer done()
+	stream.activeSince = time.Now().Add(-2 * time.Second)
+
+	assert.False(stream.checkInactivity(context.Background(), nil))
+	assert.Equal("stream1", m.deletedStream)
+	assert.Empty(alerts)
+}
+
+func TestCheckInactivitySubscriptions(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{err: fmt.Errorf("pop")}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{TimeoutSec: 10})
+	defer done()
+	stream.activeSince = time.Now().Add(-20 * time.Second)
+
+	idle := &subscription{
+		info: &SubscriptionInfo{ID: "sub1", Inactivity: &inactivityInfo{TimeoutSec: 10, Action: InactivityActionDelete}},
+		lp:   &logProcessor{lastActivity: time.Now().Add(-15 * time.Second)},
+	}
+	active := &subscription{
+		info: &SubscriptionInfo{ID: "sub2", Inactivity: &inactivityInfo{TimeoutSec: 10, Action: InactivityActionDelete}},
+		lp:   &logProcessor{lastActivity: time.Now()},
+	}
+	deleting := &subscription{
+		info:     &SubscriptionInfo{ID: "sub3", Inactivity: &inactivityInfo{TimeoutSec: 10, Action: InactivityActionDelete}},
+		lp:       &logProcessor{},
+		deleting: true,
+	}
+
+	// The active subscription keeps the stream alive, even though the other is deleted
+	assert.False(stream.checkInactivity(context.Background(), []*subscription{idle, active, deleting}))
+	assert.Equal([]string{"sub1"}, m.deletedSubs)
+	assert.False(stream.spec.Suspended)
+	alert := <-alerts
+	assert.Equal("inactivityExpired", alert.Type)
+	assert.Equal("sub1", alert.SubscriptionID)
+	assert.Empty(alerts)
+}
+
+func TestCheckInactivitySubscriptionWarning(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream, alerts, done := newTestInactivityStream(m, nil)
+	defer done()
+	stream.activeSince = time.Now().Add(-20 * time.Second)
+
+	sub := &subscription{
+		info: &SubscriptionInfo{ID: "sub1", Inactivity: &inactivityInfo{TimeoutSec: 10, WarningSec: 5, Action: InactivityActionDelete}},
+		lp:   &logProcessor{lastActivity: time.Now().Add(-7 * time.Second)},
+	}
+	assert.False(stream.checkInactivity(context.Background(), []*subscription{sub}))
+	alert := <-alerts
+	assert.Equal("inactivityWarning", alert.Type)
+	assert.Equal("sub1", alert.SubscriptionID)
+	assert.Empty(m.deletedSubs)
+}
+
+func TestCheckInactivityNoAlertURL(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream, alerts, done := newTestInactivityStream(m, &inactivityInfo{TimeoutSec: 1})
+	defer done()
+	stream.spec.AlertURL = ""
+	stream.activeSince = time.Now().Add(-2 * time.Second)
+
+	assert.True(stream.checkInactivity(context.Background(), nil))
+	assert.True(stream.spec.Suspended)
+	assert.Empty(alerts)
+}
+
+func TestDispatchRecordsActivity(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream()
+	defer stream.stop(false)
+
+	lp := newLogProcessor("sub1", nil, stream)
+	lp.lastActivity = time.Time{}
+	lp.dispatch(&eventData{SubID: "sub1", batchComplete: func(*eventData) {}})
+	assert.False(lp.getLastActivity().IsZero())
+}
+
+func TestEventPollerSuspendsInactiveStream(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:         "123",
+		Type:       "WebHook",
+		Webhook:    &webhookActionInfo{URL: "http://hello.example.com/world"},
+		Inactivity: &inactivityInfo{TimeoutSec: 1},
+	}, nil)
+	assert.NoError(err)
+	defer stream.stop(false)
+
+	<-stream.eventPollerDone
+	assert.True(stream.spec.Suspended)
+	assert.Regexp("Suspended after no events", stream.spec.SuspendedReason)
+}
+
+func TestInactivityValidatedOnCreateAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, err := newEventStream(sm, &StreamInfo{
+		ID:         "123",
+		Type:       "WebHook",
+		Webhook:    &webhookActionInfo{URL: "http://hello.example.com/world"},
+		Inactivity: &inactivityInfo{},
+	}, nil)
+	assert.Regexp("Inactivity policies must have a timeoutSec", err)
+
+	_, err = newEventStream(sm, &StreamInfo{
+		ID:         "123",
+		Type:       "WebHook",
+		Webhook:    &webhookActionInfo{URL: "http://hello.example.com/world"},
+		Inactivity: &inactivityInfo{NoConsumerSec: 60},
+	}, nil)
+	assert.Regexp("noConsumerSec is only supported on WebSocket streams", err)
+
+	stream := newTestStream()
+	defer stream.stop(false)
+	_, err = stream.update(&StreamInfo{Inactivity: &inactivityInfo{TimeoutSec: 60, Action: "wrong"}})
+	assert.Regexp("Invalid inactivity action 'wrong'", err)
+	spec, err := stream.update(&StreamInfo{Inactivity: &inactivityInfo{TimeoutSec: 60, Action: "Delete"}})
+	assert.NoError(err)
+	assert.Equal(InactivityActionDelete, spec.Inactivity.Action)
+
+	_, err = sm.newSubscriptionFromDTO(nil, &SubscriptionCreateDTO{Inactivity: &inactivityInfo{TimeoutSec: 60, Action: "suspend"}})
+	assert.Regexp("Invalid inactivity action 'suspend'", err)
+}
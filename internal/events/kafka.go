@@ -0,0 +1,117 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// KafkaKeyByAddress keys each message by the address of the contract that emitted the event
+	KafkaKeyByAddress = "address"
+	// KafkaKeyByArg keys each message by the value of an event argument, such as an indexed argument
+	KafkaKeyByArg = "arg"
+	// KafkaKeyByNone sends each message without a key
+	KafkaKeyByNone = "none"
+)
+
+type kafkaActionInfo struct {
+	Topic  string `json:"topic,omitempty"`
+	KeyBy  string `json:"keyBy,omitempty"`
+	KeyArg string `json:"keyArg,omitempty"`
+}
+
+type kafkaAction struct {
+	es   *eventStream
+	spec *kafkaActionInfo
+}
+
+func validateKafka(sm subscriptionManager, spec *kafkaActionInfo) error {
+	if len(sm.config().Kafka.Brokers) == 0 {
+		return errors.Errorf(errors.EventStreamsKafkaNotConfigured)
+	}
+	if spec == nil || spec.Topic == "" {
+		return errors.Errorf(errors.EventStreamsKafkaNoTopic)
+	}
+	spec.KeyBy = strings.ToLower(spec.KeyBy)
+	switch spec.KeyBy {
+	case "":
+		spec.KeyBy = KafkaKeyByAddress
+	case KafkaKeyByAddress, KafkaKeyByNone:
+	case KafkaKeyByArg:
+		if spec.KeyArg == "" {
+			return errors.Errorf(errors.EventStreamsKafkaInvalidKey, spec.KeyBy)
+		}
+	default:
+		return errors.Errorf(errors.EventStreamsKafkaInvalidKey, spec.KeyBy)
+	}
+	return nil
+}
+
+func newKafkaAction(es *eventStream, spec *kafkaActionInfo) (*kafkaAction, error) {
+	if err := validateKafka(es.sm, spec); err != nil {
+		return nil, err
+	}
+	return &kafkaAction{
+		es:   es,
+		spec: spec,
+	}, nil
+}
+
+// messageKey returns the key for an event, so all events for the same contract, or
+// with the same argument value, are delivered to the same partition in order.
+// Events without the argument fall back to the contract address
+func (k *kafkaAction) messageKey(event *eventData) string {
+	switch k.spec.KeyBy {
+	case KafkaKeyByNone:
+		return ""
+	case KafkaKeyByArg:
+		if v, ok := event.Data[k.spec.KeyArg]; ok && v != nil {
+			if s, ok := v.(string); ok {
+				return s
+			}
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return event.Address
+}
+
+// attemptBatch publishes each event in the batch as a message to the topic, and
+// returns once all of them have been acknowledged by Kafka
+func (k *kafkaAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
+	producer, err := k.es.sm.kafkaProducer()
+	if err != nil {
+		return err
+	}
+	msgs := make([]*kafka.KafkaBatchMessage, len(events))
+	for i, event := range events {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msgs[i] = &kafka.KafkaBatchMessage{
+			Key:   k.messageKey(event),
+			Value: b,
+		}
+	}
+	log.Infof("%s: Sending batch %d (attempt %d) of %d events to Kafka topic '%s'", k.es.spec.ID, batchNumber, attempt, len(events), k.spec.Topic)
+	return producer.SendBatch(k.spec.Topic, msgs)
+}
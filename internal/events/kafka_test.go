@@ -0,0 +1,203 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+type testKafkaProducer struct {
+	topic  string
+	msgs   []*kafka.KafkaBatchMessage
+	err    error
+	closed bool
+}
+
+func (p *testKafkaProducer) SendBatch(topic string, msgs []*kafka.KafkaBatchMessage) error {
+	p.topic = topic
+	p.msgs = msgs
+	return p.err
+}
+
+func (p *testKafkaProducer) Close() {
+	p.closed = true
+}
+
+func newTestKafkaSubscriptionManager() *subscriptionMGR {
+	sm := newTestSubscriptionManager()
+	sm.config().Kafka.Brokers = []string{"broker1"}
+	sm.kafkaFactory = kafka.NewMockKafkaFactory()
+	return sm
+}
+
+func TestNewKafkaActionValidation(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestKafkaSubscriptionManager()
+	es := &eventStream{sm: sm}
+
+	_, err := newKafkaAction(es, nil)
+	assert.Regexp("Must specify kafka.topic for action type 'kafka'", err)
+
+	_, err = newKafkaAction(es, &kafkaActionInfo{Topic: "topic1", KeyBy: "wrong"})
+	assert.Regexp("Invalid kafka.keyBy 'wrong'", err)
+
+	_, err = newKafkaAction(es, &kafkaActionInfo{Topic: "topic1", KeyBy: "arg"})
+	assert.Regexp("Invalid kafka.keyBy 'arg'", err)
+
+	k, err := newKafkaAction(es, &kafkaActionInfo{Topic: "topic1"})
+	assert.NoError(err)
+	assert.Equal(KafkaKeyByAddress, k.spec.KeyBy)
+
+	k, err = newKafkaAction(es, &kafkaActionInfo{Topic: "topic1", KeyBy: "Arg", KeyArg: "from"})
+	assert.NoError(err)
+	assert.Equal(KafkaKeyByArg, k.spec.KeyBy)
+
+	sm.config().Kafka.Brokers = nil
+	_, err = newKafkaAction(es, &kafkaActionInfo{Topic: "topic1"})
+	assert.Regexp("Kafka brokers must be configured for events", err)
+}
+
+func TestKafkaActionAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	p := &testKafkaProducer{}
+	k := &kafkaAction{
+		es:   &eventStream{sm: &mockSubMgr{kafka: p}, spec: &StreamInfo{ID: "123"}},
+		spec: &kafkaActionInfo{Topic: "topic1", KeyBy: KafkaKeyByArg, KeyArg: "from"},
+	}
+
+	err := k.attemptBatch(1, 1, []*eventData{
+		{Address: "0x1111", Data: map[string]interface{}{"from": "0xaaaa"}},
+		{Address: "0x2222", Data: map[string]interface{}{"from": 12345}},
+		{Address: "0x3333", Data: map[string]interface{}{}},
+	})
+	assert.NoError(err)
+	assert.Equal("topic1", p.topic)
+	assert.Equal(3, len(p.msgs))
+	assert.Equal("0xaaaa", p.msgs[0].Key)
+	assert.Equal("12345", p.msgs[1].Key)
+	assert.Equal("0x3333", p.msgs[2].Key)
+	var event eventData
+	err = json.Unmarshal(p.msgs[0].Value, &event)
+	assert.NoError(err)
+	assert.Equal("0x1111", event.Address)
+}
+
+func TestKafkaActionMessageKey(t *testing.T) {
+	assert := assert.New(t)
+	event := &eventData{Address: "0x1111", Data: map[string]interface{}{"from": "0xaaaa"}}
+
+	k := &kafkaAction{spec: &kafkaActionInfo{KeyBy: KafkaKeyByAddress}}
+	assert.Equal("0x1111", k.messageKey(event))
+	k.spec.KeyBy = KafkaKeyByNone
+	assert.Equal("", k.messageKey(event))
+	k.spec.KeyBy = KafkaKeyByArg
+	k.spec.KeyArg = "from"
+	assert.Equal("0xaaaa", k.messageKey(event))
+}
+
+func TestKafkaActionAttemptBatchFail(t *testing.T) {
+	assert := assert.New(t)
+	p := &testKafkaProducer{err: fmt.Errorf("pop")}
+	k := &kafkaAction{
+		es:   &eventStream{sm: &mockSubMgr{kafka: p}, spec: &StreamInfo{ID: "123"}},
+		spec: &kafkaActionInfo{Topic: "topic1", KeyBy: KafkaKeyByAddress},
+	}
+
+	err := k.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("pop", err)
+}
+
+func TestKafkaActionAttemptBatchNoProducer(t *testing.T) {
+	assert := assert.New(t)
+	k := &kafkaAction{
+		es:   &eventStream{sm: &mockSubMgr{err: fmt.Errorf("pop")}, spec: &StreamInfo{ID: "123"}},
+		spec: &kafkaActionInfo{Topic: "topic1", KeyBy: KafkaKeyByAddress},
+	}
+
+	err := k.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("pop", err)
+}
+
+func TestKafkaProducerSharedAndClosed(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestKafkaSubscriptionManager()
+
+	p1, err := sm.kafkaProducer()
+	assert.NoError(err)
+	p2, err := sm.kafkaProducer()
+	assert.NoError(err)
+	assert.Equal(p1, p2)
+
+	sm.Close(true)
+	assert.True(sm.kafkaFactory.(*kafka.MockKafkaFactory).Producer.Closed)
+	assert.Nil(sm.kafka)
+}
+
+func TestKafkaProducerConnectFail(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestKafkaSubscriptionManager()
+	sm.kafkaFactory = kafka.NewErrorMockKafkaFactory(fmt.Errorf("pop"), nil, nil)
+
+	_, err := sm.kafkaProducer()
+	assert.Regexp("Failed to connect to Kafka for event streams: pop", err)
+}
+
+func TestKafkaStreamCreateAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestKafkaSubscriptionManager()
+
+	stream, err := newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "Kafka",
+		Kafka: &kafkaActionInfo{
+			Topic: "topic1",
+		},
+	}, nil)
+	assert.NoError(err)
+	defer stream.stop(false)
+	assert.Equal("kafka", stream.spec.Type)
+	assert.Equal(KafkaKeyByAddress, stream.spec.Kafka.KeyBy)
+
+	_, err = stream.update(&StreamInfo{
+		Kafka: &kafkaActionInfo{
+			Topic: "topic2",
+			KeyBy: "none",
+		},
+	})
+	assert.NoError(err)
+	assert.Equal("topic2", stream.spec.Kafka.Topic)
+	assert.Equal(KafkaKeyByNone, stream.spec.Kafka.KeyBy)
+
+	_, err = stream.update(&StreamInfo{
+		Kafka: &kafkaActionInfo{},
+	})
+	assert.Regexp("Must specify kafka.topic for action type 'kafka'", err)
+}
+
+func TestKafkaStreamCreateNoTopic(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestKafkaSubscriptionManager()
+
+	_, err := newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "kafka",
+	}, nil)
+	assert.Regexp("Must specify kafka.topic for action type 'kafka'", err)
+}
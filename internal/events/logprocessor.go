@@ -15,10 +15,12 @@
 package events
 
 import (
+	"encoding/json"
 	"math/big"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
@@ -34,23 +36,43 @@ type logEntry struct {
 	TransactionHash  ethbinding.Hash        `json:"transactionHash"`
 	Data             string                 `json:"data"`
 	Topics           []*ethbinding.Hash     `json:"topics"`
+	BlockHash        *ethbinding.Hash       `json:"blockHash,omitempty"`
+	LogIndex         json.RawMessage        `json:"logIndex,omitempty"`
+	Removed          bool                   `json:"removed,omitempty"`
 	Timestamp        uint64                 `json:"timestamp,omitempty"`
 	InputMethod      string                 `json:"inputMethod,omitempty"`
 	InputArgs        map[string]interface{} `json:"inputArgs,omitempty"`
+	// event is set when the contract has been upgraded, to the event of its ABI at the block of the log
+	event *ethbinding.ABIEvent
+}
+
+// rawLogData is the log as returned by the node, included alongside the decoded fields for
+// a subscription with rawLog set, for consumers that re-verify the decoding or decode it themselves
+type rawLogData struct {
+	Topics           []*ethbinding.Hash   `json:"topics"`
+	Data             string               `json:"data"`
+	Removed          bool                 `json:"removed"`
+	BlockHash        *ethbinding.Hash     `json:"blockHash,omitempty"`
+	BlockNumber      ethbinding.HexBigInt `json:"blockNumber"`
+	TransactionHash  ethbinding.Hash      `json:"transactionHash"`
+	TransactionIndex ethbinding.HexUint   `json:"transactionIndex"`
+	LogIndex         json.RawMessage      `json:"logIndex,omitempty"` // as returned by the node
 }
 
 type eventData struct {
-	Address          string                 `json:"address"`
+	Address          string                 `json:"address,omitempty"`
 	BlockNumber      string                 `json:"blockNumber"`
-	TransactionIndex string                 `json:"transactionIndex"`
-	TransactionHash  string                 `json:"transactionHash"`
+	BlockHash        string                 `json:"blockHash,omitempty"` // only set for the header of a block
+	TransactionIndex string                 `json:"transactionIndex,omitempty"`
+	TransactionHash  string                 `json:"transactionHash,omitempty"`
 	Data             map[string]interface{} `json:"data"`
 	SubID            string                 `json:"subId"`
-	Signature        string                 `json:"signature"`
-	LogIndex         string                 `json:"logIndex"`
+	Signature        string                 `json:"signature,omitempty"`
+	LogIndex         string                 `json:"logIndex,omitempty"`
 	Timestamp        string                 `json:"timestamp,omitempty"`
 	InputMethod      string                 `json:"inputMethod,omitempty"`
 	InputArgs        map[string]interface{} `json:"inputArgs,omitempty"`
+	Raw              *rawLogData            `json:"raw,omitempty"`
 	// Used for callback handling
 	batchComplete func(*eventData)
 }
@@ -58,17 +80,21 @@ type eventData struct {
 type logProcessor struct {
 	subID             string
 	event             *ethbinding.ABIEvent
+	events            map[ethbinding.Hash]*ethbinding.ABIEvent // set for a subscription to all the events of a contract
 	stream            *eventStream
+	rawLog            bool // include the raw log in each event
 	blockHWM          big.Int
 	highestDispatched big.Int
+	lastActivity      time.Time // when an event was last dispatched, for the inactivity policies
 	hwnSync           sync.Mutex
 }
 
 func newLogProcessor(subID string, event *ethbinding.ABIEvent, stream *eventStream) *logProcessor {
 	return &logProcessor{
-		subID:  subID,
-		event:  event,
-		stream: stream,
+		subID:        subID,
+		event:        event,
+		stream:       stream,
+		lastActivity: time.Now(),
 	}
 }
 
@@ -107,8 +133,33 @@ func (lp *logProcessor) initBlockHWM(intVal *big.Int) {
 	lp.hwnSync.Unlock()
 }
 
+// logEvent returns the event to decode a log with, which for a subscription to all the events
+// of a contract is the one matching the first topic of the log, unless it was resolved from
+// the ABI version of an upgraded contract
+func (lp *logProcessor) logEvent(subInfo string, entry *logEntry) (*ethbinding.ABIEvent, error) {
+	if entry.event != nil {
+		return entry.event, nil
+	}
+	if lp.events == nil {
+		return lp.event, nil
+	}
+	topic := "<none>"
+	if len(entry.Topics) > 0 && entry.Topics[0] != nil {
+		if event, ok := lp.events[*entry.Topics[0]]; ok {
+			return event, nil
+		}
+		topic = entry.Topics[0].String()
+	}
+	return nil, errors.Errorf(errors.EventStreamsLogDecodeUnknownEvent, subInfo, topic)
+}
+
 func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int) (err error) {
 
+	event, err := lp.logEvent(subInfo, entry)
+	if err != nil {
+		return err
+	}
+
 	var data []byte
 	if strings.HasPrefix(entry.Data, "0x") {
 		data, err = ethbind.API.HexDecode(entry.Data)
@@ -123,7 +174,7 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 		BlockNumber:      blockNumber.String(),
 		TransactionIndex: entry.TransactionIndex.String(),
 		TransactionHash:  entry.TransactionHash.String(),
-		Signature:        ethbind.API.ABIEventSignature(lp.event),
+		Signature:        ethbind.API.ABIEventSignature(event),
 		Data:             make(map[string]interface{}),
 		SubID:            lp.subID,
 		LogIndex:         strconv.Itoa(idx),
@@ -134,24 +185,36 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 	if lp.stream.spec.Timestamps {
 		result.Timestamp = strconv.FormatUint(entry.Timestamp, 10)
 	}
+	if lp.rawLog {
+		result.Raw = &rawLogData{
+			Topics:           entry.Topics,
+			Data:             entry.Data,
+			Removed:          entry.Removed,
+			BlockHash:        entry.BlockHash,
+			BlockNumber:      entry.BlockNumber,
+			TransactionHash:  entry.TransactionHash,
+			TransactionIndex: entry.TransactionIndex,
+			LogIndex:         entry.LogIndex,
+		}
+	}
 	topicIdx := 0
-	if !lp.event.Anonymous {
+	if !event.Anonymous {
 		topicIdx++ // first index is the hash of the event description
 	}
 
 	// We need split out the indexed args that we parse out of the topic, from the data args
 	var dataArgs ethbinding.ABIArguments
-	dataArgs = make([]ethbinding.ABIArgument, 0, len(lp.event.Inputs))
-	for idx, input := range lp.event.Inputs {
+	dataArgs = make([]ethbinding.ABIArgument, 0, len(event.Inputs))
+	for idx, input := range event.Inputs {
 		var val interface{}
 		if input.Indexed {
 			if topicIdx >= len(entry.Topics) {
-				return errors.Errorf(errors.EventStreamsLogDecodeInsufficientTopics, subInfo, idx, ethbind.API.ABIEventSignature(lp.event))
+				return errors.Errorf(errors.EventStreamsLogDecodeInsufficientTopics, subInfo, idx, ethbind.API.ABIEventSignature(event))
 			}
 			topic := entry.Topics[topicIdx]
 			topicIdx++
 			if topic != nil {
-				val = topicToValue(topic, &input)
+				val = eth.TopicToValue(topic, &input)
 			} else {
 				val = nil
 			}
@@ -176,32 +239,6 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 		lp.highestDispatched.Set(blockNumber)
 	}
 	lp.hwnSync.Unlock()
-	lp.stream.handleEvent(result)
+	lp.dispatch(result)
 	return nil
 }
-
-func topicToValue(topic *ethbinding.Hash, input *ethbinding.ABIArgument) interface{} {
-	switch input.Type.T {
-	case ethbinding.IntTy, ethbinding.UintTy, ethbinding.BoolTy:
-		h := ethbinding.HexBigInt{}
-		_ = h.UnmarshalText([]byte(topic.Hex()))
-		bI, _ := ethbind.API.ParseBig256(topic.Hex())
-		if input.Type.T == ethbinding.IntTy {
-			// It will be a two's complement number, so needs to be interpretted
-			bI = ethbind.API.S256(bI)
-			return bI.String()
-		} else if input.Type.T == ethbinding.BoolTy {
-			return (bI.Uint64() != 0)
-		}
-		return bI.String()
-	case ethbinding.AddressTy:
-		topicBytes := topic.Bytes()
-		addrBytes := topicBytes[len(topicBytes)-20:]
-		return ethbind.API.BytesToAddress(addrBytes)
-	default:
-		// For all other types it is just a hash of the output for indexing, so we can only
-		// logically return it as a hex string. The Solidity developer has to include
-		// the same data a second type non-indexed to get the real value.
-		return topic.String()
-	}
-}
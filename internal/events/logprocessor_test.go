@@ -57,35 +57,6 @@ const sampleEventABIAllIndexedNoData = `
 }
 `
 
-func TestTopicToValue(t *testing.T) {
-	assert := assert.New(t)
-
-	h := ethbind.API.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffcfc7")
-	v := topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("int64")})
-	assert.Equal("-12345", v)
-
-	h = ethbind.API.HexToHash("0x000000000000000000000000000000000000000001d2d490d572353317a01f8d")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("uint256")})
-	assert.Equal("564363245346346345353453453", v)
-
-	h = ethbind.API.HexToHash("0x0000000000000000000000003924d1d6423f88148a4fcc0417a33b27a61d595f")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("address")})
-	assert.Equal(ethbind.API.HexToAddress("0x3924d1D6423F88148A4fcc0417A33B27a61d595f"), v)
-
-	h = ethbind.API.HexToHash("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("string")})
-	assert.Equal("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19", v)
-
-	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
-	assert.Equal(false, v)
-
-	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000001")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
-	assert.Equal(true, v)
-
-}
-
 func TestProcessLogEntryNillAndTooFewFields(t *testing.T) {
 	assert := assert.New(t)
 
@@ -183,3 +154,123 @@ func TestProcessLogSampleEvent(t *testing.T) {
 		"data2": "1000",
 	}, ev.Data)
 }
+
+func TestProcessLogSampleEventRawLog(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := &eventStream{
+		spec:        &StreamInfo{},
+		eventStream: make(chan *eventData, 1),
+	}
+	var marshaling ethbinding.ABIElementMarshaling
+	json.Unmarshal([]byte(sampleEventABIAllIndexedNoData), &marshaling)
+	event, _ := ethbind.API.ABIElementMarshalingToABIEvent(&marshaling)
+	lp := &logProcessor{
+		event:  event,
+		stream: stream,
+		rawLog: true,
+	}
+	var l logEntry
+	err := json.Unmarshal([]byte(sampleEventLogAllIndexedNoData), &l)
+	assert.NoError(err)
+	err = lp.processLogEntry(t.Name(), &l, 0)
+	assert.NoError(err)
+
+	ev := <-stream.eventStream
+	assert.Equal("1000", ev.Data["data2"])
+	b, err := json.Marshal(ev.Raw)
+	assert.NoError(err)
+	assert.JSONEq(`{
+		"topics": ["0x35d3551f6fc757e3146f18d79fbbaf97d788f77b23b07f25f5a80621072d5c70", "0x51b201b016025d42c9a0718b75aacc12b1e9c7f16e4bd2c6618aa944ca399156", "0x00000000000000000000000000000000000000000000000000000000000003e8"],
+		"data": "0x",
+		"removed": false,
+		"blockHash": "0xb6d8a38a89ac35a04ee6ebd5789a4a805dfa26c1b753c311db523ec9bf204384",
+		"blockNumber": "0x74082",
+		"transactionHash": "0x23307094299f08a1041de9f1e7ecb67197a5a3c11ce5be775a8147de266b7524",
+		"transactionIndex": "0x0",
+		"logIndex": 1
+	}`, string(b))
+
+	lp.rawLog = false
+	err = lp.processLogEntry(t.Name(), &l, 0)
+	assert.NoError(err)
+	ev = <-stream.eventStream
+	assert.Nil(ev.Raw)
+}
+
+func TestProcessLogAnonymousNonIndexedFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := &eventStream{
+		spec:        &StreamInfo{},
+		eventStream: make(chan *eventData, 1),
+	}
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&ethbinding.ABIElementMarshaling{
+		Type:      "event",
+		Name:      "Anon",
+		Anonymous: true,
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "value", Type: "uint256"},
+			{Name: "from", Type: "address", Indexed: true},
+		},
+	})
+	assert.NoError(err)
+	lp := &logProcessor{
+		event:  event,
+		stream: stream,
+	}
+	from := ethbind.API.HexToHash("0x0000000000000000000000000123456789abcdef0123456789abcdef01234567")
+	err = lp.processLogEntry(t.Name(), &logEntry{
+		Topics: []*ethbinding.Hash{&from},
+		Data:   "0x000000000000000000000000000000000000000000000000000000000000002a",
+	}, 0)
+	assert.NoError(err)
+
+	ev := <-stream.eventStream
+	assert.Equal("42", ev.Data["value"])
+	assert.Equal(ethbind.API.HexToAddress("0x0123456789abcDEF0123456789abCDef01234567"), ev.Data["from"])
+	assert.Equal("Anon(uint256,address)", ev.Signature)
+}
+
+func TestProcessLogAllEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := &eventStream{
+		spec:        &StreamInfo{},
+		eventStream: make(chan *eventData, 1),
+	}
+	var marshaling ethbinding.ABIElementMarshaling
+	json.Unmarshal([]byte(sampleEventABIAllIndexedNoData), &marshaling)
+	sampleEvent, _ := ethbind.API.ABIElementMarshalingToABIEvent(&marshaling)
+	otherEvent, _ := ethbind.API.ABIElementMarshalingToABIEvent(&ethbinding.ABIElementMarshaling{Type: "event", Name: "Other"})
+	lp := &logProcessor{
+		events: map[ethbinding.Hash]*ethbinding.ABIEvent{
+			sampleEvent.ID: sampleEvent,
+			otherEvent.ID:  otherEvent,
+		},
+		stream: stream,
+	}
+	var l logEntry
+	err := json.Unmarshal([]byte(sampleEventLogAllIndexedNoData), &l)
+	assert.NoError(err)
+	err = lp.processLogEntry(t.Name(), &l, 0)
+	assert.NoError(err)
+	ev := <-stream.eventStream
+	assert.Equal("SampleEvent(string,uint256)", ev.Signature)
+	assert.Equal("1000", ev.Data["data2"])
+
+	l.Topics = []*ethbinding.Hash{&otherEvent.ID}
+	err = lp.processLogEntry(t.Name(), &l, 1)
+	assert.NoError(err)
+	ev = <-stream.eventStream
+	assert.Equal("Other()", ev.Signature)
+
+	unknown := ethbinding.Hash{0x01}
+	l.Topics = []*ethbinding.Hash{&unknown}
+	err = lp.processLogEntry(t.Name(), &l, 2)
+	assert.Regexp("Log topic 0x01.* does not match any event in the ABI", err)
+
+	l.Topics = nil
+	err = lp.processLogEntry(t.Name(), &l, 3)
+	assert.Regexp("Log topic <none> does not match any event in the ABI", err)
+}
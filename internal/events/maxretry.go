@@ -0,0 +1,110 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxRetryActionSuspend suspends a stream once a batch has been retried for the max retry duration
+	MaxRetryActionSuspend = "suspend"
+	// MaxRetryActionSkip moves a stream on to the next batch once a batch has been retried for the max retry duration
+	MaxRetryActionSkip = "skip"
+)
+
+// maxRetryInfo bounds how long a stream with ErrorHandlingBlock retries a batch. Once the duration
+// is exceeded the batch is recorded as a terminal failure, with its events, and the action is taken
+type maxRetryInfo struct {
+	DurationSec uint64 `json:"durationSec"`
+	Action      string `json:"action,omitempty"`
+}
+
+func validateMaxRetry(spec *maxRetryInfo) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.DurationSec == 0 {
+		return errors.Errorf(errors.EventStreamsMaxRetryInvalidDuration)
+	}
+	spec.Action = strings.ToLower(spec.Action)
+	switch spec.Action {
+	case "":
+		spec.Action = MaxRetryActionSuspend
+	case MaxRetryActionSuspend, MaxRetryActionSkip:
+	default:
+		return errors.Errorf(errors.EventStreamsMaxRetryInvalidAction, spec.Action)
+	}
+	return nil
+}
+
+// maxRetryExceeded is true if the stream blocks on failures, and the first attempt of the
+// batch was longer ago than the max retry duration
+func (a *eventStream) maxRetryExceeded(delivery *batchDelivery) bool {
+	spec := a.spec.MaxRetry
+	if spec == nil || a.spec.ErrorHandling != ErrorHandlingBlock || delivery.firstAttempt.IsZero() {
+		return false
+	}
+	return time.Since(delivery.firstAttempt) >= time.Duration(spec.DurationSec)*time.Second
+}
+
+// terminalFailure stores a batch that exceeded the max retry duration in the dead letter store
+// of the stream, where it can be inspected and requeued, then takes the action of the policy.
+// It returns true if the stream should move on to the next batch. If the batch cannot be stored
+// it keeps being retried, so the events are not lost
+func (a *eventStream) terminalFailure(delivery *batchDelivery, events []*eventData, deliveryErr error) bool {
+	spec := a.spec.MaxRetry
+	dl := a.newDeadLetter(delivery.number, events, deliveryErr)
+	dl.Terminal = true
+	b, err := json.Marshal(dl)
+	if err == nil {
+		err = a.sm.storeDeadLetter(dl.StreamID, dl.ID, b)
+	}
+	if err != nil {
+		log.Errorf("%s: Failed to record terminal failure of batch %d: %s", a.spec.ID, delivery.number, err)
+		return false
+	}
+	retryDuration := time.Since(delivery.firstAttempt).Round(time.Second)
+	log.Errorf("%s: Batch %d recorded as terminal failure %s after retrying for %s. Action=%s", a.spec.ID, delivery.number, dl.ID, retryDuration, spec.Action)
+
+	if spec.Action == MaxRetryActionSuspend {
+		a.batchCond.L.Lock()
+		a.spec.Suspended = true
+		a.spec.SuspendedReason = errors.Errorf(errors.EventStreamsMaxRetryExceeded, delivery.number, retryDuration, deliveryErr).Error()
+		a.batchCond.Broadcast()
+		a.batchCond.L.Unlock()
+		if _, err := a.sm.storeStream(a.spec); err != nil {
+			log.Errorf("%s: Failed to persist suspended stream: %s", a.spec.ID, err)
+		}
+	}
+	if a.spec.AlertURL != "" {
+		if alertErr := a.sendAlert(&streamAlert{
+			Type:      "maxRetryExceeded",
+			StreamID:  a.spec.ID,
+			Name:      a.spec.Name,
+			Error:     deliveryErr.Error(),
+			Action:    spec.Action,
+			Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		}); alertErr != nil {
+			log.Errorf("%s: Failed to send alert to %s: %s", a.spec.ID, a.spec.AlertURL, alertErr)
+		}
+	}
+	return spec.Action == MaxRetryActionSkip
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMaxRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateMaxRetry(nil))
+
+	err := validateMaxRetry(&maxRetryInfo{})
+	assert.Regexp("Must specify maxRetry.durationSec greater than zero", err)
+
+	spec := &maxRetryInfo{DurationSec: 60}
+	assert.NoError(validateMaxRetry(spec))
+	assert.Equal(MaxRetryActionSuspend, spec.Action)
+
+	spec = &maxRetryInfo{DurationSec: 60, Action: "Skip"}
+	assert.NoError(validateMaxRetry(spec))
+	assert.Equal(MaxRetryActionSkip, spec.Action)
+
+	err = validateMaxRetry(&maxRetryInfo{DurationSec: 60, Action: "delete"})
+	assert.Regexp("Invalid maxRetry.action 'delete'", err)
+}
+
+func TestMaxRetryStreamCreateAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, err := newEventStream(sm, &StreamInfo{
+		ID:       "123",
+		Type:     "webhook",
+		Webhook:  &webhookActionInfo{URL: "http://test.invalid"},
+		MaxRetry: &maxRetryInfo{},
+	}, nil)
+	assert.Regexp("Must specify maxRetry.durationSec greater than zero", err)
+
+	stream, err := newEventStream(sm, &StreamInfo{
+		ID:       "123",
+		Type:     "webhook",
+		Webhook:  &webhookActionInfo{URL: "http://test.invalid"},
+		MaxRetry: &maxRetryInfo{DurationSec: 60},
+	}, nil)
+	assert.NoError(err)
+	defer stream.stop(false)
+	assert.Equal(MaxRetryActionSuspend, stream.spec.MaxRetry.Action)
+
+	_, err = stream.update(&StreamInfo{MaxRetry: &maxRetryInfo{DurationSec: 30, Action: "skip"}})
+	assert.NoError(err)
+	assert.Equal(uint64(30), stream.spec.MaxRetry.DurationSec)
+	assert.Equal(MaxRetryActionSkip, stream.spec.MaxRetry.Action)
+
+	_, err = stream.update(&StreamInfo{MaxRetry: &maxRetryInfo{DurationSec: 30, Action: "wrong"}})
+	assert.Regexp("Invalid maxRetry.action 'wrong'", err)
+}
+
+func TestMaxRetrySkipRecordsTerminalFailure(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:            1,
+			Webhook:              &webhookActionInfo{},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 1,
+			MaxRetry:             &maxRetryInfo{DurationSec: 1, Action: MaxRetryActionSkip},
+		}, db, 404)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop(false)
+
+	go func() {
+		for range eventStream {
+		}
+	}()
+	complete := make(chan bool, 1)
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		Address:       "0x1111",
+		batchComplete: func(*eventData) { complete <- true },
+	})
+	// The blocking stream moves on once the batch has been retried for the max duration
+	<-complete
+	assert.False(stream.spec.Suspended)
+
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 1)
+	assert.True(deadLetters[0].Terminal)
+	assert.Regexp("404", deadLetters[0].Error)
+	assert.Equal("0x1111", deadLetters[0].Events[0].Address)
+}
+
+func TestMaxRetrySuspendsAndAlerts(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	alerts := make(chan *streamAlert, 1)
+	alertSvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var alert streamAlert
+		json.NewDecoder(req.Body).Decode(&alert)
+		alerts <- &alert
+		res.WriteHeader(204)
+	}))
+	defer alertSvr.Close()
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:            1,
+			Name:                 "stream1",
+			Webhook:              &webhookActionInfo{},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 1,
+			MaxRetry:             &maxRetryInfo{DurationSec: 1},
+			AlertURL:             alertSvr.URL,
+		}, db, 404)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop(false)
+
+	go func() {
+		for range eventStream {
+		}
+	}()
+	complete := false
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		batchComplete: func(*eventData) { complete = true },
+	})
+
+	alert := <-alerts
+	assert.Equal("maxRetryExceeded", alert.Type)
+	assert.Equal("stream1", alert.Name)
+	assert.Equal(MaxRetryActionSuspend, alert.Action)
+	assert.Regexp("404", alert.Error)
+
+	<-stream.batchProcessorDone
+	assert.False(complete)
+	assert.True(stream.spec.Suspended)
+	assert.Regexp("Suspended after retrying batch 1 for", stream.spec.SuspendedReason)
+
+	b, err := db.Get(stream.spec.ID)
+	assert.NoError(err)
+	var stored StreamInfo
+	json.Unmarshal(b, &stored)
+	assert.True(stored.Suspended)
+
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 1)
+	assert.True(deadLetters[0].Terminal)
+}
+
+func TestMaxRetryTerminalFailureStoreFail(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream()
+	defer stream.stop(false)
+	stream.spec.MaxRetry = &maxRetryInfo{DurationSec: 1, Action: MaxRetryActionSkip}
+	stream.sm.(*subscriptionMGR).db = kvstore.NewMockKV(fmt.Errorf("pop"))
+
+	delivery := &batchDelivery{number: 1}
+	assert.False(stream.maxRetryExceeded(delivery))
+	assert.False(stream.terminalFailure(delivery, []*eventData{{}}, fmt.Errorf("bang")))
+	assert.False(stream.spec.Suspended)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+	"time"
+)
+
+// StreamMetrics reports the delivery of events by a stream, so operators can alert on
+// streams that are lagging or blocked. The counts are held in memory since the stream
+// was started, so are reset by a restart
+type StreamMetrics struct {
+	ID               string `json:"id"`
+	Since            string `json:"since"`
+	BatchesDelivered uint64 `json:"batchesDelivered"`
+	EventsDelivered  uint64 `json:"eventsDelivered"`
+	Retries          uint64 `json:"retries"`
+	InFlight         uint64 `json:"inFlight"`
+	LastDelivery     string `json:"lastDelivery,omitempty"`
+	SyncStatus
+}
+
+type streamMetrics struct {
+	since            time.Time
+	batchesDelivered uint64
+	eventsDelivered  uint64
+	retries          uint64
+	lastDelivery     time.Time
+}
+
+// recordDeliveryMetrics counts an attempt to deliver a batch. Any attempt after the first for the
+// same batch is a retry, whether it follows the exponential backoff or the blocked retry delay
+func (a *eventStream) recordDeliveryMetrics(events int, retry bool, err error) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if retry {
+		a.metrics.retries++
+	}
+	if err == nil {
+		a.metrics.batchesDelivered++
+		a.metrics.eventsDelivered += uint64(events)
+		a.metrics.lastDelivery = time.Now()
+	}
+}
+
+func (a *eventStream) deliveryMetrics() *StreamMetrics {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	m := &StreamMetrics{
+		ID:               a.spec.ID,
+		Since:            a.metrics.since.UTC().Format(time.RFC3339Nano),
+		BatchesDelivered: a.metrics.batchesDelivered,
+		EventsDelivered:  a.metrics.eventsDelivered,
+		Retries:          a.metrics.retries,
+		InFlight:         a.inFlight,
+	}
+	if !a.metrics.lastDelivery.IsZero() {
+		m.LastDelivery = a.metrics.lastDelivery.UTC().Format(time.RFC3339Nano)
+	}
+	return m
+}
+
+// StreamMetrics returns the delivery metrics of a stream, with the backlog of its slowest subscription
+func (s *subscriptionMGR) StreamMetrics(ctx context.Context, id string) (*StreamMetrics, error) {
+	stream, err := s.streamByID(id)
+	if err != nil {
+		return nil, err
+	}
+	m := stream.deliveryMetrics()
+	m.SyncStatus = s.streamSyncStatus(id, s.chainHead(ctx), make(map[string]map[string]*big.Int))
+	return m, nil
+}
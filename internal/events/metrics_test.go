@@ -0,0 +1,130 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamMetricsDeliveryAndRetries(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:            1,
+			Webhook:              &webhookActionInfo{},
+			ErrorHandling:        ErrorHandlingBlock,
+			RetryTimeoutSec:      1,
+			BlockedRetryDelaySec: 1,
+		}, nil, 500, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop(false)
+	stream.initialRetryDelay = 1 * time.Millisecond
+
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Run(func(args mock.Arguments) {
+			args[1].(*ethbinding.HexBigInt).ToInt().SetInt64(1000)
+		}).
+		Return(nil)
+	sm.rpc = rpc
+
+	complete := make(chan struct{})
+	go func() {
+		<-eventStream
+		<-eventStream
+	}()
+	stream.handleEvent(&eventData{
+		SubID:         "sb-1",
+		batchComplete: func(*eventData) { close(complete) },
+	})
+	<-complete
+
+	m, err := sm.StreamMetrics(context.Background(), stream.spec.ID)
+	assert.NoError(err)
+	assert.Equal(stream.spec.ID, m.ID)
+	assert.Equal(uint64(1), m.BatchesDelivered)
+	assert.Equal(uint64(1), m.EventsDelivered)
+	assert.Equal(uint64(1), m.Retries)
+	assert.Equal(uint64(0), m.InFlight)
+	assert.NotEmpty(m.Since)
+	assert.NotEmpty(m.LastDelivery)
+	assert.Nil(m.CurrentBlock)
+	assert.Equal(int64(1000), m.ChainHead.Int64())
+}
+
+func TestStreamMetricsBacklog(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Run(func(args mock.Arguments) {
+			args[1].(*ethbinding.HexBigInt).ToInt().SetInt64(1000)
+		}).
+		Return(nil)
+	sm := newTestSubscriptionManager()
+	sm.rpc = rpc
+	sm.streams["es-1"] = &eventStream{spec: &StreamInfo{ID: "es-1"}, batchCond: sync.NewCond(&sync.Mutex{})}
+	sm.subscriptions["sb-1"] = &subscription{info: &SubscriptionInfo{ID: "sb-1", Stream: "es-1"}, lp: &logProcessor{}}
+	sm.subscriptions["sb-2"] = &subscription{info: &SubscriptionInfo{ID: "sb-2", Stream: "es-1"}, lp: &logProcessor{}}
+	sm.storeCheckpoint("es-1", map[string]*big.Int{"sb-1": big.NewInt(990), "sb-2": big.NewInt(900)})
+
+	m, err := sm.StreamMetrics(context.Background(), "es-1")
+	assert.NoError(err)
+	assert.Equal(int64(900), m.CurrentBlock.Int64())
+	assert.Equal(int64(1000), m.ChainHead.Int64())
+	assert.Equal(int64(100), m.BlocksBehind.Int64())
+}
+
+func TestStreamMetricsBlockedRetries(t *testing.T) {
+	assert := assert.New(t)
+	stream := &eventStream{
+		spec:      &StreamInfo{ID: "es-1"},
+		batchCond: sync.NewCond(&sync.Mutex{}),
+	}
+
+	stream.recordDeliveryMetrics(5, false, fmt.Errorf("pop"))
+	stream.recordDeliveryMetrics(5, true, fmt.Errorf("pop"))
+	m := stream.deliveryMetrics()
+	assert.Equal(uint64(0), m.BatchesDelivered)
+	assert.Equal(uint64(0), m.EventsDelivered)
+	assert.Equal(uint64(1), m.Retries)
+	assert.Empty(m.LastDelivery)
+
+	stream.recordDeliveryMetrics(5, true, nil)
+	m = stream.deliveryMetrics()
+	assert.Equal(uint64(1), m.BatchesDelivered)
+	assert.Equal(uint64(5), m.EventsDelivered)
+	assert.Equal(uint64(2), m.Retries)
+	assert.NotEmpty(m.LastDelivery)
+}
+
+func TestStreamMetricsNotFound(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, err := sm.StreamMetrics(context.Background(), "missing")
+	assert.Regexp("Stream with ID 'missing' not found", err)
+}
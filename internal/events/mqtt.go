@@ -0,0 +1,241 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// mqttQoS is at-least-once delivery, so each batch is acknowledged by the broker before the checkpoint moves on
+	mqttQoS               = 1
+	mqttDefaultTimeoutSec = 30
+	mqttDisconnectQuiesce = 250
+)
+
+type mqttActionInfo struct {
+	BrokerURL         string           `json:"brokerURL,omitempty"`
+	Topic             string           `json:"topic,omitempty"`
+	ClientID          string           `json:"clientId,omitempty"`
+	Username          string           `json:"username,omitempty"`
+	Password          string           `json:"password,omitempty"`
+	TLS               *utils.TLSConfig `json:"tls,omitempty"`
+	RequestTimeoutSec uint32           `json:"requestTimeoutSec,omitempty"`
+}
+
+type mqttAction struct {
+	es     *eventStream
+	spec   *mqttActionInfo
+	client mqtt.Client
+}
+
+// validateMQTT checks the settings of an MQTT stream. The broker must be one of the hosts
+// webhooks are allowed to call, and TLS files must be in the webhook TLS directory, as the
+// broker is chosen by the API caller in the same way as the URL of a webhook
+func validateMQTT(conf *SubscriptionManagerConf, streamID string, spec *mqttActionInfo) error {
+	if spec == nil || spec.BrokerURL == "" {
+		return errors.Errorf(errors.EventStreamsMQTTNoBrokerURL)
+	}
+	u, err := url.Parse(spec.BrokerURL)
+	if err != nil || u.Host == "" {
+		return errors.Errorf(errors.EventStreamsMQTTInvalidBrokerURL, spec.BrokerURL)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss":
+	default:
+		return errors.Errorf(errors.EventStreamsMQTTInvalidBrokerURL, spec.BrokerURL)
+	}
+	if !isHostAllowed(conf.WebhooksAllowedHosts, u.Hostname()) {
+		return errors.Errorf(errors.EventStreamsWebhookHostNotAllowed, u.Hostname())
+	}
+	if _, err := mqttTLSConfig(conf, spec); err != nil {
+		return err
+	}
+	if spec.Topic == "" {
+		return errors.Errorf(errors.EventStreamsMQTTNoTopic)
+	}
+	if strings.ContainsAny(spec.Topic, "+#") {
+		return errors.Errorf(errors.EventStreamsMQTTInvalidTopic, spec.Topic)
+	}
+	if spec.ClientID == "" {
+		spec.ClientID = "ethconnect-" + streamID
+	}
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = mqttDefaultTimeoutSec
+	}
+	return nil
+}
+
+// mqttTLSConfig builds the TLS configuration for the connection to the broker, if TLS is enabled.
+// The files are read each time, so certificates can be rotated without recreating the stream
+func mqttTLSConfig(conf *SubscriptionManagerConf, spec *mqttActionInfo) (*tls.Config, error) {
+	if spec.TLS == nil || !spec.TLS.Enabled {
+		return nil, nil
+	}
+	tlsConf := *spec.TLS
+	var err error
+	if tlsConf.ClientCertsFile, err = webhookTLSFile(conf, spec.TLS.ClientCertsFile); err != nil {
+		return nil, err
+	}
+	if tlsConf.ClientKeyFile, err = webhookTLSFile(conf, spec.TLS.ClientKeyFile); err != nil {
+		return nil, err
+	}
+	if tlsConf.CACertsFile, err = webhookTLSFile(conf, spec.TLS.CACertsFile); err != nil {
+		return nil, err
+	}
+	t, err := utils.CreateTLSConfiguration(&tlsConf)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsMQTTTLSInvalid, err)
+	}
+	return t, nil
+}
+
+// redactMQTTPassword returns a copy of the MQTT settings of a stream with the password redacted.
+// References are not resolved for the MQTT password, so any value is redacted
+func redactMQTTPassword(spec *mqttActionInfo) *mqttActionInfo {
+	redacted := *spec
+	if redacted.Password != "" {
+		redacted.Password = redactedWebhookSecret
+	}
+	return &redacted
+}
+
+// restoreMQTTPassword keeps the stored password of the broker when an update echoes back
+// the redacted placeholder, so a stream read from the API can be updated
+func restoreMQTTPassword(existing, spec *mqttActionInfo) {
+	if existing == nil || spec == nil {
+		return
+	}
+	if spec.Password == redactedWebhookSecret {
+		spec.Password = existing.Password
+	}
+}
+
+func newMQTTAction(es *eventStream, spec *mqttActionInfo) (*mqttAction, error) {
+	if err := validateMQTT(es.sm.config(), es.spec.ID, spec); err != nil {
+		return nil, err
+	}
+	return &mqttAction{
+		es:   es,
+		spec: spec,
+	}, nil
+}
+
+// messageTopic resolves the placeholders in the topic template for an event, so events
+// can be routed to devices by the contract, subscription or event that they relate to
+func (m *mqttAction) messageTopic(event *eventData) string {
+	eventName := event.Signature
+	if i := strings.Index(eventName, "("); i >= 0 {
+		eventName = eventName[0:i]
+	}
+	return strings.NewReplacer(
+		"{{address}}", event.Address,
+		"{{subId}}", event.SubID,
+		"{{event}}", eventName,
+		"{{streamId}}", m.es.spec.ID,
+	).Replace(m.spec.Topic)
+}
+
+// connect returns the connected client, establishing a new connection if this is the
+// first batch, or the previous connection to the broker was lost
+func (m *mqttAction) connect() (mqtt.Client, error) {
+	if m.client != nil && m.client.IsConnectionOpen() {
+		return m.client, nil
+	}
+	m.close()
+	// The broker is resolved before each connection, to exclude private IP address ranges, as for webhooks
+	u, _ := url.Parse(m.spec.BrokerURL)
+	if _, err := ResolveWebhookAddress(m.es.allowPrivateIPs, m.es.allowedHosts, u); err != nil {
+		return nil, errors.Errorf(errors.EventStreamsMQTTConnectFailed, m.spec.BrokerURL, err)
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(m.spec.BrokerURL).
+		SetClientID(m.spec.ClientID).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectTimeout(time.Duration(m.spec.RequestTimeoutSec) * time.Second)
+	if m.spec.Username != "" {
+		opts.SetUsername(m.spec.Username)
+		opts.SetPassword(m.spec.Password)
+	}
+	tlsConfig, err := mqttTLSConfig(m.es.sm.config(), m.spec)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsMQTTConnectFailed, m.spec.BrokerURL, err)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	client := m.es.sm.newMQTTClient(opts)
+	log.Infof("%s: Connecting to MQTT broker %s as '%s'", m.es.spec.ID, m.spec.BrokerURL, m.spec.ClientID)
+	if err := m.wait(client.Connect()); err != nil {
+		return nil, errors.Errorf(errors.EventStreamsMQTTConnectFailed, m.spec.BrokerURL, err)
+	}
+	m.client = client
+	return client, nil
+}
+
+func (m *mqttAction) wait(token mqtt.Token) error {
+	if !token.WaitTimeout(time.Duration(m.spec.RequestTimeoutSec) * time.Second) {
+		return errors.Errorf(errors.EventStreamsMQTTTimeout, m.spec.RequestTimeoutSec)
+	}
+	return token.Error()
+}
+
+// close disconnects from the broker, which is done whenever the stream stops delivering
+// batches, so an update to the stream takes effect on the next connection
+func (m *mqttAction) close() {
+	if m.client != nil {
+		m.client.Disconnect(mqttDisconnectQuiesce)
+		m.client = nil
+	}
+}
+
+// attemptBatch publishes the events in the batch as a JSON array to each topic the
+// events resolve to, and returns once every message has been acknowledged by the broker
+func (m *mqttAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
+	client, err := m.connect()
+	if err != nil {
+		return err
+	}
+	var topics []string
+	byTopic := make(map[string][]*eventData)
+	for _, event := range events {
+		topic := m.messageTopic(event)
+		if _, exists := byTopic[topic]; !exists {
+			topics = append(topics, topic)
+		}
+		byTopic[topic] = append(byTopic[topic], event)
+	}
+	for _, topic := range topics {
+		b, err := json.Marshal(byTopic[topic])
+		if err != nil {
+			return err
+		}
+		log.Infof("%s: Publishing batch %d (attempt %d) of %d events to MQTT topic '%s'", m.es.spec.ID, batchNumber, attempt, len(byTopic[topic]), topic)
+		if err := m.wait(client.Publish(topic, mqttQoS, false, b)); err != nil {
+			return errors.Errorf(errors.EventStreamsMQTTPublishFailed, topic, err)
+		}
+	}
+	return nil
+}
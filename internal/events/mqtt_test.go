@@ -0,0 +1,311 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type testMQTTToken struct {
+	timeout bool
+	err     error
+}
+
+func (t *testMQTTToken) Wait() bool                     { return !t.timeout }
+func (t *testMQTTToken) WaitTimeout(time.Duration) bool { return !t.timeout }
+func (t *testMQTTToken) Done() <-chan struct{}          { return nil }
+func (t *testMQTTToken) Error() error                   { return t.err }
+
+type testMQTTMessage struct {
+	topic   string
+	qos     byte
+	payload []byte
+}
+
+type testMQTTClient struct {
+	mqtt.Client
+	connectToken *testMQTTToken
+	publishToken *testMQTTToken
+	connected    bool
+	disconnected bool
+	published    []*testMQTTMessage
+}
+
+func (c *testMQTTClient) IsConnectionOpen() bool { return c.connected }
+
+func (c *testMQTTClient) Connect() mqtt.Token {
+	c.connected = c.connectToken.err == nil && !c.connectToken.timeout
+	return c.connectToken
+}
+
+func (c *testMQTTClient) Disconnect(quiesce uint) {
+	c.connected = false
+	c.disconnected = true
+}
+
+func (c *testMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.published = append(c.published, &testMQTTMessage{topic: topic, qos: qos, payload: payload.([]byte)})
+	return c.publishToken
+}
+
+func newTestMQTTClient() *testMQTTClient {
+	return &testMQTTClient{
+		connectToken: &testMQTTToken{},
+		publishToken: &testMQTTToken{},
+	}
+}
+
+func newTestMQTTAction(client *testMQTTClient, topic string) *mqttAction {
+	spec := &mqttActionInfo{BrokerURL: "tcp://localhost:1883", Topic: topic}
+	es := &eventStream{sm: &mockSubMgr{mqtt: client}, spec: &StreamInfo{ID: "123", MQTT: spec}, allowPrivateIPs: true}
+	m, _ := newMQTTAction(es, spec)
+	return m
+}
+
+func TestNewMQTTActionValidation(t *testing.T) {
+	assert := assert.New(t)
+	es := &eventStream{sm: &mockSubMgr{}, spec: &StreamInfo{ID: "123"}}
+
+	_, err := newMQTTAction(es, nil)
+	assert.Regexp("Must specify mqtt.brokerURL for action type 'mqtt'", err)
+
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: "http://broker1", Topic: "t1"})
+	assert.Regexp("Invalid mqtt.brokerURL 'http://broker1'", err)
+
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: ":::", Topic: "t1"})
+	assert.Regexp("Invalid mqtt.brokerURL", err)
+
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: "tcp://broker1:1883"})
+	assert.Regexp("Must specify mqtt.topic for action type 'mqtt'", err)
+
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: "tcp://broker1:1883", Topic: "devices/+/events"})
+	assert.Regexp("Invalid mqtt.topic 'devices/\\+/events'", err)
+
+	m, err := newMQTTAction(es, &mqttActionInfo{BrokerURL: "SSL://broker1:8883", Topic: "events"})
+	assert.NoError(err)
+	assert.Equal("ethconnect-123", m.spec.ClientID)
+	assert.Equal(uint32(mqttDefaultTimeoutSec), m.spec.RequestTimeoutSec)
+}
+
+func TestNewMQTTActionRestricted(t *testing.T) {
+	assert := assert.New(t)
+	conf := &SubscriptionManagerConf{WebhooksAllowedHosts: []string{"*.example.com"}}
+	es := &eventStream{sm: &mockSubMgr{conf: conf}, spec: &StreamInfo{ID: "123"}}
+
+	_, err := newMQTTAction(es, &mqttActionInfo{BrokerURL: "tcp://internal:1883", Topic: "t1"})
+	assert.Regexp("Webhook host 'internal' is not in the list of allowed hosts", err)
+
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: "ssl://broker.example.com:8883", Topic: "t1", TLS: &utils.TLSConfig{
+		Enabled:         true,
+		ClientCertsFile: "/etc/ethconnect/client.pem",
+		ClientKeyFile:   "/etc/ethconnect/client.key",
+	}})
+	assert.Regexp("FFEC100402.*client.pem", err)
+
+	conf.WebhooksTLSDir = "/etc/ethconnect"
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: "ssl://broker.example.com:8883", Topic: "t1", TLS: &utils.TLSConfig{
+		Enabled:     true,
+		CACertsFile: "../ca.pem",
+	}})
+	assert.Regexp("FFEC100402.*ca.pem", err)
+
+	_, err = newMQTTAction(es, &mqttActionInfo{BrokerURL: "ssl://broker.example.com:8883", Topic: "t1", TLS: &utils.TLSConfig{
+		Enabled:     true,
+		CACertsFile: "missing.pem",
+	}})
+	assert.Regexp("Invalid mqtt.tls configuration", err)
+}
+
+func TestMQTTActionPrivateBroker(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestMQTTClient()
+	m := newTestMQTTAction(client, "events")
+	m.es.allowPrivateIPs = false
+
+	err := m.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Failed to connect to MQTT broker 'tcp://localhost:1883'.*Cannot send Webhook POST to address: localhost", err)
+	assert.Nil(m.client)
+	assert.False(client.connected)
+}
+
+func TestRedactMQTTPassword(t *testing.T) {
+	assert := assert.New(t)
+	spec := &StreamInfo{ID: "123", MQTT: &mqttActionInfo{Username: "user1", Password: "${env:MQTT_PASSWORD}"}}
+	redacted := redactStreamSecrets(spec)
+	assert.Equal("***", redacted.MQTT.Password)
+	assert.Equal("user1", redacted.MQTT.Username)
+	assert.Equal("${env:MQTT_PASSWORD}", spec.MQTT.Password)
+	assert.Equal("mqtt.password", redactedSecretField(redacted))
+	assert.Equal("", redactedSecretField(spec))
+
+	update := &mqttActionInfo{Password: "***"}
+	restoreMQTTPassword(spec.MQTT, update)
+	assert.Equal("${env:MQTT_PASSWORD}", update.Password)
+	update.Password = "pass2"
+	restoreMQTTPassword(spec.MQTT, update)
+	assert.Equal("pass2", update.Password)
+	restoreMQTTPassword(nil, update)
+
+	spec.MQTT.Password = ""
+	assert.Equal("", redactStreamSecrets(spec).MQTT.Password)
+}
+
+func TestMQTTActionMessageTopic(t *testing.T) {
+	assert := assert.New(t)
+	m := newTestMQTTAction(newTestMQTTClient(), "devices/{{address}}/{{event}}/{{subId}}/{{streamId}}")
+	topic := m.messageTopic(&eventData{Address: "0x1111", SubID: "sub1", Signature: "Changed(address,uint256)"})
+	assert.Equal("devices/0x1111/Changed/sub1/123", topic)
+}
+
+func TestMQTTActionAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestMQTTClient()
+	m := newTestMQTTAction(client, "devices/{{address}}")
+
+	err := m.attemptBatch(1, 1, []*eventData{
+		{Address: "0x1111", LogIndex: "1"},
+		{Address: "0x2222", LogIndex: "2"},
+		{Address: "0x1111", LogIndex: "3"},
+	})
+	assert.NoError(err)
+	assert.Equal(2, len(client.published))
+	assert.Equal("devices/0x1111", client.published[0].topic)
+	assert.Equal(byte(1), client.published[0].qos)
+	var events []*eventData
+	err = json.Unmarshal(client.published[0].payload, &events)
+	assert.NoError(err)
+	assert.Equal(2, len(events))
+	assert.Equal("3", events[1].LogIndex)
+	assert.Equal("devices/0x2222", client.published[1].topic)
+
+	// The connection is reused for the next batch, and closed when the stream stops
+	err = m.attemptBatch(2, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+	assert.Equal(3, len(client.published))
+	assert.False(client.disconnected)
+	m.close()
+	assert.True(client.disconnected)
+	assert.Nil(m.client)
+}
+
+func TestMQTTActionAttemptBatchPublishFail(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestMQTTClient()
+	client.publishToken.err = fmt.Errorf("pop")
+	m := newTestMQTTAction(client, "events")
+
+	err := m.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Failed to publish events to MQTT topic 'events': pop", err)
+
+	client.publishToken = &testMQTTToken{timeout: true}
+	err = m.attemptBatch(1, 2, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Failed to publish events to MQTT topic 'events': .*Timed out after 30s", err)
+}
+
+func TestMQTTActionAttemptBatchConnectFail(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestMQTTClient()
+	client.connectToken.err = fmt.Errorf("pop")
+	m := newTestMQTTAction(client, "events")
+
+	err := m.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Failed to connect to MQTT broker 'tcp://localhost:1883': pop", err)
+	assert.Nil(m.client)
+	assert.Empty(client.published)
+}
+
+func TestMQTTActionReconnect(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestMQTTClient()
+	m := newTestMQTTAction(client, "events")
+	m.spec.Username = "user1"
+	m.spec.Password = "pass1"
+
+	err := m.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+
+	// A lost connection is replaced on the next batch
+	client.connected = false
+	err = m.attemptBatch(2, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+	assert.True(client.disconnected)
+	assert.True(client.connected)
+}
+
+func TestMQTTActionBadTLS(t *testing.T) {
+	assert := assert.New(t)
+	m := newTestMQTTAction(newTestMQTTClient(), "events")
+	m.spec.TLS = &utils.TLSConfig{Enabled: true, ClientCertsFile: "missing.pem"}
+
+	err := m.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Failed to connect to MQTT broker", err)
+}
+
+func TestMQTTStreamCreateAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	client := newTestMQTTClient()
+	sm.mqttFactory = func(opts *mqtt.ClientOptions) mqtt.Client {
+		assert.Equal("device-bridge", opts.ClientID)
+		return client
+	}
+
+	stream, err := newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "MQTT",
+		MQTT: &mqttActionInfo{
+			BrokerURL: "tcp://broker1:1883",
+			Topic:     "events",
+			ClientID:  "device-bridge",
+		},
+	}, nil)
+	assert.NoError(err)
+	defer stream.stop(false)
+	assert.Equal("mqtt", stream.spec.Type)
+
+	_, err = stream.update(&StreamInfo{
+		MQTT: &mqttActionInfo{
+			BrokerURL: "tcp://broker2:1883",
+			Topic:     "events/{{address}}",
+			ClientID:  "device-bridge",
+		},
+	})
+	assert.NoError(err)
+	assert.Equal("tcp://broker2:1883", stream.spec.MQTT.BrokerURL)
+	assert.Equal("events/{{address}}", stream.action.(*mqttAction).spec.Topic)
+
+	_, err = stream.update(&StreamInfo{
+		MQTT: &mqttActionInfo{BrokerURL: "tcp://broker2:1883"},
+	})
+	assert.Regexp("Must specify mqtt.topic for action type 'mqtt'", err)
+}
+
+func TestMQTTStreamCreateNoBroker(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, err := newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "mqtt",
+	}, nil)
+	assert.Regexp("Must specify mqtt.brokerURL for action type 'mqtt'", err)
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const natsDefaultTimeoutSec = 30
+
+// NATSConf configures the connection shared by all the NATS event streams
+type NATSConf struct {
+	URL       string          `json:"url,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	CredsFile string          `json:"credsFile,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	Password  string          `json:"password,omitempty"`
+	TLS       utils.TLSConfig `json:"tls"`
+}
+
+type natsActionInfo struct {
+	Subject           string `json:"subject,omitempty"`
+	Stream            string `json:"stream,omitempty"`
+	RequestTimeoutSec uint32 `json:"requestTimeoutSec,omitempty"`
+}
+
+type natsAction struct {
+	es   *eventStream
+	spec *natsActionInfo
+}
+
+// natsJetStream is the connection to JetStream used to publish events
+type natsJetStream interface {
+	PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error)
+	Close()
+}
+
+// natsFactory connects to NATS, so tests can replace the connection
+type natsFactory interface {
+	connect(conf *NATSConf) (natsJetStream, error)
+}
+
+type natsConnector struct{}
+
+type natsConnection struct {
+	nats.JetStreamContext
+	nc *nats.Conn
+}
+
+func (c *natsConnection) Close() {
+	c.nc.Close()
+}
+
+func (f *natsConnector) connect(conf *NATSConf) (natsJetStream, error) {
+	var opts []nats.Option
+	if conf.Name != "" {
+		opts = append(opts, nats.Name(conf.Name))
+	}
+	if conf.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(conf.CredsFile))
+	}
+	if conf.Username != "" {
+		opts = append(opts, nats.UserInfo(conf.Username, conf.Password))
+	}
+	if conf.TLS.Enabled {
+		tlsConfig, err := utils.CreateTLSConfiguration(&conf.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+	nc, err := nats.Connect(conf.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &natsConnection{JetStreamContext: js, nc: nc}, nil
+}
+
+func validateNATS(sm subscriptionManager, spec *natsActionInfo) error {
+	if sm.config().NATS.URL == "" {
+		return errors.Errorf(errors.EventStreamsNATSNotConfigured)
+	}
+	if spec == nil || spec.Subject == "" {
+		return errors.Errorf(errors.EventStreamsNATSNoSubject)
+	}
+	if strings.ContainsAny(spec.Subject, "*> \t\r\n") {
+		return errors.Errorf(errors.EventStreamsNATSInvalidSubject, spec.Subject)
+	}
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = natsDefaultTimeoutSec
+	}
+	return nil
+}
+
+func newNATSAction(es *eventStream, spec *natsActionInfo) (*natsAction, error) {
+	if err := validateNATS(es.sm, spec); err != nil {
+		return nil, err
+	}
+	return &natsAction{
+		es:   es,
+		spec: spec,
+	}, nil
+}
+
+// messageID identifies an event to JetStream, so an event that is sent again when
+// a batch is retried is discarded as a duplicate within the window of the stream
+func (n *natsAction) messageID(event *eventData) string {
+	if event.BlockHash != "" {
+		return fmt.Sprintf("%s:%s:%s", n.es.spec.ID, event.SubID, event.BlockHash)
+	}
+	return fmt.Sprintf("%s:%s:%s", n.es.spec.ID, event.TransactionHash, event.LogIndex)
+}
+
+// attemptBatch publishes each event in the batch as a message to the subject, and
+// returns once all of them have been acknowledged by JetStream
+func (n *natsAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
+	js, err := n.es.sm.natsJetStream()
+	if err != nil {
+		return err
+	}
+	opts := []nats.PubOpt{nats.AckWait(time.Duration(n.spec.RequestTimeoutSec) * time.Second)}
+	if n.spec.Stream != "" {
+		opts = append(opts, nats.ExpectStream(n.spec.Stream))
+	}
+	log.Infof("%s: Publishing batch %d (attempt %d) of %d events to NATS subject '%s'", n.es.spec.ID, batchNumber, attempt, len(events), n.spec.Subject)
+	for _, event := range events {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msg := nats.NewMsg(n.spec.Subject)
+		msg.Data = b
+		msg.Header.Set(nats.MsgIdHdr, n.messageID(event))
+		if _, err := js.PublishMsg(msg, opts...); err != nil {
+			return errors.Errorf(errors.EventStreamsNATSPublishFailed, n.spec.Subject, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testNATSJetStream struct {
+	msgs   []*nats.Msg
+	opts   []nats.PubOpt
+	err    error
+	closed bool
+}
+
+func (j *testNATSJetStream) PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if j.err != nil {
+		return nil, j.err
+	}
+	j.msgs = append(j.msgs, m)
+	j.opts = opts
+	return &nats.PubAck{Stream: "events", Sequence: uint64(len(j.msgs))}, nil
+}
+
+func (j *testNATSJetStream) Close() {
+	j.closed = true
+}
+
+type testNATSFactory struct {
+	js  *testNATSJetStream
+	err error
+}
+
+func (f *testNATSFactory) connect(conf *NATSConf) (natsJetStream, error) {
+	return f.js, f.err
+}
+
+func newTestNATSSubscriptionManager() *subscriptionMGR {
+	sm := newTestSubscriptionManager()
+	sm.config().NATS.URL = "nats://localhost:4222"
+	sm.natsFactory = &testNATSFactory{js: &testNATSJetStream{}}
+	return sm
+}
+
+func TestNewNATSActionValidation(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestNATSSubscriptionManager()
+	es := &eventStream{sm: sm}
+
+	_, err := newNATSAction(es, nil)
+	assert.Regexp("Must specify nats.subject for action type 'nats'", err)
+
+	_, err = newNATSAction(es, &natsActionInfo{Subject: "events.>"})
+	assert.Regexp("Invalid nats.subject 'events.>'", err)
+
+	_, err = newNATSAction(es, &natsActionInfo{Subject: "events *"})
+	assert.Regexp("Invalid nats.subject", err)
+
+	n, err := newNATSAction(es, &natsActionInfo{Subject: "chain.events"})
+	assert.NoError(err)
+	assert.Equal(uint32(natsDefaultTimeoutSec), n.spec.RequestTimeoutSec)
+
+	sm.config().NATS.URL = ""
+	_, err = newNATSAction(es, &natsActionInfo{Subject: "chain.events"})
+	assert.Regexp("A NATS server must be configured for events", err)
+}
+
+func TestNATSActionAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	js := &testNATSJetStream{}
+	n := &natsAction{
+		es:   &eventStream{sm: &mockSubMgr{nats: js}, spec: &StreamInfo{ID: "123"}},
+		spec: &natsActionInfo{Subject: "chain.events", Stream: "EVENTS", RequestTimeoutSec: 10},
+	}
+
+	err := n.attemptBatch(1, 1, []*eventData{
+		{Address: "0x1111", TransactionHash: "0xaaaa", LogIndex: "0"},
+		{Address: "0x2222", TransactionHash: "0xaaaa", LogIndex: "1"},
+	})
+	assert.NoError(err)
+	assert.Equal(2, len(js.msgs))
+	assert.Equal(2, len(js.opts))
+	assert.Equal("chain.events", js.msgs[0].Subject)
+	assert.Equal("123:0xaaaa:0", js.msgs[0].Header.Get(nats.MsgIdHdr))
+	assert.Equal("123:0xaaaa:1", js.msgs[1].Header.Get(nats.MsgIdHdr))
+	var event eventData
+	err = json.Unmarshal(js.msgs[1].Data, &event)
+	assert.NoError(err)
+	assert.Equal("0x2222", event.Address)
+}
+
+func TestNATSActionAttemptBatchFail(t *testing.T) {
+	assert := assert.New(t)
+	n := &natsAction{
+		es:   &eventStream{sm: &mockSubMgr{nats: &testNATSJetStream{err: fmt.Errorf("pop")}}, spec: &StreamInfo{ID: "123"}},
+		spec: &natsActionInfo{Subject: "chain.events", RequestTimeoutSec: 10},
+	}
+
+	err := n.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Failed to publish event to NATS subject 'chain.events': pop", err)
+}
+
+func TestNATSActionAttemptBatchNoConnection(t *testing.T) {
+	assert := assert.New(t)
+	n := &natsAction{
+		es:   &eventStream{sm: &mockSubMgr{err: fmt.Errorf("pop")}, spec: &StreamInfo{ID: "123"}},
+		spec: &natsActionInfo{Subject: "chain.events", RequestTimeoutSec: 10},
+	}
+
+	err := n.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("pop", err)
+}
+
+func TestNATSJetStreamSharedAndClosed(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestNATSSubscriptionManager()
+
+	js1, err := sm.natsJetStream()
+	assert.NoError(err)
+	js2, err := sm.natsJetStream()
+	assert.NoError(err)
+	assert.Equal(js1, js2)
+
+	sm.Close(true)
+	assert.True(sm.natsFactory.(*testNATSFactory).js.closed)
+	assert.Nil(sm.nats)
+}
+
+func TestNATSJetStreamConnectFail(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestNATSSubscriptionManager()
+	sm.natsFactory = &testNATSFactory{err: fmt.Errorf("pop")}
+
+	_, err := sm.natsJetStream()
+	assert.Regexp("Failed to connect to NATS JetStream for event streams: pop", err)
+}
+
+func TestNATSConnectorFail(t *testing.T) {
+	assert := assert.New(t)
+	f := &natsConnector{}
+
+	_, err := f.connect(&NATSConf{URL: "nats://127.0.0.1:1", Name: "test", CredsFile: "missing.creds", Username: "user1"})
+	assert.Error(err)
+
+	_, err = f.connect(&NATSConf{URL: "nats://127.0.0.1:1", TLS: utils.TLSConfig{Enabled: true, ClientCertsFile: "missing.pem"}})
+	assert.Regexp("FFEC", err)
+}
+
+func TestNATSStreamCreateAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestNATSSubscriptionManager()
+
+	stream, err := newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "NATS",
+		NATS: &natsActionInfo{
+			Subject: "chain.events",
+		},
+	}, nil)
+	assert.NoError(err)
+	defer stream.stop(false)
+	assert.Equal("nats", stream.spec.Type)
+
+	_, err = stream.update(&StreamInfo{
+		NATS: &natsActionInfo{
+			Subject: "chain.events2",
+			Stream:  "EVENTS",
+		},
+	})
+	assert.NoError(err)
+	assert.Equal("chain.events2", stream.action.(*natsAction).spec.Subject)
+	assert.Equal("EVENTS", stream.spec.NATS.Stream)
+
+	_, err = stream.update(&StreamInfo{
+		NATS: &natsActionInfo{},
+	})
+	assert.Regexp("Must specify nats.subject for action type 'nats'", err)
+}
+
+func TestNATSMessageIDBlock(t *testing.T) {
+	assert := assert.New(t)
+	n := &natsAction{es: &eventStream{spec: &StreamInfo{ID: "123"}}}
+	id := n.messageID(&eventData{SubID: "sub1", BlockNumber: "100", BlockHash: "0xabcd"})
+	assert.Equal("123:sub1:0xabcd", id)
+}
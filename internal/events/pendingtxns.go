@@ -0,0 +1,193 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubscriptionTypePendingTransactions is a subscription that delivers each transaction as it
+// arrives in the transaction pool of the node, before it is mined
+const SubscriptionTypePendingTransactions = "pendingTransactions"
+
+// pendingTransactionFilter matches the pending transactions to any of the To addresses, and
+// from any of the From addresses. An empty list matches any address
+type pendingTransactionFilter struct {
+	To   []ethbinding.Address
+	From []ethbinding.Address
+}
+
+// newPendingTransactionFilter parses the filter of a subscription to pending transactions,
+// where each of "to" and "from" is an address or a list of addresses
+func newPendingTransactionFilter(filter map[string]interface{}) (*pendingTransactionFilter, error) {
+	f := &pendingTransactionFilter{}
+	for name, value := range filter {
+		addrs, err := filterAddresses(name, value)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "to":
+			f.To = addrs
+		case "from":
+			f.From = addrs
+		default:
+			return nil, errors.Errorf(errors.EventStreamsSubscribePendingBadFilter, name)
+		}
+	}
+	return f, nil
+}
+
+func filterAddresses(name string, value interface{}) ([]ethbinding.Address, error) {
+	var strs []string
+	switch v := value.(type) {
+	case string:
+		strs = []string{v}
+	case []string:
+		strs = v
+	case []interface{}:
+		for _, entry := range v {
+			s, ok := entry.(string)
+			if !ok {
+				return nil, errors.Errorf(errors.EventStreamsSubscribePendingBadFilter, name)
+			}
+			strs = append(strs, s)
+		}
+	default:
+		return nil, errors.Errorf(errors.EventStreamsSubscribePendingBadFilter, name)
+	}
+	addrs := make([]ethbinding.Address, len(strs))
+	for i, s := range strs {
+		if !strings.HasPrefix(s, "0x") {
+			s = "0x" + s
+		}
+		if !ethbind.API.IsHexAddress(s) {
+			return nil, errors.Errorf(errors.EventStreamsSubscribePendingBadFilter, name)
+		}
+		addrs[i] = ethbind.API.HexToAddress(s)
+	}
+	return addrs, nil
+}
+
+func addressIn(addrs []ethbinding.Address, addr *ethbinding.Address) bool {
+	if len(addrs) == 0 {
+		return true
+	}
+	if addr == nil {
+		// A contract deployment has no to address, so only matches when there is no filter on it
+		return false
+	}
+	for _, a := range addrs {
+		if a == *addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *pendingTransactionFilter) matches(txn *eth.TxnInfo) bool {
+	return addressIn(f.To, txn.To) && addressIn(f.From, txn.From)
+}
+
+func (s *subscription) isPendingTransactions() bool {
+	return s.info != nil && s.info.Type == SubscriptionTypePendingTransactions
+}
+
+// createPendingTransactionFilter creates a filter on the node for the hashes of new pending transactions.
+// Pending transactions are not checkpointed, so there is nothing to catch up on
+func (s *subscription) createPendingTransactionFilter(ctx context.Context) error {
+	if err := s.rpc.CallContext(ctx, &s.filterID, "eth_newPendingTransactionFilter"); err != nil {
+		return errors.Errorf(errors.RPCCallReturnedError, "eth_newPendingTransactionFilter", err)
+	}
+	s.markFilterStale(ctx, false)
+	log.Infof("%s: created pending transaction filter: %s", s.logName, s.filterID.String())
+	return nil
+}
+
+// processPendingTransactions gets the hashes of the transactions that arrived in the pool since the
+// last poll, and delivers the details of each one that matches the filter of the subscription
+func (s *subscription) processPendingTransactions(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var hashes []ethbinding.Hash
+	if err := s.rpc.CallContext(ctx, &hashes, "eth_getFilterChanges", s.filterID); err != nil {
+		if strings.Contains(err.Error(), "filter not found") {
+			s.markFilterStale(ctx, true)
+		}
+		return err
+	}
+	for i := range hashes {
+		hash := &hashes[i]
+		txn, err := eth.GetTransactionInfo(ctx, s.rpc, hash.String())
+		if err != nil {
+			// The transaction might already have been dropped from the pool
+			log.Warnf("%s: failed to get pending transaction %s: %s", s.logName, hash.String(), err)
+			continue
+		}
+		txn.Hash = hash
+		if s.pendingFilter == nil || s.pendingFilter.matches(txn) {
+			s.lp.processPendingTransaction(s.logName, txn)
+		}
+	}
+	return nil
+}
+
+// processPendingTransaction dispatches a pending transaction as an event, with the fields of the transaction as the data
+func (lp *logProcessor) processPendingTransaction(subInfo string, txn *eth.TxnInfo) {
+	data := map[string]interface{}{
+		"hash": txn.Hash.String(),
+	}
+	result := &eventData{
+		TransactionHash: txn.Hash.String(),
+		SubID:           lp.subID,
+		Data:            data,
+		// Pending transactions are not checkpointed, so there is no high water mark to update
+		batchComplete: func(*eventData) {},
+	}
+	if txn.From != nil {
+		data["from"] = txn.From.String()
+	}
+	if txn.To != nil {
+		result.Address = txn.To.String()
+		data["to"] = txn.To.String()
+	}
+	if txn.Nonce != nil {
+		data["nonce"] = strconv.FormatUint(uint64(*txn.Nonce), 10)
+	}
+	if txn.Gas != nil {
+		data["gas"] = strconv.FormatUint(uint64(*txn.Gas), 10)
+	}
+	if txn.GasPrice != nil {
+		data["gasPrice"] = txn.GasPrice.ToInt().String()
+	}
+	if txn.Value != nil {
+		data["value"] = txn.Value.ToInt().String()
+	}
+	if txn.Input != nil {
+		data["input"] = txn.Input.String()
+	}
+	log.Infof("%s: Dispatching pending transaction. Hash=%s", subInfo, result.TransactionHash)
+	lp.dispatch(result)
+}
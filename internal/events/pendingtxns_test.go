@@ -0,0 +1,205 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	testPendingFrom = "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	testPendingTo   = "0x0123456789abcdef0123456789abcdef01234567"
+)
+
+func newTestPendingSubscription(rpc *ethmocks.RPCClient, filter map[string]interface{}) (*subscription, chan *eventData, error) {
+	events := make(chan *eventData, 10)
+	stream := &eventStream{spec: &StreamInfo{ID: "123"}, eventStream: events}
+	m := &mockSubMgr{stream: stream}
+	i := &SubscriptionInfo{ID: "sub1", Stream: "123", Type: "PendingTransactions", IndexedFilter: filter}
+	s, err := newSubscription(m, rpc, nil, nil, i)
+	return s, events, err
+}
+
+func mockPendingTransactions(rpc *ethmocks.RPCClient, txns map[string]string) {
+	hashes := []ethbinding.Hash{}
+	for hash, txnJSON := range txns {
+		hashes = append(hashes, ethbind.API.HexToHash(hash))
+		txnJSON := txnJSON
+		rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getTransactionByHash", hash).
+			Run(func(args mock.Arguments) {
+				json.Unmarshal([]byte(txnJSON), args[1])
+			}).
+			Return(nil)
+	}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_newPendingTransactionFilter").
+		Run(func(args mock.Arguments) {
+			args[1].(*ethbinding.HexBigInt).ToInt().SetInt64(42)
+		}).
+		Return(nil)
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getFilterChanges", mock.Anything).
+		Run(func(args mock.Arguments) {
+			*(args[1].(*[]ethbinding.Hash)) = hashes
+		}).
+		Return(nil)
+}
+
+func TestCreateSubscriptionPendingTransactions(t *testing.T) {
+	assert := assert.New(t)
+	s, _, err := newTestPendingSubscription(nil, map[string]interface{}{
+		"to":   []interface{}{testPendingTo},
+		"from": testPendingFrom[2:],
+	})
+	assert.NoError(err)
+	assert.Equal(SubscriptionTypePendingTransactions, s.info.Type)
+	assert.Equal("*:pendingTransactions", s.info.Summary)
+	assert.Empty(s.info.Filter.Topics)
+	assert.Equal([]ethbinding.Address{ethbind.API.HexToAddress(testPendingTo)}, s.pendingFilter.To)
+	assert.Equal([]ethbinding.Address{ethbind.API.HexToAddress(testPendingFrom)}, s.pendingFilter.From)
+
+	restored, err := restoreSubscription(&mockSubMgr{stream: s.lp.stream}, nil, nil, s.info)
+	assert.NoError(err)
+	assert.True(restored.isPendingTransactions())
+	assert.Equal(s.pendingFilter, restored.pendingFilter)
+}
+
+func TestCreateSubscriptionPendingTransactionsBadFilter(t *testing.T) {
+	assert := assert.New(t)
+	_, _, err := newTestPendingSubscription(nil, map[string]interface{}{"value": "1"})
+	assert.Regexp("Invalid filter 'value' for pending transactions", err)
+	_, _, err = newTestPendingSubscription(nil, map[string]interface{}{"to": "badness"})
+	assert.Regexp("Invalid filter 'to' for pending transactions", err)
+	_, _, err = newTestPendingSubscription(nil, map[string]interface{}{"to": []interface{}{12345}})
+	assert.Regexp("Invalid filter 'to' for pending transactions", err)
+	_, _, err = newTestPendingSubscription(nil, map[string]interface{}{"from": true})
+	assert.Regexp("Invalid filter 'from' for pending transactions", err)
+
+	i := &SubscriptionInfo{ID: "sub1", Stream: "123", Type: "pendingTransactions", IndexedFilter: map[string]interface{}{"to": 1}}
+	_, err = restoreSubscription(&mockSubMgr{stream: newTestStream()}, nil, nil, i)
+	assert.Regexp("Invalid filter 'to' for pending transactions", err)
+}
+
+func TestCreateSubscriptionPendingTransactionsWithEvent(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := testSubInfo(&ethbinding.ABIElementMarshaling{Name: "devent"})
+	i.Type = SubscriptionTypePendingTransactions
+	_, err := newSubscription(m, nil, nil, nil, i)
+	assert.Regexp("A subscription to pending transactions cannot have an address or event", err)
+}
+
+func TestProcessPendingTransactions(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	mockPendingTransactions(rpc, map[string]string{
+		"0x0000000000000000000000000000000000000000000000000000000000000001": `{
+			"from": "` + testPendingFrom + `", "to": "` + testPendingTo + `",
+			"nonce": "0xa", "gas": "0x5208", "gasPrice": "0x0", "value": "0x64", "input": "0x1234"
+		}`,
+		"0x0000000000000000000000000000000000000000000000000000000000000002": `{
+			"from": "` + testPendingTo + `", "to": "` + testPendingFrom + `", "input": "0x"
+		}`,
+		"0x0000000000000000000000000000000000000000000000000000000000000003": `{}`,
+	})
+	s, events, err := newTestPendingSubscription(rpc, map[string]interface{}{"to": testPendingTo})
+	assert.NoError(err)
+
+	err = s.restartFilter(context.Background(), nil)
+	assert.NoError(err)
+	assert.False(s.filterStale)
+	assert.Equal(int64(42), s.filterID.ToInt().Int64())
+
+	err = s.processNewEvents(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, len(events))
+	e := <-events
+	assert.Equal("0x0000000000000000000000000000000000000000000000000000000000000001", e.TransactionHash)
+	assert.Equal(ethbind.API.HexToAddress(testPendingTo).String(), e.Address)
+	assert.Equal("", e.BlockNumber)
+	assert.Equal("10", e.Data["nonce"])
+	assert.Equal("21000", e.Data["gas"])
+	assert.Equal("0", e.Data["gasPrice"])
+	assert.Equal("100", e.Data["value"])
+	assert.Equal("0x1234", e.Data["input"])
+	assert.Equal(ethbind.API.HexToAddress(testPendingFrom).String(), e.Data["from"])
+	e.batchComplete(e)
+
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_uninstallFilter", mock.Anything).Return(nil)
+	err = s.unsubscribe(context.Background(), true)
+	assert.NoError(err)
+	rpc.AssertCalled(t, "CallContext", mock.Anything, mock.Anything, "eth_uninstallFilter", mock.Anything)
+}
+
+func TestProcessPendingTransactionsNoFilter(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	mockPendingTransactions(rpc, map[string]string{
+		"0x0000000000000000000000000000000000000000000000000000000000000001": `{"from": "` + testPendingFrom + `", "input": "0x"}`,
+	})
+	s, events, err := newTestPendingSubscription(rpc, nil)
+	assert.NoError(err)
+	err = s.processPendingTransactions(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, len(events))
+	e := <-events
+	assert.Empty(e.Address)
+	assert.Nil(e.Data["to"])
+}
+
+func TestProcessPendingTransactionsFilterNotFound(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_getFilterChanges", mock.Anything).
+		Return(fmt.Errorf("filter not found"))
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_uninstallFilter", mock.Anything).Return(nil)
+	s, _, err := newTestPendingSubscription(rpc, nil)
+	assert.NoError(err)
+	s.filterStale = false
+	err = s.processPendingTransactions(context.Background())
+	assert.Regexp("filter not found", err)
+	assert.True(s.filterStale)
+}
+
+func TestCreatePendingTransactionFilterFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_newPendingTransactionFilter").
+		Return(fmt.Errorf("pop"))
+	s, _, err := newTestPendingSubscription(rpc, nil)
+	assert.NoError(err)
+	err = s.restartFilter(context.Background(), nil)
+	assert.Regexp("eth_newPendingTransactionFilter returned: pop", err)
+}
+
+func TestPendingTransactionFilterMatches(t *testing.T) {
+	assert := assert.New(t)
+	to := ethbind.API.HexToAddress(testPendingTo)
+	from := ethbind.API.HexToAddress(testPendingFrom)
+	f := &pendingTransactionFilter{To: []ethbinding.Address{to}}
+	assert.True(f.matches(&eth.TxnInfo{To: &to, From: &from}))
+	assert.False(f.matches(&eth.TxnInfo{To: &from, From: &from}))
+	assert.False(f.matches(&eth.TxnInfo{From: &from}))
+	f = &pendingTransactionFilter{From: []ethbinding.Address{from}}
+	assert.True(f.matches(&eth.TxnInfo{From: &from}))
+}
@@ -19,13 +19,16 @@ import (
 	"encoding/json"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/spf13/cobra"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
 	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
@@ -57,13 +60,28 @@ type SubscriptionManager interface {
 	UpdateStream(ctx context.Context, id string, spec *StreamInfo) (*StreamInfo, error)
 	SuspendStream(ctx context.Context, id string) error
 	ResumeStream(ctx context.Context, id string) error
+	SuspendAllStreams(ctx context.Context) error
+	ResumeAllStreams(ctx context.Context) error
 	DeleteStream(ctx context.Context, id string) error
-	AddSubscription(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string) (*SubscriptionInfo, error)
+	StreamMetrics(ctx context.Context, id string) (*StreamMetrics, error)
+	DeadLetters(ctx context.Context, streamID string) ([]*DeadLetter, error)
+	RequeueDeadLetter(ctx context.Context, streamID, id string) error
+	DeleteDeadLetter(ctx context.Context, streamID, id string) error
+	AddSubscription(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, event *ethbinding.ABIElementMarshaling, filter map[string]interface{}, streamID, initialBlock, name string) (*SubscriptionInfo, error)
+	AddSubscriptionAllEvents(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, events ethbinding.ABIMarshaling, streamID, initialBlock, name string) (*SubscriptionInfo, error)
 	AddSubscriptionDirect(ctx context.Context, newSub *SubscriptionCreateDTO) (*SubscriptionInfo, error)
+	AddSubscriptions(ctx context.Context, newSubs []*SubscriptionCreateDTO) ([]*SubscriptionBatchResult, error)
 	Subscriptions(ctx context.Context) []*SubscriptionInfo
 	SubscriptionByID(ctx context.Context, id string) (*SubscriptionInfo, error)
+	UpdateSubscription(ctx context.Context, id string, update *SubscriptionUpdateDTO) (*SubscriptionInfo, error)
 	ResetSubscription(ctx context.Context, id, initialBlock string) error
+	ExportCheckpoint(ctx context.Context, id string) (*SubscriptionCheckpoint, error)
+	ImportCheckpoint(ctx context.Context, id string, cp *SubscriptionCheckpoint) error
 	DeleteSubscription(ctx context.Context, id string) error
+	ContractUpgraded(ctx context.Context, address string)
+	ExportEvents(ctx context.Context) (*EventsBackup, error)
+	ImportEvents(ctx context.Context, backup *EventsBackup) (*EventsImportResult, error)
+	LastHeartbeat(ctx context.Context) (*Heartbeat, error)
 	Close(wait bool)
 }
 
@@ -74,26 +92,65 @@ type subscriptionManager interface {
 	subscriptionsForStream(string) []*subscription
 	loadCheckpoint(string) (map[string]*big.Int, error)
 	storeCheckpoint(string, map[string]*big.Int) error
+	storeStream(*StreamInfo) (*StreamInfo, error)
+	storeDeadLetter(streamID, id string, b []byte) error
+	kafkaProducer() (kafka.KafkaBatchProducer, error)
+	newMQTTClient(opts *mqtt.ClientOptions) mqtt.Client
+	natsJetStream() (natsJetStream, error)
+	DeleteStream(ctx context.Context, id string) error
+	DeleteSubscription(ctx context.Context, id string) error
 }
 
 // SubscriptionManagerConf configuration
 type SubscriptionManagerConf struct {
-	EventLevelDBPath        string `json:"eventsDB"`
-	EventPollingIntervalSec uint64 `json:"eventPollingIntervalSec,omitempty"`
-	CatchupModeBlockGap     int64  `json:"catchupModeBlockGap,omitempty"`
-	CatchupModePageSize     int64  `json:"catchupModePageSize,omitempty"`
-	WebhooksAllowPrivateIPs bool   `json:"webhooksAllowPrivateIPs,omitempty"`
+	EventLevelDBPath         string                `json:"eventsDB"`
+	EventPollingIntervalSec  uint64                `json:"eventPollingIntervalSec,omitempty"`
+	CatchupModeBlockGap      int64                 `json:"catchupModeBlockGap,omitempty"`
+	CatchupModePageSize      int64                 `json:"catchupModePageSize,omitempty"`
+	WebhooksAllowPrivateIPs  bool                  `json:"webhooksAllowPrivateIPs,omitempty"`
+	WebhooksAllowedHosts     []string              `json:"webhooksAllowedHosts,omitempty"`
+	WebhooksTLS              utils.TLSConfig       `json:"webhooksTLS,omitempty"`
+	WebhooksTLSDir           string                `json:"webhooksTLSDir,omitempty"`
+	WebhooksSecretsDir       string                `json:"webhooksSecretsDir,omitempty"`
+	WebhooksSecretsEnvPrefix string                `json:"webhooksSecretsEnvPrefix,omitempty"`
+	StartSuspended           bool                  `json:"startSuspended,omitempty"`
+	Kafka                    kafka.KafkaCommonConf `json:"eventsKafka,omitempty"`
+	NATS                     NATSConf              `json:"eventsNATS,omitempty"`
+	Heartbeat                HeartbeatConf         `json:"heartbeat,omitempty"`
+}
+
+// SyncStatus reports how far a subscription, or the slowest subscription on a stream,
+// is behind the head of the chain. It is calculated for the list APIs, and not persisted
+type SyncStatus struct {
+	CurrentBlock *big.Int `json:"currentBlock,omitempty"`
+	ChainHead    *big.Int `json:"chainHead,omitempty"`
+	BlocksBehind *big.Int `json:"blocksBehind,omitempty"`
 }
 
 type subscriptionMGR struct {
 	conf          *SubscriptionManagerConf
 	db            kvstore.KVStore
 	rpc           eth.RPCClient
+	mux           sync.RWMutex // protects the subscriptions and streams maps
 	subscriptions map[string]*subscription
 	streams       map[string]*eventStream
 	closed        bool
 	cr            contractregistry.ContractResolver
 	wsChannels    ws.WebSocketChannels
+	headMux       sync.Mutex
+	head          *big.Int
+	headFetched   time.Time
+	kafkaFactory  kafka.KafkaFactory
+	kafkaMux      sync.Mutex
+	kafka         kafka.KafkaBatchProducer
+	mqttFactory   func(opts *mqtt.ClientOptions) mqtt.Client
+	natsFactory   natsFactory
+	natsMux       sync.Mutex
+	nats          natsJetStream
+	heartbeatMux  sync.Mutex
+	heartbeat     *Heartbeat
+	heartbeatStop chan struct{}
+	heartbeatDone chan struct{}
 }
 
 // CobraInitSubscriptionManager standard naming for cobra command params
@@ -101,6 +158,18 @@ func CobraInitSubscriptionManager(cmd *cobra.Command, conf *SubscriptionManagerC
 	cmd.Flags().StringVarP(&conf.EventLevelDBPath, "events-db", "E", "", "Level DB location for subscription management")
 	cmd.Flags().Uint64VarP(&conf.EventPollingIntervalSec, "events-polling-int", "j", 10, "Event polling interval (ms)")
 	cmd.Flags().BoolVarP(&conf.WebhooksAllowPrivateIPs, "events-privips", "J", false, "Allow private IPs in Webhooks")
+	cmd.Flags().BoolVarP(&conf.StartSuspended, "events-start-suspended", "", false, "Start with all event streams suspended, for node maintenance. Resume them with POST /eventstreams/resumeall")
+	cmd.Flags().StringArrayVarP(&conf.WebhooksAllowedHosts, "events-webhook-hosts", "", nil, "Hosts that Webhooks can be sent to, such as api.example.com or *.example.com. Any host when not set")
+	cmd.Flags().StringVarP(&conf.WebhooksTLSDir, "events-webhook-tls-dir", "", "", "Directory of client certificate, key and CA files that Webhooks can set in their tls settings. Per-stream TLS files are rejected when not set")
+	cmd.Flags().StringVarP(&conf.WebhooksSecretsDir, "events-webhook-secrets-dir", "", "", "Directory of files that Webhook secrets can refer to as ${file:name}. File references are rejected when not set")
+	cmd.Flags().StringVarP(&conf.WebhooksSecretsEnvPrefix, "events-webhook-secrets-env-prefix", "", "", "Prefix of environment variables that Webhook secrets can refer to as ${env:NAME}. Environment references are rejected when not set")
+	cmd.Flags().StringArrayVarP(&conf.Kafka.Brokers, "events-kafka-brokers", "", nil, "Kafka brokers for event streams of type kafka")
+	cmd.Flags().StringVarP(&conf.Kafka.ClientID, "events-kafka-clientid", "", "", "Client ID (or generated UUID) for event streams of type kafka")
+	cmd.Flags().StringVarP(&conf.NATS.URL, "events-nats-url", "", "", "NATS server URL, or comma separated URLs, for event streams of type nats")
+	cmd.Flags().StringVarP(&conf.NATS.CredsFile, "events-nats-creds", "", "", "NATS credentials file for event streams of type nats")
+	cmd.Flags().Uint64VarP(&conf.Heartbeat.IntervalSec, "events-heartbeat-int", "", 0, "Interval (s) to record the chain head and stream checkpoints as a heartbeat. Disabled when 0")
+	cmd.Flags().StringVarP(&conf.Heartbeat.WebhookURL, "events-heartbeat-webhook", "", "", "URL to POST each event processing heartbeat to")
+	cmd.Flags().StringVarP(&conf.Heartbeat.KafkaTopic, "events-heartbeat-topic", "", "", "Kafka topic to send each event processing heartbeat to")
 }
 
 // NewSubscriptionManager constructor
@@ -112,6 +181,9 @@ func NewSubscriptionManager(conf *SubscriptionManagerConf, rpc eth.RPCClient, cr
 		streams:       make(map[string]*eventStream),
 		cr:            cr,
 		wsChannels:    wsChannels,
+		kafkaFactory:  &kafka.SaramaKafkaFactory{},
+		mqttFactory:   mqtt.NewClient,
+		natsFactory:   &natsConnector{},
 	}
 	if conf.EventPollingIntervalSec <= 0 {
 		conf.EventPollingIntervalSec = 1
@@ -131,18 +203,99 @@ func (s *subscriptionMGR) SubscriptionByID(ctx context.Context, id string) (*Sub
 	if err != nil {
 		return nil, err
 	}
+	if progress := sub.catchupStatus(); progress != nil {
+		info := *sub.info
+		info.CatchupProgress = progress
+		return &info, nil
+	}
 	return sub.info, err
 }
 
-// Subscriptions used externally to get list subscriptions
+// Subscriptions used externally to get list subscriptions, with their sync status
 func (s *subscriptionMGR) Subscriptions(ctx context.Context) []*SubscriptionInfo {
-	l := make([]*SubscriptionInfo, 0, len(s.subscriptions))
-	for _, sub := range s.subscriptions {
-		l = append(l, sub.info)
+	subs := s.allSubscriptions()
+	l := make([]*SubscriptionInfo, 0, len(subs))
+	if len(subs) == 0 {
+		return l
+	}
+	head := s.chainHead(ctx)
+	checkpoints := make(map[string]map[string]*big.Int)
+	for _, sub := range subs {
+		info := *sub.info
+		info.SyncStatus = newSyncStatus(s.currentBlock(sub, checkpoints), head)
+		info.CatchupProgress = sub.catchupStatus()
+		l = append(l, &info)
 	}
 	return l
 }
 
+// chainHead returns the latest block number, cached for the polling interval so
+// that listing many subscriptions does not query the node for each one
+func (s *subscriptionMGR) chainHead(ctx context.Context) *big.Int {
+	s.headMux.Lock()
+	defer s.headMux.Unlock()
+	if s.head != nil && time.Since(s.headFetched) < time.Duration(s.conf.EventPollingIntervalSec)*time.Second {
+		return s.head
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	blockHeight := ethbinding.HexBigInt{}
+	if err := s.rpc.CallContext(ctx, &blockHeight, "eth_blockNumber"); err != nil {
+		log.Warnf("Failed to query the chain head for the sync status: %s", err)
+		return nil
+	}
+	s.head = new(big.Int).Set(blockHeight.ToInt())
+	s.headFetched = time.Now()
+	return s.head
+}
+
+// currentBlock returns the block a subscription has processed up to, from the stream
+// checkpoint, or from the in-memory high water mark if the stream is further ahead
+func (s *subscriptionMGR) currentBlock(sub *subscription, checkpoints map[string]map[string]*big.Int) *big.Int {
+	checkpoint, loaded := checkpoints[sub.info.Stream]
+	if !loaded {
+		var err error
+		if checkpoint, err = s.loadCheckpoint(sub.info.Stream); err != nil {
+			log.Warnf("%s: Failed to load checkpoint for the sync status: %s", sub.info.Stream, err)
+		}
+		checkpoints[sub.info.Stream] = checkpoint
+	}
+	var current *big.Int
+	if cp := checkpoint[sub.info.ID]; cp != nil {
+		current = new(big.Int).Set(cp)
+	}
+	hwm := sub.blockHWM()
+	if hwm.Sign() > 0 && (current == nil || hwm.Cmp(current) > 0) {
+		current = &hwm
+	}
+	return current
+}
+
+// streamSyncStatus returns the sync status of the slowest subscription on a stream
+func (s *subscriptionMGR) streamSyncStatus(streamID string, head *big.Int, checkpoints map[string]map[string]*big.Int) SyncStatus {
+	var slowest *big.Int
+	for _, sub := range s.subscriptionsForStream(streamID) {
+		if current := s.currentBlock(sub, checkpoints); current != nil && (slowest == nil || current.Cmp(slowest) < 0) {
+			slowest = current
+		}
+	}
+	return newSyncStatus(slowest, head)
+}
+
+func newSyncStatus(current, head *big.Int) SyncStatus {
+	status := SyncStatus{
+		CurrentBlock: current,
+		ChainHead:    head,
+	}
+	if current != nil && head != nil {
+		status.BlocksBehind = new(big.Int).Sub(head, current)
+		if status.BlocksBehind.Sign() < 0 {
+			status.BlocksBehind.SetInt64(0)
+		}
+	}
+	return status
+}
+
 func (s *subscriptionMGR) setInitialBlock(i *SubscriptionInfo, initialBlock string) error {
 	// Check initial block number to subscribe from
 	if initialBlock == "" || initialBlock == FromBlockLatest {
@@ -158,11 +311,23 @@ func (s *subscriptionMGR) setInitialBlock(i *SubscriptionInfo, initialBlock stri
 }
 
 // AddSubscription adds a new subscription
-func (s *subscriptionMGR) AddSubscription(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string) (*SubscriptionInfo, error) {
+func (s *subscriptionMGR) AddSubscription(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, event *ethbinding.ABIElementMarshaling, filter map[string]interface{}, streamID, initialBlock, name string) (*SubscriptionInfo, error) {
 	return s.addSubscriptionCommon(ctx, abi, &SubscriptionCreateDTO{
 		Address:   addr,
 		Name:      name,
 		Event:     event,
+		Filter:    filter,
+		Stream:    streamID,
+		FromBlock: initialBlock,
+	})
+}
+
+// AddSubscriptionAllEvents adds a new subscription that matches every event in the ABI of a contract
+func (s *subscriptionMGR) AddSubscriptionAllEvents(ctx context.Context, addr *ethbinding.Address, abi *contractregistry.ABILocation, events ethbinding.ABIMarshaling, streamID, initialBlock, name string) (*SubscriptionInfo, error) {
+	return s.addSubscriptionCommon(ctx, abi, &SubscriptionCreateDTO{
+		Address:   addr,
+		Name:      name,
+		Events:    events,
 		Stream:    streamID,
 		FromBlock: initialBlock,
 	})
@@ -173,6 +338,61 @@ func (s *subscriptionMGR) AddSubscriptionDirect(ctx context.Context, newSub *Sub
 }
 
 func (s *subscriptionMGR) addSubscriptionCommon(ctx context.Context, abi *contractregistry.ABILocation, newSub *SubscriptionCreateDTO) (*SubscriptionInfo, error) {
+	sub, err := s.newSubscriptionFromDTO(abi, newSub)
+	if err != nil {
+		return nil, err
+	}
+	s.putSubscription(sub)
+	return s.storeSubscription(sub.info)
+}
+
+// AddSubscriptions creates a batch of subscriptions, all or nothing. Every subscription is
+// validated before any is stored, and those already stored are removed if storing one fails
+func (s *subscriptionMGR) AddSubscriptions(ctx context.Context, newSubs []*SubscriptionCreateDTO) ([]*SubscriptionBatchResult, error) {
+	if len(newSubs) == 0 {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeBatchEmpty)
+	}
+	results := make([]*SubscriptionBatchResult, len(newSubs))
+	subs := make([]*subscription, len(newSubs))
+	invalid := 0
+	for idx, newSub := range newSubs {
+		results[idx] = &SubscriptionBatchResult{Index: idx, Status: SubscriptionBatchNotCreated}
+		var err error
+		if newSub == nil {
+			err = errors.Errorf(errors.EventStreamsSubscribeBatchNilEntry)
+		} else {
+			subs[idx], err = s.newSubscriptionFromDTO(nil, newSub)
+		}
+		if err != nil {
+			results[idx].Status = SubscriptionBatchFailed
+			results[idx].Error = err.Error()
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return results, errors.Errorf(errors.EventStreamsSubscribeBatchInvalid, invalid, len(newSubs))
+	}
+
+	for idx, sub := range subs {
+		if _, err := s.storeSubscription(sub.info); err != nil {
+			for _, stored := range subs[:idx] {
+				_ = s.db.Delete(stored.info.ID)
+			}
+			results[idx].Status = SubscriptionBatchFailed
+			results[idx].Error = err.Error()
+			return results, err
+		}
+	}
+	for idx, sub := range subs {
+		s.putSubscription(sub)
+		results[idx].Status = SubscriptionBatchCreated
+		results[idx].Subscription = sub.info
+	}
+	log.Infof("Created batch of %d subscriptions", len(subs))
+	return results, nil
+}
+
+func (s *subscriptionMGR) newSubscriptionFromDTO(abi *contractregistry.ABILocation, newSub *SubscriptionCreateDTO) (*subscription, error) {
 	i := &SubscriptionInfo{
 		Name: newSub.Name,
 		TimeSorted: messages.TimeSorted{
@@ -180,29 +400,95 @@ func (s *subscriptionMGR) addSubscriptionCommon(ctx context.Context, abi *contra
 		},
 		ID:     subIDPrefix + utils.UUIDv4(),
 		Event:  newSub.Event,
+		Events: newSub.Events,
 		Stream: newSub.Stream,
 		ABI:    abi,
 	}
 	i.Path = SubPathPrefix + "/" + i.ID
 
+	if err := validateCatchup(newSub.Catchup); err != nil {
+		return nil, err
+	}
+	i.Catchup = newSub.Catchup
+	i.IndexedFilter = newSub.Filter
+	i.Type = newSub.Type
+	i.RawLog = newSub.RawLog
+	if err := validateInactivity(newSub.Inactivity, true, false); err != nil {
+		return nil, err
+	}
+	i.Inactivity = newSub.Inactivity
+
 	// Check initial block number to subscribe from
 	if err := s.setInitialBlock(i, newSub.FromBlock); err != nil {
 		return nil, err
 	}
 
 	// Create it
-	sub, err := newSubscription(s, s.rpc, s.cr, newSub.Address, i)
-	if err != nil {
-		return nil, err
-	}
-	s.subscriptions[sub.info.ID] = sub
-	return s.storeSubscription(sub.info)
+	return newSubscription(s, s.rpc, s.cr, newSub.Address, i)
 }
 
 func (s *subscriptionMGR) config() *SubscriptionManagerConf {
 	return s.conf
 }
 
+// UpdateSubscription changes the name, stream or filter of a subscription, keeping its
+// checkpoint. A subscription moved to another stream continues from the block it has
+// processed up to on the original stream, so events in-flight on that stream are delivered again
+func (s *subscriptionMGR) UpdateSubscription(ctx context.Context, id string, update *SubscriptionUpdateDTO) (*SubscriptionInfo, error) {
+	sub, err := s.subscriptionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	info := *sub.info
+	var stream *eventStream
+	if update.Stream != "" && update.Stream != info.Stream {
+		if stream, err = s.streamByID(update.Stream); err != nil {
+			return nil, err
+		}
+		if current := s.currentBlock(sub, make(map[string]map[string]*big.Int)); current != nil && current.Sign() > 0 {
+			info.FromBlock = current.Text(10)
+		}
+		info.Stream = update.Stream
+	}
+	if update.Name != "" {
+		info.Name = update.Name
+	}
+	var pending *pendingTransactionFilter
+	if update.Filter != nil {
+		var topics [][]ethbinding.Hash
+		if topics, pending, err = sub.updatedFilter(update.Filter); err != nil {
+			return nil, err
+		}
+		info.Filter.Topics = topics
+		info.IndexedFilter = update.Filter
+		if len(update.Filter) == 0 {
+			info.IndexedFilter = nil
+		}
+	}
+	if _, err := s.storeSubscription(&info); err != nil {
+		return nil, err
+	}
+
+	*sub.info = info
+	if update.Filter != nil {
+		sub.pendingFilter = pending
+	}
+	if stream != nil {
+		// The new stream restarts the subscription from the block processed on the original stream
+		lp := newLogProcessor(info.ID, sub.lp.event, stream)
+		lp.events = sub.lp.events
+		lp.rawLog = sub.lp.rawLog
+		lp.lastActivity = sub.lp.getLastActivity()
+		sub.lp = lp
+		sub.requestReset()
+	} else if update.Filter != nil {
+		// The filter is created again from the checkpoint on the next polling cycle
+		_ = sub.unsubscribe(ctx, false)
+	}
+	log.Infof("%s: Updated subscription name:%s stream:%s", sub.logName, info.Name, info.Stream)
+	return sub.info, nil
+}
+
 // ResetSubscription restarts the steam from the specified block
 func (s *subscriptionMGR) ResetSubscription(ctx context.Context, id, initialBlock string) error {
 	sub, err := s.subscriptionByID(id)
@@ -235,7 +521,9 @@ func (s *subscriptionMGR) DeleteSubscription(ctx context.Context, id string) err
 }
 
 func (s *subscriptionMGR) deleteSubscription(ctx context.Context, sub *subscription) error {
+	s.mux.Lock()
 	delete(s.subscriptions, sub.info.ID)
+	s.mux.Unlock()
 	_ = sub.unsubscribe(ctx, true)
 	if err := s.db.Delete(sub.info.ID); err != nil {
 		return err
@@ -257,14 +545,32 @@ func (s *subscriptionMGR) StreamByID(ctx context.Context, id string) (*StreamInf
 	if err != nil {
 		return nil, err
 	}
-	return stream.spec, nil
+	circuit := stream.circuitStatus()
+	connections := stream.webSocketConnections()
+	if circuit != nil || connections != nil {
+		spec := *stream.spec
+		spec.Circuit = circuit
+		spec.Connections = connections
+		return redactStreamSecrets(&spec), nil
+	}
+	return redactStreamSecrets(stream.spec), nil
 }
 
-// Streams used externally to get list streams
+// Streams used externally to get list streams, with the sync status of the slowest subscription
 func (s *subscriptionMGR) Streams(ctx context.Context) []*StreamInfo {
-	l := make([]*StreamInfo, 0, len(s.subscriptions))
-	for _, stream := range s.streams {
-		l = append(l, stream.spec)
+	streams := s.allStreams()
+	l := make([]*StreamInfo, 0, len(streams))
+	if len(streams) == 0 {
+		return l
+	}
+	head := s.chainHead(ctx)
+	checkpoints := make(map[string]map[string]*big.Int)
+	for _, stream := range streams {
+		spec := *stream.spec
+		spec.SyncStatus = s.streamSyncStatus(spec.ID, head, checkpoints)
+		spec.Circuit = stream.circuitStatus()
+		spec.Connections = stream.webSocketConnections()
+		l = append(l, redactStreamSecrets(&spec))
 	}
 	return l
 }
@@ -274,12 +580,21 @@ func (s *subscriptionMGR) AddStream(ctx context.Context, spec *StreamInfo) (*Str
 	spec.ID = streamIDPrefix + utils.UUIDv4()
 	spec.CreatedISO8601 = time.Now().UTC().Format(time.RFC3339)
 	spec.Path = StreamPathPrefix + "/" + spec.ID
+	spec.SyncStatus = SyncStatus{}
+	if strings.EqualFold(spec.Type, "webhook") && spec.Webhook != nil {
+		if err := probeWebhook(s.conf, spec.Webhook); err != nil {
+			return nil, err
+		}
+	}
 	stream, err := newEventStream(s, spec, s.wsChannels)
 	if err != nil {
 		return nil, err
 	}
-	s.streams[stream.spec.ID] = stream
-	return s.storeStream(stream.spec)
+	s.putStream(stream)
+	if _, err = s.storeStream(stream.spec); err != nil {
+		return nil, err
+	}
+	return redactStreamSecrets(stream.spec), nil
 }
 
 // UpdateStream updates an existing stream
@@ -288,11 +603,23 @@ func (s *subscriptionMGR) UpdateStream(ctx context.Context, id string, spec *Str
 	if err != nil {
 		return nil, err
 	}
+	if stream.spec.Type == "webhook" && spec.Webhook != nil {
+		restoreWebhookSecrets(stream.spec.Webhook, spec.Webhook)
+		if err := probeWebhook(s.conf, spec.Webhook); err != nil {
+			return nil, err
+		}
+	}
+	if stream.spec.Type == "mqtt" {
+		restoreMQTTPassword(stream.spec.MQTT, spec.MQTT)
+	}
 	updatedSpec, err := stream.update(spec)
 	if err != nil {
 		return nil, err
 	}
-	return s.storeStream(updatedSpec)
+	if _, err = s.storeStream(updatedSpec); err != nil {
+		return nil, err
+	}
+	return redactStreamSecrets(updatedSpec), nil
 }
 
 func (s *subscriptionMGR) storeStream(spec *StreamInfo) (*StreamInfo, error) {
@@ -310,21 +637,24 @@ func (s *subscriptionMGR) DeleteStream(ctx context.Context, id string) error {
 		return err
 	}
 	// We have to clean up all the associated subs
-	for _, sub := range s.subscriptions {
-		if sub.info.Stream == stream.spec.ID {
-			_ = s.deleteSubscription(ctx, sub)
-		}
+	for _, sub := range s.subscriptionsForStream(stream.spec.ID) {
+		_ = s.deleteSubscription(ctx, sub)
 	}
+	s.mux.Lock()
 	delete(s.streams, stream.spec.ID)
+	s.mux.Unlock()
 	stream.stop(false)
 	if err = s.db.Delete(stream.spec.ID); err != nil {
 		return err
 	}
 	s.deleteCheckpoint(stream.spec.ID)
+	s.deleteDeadLetters(stream.spec.ID)
 	return nil
 }
 
 func (s *subscriptionMGR) subscriptionsForStream(id string) []*subscription {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
 	subIDs := make([]*subscription, 0)
 	for _, sub := range s.subscriptions {
 		if sub.info.Stream == id {
@@ -360,9 +690,45 @@ func (s *subscriptionMGR) ResumeStream(ctx context.Context, id string) error {
 	return err
 }
 
+// SuspendAllStreams suspends every stream that is running, such as for a maintenance
+// window on the node, continuing past any failures and returning the first
+func (s *subscriptionMGR) SuspendAllStreams(ctx context.Context) (err error) {
+	for _, stream := range s.allStreams() {
+		if stream.spec.Suspended {
+			continue
+		}
+		log.Infof("%s: Suspending for all streams", stream.spec.ID)
+		stream.suspend()
+		if _, storeErr := s.storeStream(stream.spec); storeErr != nil && err == nil {
+			err = storeErr
+		}
+	}
+	return err
+}
+
+// ResumeAllStreams resumes every stream that is suspended, continuing past any failures and returning the first
+func (s *subscriptionMGR) ResumeAllStreams(ctx context.Context) (err error) {
+	for _, stream := range s.allStreams() {
+		if !stream.spec.Suspended {
+			continue
+		}
+		log.Infof("%s: Resuming for all streams", stream.spec.ID)
+		resumeErr := stream.resume()
+		if resumeErr == nil {
+			_, resumeErr = s.storeStream(stream.spec)
+		}
+		if resumeErr != nil && err == nil {
+			err = resumeErr
+		}
+	}
+	return err
+}
+
 // subscriptionByID used internally to lookup full objects
 func (s *subscriptionMGR) subscriptionByID(id string) (*subscription, error) {
+	s.mux.RLock()
 	sub, exists := s.subscriptions[id]
+	s.mux.RUnlock()
 	if !exists {
 		return nil, errors.Errorf(errors.EventStreamsSubscriptionNotFound, id)
 	}
@@ -371,13 +737,51 @@ func (s *subscriptionMGR) subscriptionByID(id string) (*subscription, error) {
 
 // streamByID used internally to lookup full objects
 func (s *subscriptionMGR) streamByID(id string) (*eventStream, error) {
+	s.mux.RLock()
 	stream, exists := s.streams[id]
+	s.mux.RUnlock()
 	if !exists {
 		return nil, errors.Errorf(errors.EventStreamsStreamNotFound, id)
 	}
 	return stream, nil
 }
 
+// putSubscription adds a subscription to the map, which is also read by the event pollers
+func (s *subscriptionMGR) putSubscription(sub *subscription) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.subscriptions[sub.info.ID] = sub
+}
+
+// putStream adds a stream to the map, which is also read by the event pollers
+func (s *subscriptionMGR) putStream(stream *eventStream) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.streams[stream.spec.ID] = stream
+}
+
+// allSubscriptions returns a snapshot of the subscriptions, to iterate without holding the lock
+func (s *subscriptionMGR) allSubscriptions() []*subscription {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	subs := make([]*subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// allStreams returns a snapshot of the streams, to iterate without holding the lock
+func (s *subscriptionMGR) allStreams() []*eventStream {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	streams := make([]*eventStream, 0, len(s.streams))
+	for _, stream := range s.streams {
+		streams = append(streams, stream)
+	}
+	return streams
+}
+
 func (s *subscriptionMGR) loadCheckpoint(streamID string) (map[string]*big.Int, error) {
 	cpID := checkpointIDPrefix + streamID
 	b, err := s.db.Get(cpID)
@@ -413,7 +817,7 @@ func (s *subscriptionMGR) Init() (err error) {
 	}
 	s.recoverStreams()
 	s.recoverSubscriptions()
-	return nil
+	return s.startHeartbeat()
 }
 
 func (s *subscriptionMGR) recoverStreams() {
@@ -429,11 +833,14 @@ func (s *subscriptionMGR) recoverStreams() {
 				log.Errorf("Failed to recover stream '%s': %s", string(iStream.Value()), err)
 				continue
 			}
+			if s.conf.StartSuspended {
+				streamInfo.Suspended = true
+			}
 			stream, err := newEventStream(s, &streamInfo, s.wsChannels)
 			if err != nil {
 				log.Errorf("Failed to recover stream '%s': %s", streamInfo.ID, err)
 			} else {
-				s.streams[streamInfo.ID] = stream
+				s.putStream(stream)
 			}
 		}
 	}
@@ -456,7 +863,7 @@ func (s *subscriptionMGR) recoverSubscriptions() {
 			if err != nil {
 				log.Errorf("Failed to recover subscription '%s': %s", subInfo.ID, err)
 			} else {
-				s.subscriptions[subInfo.ID] = sub
+				s.putSubscription(sub)
 			}
 		}
 	}
@@ -464,11 +871,57 @@ func (s *subscriptionMGR) recoverSubscriptions() {
 
 func (s *subscriptionMGR) Close(wait bool) {
 	log.Infof("Event stream subscription manager shutting down")
-	for _, stream := range s.streams {
+	s.stopHeartbeat()
+	for _, stream := range s.allStreams() {
 		stream.stop(wait)
 	}
+	s.kafkaMux.Lock()
+	if s.kafka != nil {
+		s.kafka.Close()
+		s.kafka = nil
+	}
+	s.kafkaMux.Unlock()
+	s.natsMux.Lock()
+	if s.nats != nil {
+		s.nats.Close()
+		s.nats = nil
+	}
+	s.natsMux.Unlock()
 	if !s.closed && s.db != nil {
 		s.db.Close()
 	}
 	s.closed = true
 }
+
+// kafkaProducer returns the producer shared by all Kafka event streams, connecting on first use
+func (s *subscriptionMGR) kafkaProducer() (kafka.KafkaBatchProducer, error) {
+	s.kafkaMux.Lock()
+	defer s.kafkaMux.Unlock()
+	if s.kafka == nil {
+		producer, err := kafka.NewKafkaBatchProducer(s.kafkaFactory, &s.conf.Kafka)
+		if err != nil {
+			return nil, errors.Errorf(errors.EventStreamsKafkaConnectFailed, err)
+		}
+		s.kafka = producer
+	}
+	return s.kafka, nil
+}
+
+// newMQTTClient creates the client for an MQTT event stream, which connects to the broker of that stream
+func (s *subscriptionMGR) newMQTTClient(opts *mqtt.ClientOptions) mqtt.Client {
+	return s.mqttFactory(opts)
+}
+
+// natsJetStream returns the JetStream connection shared by all NATS event streams, connecting on first use
+func (s *subscriptionMGR) natsJetStream() (natsJetStream, error) {
+	s.natsMux.Lock()
+	defer s.natsMux.Unlock()
+	if s.nats == nil {
+		js, err := s.natsFactory.connect(&s.conf.NATS)
+		if err != nil {
+			return nil, errors.Errorf(errors.EventStreamsNATSConnectFailed, err)
+		}
+		s.nats = js
+	}
+	return s.nats, nil
+}
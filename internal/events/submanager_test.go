@@ -16,16 +16,20 @@ package events
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/internal/ws"
 	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
 	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
 	"github.com/julienschmidt/httprouter"
@@ -40,6 +44,7 @@ type mockWebSocket struct {
 	sender            chan interface{}
 	broadcast         chan interface{}
 	receiver          chan error
+	connections       []*ws.ConnectionInfo
 }
 
 func (m *mockWebSocket) GetChannels(namespace string) (chan<- interface{}, chan<- interface{}, <-chan error) {
@@ -49,6 +54,11 @@ func (m *mockWebSocket) GetChannels(namespace string) (chan<- interface{}, chan<
 
 func (m *mockWebSocket) SendReply(message interface{}) {}
 
+func (m *mockWebSocket) Connections(topic string) []*ws.ConnectionInfo {
+	m.capturedNamespace = topic
+	return m.connections
+}
+
 func tempdir(t *testing.T) string {
 	dir, _ := ioutil.TempDir("", "fly")
 	t.Logf("tmpdir/create: %s", dir)
@@ -72,6 +82,7 @@ func newTestSubscriptionManager() *subscriptionMGR {
 	smconf := &SubscriptionManagerConf{}
 	rpc := &ethmocks.RPCClient{}
 	cr := &contractregistrymocks.ContractStore{}
+	cr.On("GetContractByAddress", mock.Anything).Return(nil, fmt.Errorf("not found")).Maybe()
 	sm := NewSubscriptionManager(smconf, rpc, cr, newMockWebSocket()).(*subscriptionMGR)
 	sm.db = kvstore.NewMockKV(nil)
 	sm.config().WebhooksAllowPrivateIPs = true
@@ -143,12 +154,18 @@ func TestActionAndSubscriptionLifecyle(t *testing.T) {
 	})
 	assert.NoError(err)
 
-	sub, err := sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "", subscriptionName)
+	sub, err := sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, nil, stream.ID, "", subscriptionName)
 	assert.NoError(err)
 	assert.Equal(stream.ID, sub.Stream)
 
-	assert.Equal([]*SubscriptionInfo{sub}, sm.Subscriptions(ctx))
-	assert.Equal([]*StreamInfo{stream}, sm.Streams(ctx))
+	// The list APIs return copies, with the sync status added
+	subs := sm.Subscriptions(ctx)
+	assert.Len(subs, 1)
+	assert.Equal(sub.ID, subs[0].ID)
+	assert.Equal(int64(0), subs[0].ChainHead.Int64())
+	streams := sm.Streams(ctx)
+	assert.Len(streams, 1)
+	assert.Equal(stream.ID, streams[0].ID)
 
 	retSub, _ := sm.SubscriptionByID(ctx, sub.ID)
 	assert.Equal(sub, retSub)
@@ -223,7 +240,7 @@ func TestActionChildCleanup(t *testing.T) {
 	})
 	assert.NoError(err)
 
-	sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "12345", "")
+	sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, nil, stream.ID, "12345", "")
 	err = sm.DeleteStream(ctx, stream.ID)
 	assert.NoError(err)
 
@@ -234,6 +251,79 @@ func TestActionChildCleanup(t *testing.T) {
 	sm.Close(true)
 }
 
+func TestSubscriptionAndStreamSyncStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	headCalls := 0
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").
+		Run(func(args mock.Arguments) {
+			headCalls++
+			args[1].(*ethbinding.HexBigInt).ToInt().SetInt64(1000)
+		}).
+		Return(nil)
+	sm := newTestSubscriptionManager()
+	sm.rpc = rpc
+	sm.config().EventPollingIntervalSec = 60
+
+	sm.streams["es-1"] = &eventStream{spec: &StreamInfo{ID: "es-1"}, batchCond: sync.NewCond(&sync.Mutex{})}
+	sm.streams["es-2"] = &eventStream{spec: &StreamInfo{ID: "es-2"}, batchCond: sync.NewCond(&sync.Mutex{})}
+	sm.subscriptions["sb-1"] = &subscription{info: &SubscriptionInfo{ID: "sb-1", Stream: "es-1"}, lp: &logProcessor{}}
+	sm.subscriptions["sb-2"] = &subscription{info: &SubscriptionInfo{ID: "sb-2", Stream: "es-1"}, lp: &logProcessor{}}
+	sm.subscriptions["sb-3"] = &subscription{info: &SubscriptionInfo{ID: "sb-3", Stream: "es-1"}, lp: &logProcessor{}}
+	sm.storeCheckpoint("es-1", map[string]*big.Int{"sb-1": big.NewInt(900), "sb-2": big.NewInt(990)})
+	// The in-memory high water mark is used when ahead of the checkpoint
+	sm.subscriptions["sb-2"].lp.initBlockHWM(big.NewInt(995))
+
+	ctx := context.Background()
+	subs := make(map[string]*SubscriptionInfo)
+	for _, sub := range sm.Subscriptions(ctx) {
+		subs[sub.ID] = sub
+	}
+	assert.Equal(int64(900), subs["sb-1"].CurrentBlock.Int64())
+	assert.Equal(int64(1000), subs["sb-1"].ChainHead.Int64())
+	assert.Equal(int64(100), subs["sb-1"].BlocksBehind.Int64())
+	assert.Equal(int64(995), subs["sb-2"].CurrentBlock.Int64())
+	assert.Equal(int64(5), subs["sb-2"].BlocksBehind.Int64())
+	assert.Nil(subs["sb-3"].CurrentBlock)
+	assert.Nil(subs["sb-3"].BlocksBehind)
+	assert.Equal(int64(1000), subs["sb-3"].ChainHead.Int64())
+	assert.Nil(sm.subscriptions["sb-1"].info.ChainHead)
+
+	streams := make(map[string]*StreamInfo)
+	for _, stream := range sm.Streams(ctx) {
+		streams[stream.ID] = stream
+	}
+	assert.Equal(int64(900), streams["es-1"].CurrentBlock.Int64())
+	assert.Equal(int64(100), streams["es-1"].BlocksBehind.Int64())
+	assert.Nil(streams["es-2"].CurrentBlock)
+	assert.Equal(int64(1000), streams["es-2"].ChainHead.Int64())
+
+	// The head is cached between calls
+	assert.Equal(1, headCalls)
+}
+
+func TestSyncStatusErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").Return(fmt.Errorf("pop"))
+	sm := newTestSubscriptionManager()
+	sm.rpc = rpc
+	sm.db = kvstore.NewMockKV(fmt.Errorf("pop"))
+	sm.subscriptions["sb-1"] = &subscription{info: &SubscriptionInfo{ID: "sb-1", Stream: "es-1"}, lp: &logProcessor{}}
+	sm.subscriptions["sb-1"].lp.initBlockHWM(big.NewInt(10))
+
+	subs := sm.Subscriptions(context.Background())
+	assert.Len(subs, 1)
+	assert.Equal(int64(10), subs[0].CurrentBlock.Int64())
+	assert.Nil(subs[0].ChainHead)
+	assert.Nil(subs[0].BlocksBehind)
+
+	assert.Equal(SyncStatus{}.BlocksBehind, newSyncStatus(nil, big.NewInt(1)).BlocksBehind)
+	assert.Equal(int64(0), newSyncStatus(big.NewInt(2), big.NewInt(1)).BlocksBehind.Int64())
+}
+
 func TestStreamAndSubscriptionErrors(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -277,6 +367,77 @@ func TestStreamAndSubscriptionErrors(t *testing.T) {
 	sm.Close(true)
 }
 
+type failNthPutKV struct {
+	*kvstore.MockKV
+	puts   int
+	failAt int
+}
+
+func (kv *failNthPutKV) Put(key string, val []byte) error {
+	kv.puts++
+	if kv.puts == kv.failAt {
+		return fmt.Errorf("pop")
+	}
+	return kv.MockKV.Put(key, val)
+}
+
+func TestAddSubscriptionsBatch(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	sm.streams["es-1"] = &eventStream{spec: &StreamInfo{ID: "es-1"}}
+	ctx := context.Background()
+
+	_, err := sm.AddSubscriptions(ctx, []*SubscriptionCreateDTO{})
+	assert.Regexp("No subscriptions supplied in the batch", err)
+
+	results, err := sm.AddSubscriptions(ctx, []*SubscriptionCreateDTO{
+		{Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "ping"}},
+		{Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "pong"}, FromBlock: "badness"},
+		nil,
+	})
+	assert.Regexp("2 of the 3 subscriptions in the batch are invalid", err)
+	assert.Equal(SubscriptionBatchNotCreated, results[0].Status)
+	assert.Equal(SubscriptionBatchFailed, results[1].Status)
+	assert.Regexp("FromBlock cannot be parsed as a BigInt", results[1].Error)
+	assert.Equal(SubscriptionBatchFailed, results[2].Status)
+	assert.Regexp("Subscription missing from the batch entry", results[2].Error)
+	assert.Empty(sm.subscriptions)
+
+	results, err = sm.AddSubscriptions(ctx, []*SubscriptionCreateDTO{
+		{Name: "sub1", Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "ping"}},
+		{Name: "sub2", Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "pong"}, FromBlock: "0"},
+	})
+	assert.NoError(err)
+	assert.Len(results, 2)
+	assert.Equal(SubscriptionBatchCreated, results[1].Status)
+	assert.Equal(1, results[1].Index)
+	assert.Equal("sub2", results[1].Subscription.Name)
+	assert.Equal("0", results[1].Subscription.FromBlock)
+	assert.Len(sm.subscriptions, 2)
+	_, err = sm.db.Get(results[0].Subscription.ID)
+	assert.NoError(err)
+}
+
+func TestAddSubscriptionsBatchStoreFailure(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	sm.streams["es-1"] = &eventStream{spec: &StreamInfo{ID: "es-1"}}
+	kv := &failNthPutKV{MockKV: kvstore.NewMockKV(nil), failAt: 2}
+	sm.db = kv
+
+	results, err := sm.AddSubscriptions(context.Background(), []*SubscriptionCreateDTO{
+		{Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "ping"}},
+		{Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "pong"}},
+		{Stream: "es-1", Event: &ethbinding.ABIElementMarshaling{Name: "pang"}},
+	})
+	assert.Regexp("Failed to store subscription: pop", err)
+	assert.Equal(SubscriptionBatchNotCreated, results[0].Status)
+	assert.Equal(SubscriptionBatchFailed, results[1].Status)
+	assert.Equal(SubscriptionBatchNotCreated, results[2].Status)
+	assert.Empty(kv.KVS)
+	assert.Empty(sm.subscriptions)
+}
+
 func TestResetSubscriptionErrors(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -308,11 +469,11 @@ func TestResetSubscriptionErrors(t *testing.T) {
 	err = sm.DeleteStream(ctx, "teststream")
 	assert.Regexp("pop", err)
 
-	_, err = sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "nope", "", "")
+	_, err = sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, nil, "nope", "", "")
 	assert.Regexp("Stream with ID 'nope' not found", err)
-	_, err = sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "teststream", "", "test")
+	_, err = sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, nil, "teststream", "", "test")
 	assert.Regexp("Failed to store subscription: pop", err)
-	_, err = sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "teststream", "!bad integer", "")
+	_, err = sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, nil, "teststream", "!bad integer", "")
 	assert.Regexp("FromBlock cannot be parsed as a BigInt", err)
 	sm.subscriptions["testsub"] = &subscription{info: &SubscriptionInfo{}, rpc: sm.rpc}
 	err = sm.ResetSubscription(ctx, "nope", "0")
@@ -323,6 +484,107 @@ func TestResetSubscriptionErrors(t *testing.T) {
 	assert.Regexp("pop", err)
 }
 
+func TestUpdateSubscription(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	rpc := &ethmocks.RPCClient{}
+	rpc.On("CallContext", mock.Anything, mock.Anything, "eth_uninstallFilter", mock.Anything).Return(nil)
+	sm.rpc = rpc
+	sm.db = kvstore.NewMockKV(nil)
+	defer sm.db.Close()
+	stream1, stream2 := newTestStream(), newTestStream()
+	defer stream1.stop(false)
+	defer stream2.stop(false)
+	sm.streams["stream1"] = stream1
+	sm.streams["stream2"] = stream2
+
+	ctx := context.Background()
+	event := &ethbinding.ABIElementMarshaling{
+		Name: "Transfer",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "from", Type: "address", Indexed: true},
+			{Name: "value", Type: "uint256"},
+		},
+	}
+	info, err := sm.AddSubscription(ctx, nil, nil, event, nil, "stream1", "0", "sub1")
+	assert.NoError(err)
+	assert.Len(info.Filter.Topics, 1)
+	err = sm.storeCheckpoint("stream1", map[string]*big.Int{info.ID: big.NewInt(100)})
+	assert.NoError(err)
+	sub := sm.subscriptions[info.ID]
+	sub.filterStale = false
+
+	// Changing the filter restarts the filter from the checkpoint, on the same stream
+	updated, err := sm.UpdateSubscription(ctx, info.ID, &SubscriptionUpdateDTO{
+		Filter: map[string]interface{}{"from": "0x1111111111111111111111111111111111111111"},
+	})
+	assert.NoError(err)
+	assert.Equal("sub1", updated.Name)
+	assert.Equal("stream1", updated.Stream)
+	assert.Equal("0", updated.FromBlock)
+	assert.Len(updated.Filter.Topics, 2)
+	assert.True(sub.filterStale)
+	assert.False(sub.resetRequested)
+
+	// Moving the subscription restarts it on the new stream from the checkpoint
+	updated, err = sm.UpdateSubscription(ctx, info.ID, &SubscriptionUpdateDTO{
+		Name:   "sub2",
+		Stream: "stream2",
+	})
+	assert.NoError(err)
+	assert.Equal("sub2", updated.Name)
+	assert.Equal("stream2", updated.Stream)
+	assert.Equal("100", updated.FromBlock)
+	assert.Len(updated.Filter.Topics, 2)
+	assert.True(sub.resetRequested)
+	assert.Equal(stream2, sub.lp.stream)
+	assert.Equal(sub.lp.event.ID, updated.Filter.Topics[0][0])
+
+	// An empty filter removes the filter
+	updated, err = sm.UpdateSubscription(ctx, info.ID, &SubscriptionUpdateDTO{Filter: map[string]interface{}{}})
+	assert.NoError(err)
+	assert.Nil(updated.IndexedFilter)
+	assert.Len(updated.Filter.Topics, 1)
+
+	var stored SubscriptionInfo
+	err = json.Unmarshal(sm.db.(*kvstore.MockKV).KVS[info.ID], &stored)
+	assert.NoError(err)
+	assert.Equal("sub2", stored.Name)
+	assert.Equal("stream2", stored.Stream)
+}
+
+func TestUpdateSubscriptionErrors(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	sm.rpc = &ethmocks.RPCClient{}
+	sm.db = kvstore.NewMockKV(nil)
+	defer sm.db.Close()
+	stream := newTestStream()
+	defer stream.stop(false)
+	sm.streams["stream1"] = stream
+
+	ctx := context.Background()
+	_, err := sm.UpdateSubscription(ctx, "nope", &SubscriptionUpdateDTO{})
+	assert.Regexp("Subscription with ID 'nope' not found", err)
+
+	info, err := sm.AddSubscription(ctx, nil, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, nil, "stream1", "", "sub1")
+	assert.NoError(err)
+	_, err = sm.UpdateSubscription(ctx, info.ID, &SubscriptionUpdateDTO{Stream: "nope"})
+	assert.Regexp("Stream with ID 'nope' not found", err)
+	_, err = sm.UpdateSubscription(ctx, info.ID, &SubscriptionUpdateDTO{Filter: map[string]interface{}{"missing": "value"}})
+	assert.Regexp("Filter argument 'missing' is not an indexed argument of event 'any'", err)
+
+	blocks, err := sm.AddSubscriptionDirect(ctx, &SubscriptionCreateDTO{Type: SubscriptionTypeBlocks, Stream: "stream1"})
+	assert.NoError(err)
+	_, err = sm.UpdateSubscription(ctx, blocks.ID, &SubscriptionUpdateDTO{Filter: map[string]interface{}{"from": "0x1111"}})
+	assert.Regexp("A subscription to blocks cannot have", err)
+
+	sm.db.(*kvstore.MockKV).StoreErr = fmt.Errorf("pop")
+	_, err = sm.UpdateSubscription(ctx, info.ID, &SubscriptionUpdateDTO{Name: "sub2"})
+	assert.Regexp("Failed to store subscription: pop", err)
+	assert.Equal("sub1", sm.subscriptions[info.ID].info.Name)
+}
+
 func TestRecoverErrors(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -342,3 +604,114 @@ func TestRecoverErrors(t *testing.T) {
 	assert.Equal(0, len(sm.streams))
 	assert.Equal(0, len(sm.subscriptions))
 }
+
+func TestSuspendAndResumeAllStreams(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.db, _ = kvstore.NewLDBKeyValueStore(path.Join(dir, "db"))
+	defer sm.db.Close()
+	ctx := context.Background()
+
+	stream1, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	})
+	assert.NoError(err)
+	stream2, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	})
+	assert.NoError(err)
+	err = sm.SuspendStream(ctx, stream2.ID)
+	assert.NoError(err)
+
+	err = sm.SuspendAllStreams(ctx)
+	assert.NoError(err)
+	assert.True(sm.streams[stream1.ID].spec.Suspended)
+	assert.True(sm.streams[stream2.ID].spec.Suspended)
+	b, _ := sm.db.Get(stream1.ID)
+	assert.Regexp(`"suspended": true`, string(b))
+
+	err = sm.ResumeAllStreams(ctx)
+	assert.NoError(err)
+	assert.False(sm.streams[stream1.ID].spec.Suspended)
+	assert.False(sm.streams[stream2.ID].spec.Suspended)
+	b, _ = sm.db.Get(stream2.ID)
+	assert.Regexp(`"suspended": false`, string(b))
+
+	sm.Close(false)
+}
+
+func TestSuspendAndResumeAllStreamsStoreFail(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+
+	_, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	})
+	assert.NoError(err)
+	sm.db.(*kvstore.MockKV).StoreErr = fmt.Errorf("pop")
+
+	err = sm.SuspendAllStreams(ctx)
+	assert.Regexp("pop", err)
+	err = sm.ResumeAllStreams(ctx)
+	assert.Regexp("pop", err)
+
+	sm.Close(false)
+}
+
+func TestRecoverStreamsStartSuspended(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	sm.conf.StartSuspended = true
+	sm.db.Put(streamIDPrefix+"esid1", []byte(`{"id":"esid1","type":"webhook","webhook":{"url":"http://test.invalid"}}`))
+
+	sm.recoverStreams()
+	assert.Equal(1, len(sm.streams))
+	assert.True(sm.streams["esid1"].spec.Suspended)
+
+	for {
+		// The stream takes a little time to see it is suspended
+		if err := sm.ResumeAllStreams(context.Background()); err == nil {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.False(sm.streams["esid1"].spec.Suspended)
+	sm.Close(false)
+}
+
+func TestStreamAndSubscriptionMapsConcurrentAccess(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.db.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				id := fmt.Sprintf("es-%d-%d", w, i)
+				sm.putStream(&eventStream{spec: &StreamInfo{ID: id}})
+				sm.putSubscription(&subscription{info: &SubscriptionInfo{ID: "sb-" + id, Stream: id}})
+				_, err := sm.streamByID(id)
+				assert.NoError(err)
+				assert.Len(sm.subscriptionsForStream(id), 1)
+				sm.allStreams()
+				sm.allSubscriptions()
+				sm.mux.Lock()
+				delete(sm.streams, id)
+				delete(sm.subscriptions, "sb-"+id)
+				sm.mux.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Empty(sm.allStreams())
+	assert.Empty(sm.allSubscriptions())
+}
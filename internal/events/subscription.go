@@ -17,7 +17,9 @@ package events
 import (
 	"context"
 	"math/big"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
@@ -43,25 +45,64 @@ type ethFilter struct {
 }
 
 type SubscriptionCreateDTO struct {
-	Name      string                           `json:"name,omitempty"`
-	Stream    string                           `json:"stream,omitempty"`
-	Event     *ethbinding.ABIElementMarshaling `json:"event,omitempty"`
-	FromBlock string                           `json:"fromBlock,omitempty"`
-	Address   *ethbinding.Address              `json:"address,omitempty"`
+	Name       string                           `json:"name,omitempty"`
+	Stream     string                           `json:"stream,omitempty"`
+	Event      *ethbinding.ABIElementMarshaling `json:"event,omitempty"`
+	FromBlock  string                           `json:"fromBlock,omitempty"`
+	Address    *ethbinding.Address              `json:"address,omitempty"`
+	Catchup    *catchupInfo                     `json:"catchup,omitempty"`
+	Events     ethbinding.ABIMarshaling         `json:"events,omitempty"`
+	Filter     map[string]interface{}           `json:"filter,omitempty"`
+	Type       string                           `json:"type,omitempty"`
+	RawLog     bool                             `json:"rawLog,omitempty"`
+	Inactivity *inactivityInfo                  `json:"inactivity,omitempty"`
+}
+
+// SubscriptionUpdateDTO is a change to the name, stream or filter of a subscription.
+// Fields that are omitted are unchanged, and an empty filter removes the filter
+type SubscriptionUpdateDTO struct {
+	Name   string                 `json:"name,omitempty"`
+	Stream string                 `json:"stream,omitempty"`
+	Filter map[string]interface{} `json:"filter,omitempty"`
+}
+
+const (
+	// SubscriptionBatchCreated is the status of a subscription created in a batch
+	SubscriptionBatchCreated = "created"
+	// SubscriptionBatchFailed is the status of an invalid subscription, which caused the batch to fail
+	SubscriptionBatchFailed = "failed"
+	// SubscriptionBatchNotCreated is the status of a valid subscription in a batch that failed
+	SubscriptionBatchNotCreated = "notCreated"
+)
+
+// SubscriptionBatchResult is the outcome for one subscription in a batch
+type SubscriptionBatchResult struct {
+	Index        int               `json:"index"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"`
+	Subscription *SubscriptionInfo `json:"subscription,omitempty"`
 }
 
 // SubscriptionInfo is the persisted data for the subscription
 type SubscriptionInfo struct {
 	messages.TimeSorted
-	ID        string                           `json:"id,omitempty"`
-	Path      string                           `json:"path"`
-	Summary   string                           `json:"-"`    // System generated name for the subscription
-	Name      string                           `json:"name"` // User provided name for the subscription, set to Summary if missing
-	Stream    string                           `json:"stream"`
-	Filter    persistedFilter                  `json:"filter"`
-	Event     *ethbinding.ABIElementMarshaling `json:"event"`
-	FromBlock string                           `json:"fromBlock,omitempty"`
-	ABI       *contractregistry.ABILocation    `json:"abi,omitempty"`
+	ID              string                           `json:"id,omitempty"`
+	Path            string                           `json:"path"`
+	Summary         string                           `json:"-"`              // System generated name for the subscription
+	Name            string                           `json:"name"`           // User provided name for the subscription, set to Summary if missing
+	Type            string                           `json:"type,omitempty"` // Empty for a subscription to events, or "blocks" for block headers
+	Stream          string                           `json:"stream"`
+	Filter          persistedFilter                  `json:"filter"`
+	Event           *ethbinding.ABIElementMarshaling `json:"event"`
+	Events          ethbinding.ABIMarshaling         `json:"events,omitempty"`        // Every event of the contract, for a subscription to all of them
+	IndexedFilter   map[string]interface{}           `json:"indexedFilter,omitempty"` // Values of indexed arguments of the event to match, from the filter on creation
+	FromBlock       string                           `json:"fromBlock,omitempty"`
+	ABI             *contractregistry.ABILocation    `json:"abi,omitempty"`
+	Catchup         *catchupInfo                     `json:"catchup,omitempty"`
+	CatchupProgress *CatchupProgress                 `json:"catchupProgress,omitempty"`
+	RawLog          bool                             `json:"rawLog,omitempty"` // Include the topics, data and removed flag of the log in each event
+	Inactivity      *inactivityInfo                  `json:"inactivity,omitempty"`
+	SyncStatus
 }
 
 // subscription is the runtime that manages the subscription
@@ -75,10 +116,50 @@ type subscription struct {
 	filteredOnce        bool
 	filterStale         bool
 	deleting            bool
+	inactivity          inactivityState
 	resetRequested      bool
 	catchupBlock        *big.Int
 	catchupModeBlockGap int64
 	catchupModePageSize int64
+	catchupMux          sync.Mutex
+	catchupProgress     *CatchupProgress
+	lastCatchupQuery    time.Time
+	versionCache        map[string]map[ethbinding.Hash]*ethbinding.ABIEvent // events of the ABI versions of upgraded contracts
+	versionsMux         sync.Mutex
+	nextBlock           *big.Int // the next block header to deliver, for a subscription to blocks
+	pendingFilter       *pendingTransactionFilter
+}
+
+// subscriptionEvents parses the event of a subscription, or every event of a subscription to all the
+// events of a contract, keyed by the event ID that is the first topic of each log.
+// Anonymous events do not have an ID, so cannot be included in a subscription to all events
+func subscriptionEvents(i *SubscriptionInfo) (event *ethbinding.ABIEvent, events map[ethbinding.Hash]*ethbinding.ABIEvent, signature string, err error) {
+	if i.Type == SubscriptionTypeBlocks || i.Type == SubscriptionTypePendingTransactions {
+		return nil, nil, i.Type, nil
+	}
+	if len(i.Events) == 0 {
+		if event, err = ethbind.API.ABIElementMarshalingToABIEvent(i.Event); err != nil {
+			return nil, nil, "", err
+		}
+		return event, nil, ethbind.API.ABIEventSignature(event), nil
+	}
+	events = make(map[ethbinding.Hash]*ethbinding.ABIEvent)
+	for idx := range i.Events {
+		if i.Events[idx].Type != "event" {
+			continue
+		}
+		e, err := ethbind.API.ABIElementMarshalingToABIEvent(&i.Events[idx])
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if e != nil && !e.Anonymous {
+			events[e.ID] = e
+		}
+	}
+	if len(events) == 0 {
+		return nil, nil, "", errors.Errorf(errors.EventStreamsSubscribeNoContractEvents)
+	}
+	return nil, events, "*", nil
 }
 
 func newSubscription(sm subscriptionManager, rpc eth.RPCClient, cr contractregistry.ContractResolver, addr *ethbinding.Address, i *SubscriptionInfo) (*subscription, error) {
@@ -86,7 +167,10 @@ func newSubscription(sm subscriptionManager, rpc eth.RPCClient, cr contractregis
 	if err != nil {
 		return nil, err
 	}
-	event, err := ethbind.API.ABIElementMarshalingToABIEvent(i.Event)
+	if err := validateSubscriptionType(i, addr); err != nil {
+		return nil, err
+	}
+	event, events, signature, err := subscriptionEvents(i)
 	if err != nil {
 		return nil, err
 	}
@@ -95,32 +179,87 @@ func newSubscription(sm subscriptionManager, rpc eth.RPCClient, cr contractregis
 		rpc:                 rpc,
 		cr:                  cr,
 		lp:                  newLogProcessor(i.ID, event, stream),
-		logName:             i.ID + ":" + ethbind.API.ABIEventSignature(event),
+		logName:             i.ID + ":" + signature,
 		filterStale:         true,
 		catchupModeBlockGap: sm.config().CatchupModeBlockGap,
 		catchupModePageSize: sm.config().CatchupModePageSize,
 	}
+	s.lp.rawLog = i.RawLog
 	f := &i.Filter
 	addrStr := "*"
 	if addr != nil {
 		f.Addresses = []ethbinding.Address{*addr}
 		addrStr = addr.String()
 	}
-	i.Summary = addrStr + ":" + ethbind.API.ABIEventSignature(event)
+	i.Summary = addrStr + ":" + signature
 	// If a name was not provided by the end user, set it to the system generated summary
 	if i.Name == "" {
 		log.Debugf("No name provided for subscription, using auto-generated summary:%s", i.Summary)
 		i.Name = i.Summary
 	}
+	if s.isBlocks() {
+		log.Infof("Created subscription ID:%s name:%s to blocks", i.ID, i.Name)
+		return s, nil
+	}
+	if s.isPendingTransactions() {
+		if s.pendingFilter, err = newPendingTransactionFilter(i.IndexedFilter); err != nil {
+			return nil, err
+		}
+		log.Infof("Created subscription ID:%s name:%s to pending transactions", i.ID, i.Name)
+		return s, nil
+	}
+	if events != nil {
+		if len(i.IndexedFilter) > 0 {
+			return nil, errors.Errorf(errors.EventStreamsSubscribeFilterMultipleEvents)
+		}
+		// Match any of the events of the contract, on the first topic
+		s.lp.events = events
+		ids := make([]ethbinding.Hash, 0, len(events))
+		for id := range events {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(a, b int) bool { return ids[a].Hex() < ids[b].Hex() })
+		f.Topics = [][]ethbinding.Hash{ids}
+		log.Infof("Created subscription ID:%s name:%s events:%d", i.ID, i.Name, len(ids))
+		return s, nil
+	}
 	if event == nil || event.Name == "" {
 		return nil, errors.Errorf(errors.EventStreamsSubscribeNoEvent)
 	}
-	// For now we only support filtering on the event type
-	f.Topics = [][]ethbinding.Hash{{event.ID}}
+	if event.Anonymous && addr == nil {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeAnonymousNoAddress, event.Name)
+	}
+	// Filter on the event type, and the values of any indexed arguments in the filter
+	if f.Topics, err = indexedArgsTopics(event, i.IndexedFilter); err != nil {
+		return nil, err
+	}
 	log.Infof("Created subscription ID:%s name:%s topic:%s", i.ID, i.Name, event.ID)
 	return s, nil
 }
 
+// updatedFilter validates a new filter for a subscription, and returns the topics to
+// filter logs on, or the filter for a subscription to pending transactions
+func (s *subscription) updatedFilter(filter map[string]interface{}) (topics [][]ethbinding.Hash, pending *pendingTransactionFilter, err error) {
+	switch {
+	case s.isBlocks():
+		if len(filter) > 0 {
+			return nil, nil, errors.Errorf(errors.EventStreamsSubscribeBlocksWithEvent)
+		}
+		return nil, nil, nil
+	case s.isPendingTransactions():
+		pending, err = newPendingTransactionFilter(filter)
+		return nil, pending, err
+	case s.lp.events != nil:
+		if len(filter) > 0 {
+			return nil, nil, errors.Errorf(errors.EventStreamsSubscribeFilterMultipleEvents)
+		}
+		return s.info.Filter.Topics, nil, nil
+	default:
+		topics, err = indexedArgsTopics(s.lp.event, filter)
+		return topics, nil, err
+	}
+}
+
 // GetID returns the ID (for sorting)
 func (info *SubscriptionInfo) GetID() string {
 	return info.ID
@@ -145,7 +284,13 @@ func restoreSubscription(sm subscriptionManager, rpc eth.RPCClient, cr contractr
 	if err != nil {
 		return nil, err
 	}
-	event, err := ethbind.API.ABIElementMarshalingToABIEvent(i.Event)
+	return restoreSubscriptionOnStream(sm, rpc, cr, stream, i)
+}
+
+// restoreSubscriptionOnStream builds a subscription for a stream that might not yet be
+// registered with the manager, such as one that is being imported
+func restoreSubscriptionOnStream(sm subscriptionManager, rpc eth.RPCClient, cr contractregistry.ContractResolver, stream *eventStream, i *SubscriptionInfo) (*subscription, error) {
+	event, events, signature, err := subscriptionEvents(i)
 	if err != nil {
 		return nil, err
 	}
@@ -154,11 +299,18 @@ func restoreSubscription(sm subscriptionManager, rpc eth.RPCClient, cr contractr
 		cr:                  cr,
 		info:                i,
 		lp:                  newLogProcessor(i.ID, event, stream),
-		logName:             i.ID + ":" + ethbind.API.ABIEventSignature(event),
+		logName:             i.ID + ":" + signature,
 		filterStale:         true,
 		catchupModeBlockGap: sm.config().CatchupModeBlockGap,
 		catchupModePageSize: sm.config().CatchupModePageSize,
 	}
+	s.lp.rawLog = i.RawLog
+	s.lp.events = events
+	if s.isPendingTransactions() {
+		if s.pendingFilter, err = newPendingTransactionFilter(i.IndexedFilter); err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
@@ -192,7 +344,7 @@ func (s *subscription) setCheckpointBlockHeight(i *big.Int) {
 
 func (s *subscription) createFilter(ctx context.Context, since *big.Int) error {
 	f := &ethFilter{}
-	f.persistedFilter = s.info.Filter
+	f.persistedFilter = s.versionedFilter()
 	f.FromBlock.ToInt().Set(since)
 	f.ToBlock = "latest"
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -202,6 +354,7 @@ func (s *subscription) createFilter(ctx context.Context, since *big.Int) error {
 		return errors.Errorf(errors.RPCCallReturnedError, "eth_newFilter", err)
 	}
 	s.catchupBlock = nil // we are not in catchup mode now
+	s.updateCatchupProgress(nil)
 	s.filteredOnce = false
 	s.markFilterStale(ctx, false)
 	log.Infof("%s: created filter from block %s: %s - %+v", s.logName, since.String(), s.filterID.String(), s.info.Filter)
@@ -219,6 +372,17 @@ func (s *subscription) restartFilter(ctx context.Context, checkpoint *big.Int) e
 		since = s.catchupBlock
 	}
 
+	if s.isBlocks() {
+		// Blocks are read by number, so there is no filter to create on the node
+		s.nextBlock = new(big.Int).Set(since)
+		s.filterStale = false
+		log.Infof("%s: delivering blocks from block %s", s.logName, since.String())
+		return nil
+	}
+	if s.isPendingTransactions() {
+		return s.createPendingTransactionFilter(ctx)
+	}
+
 	blockNumber := ethbinding.HexBigInt{}
 	err := s.rpc.CallContext(ctx, &blockNumber, "eth_blockNumber")
 	if err != nil {
@@ -229,6 +393,7 @@ func (s *subscription) restartFilter(ctx context.Context, checkpoint *big.Int) e
 	log.Debugf("%s: restarting. Head=%s Position=%s Gap=%d (catchup threshold: %d)", s.logName, blockNumber.ToInt().String(), since.String(), blockGap, s.catchupModeBlockGap)
 	if s.catchupModeBlockGap > 0 && blockGap > s.catchupModeBlockGap {
 		s.catchupBlock = since // note if we were already in catchup, this does not change anything
+		s.updateCatchupProgress(blockNumber.ToInt())
 		return nil
 	}
 
@@ -286,14 +451,17 @@ func (s *subscription) getTransactionInputs(ctx context.Context, l *logEntry) {
 }
 
 func (s *subscription) processCatchupBlocks(ctx context.Context) error {
+	if s.catchupThrottled() {
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 	var logs []*logEntry
 
 	f := &ethFilter{}
-	f.persistedFilter = s.info.Filter
+	f.persistedFilter = s.versionedFilter()
 	f.FromBlock.ToInt().Set(s.catchupBlock)
-	endBlock := new(big.Int).Add(s.catchupBlock, big.NewInt(s.catchupModePageSize-1))
+	endBlock := new(big.Int).Add(s.catchupBlock, big.NewInt(s.catchupPageSize()-1))
 	f.ToBlock = "0x" + endBlock.Text(16)
 
 	log.Infof("%s: catchup mode. Blocks %d -> %d", s.logName, s.catchupBlock.Int64(), endBlock.Int64())
@@ -308,6 +476,7 @@ func (s *subscription) processCatchupBlocks(ctx context.Context) error {
 		s.processLogs(ctx, "eth_getLogs", logs)
 	}
 	s.catchupBlock = endBlock.Add(endBlock, big.NewInt(1))
+	s.updateCatchupProgress(nil)
 	return nil
 }
 
@@ -323,6 +492,7 @@ func (s *subscription) processLogs(ctx context.Context, rpcMethod string, logs [
 		if s.lp.stream.spec.Inputs {
 			s.getTransactionInputs(ctx, logEntry)
 		}
+		logEntry.event = s.versionedEvent(logEntry)
 		if err := s.lp.processLogEntry(s.logName, logEntry, idx); err != nil {
 			log.Errorf("Failed to process event: %s", err)
 		}
@@ -330,6 +500,12 @@ func (s *subscription) processLogs(ctx context.Context, rpcMethod string, logs [
 }
 
 func (s *subscription) processNewEvents(ctx context.Context) error {
+	if s.isBlocks() {
+		return s.processNewBlocks(ctx)
+	}
+	if s.isPendingTransactions() {
+		return s.processPendingTransactions(ctx)
+	}
 	if s.catchupBlock != nil {
 		return s.processCatchupBlocks(ctx)
 	}
@@ -374,7 +550,7 @@ func (s *subscription) blockHWM() big.Int {
 func (s *subscription) markFilterStale(ctx context.Context, newFilterStale bool) {
 	log.Debugf("%s: Marking filter stale=%t, current sub filter stale=%t", s.logName, newFilterStale, s.filterStale)
 	// If unsubscribe is called multiple times, we might not have a filter
-	if newFilterStale && !s.filterStale {
+	if newFilterStale && !s.filterStale && !s.isBlocks() {
 		var retval bool
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
@@ -383,6 +559,7 @@ func (s *subscription) markFilterStale(ctx context.Context, newFilterStale bool)
 		log.Infof("%s: Uninstalled filter. ok=%t (%s)", s.logName, retval, err)
 		// Clear any catchup mode state. We will restart from the last checkpoint
 		s.catchupBlock = nil
+		s.updateCatchupProgress(nil)
 	}
 	s.filterStale = newFilterStale
 }
@@ -21,9 +21,11 @@ import (
 	"math/big"
 	"testing"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
 	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/kafka"
 	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/mocks/contractregistrymocks"
@@ -39,9 +41,18 @@ type mockSubMgr struct {
 	subscription  *subscription
 	err           error
 	subscriptions []*subscription
+	kafka         kafka.KafkaBatchProducer
+	mqtt          mqtt.Client
+	nats          natsJetStream
+	deletedStream string
+	deletedSubs   []string
+	conf          *SubscriptionManagerConf
 }
 
 func (m *mockSubMgr) config() *SubscriptionManagerConf {
+	if m.conf != nil {
+		return m.conf
+	}
 	return &SubscriptionManagerConf{}
 }
 
@@ -61,6 +72,26 @@ func (m *mockSubMgr) loadCheckpoint(string) (map[string]*big.Int, error) { retur
 
 func (m *mockSubMgr) storeCheckpoint(string, map[string]*big.Int) error { return nil }
 
+func (m *mockSubMgr) storeStream(spec *StreamInfo) (*StreamInfo, error) { return spec, m.err }
+
+func (m *mockSubMgr) storeDeadLetter(streamID, id string, b []byte) error { return m.err }
+
+func (m *mockSubMgr) kafkaProducer() (kafka.KafkaBatchProducer, error) { return m.kafka, m.err }
+
+func (m *mockSubMgr) newMQTTClient(opts *mqtt.ClientOptions) mqtt.Client { return m.mqtt }
+
+func (m *mockSubMgr) natsJetStream() (natsJetStream, error) { return m.nats, m.err }
+
+func (m *mockSubMgr) DeleteStream(ctx context.Context, id string) error {
+	m.deletedStream = id
+	return m.err
+}
+
+func (m *mockSubMgr) DeleteSubscription(ctx context.Context, id string) error {
+	m.deletedSubs = append(m.deletedSubs, id)
+	return m.err
+}
+
 func newTestStream() *eventStream {
 	a, _ := newEventStream(newTestSubscriptionManager(), &StreamInfo{
 		ID:   "123",
@@ -116,6 +147,43 @@ func TestCreateWebhookSub(t *testing.T) {
 	assert.Equal("0x80f327694f71b67acac8d8c4b097d66a508a3cb6f8f27644c932bf508654a046", s.info.Filter.Topics[0][0].Hex())
 }
 
+func TestCreateSubscriptionRawLog(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+
+	i := testSubInfo(&ethbinding.ABIElementMarshaling{Name: "ping"})
+	i.RawLog = true
+	s, err := newSubscription(m, nil, nil, nil, i)
+	assert.NoError(err)
+	assert.True(s.lp.rawLog)
+
+	s1, err := restoreSubscription(m, nil, nil, i)
+	assert.NoError(err)
+	assert.True(s1.lp.rawLog)
+}
+
+func TestCreateSubscriptionAnonymous(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	event := &ethbinding.ABIElementMarshaling{
+		Name:      "anon",
+		Anonymous: true,
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "value", Type: "uint256"},
+			{Name: "from", Type: "address", Indexed: true},
+		},
+	}
+
+	_, err := newSubscription(m, nil, nil, nil, testSubInfo(event))
+	assert.Regexp("An address is required to subscribe to anonymous event 'anon'", err)
+
+	addr := ethbind.API.HexToAddress("0x0123456789abcDEF0123456789abCDef01234567")
+	s, err := newSubscription(m, nil, nil, &addr, testSubInfo(event))
+	assert.NoError(err)
+	assert.Empty(s.info.Filter.Topics)
+	assert.Equal([]ethbinding.Address{addr}, s.info.Filter.Addresses)
+}
+
 func TestCreateWebhookSubWithAddr(t *testing.T) {
 	assert := assert.New(t)
 
@@ -132,8 +200,8 @@ func TestCreateWebhookSubWithAddr(t *testing.T) {
 	s, err := newSubscription(m, rpc, nil, &addr, subInfo)
 	assert.NoError(err)
 	assert.NotEmpty(s.info.ID)
-	// common.BytesToHash(crypto.Keccak256([]byte("devcon()"))).Hex()
-	assert.Equal("0x81b7baac232325e8fb0e2446cc62852d9f68c86874699311b99ef89d8ed424dd", s.info.Filter.Topics[0][0].Hex())
+	// The logs of an anonymous event do not include the event ID, so there is no topic to filter on
+	assert.Empty(s.info.Filter.Topics)
 	assert.Equal("0x0123456789abcDEF0123456789abCDef01234567:devcon()", s.info.Summary)
 	assert.Equal("mySubscription", s.info.Name)
 }
@@ -146,6 +214,54 @@ func TestCreateSubscriptionNoEvent(t *testing.T) {
 	assert.Regexp("Solidity event name must be specified", err)
 }
 
+func TestCreateSubscriptionAllEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &ethmocks.RPCClient{}
+	m := &mockSubMgr{stream: newTestStream()}
+	addr := ethbind.API.HexToAddress("0x0123456789abcDEF0123456789abCDef01234567")
+	i := &SubscriptionInfo{ID: "test", Stream: "streamID", Events: ethbinding.ABIMarshaling{
+		{Type: "function", Name: "set"},
+		{Type: "event", Name: "glastonbury", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "field", Type: "address"}}},
+		{Type: "event", Name: "devcon", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "talks", Type: "uint256"}}},
+		{Type: "event", Name: "hidden", Anonymous: true},
+	}}
+	s, err := newSubscription(m, rpc, nil, &addr, i)
+	assert.NoError(err)
+	assert.Equal("0x0123456789abcDEF0123456789abCDef01234567:*", s.info.Summary)
+	assert.Equal(1, len(s.info.Filter.Topics))
+	assert.Equal(2, len(s.info.Filter.Topics[0]))
+	assert.Equal(2, len(s.lp.events))
+	assert.Nil(s.lp.event)
+	assert.True(s.info.Filter.Topics[0][0].Hex() < s.info.Filter.Topics[0][1].Hex())
+
+	s1, err := restoreSubscription(m, rpc, nil, i)
+	assert.NoError(err)
+	assert.Equal(2, len(s1.lp.events))
+	assert.Equal("test:*", s1.logName)
+}
+
+func TestCreateSubscriptionAllEventsNoEvents(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := &SubscriptionInfo{ID: "test", Stream: "streamID", Events: ethbinding.ABIMarshaling{
+		{Type: "function", Name: "set"},
+		{Type: "event", Name: "hidden", Anonymous: true},
+	}}
+	_, err := newSubscription(m, nil, nil, nil, i)
+	assert.Regexp("The ABI does not declare any events that are not anonymous", err)
+}
+
+func TestCreateSubscriptionAllEventsBadABI(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := &SubscriptionInfo{ID: "test", Stream: "streamID", Events: ethbinding.ABIMarshaling{
+		{Type: "event", Name: "bad", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "x", Type: "badness"}}},
+	}}
+	_, err := newSubscription(m, nil, nil, nil, i)
+	assert.Regexp("unsupported arg type: badness", err)
+}
+
 func TestCreateSubscriptionBadABI(t *testing.T) {
 	assert := assert.New(t)
 	event := &ethbinding.ABIElementMarshaling{
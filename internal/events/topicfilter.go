@@ -0,0 +1,183 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// twoTo256 is the modulus used to encode negative signed integers as two's complement topics
+var twoTo256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// indexedArgsTopics builds the topics of a filter for an event from a filter on its indexed arguments.
+// The first topic is the event ID, followed by one position for each indexed argument. A filter value
+// can be an array, to match any of the values. Indexed arguments that are not in the filter match any
+// value, and are left out of the end of the topics. An anonymous event does not have its ID in the
+// log, so the first topic is the first indexed argument
+func indexedArgsTopics(event *ethbinding.ABIEvent, filter map[string]interface{}) ([][]ethbinding.Hash, error) {
+	topics := [][]ethbinding.Hash{{event.ID}}
+	minTopics := 1
+	if event.Anonymous {
+		topics = [][]ethbinding.Hash{}
+		minTopics = 0
+	}
+	matched := 0
+	for idx := range event.Inputs {
+		input := &event.Inputs[idx]
+		if !input.Indexed {
+			continue
+		}
+		value, ok := filter[input.Name]
+		if !ok {
+			topics = append(topics, nil)
+			continue
+		}
+		matched++
+		values, isArray := value.([]interface{})
+		if !isArray {
+			values = []interface{}{value}
+		}
+		hashes := make([]ethbinding.Hash, len(values))
+		for i, v := range values {
+			h, err := topicFromValue(input, v)
+			if err != nil {
+				return nil, err
+			}
+			hashes[i] = h
+		}
+		topics = append(topics, hashes)
+	}
+	if matched < len(filter) {
+		for name := range filter {
+			if !isIndexedArg(event, name) {
+				return nil, errors.Errorf(errors.EventStreamsSubscribeFilterNotIndexed, name, event.Name)
+			}
+		}
+	}
+	for len(topics) > minTopics && topics[len(topics)-1] == nil {
+		topics = topics[:len(topics)-1]
+	}
+	return topics, nil
+}
+
+func isIndexedArg(event *ethbinding.ABIEvent, name string) bool {
+	for _, input := range event.Inputs {
+		if input.Indexed && input.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// topicFromValue encodes a filter value in the same way as the indexed argument is encoded in the
+// topics of a log. Strings, bytes, arrays and structs are stored in the topic as a hash of the value,
+// so the filter value for those must be the 32 byte hash in hex
+func topicFromValue(input *ethbinding.ABIArgument, value interface{}) (h ethbinding.Hash, err error) {
+	badValue := func() (ethbinding.Hash, error) {
+		return h, errors.Errorf(errors.EventStreamsSubscribeFilterBadValue, input.Name, input.Type.String(), value)
+	}
+	switch input.Type.T {
+	case ethbinding.AddressTy:
+		s, ok := value.(string)
+		if !ok || !ethbind.API.IsHexAddress(s) {
+			return badValue()
+		}
+		addr := ethbind.API.HexToAddress(s)
+		copy(h[32-len(addr):], addr[:])
+	case ethbinding.IntTy, ethbinding.UintTy:
+		i, ok := filterInteger(value)
+		if !ok || !integerInRange(input.Type.T, input.Type.Size, i) {
+			return badValue()
+		}
+		if i.Sign() < 0 {
+			i.Add(i, twoTo256)
+		}
+		i.FillBytes(h[:])
+	case ethbinding.BoolTy:
+		var b bool
+		switch v := value.(type) {
+		case bool:
+			b = v
+		case string:
+			switch strings.ToLower(v) {
+			case "true":
+				b = true
+			case "false":
+			default:
+				return badValue()
+			}
+		default:
+			return badValue()
+		}
+		if b {
+			h[31] = 1
+		}
+	case ethbinding.FixedBytesTy:
+		s, ok := value.(string)
+		if !ok {
+			return badValue()
+		}
+		b, err := ethbind.API.HexDecode(s)
+		if err != nil || len(b) > input.Type.Size {
+			return badValue()
+		}
+		copy(h[:], b)
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return badValue()
+		}
+		b, err := ethbind.API.HexDecode(s)
+		if err != nil || len(b) != len(h) {
+			return badValue()
+		}
+		copy(h[:], b)
+	}
+	return h, nil
+}
+
+// filterInteger parses an integer from a JSON number, or from a decimal or 0x prefixed hex string
+func filterInteger(value interface{}) (*big.Int, bool) {
+	switch v := value.(type) {
+	case string:
+		return new(big.Int).SetString(v, 0)
+	case json.Number:
+		return new(big.Int).SetString(v.String(), 0)
+	case float64:
+		f := big.NewFloat(v)
+		if !f.IsInt() {
+			return nil, false
+		}
+		i, _ := f.Int(nil)
+		return i, true
+	}
+	return nil, false
+}
+
+// integerInRange checks an integer can be stored in a signed or unsigned integer of the size in bits
+func integerInRange(t byte, size int, i *big.Int) bool {
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(size))
+	if t == ethbinding.IntTy {
+		limit.Rsh(limit, 1)
+		return i.Cmp(new(big.Int).Neg(limit)) >= 0 && i.Cmp(limit) < 0
+	}
+	return i.Sign() >= 0 && i.Cmp(limit) < 0
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFilterEvent(t *testing.T) *ethbinding.ABIEvent {
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&ethbinding.ABIElementMarshaling{
+		Type: "event",
+		Name: "Transfer",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "from", Type: "address", Indexed: true},
+			{Name: "to", Type: "address", Indexed: true},
+			{Name: "value", Type: "uint256"},
+			{Name: "delta", Type: "int8", Indexed: true},
+		},
+	})
+	assert.NoError(t, err)
+	return event
+}
+
+func TestIndexedArgsTopics(t *testing.T) {
+	assert := assert.New(t)
+	event := testFilterEvent(t)
+
+	topics, err := indexedArgsTopics(event, nil)
+	assert.NoError(err)
+	assert.Equal([][]ethbinding.Hash{{event.ID}}, topics)
+
+	topics, err = indexedArgsTopics(event, map[string]interface{}{
+		"to": []interface{}{"0x0123456789abcDEF0123456789abCDef01234567", "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+	})
+	assert.NoError(err)
+	assert.Equal(3, len(topics))
+	assert.Nil(topics[1])
+	assert.Equal("0x0000000000000000000000000123456789abcdef0123456789abcdef01234567", topics[2][0].Hex())
+	assert.Equal("0x000000000000000000000000aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", topics[2][1].Hex())
+
+	topics, err = indexedArgsTopics(event, map[string]interface{}{
+		"from":  "0x0123456789abcDEF0123456789abCDef01234567",
+		"delta": float64(-1),
+	})
+	assert.NoError(err)
+	assert.Equal(4, len(topics))
+	assert.Nil(topics[2])
+	assert.Equal("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", topics[3][0].Hex())
+
+	b, _ := json.Marshal(&persistedFilter{Topics: topics})
+	assert.Regexp(`"topics":\[\["0x[0-9a-f]{64}"\],\["0x[0-9a-f]{64}"\],null,\["0x[f]{64}"\]\]`, string(b))
+}
+
+func TestIndexedArgsTopicsAnonymous(t *testing.T) {
+	assert := assert.New(t)
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&ethbinding.ABIElementMarshaling{
+		Type:      "event",
+		Name:      "Anon",
+		Anonymous: true,
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "value", Type: "uint256"},
+			{Name: "from", Type: "address", Indexed: true},
+		},
+	})
+	assert.NoError(err)
+
+	topics, err := indexedArgsTopics(event, nil)
+	assert.NoError(err)
+	assert.Empty(topics)
+
+	topics, err = indexedArgsTopics(event, map[string]interface{}{"from": "0x0123456789abcDEF0123456789abCDef01234567"})
+	assert.NoError(err)
+	assert.Equal(1, len(topics))
+	assert.Equal("0x0000000000000000000000000123456789abcdef0123456789abcdef01234567", topics[0][0].Hex())
+}
+
+func TestIndexedArgsTopicsNotIndexed(t *testing.T) {
+	assert := assert.New(t)
+	event := testFilterEvent(t)
+
+	_, err := indexedArgsTopics(event, map[string]interface{}{"value": "1"})
+	assert.Regexp("Filter argument 'value' is not an indexed argument of event 'Transfer'", err)
+
+	_, err = indexedArgsTopics(event, map[string]interface{}{"from": "0x0123456789abcDEF0123456789abCDef01234567", "unknown": "1"})
+	assert.Regexp("Filter argument 'unknown' is not an indexed argument of event 'Transfer'", err)
+}
+
+func TestIndexedArgsTopicsBadValue(t *testing.T) {
+	assert := assert.New(t)
+	event := testFilterEvent(t)
+
+	_, err := indexedArgsTopics(event, map[string]interface{}{"from": "not an address"})
+	assert.Regexp("Invalid filter value for indexed argument 'from' of type address", err)
+
+	_, err = indexedArgsTopics(event, map[string]interface{}{"delta": []interface{}{float64(1), float64(128)}})
+	assert.Regexp("Invalid filter value for indexed argument 'delta' of type int8: 128", err)
+}
+
+func TestTopicFromValue(t *testing.T) {
+	assert := assert.New(t)
+
+	arg := func(typeName string) *ethbinding.ABIArgument {
+		typ, err := ethbind.API.ABITypeFor(typeName)
+		assert.NoError(err)
+		return &ethbinding.ABIArgument{Name: "arg", Type: typ, Indexed: true}
+	}
+	topic := func(typeName string, value interface{}) string {
+		h, err := topicFromValue(arg(typeName), value)
+		assert.NoError(err)
+		return h.Hex()
+	}
+	badValue := func(typeName string, value interface{}) {
+		_, err := topicFromValue(arg(typeName), value)
+		assert.Regexp("Invalid filter value for indexed argument 'arg'", err)
+	}
+	hash := "0x49d0d5ec93185ca4cd24efff28fdeef97bd06fe7a26f771e645892433184af13"
+
+	assert.Equal("0x000000000000000000000000000000000000000000000000000000000000000a", topic("uint256", "10"))
+	assert.Equal("0x00000000000000000000000000000000000000000000000000000000000000ff", topic("uint8", "0xff"))
+	assert.Equal("0x000000000000000000000000000000000000000000000000000000000000002a", topic("uint64", json.Number("42")))
+	assert.Equal("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80", topic("int8", float64(-128)))
+	assert.Equal("0x0000000000000000000000000000000000000000000000000000000000000001", topic("bool", true))
+	assert.Equal("0x0000000000000000000000000000000000000000000000000000000000000001", topic("bool", "TRUE"))
+	assert.Equal("0x0000000000000000000000000000000000000000000000000000000000000000", topic("bool", "false"))
+	assert.Equal("0xabcd000000000000000000000000000000000000000000000000000000000000", topic("bytes4", "0xabcd"))
+	assert.Equal(hash, topic("string", hash))
+	assert.Equal(hash, topic("bytes", hash))
+
+	badValue("uint8", "256")
+	badValue("uint256", "-1")
+	badValue("int8", float64(-129))
+	badValue("uint256", float64(1.5))
+	badValue("uint256", "ten")
+	badValue("uint256", true)
+	badValue("bool", "yes")
+	badValue("bool", float64(1))
+	badValue("address", float64(1))
+	badValue("bytes4", "0xabcdef0102")
+	badValue("bytes4", "abcd")
+	badValue("bytes4", float64(1))
+	badValue("string", "hello")
+	badValue("string", "0xabcd")
+	badValue("string", float64(1))
+}
+
+func TestCreateSubscriptionIndexedFilter(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &ethmocks.RPCClient{}
+	m := &mockSubMgr{stream: newTestStream()}
+	i := testSubInfo(&ethbinding.ABIElementMarshaling{
+		Type:   "event",
+		Name:   "Transfer",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address", Indexed: true}},
+	})
+	i.IndexedFilter = map[string]interface{}{"from": "0x0123456789abcDEF0123456789abCDef01234567"}
+	s, err := newSubscription(m, rpc, nil, nil, i)
+	assert.NoError(err)
+	assert.Equal(2, len(s.info.Filter.Topics))
+	assert.Equal("0x0000000000000000000000000123456789abcdef0123456789abcdef01234567", s.info.Filter.Topics[1][0].Hex())
+
+	i.IndexedFilter = map[string]interface{}{"to": "0x0123456789abcDEF0123456789abCDef01234567"}
+	_, err = newSubscription(m, rpc, nil, nil, i)
+	assert.Regexp("Filter argument 'to' is not an indexed argument of event 'Transfer'", err)
+}
+
+func TestCreateSubscriptionAllEventsIndexedFilter(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := &SubscriptionInfo{ID: "test", Stream: "streamID", Events: ethbinding.ABIMarshaling{
+		{Type: "event", Name: "Transfer", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "from", Type: "address", Indexed: true}}},
+	}, IndexedFilter: map[string]interface{}{"from": "0x0123456789abcDEF0123456789abCDef01234567"}}
+	_, err := newSubscription(m, nil, nil, nil, i)
+	assert.Regexp("A filter on indexed arguments can only be used when subscribing to a single event", err)
+}
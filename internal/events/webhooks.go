@@ -16,24 +16,88 @@ package events
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// WebhookProbeDNS resolves the webhook host, and checks it is an allowed target
+	WebhookProbeDNS = "dns"
+	// WebhookProbeHEAD sends a HEAD request, and accepts any response that is not a server error
+	WebhookProbeHEAD = "head"
+	// WebhookProbeOPTIONS sends an OPTIONS request, and accepts any response that is not a server error
+	WebhookProbeOPTIONS = "options"
+	// WebhookProbePOST sends an empty batch of events, which must be accepted with a 2xx response
+	WebhookProbePOST = "post"
+
+	webhookProbeTimeout = 10 * time.Second
+
+	// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the request body, when
+	// the webhook is configured with an hmacSecret, so the receiver can verify the payload
+	WebhookSignatureHeader = "X-Ethconnect-Signature"
+
+	// defaultWebhookGzipMinSize is the smallest batch that is compressed, when gzip is enabled on the webhook
+	defaultWebhookGzipMinSize = 1024
+)
+
+// webhookSecretRef matches a header value, password or HMAC secret that refers to an
+// environment variable as ${env:NAME}, or to the contents of a file as ${file:/path}.
+// Only files in the configured secrets directory, and environment variables with the
+// configured prefix, can be referred to
+var webhookSecretRef = regexp.MustCompile(`^\$\{(env|file):(.+)\}$`)
+
 type webhookAction struct {
 	es   *eventStream
 	spec *webhookActionInfo
 }
 
+// webhookBatchMetadata describes the delivery of a batch, so receivers can detect
+// redelivery of a batch, and support can correlate the logs of the receiver with
+// those of the gateway
+type webhookBatchMetadata struct {
+	StreamID         string `json:"streamId"`
+	BatchID          string `json:"batchId"`
+	BatchNumber      uint64 `json:"batchNumber"`
+	Attempt          uint64 `json:"attempt"`
+	FirstAttemptTime string `json:"firstAttemptTime"`
+}
+
+// webhookBatchPayload is the body of a webhook request with metadata enabled,
+// in place of the plain array of events
+type webhookBatchPayload struct {
+	Metadata *webhookBatchMetadata `json:"metadata"`
+	Events   []*eventData          `json:"events"`
+}
+
+func validateWebhookProbe(probe string) error {
+	switch strings.ToLower(probe) {
+	case "", WebhookProbeDNS, WebhookProbeHEAD, WebhookProbeOPTIONS, WebhookProbePOST:
+		return nil
+	default:
+		return errors.Errorf(errors.EventStreamsWebhookInvalidProbe, probe)
+	}
+}
+
 func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction, error) {
 	if spec == nil || spec.URL == "" {
 		return nil, errors.Errorf(errors.EventStreamsWebhookNoURL)
@@ -41,6 +105,15 @@ func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction,
 	if _, err := url.Parse(spec.URL); err != nil {
 		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidURL)
 	}
+	if err := validateWebhookProbe(spec.Probe); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookSecrets(es.sm.config(), spec); err != nil {
+		return nil, err
+	}
+	if _, err := webhookTLSConfig(es.sm.config(), spec); err != nil {
+		return nil, err
+	}
 	if spec.RequestTimeoutSec == 0 {
 		spec.RequestTimeoutSec = 120
 	}
@@ -50,21 +123,91 @@ func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction,
 	}, nil
 }
 
-// attemptWebhookAction performs a single attempt of a webhook action
-func (w *webhookAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
-	// We perform DNS resolution before each attempt, to exclude private IP address ranges from the target
-	esID := w.es.spec.ID
-	u, _ := url.Parse(w.spec.URL)
+// isHostAllowed checks a host against the allowed hosts, which are exact host names
+// or wildcards such as *.example.com. All hosts are allowed if the list is empty
+func isHostAllowed(allowedHosts []string, host string) bool {
+	if len(allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveWebhookAddress resolves the host of a webhook URL, and checks it is an allowed target.
+// It is also used for the other URLs the gateway sends requests to on behalf of API callers
+func ResolveWebhookAddress(allowPrivateIPs bool, allowedHosts []string, u *url.URL) (*net.IPAddr, error) {
+	if !isHostAllowed(allowedHosts, u.Hostname()) {
+		return nil, errors.Errorf(errors.EventStreamsWebhookHostNotAllowed, u.Hostname())
+	}
 	addr, err := net.ResolveIPAddr("ip4", u.Hostname())
 	if err != nil {
-		return err
+		return nil, errors.Errorf(errors.EventStreamsWebhookUnresolvable, u.Hostname(), err)
 	}
-	if w.es.isAddressUnsafe(addr) {
-		err := errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, u.Hostname())
-		log.Errorf(err.Error())
-		return err
+	if isAddressUnsafe(allowPrivateIPs, addr) {
+		return nil, errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, u.Hostname())
+	}
+	return addr, nil
+}
+
+// webhookTLSConfig builds the TLS configuration for a webhook. The client certificate and
+// CA bundle of the stream take precedence over those configured for all webhooks. The files
+// are read each time, so certificates can be rotated without recreating the stream
+func webhookTLSConfig(conf *SubscriptionManagerConf, spec *webhookActionInfo) (*tls.Config, error) {
+	tlsConf := utils.TLSConfig{
+		Enabled:            true,
+		ClientCertsFile:    conf.WebhooksTLS.ClientCertsFile,
+		ClientKeyFile:      conf.WebhooksTLS.ClientKeyFile,
+		CACertsFile:        conf.WebhooksTLS.CACertsFile,
+		InsecureSkipVerify: conf.WebhooksTLS.InsecureSkipVerify || spec.TLSkipHostVerify,
+	}
+	if spec.TLS != nil {
+		var err error
+		if spec.TLS.ClientCertsFile != "" || spec.TLS.ClientKeyFile != "" {
+			if tlsConf.ClientCertsFile, err = webhookTLSFile(conf, spec.TLS.ClientCertsFile); err != nil {
+				return nil, err
+			}
+			if tlsConf.ClientKeyFile, err = webhookTLSFile(conf, spec.TLS.ClientKeyFile); err != nil {
+				return nil, err
+			}
+		}
+		if spec.TLS.CACertsFile != "" {
+			if tlsConf.CACertsFile, err = webhookTLSFile(conf, spec.TLS.CACertsFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+	t, err := utils.CreateTLSConfiguration(&tlsConf)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWebhookTLSInvalid, err)
+	}
+	return t, nil
+}
+
+// webhookTLSFile returns the path of a TLS file set on a stream, which must be in the
+// directory configured by the operator. Otherwise API callers could present the
+// certificates of the gateway to a host of their choosing, or probe for files
+func webhookTLSFile(conf *SubscriptionManagerConf, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	filename, ok := pathInDir(conf.WebhooksTLSDir, name)
+	if !ok {
+		return "", errors.Errorf(errors.EventStreamsWebhookTLSNotPermitted, name)
+	}
+	return filename, nil
+}
+
+func newWebhookClient(conf *SubscriptionManagerConf, spec *webhookActionInfo, timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := webhookTLSConfig(conf, spec)
+	if err != nil {
+		return nil, err
 	}
-	// Set the timeout
 	var transport = &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -76,26 +219,346 @@ func (w *webhookAction) attemptBatch(batchNumber, attempt uint64, events []*even
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
 	}
-	transport.TLSClientConfig = &tls.Config{
-		InsecureSkipVerify: w.spec.TLSkipHostVerify,
-	}
-	netClient := &http.Client{
-		Timeout:   time.Duration(w.spec.RequestTimeoutSec) * time.Second,
+	return &http.Client{
+		Timeout:   timeout,
 		Transport: transport,
+	}, nil
+}
+
+// resolveWebhookSecret returns the value of an environment variable or file referred to
+// by a secret, so it does not need to be stored in the event stream. Other values are
+// returned unchanged. Files are trimmed of leading and trailing whitespace.
+// References outside of the secrets directory and environment variable prefix configured
+// by the operator are rejected, so API callers cannot read arbitrary files or variables
+func resolveWebhookSecret(conf *SubscriptionManagerConf, value string) (string, error) {
+	match := webhookSecretRef.FindStringSubmatch(value)
+	if match == nil {
+		return value, nil
+	}
+	if match[1] == "env" {
+		if conf.WebhooksSecretsEnvPrefix == "" || !strings.HasPrefix(match[2], conf.WebhooksSecretsEnvPrefix) {
+			return "", errors.Errorf(errors.EventStreamsWebhookSecretNotPermitted, value)
+		}
+		resolved, ok := os.LookupEnv(match[2])
+		if !ok {
+			return "", errors.Errorf(errors.EventStreamsWebhookSecretUnresolved, value, "environment variable is not set")
+		}
+		return resolved, nil
+	}
+	filename, ok := pathInDir(conf.WebhooksSecretsDir, match[2])
+	if !ok {
+		return "", errors.Errorf(errors.EventStreamsWebhookSecretNotPermitted, value)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", errors.Errorf(errors.EventStreamsWebhookSecretUnresolved, value, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// pathInDir returns the cleaned path of a file within a directory configured by the operator.
+// Relative paths are relative to the directory, and false is returned for any path outside
+// of it, or if no directory is configured
+func pathInDir(dir, name string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	base := filepath.Clean(dir)
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(base, p)
+	}
+	p = filepath.Clean(p)
+	rel, err := filepath.Rel(base, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return p, true
+}
+
+// validateWebhookSecrets checks all the secrets of a webhook can be resolved, so a
+// missing environment variable or file is reported when the stream is created or updated
+func validateWebhookSecrets(conf *SubscriptionManagerConf, spec *webhookActionInfo) error {
+	values := []string{spec.HMACSecret}
+	for _, v := range spec.Headers {
+		values = append(values, v)
+	}
+	if spec.BasicAuth != nil {
+		values = append(values, spec.BasicAuth.Password)
+	}
+	for _, v := range values {
+		if _, err := resolveWebhookSecret(conf, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactedWebhookSecret replaces the literal secrets of a stream in the streams returned by the API
+const redactedWebhookSecret = "***"
+
+// redactStreamSecrets returns a copy of a stream with the literal HMAC secret, header values and basic
+// auth password of its webhook, and the password of its MQTT broker, redacted so they cannot be read
+// back from the API. References to environment variables and files are returned as they are, as they
+// do not contain the secret
+func redactStreamSecrets(spec *StreamInfo) *StreamInfo {
+	if spec == nil || (spec.Webhook == nil && spec.MQTT == nil) {
+		return spec
+	}
+	redacted := *spec
+	if spec.Webhook != nil {
+		webhook := *spec.Webhook
+		webhook.HMACSecret = redactWebhookSecret(webhook.HMACSecret)
+		if webhook.Headers != nil {
+			headers := make(map[string]string, len(webhook.Headers))
+			for h, v := range webhook.Headers {
+				headers[h] = redactWebhookSecret(v)
+			}
+			webhook.Headers = headers
+		}
+		if webhook.BasicAuth != nil {
+			basicAuth := *webhook.BasicAuth
+			basicAuth.Password = redactWebhookSecret(basicAuth.Password)
+			webhook.BasicAuth = &basicAuth
+		}
+		redacted.Webhook = &webhook
+	}
+	if spec.MQTT != nil {
+		redacted.MQTT = redactMQTTPassword(spec.MQTT)
+	}
+	return &redacted
+}
+
+func redactWebhookSecret(value string) string {
+	if value == "" || webhookSecretRef.MatchString(value) {
+		return value
+	}
+	return redactedWebhookSecret
+}
+
+// redactedSecretField returns the name of the first secret of a stream that holds the redacted
+// placeholder, or an empty string if there is none. A stream exported from the API cannot be
+// imported until its secrets, or references to them, have been put back
+func redactedSecretField(spec *StreamInfo) string {
+	if spec == nil {
+		return ""
+	}
+	if spec.MQTT != nil && spec.MQTT.Password == redactedWebhookSecret {
+		return "mqtt.password"
+	}
+	if spec.Webhook == nil {
+		return ""
+	}
+	if spec.Webhook.HMACSecret == redactedWebhookSecret {
+		return "webhook.hmacSecret"
+	}
+	headers := make([]string, 0, len(spec.Webhook.Headers))
+	for h := range spec.Webhook.Headers {
+		headers = append(headers, h)
+	}
+	sort.Strings(headers)
+	for _, h := range headers {
+		if spec.Webhook.Headers[h] == redactedWebhookSecret {
+			return "webhook.headers." + h
+		}
+	}
+	if spec.Webhook.BasicAuth != nil && spec.Webhook.BasicAuth.Password == redactedWebhookSecret {
+		return "webhook.basicAuth.password"
+	}
+	return ""
+}
+
+// restoreWebhookSecrets keeps the stored HMAC secret, header values and basic auth password of a webhook
+// when an update echoes back the redacted placeholder, so a stream read from the API can be updated
+func restoreWebhookSecrets(existing, spec *webhookActionInfo) {
+	if existing == nil || spec == nil {
+		return
+	}
+	if spec.HMACSecret == redactedWebhookSecret {
+		spec.HMACSecret = existing.HMACSecret
+	}
+	for h, v := range spec.Headers {
+		if existingValue, ok := existing.Headers[h]; ok && v == redactedWebhookSecret {
+			spec.Headers[h] = existingValue
+		}
+	}
+	if spec.BasicAuth != nil && spec.BasicAuth.Password == redactedWebhookSecret && existing.BasicAuth != nil {
+		spec.BasicAuth.Password = existing.BasicAuth.Password
+	}
+}
+
+// gzipWebhookPayload compresses a request body if gzip is enabled and it is at least the minimum size
+func gzipWebhookPayload(spec *webhookActionInfo, body []byte) ([]byte, bool, error) {
+	minSize := int(spec.GzipMinSize)
+	if minSize == 0 {
+		minSize = defaultWebhookGzipMinSize
+	}
+	if !spec.Gzip || len(body) < minSize {
+		return body, false, nil
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, false, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// newWebhookRequest builds a request to a webhook, with the configured headers and basic auth
+// credentials, and a signature of the body if the webhook has an HMAC secret
+func newWebhookRequest(conf *SubscriptionManagerConf, spec *webhookActionInfo, method, url string, body []byte) (*http.Request, error) {
+	payload, compressed, err := gzipWebhookPayload(spec, body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for h, v := range spec.Headers {
+		if v, err = resolveWebhookSecret(conf, v); err != nil {
+			return nil, err
+		}
+		req.Header.Set(h, v)
+	}
+	if spec.BasicAuth != nil {
+		password, err := resolveWebhookSecret(conf, spec.BasicAuth.Password)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(spec.BasicAuth.Username, password)
+	}
+	if spec.HMACSecret != "" && body != nil {
+		secret, err := resolveWebhookSecret(conf, spec.HMACSecret)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(WebhookSignatureHeader, signWebhookPayload(secret, body))
+	}
+	return req, nil
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of a webhook request body
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// probeWebhook checks a webhook can be reached when a stream is created or updated, so that
+// problems are reported to the caller rather than only at the first delivery of events
+func probeWebhook(conf *SubscriptionManagerConf, spec *webhookActionInfo) error {
+	probe := strings.ToLower(spec.Probe)
+	if probe == "" {
+		return nil
+	}
+	if err := validateWebhookProbe(probe); err != nil {
+		return err
+	}
+	u, err := url.Parse(spec.URL)
+	if err != nil {
+		return errors.Errorf(errors.EventStreamsWebhookInvalidURL)
+	}
+	if _, err := ResolveWebhookAddress(conf.WebhooksAllowPrivateIPs, conf.WebhooksAllowedHosts, u); err != nil || probe == WebhookProbeDNS {
+		return err
+	}
+
+	method := strings.ToUpper(probe)
+	var body []byte
+	if probe == WebhookProbePOST {
+		body = []byte("[]")
+	}
+	req, err := newWebhookRequest(conf, spec, method, u.String(), body)
+	if err != nil {
+		return errors.Errorf(errors.EventStreamsWebhookProbeFailed, method, u.String(), err)
+	}
+	timeout := webhookProbeTimeout
+	if spec.RequestTimeoutSec > 0 && time.Duration(spec.RequestTimeoutSec)*time.Second < timeout {
+		timeout = time.Duration(spec.RequestTimeoutSec) * time.Second
+	}
+	client, err := newWebhookClient(conf, spec, timeout)
+	if err != nil {
+		return err
+	}
+	log.Infof("Webhook probe %s --> %s", method, u.String())
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Errorf(errors.EventStreamsWebhookProbeFailed, method, u.String(), err)
+	}
+	defer res.Body.Close()
+	log.Infof("Webhook probe %s <-- %s [%d]", method, u.String(), res.StatusCode)
+	// A HEAD or OPTIONS request only shows the server can be reached, as it might not handle those methods
+	if res.StatusCode >= 500 || (probe == WebhookProbePOST && (res.StatusCode < 200 || res.StatusCode >= 300)) {
+		return errors.Errorf(errors.EventStreamsWebhookProbeFailed, method, u.String(), fmt.Sprintf("status=%d", res.StatusCode))
+	}
+	return nil
+}
+
+// batchMetadata returns the metadata for an attempt to deliver a batch. The ID and
+// time of the first attempt are those of the batch being delivered by the stream
+func (w *webhookAction) batchMetadata(batchNumber, attempt uint64) *webhookBatchMetadata {
+	metadata := &webhookBatchMetadata{
+		StreamID:         w.es.spec.ID,
+		BatchNumber:      batchNumber,
+		Attempt:          attempt,
+		FirstAttemptTime: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if d := w.es.delivery; d != nil && d.number == batchNumber {
+		metadata.BatchID = d.id
+		metadata.FirstAttemptTime = d.firstAttempt.UTC().Format(time.RFC3339Nano)
+	} else {
+		metadata.BatchID = utils.UUIDv4()
+	}
+	return metadata
+}
+
+// webhookPayload returns the body of the request for a batch, which is the array of
+// events, or the events with the metadata of the batch if enabled on the webhook
+func (w *webhookAction) webhookPayload(batchNumber, attempt uint64, events []*eventData) ([]byte, error) {
+	if !w.spec.Metadata {
+		return json.Marshal(&events)
+	}
+	return json.Marshal(&webhookBatchPayload{
+		Metadata: w.batchMetadata(batchNumber, attempt),
+		Events:   events,
+	})
+}
+
+// attemptWebhookAction performs a single attempt of a webhook action
+func (w *webhookAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
+	// We perform DNS resolution before each attempt, to exclude private IP address ranges from the target
+	esID := w.es.spec.ID
+	u, _ := url.Parse(w.spec.URL)
+	addr, err := ResolveWebhookAddress(w.es.allowPrivateIPs, w.es.allowedHosts, u)
+	if err != nil {
+		log.Errorf(err.Error())
+		return err
+	}
+	// Set the timeout, and load the current client certificates
+	netClient, err := newWebhookClient(w.es.sm.config(), w.spec, time.Duration(w.spec.RequestTimeoutSec)*time.Second)
+	if err != nil {
+		log.Errorf(err.Error())
+		return err
 	}
 	log.Infof("%s: POST --> %s [%s] (attempt=%d)", esID, u.String(), addr.String(), attempt)
-	reqBytes, err := json.Marshal(&events)
+	reqBytes, err := w.webhookPayload(batchNumber, attempt, events)
 	var req *http.Request
 	if err == nil {
-		req, err = http.NewRequest("POST", u.String(), bytes.NewReader(reqBytes))
+		req, err = newWebhookRequest(w.es.sm.config(), w.spec, "POST", u.String(), reqBytes)
 	}
 	if err == nil {
 		var res *http.Response
-		req.Header.Set("Content-Type", "application/json")
-		for h, v := range w.spec.Headers {
-			req.Header.Set(h, v)
-		}
 		res, err = netClient.Do(req)
 		if err == nil {
 			ok := (res.StatusCode >= 200 && res.StatusCode < 300)
@@ -106,6 +569,11 @@ func (w *webhookAction) attemptBatch(batchNumber, attempt uint64, events []*even
 			}
 			if !ok {
 				err = errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, esID, res.StatusCode)
+				if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+					if retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); retryAfter > 0 {
+						err = &retryAfterError{error: err, retryAfter: retryAfter}
+					}
+				}
 			}
 		}
 	}
@@ -0,0 +1,680 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/hyperledger/firefly-ethconnect/mocks/ethmocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestProbeServer(status int) (*httptest.Server, *http.Request, *string) {
+	var received http.Request
+	var body string
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received = *req
+		b, _ := ioutil.ReadAll(req.Body)
+		body = string(b)
+		res.WriteHeader(status)
+	}))
+	return svr, &received, &body
+}
+
+func TestProbeWebhookMethods(t *testing.T) {
+	assert := assert.New(t)
+	conf := &SubscriptionManagerConf{WebhooksAllowPrivateIPs: true}
+
+	svr, received, body := newTestProbeServer(405)
+	defer svr.Close()
+	err := probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "HEAD"})
+	assert.NoError(err)
+	assert.Equal("HEAD", received.Method)
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "options"})
+	assert.NoError(err)
+	assert.Equal("OPTIONS", received.Method)
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "post"})
+	assert.Regexp("Webhook probe POST .* failed: status=405", err)
+
+	svr2, received, body := newTestProbeServer(204)
+	defer svr2.Close()
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr2.URL, Probe: "post", Headers: map[string]string{"Authorization": "Bearer token"}})
+	assert.NoError(err)
+	assert.Equal("POST", received.Method)
+	assert.Equal("Bearer token", received.Header.Get("Authorization"))
+	assert.Equal("application/json", received.Header.Get("Content-Type"))
+	assert.Equal("[]", *body)
+
+	svr3, _, _ := newTestProbeServer(503)
+	defer svr3.Close()
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr3.URL, Probe: "head"})
+	assert.Regexp("Webhook probe HEAD .* failed: status=503", err)
+}
+
+func TestProbeWebhookValidation(t *testing.T) {
+	assert := assert.New(t)
+	conf := &SubscriptionManagerConf{}
+
+	err := probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0"})
+	assert.NoError(err)
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0", Probe: "ping"})
+	assert.Regexp("Invalid webhook probe 'ping'", err)
+	err = probeWebhook(conf, &webhookActionInfo{URL: ":bad", Probe: "dns"})
+	assert.Regexp("Invalid URL in webhook action", err)
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0", Probe: "dns"})
+	assert.Regexp("Cannot send Webhook POST to address: localhost", err)
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://test.invalid", Probe: "dns"})
+	assert.Regexp("Cannot resolve webhook host 'test.invalid'", err)
+
+	conf.WebhooksAllowPrivateIPs = true
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0", Probe: "dns"})
+	assert.NoError(err)
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0", Probe: "head"})
+	assert.Regexp("Webhook probe HEAD http://localhost:0 failed", err)
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0", Probe: "post", Headers: map[string]string{"bad\nheader": "value"}})
+	assert.Regexp("Webhook probe POST http://localhost:0 failed", err)
+
+	conf.WebhooksAllowedHosts = []string{"*.example.com", "webhooks.local"}
+	err = probeWebhook(conf, &webhookActionInfo{URL: "http://localhost:0", Probe: "dns"})
+	assert.Regexp("Webhook host 'localhost' is not in the list of allowed hosts", err)
+}
+
+func TestIsHostAllowed(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isHostAllowed(nil, "anything"))
+	assert.True(isHostAllowed([]string{"*.example.com"}, "api.Example.com"))
+	assert.True(isHostAllowed([]string{"*.example.com"}, "a.b.example.com"))
+	assert.False(isHostAllowed([]string{"*.example.com"}, "example.com"))
+	assert.False(isHostAllowed([]string{"*.example.com"}, "badexample.com"))
+	assert.True(isHostAllowed([]string{"api.example.com"}, "API.example.com"))
+}
+
+func TestWebhookHostNotAllowedAtDelivery(t *testing.T) {
+	assert := assert.New(t)
+	stream := &eventStream{
+		sm:              &mockSubMgr{},
+		spec:            &StreamInfo{ID: "stream1"},
+		allowPrivateIPs: true,
+		allowedHosts:    []string{"webhooks.local"},
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{URL: "http://localhost:0"}}
+	err := w.attemptBatch(1, 1, []*eventData{})
+	assert.Regexp("Webhook host 'localhost' is not in the list of allowed hosts", err)
+
+	stream.spec.AlertURL = "http://localhost:0"
+	err = stream.sendAlert(&streamAlert{})
+	assert.Regexp("Webhook host 'localhost' is not in the list of allowed hosts", err)
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	assert := assert.New(t)
+	mac := hmac.New(sha256.New, []byte("secret1"))
+	mac.Write([]byte(`[{"a":"b"}]`))
+	assert.Equal(hex.EncodeToString(mac.Sum(nil)), signWebhookPayload("secret1", []byte(`[{"a":"b"}]`)))
+	assert.NotEqual(signWebhookPayload("secret1", []byte("[]")), signWebhookPayload("secret2", []byte("[]")))
+}
+
+func TestWebhookHMACSignature(t *testing.T) {
+	assert := assert.New(t)
+	svr, received, body := newTestProbeServer(200)
+	defer svr.Close()
+	stream := &eventStream{
+		sm:              &mockSubMgr{},
+		spec:            &StreamInfo{ID: "stream1"},
+		allowPrivateIPs: true,
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{URL: svr.URL, HMACSecret: "secret1", RequestTimeoutSec: 10}}
+	err := w.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+	assert.Equal(signWebhookPayload("secret1", []byte(*body)), received.Header.Get(WebhookSignatureHeader))
+
+	w.spec.HMACSecret = ""
+	err = w.attemptBatch(2, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+	assert.Equal("", received.Header.Get(WebhookSignatureHeader))
+
+	conf := &SubscriptionManagerConf{WebhooksAllowPrivateIPs: true}
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "post", HMACSecret: "secret1"})
+	assert.NoError(err)
+	assert.Equal(signWebhookPayload("secret1", []byte("[]")), received.Header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookGzip(t *testing.T) {
+	assert := assert.New(t)
+	svr, received, body := newTestProbeServer(200)
+	defer svr.Close()
+	stream := &eventStream{
+		sm:              &mockSubMgr{},
+		spec:            &StreamInfo{ID: "stream1"},
+		allowPrivateIPs: true,
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{URL: svr.URL, HMACSecret: "secret1", Gzip: true, GzipMinSize: 250, RequestTimeoutSec: 10}}
+	events := []*eventData{{Address: strings.Repeat("1", 200)}}
+	err := w.attemptBatch(1, 1, events)
+	assert.NoError(err)
+	assert.Equal("gzip", received.Header.Get("Content-Encoding"))
+	gz, err := gzip.NewReader(strings.NewReader(*body))
+	assert.NoError(err)
+	b, err := ioutil.ReadAll(gz)
+	assert.NoError(err)
+	expected, _ := json.Marshal(&events)
+	assert.Equal(expected, b)
+	assert.Equal(signWebhookPayload("secret1", expected), received.Header.Get(WebhookSignatureHeader))
+
+	err = w.attemptBatch(2, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+	assert.Equal("", received.Header.Get("Content-Encoding"))
+	assert.Regexp("0x1111", *body)
+
+	w.spec.Gzip = false
+	err = w.attemptBatch(3, 1, events)
+	assert.NoError(err)
+	assert.Equal("", received.Header.Get("Content-Encoding"))
+}
+
+func TestWebhookBatchMetadata(t *testing.T) {
+	assert := assert.New(t)
+	svr, _, body := newTestProbeServer(200)
+	defer svr.Close()
+	stream := &eventStream{
+		sm:              &mockSubMgr{},
+		spec:            &StreamInfo{ID: "stream1", RetryTimeoutSec: 1},
+		allowPrivateIPs: true,
+		batchCond:       sync.NewCond(&sync.Mutex{}),
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{URL: svr.URL, Metadata: true, RequestTimeoutSec: 10}}
+	stream.action = w
+	events := []*eventData{{Address: "0x1111"}}
+
+	delivery := &batchDelivery{number: 5, id: "batch1"}
+	stream.delivery = delivery
+	err := stream.performActionWithRetry(delivery, events)
+	assert.NoError(err)
+	var payload webhookBatchPayload
+	err = json.Unmarshal([]byte(*body), &payload)
+	assert.NoError(err)
+	assert.Equal("stream1", payload.Metadata.StreamID)
+	assert.Equal("batch1", payload.Metadata.BatchID)
+	assert.Equal(uint64(5), payload.Metadata.BatchNumber)
+	assert.Equal(uint64(1), payload.Metadata.Attempt)
+	firstAttempt := payload.Metadata.FirstAttemptTime
+	assert.Equal(delivery.firstAttempt.UTC().Format(time.RFC3339Nano), firstAttempt)
+	assert.Equal("0x1111", payload.Events[0].Address)
+
+	// A blocked retry of the same batch continues the numbering of the attempts
+	err = stream.performActionWithRetry(delivery, events)
+	assert.NoError(err)
+	err = json.Unmarshal([]byte(*body), &payload)
+	assert.NoError(err)
+	assert.Equal("batch1", payload.Metadata.BatchID)
+	assert.Equal(uint64(2), payload.Metadata.Attempt)
+	assert.Equal(firstAttempt, payload.Metadata.FirstAttemptTime)
+
+	// Without a batch being delivered by the stream, a new ID is allocated
+	stream.delivery = nil
+	err = w.attemptBatch(6, 1, events)
+	assert.NoError(err)
+	err = json.Unmarshal([]byte(*body), &payload)
+	assert.NoError(err)
+	assert.NotEqual("batch1", payload.Metadata.BatchID)
+	assert.Equal(uint64(6), payload.Metadata.BatchNumber)
+
+	w.spec.Metadata = false
+	err = w.attemptBatch(7, 1, events)
+	assert.NoError(err)
+	expected, _ := json.Marshal(&events)
+	assert.Equal(string(expected), *body)
+}
+
+func TestGzipWebhookPayloadDefaultMinSize(t *testing.T) {
+	assert := assert.New(t)
+	spec := &webhookActionInfo{Gzip: true}
+	b, compressed, err := gzipWebhookPayload(spec, []byte(strings.Repeat("a", defaultWebhookGzipMinSize-1)))
+	assert.NoError(err)
+	assert.False(compressed)
+	assert.Equal(defaultWebhookGzipMinSize-1, len(b))
+	b, compressed, err = gzipWebhookPayload(spec, []byte(strings.Repeat("a", defaultWebhookGzipMinSize)))
+	assert.NoError(err)
+	assert.True(compressed)
+	assert.Less(len(b), defaultWebhookGzipMinSize)
+}
+
+func TestResolveWebhookSecret(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv("ETHCONNECT_TEST_SECRET", "secret1")
+	defer os.Unsetenv("ETHCONNECT_TEST_SECRET")
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	secretFile := path.Join(dir, "secret")
+	ioutil.WriteFile(secretFile, []byte("secret2\n"), 0600)
+	conf := &SubscriptionManagerConf{WebhooksSecretsDir: dir, WebhooksSecretsEnvPrefix: "ETHCONNECT_TEST_"}
+
+	v, err := resolveWebhookSecret(conf, "plain")
+	assert.NoError(err)
+	assert.Equal("plain", v)
+	v, err = resolveWebhookSecret(conf, "${env:ETHCONNECT_TEST_SECRET}")
+	assert.NoError(err)
+	assert.Equal("secret1", v)
+	v, err = resolveWebhookSecret(conf, "${file:"+secretFile+"}")
+	assert.NoError(err)
+	assert.Equal("secret2", v)
+	v, err = resolveWebhookSecret(conf, "${file:secret}")
+	assert.NoError(err)
+	assert.Equal("secret2", v)
+	v, err = resolveWebhookSecret(conf, "Bearer ${env:ETHCONNECT_TEST_SECRET}")
+	assert.NoError(err)
+	assert.Equal("Bearer ${env:ETHCONNECT_TEST_SECRET}", v)
+
+	_, err = resolveWebhookSecret(conf, "${env:ETHCONNECT_TEST_MISSING}")
+	assert.Regexp("Cannot resolve webhook secret '\\$\\{env:ETHCONNECT_TEST_MISSING\\}': environment variable is not set", err)
+	_, err = resolveWebhookSecret(conf, "${file:"+path.Join(dir, "missing")+"}")
+	assert.Regexp("Cannot resolve webhook secret", err)
+}
+
+func TestResolveWebhookSecretNotPermitted(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv("ETHCONNECT_TEST_SECRET", "secret1")
+	defer os.Unsetenv("ETHCONNECT_TEST_SECRET")
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	_, err := resolveWebhookSecret(&SubscriptionManagerConf{}, "${env:ETHCONNECT_TEST_SECRET}")
+	assert.Regexp("FFEC100398", err)
+	_, err = resolveWebhookSecret(&SubscriptionManagerConf{}, "${file:/etc/hostname}")
+	assert.Regexp("FFEC100398", err)
+
+	conf := &SubscriptionManagerConf{WebhooksSecretsDir: dir, WebhooksSecretsEnvPrefix: "WEBHOOK_"}
+	_, err = resolveWebhookSecret(conf, "${env:ETHCONNECT_TEST_SECRET}")
+	assert.Regexp("Webhook secret '\\$\\{env:ETHCONNECT_TEST_SECRET\\}' is not permitted", err)
+	_, err = resolveWebhookSecret(conf, "${file:/etc/hostname}")
+	assert.Regexp("FFEC100398", err)
+	_, err = resolveWebhookSecret(conf, "${file:../../etc/hostname}")
+	assert.Regexp("FFEC100398", err)
+	_, err = resolveWebhookSecret(conf, "${file:"+dir+"/../secret}")
+	assert.Regexp("FFEC100398", err)
+}
+
+func TestWebhookAuthAndSecrets(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv("ETHCONNECT_TEST_SECRET", "secret1")
+	defer os.Unsetenv("ETHCONNECT_TEST_SECRET")
+	svr, received, body := newTestProbeServer(200)
+	defer svr.Close()
+	stream := &eventStream{
+		sm:              &mockSubMgr{conf: &SubscriptionManagerConf{WebhooksSecretsEnvPrefix: "ETHCONNECT_TEST_"}},
+		spec:            &StreamInfo{ID: "stream1"},
+		allowPrivateIPs: true,
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{
+		URL:               svr.URL,
+		Headers:           map[string]string{"x-api-key": "${env:ETHCONNECT_TEST_SECRET}", "x-static": "value1"},
+		BasicAuth:         &webhookBasicAuth{Username: "user1", Password: "${env:ETHCONNECT_TEST_SECRET}"},
+		HMACSecret:        "${env:ETHCONNECT_TEST_SECRET}",
+		RequestTimeoutSec: 10,
+	}}
+	err := w.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+	username, password, ok := received.BasicAuth()
+	assert.True(ok)
+	assert.Equal("user1", username)
+	assert.Equal("secret1", password)
+	assert.Equal("secret1", received.Header.Get("x-api-key"))
+	assert.Equal("value1", received.Header.Get("x-static"))
+	assert.Equal(signWebhookPayload("secret1", []byte(*body)), received.Header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookSecretUnresolvedAtDelivery(t *testing.T) {
+	assert := assert.New(t)
+	svr, _, _ := newTestProbeServer(200)
+	defer svr.Close()
+	stream := &eventStream{
+		sm:              &mockSubMgr{conf: &SubscriptionManagerConf{WebhooksSecretsEnvPrefix: "ETHCONNECT_TEST_"}},
+		spec:            &StreamInfo{ID: "stream1"},
+		allowPrivateIPs: true,
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{
+		URL:               svr.URL,
+		HMACSecret:        "${env:ETHCONNECT_TEST_MISSING}",
+		RequestTimeoutSec: 10,
+	}}
+	err := w.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Cannot resolve webhook secret", err)
+
+	w.spec.HMACSecret = ""
+	w.spec.Headers = map[string]string{"Authorization": "${env:ETHCONNECT_TEST_MISSING}"}
+	err = w.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Cannot resolve webhook secret", err)
+
+	w.spec.Headers = nil
+	w.spec.BasicAuth = &webhookBasicAuth{Username: "user1", Password: "${env:ETHCONNECT_TEST_MISSING}"}
+	err = w.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Cannot resolve webhook secret", err)
+}
+
+func TestAddStreamWebhookProbe(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.db.Close()
+	svr, _, _ := newTestProbeServer(500)
+	defer svr.Close()
+
+	ctx := context.Background()
+	_, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "Webhook",
+		Webhook: &webhookActionInfo{URL: svr.URL, Probe: "post"},
+	})
+	assert.Regexp("Webhook probe POST .* failed: status=500", err)
+	assert.Empty(sm.streams)
+
+	u, _ := url.Parse(svr.URL)
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: svr.URL, Probe: "dns"},
+	})
+	assert.NoError(err)
+	defer sm.DeleteStream(ctx, stream.ID)
+
+	_, err = sm.UpdateStream(ctx, stream.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: "http://" + u.Host + "/other", Probe: "options"},
+	})
+	assert.Regexp("Webhook probe OPTIONS .* failed: status=500", err)
+	assert.Equal(svr.URL, sm.streams[stream.ID].spec.Webhook.URL)
+
+	_, err = sm.UpdateStream(ctx, stream.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL, Probe: "ping"},
+	})
+	assert.Regexp("Invalid webhook probe 'ping'", err)
+}
+
+func newTestClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ethconnect"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certFile = path.Join(dir, "client.crt")
+	keyFile = path.Join(dir, "client.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, cert
+}
+
+func newTestMutualTLSServer(t *testing.T, dir string, clientCert *x509.Certificate) (*httptest.Server, string) {
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	svr.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	svr.StartTLS()
+	caFile := path.Join(dir, "ca.crt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw}), 0600)
+	return svr, caFile
+}
+
+func TestWebhookMutualTLS(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "webhooktls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert := newTestClientCert(t, dir)
+	svr, caFile := newTestMutualTLSServer(t, dir, cert)
+	defer svr.Close()
+
+	stream := &eventStream{
+		sm:              &mockSubMgr{conf: &SubscriptionManagerConf{WebhooksTLSDir: dir}},
+		spec:            &StreamInfo{ID: "stream1"},
+		allowPrivateIPs: true,
+	}
+	w := &webhookAction{es: stream, spec: &webhookActionInfo{
+		URL:               svr.URL,
+		RequestTimeoutSec: 10,
+		TLS:               &webhookTLSInfo{CACertsFile: caFile},
+	}}
+	err := w.attemptBatch(1, 1, []*eventData{{Address: "0x1111"}})
+	assert.Error(err)
+
+	w.spec.TLS.ClientCertsFile = certFile
+	w.spec.TLS.ClientKeyFile = keyFile
+	err = w.attemptBatch(2, 1, []*eventData{{Address: "0x1111"}})
+	assert.NoError(err)
+
+	w.spec.TLS.ClientKeyFile = path.Join(dir, "missing.key")
+	err = w.attemptBatch(3, 1, []*eventData{{Address: "0x1111"}})
+	assert.Regexp("Invalid TLS configuration for webhook", err)
+}
+
+func TestWebhookMutualTLSGlobal(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "webhooktls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert := newTestClientCert(t, dir)
+	svr, caFile := newTestMutualTLSServer(t, dir, cert)
+	defer svr.Close()
+
+	conf := &SubscriptionManagerConf{WebhooksAllowPrivateIPs: true}
+	err := probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "post"})
+	assert.Regexp("Webhook probe POST .* failed", err)
+
+	conf.WebhooksTLS = utils.TLSConfig{
+		ClientCertsFile: certFile,
+		ClientKeyFile:   keyFile,
+		CACertsFile:     caFile,
+	}
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "post"})
+	assert.NoError(err)
+
+	conf.WebhooksTLS.ClientKeyFile = ""
+	err = probeWebhook(conf, &webhookActionInfo{URL: svr.URL, Probe: "post"})
+	assert.Regexp("Invalid TLS configuration for webhook", err)
+}
+
+func TestWebhookTLSConfigPrecedence(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "webhooktls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile, _ := newTestClientCert(t, dir)
+
+	conf := &SubscriptionManagerConf{
+		WebhooksTLS: utils.TLSConfig{
+			ClientCertsFile: path.Join(dir, "missing.crt"),
+			ClientKeyFile:   path.Join(dir, "missing.key"),
+		},
+		WebhooksTLSDir: dir,
+	}
+	_, err := webhookTLSConfig(conf, &webhookActionInfo{})
+	assert.Regexp("Invalid TLS configuration for webhook", err)
+
+	tlsConfig, err := webhookTLSConfig(conf, &webhookActionInfo{
+		TLSkipHostVerify: true,
+		TLS:              &webhookTLSInfo{ClientCertsFile: certFile, ClientKeyFile: keyFile},
+	})
+	assert.NoError(err)
+	assert.Equal(1, len(tlsConfig.Certificates))
+	assert.Nil(tlsConfig.RootCAs)
+	assert.True(tlsConfig.InsecureSkipVerify)
+
+	_, err = newWebhookAction(&eventStream{sm: &mockSubMgr{conf: conf}}, &webhookActionInfo{
+		URL: "http://test.invalid",
+		TLS: &webhookTLSInfo{ClientCertsFile: certFile},
+	})
+	assert.Regexp("Invalid TLS configuration for webhook", err)
+}
+
+func TestWebhookTLSFilesRestrictedToDir(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "webhooktls")
+	defer os.RemoveAll(dir)
+	newTestClientCert(t, dir)
+
+	conf := &SubscriptionManagerConf{}
+	spec := &webhookActionInfo{TLS: &webhookTLSInfo{ClientCertsFile: "client.crt", ClientKeyFile: "client.key"}}
+	_, err := webhookTLSConfig(conf, spec)
+	assert.Regexp("FFEC100402.*client.crt", err)
+
+	conf.WebhooksTLSDir = dir
+	tlsConfig, err := webhookTLSConfig(conf, spec)
+	assert.NoError(err)
+	assert.Equal(1, len(tlsConfig.Certificates))
+
+	_, err = webhookTLSConfig(conf, &webhookActionInfo{TLS: &webhookTLSInfo{CACertsFile: "/etc/ssl/certs/ca-certificates.crt"}})
+	assert.Regexp("FFEC100402", err)
+
+	_, err = webhookTLSConfig(conf, &webhookActionInfo{TLS: &webhookTLSInfo{ClientCertsFile: "client.crt", ClientKeyFile: "../client.key"}})
+	assert.Regexp("FFEC100402.*client.key", err)
+}
+
+func TestRedactWebhookSecrets(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(redactStreamSecrets(nil))
+	spec := &StreamInfo{ID: "stream1", Webhook: &webhookActionInfo{
+		URL:        "http://example.com",
+		HMACSecret: "secret1",
+		Headers: map[string]string{
+			"Authorization": "Bearer token1",
+			"X-Api-Key":     "${file:apikey}",
+		},
+		BasicAuth: &webhookBasicAuth{Username: "user1", Password: "${env:WEBHOOK_PASSWORD}"},
+	}}
+	redacted := redactStreamSecrets(spec)
+	assert.Equal("***", redacted.Webhook.HMACSecret)
+	assert.Equal("***", redacted.Webhook.Headers["Authorization"])
+	assert.Equal("${file:apikey}", redacted.Webhook.Headers["X-Api-Key"])
+	assert.Equal("Bearer token1", spec.Webhook.Headers["Authorization"])
+	assert.Equal("user1", redacted.Webhook.BasicAuth.Username)
+	assert.Equal("${env:WEBHOOK_PASSWORD}", redacted.Webhook.BasicAuth.Password)
+	assert.Equal("secret1", spec.Webhook.HMACSecret)
+
+	spec.Webhook.BasicAuth.Password = "password1"
+	redacted = redactStreamSecrets(spec)
+	assert.Equal("***", redacted.Webhook.BasicAuth.Password)
+	assert.Equal("password1", spec.Webhook.BasicAuth.Password)
+}
+
+func TestRedactedWebhookField(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", redactedSecretField(nil))
+	assert.Equal("", redactedSecretField(&StreamInfo{}))
+	spec := &StreamInfo{Webhook: &webhookActionInfo{
+		HMACSecret: "secret1",
+		Headers:    map[string]string{"X-Api-Key": "${file:apikey}"},
+		BasicAuth:  &webhookBasicAuth{Username: "user1", Password: "password1"},
+	}}
+	assert.Equal("", redactedSecretField(spec))
+	assert.Equal("webhook.hmacSecret", redactedSecretField(redactStreamSecrets(spec)))
+	spec.Webhook.HMACSecret = ""
+	spec.Webhook.Headers["Authorization"] = "***"
+	assert.Equal("webhook.headers.Authorization", redactedSecretField(spec))
+	delete(spec.Webhook.Headers, "Authorization")
+	spec.Webhook.BasicAuth.Password = "***"
+	assert.Equal("webhook.basicAuth.password", redactedSecretField(spec))
+}
+
+func TestRestoreWebhookSecrets(t *testing.T) {
+	assert := assert.New(t)
+	existing := &webhookActionInfo{
+		HMACSecret: "secret1",
+		Headers:    map[string]string{"Authorization": "Bearer token1", "X-Removed": "value1"},
+		BasicAuth:  &webhookBasicAuth{Username: "user1", Password: "password1"},
+	}
+	spec := &webhookActionInfo{
+		HMACSecret: "***",
+		Headers:    map[string]string{"Authorization": "***", "X-New": "***", "X-Other": "value2"},
+		BasicAuth:  &webhookBasicAuth{Username: "user2", Password: "***"},
+	}
+	restoreWebhookSecrets(existing, spec)
+	assert.Equal("secret1", spec.HMACSecret)
+	assert.Equal(map[string]string{"Authorization": "Bearer token1", "X-New": "***", "X-Other": "value2"}, spec.Headers)
+	assert.Equal("user2", spec.BasicAuth.Username)
+	assert.Equal("password1", spec.BasicAuth.Password)
+
+	spec = &webhookActionInfo{HMACSecret: "secret2", BasicAuth: &webhookBasicAuth{Password: "password2"}}
+	restoreWebhookSecrets(existing, spec)
+	assert.Equal("secret2", spec.HMACSecret)
+	assert.Equal("password2", spec.BasicAuth.Password)
+	restoreWebhookSecrets(nil, spec)
+}
+
+func TestStreamsRedactWebhookSecrets(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.db.Close()
+	sm.rpc.(*ethmocks.RPCClient).On("CallContext", mock.Anything, mock.Anything, "eth_blockNumber").Return(fmt.Errorf("pop"))
+	svr, _, _ := newTestProbeServer(200)
+	defer svr.Close()
+
+	ctx := context.Background()
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: svr.URL, HMACSecret: "secret1", Headers: map[string]string{"Authorization": "Bearer token1"}},
+	})
+	assert.NoError(err)
+	assert.Equal("***", stream.Webhook.HMACSecret)
+	assert.Equal("***", stream.Webhook.Headers["Authorization"])
+	assert.Equal("secret1", sm.streams[stream.ID].spec.Webhook.HMACSecret)
+
+	stream, err = sm.StreamByID(ctx, stream.ID)
+	assert.NoError(err)
+	assert.Equal("***", stream.Webhook.HMACSecret)
+	assert.Equal("***", sm.Streams(ctx)[0].Webhook.HMACSecret)
+
+	backup, err := sm.ExportEvents(ctx)
+	assert.NoError(err)
+	assert.Equal("***", backup.Streams[0].Webhook.HMACSecret)
+	assert.Equal("***", backup.Streams[0].Webhook.Headers["Authorization"])
+
+	stream, err = sm.UpdateStream(ctx, stream.ID, stream)
+	assert.NoError(err)
+	assert.Equal("***", stream.Webhook.HMACSecret)
+	assert.Equal("secret1", sm.streams[stream.ID].spec.Webhook.HMACSecret)
+	assert.Equal("Bearer token1", sm.streams[stream.ID].spec.Webhook.Headers["Authorization"])
+	sm.Close(true)
+}
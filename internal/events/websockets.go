@@ -16,6 +16,7 @@ package events
 
 import (
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/ws"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -89,3 +90,16 @@ func (w *webSocketAction) attemptBatch(batchNumber, attempt uint64, events []*ev
 	log.Infof("Attempt batch %d complete. ok=%t", batchNumber, err == nil)
 	return err
 }
+
+// webSocketConnections returns the clients currently listening on the topic of a WebSocket
+// stream, so they can be reported in the stream status
+func (a *eventStream) webSocketConnections() []*ws.ConnectionInfo {
+	if a.spec.Type != "websocket" || a.wsChannels == nil {
+		return nil
+	}
+	topic := ""
+	if a.spec.WebSocket != nil {
+		topic = a.spec.WebSocket.Topic
+	}
+	return a.wsChannels.Connections(topic)
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identifiers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/pkg/plugins"
+)
+
+// DIDEthrScheme is the scheme of did:ethr DIDs, which are resolved by default
+const DIDEthrScheme = "did:ethr"
+
+var hexAddress = regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+var resolversMux sync.RWMutex
+var resolvers = map[string]plugins.AddressResolver{
+	DIDEthrScheme: &didEthrResolver{},
+}
+
+// RegisterResolver is the plug point to register the address resolver for an identifier scheme, such as
+// "did:web", replacing any resolver already registered for it
+func RegisterResolver(scheme string, resolver plugins.AddressResolver) {
+	resolversMux.Lock()
+	defer resolversMux.Unlock()
+	resolvers[scheme] = resolver
+}
+
+// resolverFor returns the resolver registered for the longest scheme the identifier starts with
+func resolverFor(identifier string) plugins.AddressResolver {
+	resolversMux.RLock()
+	defer resolversMux.RUnlock()
+	var resolver plugins.AddressResolver
+	longest := 0
+	for scheme, r := range resolvers {
+		if len(scheme) > longest && strings.HasPrefix(identifier, scheme+":") {
+			resolver = r
+			longest = len(scheme)
+		}
+	}
+	return resolver
+}
+
+// Resolve resolves an identifier supplied for an address to a 0x prefixed hex address. The identifier
+// is returned unchanged if it is already an address, or no resolver is registered for its scheme, so
+// it fails validation as an address in the normal way
+func Resolve(ctx context.Context, identifier string) (string, error) {
+	if hexAddress.MatchString(identifier) {
+		return identifier, nil
+	}
+	resolver := resolverFor(identifier)
+	if resolver == nil {
+		return identifier, nil
+	}
+	addr, err := resolver.ResolveAddress(ctx, identifier)
+	if err != nil {
+		return "", err
+	}
+	if !hexAddress.MatchString(addr) {
+		return "", errors.Errorf(errors.IdentifierResolvedInvalidAddress, identifier, addr)
+	}
+	return addr, nil
+}
+
+// didEthrResolver resolves did:ethr DIDs of the form did:ethr[:network]:0x<address>, which
+// contain the address they identify
+type didEthrResolver struct{}
+
+func (d *didEthrResolver) ResolveAddress(ctx context.Context, identifier string) (string, error) {
+	parts := strings.Split(identifier, ":")
+	if len(parts) < 3 || len(parts) > 4 || !hexAddress.MatchString(parts[len(parts)-1]) {
+		return "", errors.Errorf(errors.IdentifierDIDEthrInvalid, identifier)
+	}
+	return parts[len(parts)-1], nil
+}
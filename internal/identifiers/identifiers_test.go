@@ -0,0 +1,84 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identifiers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResolver struct {
+	addr string
+	err  error
+}
+
+func (r *testResolver) ResolveAddress(ctx context.Context, identifier string) (string, error) {
+	return r.addr, r.err
+}
+
+func TestResolveDIDEthr(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, err := Resolve(context.Background(), "did:ethr:0x66C5fE653e7A9EBB628a6D40f0452d1e358BaeE8")
+	assert.NoError(err)
+	assert.Equal("0x66C5fE653e7A9EBB628a6D40f0452d1e358BaeE8", addr)
+	addr, err = Resolve(context.Background(), "did:ethr:0x5:0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	assert.NoError(err)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", addr)
+	_, err = Resolve(context.Background(), "did:ethr:0x02b97c30de767f084ce3080168ee293053ba33b235d7116a3263d29f1450936b71")
+	assert.Regexp("FFEC100378", err)
+	_, err = Resolve(context.Background(), "did:ethr:a:b:0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	assert.Regexp("FFEC100378", err)
+}
+
+func TestResolveUnchanged(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, err := Resolve(context.Background(), "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	assert.NoError(err)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", addr)
+	addr, err = Resolve(context.Background(), "did:unknown:12345")
+	assert.NoError(err)
+	assert.Equal("did:unknown:12345", addr)
+	addr, err = Resolve(context.Background(), "did:ethrx:12345")
+	assert.NoError(err)
+	assert.Equal("did:ethrx:12345", addr)
+}
+
+func TestResolveRegisteredResolver(t *testing.T) {
+	assert := assert.New(t)
+	defer func() {
+		resolversMux.Lock()
+		delete(resolvers, "did:web")
+		delete(resolvers, "did:web:bad.example.com")
+		delete(resolvers, "did:web:broken.example.com")
+		resolversMux.Unlock()
+	}()
+
+	RegisterResolver("did:web", &testResolver{addr: "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"})
+	RegisterResolver("did:web:bad.example.com", &testResolver{addr: "not an address"})
+	RegisterResolver("did:web:broken.example.com", &testResolver{err: fmt.Errorf("pop")})
+
+	addr, err := Resolve(context.Background(), "did:web:example.com:user1")
+	assert.NoError(err)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", addr)
+	_, err = Resolve(context.Background(), "did:web:bad.example.com:user1")
+	assert.Regexp("FFEC100377.*not an address", err)
+	_, err = Resolve(context.Background(), "did:web:broken.example.com:user1")
+	assert.Regexp("pop", err)
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+// KafkaBatchMessage is a message in a batch sent by a KafkaBatchProducer
+type KafkaBatchMessage struct {
+	Key   string
+	Value []byte
+}
+
+// KafkaBatchProducer sends batches of messages to Kafka, and waits for every message
+// in the batch to be acknowledged, so the caller knows when the whole batch is delivered
+type KafkaBatchProducer interface {
+	SendBatch(topic string, msgs []*KafkaBatchMessage) error
+	Close()
+}
+
+type kafkaBatch struct {
+	lock      sync.Mutex
+	total     int
+	remaining int
+	failed    int
+	lastErr   error
+	done      chan struct{}
+}
+
+func (b *kafkaBatch) complete(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err != nil {
+		b.failed++
+		b.lastErr = err
+	}
+	b.remaining--
+	if b.remaining == 0 {
+		close(b.done)
+	}
+}
+
+type kafkaBatchProducer struct {
+	producer KafkaProducer
+	wg       sync.WaitGroup
+}
+
+// NewKafkaBatchProducer connects to Kafka and creates a producer. Only the brokers,
+// client ID, TLS and SASL settings of the common configuration are used
+func NewKafkaBatchProducer(kf KafkaFactory, conf *KafkaCommonConf) (KafkaBatchProducer, error) {
+	k := &kafkaCommon{
+		factory: kf,
+		conf:    conf,
+	}
+	if err := k.connect(); err != nil {
+		return nil, err
+	}
+	if err := k.createProducer(); err != nil {
+		return nil, err
+	}
+	p := &kafkaBatchProducer{
+		producer: k.producer,
+	}
+	p.wg.Add(2)
+	go p.successLoop()
+	go p.errorLoop()
+	return p, nil
+}
+
+func (p *kafkaBatchProducer) successLoop() {
+	defer p.wg.Done()
+	for msg := range p.producer.Successes() {
+		if b, ok := msg.Metadata.(*kafkaBatch); ok {
+			b.complete(nil)
+		}
+	}
+}
+
+func (p *kafkaBatchProducer) errorLoop() {
+	defer p.wg.Done()
+	for pErr := range p.producer.Errors() {
+		log.Errorf("Kafka producer failed for topic %s: %s", pErr.Msg.Topic, pErr.Err)
+		if b, ok := pErr.Msg.Metadata.(*kafkaBatch); ok {
+			b.complete(pErr.Err)
+		}
+	}
+}
+
+// SendBatch sends all the messages, then waits for each of them to be acknowledged or to fail
+func (p *kafkaBatchProducer) SendBatch(topic string, msgs []*KafkaBatchMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	input, err := p.producer.Input(topic)
+	if err != nil {
+		return err
+	}
+	b := &kafkaBatch{
+		total:     len(msgs),
+		remaining: len(msgs),
+		done:      make(chan struct{}),
+	}
+	for _, msg := range msgs {
+		pm := &sarama.ProducerMessage{
+			Topic:    topic,
+			Value:    sarama.ByteEncoder(msg.Value),
+			Metadata: b,
+		}
+		if msg.Key != "" {
+			pm.Key = sarama.StringEncoder(msg.Key)
+		}
+		input <- pm
+	}
+	<-b.done
+	if b.failed > 0 {
+		return errors.Errorf(errors.KafkaBatchDeliveryFailed, b.failed, b.total, topic, b.lastErr)
+	}
+	return nil
+}
+
+func (p *kafkaBatchProducer) Close() {
+	p.producer.AsyncClose()
+	p.wg.Wait()
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaBatchProducerSendBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewMockKafkaFactory()
+	p, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.NoError(err)
+	defer p.Close()
+
+	go func() {
+		for msg := range f.Producer.MockInput {
+			f.Producer.MockSuccesses <- msg
+		}
+	}()
+
+	err = p.SendBatch("topic1", []*KafkaBatchMessage{
+		{Key: "key1", Value: []byte("msg1")},
+		{Value: []byte("msg2")},
+	})
+	assert.NoError(err)
+}
+
+func TestKafkaBatchProducerSendBatchKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewMockKafkaFactory()
+	p, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.NoError(err)
+	defer p.Close()
+
+	sent := make(chan *sarama.ProducerMessage, 2)
+	go func() {
+		for msg := range f.Producer.MockInput {
+			sent <- msg
+			f.Producer.MockSuccesses <- msg
+		}
+	}()
+
+	err = p.SendBatch("topic1", []*KafkaBatchMessage{
+		{Key: "key1", Value: []byte("msg1")},
+		{Value: []byte("msg2")},
+	})
+	assert.NoError(err)
+	msg1 := <-sent
+	assert.Equal("topic1", msg1.Topic)
+	assert.Equal(sarama.StringEncoder("key1"), msg1.Key)
+	assert.Equal(sarama.ByteEncoder("msg1"), msg1.Value)
+	msg2 := <-sent
+	assert.Nil(msg2.Key)
+}
+
+func TestKafkaBatchProducerSendBatchPartialFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewMockKafkaFactory()
+	p, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.NoError(err)
+	defer p.Close()
+
+	go func() {
+		i := 0
+		for msg := range f.Producer.MockInput {
+			if i%2 == 0 {
+				f.Producer.MockSuccesses <- msg
+			} else {
+				f.Producer.MockErrors <- &sarama.ProducerError{Msg: msg, Err: fmt.Errorf("pop")}
+			}
+			i++
+		}
+	}()
+
+	err = p.SendBatch("topic1", []*KafkaBatchMessage{
+		{Value: []byte("msg1")},
+		{Value: []byte("msg2")},
+		{Value: []byte("msg3")},
+	})
+	assert.Regexp("Failed to deliver 1 of 3 messages to Kafka topic 'topic1': pop", err)
+}
+
+func TestKafkaBatchProducerSendBatchInputFail(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewMockKafkaFactory()
+	p, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.NoError(err)
+	defer p.Close()
+
+	f.Producer.FirstSendError = fmt.Errorf("pop")
+	err = p.SendBatch("topic1", []*KafkaBatchMessage{{Value: []byte("msg1")}})
+	assert.Regexp("pop", err)
+}
+
+func TestKafkaBatchProducerSendBatchEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewMockKafkaFactory()
+	p, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.NoError(err)
+	defer p.Close()
+
+	err = p.SendBatch("topic1", []*KafkaBatchMessage{})
+	assert.NoError(err)
+}
+
+func TestNewKafkaBatchProducerNoBrokers(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewKafkaBatchProducer(NewMockKafkaFactory(), &KafkaCommonConf{})
+	assert.Regexp("No Kafka brokers configured", err)
+}
+
+func TestNewKafkaBatchProducerClientFail(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewErrorMockKafkaFactory(fmt.Errorf("pop"), nil, nil)
+	_, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.Regexp("pop", err)
+}
+
+func TestNewKafkaBatchProducerProducerFail(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewErrorMockKafkaFactory(nil, nil, fmt.Errorf("pop"))
+	_, err := NewKafkaBatchProducer(f, &KafkaCommonConf{Brokers: []string{"broker1"}})
+	assert.Regexp("pop", err)
+}
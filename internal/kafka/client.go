@@ -94,7 +94,7 @@ func (c *saramaKafkaClient) NewConsumer(k KafkaCommon) (KafkaConsumer, error) {
 		&saramaConsumerGroupFactory{},
 		c.client,
 		k.Conf().ConsumerGroup,
-		[]string{k.Conf().TopicIn},
+		k.Conf().ConsumerTopics(),
 		kafkaConsumerReconnectDelaySecs*time.Second)
 	return h, nil
 }
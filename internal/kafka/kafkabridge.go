@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,9 +36,13 @@ import (
 
 // KafkaBridgeConf defines the YAML config structure for a Kafka bridge instance
 type KafkaBridgeConf struct {
-	CircuitBreaker CircuitBreakerConf `json:"circuitBreaker,omitempty"`
-	Kafka          KafkaCommonConf    `json:"kafka"`
-	MaxInFlight    int                `json:"maxInFlight"`
+	CircuitBreaker    CircuitBreakerConf `json:"circuitBreaker,omitempty"`
+	Kafka             KafkaCommonConf    `json:"kafka"`
+	MaxInFlight       int                `json:"maxInFlight"`
+	ReplyProfile      string             `json:"replyProfile,omitempty"`
+	ReplyProfiles     map[string]string  `json:"replyProfiles,omitempty"`
+	ReplyTopics       []string           `json:"replyTopics,omitempty"`
+	TenantReplyTopics map[string]string  `json:"tenantReplyTopics,omitempty"`
 	tx.TxnProcessorConf
 	eth.RPCConf
 }
@@ -46,6 +51,7 @@ type KafkaBridgeConf struct {
 type KafkaBridge struct {
 	printYAML    *bool
 	conf         KafkaBridgeConf
+	factory      KafkaFactory
 	kafka        KafkaCommon
 	rpc          eth.RPCClient
 	processor    tx.TxnProcessor
@@ -77,7 +83,28 @@ func (k *KafkaBridge) ValidateConf() (err error) {
 	if k.conf.MaxInFlight <= 0 {
 		k.conf.MaxInFlight = 10
 	}
-	return
+	if err = messages.ValidateReplyProfile(k.conf.ReplyProfile); err != nil {
+		return
+	}
+	for _, profile := range k.conf.ReplyProfiles {
+		if err = messages.ValidateReplyProfile(profile); err != nil {
+			return
+		}
+	}
+	for tenant, topic := range k.conf.TenantReplyTopics {
+		if topic == "" {
+			return errors.Errorf(errors.ConfigKafkaTenantNoReplyTopic, tenant)
+		}
+	}
+	return tx.ValidateMessageTypes(&k.conf.TxnProcessorConf)
+}
+
+// replyProfile returns the profile used to serialize the replies sent to a topic
+func (k *KafkaBridge) replyProfile(topic string) string {
+	if profile, ok := k.conf.ReplyProfiles[topic]; ok {
+		return profile
+	}
+	return k.conf.ReplyProfile
 }
 
 // CobraInit retruns a cobra command to configure this KafkaBridge
@@ -102,6 +129,10 @@ func (k *KafkaBridge) CobraInit() (cmd *cobra.Command) {
 	eth.CobraInitRPC(cmd, &k.conf.RPCConf)
 	tx.CobraInitTxnProcessor(cmd, &k.conf.TxnProcessorConf)
 	cmd.Flags().IntVarP(&k.conf.MaxInFlight, "maxinflight", "m", utils.DefInt("KAFKA_MAX_INFLIGHT", 0), "Maximum messages to hold in-flight")
+	cmd.Flags().StringVarP(&k.conf.ReplyProfile, "reply-profile", "", messages.ReplyProfileCurrent, "Field naming profile for replies: current or legacy")
+	cmd.Flags().StringToStringVarP(&k.conf.TenantReplyTopics, "tenant-reply-topics", "", nil, "Reply topic for each tenant, identified by request topic or fly-tenant record header, such as tenant1=tenant1-replies")
+	cmd.Flags().StringToStringVarP(&k.conf.ReplyProfiles, "reply-topic-profiles", "", nil, "Field naming profile for replies sent to specific topics, such as legacy-replies=legacy")
+	cmd.Flags().StringSliceVarP(&k.conf.ReplyTopics, "reply-topics", "", nil, "Topics that requests can set as their replyTopic, such as app-replies or app-*. Any topic when not set")
 	return
 }
 
@@ -113,6 +144,7 @@ type msgContext struct {
 	reqOffset     string
 	saramaMsg     *sarama.ConsumerMessage
 	key           string
+	tenant        string
 	bridge        *KafkaBridge
 	complete      bool
 	replyType     string
@@ -157,8 +189,11 @@ func (k *KafkaBridge) addInflightMsg(msg *sarama.ConsumerMessage, producer Kafka
 	headers := &ctx.requestCommon.Headers
 	accessToken := ""
 	for _, header := range msg.Headers {
-		if string(header.Key) == messages.RecordHeaderAccessToken {
+		switch string(header.Key) {
+		case messages.RecordHeaderAccessToken:
 			accessToken = string(header.Value)
+		case messages.RecordHeaderTenant:
+			ctx.tenant = string(header.Value)
 		}
 	}
 	authCtx, err := auth.WithAuthContext(context.Background(), accessToken)
@@ -168,11 +203,20 @@ func (k *KafkaBridge) addInflightMsg(msg *sarama.ConsumerMessage, producer Kafka
 		return
 	}
 	ctx.ctx = authCtx
+	if err = ctx.checkReplyTopic(); err != nil {
+		log.Errorf("Rejected reply topic: %s - Message=%+v", err, ctx.requestCommon)
+		// The error reply must not be sent to the rejected topic either
+		headers.ReplyTopic = ""
+		return
+	}
 	if headers.ID == "" {
 		headers.ID = utils.UUIDv4()
 	}
-	// Use the account as the partitioning key, or fallback to the ID, which we ensure is non-null
-	if headers.Account != "" {
+	// Use the requested reply partition key, then the account as the partitioning key,
+	// or fallback to the ID, which we ensure is non-null
+	if headers.ReplyPartitionKey != "" {
+		ctx.key = headers.ReplyPartitionKey
+	} else if headers.Account != "" {
 		ctx.key = headers.Account
 	} else {
 		ctx.key = headers.ID
@@ -202,7 +246,7 @@ func (k *KafkaBridge) setInFlightComplete(ctx *msgContext, consumer KafkaConsume
 	ctx.complete = true
 	var completeInParition []*msgContext
 	for _, inflight := range k.inFlight {
-		if inflight.saramaMsg.Partition == ctx.saramaMsg.Partition {
+		if inflight.saramaMsg.Topic == ctx.saramaMsg.Topic && inflight.saramaMsg.Partition == ctx.saramaMsg.Partition {
 			completeInParition = append(completeInParition, inflight)
 		}
 	}
@@ -284,10 +328,11 @@ func (c *msgContext) Reply(replyMessage messages.ReplyWithHeaders) {
 	replyHeaders.Received = c.timeReceived.UTC().Format(time.RFC3339Nano)
 	c.replyTime = time.Now().UTC()
 	replyHeaders.Elapsed = c.replyTime.Sub(c.timeReceived).Seconds()
-	c.replyBytes, _ = json.Marshal(replyMessage)
+
+	topic := c.replyTopic()
+	c.replyBytes, _ = messages.MarshalReply(replyMessage, c.bridge.replyProfile(topic))
 
 	log.Infof("Sending reply: %s", c)
-	topic := c.bridge.kafka.Conf().TopicOut
 	var input chan<- *sarama.ProducerMessage
 	for {
 		var err error
@@ -306,6 +351,57 @@ func (c *msgContext) Reply(replyMessage messages.ReplyWithHeaders) {
 	}
 }
 
+// replyTopic returns the topic to send the reply to. A tenant reply topic configured for
+// the request topic takes precedence, followed by one for the fly-tenant record header, so
+// a tenant cannot direct its replies to the topic of another tenant. Requests that do not
+// belong to a tenant are replied to on the replyTopic in their headers, or on topicOut
+func (c *msgContext) replyTopic() string {
+	tenantTopics := c.bridge.conf.TenantReplyTopics
+	if topic, ok := tenantTopics[c.saramaMsg.Topic]; ok {
+		return topic
+	}
+	if topic, ok := tenantTopics[c.tenant]; ok && c.tenant != "" {
+		return topic
+	}
+	if c.requestCommon.Headers.ReplyTopic != "" {
+		return c.requestCommon.Headers.ReplyTopic
+	}
+	return c.bridge.kafka.Conf().TopicOut
+}
+
+// checkReplyTopic rejects a replyTopic in the headers of a request that is not one of the configured
+// reply topics, or that is the reply topic of a tenant the request does not belong to, so a request
+// cannot send its replies to a topic read by another application
+func (c *msgContext) checkReplyTopic() error {
+	replyTopic := c.requestCommon.Headers.ReplyTopic
+	if replyTopic == "" {
+		return nil
+	}
+	if !isReplyTopicAllowed(c.bridge.conf.ReplyTopics, replyTopic) {
+		return errors.Errorf(errors.KafkaReplyTopicNotPermitted, replyTopic)
+	}
+	for tenant, topic := range c.bridge.conf.TenantReplyTopics {
+		if topic == replyTopic && tenant != c.saramaMsg.Topic && tenant != c.tenant {
+			return errors.Errorf(errors.KafkaReplyTopicNotPermitted, replyTopic)
+		}
+	}
+	return nil
+}
+
+// isReplyTopicAllowed checks a topic against a list of topics, where an entry ending in '*' matches
+// any topic with that prefix. Any topic is allowed when the list is empty
+func isReplyTopicAllowed(allowedTopics []string, topic string) bool {
+	if len(allowedTopics) == 0 {
+		return true
+	}
+	for _, allowed := range allowedTopics {
+		if topic == allowed || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(topic, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *msgContext) String() string {
 	retval := fmt.Sprintf("MsgContext[%s:%s reqOffset=%s complete=%t received=%s",
 		c.requestCommon.Headers.MsgType, c.requestCommon.Headers.ID,
@@ -329,14 +425,15 @@ func (c msgContext) Encode() ([]byte, error) {
 }
 
 // NewKafkaBridge creates a new KafkaBridge
-func NewKafkaBridge(printYAML *bool) *KafkaBridge {
+func NewKafkaBridge(printYAML *bool, solc *eth.SolcConf) *KafkaBridge {
 	k := &KafkaBridge{
 		printYAML:    printYAML,
 		inFlight:     make(map[string]*msgContext),
 		inFlightCond: sync.NewCond(&sync.Mutex{}),
+		factory:      &SaramaKafkaFactory{},
 	}
-	k.processor = tx.NewTxnProcessor(&k.conf.TxnProcessorConf, &k.conf.RPCConf)
-	k.kafka = NewKafkaCommon(&SaramaKafkaFactory{}, &k.conf.Kafka, k)
+	k.processor = tx.NewTxnProcessor(&k.conf.TxnProcessorConf, &k.conf.RPCConf, solc)
+	k.kafka = NewKafkaCommon(k.factory, &k.conf.Kafka, k)
 	return k
 }
 
@@ -344,6 +441,7 @@ func NewKafkaBridge(printYAML *bool) *KafkaBridge {
 func (k *KafkaBridge) ConsumerMessagesLoop(consumer KafkaConsumer, producer KafkaProducer, wg *sync.WaitGroup) {
 	log.Debugf("Kafka consumer loop started")
 	for msg := range consumer.Messages() {
+		k.waitForRPC()
 		k.inFlightCond.L.Lock()
 		log.Infof("Kafka consumer received message: Partition=%d Offset=%d", msg.Partition, msg.Offset)
 
@@ -371,6 +469,22 @@ func (k *KafkaBridge) ConsumerMessagesLoop(consumer KafkaConsumer, producer Kafk
 	wg.Done()
 }
 
+// waitForRPC pauses consumption while the circuit breaker of the RPC connection is open, so
+// messages are left on the topic until the node responds again
+func (k *KafkaBridge) waitForRPC() {
+	breaker := eth.CircuitBreakerFor(k.rpc)
+	if breaker == nil {
+		return
+	}
+	if err := breaker.Check(); err != nil {
+		log.Warnf("Kafka consumer paused: %s", err)
+		if err = breaker.WaitClosed(context.Background()); err != nil {
+			return
+		}
+		log.Infof("Kafka consumer resumed")
+	}
+}
+
 // ProducerErrorLoop - goroutine to process producer errors
 func (k *KafkaBridge) ProducerErrorLoop(consumer KafkaConsumer, producer KafkaProducer, wg *sync.WaitGroup) {
 	log.Debugf("Kafka producer error loop started")
@@ -419,7 +533,22 @@ func (k *KafkaBridge) connect() (err error) {
 		return
 	}
 	k.processor.Init(k.rpc)
-	return
+	return k.addLifecycleSink()
+}
+
+// addLifecycleSink sends transaction lifecycle events to a Kafka topic, when configured
+func (k *KafkaBridge) addLifecycleSink() error {
+	topic := k.conf.Lifecycle.KafkaTopic
+	if topic == "" {
+		return nil
+	}
+	sink, err := NewKafkaLifecycleSink(k.factory, &k.conf.Kafka, topic)
+	if err != nil {
+		return err
+	}
+	log.Infof("Sending transaction lifecycle events to Kafka topic '%s'", topic)
+	k.processor.AddLifecycleSink(sink)
+	return nil
 }
 
 // Start kicks off the bridge
@@ -15,6 +15,7 @@
 package kafka
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/tx"
 	log "github.com/sirupsen/logrus"
@@ -84,6 +86,34 @@ func (p *testKafkaMsgProcessor) ResolveAddress(from string) (resolvedFrom string
 	return from, nil
 }
 
+func (p *testKafkaMsgProcessor) PendingTransactions(ctx context.Context, addr string) (*tx.PendingTransactions, error) {
+	return nil, nil
+}
+func (p *testKafkaMsgProcessor) InflightTransactions(addr string) ([]*tx.InflightAddress, error) {
+	return nil, nil
+}
+func (p *testKafkaMsgProcessor) ResetNonce(addr string, nextNonce *int64) (*tx.NonceReset, error) {
+	return nil, nil
+}
+
+func (p *testKafkaMsgProcessor) RecoverInflight(store kvstore.KVStore, newContext tx.RecoveryContextFactory) (*tx.RecoveryResult, error) {
+	return &tx.RecoveryResult{}, nil
+}
+
+func (p *testKafkaMsgProcessor) UpdateHDWallet(conf *tx.HDWalletConf, probe string) (*tx.IntegrationUpdate, error) {
+	return nil, nil
+}
+
+func (p *testKafkaMsgProcessor) UpdateAddressBook(ctx context.Context, conf *tx.AddressBookConf, probe string) (*tx.IntegrationUpdate, error) {
+	return nil, nil
+}
+
+func (p *testKafkaMsgProcessor) AddLifecycleSink(sink tx.LifecycleSink) {
+}
+
+func (p *testKafkaMsgProcessor) SetContractABIResolver(resolver tx.ContractABIResolver) {
+}
+
 func (p *testKafkaMsgProcessor) Init(rpc eth.RPCClient) {
 	p.rpc = rpc
 }
@@ -97,7 +127,7 @@ func TestNewKafkaBridge(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = false
-	bridge := NewKafkaBridge(&printYAML)
+	bridge := NewKafkaBridge(&printYAML, &eth.SolcConf{})
 	var conf KafkaBridgeConf
 	conf.RPC.URL = "http://example.com"
 	bridge.SetConf(&conf)
@@ -110,7 +140,7 @@ func TestNewKafkaBridge(t *testing.T) {
 func newTestKafkaBridge() (k *KafkaBridge, kafkaCmd *cobra.Command) {
 	log.SetLevel(log.DebugLevel)
 	var printYAML = false
-	k = NewKafkaBridge(&printYAML)
+	k = NewKafkaBridge(&printYAML, &eth.SolcConf{})
 	k.kafka = &testKafkaCommon{}
 	k.processor = &testKafkaMsgProcessor{
 		messages: make(chan tx.TxnContext),
@@ -294,6 +324,260 @@ func TestSingleMessageWithReply(t *testing.T) {
 	auth.RegisterSecurityModule(nil)
 }
 
+func TestSingleMessageWithReplyTopicAndPartitionKey(t *testing.T) {
+	assert := assert.New(t)
+
+	_, processor, mockConsumer, mockProducer, wg := setupMocks(true)
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestSingleMessageWithReplyTopicAndPartitionKey"
+	msg1.Headers.Account = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg1.Headers.ReplyTopic = "app-instance-replies"
+	msg1.Headers.ReplyPartitionKey = "app-instance-1"
+	msg1bytes, _ := json.Marshal(&msg1)
+
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+
+	msgContext1 := <-processor.messages
+	go func() {
+		reply1 := messages.ReplyCommon{}
+		reply1.Headers.MsgType = "TestReply"
+		msgContext1.Reply(&reply1)
+	}()
+
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+	assert.Equal("app-instance-replies", replyKafkaMsg.Topic)
+	assert.Equal(sarama.StringEncoder("app-instance-1"), replyKafkaMsg.Key)
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestValidateConfReplyProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.conf.RPC.URL = "http://localhost:8545"
+	k.conf.ReplyProfile = "other"
+	assert.Regexp("Unknown reply profile 'other'", k.ValidateConf())
+
+	k.conf.ReplyProfile = messages.ReplyProfileCurrent
+	k.conf.ReplyProfiles = map[string]string{"topic1": "another"}
+	assert.Regexp("Unknown reply profile 'another'", k.ValidateConf())
+
+	k.conf.ReplyProfiles = map[string]string{"topic1": messages.ReplyProfileLegacy}
+	assert.NoError(k.ValidateConf())
+	assert.Equal(messages.ReplyProfileLegacy, k.replyProfile("topic1"))
+	assert.Equal(messages.ReplyProfileCurrent, k.replyProfile("topic2"))
+}
+
+func TestValidateConfTenantReplyTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.conf.RPC.URL = "http://localhost:8545"
+	k.conf.TenantReplyTopics = map[string]string{"tenant1": ""}
+	assert.Regexp("No reply topic configured for tenant 'tenant1'", k.ValidateConf())
+
+	k.conf.TenantReplyTopics = map[string]string{"tenant1": "tenant1-replies"}
+	assert.NoError(k.ValidateConf())
+}
+
+func TestValidateConfMessageTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.conf.RPC.URL = "http://localhost:8545"
+	k.conf.MessageTypes = []string{"wrong"}
+	assert.Regexp("Invalid message type 'wrong'", k.ValidateConf())
+
+	k.conf.MessageTypes = []string{"sendtransaction"}
+	assert.NoError(k.ValidateConf())
+	assert.Equal([]string{"SendTransaction"}, k.conf.MessageTypes)
+}
+
+func TestSingleMessageTenantReplyTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks(true)
+	k.conf.TenantReplyTopics = map[string]string{
+		"tenant1-requests": "tenant1-replies",
+		"tenant2":          "tenant2-replies",
+	}
+
+	sendAndReply := func(topic string, offset int64, tenant, replyTopic string) string {
+		msg := messages.RequestCommon{}
+		msg.Headers.MsgType = "TestSingleMessageTenantReplyTopics"
+		msg.Headers.ReplyTopic = replyTopic
+		msgBytes, _ := json.Marshal(&msg)
+		var headers []*sarama.RecordHeader
+		if tenant != "" {
+			headers = append(headers, &sarama.RecordHeader{Key: []byte(messages.RecordHeaderTenant), Value: []byte(tenant)})
+		}
+		mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+			Topic:     topic,
+			Partition: 0,
+			Offset:    offset,
+			Value:     msgBytes,
+			Headers:   headers,
+		}
+		msgContext := <-processor.messages
+		go func() {
+			reply := messages.ReplyCommon{}
+			reply.Headers.MsgType = "TestReply"
+			msgContext.Reply(&reply)
+		}()
+		replyKafkaMsg := <-mockProducer.MockInput
+		mockProducer.MockSuccesses <- replyKafkaMsg
+		return replyKafkaMsg.Topic
+	}
+
+	// Request topic mapped to a tenant, which cannot be overridden by headers
+	assert.Equal("tenant1-replies", sendAndReply("tenant1-requests", 1, "", ""))
+	assert.Equal("tenant1-replies", sendAndReply("tenant1-requests", 2, "tenant2", "other-replies"))
+	// Tenant identified by record header on a shared request topic
+	assert.Equal("tenant2-replies", sendAndReply("in-topic", 1, "tenant2", "other-replies"))
+	// Requests without a configured tenant use the reply topic in their headers
+	assert.Equal("other-replies", sendAndReply("in-topic", 2, "tenant3", "other-replies"))
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestSingleMessageTenantReplyTopicNotPermitted(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _, mockConsumer, mockProducer, wg := setupMocks(true)
+	k.conf.TenantReplyTopics = map[string]string{
+		"tenant1-requests": "tenant1-replies",
+	}
+
+	// A request without a tenant cannot direct its replies to the topic of a tenant
+	msg := messages.RequestCommon{}
+	msg.Headers.MsgType = "TestSingleMessageTenantReplyTopicNotPermitted"
+	msg.Headers.ReplyTopic = "tenant1-replies"
+	msgBytes, _ := json.Marshal(&msg)
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic: "in-topic",
+		Value: msgBytes,
+	}
+
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+	assert.Equal("", replyKafkaMsg.Topic)
+	replyBytes, _ := replyKafkaMsg.Value.Encode()
+	var errorReply messages.ErrorReply
+	json.Unmarshal(replyBytes, &errorReply)
+	assert.Equal("Reply topic 'tenant1-replies' is not permitted", errorReply.ErrorMessage)
+	assert.Equal(errors.KafkaReplyTopicNotPermitted.Code(), errorReply.ErrorCode)
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestSingleMessageReplyTopicNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _, mockConsumer, mockProducer, wg := setupMocks(true)
+	k.conf.ReplyTopics = []string{"app-replies", "team1-*"}
+
+	msg := messages.RequestCommon{}
+	msg.Headers.MsgType = "TestSingleMessageReplyTopicNotAllowed"
+	msg.Headers.ReplyTopic = "other-replies"
+	msgBytes, _ := json.Marshal(&msg)
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic: "in-topic",
+		Value: msgBytes,
+	}
+
+	// The error reply is sent to the output topic, rather than the requested topic
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+	assert.Equal("", replyKafkaMsg.Topic)
+	replyBytes, _ := replyKafkaMsg.Value.Encode()
+	var errorReply messages.ErrorReply
+	json.Unmarshal(replyBytes, &errorReply)
+	assert.Equal("Reply topic 'other-replies' is not permitted", errorReply.ErrorMessage)
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestIsReplyTopicAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isReplyTopicAllowed(nil, "any-topic"))
+	allowed := []string{"app-replies", "team1-*"}
+	assert.True(isReplyTopicAllowed(allowed, "app-replies"))
+	assert.True(isReplyTopicAllowed(allowed, "team1-replies"))
+	assert.False(isReplyTopicAllowed(allowed, "app-replies2"))
+	assert.False(isReplyTopicAllowed(allowed, "team2-replies"))
+}
+
+func TestSetInFlightCompletePerTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _, mockConsumer, mockProducer, _ := setupMocks(false)
+
+	ctx1, _ := k.addInflightMsg(&sarama.ConsumerMessage{Topic: "topic1", Partition: 0, Offset: 10, Value: []byte("{}")}, mockProducer)
+	ctx2, _ := k.addInflightMsg(&sarama.ConsumerMessage{Topic: "topic2", Partition: 0, Offset: 20, Value: []byte("{}")}, mockProducer)
+	assert.NotNil(ctx1)
+
+	// The incomplete message on topic1 does not hold up the offset of topic2
+	k.setInFlightComplete(ctx2, mockConsumer)
+	assert.Equal(int64(20), mockConsumer.OffsetsByPartition[0])
+	assert.Equal(1, len(k.inFlight))
+}
+
+func TestSingleMessageWithLegacyReplyProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks(true)
+	k.conf.ReplyProfiles = map[string]string{"legacy-replies": messages.ReplyProfileLegacy}
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestSingleMessageWithLegacyReplyProfile"
+	msg1.Headers.ReplyTopic = "legacy-replies"
+	msg1bytes, _ := json.Marshal(&msg1)
+
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+
+	msgContext1 := <-processor.messages
+	go func() {
+		reply1 := messages.TransactionReceipt{ContractSwagger: "http://localhost/contracts/c1?openapi"}
+		reply1.Headers.MsgType = messages.MsgTypeTransactionSuccess
+		msgContext1.Reply(&reply1)
+	}()
+
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+	assert.Equal("legacy-replies", replyKafkaMsg.Topic)
+	replyBytes, _ := replyKafkaMsg.Value.Encode()
+	var replySent map[string]interface{}
+	json.Unmarshal(replyBytes, &replySent)
+	assert.Equal("http://localhost/contracts/c1?openapi", replySent["swagger"])
+	assert.Nil(replySent["openapi"])
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
 func TestSingleMessageWithNotAuthorizedReply(t *testing.T) {
 	assert := assert.New(t)
 	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
@@ -606,3 +890,78 @@ func TestProducerSuccessLoopPanicsMsgNotInflight(t *testing.T) {
 	wg.Wait()
 
 }
+
+type testRPCBreaker struct {
+	mux    sync.Mutex
+	err    error
+	closed chan struct{}
+}
+
+func (b *testRPCBreaker) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return nil
+}
+
+func (b *testRPCBreaker) Check() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.err
+}
+
+func (b *testRPCBreaker) WaitClosed(ctx context.Context) error {
+	<-b.closed
+	return nil
+}
+
+func (b *testRPCBreaker) State() *eth.RPCBreakerState {
+	return &eth.RPCBreakerState{}
+}
+
+func (b *testRPCBreaker) reset() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.err = nil
+	close(b.closed)
+}
+
+func TestConsumerPausedWhileRPCCircuitBreakerOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks(false)
+	breaker := &testRPCBreaker{err: fmt.Errorf("circuit breaker is open"), closed: make(chan struct{})}
+	k.rpc = breaker
+	wg.Add(2)
+	go k.ConsumerMessagesLoop(mockConsumer, mockProducer, wg)
+	go k.ProducerSuccessLoop(mockConsumer, mockProducer, wg)
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestConsumerPaused"
+	msg1bytes, _ := json.Marshal(&msg1)
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+
+	select {
+	case <-processor.messages:
+		assert.Fail("Message dispatched while the circuit breaker is open")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	breaker.reset()
+	msgContext1 := <-processor.messages
+	assert.Equal("TestConsumerPaused", msgContext1.Headers().MsgType)
+
+	go func() {
+		reply1 := messages.ReplyCommon{}
+		reply1.Headers.MsgType = "TestReply"
+		msgContext1.Reply(&reply1)
+	}()
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
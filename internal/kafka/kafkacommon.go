@@ -41,6 +41,7 @@ type KafkaCommonConf struct {
 	ClientID         string   `json:"clientID"`
 	ConsumerGroup    string   `json:"consumerGroup"`
 	TopicIn          string   `json:"topicIn"`
+	TopicsIn         []string `json:"topicsIn,omitempty"`
 	TopicOut         string   `json:"topicOut"`
 	SendRetryDelayMS int      `json:"sendRetryDelayMS"`
 	ProducerFlush    struct {
@@ -58,6 +59,17 @@ type KafkaCommonConf struct {
 	sendRetryDelay time.Duration
 }
 
+// ConsumerTopics returns topicIn, followed by any additional topicsIn
+func (c *KafkaCommonConf) ConsumerTopics() []string {
+	topics := []string{c.TopicIn}
+	for _, topic := range c.TopicsIn {
+		if topic != "" && topic != c.TopicIn {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
 // KafkaCommon is the base interface for bridges that interact with Kafka
 type KafkaCommon interface {
 	ValidateConf() error
@@ -144,6 +156,7 @@ func KafkaCommonCobraInit(cmd *cobra.Command, kconf *KafkaCommonConf) {
 	cmd.Flags().StringVarP(&kconf.ClientID, "clientid", "i", os.Getenv("KAFKA_CLIENT_ID"), "Client ID (or generated UUID)")
 	cmd.Flags().StringVarP(&kconf.ConsumerGroup, "consumer-group", "g", os.Getenv("KAFKA_CONSUMER_GROUP"), "Client ID (or generated UUID)")
 	cmd.Flags().StringVarP(&kconf.TopicIn, "topic-in", "t", os.Getenv("KAFKA_TOPIC_IN"), "Topic to listen to")
+	cmd.Flags().StringSliceVarP(&kconf.TopicsIn, "topics-in", "", nil, "Additional topics to listen to, such as a request topic for each tenant")
 	cmd.Flags().StringVarP(&kconf.TopicOut, "topic-out", "T", os.Getenv("KAFKA_TOPIC_OUT"), "Topic to send events to")
 	cmd.Flags().StringVarP(&kconf.TLS.ClientCertsFile, "tls-clientcerts", "c", os.Getenv("KAFKA_TLS_CLIENT_CERT"), "A client certificate file, for mutual TLS auth")
 	cmd.Flags().StringVarP(&kconf.TLS.ClientKeyFile, "tls-clientkey", "k", os.Getenv("KAFKA_TLS_CLIENT_KEY"), "A client private key file, for mutual TLS auth")
@@ -263,7 +276,7 @@ func (k *kafkaCommon) startProducer() (err error) {
 }
 
 func (k *kafkaCommon) createConsumer() (err error) {
-	log.Debugf("Kafka Consumer Topic=%s ConsumerGroup=%s", k.conf.TopicIn, k.conf.ConsumerGroup)
+	log.Debugf("Kafka Consumer Topics=%v ConsumerGroup=%s", k.conf.ConsumerTopics(), k.conf.ConsumerGroup)
 	if k.consumer, err = k.client.NewConsumer(k); err != nil {
 		log.Errorf("Failed to create Kafka consumer: %s", err)
 		return
@@ -115,6 +115,14 @@ func TestNewKafkaCommon(t *testing.T) {
 	assert.NotNil(k.Conf())
 }
 
+func TestConsumerTopics(t *testing.T) {
+	assert := assert.New(t)
+	conf := &KafkaCommonConf{TopicIn: "topic1"}
+	assert.Equal([]string{"topic1"}, conf.ConsumerTopics())
+	conf.TopicsIn = []string{"topic2", "topic1", "", "topic3"}
+	assert.Equal([]string{"topic1", "topic2", "topic3"}, conf.ConsumerTopics())
+}
+
 func TestExecuteWithIncompleteArgs(t *testing.T) {
 	assert := assert.New(t)
 	f := NewMockKafkaFactory()
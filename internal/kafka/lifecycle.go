@@ -0,0 +1,51 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+)
+
+type kafkaLifecycleSink struct {
+	producer KafkaBatchProducer
+	topic    string
+}
+
+// NewKafkaLifecycleSink connects a producer to send transaction lifecycle events to a topic,
+// keyed by request ID so the events for each transaction are delivered in order
+func NewKafkaLifecycleSink(kf KafkaFactory, conf *KafkaCommonConf, topic string) (tx.LifecycleSink, error) {
+	producer, err := NewKafkaBatchProducer(kf, conf)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaLifecycleSink{
+		producer: producer,
+		topic:    topic,
+	}, nil
+}
+
+func (s *kafkaLifecycleSink) SendLifecycleEvents(events []*tx.LifecycleEvent) error {
+	msgs := make([]*KafkaBatchMessage, len(events))
+	for i, event := range events {
+		b, _ := json.Marshal(event)
+		msgs[i] = &KafkaBatchMessage{
+			Key:   event.RequestID,
+			Value: b,
+		}
+	}
+	return s.producer.SendBatch(s.topic, msgs)
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaLifecycleSink(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewMockKafkaFactory()
+	sink, err := NewKafkaLifecycleSink(f, &KafkaCommonConf{Brokers: []string{"broker1"}}, "lifecycle")
+	assert.NoError(err)
+	defer sink.(*kafkaLifecycleSink).producer.Close()
+
+	sent := make(chan *sarama.ProducerMessage, 2)
+	go func() {
+		for msg := range f.Producer.MockInput {
+			sent <- msg
+			f.Producer.MockSuccesses <- msg
+		}
+	}()
+
+	err = sink.SendLifecycleEvents([]*tx.LifecycleEvent{
+		{Type: tx.LifecycleAccepted, RequestID: "req1"},
+		{Type: tx.LifecycleSent, RequestID: "req1", TransactionHash: "0x12345"},
+	})
+	assert.NoError(err)
+	msg1 := <-sent
+	assert.Equal("lifecycle", msg1.Topic)
+	assert.Equal(sarama.StringEncoder("req1"), msg1.Key)
+	msg2 := <-sent
+	var event tx.LifecycleEvent
+	b, _ := msg2.Value.Encode()
+	json.Unmarshal(b, &event)
+	assert.Equal(tx.LifecycleSent, event.Type)
+	assert.Equal("0x12345", event.TransactionHash)
+}
+
+func TestKafkaLifecycleSinkNoBrokers(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewKafkaLifecycleSink(NewMockKafkaFactory(), &KafkaCommonConf{}, "lifecycle")
+	assert.Regexp("No Kafka brokers configured", err)
+}
+
+func TestKafkaBridgeAddLifecycleSink(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.factory = NewMockKafkaFactory()
+	assert.NoError(k.addLifecycleSink())
+
+	k.conf.Lifecycle.KafkaTopic = "lifecycle"
+	assert.Regexp("No Kafka brokers configured", k.addLifecycleSink())
+
+	k.conf.Kafka.Brokers = []string{"broker1"}
+	assert.NoError(k.addLifecycleSink())
+
+	k.factory = NewErrorMockKafkaFactory(fmt.Errorf("pop"), nil, nil)
+	assert.Regexp("pop", k.addLifecycleSink())
+}
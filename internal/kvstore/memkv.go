@@ -15,6 +15,8 @@
 package kvstore
 
 import (
+	"sort"
+
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -47,9 +49,14 @@ func (m *MockKV) Delete(key string) error {
 	return m.DeleteErr
 }
 
-// NewIterator for a new iterator
+// NewIterator for a new iterator, over a snapshot of the keys in order
 func (m *MockKV) NewIterator() KVIterator {
-	return nil // not implemented in mock
+	keys := make([]string, 0, len(m.KVS))
+	for k := range m.KVS {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &mockKVIterator{m: m, keys: keys, pos: -1}
 }
 
 // NewIterator for a new iterator
@@ -60,6 +67,56 @@ func (m *MockKV) NewIteratorWithRange(rng interface{}) KVIterator {
 // Close it
 func (m *MockKV) Close() {}
 
+type mockKVIterator struct {
+	m    *MockKV
+	keys []string
+	pos  int
+}
+
+func (i *mockKVIterator) valid() bool {
+	return i.pos >= 0 && i.pos < len(i.keys)
+}
+
+func (i *mockKVIterator) Key() string {
+	if !i.valid() {
+		return ""
+	}
+	return i.keys[i.pos]
+}
+
+func (i *mockKVIterator) Value() []byte {
+	if !i.valid() {
+		return nil
+	}
+	return i.m.KVS[i.keys[i.pos]]
+}
+
+func (i *mockKVIterator) Next() bool {
+	if i.pos < len(i.keys) {
+		i.pos++
+	}
+	return i.valid()
+}
+
+func (i *mockKVIterator) Prev() bool {
+	if i.pos >= 0 {
+		i.pos--
+	}
+	return i.valid()
+}
+
+func (i *mockKVIterator) Seek(key string) bool {
+	i.pos = sort.SearchStrings(i.keys, key)
+	return i.valid()
+}
+
+func (i *mockKVIterator) Last() bool {
+	i.pos = len(i.keys) - 1
+	return i.valid()
+}
+
+func (i *mockKVIterator) Release() {}
+
 // NewMockKV constructor
 func NewMockKV(err error) *MockKV {
 	return &MockKV{
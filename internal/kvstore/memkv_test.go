@@ -35,3 +35,28 @@ func TestExerciseMockLDB(t *testing.T) {
 	m.Close()
 
 }
+
+func TestMockKVIterator(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewMockKV(nil)
+	m.Put("b", []byte("2"))
+	m.Put("a", []byte("1"))
+	m.Put("c", []byte("3"))
+	it := m.NewIterator()
+	defer it.Release()
+	assert.True(it.Next())
+	assert.Equal("a", it.Key())
+	assert.Equal("1", string(it.Value()))
+	assert.True(it.Seek("b"))
+	assert.Equal("b", it.Key())
+	assert.True(it.Prev())
+	assert.Equal("a", it.Key())
+	assert.False(it.Prev())
+	assert.Equal("", it.Key())
+	assert.Nil(it.Value())
+	assert.True(it.Last())
+	assert.Equal("c", it.Key())
+	assert.False(it.Next())
+	assert.False(it.Seek("d"))
+}
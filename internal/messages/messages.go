@@ -33,15 +33,33 @@ const (
 	MsgTypeTransactionSuccess = "TransactionSuccess"
 	// MsgTypeTransactionFailure - a transaction receipt where status is 0
 	MsgTypeTransactionFailure = "TransactionFailure"
+	// MsgTypeSpeedUpTransaction - resend an in-flight transaction with a higher gas price
+	MsgTypeSpeedUpTransaction = "SpeedUpTransaction"
+	// MsgTypeTransactionSpeedUp - an in-flight transaction has been resent with a higher gas price
+	MsgTypeTransactionSpeedUp = "TransactionSpeedUp"
+	// MsgTypeCancelTransaction - replace an in-flight transaction with a zero-value transfer to the sender
+	MsgTypeCancelTransaction = "CancelTransaction"
+	// MsgTypeTransactionCancel - the outcome of cancelling a transaction, once one of the transactions is mined
+	MsgTypeTransactionCancel = "TransactionCancel"
 	// RecordHeaderAccessToken - record header name for passing JWT token over messaging
 	RecordHeaderAccessToken = "fly-accesstoken"
+	// RecordHeaderTenant - record header name for the tenant of a request, used to route its reply
+	RecordHeaderTenant = "fly-tenant"
 )
 
 // AsyncSentMsg is a standard response for async requests
 type AsyncSentMsg struct {
-	Sent    bool   `json:"sent"`
-	Request string `json:"id"`
-	Msg     string `json:"msg,omitempty"`
+	Sent       bool              `json:"sent"`
+	Request    string            `json:"id"`
+	Msg        string            `json:"msg,omitempty"`
+	Simulation *SimulationResult `json:"simulation,omitempty"`
+}
+
+// SimulationResult is the outcome of running a transaction as an eth_call before it was submitted
+type SimulationResult struct {
+	Success bool                   `json:"success"`
+	Error   string                 `json:"error,omitempty"`
+	Outputs map[string]interface{} `json:"outputs,omitempty"`
 }
 
 // CommonHeaders are common to all messages
@@ -58,9 +76,13 @@ type RequestCommon struct {
 	Headers RequestHeaders `json:"headers"`
 }
 
-// RequestHeaders are common to all replies
+// RequestHeaders are common to all requests.
+// ReplyTopic and ReplyPartitionKey allow the requester to route the reply over Kafka
+// to a specific topic, and partition within that topic, instead of the default reply topic
 type RequestHeaders struct {
 	CommonHeaders
+	ReplyTopic        string `json:"replyTopic,omitempty"`
+	ReplyPartitionKey string `json:"replyPartitionKey,omitempty"`
 }
 
 // ReplyHeaders are common to all replies
@@ -115,6 +137,13 @@ type TransactionCommon struct {
 	PrivateFor     []string      `json:"privateFor,omitempty"`
 	PrivacyGroupID string        `json:"privacyGroupId,omitempty"`
 	AckType        string        `json:"acktype,omitempty"`
+	// MaxFeePerGas and MaxPriorityFeePerGas send an EIP-1559 dynamic fee transaction, instead of a gasPrice
+	MaxFeePerGas         json.Number `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas json.Number `json:"maxPriorityFeePerGas,omitempty"`
+	// EchoRequest echoes the method, parameters and target of the request into the receipt
+	EchoRequest bool `json:"echoRequest,omitempty"`
+	// RequestPath is the gateway path the request was submitted to, echoed into the receipt
+	RequestPath string `json:"requestPath,omitempty"`
 }
 
 // SendTransaction message instructs the bridge to install a contract
@@ -123,6 +152,32 @@ type SendTransaction struct {
 	To         string                           `json:"to"`
 	Method     *ethbinding.ABIElementMarshaling `json:"method,omitempty"`
 	MethodName string                           `json:"methodName,omitempty"`
+	// Errors are the custom errors in the ABI of the contract, to decode the reason the transaction reverts with
+	Errors ethbinding.ABIMarshaling `json:"errors,omitempty"`
+}
+
+// SpeedUpTransaction message instructs the bridge to resend an in-flight transaction with the
+// same nonce and a higher gas price, replacing it in the transaction pool of the node.
+// The fees are bumped by the configured percentage, unless they are supplied
+type SpeedUpTransaction struct {
+	RequestCommon
+	From                 string      `json:"from"`
+	TransactionHash      string      `json:"transactionHash"`
+	GasPrice             json.Number `json:"gasPrice,omitempty"`
+	MaxFeePerGas         json.Number `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas json.Number `json:"maxPriorityFeePerGas,omitempty"`
+}
+
+// CancelTransaction message instructs the bridge to replace an in-flight transaction with a
+// zero-value transfer from the sender to itself, with the same nonce and a higher gas price.
+// The fees are bumped by the configured percentage, unless they are supplied
+type CancelTransaction struct {
+	RequestCommon
+	From                 string      `json:"from"`
+	TransactionHash      string      `json:"transactionHash"`
+	GasPrice             json.Number `json:"gasPrice,omitempty"`
+	MaxFeePerGas         json.Number `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas json.Number `json:"maxPriorityFeePerGas,omitempty"`
 }
 
 // DeployContract message instructs the bridge to install a contract
@@ -137,6 +192,37 @@ type DeployContract struct {
 	ContractName    string                   `json:"contractName,omitempty"`
 	Description     string                   `json:"description,omitempty"`
 	RegisterAs      string                   `json:"registerAs,omitempty"`
+	Project         string                   `json:"project,omitempty"`
+	// Deleted records when a stored ABI was soft-deleted
+	Deleted string `json:"deleted,omitempty"`
+	// CompilerSettings and CompilerOutputs are recorded when the contract was compiled by the gateway
+	CompilerSettings *CompilerSettings          `json:"compilerSettings,omitempty"`
+	CompilerOutputs  map[string]json.RawMessage `json:"compilerOutputs,omitempty"`
+}
+
+// CompilerSettings are the solc settings a contract was compiled with, so the compilation can be reproduced
+type CompilerSettings struct {
+	EVMVersion   string   `json:"evmVersion"`
+	Optimize     bool     `json:"optimize"`
+	OptimizeRuns int      `json:"optimizeRuns,omitempty"`
+	Outputs      []string `json:"outputs,omitempty"`
+	Remappings   []string `json:"remappings,omitempty"`
+}
+
+// RequestEcho is the request of a transaction echoed into its receipt, so consumers of the
+// replies can act on a receipt without looking up their own record of the request
+type RequestEcho struct {
+	Method string              `json:"method,omitempty"`
+	Params []*RequestEchoParam `json:"params,omitempty"`
+	To     string              `json:"to,omitempty"`
+	Path   string              `json:"path,omitempty"`
+}
+
+// RequestEchoParam is a parameter of an echoed request, with the name and type of its ABI input
+type RequestEchoParam struct {
+	Name  string      `json:"name,omitempty"`
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value"`
 }
 
 // TransactionReceipt is sent when a transaction has been successfully mined
@@ -152,6 +238,10 @@ type TransactionReceipt struct {
 	ContractAddress      *ethbinding.Address   `json:"contractAddress,omitempty"`
 	CumulativeGasUsedStr string                `json:"cumulativeGasUsed"`
 	CumulativeGasUsedHex *ethbinding.HexBigInt `json:"cumulativeGasUsedHex,omitempty"`
+	EffectiveGasPriceStr string                `json:"effectiveGasPrice,omitempty"`
+	EffectiveGasPriceHex *ethbinding.HexBigInt `json:"effectiveGasPriceHex,omitempty"`
+	EstimatedGasStr      string                `json:"estimatedGas,omitempty"`
+	EstimatedGasHex      *ethbinding.HexUint64 `json:"estimatedGasHex,omitempty"`
 	From                 *ethbinding.Address   `json:"from"`
 	GasUsedStr           string                `json:"gasUsed"`
 	GasUsedHex           *ethbinding.HexBigInt `json:"gasUsedHex,omitempty"`
@@ -164,6 +254,61 @@ type TransactionReceipt struct {
 	TransactionIndexStr  string                `json:"transactionIndex"`
 	TransactionIndexHex  *ethbinding.HexUint   `json:"transactionIndexHex,omitempty"`
 	RegisterAs           string                `json:"registerAs,omitempty"`
+	// RevertReason is decoded for a failed transaction, by replaying it as a call
+	RevertReason string `json:"revertReason,omitempty"`
+	// Events are the logs of the transaction that could be decoded against the stored ABI of the contract that emitted them
+	Events []*ReceiptEvent `json:"events,omitempty"`
+	// Resubmissions are the attempts to resend the transaction with a higher gas price, while it was waiting to be mined
+	Resubmissions []*Resubmission `json:"resubmissions,omitempty"`
+	// Request is the request of the transaction, when it is echoed into the receipt
+	Request *RequestEcho `json:"request,omitempty"`
+}
+
+// Resubmission is an attempt to resend a transaction that had not been mined, with a higher gas price
+type Resubmission struct {
+	Attempt                 int    `json:"attempt"`
+	Time                    string `json:"time"`
+	ReplacedTransactionHash string `json:"replacedTransactionHash"`
+	TransactionHash         string `json:"transactionHash,omitempty"`
+	GasPriceStr             string `json:"gasPrice,omitempty"`
+	MaxFeePerGasStr         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGasStr string `json:"maxPriorityFeePerGas,omitempty"`
+	Error                   string `json:"error,omitempty"`
+}
+
+// ReceiptEvent is an event emitted by a transaction, decoded from a log in its receipt
+type ReceiptEvent struct {
+	Address   string                 `json:"address"`
+	Signature string                 `json:"signature"`
+	LogIndex  string                 `json:"logIndex"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// TransactionSpeedUp is sent when an in-flight transaction has been resent with a higher gas price.
+// The receipt is still sent in reply to the original request, for whichever transaction is mined
+type TransactionSpeedUp struct {
+	ReplyCommon
+	TransactionHash         string `json:"transactionHash"`
+	ReplacedTransactionHash string `json:"replacedTransactionHash"`
+	NonceStr                string `json:"nonce"`
+	GasPriceStr             string `json:"gasPrice,omitempty"`
+	MaxFeePerGasStr         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGasStr string `json:"maxPriorityFeePerGas,omitempty"`
+}
+
+// TransactionCancel is sent once either the cancelled transaction, or the cancellation, is mined.
+// Cancelled is true if the cancellation won, in which case the original request gets an error reply
+type TransactionCancel struct {
+	ReplyCommon
+	TransactionHash          string `json:"transactionHash"`
+	CancelledTransactionHash string `json:"cancelledTransactionHash"`
+	MinedTransactionHash     string `json:"minedTransactionHash"`
+	Cancelled                bool   `json:"cancelled"`
+	BlockNumberStr           string `json:"blockNumber,omitempty"`
+	NonceStr                 string `json:"nonce"`
+	GasPriceStr              string `json:"gasPrice,omitempty"`
+	MaxFeePerGasStr          string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGasStr  string `json:"maxPriorityFeePerGas,omitempty"`
 }
 
 // TransactionInfo is the detailed transaction info returned by eth_getTransactionByXXXXX
@@ -195,10 +340,13 @@ type ErrorReply struct {
 	ReplyCommon
 	ErrorMessage     string `json:"errorMessage,omitempty"`
 	ErrorCode        string `json:"errorCode,omitempty"`
+	ErrorType        string `json:"errorType,omitempty"`
+	Retryable        *bool  `json:"retryable,omitempty"`
 	OriginalMessage  string `json:"requestPayload,omitempty"`
 	TXHash           string `json:"transactionHash,omitempty"`
 	GapFillTxHash    string `json:"gapFillTxHash,omitempty"`
 	GapFillSucceeded *bool  `json:"gapFillSucceeded,omitempty"`
+	RevertReason     string `json:"revertReason,omitempty"`
 }
 
 // NewErrorReply is a helper to construct an error message
@@ -213,6 +361,13 @@ func NewErrorReply(err error, origMsg interface{}) *ErrorReply {
 		default:
 			errMsg.ErrorMessage = err.Error()
 		}
+		if errorType, retryable, ok := errors.ClassifyNodeError(err); ok {
+			errMsg.ErrorType = string(errorType)
+			errMsg.Retryable = &retryable
+		}
+		if revertErr, ok := err.(errors.RevertedError); ok {
+			errMsg.RevertReason = revertErr.RevertReason()
+		}
 	}
 	if reflect.TypeOf(origMsg).Kind() == reflect.Slice {
 		errMsg.OriginalMessage = string(origMsg.([]byte))
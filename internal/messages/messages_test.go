@@ -81,6 +81,28 @@ func TestNewErrorReplyNonFFEC(t *testing.T) {
 	assert.Equal(t, "non FFEC error", errReply.ErrorMessage)
 }
 
+func TestNewErrorReplyNodeError(t *testing.T) {
+	errReply := NewErrorReply(fmt.Errorf("nonce too low"), map[string]interface{}{})
+	assert.Equal(t, "nonceTooLow", errReply.ErrorType)
+	assert.True(t, *errReply.Retryable)
+
+	errReply = NewErrorReply(errors.Errorf(errors.RESTGatewaySyncWrapErrorWithTXDetail, "0x12345", fmt.Errorf("execution reverted")), map[string]interface{}{})
+	assert.Equal(t, "reverted", errReply.ErrorType)
+	assert.False(t, *errReply.Retryable)
+
+	errReply = NewErrorReply(fmt.Errorf("pop"), map[string]interface{}{})
+	assert.Empty(t, errReply.ErrorType)
+	assert.Nil(t, errReply.Retryable)
+}
+
+func TestNewErrorReplyReverted(t *testing.T) {
+	errReply := NewErrorReply(errors.Reverted(errors.TransactionSendCallFailedRevertError, "Panic(0x01): assertion failed", "Panic(0x01): assertion failed"), map[string]interface{}{})
+	assert.Equal(t, errors.TransactionSendCallFailedRevertError.Code(), errReply.ErrorCode)
+	assert.Equal(t, "EVM reverted: Panic(0x01): assertion failed", errReply.ErrorMessage)
+	assert.Equal(t, "Panic(0x01): assertion failed", errReply.RevertReason)
+	assert.Equal(t, "reverted", errReply.ErrorType)
+}
+
 func TestErrorMessageForEmptyData(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,85 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+)
+
+const (
+	// ReplyProfileCurrent serializes replies with the current field names
+	ReplyProfileCurrent = "current"
+	// ReplyProfileLegacy serializes replies with the field names of earlier releases,
+	// for consumers that have not been updated since fields were renamed
+	ReplyProfileLegacy = "legacy"
+)
+
+// replyProfiles maps the current JSON field names of a reply to the names used by each
+// profile. Nested fields are addressed with a dot, such as headers.requestABIId, and
+// fields mapped to an empty name are removed
+var replyProfiles = map[string]map[string]string{
+	ReplyProfileCurrent: {},
+	ReplyProfileLegacy: {
+		"openapi":              "swagger",
+		"headers.requestABIId": "",
+	},
+}
+
+// ValidateReplyProfile checks the profile is known. An empty profile is the current profile
+func ValidateReplyProfile(profile string) error {
+	if _, ok := replyProfiles[profile]; !ok && profile != "" {
+		return errors.Errorf(errors.ReplyProfileUnknown, profile)
+	}
+	return nil
+}
+
+// MarshalReply serializes a reply with the field names of a profile
+func MarshalReply(reply interface{}, profile string) ([]byte, error) {
+	b, err := json.Marshal(reply)
+	renames := replyProfiles[profile]
+	if err != nil || len(renames) == 0 {
+		return b, err
+	}
+	// Numbers are decoded as json.Number so that they are not reformatted
+	var generic map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+	for from, to := range renames {
+		renameField(generic, strings.Split(from, "."), to)
+	}
+	return json.Marshal(generic)
+}
+
+func renameField(m map[string]interface{}, path []string, to string) {
+	if len(path) > 1 {
+		if child, ok := m[path[0]].(map[string]interface{}); ok {
+			renameField(child, path[1:], to)
+		}
+		return
+	}
+	if v, ok := m[path[0]]; ok {
+		delete(m, path[0])
+		if to != "" {
+			m[to] = v
+		}
+	}
+}
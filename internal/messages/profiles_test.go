@@ -0,0 +1,73 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalReplyProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	receipt := &TransactionReceipt{
+		BlockNumberStr:  "12345",
+		ContractSwagger: "http://localhost/contracts/c1?openapi",
+	}
+	receipt.Headers.MsgType = MsgTypeTransactionSuccess
+	receipt.Headers.ReqABIID = "abi1"
+	receipt.Headers.Elapsed = 0.123456789
+
+	b, err := MarshalReply(receipt, ReplyProfileCurrent)
+	assert.NoError(err)
+	assert.Regexp(`"openapi":"http://localhost/contracts/c1\?openapi"`, string(b))
+	assert.Regexp(`"requestABIId":"abi1"`, string(b))
+
+	b, err = MarshalReply(receipt, "")
+	assert.NoError(err)
+	assert.Regexp(`"openapi":`, string(b))
+
+	b, err = MarshalReply(receipt, ReplyProfileLegacy)
+	assert.NoError(err)
+	assert.Regexp(`"swagger":"http://localhost/contracts/c1\?openapi"`, string(b))
+	assert.NotRegexp(`"openapi"`, string(b))
+	assert.NotRegexp(`"requestABIId"`, string(b))
+	assert.Regexp(`"timeElapsed":0.123456789`, string(b))
+	assert.Regexp(`"blockNumber":"12345"`, string(b))
+}
+
+func TestMarshalReplyErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := MarshalReply(math.Inf(1), ReplyProfileLegacy)
+	assert.Error(err)
+
+	_, err = MarshalReply("not an object", ReplyProfileLegacy)
+	assert.Error(err)
+
+	b, err := MarshalReply(map[string]interface{}{"headers": "flat"}, ReplyProfileLegacy)
+	assert.NoError(err)
+	assert.Equal(`{"headers":"flat"}`, string(b))
+}
+
+func TestValidateReplyProfile(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(ValidateReplyProfile(""))
+	assert.NoError(ValidateReplyProfile(ReplyProfileCurrent))
+	assert.NoError(ValidateReplyProfile(ReplyProfileLegacy))
+	assert.Regexp("Unknown reply profile 'other'", ValidateReplyProfile("other"))
+}
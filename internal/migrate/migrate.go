@@ -0,0 +1,290 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Legacy kaleido-io/ethconnect releases used these prefixes for the HTTP query
+	// parameters (kld-from) and headers (x-kaleido-from)
+	legacyPrefixShort = "kld"
+	legacyPrefixLong  = "kaleido"
+)
+
+// legacyEventKeyPrefixes maps the LevelDB key prefixes written by the kldevents package
+// to the record type now stored under that prefix
+var legacyEventKeyPrefixes = map[string]string{
+	"es-": "stream",
+	"sb-": "subscription",
+	"cp-": "checkpoint",
+}
+
+// MigrateConf configures a migration from a legacy deployment
+type MigrateConf struct {
+	LegacyContractsPath string `json:"legacyContractsPath"`
+	ContractsPath       string `json:"contractsPath"`
+	LegacyEventsDBPath  string `json:"legacyEventsDB"`
+	EventsDBPath        string `json:"eventsDB"`
+	DryRun              bool   `json:"dryRun,omitempty"`
+}
+
+// MigrateResult summarizes the records migrated
+type MigrateResult struct {
+	Contracts       int `json:"contracts"`
+	ABIs            int `json:"abis"`
+	LegacyContracts int `json:"legacyContracts"`
+	Streams         int `json:"streams"`
+	Subscriptions   int `json:"subscriptions"`
+	Checkpoints     int `json:"checkpoints"`
+	Existing        int `json:"existing"`
+	Skipped         int `json:"skipped"`
+}
+
+// Migrator converts the contract store and event stream database of a legacy
+// kaleido-io/ethconnect deployment to the current layout
+type Migrator struct {
+	conf MigrateConf
+}
+
+// NewMigrator constructor
+func NewMigrator() *Migrator {
+	return &Migrator{}
+}
+
+// EnableCompatibilityMode switches the HTTP query parameter and header prefixes back to
+// those used by legacy releases, unless they have been set explicitly in the environment
+func EnableCompatibilityMode() {
+	if os.Getenv("PREFIX_SHORT") == "" {
+		os.Setenv("PREFIX_SHORT", legacyPrefixShort)
+	}
+	if os.Getenv("PREFIX_LONG") == "" {
+		os.Setenv("PREFIX_LONG", legacyPrefixLong)
+	}
+	log.Infof("Legacy compatibility mode enabled. Query param prefix=%s Header prefix=x-%s", os.Getenv("PREFIX_SHORT"), os.Getenv("PREFIX_LONG"))
+}
+
+// CobraInit initializes the migrate command
+func (m *Migrator) CobraInit() (cmd *cobra.Command) {
+	cmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the contracts and event streams of a legacy kaleido-io/ethconnect deployment",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			_, err = m.Migrate()
+			return
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			err = m.ValidateConf()
+			return
+		},
+	}
+	cmd.Flags().StringVarP(&m.conf.LegacyContractsPath, "legacy-openapi-path", "", "", "Path containing the contracts and ABIs of the legacy deployment")
+	cmd.Flags().StringVarP(&m.conf.ContractsPath, "openapi-path", "", "", "Path to migrate the contracts and ABIs to")
+	cmd.Flags().StringVarP(&m.conf.LegacyEventsDBPath, "legacy-events-db", "", "", "Level DB location of the event streams of the legacy deployment")
+	cmd.Flags().StringVarP(&m.conf.EventsDBPath, "events-db", "", "", "Level DB location to migrate the event streams to")
+	cmd.Flags().BoolVarP(&m.conf.DryRun, "dry-run", "", false, "Report what would be migrated, without writing anything")
+	return
+}
+
+// SetConf sets the configuration
+func (m *Migrator) SetConf(conf *MigrateConf) {
+	m.conf = *conf
+}
+
+// ValidateConf validates the configuration
+func (m *Migrator) ValidateConf() error {
+	if m.conf.LegacyContractsPath == "" && m.conf.LegacyEventsDBPath == "" {
+		return errors.Errorf(errors.MigrateNothingToMigrate)
+	}
+	if m.conf.LegacyContractsPath != "" && m.conf.ContractsPath == "" {
+		return errors.Errorf(errors.MigrateMissingTarget, "legacy-openapi-path", "openapi-path")
+	}
+	if m.conf.LegacyEventsDBPath != "" && m.conf.EventsDBPath == "" {
+		return errors.Errorf(errors.MigrateMissingTarget, "legacy-events-db", "events-db")
+	}
+	if m.conf.LegacyContractsPath != "" && m.conf.LegacyContractsPath == m.conf.ContractsPath {
+		return errors.Errorf(errors.MigrateSameLocation, m.conf.ContractsPath)
+	}
+	if m.conf.LegacyEventsDBPath != "" && m.conf.LegacyEventsDBPath == m.conf.EventsDBPath {
+		return errors.Errorf(errors.MigrateSameLocation, m.conf.EventsDBPath)
+	}
+	return nil
+}
+
+// Migrate copies all records from the legacy locations that do not already exist in the
+// new locations. The legacy locations are not modified
+func (m *Migrator) Migrate() (*MigrateResult, error) {
+	result := &MigrateResult{}
+	if m.conf.LegacyContractsPath != "" {
+		legacy := contractregistry.NewFSArtifactStore(m.conf.LegacyContractsPath)
+		if err := os.MkdirAll(m.conf.ContractsPath, 0755); err != nil {
+			return nil, errors.Errorf(errors.MigrateFailed, m.conf.ContractsPath, err)
+		}
+		target := contractregistry.NewFSArtifactStore(m.conf.ContractsPath)
+		if err := m.migrateContracts(legacy, target, result); err != nil {
+			return nil, err
+		}
+	}
+	if m.conf.LegacyEventsDBPath != "" {
+		legacy, err := kvstore.NewLDBKeyValueStore(m.conf.LegacyEventsDBPath)
+		if err != nil {
+			return nil, errors.Errorf(errors.MigrateFailed, m.conf.LegacyEventsDBPath, err)
+		}
+		defer legacy.Close()
+		target, err := kvstore.NewLDBKeyValueStore(m.conf.EventsDBPath)
+		if err != nil {
+			return nil, errors.Errorf(errors.MigrateFailed, m.conf.EventsDBPath, err)
+		}
+		defer target.Close()
+		if err := m.migrateEvents(legacy, target, result); err != nil {
+			return nil, err
+		}
+	}
+	log.Infof("Migration complete (dryRun=%t). Contracts=%d ABIs=%d LegacyContracts=%d Streams=%d Subscriptions=%d Checkpoints=%d Existing=%d Skipped=%d",
+		m.conf.DryRun, result.Contracts, result.ABIs, result.LegacyContracts, result.Streams, result.Subscriptions, result.Checkpoints, result.Existing, result.Skipped)
+	return result, nil
+}
+
+func (m *Migrator) migrateContracts(legacy, target contractregistry.ArtifactStore, result *MigrateResult) error {
+	for _, artifactType := range []contractregistry.ArtifactType{
+		contractregistry.ContractInstanceArtifact,
+		contractregistry.ABIDeployArtifact,
+		contractregistry.LegacySwaggerArtifact,
+	} {
+		entries, err := legacy.List(artifactType)
+		if err != nil {
+			return errors.Errorf(errors.MigrateFailed, m.conf.LegacyContractsPath, err)
+		}
+		for _, entry := range entries {
+			if _, err := target.Get(artifactType, entry.ID); err == nil {
+				log.Infof("Contract artifact %s already exists in %s", entry.ID, m.conf.ContractsPath)
+				result.Existing++
+				continue
+			}
+			b, err := legacy.Get(artifactType, entry.ID)
+			if err == nil {
+				b, err = convertArtifact(artifactType, b)
+			}
+			if err != nil {
+				log.Warnf("Skipping contract artifact %s: %s", entry.ID, err)
+				result.Skipped++
+				continue
+			}
+			if !m.conf.DryRun {
+				if err := target.Put(artifactType, entry.ID, b); err != nil {
+					return errors.Errorf(errors.MigrateFailed, m.conf.ContractsPath, err)
+				}
+			}
+			switch artifactType {
+			case contractregistry.ContractInstanceArtifact:
+				result.Contracts++
+			case contractregistry.ABIDeployArtifact:
+				result.ABIs++
+			default:
+				// Legacy Swagger files are converted to contract instances by the
+				// contract store, the first time the gateway starts
+				result.LegacyContracts++
+			}
+		}
+	}
+	return nil
+}
+
+// convertArtifact parses a legacy artifact, and serializes it in the current format
+func convertArtifact(artifactType contractregistry.ArtifactType, b []byte) ([]byte, error) {
+	var v interface{}
+	switch artifactType {
+	case contractregistry.ContractInstanceArtifact:
+		v = &contractregistry.ContractInfo{}
+	case contractregistry.ABIDeployArtifact:
+		v = &messages.DeployContract{}
+	default:
+		// Legacy Swagger definitions are copied as-is
+		return b, json.Unmarshal(b, &v)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func (m *Migrator) migrateEvents(legacy, target kvstore.KVStore, result *MigrateResult) error {
+	it := legacy.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		recordType := legacyEventKeyPrefixes[key[:strings.Index(key, "-")+1]]
+		if recordType == "" {
+			log.Warnf("Skipping unknown event stream record %s", key)
+			result.Skipped++
+			continue
+		}
+		if _, err := target.Get(key); err == nil {
+			log.Infof("Event stream record %s already exists in %s", key, m.conf.EventsDBPath)
+			result.Existing++
+			continue
+		}
+		b, err := convertEventRecord(recordType, it.Value())
+		if err != nil {
+			log.Warnf("Skipping %s %s: %s", recordType, key, err)
+			result.Skipped++
+			continue
+		}
+		if !m.conf.DryRun {
+			if err := target.Put(key, b); err != nil {
+				return errors.Errorf(errors.MigrateFailed, m.conf.EventsDBPath, err)
+			}
+		}
+		switch recordType {
+		case "stream":
+			result.Streams++
+		case "subscription":
+			result.Subscriptions++
+		default:
+			result.Checkpoints++
+		}
+	}
+	return nil
+}
+
+// convertEventRecord parses a legacy event stream record, and serializes it in the current format
+func convertEventRecord(recordType string, b []byte) ([]byte, error) {
+	var v interface{}
+	switch recordType {
+	case "stream":
+		v = &events.StreamInfo{}
+	case "subscription":
+		v = &events.SubscriptionInfo{}
+	default:
+		v = &map[string]*big.Int{}
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
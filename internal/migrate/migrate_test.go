@@ -0,0 +1,199 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
+	"github.com/hyperledger/firefly-ethconnect/internal/events"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+)
+
+const testAddr = "0123456789abcdef0123456789abcdef01234567"
+
+func tempdir() string {
+	dir, _ := ioutil.TempDir("", "fly")
+	return dir
+}
+
+func newTestLegacyDeployment(t *testing.T, dir string) {
+	contracts := path.Join(dir, "legacy-contracts")
+	os.MkdirAll(contracts, 0755)
+	ioutil.WriteFile(path.Join(contracts, "contract_"+testAddr+".instance.json"), []byte(`{"address":"`+testAddr+`","path":"/contracts/c1","abi":"abi1","openapi":"http://localhost/contracts/c1?swagger","registeredAs":"c1"}`), 0644)
+	ioutil.WriteFile(path.Join(contracts, "abi_abi1.deploy.json"), []byte(`{"headers":{"type":"DeployContract","id":"abi1"},"contractName":"Store","abi":[]}`), 0644)
+	ioutil.WriteFile(path.Join(contracts, "abi_abi2.deploy.json"), []byte(`!json`), 0644)
+	ioutil.WriteFile(path.Join(contracts, "contract_1123456789abcdef0123456789abcdef01234567.swagger.json"), []byte(`{"swagger":"2.0"}`), 0644)
+
+	db, err := kvstore.NewLDBKeyValueStore(path.Join(dir, "legacy-events"))
+	assert.NoError(t, err)
+	defer db.Close()
+	db.Put("es-1", []byte(`{"id":"es-1","path":"/eventstreams/es-1","type":"webhook","webhook":{"url":"http://example.com"}}`))
+	db.Put("sb-1", []byte(`{"id":"sb-1","path":"/subscriptions/sb-1","stream":"es-1","event":{"name":"Changed","type":"event"}}`))
+	db.Put("sb-2", []byte(`!json`))
+	db.Put("cp-es-1", []byte(`{"sb-1":12345}`))
+	db.Put("other", []byte(`{}`))
+}
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer os.RemoveAll(dir)
+	newTestLegacyDeployment(t, dir)
+
+	m := NewMigrator()
+	m.SetConf(&MigrateConf{
+		LegacyContractsPath: path.Join(dir, "legacy-contracts"),
+		ContractsPath:       path.Join(dir, "contracts"),
+		LegacyEventsDBPath:  path.Join(dir, "legacy-events"),
+		EventsDBPath:        path.Join(dir, "events"),
+	})
+	assert.NoError(m.ValidateConf())
+	result, err := m.Migrate()
+	assert.NoError(err)
+	assert.Equal(&MigrateResult{
+		Contracts:       1,
+		ABIs:            1,
+		LegacyContracts: 1,
+		Streams:         1,
+		Subscriptions:   1,
+		Checkpoints:     1,
+		Skipped:         3,
+	}, result)
+
+	store := contractregistry.NewFSArtifactStore(path.Join(dir, "contracts"))
+	b, err := store.Get(contractregistry.ContractInstanceArtifact, testAddr)
+	assert.NoError(err)
+	var info contractregistry.ContractInfo
+	assert.NoError(json.Unmarshal(b, &info))
+	assert.Equal("c1", info.RegisteredAs)
+	_, err = store.Get(contractregistry.LegacySwaggerArtifact, "1123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+
+	db, err := kvstore.NewLDBKeyValueStore(path.Join(dir, "events"))
+	assert.NoError(err)
+	b, err = db.Get("sb-1")
+	assert.NoError(err)
+	var sub events.SubscriptionInfo
+	assert.NoError(json.Unmarshal(b, &sub))
+	assert.Equal("es-1", sub.Stream)
+	b, err = db.Get("cp-es-1")
+	assert.NoError(err)
+	assert.JSONEq(`{"sb-1":12345}`, string(b))
+	_, err = db.Get("other")
+	assert.Error(err)
+	db.Close()
+
+	// A second migration does not overwrite the records that already exist
+	result, err = m.Migrate()
+	assert.NoError(err)
+	assert.Equal(6, result.Existing)
+	assert.Equal(0, result.Contracts)
+	assert.Equal(0, result.Streams)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer os.RemoveAll(dir)
+	newTestLegacyDeployment(t, dir)
+
+	m := NewMigrator()
+	m.SetConf(&MigrateConf{
+		LegacyContractsPath: path.Join(dir, "legacy-contracts"),
+		ContractsPath:       path.Join(dir, "contracts"),
+		LegacyEventsDBPath:  path.Join(dir, "legacy-events"),
+		EventsDBPath:        path.Join(dir, "events"),
+		DryRun:              true,
+	})
+	result, err := m.Migrate()
+	assert.NoError(err)
+	assert.Equal(1, result.Contracts)
+	assert.Equal(1, result.Streams)
+
+	entries, err := contractregistry.NewFSArtifactStore(path.Join(dir, "contracts")).List(contractregistry.ContractInstanceArtifact)
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestMigrateErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, "file"), []byte{}, 0644)
+
+	m := NewMigrator()
+	m.SetConf(&MigrateConf{LegacyContractsPath: path.Join(dir, "missing"), ContractsPath: path.Join(dir, "contracts")})
+	_, err := m.Migrate()
+	assert.Regexp("Migration failed for .*missing", err)
+
+	m.SetConf(&MigrateConf{LegacyContractsPath: dir, ContractsPath: path.Join(dir, "file", "contracts")})
+	_, err = m.Migrate()
+	assert.Regexp("Migration failed for .*contracts", err)
+
+	m.SetConf(&MigrateConf{LegacyEventsDBPath: path.Join(dir, "file"), EventsDBPath: path.Join(dir, "events")})
+	_, err = m.Migrate()
+	assert.Regexp("Migration failed for .*file", err)
+
+	m.SetConf(&MigrateConf{LegacyEventsDBPath: path.Join(dir, "legacy-events"), EventsDBPath: path.Join(dir, "file")})
+	_, err = m.Migrate()
+	assert.Regexp("Migration failed for .*file", err)
+}
+
+func TestValidateConf(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMigrator()
+	assert.Regexp("No legacy contracts path or events database to migrate", m.ValidateConf())
+	m.SetConf(&MigrateConf{LegacyContractsPath: "a"})
+	assert.Regexp("The --legacy-openapi-path must be migrated to an --openapi-path", m.ValidateConf())
+	m.SetConf(&MigrateConf{LegacyEventsDBPath: "a"})
+	assert.Regexp("The --legacy-events-db must be migrated to an --events-db", m.ValidateConf())
+	m.SetConf(&MigrateConf{LegacyContractsPath: "a", ContractsPath: "a"})
+	assert.Regexp("Cannot migrate a to itself", m.ValidateConf())
+	m.SetConf(&MigrateConf{LegacyEventsDBPath: "a", EventsDBPath: "a"})
+	assert.Regexp("Cannot migrate a to itself", m.ValidateConf())
+}
+
+func TestCobraInit(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMigrator()
+	cmd := m.CobraInit()
+	cmd.SetArgs([]string{})
+	err := cmd.Execute()
+	assert.Regexp("No legacy contracts path", err)
+
+	dir := tempdir()
+	defer os.RemoveAll(dir)
+	newTestLegacyDeployment(t, dir)
+	cmd.SetArgs([]string{"--legacy-events-db", path.Join(dir, "legacy-events"), "--events-db", path.Join(dir, "events")})
+	assert.NoError(cmd.Execute())
+}
+
+func TestEnableCompatibilityMode(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Unsetenv("PREFIX_SHORT")
+	defer os.Unsetenv("PREFIX_LONG")
+
+	os.Setenv("PREFIX_LONG", "custom")
+	EnableCompatibilityMode()
+	assert.Equal("kld", os.Getenv("PREFIX_SHORT"))
+	assert.Equal("custom", os.Getenv("PREFIX_LONG"))
+}
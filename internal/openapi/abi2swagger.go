@@ -112,7 +112,7 @@ func (c *ABI2Swagger) convert(basePath, name string, abi *ethbinding.ABI, devdoc
 
 func (c *ABI2Swagger) buildDefinitionsAndPaths(inst, factoryOnly, externalRegistry bool, abi *ethbinding.ABI, defs map[string]spec.Schema, paths map[string]spec.PathItem, devdocs gjson.Result) {
 	methodsDocs := devdocs.Get("methods")
-	if !inst {
+	if !inst && !IsEventsOnly(abi) {
 		c.buildMethodDefinitionsAndPath(inst, defs, paths, "constructor", abi.Constructor, methodsDocs)
 	}
 	if !factoryOnly {
@@ -145,6 +145,13 @@ func (c *ABI2Swagger) buildDefinitionsAndPaths(inst, factoryOnly, externalRegist
 	defs["error"] = errSchema
 }
 
+// IsEventsOnly returns true for an ABI that only declares events, such as a log-only contract,
+// or a third party contract that is only of interest for its events. There is nothing to deploy
+// or call, so only the event subscription paths are generated
+func IsEventsOnly(abi *ethbinding.ABI) bool {
+	return len(abi.Events) > 0 && len(abi.Methods) == 0 && len(abi.Constructor.Inputs) == 0 && !abi.HasFallback() && !abi.HasReceive()
+}
+
 func (c *ABI2Swagger) getDeclaredIDDetails(inst bool, declaredID string, inputs ethbinding.ABIArguments, devdocs gjson.Result) (bool, string, string, gjson.Result) {
 	sig := declaredID
 	constructor := (declaredID == "constructor")
@@ -265,7 +272,7 @@ func (c *ABI2Swagger) getCommonParameters() map[string]spec.Parameter {
 	}
 	params["fromParam"] = spec.Parameter{
 		ParamProps: spec.ParamProps{
-			Description: fmt.Sprintf("The 'from' address (header: x-%s-from)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Description: fmt.Sprintf("The 'from' address (header: x-%s-from). Queries are not signed, so can use any address, or 'zero' for the zero address", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
 			Name:        fmt.Sprintf("%s-from", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
 			In:          "query",
 			Required:    false,
@@ -310,6 +317,30 @@ func (c *ABI2Swagger) getCommonParameters() map[string]spec.Parameter {
 			Type: "integer",
 		},
 	}
+	params["maxfeeParam"] = spec.Parameter{
+		ParamProps: spec.ParamProps{
+			Description:     fmt.Sprintf("Maximum fee per gas for an EIP-1559 transaction, instead of a gas price (header: x-%s-maxfee)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Name:            fmt.Sprintf("%s-maxfee", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
+			In:              "query",
+			Required:        false,
+			AllowEmptyValue: true,
+		},
+		SimpleSchema: spec.SimpleSchema{
+			Type: "integer",
+		},
+	}
+	params["priorityfeeParam"] = spec.Parameter{
+		ParamProps: spec.ParamProps{
+			Description:     fmt.Sprintf("Maximum priority fee per gas for an EIP-1559 transaction (header: x-%s-priorityfee)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Name:            fmt.Sprintf("%s-priorityfee", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
+			In:              "query",
+			Required:        false,
+			AllowEmptyValue: true,
+		},
+		SimpleSchema: spec.SimpleSchema{
+			Type: "integer",
+		},
+	}
 	params["syncParam"] = spec.Parameter{
 		ParamProps: spec.ParamProps{
 			Description:     fmt.Sprintf("Block the HTTP request until the tx is mined (does not store the receipt) (header: x-%s-sync)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
@@ -323,6 +354,18 @@ func (c *ABI2Swagger) getCommonParameters() map[string]spec.Parameter {
 			Default: true,
 		},
 	}
+	params["timeoutParam"] = spec.Parameter{
+		ParamProps: spec.ParamProps{
+			Description:     fmt.Sprintf("Seconds before the request stops waiting for the node, or for the receipt of a sync request (header: x-%s-timeout)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Name:            fmt.Sprintf("%s-timeout", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
+			In:              "query",
+			Required:        false,
+			AllowEmptyValue: true,
+		},
+		SimpleSchema: spec.SimpleSchema{
+			Type: "number",
+		},
+	}
 	params["acktypeParam"] = spec.Parameter{
 		ParamProps: spec.ParamProps{
 			Description:     fmt.Sprintf("Set to 'receipt' to store a receipt before acknowledging an async request (header: x-%s-acktype)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
@@ -433,6 +476,8 @@ func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstru
 	valueParam, _ := spec.NewRef("#/parameters/valueParam")
 	gasParam, _ := spec.NewRef("#/parameters/gasParam")
 	gaspriceParam, _ := spec.NewRef("#/parameters/gaspriceParam")
+	maxfeeParam, _ := spec.NewRef("#/parameters/maxfeeParam")
+	priorityfeeParam, _ := spec.NewRef("#/parameters/priorityfeeParam")
 	syncParam, _ := spec.NewRef("#/parameters/syncParam")
 	callParam, _ := spec.NewRef("#/parameters/callParam")
 	privateFromParam, _ := spec.NewRef("#/parameters/privateFromParam")
@@ -442,6 +487,7 @@ func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstru
 	blocknumberParam, _ := spec.NewRef("#/parameters/blocknumberParam")
 	acktypeParam, _ := spec.NewRef("#/parameters/acktypeParam")
 	transactionParam, _ := spec.NewRef("#/parameters/transactionParam")
+	timeoutParam, _ := spec.NewRef("#/parameters/timeoutParam")
 	op.Parameters = append(op.Parameters, spec.Parameter{
 		Refable: spec.Refable{
 			Ref: idParam,
@@ -467,6 +513,11 @@ func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstru
 			Ref: gaspriceParam,
 		},
 	})
+	op.Parameters = append(op.Parameters, spec.Parameter{
+		Refable: spec.Refable{
+			Ref: timeoutParam,
+		},
+	})
 	if isPOST {
 		op.Parameters = append(op.Parameters, spec.Parameter{
 			Refable: spec.Refable{
@@ -478,6 +529,16 @@ func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstru
 				Ref: callParam,
 			},
 		})
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			Refable: spec.Refable{
+				Ref: maxfeeParam,
+			},
+		})
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			Refable: spec.Refable{
+				Ref: priorityfeeParam,
+			},
+		})
 		op.Parameters = append(op.Parameters, spec.Parameter{
 			Refable: spec.Refable{
 				Ref: privateFromParam,
@@ -148,3 +148,31 @@ func TestABI2SwaggerUnnamedInputsABI(t *testing.T) {
 	assert.NotNil(swagger.SecurityDefinitions)
 	return
 }
+
+func TestABI2SwaggerEventsOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{
+		ExternalHost:     "localhost",
+		ExternalRootPath: "/contracts",
+	})
+	abi, err := ethbind.API.JSON(strings.NewReader(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":false,"name":"message","type":"string"}],"name":"Logged","type":"event"}]`))
+	assert.NoError(err)
+	assert.True(IsEventsOnly(&abi))
+
+	swagger := c.Gen4Factory("/logger", "logger", false, false, &abi, "")
+	assert.Equal(3, len(swagger.Paths.Paths))
+	assert.NotContains(swagger.Paths.Paths, "/")
+	assert.Contains(swagger.Paths.Paths, "/{address}")
+	assert.Contains(swagger.Paths.Paths, "/{address}/Logged/subscribe")
+	assert.Contains(swagger.Paths.Paths, "/Logged/subscribe")
+	assert.Contains(swagger.Definitions, "Logged_event")
+
+	swagger = c.Gen4Instance("/0x0123456789abcdef0123456789abcdef0123456", "logger", &abi, "")
+	assert.Equal(1, len(swagger.Paths.Paths))
+	assert.Contains(swagger.Paths.Paths, "/Logged/subscribe")
+
+	abi, err = ethbind.API.JSON(strings.NewReader(erc20ABI))
+	assert.NoError(err)
+	assert.False(IsEventsOnly(&abi))
+}
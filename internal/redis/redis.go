@@ -0,0 +1,240 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPort    = "6379"
+	defaultTimeout = 5 * time.Second
+)
+
+// Client is a minimal client for the Redis serialization protocol (RESP), sufficient to run commands
+// and scripts that return strings, integers and arrays of them
+type Client interface {
+	// Do runs a command, returning a string, int64, []interface{} or nil reply
+	Do(ctx context.Context, args ...string) (interface{}, error)
+	Close()
+}
+
+type client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	useTLS   bool
+	timeout  time.Duration
+	mux      sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// redisError is an error reply returned by Redis
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// NewClient creates a client for a redis:// or rediss:// (TLS) URL of the form
+// redis://[[user]:password@]host[:port][/db]. The connection is made on first use,
+// and re-made after any failure
+func NewClient(redisURL string, timeout time.Duration) (Client, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, errors.Errorf(errors.RedisBadURL, redisURL, err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, errors.Errorf(errors.RedisBadURL, redisURL, "scheme must be redis or rediss")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Errorf(errors.RedisBadURL, redisURL, "missing host")
+	}
+	c := &client{
+		addr:    u.Host,
+		useTLS:  u.Scheme == "rediss",
+		timeout: timeout,
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, errors.Errorf(errors.RedisBadURL, redisURL, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *client) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	if c.password != "" {
+		auth := []string{"AUTH", c.password}
+		if c.username != "" {
+			auth = []string{"AUTH", c.username, c.password}
+		}
+		if _, err = c.roundTrip(ctx, auth); err != nil {
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err = c.roundTrip(ctx, []string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			return err
+		}
+	}
+	log.Debugf("Connected to Redis at %s", c.addr)
+	return nil
+}
+
+func (c *client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var err error
+	if c.conn == nil {
+		err = c.connect(ctx)
+	}
+	var reply interface{}
+	if err == nil {
+		reply, err = c.roundTrip(ctx, args)
+	}
+	if err != nil {
+		if _, isReplyErr := err.(redisError); !isReplyErr {
+			// The state of the connection is unknown, so it is re-made on the next request
+			c.closeConn()
+		}
+		return nil, errors.Errorf(errors.RedisRequestFailed, err)
+	}
+	return reply, nil
+}
+
+func (c *client) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.reader)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.Errorf(errors.RedisUnexpectedReply, line)
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		i, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf(errors.RedisUnexpectedReply, line)
+		}
+		return i, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Errorf(errors.RedisUnexpectedReply, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Errorf(errors.RedisUnexpectedReply, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, errors.Errorf(errors.RedisUnexpectedReply, line)
+	}
+}
+
+func (c *client) closeConn() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.reader = nil
+	}
+}
+
+func (c *client) Close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.closeConn()
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultGzipMinSize is the smallest response body that is compressed, when not configured
+	DefaultGzipMinSize = 1024
+)
+
+// acceptsGzip checks an Accept-Encoding header for gzip, or any encoding, without a zero quality
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		rejected := false
+		for _, p := range params[1:] {
+			p = strings.ReplaceAll(p, " ", "")
+			if strings.HasPrefix(p, "q=") && strings.Trim(strings.TrimPrefix(p, "q="), "0.") == "" {
+				rejected = true
+			}
+		}
+		if !rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the body until it reaches the minimum size, so that
+// small responses are sent uncompressed, then compresses the rest of it as it is written
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize     int
+	status      int
+	buf         []byte
+	gz          *gzip.Writer
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start sends the headers, and the body held back so far, compressing it unless the
+// handler has already set its own encoding
+func (w *gzipResponseWriter) start() error {
+	h := w.ResponseWriter.Header()
+	if h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	} else {
+		w.passthrough = true
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close completes the compressed body, or sends a body below the minimum size uncompressed
+func (w *gzipResponseWriter) close() {
+	switch {
+	case w.gz != nil:
+		_ = w.gz.Close()
+	case w.passthrough:
+	case w.status != 0:
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		if len(w.buf) > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf)
+		}
+	}
+}
+
+// newGzipHandler compresses responses of at least minSize bytes for clients that accept gzip.
+// WebSocket upgrades are passed straight through
+func newGzipHandler(parent http.Handler, minSize int) http.Handler {
+	if minSize == 0 {
+		minSize = DefaultGzipMinSize
+	}
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") != "" {
+			parent.ServeHTTP(res, req)
+			return
+		}
+		res.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(req.Header.Get("Accept-Encoding")) {
+			parent.ServeHTTP(res, req)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: res, minSize: minSize}
+		defer gw.close()
+		parent.ServeHTTP(gw, req)
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGzipRequest(handler http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/test", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(acceptsGzip("gzip"))
+	assert.True(acceptsGzip("deflate, GZIP;q=0.8"))
+	assert.True(acceptsGzip("*"))
+	assert.True(acceptsGzip("gzip; q=1.0"))
+	assert.False(acceptsGzip(""))
+	assert.False(acceptsGzip("deflate, br"))
+	assert.False(acceptsGzip("gzip;q=0"))
+	assert.False(acceptsGzip("gzip; q=0.000"))
+}
+
+func TestGzipHandlerCompressesLargeResponses(t *testing.T) {
+	assert := assert.New(t)
+	body := strings.Repeat(`{"hello":"world"}`, 100)
+	handler := newGzipHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		res.Header().Set("Content-Length", "1700")
+		res.WriteHeader(201)
+		_, _ = res.Write([]byte(body[:100]))
+		_, _ = res.Write([]byte(body[100:]))
+	}), 0)
+
+	res := testGzipRequest(handler, "gzip, deflate")
+	assert.Equal(201, res.Code)
+	assert.Equal("gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal("Accept-Encoding", res.Header().Get("Vary"))
+	assert.Equal("", res.Header().Get("Content-Length"))
+	assert.Less(res.Body.Len(), len(body))
+	gz, err := gzip.NewReader(res.Body)
+	assert.NoError(err)
+	b, err := ioutil.ReadAll(gz)
+	assert.NoError(err)
+	assert.Equal(body, string(b))
+
+	res = testGzipRequest(handler, "")
+	assert.Equal(201, res.Code)
+	assert.Equal("", res.Header().Get("Content-Encoding"))
+	assert.Equal(body, res.Body.String())
+}
+
+func TestGzipHandlerSmallResponseUncompressed(t *testing.T) {
+	assert := assert.New(t)
+	handler := newGzipHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(404)
+		_, _ = res.Write([]byte(`{"error":"not found"}`))
+	}), 100)
+
+	res := testGzipRequest(handler, "gzip")
+	assert.Equal(404, res.Code)
+	assert.Equal("", res.Header().Get("Content-Encoding"))
+	assert.Equal(`{"error":"not found"}`, res.Body.String())
+}
+
+func TestGzipHandlerEmptyResponse(t *testing.T) {
+	assert := assert.New(t)
+	handler := newGzipHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(204)
+	}), 10)
+
+	res := testGzipRequest(handler, "gzip")
+	assert.Equal(204, res.Code)
+	assert.Equal(0, res.Body.Len())
+}
+
+func TestGzipHandlerAlreadyEncoded(t *testing.T) {
+	assert := assert.New(t)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte(strings.Repeat("a", 100)))
+	_ = gz.Close()
+	handler := newGzipHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Encoding", "gzip")
+		_, _ = res.Write(compressed.Bytes())
+	}), 10)
+
+	res := testGzipRequest(handler, "gzip")
+	assert.Equal(200, res.Code)
+	assert.Equal(compressed.Bytes(), res.Body.Bytes())
+}
+
+func TestGzipHandlerWebSocketUpgrade(t *testing.T) {
+	assert := assert.New(t)
+	handler := newGzipHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, isRecorder := res.(*httptest.ResponseRecorder)
+		assert.True(isRecorder)
+		_, _ = res.Write([]byte(strings.Repeat("a", 100)))
+	}), 10)
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Upgrade", "websocket")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal("", res.Header().Get("Content-Encoding"))
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// recoveredMsgContext is the context of a transaction that was in-flight before a restart,
+// which stores its reply in the receipt store, as the original requester is no longer connected
+type recoveredMsgContext struct {
+	receipts     *receiptStore
+	headers      *messages.CommonHeaders
+	timeReceived time.Time
+}
+
+// newRecoveryContextFactory returns contexts for recovered transactions, skipping those
+// that already have a reply in the receipt store
+func newRecoveryContextFactory(receipts *receiptStore) tx.RecoveryContextFactory {
+	return func(record *tx.InflightRecord) tx.TxnContext {
+		if receipts.persistence != nil && record.Headers.ID != "" {
+			existing, err := receipts.persistence.GetReceipt(record.Headers.ID)
+			if err != nil {
+				log.Warnf("Failed to check receipt store for request %s: %s", record.Headers.ID, err)
+			} else if existing != nil {
+				if pending, _ := (*existing)["pending"].(bool); !pending {
+					return nil
+				}
+			}
+		}
+		timeReceived, err := time.Parse(time.RFC3339Nano, record.Submitted)
+		if err != nil {
+			timeReceived = time.Now().UTC()
+		}
+		headers := record.Headers
+		return &recoveredMsgContext{
+			receipts:     receipts,
+			headers:      &headers,
+			timeReceived: timeReceived,
+		}
+	}
+}
+
+// recoverInflight opens the store of in-flight transactions, and resumes tracking those
+// that were in-flight when the gateway last stopped
+func recoverInflight(path string, processor tx.TxnProcessor, receipts *receiptStore) error {
+	store, err := kvstore.NewLDBKeyValueStore(path)
+	if err != nil {
+		return errors.Errorf(errors.RESTGatewayInflightDBOpenFailed, err)
+	}
+	result, err := processor.RecoverInflight(store, newRecoveryContextFactory(receipts))
+	if err != nil {
+		store.Close()
+		return err
+	}
+	log.Infof("In-flight transactions recovered from %s: resumed=%d lost=%d skipped=%d nonces=%d", path, result.Resumed, result.Lost, result.Skipped, result.Nonces)
+	return nil
+}
+
+func (t *recoveredMsgContext) Context() context.Context {
+	return context.Background()
+}
+
+func (t *recoveredMsgContext) Headers() *messages.CommonHeaders {
+	return t.headers
+}
+
+func (t *recoveredMsgContext) Unmarshal(msg interface{}) error {
+	msgBytes, _ := json.Marshal(map[string]interface{}{"headers": t.headers})
+	return json.Unmarshal(msgBytes, msg)
+}
+
+func (t *recoveredMsgContext) SendErrorReply(status int, err error) {
+	t.SendErrorReplyWithTX(status, err, "")
+}
+
+func (t *recoveredMsgContext) SendErrorReplyWithGapFill(status int, err error, gapFillTxHash string, gapFillSucceeded bool) {
+	t.SendErrorReplyWithTX(status, err, "")
+}
+
+func (t *recoveredMsgContext) SendErrorReplyWithTX(status int, err error, txHash string) {
+	log.Warnf("Failed to process recovered message %s: %s", t, err)
+	origBytes, _ := json.Marshal(map[string]interface{}{"headers": t.headers})
+	errMsg := messages.NewErrorReply(err, origBytes)
+	errMsg.TXHash = txHash
+	t.Reply(errMsg)
+}
+
+func (t *recoveredMsgContext) Reply(replyMessage messages.ReplyWithHeaders) {
+	replyHeaders := replyMessage.ReplyHeaders()
+	replyHeaders.ID = utils.UUIDv4()
+	replyHeaders.Context = t.headers.Context
+	replyHeaders.ReqID = t.headers.ID
+	replyHeaders.ReqABIID = t.headers.ABIID
+	replyHeaders.Received = t.timeReceived.UTC().Format(time.RFC3339Nano)
+	replyHeaders.Elapsed = time.Now().UTC().Sub(t.timeReceived).Seconds()
+	msgBytes, _ := json.Marshal(&replyMessage)
+	t.receipts.processReply(msgBytes)
+}
+
+func (t *recoveredMsgContext) String() string {
+	return fmt.Sprintf("RecoveredMsgContext[%s/%s]", t.headers.MsgType, t.headers.ID)
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/hyperledger/firefly-ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRecoveryRecord() *tx.InflightRecord {
+	return &tx.InflightRecord{
+		Headers: messages.CommonHeaders{
+			ID:      "req1",
+			MsgType: messages.MsgTypeSendTransaction,
+			Context: map[string]interface{}{"ctx1": "val1"},
+		},
+		TransactionHash: "0x12345",
+		Submitted:       time.Now().UTC().Add(-1 * time.Minute).Format(time.RFC3339Nano),
+	}
+}
+
+func TestRecoveryContextReply(t *testing.T) {
+	assert := assert.New(t)
+	_, r, _ := newTestWebhooksDirect(1)
+	rs := newReceiptStore(&ReceiptStoreConf{}, r, nil)
+
+	txnContext := newRecoveryContextFactory(rs)(newTestRecoveryRecord())
+	assert.NotNil(txnContext)
+	assert.Equal("req1", txnContext.Headers().ID)
+	assert.Equal("RecoveredMsgContext[SendTransaction/req1]", txnContext.String())
+	assert.NoError(txnContext.Context().Err())
+
+	var msg messages.RequestCommon
+	assert.NoError(txnContext.Unmarshal(&msg))
+	assert.Equal("req1", msg.Headers.ID)
+
+	txHash := ethbind.API.HexToHash("0x12345")
+	reply := &messages.TransactionReceipt{TransactionHash: &txHash}
+	reply.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	txnContext.Reply(reply)
+
+	receipt, err := r.GetReceipt("req1")
+	assert.NoError(err)
+	assert.Equal(messages.MsgTypeTransactionSuccess, (*receipt)["headers"].(map[string]interface{})["type"])
+	assert.Equal("val1", (*receipt)["headers"].(map[string]interface{})["ctx"].(map[string]interface{})["ctx1"])
+	assert.Greater((*receipt)["headers"].(map[string]interface{})["timeElapsed"], float64(59))
+
+	// Now a reply is stored, the transaction is skipped
+	assert.Nil(newRecoveryContextFactory(rs)(newTestRecoveryRecord()))
+}
+
+func TestRecoveryContextErrorReply(t *testing.T) {
+	assert := assert.New(t)
+	_, r, _ := newTestWebhooksDirect(1)
+	rs := newReceiptStore(&ReceiptStoreConf{}, r, nil)
+	record := newTestRecoveryRecord()
+	record.Submitted = "bad date"
+
+	txnContext := newRecoveryContextFactory(rs)(record)
+	txnContext.SendErrorReplyWithTX(500, fmt.Errorf("pop"), "0x12345")
+
+	receipt, err := r.GetReceipt("req1")
+	assert.NoError(err)
+	assert.Equal(messages.MsgTypeError, (*receipt)["headers"].(map[string]interface{})["type"])
+	assert.Equal("pop", (*receipt)["errorMessage"])
+	assert.Equal("0x12345", (*receipt)["transactionHash"])
+
+	txnContext.SendErrorReply(500, fmt.Errorf("pop2"))
+	txnContext.SendErrorReplyWithGapFill(500, fmt.Errorf("pop3"), "", false)
+	receipt, _ = r.GetReceipt("req1")
+	assert.Equal("pop3", (*receipt)["errorMessage"])
+}
+
+func TestRecoveryContextPendingReceipt(t *testing.T) {
+	assert := assert.New(t)
+	_, r, _ := newTestWebhooksDirect(1)
+	rs := newReceiptStore(&ReceiptStoreConf{}, r, nil)
+	rs.writeAccepted("req1", "ack1", map[string]interface{}{"headers": map[string]interface{}{"id": "req1"}})
+
+	assert.NotNil(newRecoveryContextFactory(rs)(newTestRecoveryRecord()))
+}
+
+func TestRecoverInflight(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "inflight_test")
+	defer os.RemoveAll(dir)
+	_, r, p := newTestWebhooksDirect(1)
+	rs := newReceiptStore(&ReceiptStoreConf{}, r, nil)
+
+	err := recoverInflight(path.Join(dir, "inflight"), p, rs)
+	assert.NoError(err)
+	assert.NotNil(p.capturedStore)
+	assert.NotNil(p.capturedNewContext)
+	p.capturedStore.Close()
+}
+
+func TestRecoverInflightFail(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "inflight_test")
+	defer os.RemoveAll(dir)
+	_, r, p := newTestWebhooksDirect(1)
+	rs := newReceiptStore(&ReceiptStoreConf{}, r, nil)
+	p.recoverErr = fmt.Errorf("pop")
+
+	err := recoverInflight(path.Join(dir, "inflight"), p, rs)
+	assert.Regexp("pop", err)
+}
+
+func TestRecoverInflightBadPath(t *testing.T) {
+	assert := assert.New(t)
+	f, _ := ioutil.TempFile("", "inflight_test")
+	defer os.Remove(f.Name())
+	_, r, p := newTestWebhooksDirect(1)
+	rs := newReceiptStore(&ReceiptStoreConf{}, r, nil)
+
+	err := recoverInflight(f.Name(), p, rs)
+	assert.Regexp("Failed to open the in-flight transactions database", err)
+}
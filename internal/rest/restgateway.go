@@ -37,6 +37,7 @@ import (
 	"github.com/hyperledger/firefly-ethconnect/internal/ws"
 
 	"github.com/Shopify/sarama"
+	"github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -78,10 +79,12 @@ type RESTGatewayConf struct {
 	MemStore ReceiptStoreConf                         `json:"memstore"`
 	OpenAPI  contractgateway.SmartContractGatewayConf `json:"openapi"`
 	HTTP     struct {
-		LocalAddr string          `json:"localAddr"`
-		Port      int             `json:"port"`
-		TLS       utils.TLSConfig `json:"tls"`
+		LocalAddr   string          `json:"localAddr"`
+		Port        int             `json:"port"`
+		TLS         utils.TLSConfig `json:"tls"`
+		GzipMinSize int             `json:"gzipMinSize"`
 	} `json:"http"`
+	InflightDBPath string `json:"inflightDB,omitempty"`
 	WebhooksDirectConf
 }
 
@@ -98,6 +101,8 @@ type RESTGateway struct {
 	webhooks        *webhooks
 	smartContractGW contractgateway.SmartContractGateway
 	ws              ws.WebSocketServer
+	rpcBreaker      eth.RPCCircuitBreaker
+	solc            *eth.SolcConf
 }
 
 // Conf gets the config for this bridge
@@ -122,17 +127,24 @@ func (g *RESTGateway) ValidateConf() (err error) {
 	if g.conf.LevelDB.QueryLimit < 1 {
 		g.conf.LevelDB.QueryLimit = 100
 	}
-	if g.conf.OpenAPI.StoragePath != "" && g.conf.RPC.URL == "" {
+	if g.contractGatewayEnabled() && g.conf.RPC.URL == "" {
 		err = errors.Errorf(errors.ConfigRESTGatewayRequiredRPC)
 		return
 	}
+	err = tx.ValidateMessageTypes(&g.conf.TxnProcessorConf)
 	return
 }
 
+// contractGatewayEnabled is true if either a local path or an object store is configured for contracts
+func (g *RESTGateway) contractGatewayEnabled() bool {
+	return g.conf.OpenAPI.StoragePath != "" || g.conf.OpenAPI.Store != ""
+}
+
 // NewRESTGateway constructor
-func NewRESTGateway(printYAML *bool) (g *RESTGateway) {
+func NewRESTGateway(printYAML *bool, solc *eth.SolcConf) (g *RESTGateway) {
 	g = &RESTGateway{
 		printYAML:   printYAML,
+		solc:        solc,
 		sendCond:    sync.NewCond(&sync.Mutex{}),
 		pendingMsgs: make(map[string]bool),
 		successMsgs: make(map[string]*sarama.ProducerMessage),
@@ -178,6 +190,7 @@ func (g *RESTGateway) CobraInit(cmdName string) (cmd *cobra.Command) {
 	cmd.Flags().IntVarP(&g.conf.MaxInFlight, "maxinflight", "m", utils.DefInt("WEBHOOKS_MAX_INFLIGHT", 0), "Maximum messages to hold in-flight")
 	cmd.Flags().StringVarP(&g.conf.HTTP.LocalAddr, "listen-addr", "L", os.Getenv("WEBHOOKS_LISTEN_ADDR"), "Local address to listen on")
 	cmd.Flags().IntVarP(&g.conf.HTTP.Port, "listen-port", "l", utils.DefInt("WEBHOOKS_LISTEN_PORT", 8080), "Port to listen on")
+	cmd.Flags().IntVarP(&g.conf.HTTP.GzipMinSize, "gzip-min-size", "", utils.DefInt("WEBHOOKS_GZIP_MIN_SIZE", 0), "Smallest response in bytes to gzip for clients that accept it (0 for 1024, -1 to disable)")
 	cmd.Flags().StringVarP(&g.conf.MongoDB.URL, "mongodb-url", "M", os.Getenv("MONGODB_URL"), "MongoDB URL for a receipt store")
 	cmd.Flags().StringVarP(&g.conf.MongoDB.Database, "mongodb-database", "D", os.Getenv("MONGODB_DATABASE"), "MongoDB receipt store database")
 	cmd.Flags().StringVarP(&g.conf.MongoDB.Collection, "mongodb-receipt-collection", "R", os.Getenv("MONGODB_COLLECTION"), "MongoDB receipt store collection")
@@ -186,11 +199,14 @@ func (g *RESTGateway) CobraInit(cmdName string) (cmd *cobra.Command) {
 	cmd.Flags().IntVarP(&g.conf.MemStore.MaxDocs, "memstore-receipt-maxdocs", "v", utils.DefInt("MEMSTORE_MAXDOCS", 10), "In-memory receipt store capped size")
 	cmd.Flags().IntVarP(&g.conf.MemStore.QueryLimit, "memstore-query-limit", "V", utils.DefInt("MEMSTORE_QUERYLIM", 0), "In-memory maximum docs to return on a rest call")
 	cmd.Flags().IntVarP(&g.conf.LevelDB.QueryLimit, "leveldb-query-limit", "B", utils.DefInt("LEVELDB_QUERYLIM", 0), "Maximum docs to return on a rest call (cap on limit)")
+	cmd.Flags().StringVarP(&g.conf.InflightDBPath, "inflight-db", "", os.Getenv("INFLIGHT_DB"), "LevelDB path to record in-flight transactions in, so they are recovered after a restart")
 	return
 }
 
 type statusMsg struct {
-	OK bool `json:"ok"`
+	OK                bool                 `json:"ok"`
+	MessageTypes      []string             `json:"messageTypes,omitempty"`      // the message types processed, when restricted
+	RPCCircuitBreaker *eth.RPCBreakerState `json:"rpcCircuitBreaker,omitempty"` // the state of the JSON/RPC circuit breaker, when enabled
 }
 
 type errMsg struct {
@@ -198,7 +214,11 @@ type errMsg struct {
 }
 
 func (g *RESTGateway) statusHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
-	reply, _ := json.Marshal(&statusMsg{OK: true})
+	status := &statusMsg{OK: true, MessageTypes: g.conf.MessageTypes}
+	if g.rpcBreaker != nil {
+		status.RPCCircuitBreaker = g.rpcBreaker.State()
+	}
+	reply, _ := json.Marshal(status)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(200)
 	_, _ = res.Write(reply)
@@ -220,11 +240,14 @@ func (g *RESTGateway) DispatchMsgAsync(ctx context.Context, msg map[string]inter
 func (g *RESTGateway) newAccessTokenContextHandler(parent http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 
-		// Extract an access token from bearer token (only - no support for query params)
+		// Extract an access token from bearer token. Browsers cannot set headers on a WebSocket
+		// upgrade, so only for those requests we also accept an access_token query param
 		accessToken := ""
 		hSplit := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
 		if len(hSplit) == 2 && strings.ToLower(hSplit[0]) == "bearer" {
 			accessToken = hSplit[1]
+		} else if websocket.IsWebSocketUpgrade(req) {
+			accessToken = req.URL.Query().Get("access_token")
 		}
 		authCtx, err := auth.WithAuthContext(req.Context(), accessToken)
 		if err != nil {
@@ -255,19 +278,27 @@ func (g *RESTGateway) Start() (err error) {
 
 	var processor tx.TxnProcessor
 	var rpcClient eth.RPCClient
-	if g.conf.RPC.URL != "" || g.conf.OpenAPI.StoragePath != "" {
+	if g.conf.RPC.URL != "" || g.contractGatewayEnabled() {
 		rpcClient, err = eth.RPCConnect(&g.conf.RPC)
 		if err != nil {
 			return err
 		}
-		processor = tx.NewTxnProcessor(&g.conf.TxnProcessorConf, &g.conf.RPCConf)
+		g.rpcBreaker = eth.CircuitBreakerFor(rpcClient)
+		processor = tx.NewTxnProcessor(&g.conf.TxnProcessorConf, &g.conf.RPCConf, g.solc)
 		processor.Init(rpcClient)
+		if topic := g.conf.Lifecycle.KafkaTopic; topic != "" {
+			sink, err := kafka.NewKafkaLifecycleSink(&kafka.SaramaKafkaFactory{}, &g.conf.Kafka, topic)
+			if err != nil {
+				return err
+			}
+			processor.AddLifecycleSink(sink)
+		}
 	}
 
 	g.ws.AddRoutes(router)
 
-	if g.conf.OpenAPI.StoragePath != "" {
-		g.smartContractGW, err = contractgateway.NewSmartContractGateway(&g.conf.OpenAPI, &g.conf.TxnProcessorConf, rpcClient, processor, g, g.ws)
+	if g.contractGatewayEnabled() {
+		g.smartContractGW, err = contractgateway.NewSmartContractGateway(&g.conf.OpenAPI, &g.conf.TxnProcessorConf, g.solc, rpcClient, processor, g, g.ws)
 		if err != nil {
 			return err
 		}
@@ -305,14 +336,24 @@ func (g *RESTGateway) Start() (err error) {
 		g.webhooks = newWebhooks(wk, g.receipts, g.smartContractGW)
 	} else {
 		wd := newWebhooksDirect(&g.conf.WebhooksDirectConf, processor, g.receipts)
+		wd.rpcBreaker = g.rpcBreaker
 		g.webhooks = newWebhooks(wd, g.receipts, g.smartContractGW)
 	}
 	g.webhooks.addRoutes(router)
+	if g.conf.InflightDBPath != "" && processor != nil {
+		if err = recoverInflight(g.conf.InflightDBPath, processor, g.receipts); err != nil {
+			return err
+		}
+	}
 
+	handler := g.newAccessTokenContextHandler(router)
+	if g.conf.HTTP.GzipMinSize >= 0 {
+		handler = newGzipHandler(handler, g.conf.HTTP.GzipMinSize)
+	}
 	g.srv = &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", g.conf.HTTP.LocalAddr, g.conf.HTTP.Port),
 		TLSConfig:      tlsConfig,
-		Handler:        g.newAccessTokenContextHandler(router),
+		Handler:        handler,
 		MaxHeaderBytes: MaxHeaderSize,
 	}
 
@@ -27,6 +27,7 @@ import (
 
 	"github.com/hyperledger/firefly-ethconnect/internal/auth"
 	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 )
@@ -36,7 +37,7 @@ var lastPort = 9000
 func TestNewRESTGateway(t *testing.T) {
 	assert := assert.New(t)
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	var conf RESTGatewayConf
 	conf.HTTP.LocalAddr = "127.0.0.1"
 	g.SetConf(&conf)
@@ -46,7 +47,7 @@ func TestNewRESTGateway(t *testing.T) {
 func TestValidateConfInvalidArgs(t *testing.T) {
 	assert := assert.New(t)
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.MongoDB.URL = "mongodb://localhost:27017"
 	err := g.ValidateConf()
 	assert.Regexp("MongoDB URL, Database and Collection name must be specified to enable the receipt store", err)
@@ -55,10 +56,66 @@ func TestValidateConfInvalidArgs(t *testing.T) {
 func TestValidateConfInvalidOpenAPIArgs(t *testing.T) {
 	assert := assert.New(t)
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.OpenAPI.StoragePath = "/tmp/t"
 	err := g.ValidateConf()
-	assert.Regexp("RPC URL and Storage Path must be supplied to enable the Open API REST Gateway", err)
+	assert.Regexp("RPC URL and Storage Path or Store URL must be supplied to enable the Open API REST Gateway", err)
+}
+
+func TestValidateConfInvalidOpenAPIStoreArgs(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
+	g.conf.OpenAPI.Store = "s3://bucket/prefix"
+	err := g.ValidateConf()
+	assert.Regexp("RPC URL and Storage Path or Store URL must be supplied to enable the Open API REST Gateway", err)
+}
+
+func TestValidateConfInvalidMessageTypes(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
+	g.conf.MessageTypes = []string{"wrong"}
+	err := g.ValidateConf()
+	assert.Regexp("Invalid message type 'wrong'", err)
+}
+
+func TestStatusMessageTypes(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
+	g.conf.MessageTypes = []string{"deploycontract"}
+	assert.NoError(g.ValidateConf())
+
+	res := httptest.NewRecorder()
+	g.statusHandler(res, httptest.NewRequest("GET", "/status", nil), nil)
+	var statusResp statusMsg
+	err := json.NewDecoder(res.Body).Decode(&statusResp)
+	assert.NoError(err)
+	assert.True(statusResp.OK)
+	assert.Equal([]string{"DeployContract"}, statusResp.MessageTypes)
+}
+
+func TestStatusRPCCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
+
+	res := httptest.NewRecorder()
+	g.statusHandler(res, httptest.NewRequest("GET", "/status", nil), nil)
+	var statusResp statusMsg
+	err := json.NewDecoder(res.Body).Decode(&statusResp)
+	assert.NoError(err)
+	assert.Nil(statusResp.RPCCircuitBreaker)
+
+	g.rpcBreaker = &testRPCBreaker{err: fmt.Errorf("connection refused")}
+	res = httptest.NewRecorder()
+	g.statusHandler(res, httptest.NewRequest("GET", "/status", nil), nil)
+	err = json.NewDecoder(res.Body).Decode(&statusResp)
+	assert.NoError(err)
+	assert.True(statusResp.OK)
+	assert.Equal(eth.RPCBreakerOpen, statusResp.RPCCircuitBreaker.State)
+	assert.Equal("connection refused", statusResp.RPCCircuitBreaker.LastError)
 }
 
 func TestStartStatusStopNoKafkaWebhooksAccessToken(t *testing.T) {
@@ -72,7 +129,7 @@ func TestStartStatusStopNoKafkaWebhooksAccessToken(t *testing.T) {
 	u.User = url.UserPassword("user1", "pass1")
 
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.HTTP.Port = lastPort
 	g.conf.HTTP.LocalAddr = "127.0.0.1"
 	g.conf.RPC.URL = u.String()
@@ -124,7 +181,7 @@ func TestStartStatusStopNoKafkaWebhooksMissingToken(t *testing.T) {
 	u.User = url.UserPassword("user1", "pass1")
 
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.HTTP.Port = lastPort
 	g.conf.HTTP.LocalAddr = "127.0.0.1"
 	g.conf.RPC.URL = u.String()
@@ -168,7 +225,7 @@ func TestStartWithKafkaWebhooks(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.HTTP.Port = lastPort
 	g.conf.HTTP.LocalAddr = "127.0.0.1"
 	g.conf.Kafka.Brokers = []string{""}
@@ -189,7 +246,7 @@ func TestStartWithBadTLS(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.HTTP.Port = lastPort
 	g.conf.HTTP.LocalAddr = "127.0.0.1"
 	g.conf.HTTP.TLS.Enabled = true
@@ -215,7 +272,7 @@ func TestStartInvalidMongo(t *testing.T) {
 	defer fakeMongo.Close()
 
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	url, _ := url.Parse(fakeMongo.URL)
 	url.Scheme = "mongodb"
 	g.conf.MongoDB.URL = url.String()
@@ -228,7 +285,7 @@ func TestStartWithBadRPCUrl(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = false
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.conf.HTTP.Port = lastPort
 	g.conf.HTTP.LocalAddr = "127.0.0.1"
 	g.conf.OpenAPI.StoragePath = "/tmp/t"
@@ -248,7 +305,7 @@ func TestPrintYaml(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = true
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.printYAML = &printYAML
 	cmd := g.CobraInit("rest")
 	cmd.SetArgs([]string{"-l", "8001", "-r", "http://localhost:8545"})
@@ -260,7 +317,7 @@ func TestMissingRPCAndMissingKafka(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = true
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.printYAML = &printYAML
 	cmd := g.CobraInit("rest")
 	cmd.SetArgs([]string{"-l", "8001"})
@@ -272,7 +329,7 @@ func TestMaxWaitTimeTooSmallWarns(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = true
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.printYAML = &printYAML
 	cmd := g.CobraInit("rest")
 	cmd.SetArgs([]string{"-l", "8001", "-r", "http://localhost:8545", "-x", "1"})
@@ -284,7 +341,7 @@ func TestKafkaCobraInitSuccess(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = true
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.printYAML = &printYAML
 	cmd := g.CobraInit("rest")
 	args := []string{
@@ -304,7 +361,7 @@ func TestKafkaCobraInitFailure(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = true
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	g.printYAML = &printYAML
 	cmd := g.CobraInit("rest")
 	args := []string{
@@ -321,7 +378,7 @@ func TestDispatchMsgAsyncPassesThroughToWebhooks(t *testing.T) {
 	assert := assert.New(t)
 
 	var printYAML = true
-	g := NewRESTGateway(&printYAML)
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
 	fakeHandler := &mockHandler{}
 	r, _ := newReceiptsTestStore(nil)
 	g.webhooks = newWebhooks(fakeHandler, r, nil)
@@ -331,3 +388,30 @@ func TestDispatchMsgAsyncPassesThroughToWebhooks(t *testing.T) {
 	assert.Equal(400, status)
 	assert.Regexp("Invalid message - missing 'headers' \\(or not an object\\)", err)
 }
+
+func TestAccessTokenQueryParamWebSocketOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML, &eth.SolcConf{})
+	var accessToken string
+	handler := g.newAccessTokenContextHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		accessToken = auth.GetAccessToken(req.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/ws?access_token=testat", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("testat", accessToken)
+
+	req = httptest.NewRequest("GET", "/status?access_token=testat", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(401, res.Code)
+}
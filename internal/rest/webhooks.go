@@ -22,6 +22,7 @@ import (
 
 	"github.com/hyperledger/firefly-ethconnect/internal/contractgateway"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 	"github.com/julienschmidt/httprouter"
@@ -128,7 +129,7 @@ func (w *webhooks) processMsg(ctx context.Context, msg map[string]interface{}, a
 	}
 	var key string
 	switch msgType {
-	case messages.MsgTypeDeployContract, messages.MsgTypeSendTransaction:
+	case messages.MsgTypeDeployContract, messages.MsgTypeSendTransaction, messages.MsgTypeSpeedUpTransaction, messages.MsgTypeCancelTransaction:
 		from, exists := msg["from"]
 		if !exists || reflect.TypeOf(from).Kind() != reflect.String {
 			return nil, 400, errors.Errorf(errors.WebhooksInvalidMsgFromMissing)
@@ -151,7 +152,7 @@ func (w *webhooks) processMsg(ctx context.Context, msg map[string]interface{}, a
 	if w.smartContractGW != nil && msgType == messages.MsgTypeDeployContract {
 		var err error
 		if msg, err = w.contractGWHandler(msg); err != nil {
-			return nil, 500, err
+			return nil, eth.CompileErrorStatus(err, 500), err
 		}
 	}
 
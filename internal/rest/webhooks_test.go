@@ -25,6 +25,7 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/hyperledger/firefly-ethconnect/internal/contractgateway"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
@@ -57,6 +58,10 @@ func (m *mockContractGW) SendReply(message interface{}) {
 
 func (m *mockContractGW) Shutdown() {}
 
+func (m *mockContractGW) Invoke(ctx context.Context, addr, method string, params map[string]interface{}, opts *contractgateway.InvokeOptions) (*contractgateway.InvokeResult, error) {
+	return nil, nil
+}
+
 type mockHandler struct{}
 
 func (*mockHandler) sendWebhookMsg(ctx context.Context, key, msgID string, msg map[string]interface{}, ack bool) (msgAck string, statusCode int, err error) {
@@ -261,3 +266,39 @@ func TestWebhookHandlerTransactionWithID(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal("test-id", asyncResponse.Request)
 }
+
+func TestWebhookHandlerSpeedUpTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	speedUpMsg := messages.SpeedUpTransaction{
+		From:            "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+		TransactionHash: "0x3e9c6a0a2a2b5e6ae4a40e3d2c4fbb9dda4df2d9cf2f6e8bcb42b1dc4cb5a2b1",
+	}
+	speedUpMsg.Headers.MsgType = messages.MsgTypeSpeedUpTransaction
+	speedUpMsgBytes, _ := json.Marshal(&speedUpMsg)
+	req, _ := http.NewRequest("POST", "/any", bytes.NewReader(speedUpMsgBytes))
+	w := &webhooks{
+		handler: &mockHandler{},
+	}
+	rec := httptest.NewRecorder()
+	w.webhookHandler(rec, req, false)
+	assert.Equal(200, rec.Result().StatusCode)
+}
+
+func TestWebhookHandlerCancelTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	cancelMsg := messages.CancelTransaction{
+		From:            "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+		TransactionHash: "0x3e9c6a0a2a2b5e6ae4a40e3d2c4fbb9dda4df2d9cf2f6e8bcb42b1dc4cb5a2b1",
+	}
+	cancelMsg.Headers.MsgType = messages.MsgTypeCancelTransaction
+	cancelMsgBytes, _ := json.Marshal(&cancelMsg)
+	req, _ := http.NewRequest("POST", "/any", bytes.NewReader(cancelMsgBytes))
+	w := &webhooks{
+		handler: &mockHandler{},
+	}
+	rec := httptest.NewRecorder()
+	w.webhookHandler(rec, req, false)
+	assert.Equal(200, rec.Result().StatusCode)
+}
@@ -45,6 +45,7 @@ type webhooksDirect struct {
 	inFlightMutex sync.Mutex
 	inFlight      map[string]*msgContext
 	stopChan      chan error
+	rpcBreaker    eth.RPCCircuitBreaker // set when the RPC connection has a circuit breaker
 }
 
 func newWebhooksDirect(conf *WebhooksDirectConf, processor tx.TxnProcessor, receipts *receiptStore) *webhooksDirect {
@@ -121,6 +122,13 @@ func (t *msgContext) String() string {
 }
 
 func (w *webhooksDirect) sendWebhookMsg(ctx context.Context, key, msgID string, msg map[string]interface{}, ack bool) (string, int, error) {
+	if w.rpcBreaker != nil {
+		if err := w.rpcBreaker.Check(); err != nil {
+			log.Errorf("Failed to dispatch mesage from '%s': %s", key, err)
+			return "", 503, err
+		}
+	}
+
 	w.inFlightMutex.Lock()
 
 	numInFlight := len(w.inFlight)
@@ -25,6 +25,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/tx"
 	"github.com/julienschmidt/httprouter"
@@ -33,7 +34,10 @@ import (
 )
 
 type mockProcessor struct {
-	capturedCtx *msgContext
+	capturedCtx        *msgContext
+	capturedStore      kvstore.KVStore
+	capturedNewContext tx.RecoveryContextFactory
+	recoverErr         error
 }
 
 func (p *mockProcessor) ResolveAddress(from string) (string, error) { return "", nil }
@@ -41,6 +45,35 @@ func (p *mockProcessor) OnMessage(ctx tx.TxnContext) {
 	p.capturedCtx = ctx.(*msgContext)
 }
 func (p *mockProcessor) Init(eth.RPCClient) {}
+func (p *mockProcessor) PendingTransactions(ctx context.Context, addr string) (*tx.PendingTransactions, error) {
+	return nil, nil
+}
+func (p *mockProcessor) InflightTransactions(addr string) ([]*tx.InflightAddress, error) {
+	return nil, nil
+}
+func (p *mockProcessor) ResetNonce(addr string, nextNonce *int64) (*tx.NonceReset, error) {
+	return nil, nil
+}
+
+func (p *mockProcessor) UpdateHDWallet(conf *tx.HDWalletConf, probe string) (*tx.IntegrationUpdate, error) {
+	return nil, nil
+}
+
+func (p *mockProcessor) UpdateAddressBook(ctx context.Context, conf *tx.AddressBookConf, probe string) (*tx.IntegrationUpdate, error) {
+	return nil, nil
+}
+
+func (p *mockProcessor) AddLifecycleSink(sink tx.LifecycleSink) {
+}
+
+func (p *mockProcessor) SetContractABIResolver(resolver tx.ContractABIResolver) {
+}
+
+func (p *mockProcessor) RecoverInflight(store kvstore.KVStore, newContext tx.RecoveryContextFactory) (*tx.RecoveryResult, error) {
+	p.capturedStore = store
+	p.capturedNewContext = newContext
+	return &tx.RecoveryResult{}, p.recoverErr
+}
 
 func newTestWebhooksDirect(maxMsgs int) (*webhooksDirect, *memoryReceipts, *mockProcessor) {
 	rsc := &ReceiptStoreConf{}
@@ -172,3 +205,47 @@ func TestWebhooksDirectUnmarshalBadMsg(t *testing.T) {
 	err := ctx.Unmarshal(nil)
 	assert.Regexp("json: unsupported type: map\\[bool\\]string", err)
 }
+
+type testRPCBreaker struct {
+	err error
+}
+
+func (b *testRPCBreaker) Check() error                         { return b.err }
+func (b *testRPCBreaker) WaitClosed(ctx context.Context) error { return nil }
+func (b *testRPCBreaker) State() *eth.RPCBreakerState {
+	state := &eth.RPCBreakerState{State: eth.RPCBreakerClosed, FailureThreshold: 5}
+	if b.err != nil {
+		state.State = eth.RPCBreakerOpen
+		state.LastError = b.err.Error()
+	}
+	return state
+}
+
+func TestWebhooksDirectRPCCircuitBreakerOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	wd, ts, _, p := newTestWebhooksDirectServer(1)
+	defer ts.Close()
+	breaker := &testRPCBreaker{err: fmt.Errorf("circuit breaker is open")}
+	wd.rpcBreaker = breaker
+
+	msg := newTestMsg()
+	msgBytes, _ := json.Marshal(&msg)
+	url := fmt.Sprintf("%s/hook", ts.URL)
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(msgBytes))
+	assert.NoError(err)
+	assert.Equal(503, resp.StatusCode)
+	replyBytes, _ := ioutil.ReadAll(resp.Body)
+	reply := hookErrMsg{}
+	json.Unmarshal(replyBytes, &reply)
+	assert.False(reply.Sent)
+	assert.Regexp("circuit breaker is open", reply.Message)
+	assert.Nil(p.capturedCtx)
+	assert.Empty(wd.inFlight)
+
+	breaker.err = nil
+	resp, err = http.Post(url, "application/json", bytes.NewReader(msgBytes))
+	assert.NoError(err)
+	assert.Equal(200, resp.StatusCode)
+}
@@ -63,7 +63,22 @@ func (w *webhooksKafka) setMsgPending(msgID string) {
 	w.sendCond.L.Unlock()
 }
 
-func (w *webhooksKafka) waitForSend(msgID string) (msg *sarama.ProducerMessage, err error) {
+// waitForSend waits for Kafka to acknowledge a message, or for the context of the request to be
+// cancelled or reach its deadline. The message is no longer pending once we stop waiting, so a
+// late acknowledgement is discarded
+func (w *webhooksKafka) waitForSend(ctx context.Context, msgID string) (msg *sarama.ProducerMessage, err error) {
+	waiting := make(chan struct{})
+	defer close(waiting)
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.sendCond.L.Lock()
+			w.sendCond.Broadcast()
+			w.sendCond.L.Unlock()
+		case <-waiting:
+		}
+	}()
+
 	w.sendCond.L.Lock()
 	for msg == nil && err == nil {
 		var found bool
@@ -71,6 +86,9 @@ func (w *webhooksKafka) waitForSend(msgID string) (msg *sarama.ProducerMessage,
 			delete(w.failedMsgs, msgID)
 		} else if msg, found = w.successMsgs[msgID]; found {
 			delete(w.successMsgs, msgID)
+		} else if ctx.Err() != nil {
+			delete(w.pendingMsgs, msgID)
+			err = errors.Errorf(errors.WebhooksKafkaAckAborted, ctx.Err())
 		} else {
 			w.sendCond.Wait()
 		}
@@ -168,8 +186,11 @@ func (w *webhooksKafka) sendWebhookMsg(ctx context.Context, key, msgID string, m
 
 	msgAck := ""
 	if ack {
-		successMsg, err := w.waitForSend(msgID)
+		successMsg, err := w.waitForSend(ctx, msgID)
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", 408, err
+			}
 			return "", 502, errors.Errorf(errors.WebhooksKafkaErr, err)
 		}
 		msgAck = fmt.Sprintf("%s:%d:%d", successMsg.Topic, successMsg.Partition, successMsg.Offset)
@@ -310,6 +310,45 @@ func TestWebhookHandlerJSONSendFailedToKafkaNoAck(t *testing.T) {
 	assert.Equal(messages.MsgTypeSendTransaction, forwardedMessage.Headers.MsgType)
 }
 
+func TestWaitForSendRequestCancelled(t *testing.T) {
+	assert := assert.New(t)
+	w := newWebhooksKafkaBase(nil)
+	w.setMsgPending("msg1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := w.waitForSend(ctx, "msg1")
+		done <- err
+	}()
+	cancel()
+	err := <-done
+	assert.Regexp("Stopped waiting for Kafka to acknowledge the message, as the request was cancelled or reached its deadline: context canceled", err)
+	assert.Empty(w.pendingMsgs)
+}
+
+func TestWaitForSendAcknowledged(t *testing.T) {
+	assert := assert.New(t)
+	w := newWebhooksKafkaBase(nil)
+	w.setMsgPending("msg1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan *sarama.ProducerMessage)
+	go func() {
+		msg, err := w.waitForSend(ctx, "msg1")
+		assert.NoError(err)
+		done <- msg
+	}()
+	w.sendCond.L.Lock()
+	delete(w.pendingMsgs, "msg1")
+	w.successMsgs["msg1"] = &sarama.ProducerMessage{Topic: "topic1"}
+	w.sendCond.Broadcast()
+	w.sendCond.L.Unlock()
+	assert.Equal("topic1", (<-done).Topic)
+	assert.Empty(w.successMsgs)
+}
+
 func TestProducerErrorLoopPanicsOnBadErrStructure(t *testing.T) {
 	assert := assert.New(t)
 
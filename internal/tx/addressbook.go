@@ -152,6 +152,16 @@ func (ab *addressBook) mapEndpoint(ctx context.Context, endpoint string) (eth.RP
 	return rpc, err
 }
 
+// close the cached RPC connections
+func (ab *addressBook) close() {
+	ab.mtx.Lock()
+	defer ab.mtx.Unlock()
+	for endpoint, rpc := range ab.hostToRPC {
+		rpc.Close()
+		delete(ab.hostToRPC, endpoint)
+	}
+}
+
 // lookup the RPC URL to use for a given from address, performing hostname resolution
 // based on a custom hosts file (if configured)
 func (ab *addressBook) lookup(ctx context.Context, fromAddr string) (eth.RPCClient, error) {
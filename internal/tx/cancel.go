@@ -0,0 +1,144 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+// cancellation records the zero-value transfer sent in place of an in-flight transaction, so
+// the request that asked for it can be answered with whichever of the two is mined
+type cancellation struct {
+	req           *speedUpRequest
+	tx            *eth.Txn
+	cancelledHash string
+}
+
+// cancelled is true while the cancellation is the transaction being tracked. Once a receipt is
+// obtained, this means the cancellation was mined rather than the transaction it replaced
+func (i *inflightTxn) cancelled() bool {
+	return i.cancellation != nil && i.tx == i.cancellation.tx
+}
+
+// OnCancelTransactionMessage queues a request to replace an in-flight transaction with a
+// zero-value transfer. The goroutine tracking the transaction sends the reply, once either
+// the transaction or the cancellation is mined
+func (p *txnProcessor) OnCancelTransactionMessage(txnContext TxnContext, msg *messages.CancelTransaction) {
+	req, err := newSpeedUpRequest(txnContext, &messages.SpeedUpTransaction{
+		TransactionHash:      msg.TransactionHash,
+		GasPrice:             msg.GasPrice,
+		MaxFeePerGas:         msg.MaxFeePerGas,
+		MaxPriorityFeePerGas: msg.MaxPriorityFeePerGas,
+	})
+	if err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+	req.cancel = true
+	if status, err := p.queueSpeedUp(req); err != nil {
+		txnContext.SendErrorReply(status, err)
+	}
+}
+
+// sendCancellation replaces an in-flight transaction with a transfer of nothing from the sender to
+// itself, built the same way as a gap-fill transaction, on the goroutine tracking it. The fees are
+// bumped from those of the transaction it replaces, so the node accepts the replacement
+func (p *txnProcessor) sendCancellation(inflight *inflightTxn, req *speedUpRequest) {
+	current := inflight.tx
+	ctx := req.txnContext.Context()
+	cancelTx, err := eth.NewNilTX(inflight.from, inflight.nonce, inflight.signer)
+	if err == nil {
+		if current.IsDynamicFee() {
+			cancelTx.MaxFeePerGas = current.MaxFeePerGas
+			cancelTx.MaxPriorityFeePerGas = current.MaxPriorityFeePerGas
+		} else {
+			cancelTx.SetGasPrice(current.EthTX.GasPrice())
+		}
+		err = p.setSpeedUpFees(ctx, inflight, cancelTx, req)
+	}
+	if err == nil {
+		err = cancelTx.Send(ctx, inflight.rpc)
+	}
+	if err != nil {
+		req.txnContext.SendErrorReplyWithTX(400, err, current.Hash)
+		return
+	}
+
+	p.inflightTxnsLock.Lock()
+	inflight.replaced = append(inflight.replaced, current)
+	inflight.tx = cancelTx
+	inflight.cancellation = &cancellation{req: req, tx: cancelTx, cancelledHash: current.Hash}
+	p.inflightTxnsLock.Unlock()
+	log.Infof("In-flight %d cancelled. nonce=%d cancelled=%s with=%s", inflight.id, inflight.nonce, current.Hash, cancelTx.Hash)
+
+	p.persistInflight(inflight, cancelTx)
+	p.forgetInflight(current.Hash)
+	p.emitLifecycle(inflight.txnContext, inflight, &LifecycleEvent{Type: LifecycleCancelled})
+}
+
+// replyCancelled sends an error reply to the original request, when the cancellation was mined
+// instead of its transaction
+func (p *txnProcessor) replyCancelled(inflight *inflightTxn) {
+	receipt := inflight.tx.Receipt
+	var blockNumber, status string
+	if receipt.BlockNumber != nil {
+		blockNumber = receipt.BlockNumber.ToInt().Text(10)
+	}
+	if receipt.Status != nil {
+		status = receipt.Status.ToInt().Text(10)
+	}
+	log.Infof("Cancellation %s of %s mined in block %s", inflight.tx.Hash, inflight.cancellation.cancelledHash, blockNumber)
+	p.emitLifecycle(inflight.txnContext, inflight, &LifecycleEvent{
+		Type:        LifecycleMined,
+		BlockNumber: blockNumber,
+		Status:      status,
+	})
+	err := errors.Errorf(errors.TransactionCancelled, inflight.cancellation.cancelledHash, inflight.tx.Hash, blockNumber)
+	inflight.txnContext.SendErrorReplyWithTX(409, err, inflight.cancellation.cancelledHash)
+}
+
+// replyCancellation answers the request that cancelled an in-flight transaction, with the
+// transaction that was mined. Tracking can stop before either of them is mined
+func (p *txnProcessor) replyCancellation(inflight *inflightTxn, isMined bool) {
+	c := inflight.cancellation
+	if c == nil {
+		return
+	}
+	if !isMined {
+		c.req.txnContext.SendErrorReplyWithTX(408, errors.Errorf(errors.TransactionCancelNotMined, c.cancelledHash, c.tx.Hash), c.tx.Hash)
+		return
+	}
+	reply := &messages.TransactionCancel{
+		TransactionHash:          c.tx.Hash,
+		CancelledTransactionHash: c.cancelledHash,
+		MinedTransactionHash:     inflight.tx.Hash,
+		Cancelled:                inflight.cancelled(),
+		NonceStr:                 inflight.nonceNumber().String(),
+	}
+	reply.Headers.MsgType = messages.MsgTypeTransactionCancel
+	if inflight.tx.Receipt.BlockNumber != nil {
+		reply.BlockNumberStr = inflight.tx.Receipt.BlockNumber.ToInt().Text(10)
+	}
+	if c.tx.IsDynamicFee() {
+		reply.MaxFeePerGasStr = c.tx.MaxFeePerGas.Text(10)
+		reply.MaxPriorityFeePerGasStr = c.tx.MaxPriorityFeePerGas.Text(10)
+	} else {
+		reply.GasPriceStr = c.tx.EthTX.GasPrice().Text(10)
+	}
+	c.req.txnContext.Reply(reply)
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func cancelMsgJSON(fees string) string {
+	return `{"headers":{"type":"CancelTransaction"},"transactionHash":"` + testSpeedUpHash + `"` + fees + `}`
+}
+
+func TestOnCancelTransactionMessageQueueErrors(t *testing.T) {
+	assert := assert.New(t)
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	cancel := func(msg string) *testTxnContext {
+		txnContext := &testTxnContext{jsonMsg: msg}
+		p.OnMessage(txnContext)
+		return txnContext
+	}
+
+	txnContext := cancel(cancelMsgJSON(`,"gasPrice":"-1"`))
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Regexp("Invalid gasPrice '-1'", txnContext.errorReplies[0].err)
+
+	inflight.privacyGroupID = "P1"
+	txnContext = cancel(cancelMsgJSON(""))
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Regexp("FFEC100355", txnContext.errorReplies[0].err)
+	inflight.privacyGroupID = ""
+
+	txnContext = cancel(cancelMsgJSON(""))
+	assert.Empty(txnContext.errorReplies)
+	queued := <-inflight.speedUps
+	assert.True(queued.cancel)
+
+	inflight.cancellation = &cancellation{tx: newFeeBumpTestTxn(1100), cancelledHash: testSpeedUpHash}
+	txnContext = cancel(cancelMsgJSON(""))
+	assert.Equal(409, txnContext.errorReplies[0].status)
+	assert.Regexp("has already been cancelled", txnContext.errorReplies[0].err)
+
+	txnContext = &testTxnContext{jsonMsg: speedUpMsgJSON("")}
+	p.OnMessage(txnContext)
+	assert.Equal(409, txnContext.errorReplies[0].status)
+}
+
+func TestSendCancellationGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	txnContext := &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext, txHash: testSpeedUpHash, cancel: true})
+	assert.Empty(txnContext.replies)
+	assert.Empty(txnContext.errorReplies)
+	sent := rpc.sent[0]
+	assert.Equal(sent.From, sent.To)
+	assert.Equal(strings.ToLower(testFromAddr), strings.ToLower(sent.From))
+	assert.Equal(int64(0), sent.Value.ToInt().Int64())
+	assert.Equal(int64(1100), sent.GasPrice.ToInt().Int64())
+	assert.Equal(uint64(5), uint64(*sent.Nonce))
+	assert.Equal(testSpeedUpHash, inflight.replaced[0].Hash)
+	assert.Equal(testSpeedUpHash, inflight.cancellation.cancelledHash)
+	assert.Equal(inflight.tx, inflight.cancellation.tx)
+}
+
+func TestSendCancellationDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{}
+	tx := newFeeBumpTestTxn(0)
+	tx.MaxFeePerGas = big.NewInt(2000)
+	tx.MaxPriorityFeePerGas = big.NewInt(100)
+	inflight := newSpeedUpTestInflight(rpc, tx)
+	p := newSpeedUpTestProcessor(inflight)
+
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: &testTxnContext{}, priorityFee: big.NewInt(500), cancel: true})
+	assert.Equal(int64(2200), rpc.sent[0].MaxFeePerGas.ToInt().Int64())
+	assert.Equal(int64(500), rpc.sent[0].MaxPriorityFeePerGas.ToInt().Int64())
+	assert.Nil(rpc.sent[0].GasPrice)
+}
+
+func TestSendCancellationFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{sendErr: fmt.Errorf("replacement transaction underpriced")}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	txnContext := &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext, cancel: true})
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Equal(testSpeedUpHash, txnContext.errorReplies[0].txHash)
+	assert.Regexp("replacement transaction underpriced", txnContext.errorReplies[0].err)
+	assert.Nil(inflight.cancellation)
+	assert.Equal(testSpeedUpHash, inflight.tx.Hash)
+}
+
+func TestCancelTrackedTransaction(t *testing.T) {
+	assert := assert.New(t)
+	cancelHash := fmt.Sprintf("0x%064x", 1)
+	rpc := &speedUpRPC{mined: map[string]bool{cancelHash: true}}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	inflight.initialWaitDelay = 10 * time.Millisecond
+	p := newSpeedUpTestProcessor(inflight)
+	p.conf.MaxTXWaitTime = 5
+	p.Init(rpc)
+
+	p.trackMining(inflight, inflight.tx)
+	cancelContext := &testTxnContext{jsonMsg: cancelMsgJSON("")}
+	p.OnMessage(cancelContext)
+	inflight.wg.Wait()
+
+	assert.Empty(cancelContext.errorReplies)
+	reply := cancelContext.replies[0].(*messages.TransactionCancel)
+	assert.Equal(messages.MsgTypeTransactionCancel, reply.Headers.MsgType)
+	assert.True(reply.Cancelled)
+	assert.Equal(cancelHash, reply.TransactionHash)
+	assert.Equal(cancelHash, reply.MinedTransactionHash)
+	assert.Equal(testSpeedUpHash, reply.CancelledTransactionHash)
+	assert.Equal("12345", reply.BlockNumberStr)
+	assert.Equal("1100", reply.GasPriceStr)
+	txnContext := inflight.txnContext.(*testTxnContext)
+	assert.Empty(txnContext.replies)
+	assert.Equal(409, txnContext.errorReplies[0].status)
+	assert.Equal(testSpeedUpHash, txnContext.errorReplies[0].txHash)
+	assert.Regexp("was cancelled by "+cancelHash+", mined in block 12345", txnContext.errorReplies[0].err)
+	assert.Empty(p.inflightTxns)
+}
+
+func TestCancelTrackedTransactionOriginalMined(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{mined: map[string]bool{testSpeedUpHash: true}}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	inflight.initialWaitDelay = 10 * time.Millisecond
+	p := newSpeedUpTestProcessor(inflight)
+	p.conf.MaxTXWaitTime = 5
+	p.Init(rpc)
+
+	cancelContext := &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: cancelContext, cancel: true})
+	p.trackMining(inflight, inflight.tx)
+	inflight.wg.Wait()
+
+	assert.Empty(cancelContext.errorReplies)
+	reply := cancelContext.replies[0].(*messages.TransactionCancel)
+	assert.False(reply.Cancelled)
+	assert.Equal(testSpeedUpHash, reply.MinedTransactionHash)
+	txnContext := inflight.txnContext.(*testTxnContext)
+	assert.Empty(txnContext.errorReplies)
+	assert.Equal(messages.MsgTypeTransactionSuccess, txnContext.replies[0].ReplyHeaders().MsgType)
+}
+
+func TestReplyCancellationNotMined(t *testing.T) {
+	assert := assert.New(t)
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	p.replyCancellation(inflight, false)
+
+	cancelContext := &testTxnContext{}
+	cancelTx := newFeeBumpTestTxn(1100)
+	cancelTx.Hash = "0x1111"
+	inflight.cancellation = &cancellation{req: &speedUpRequest{txnContext: cancelContext}, tx: cancelTx, cancelledHash: testSpeedUpHash}
+	p.replyCancellation(inflight, false)
+	assert.Equal(408, cancelContext.errorReplies[0].status)
+	assert.Equal("0x1111", cancelContext.errorReplies[0].txHash)
+	assert.Regexp("FFEC100358", cancelContext.errorReplies[0].err)
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+// resolveDynamicFees checks the chain supports EIP-1559 before a dynamic fee transaction
+// is sent. On a chain without a base fee the transaction is sent as a legacy transaction,
+// offering the maximum fee as the gas price
+func (p *txnProcessor) resolveDynamicFees(ctx context.Context, inflight *inflightTxn, tx *eth.Txn) error {
+	if !tx.IsDynamicFee() {
+		return nil
+	}
+	supported, err := p.dynamicFeesSupported(ctx, inflight.rpc)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		log.Infof("In-flight %d sending with gasPrice=%s as the chain does not support dynamic fees", inflight.id, tx.MaxFeePerGas.String())
+		tx.UseLegacyFees()
+	}
+	return nil
+}
+
+// dynamicFeesSupported checks the chain for EIP-1559 support the first time a dynamic fee
+// transaction is sent, and caches the result
+func (p *txnProcessor) dynamicFeesSupported(ctx context.Context, rpc eth.RPCClient) (bool, error) {
+	p.dynamicFeesLock.Lock()
+	defer p.dynamicFeesLock.Unlock()
+	if p.dynamicFees == nil {
+		supported, err := eth.SupportsDynamicFees(ctx, rpc)
+		if err != nil {
+			return false, err
+		}
+		p.dynamicFees = &supported
+	}
+	return *p.dynamicFees, nil
+}
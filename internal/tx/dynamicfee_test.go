@@ -0,0 +1,203 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+var goodDynamicFeeSendTxnJSON = "{" +
+	"  \"headers\":{\"type\": \"SendTransaction\"}," +
+	"  \"from\":\"" + testFromAddr + "\"," +
+	"  \"gas\":\"123\"," +
+	"  \"maxFeePerGas\":\"2000\"," +
+	"  \"maxPriorityFeePerGas\":\"100\"," +
+	"  \"method\":{\"name\":\"test\"}" +
+	"}"
+
+func newDynamicFeeTestTxn(maxFee, priorityFee int64) *eth.Txn {
+	tx := newFeeBumpTestTxn(0)
+	tx.MaxFeePerGas = big.NewInt(maxFee)
+	if priorityFee >= 0 {
+		tx.MaxPriorityFeePerGas = big.NewInt(priorityFee)
+	}
+	return tx
+}
+
+func TestResolveDynamicFeesSupported(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{}}
+	rpc := &feeBumpRPC{baseFee: big.NewInt(7)}
+	inflight := &inflightTxn{rpc: rpc}
+
+	tx := newDynamicFeeTestTxn(2000, 100)
+	err := p.resolveDynamicFees(context.Background(), inflight, tx)
+	assert.NoError(err)
+	assert.True(tx.IsDynamicFee())
+
+	// The result is cached
+	err = p.resolveDynamicFees(context.Background(), inflight, newDynamicFeeTestTxn(2000, 100))
+	assert.NoError(err)
+	assert.Equal(1, rpc.blockCalls)
+
+	// Legacy transactions do not check the chain
+	p.dynamicFees = nil
+	err = p.resolveDynamicFees(context.Background(), inflight, newFeeBumpTestTxn(1000))
+	assert.NoError(err)
+	assert.Equal(1, rpc.blockCalls)
+}
+
+func TestResolveDynamicFeesNotSupported(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{}}
+	rpc := &feeBumpRPC{}
+
+	tx := newDynamicFeeTestTxn(2000, 100)
+	err := p.resolveDynamicFees(context.Background(), &inflightTxn{rpc: rpc}, tx)
+	assert.NoError(err)
+	assert.False(tx.IsDynamicFee())
+	assert.Equal(int64(2000), tx.EthTX.GasPrice().Int64())
+
+	err = p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, tx)
+	assert.NoError(err)
+	assert.Equal([]int64{2000}, rpc.gasPrices)
+	assert.Empty(rpc.maxFees)
+}
+
+func TestResolveDynamicFeesFail(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{}}
+	rpc := &feeBumpRPC{blockErr: fmt.Errorf("pop")}
+
+	err := p.resolveDynamicFees(context.Background(), &inflightTxn{rpc: rpc}, newDynamicFeeTestTxn(2000, 100))
+	assert.Regexp("eth_getBlockByNumber returned: pop", err)
+	assert.Nil(p.dynamicFees)
+}
+
+func TestSendWithFeeBumpDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 3}}}
+	rpc := &feeBumpRPC{sendErrs: []error{
+		fmt.Errorf("replacement transaction underpriced"),
+		fmt.Errorf("transaction underpriced"),
+	}}
+	inflight := &inflightTxn{rpc: rpc, nonce: 5}
+
+	tx := newDynamicFeeTestTxn(2000, 100)
+	err := p.sendWithFeeBump(context.Background(), inflight, tx)
+	assert.NoError(err)
+	assert.Equal([]int64{2000, 2200, 2420}, rpc.maxFees)
+	assert.Equal([]int64{100, 110, 121}, rpc.priorityFees)
+	assert.Empty(rpc.gasPrices)
+}
+
+func TestSendWithFeeBumpDynamicFeesNodePriorityFee(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 1}}}
+	rpc := &feeBumpRPC{priorityFee: 150, sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+
+	err := p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, newDynamicFeeTestTxn(2000, -1))
+	assert.NoError(err)
+	assert.Equal([]int64{2000, 2200}, rpc.maxFees)
+	assert.Equal([]int64{165}, rpc.priorityFees)
+
+	rpc = &feeBumpRPC{priorityFeeErr: fmt.Errorf("pop"), sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+	err = p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, newDynamicFeeTestTxn(2000, -1))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{2000}, rpc.maxFees)
+}
+
+func TestSendWithFeeBumpDynamicFeesMaxGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 3, MaxGasPrice: "2100"}}}
+	rpc := &feeBumpRPC{sendErrs: []error{
+		fmt.Errorf("transaction underpriced"),
+		fmt.Errorf("transaction underpriced"),
+		fmt.Errorf("transaction underpriced"),
+	}}
+
+	err := p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, newDynamicFeeTestTxn(2000, 2000))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{2000, 2100}, rpc.maxFees)
+	assert.Equal([]int64{2000, 2100}, rpc.priorityFees)
+}
+
+func TestOnSendTransactionMessageDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:      1,
+		HexValuesInReceipt: true,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodDynamicFeeSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetBlockByNumberResult = map[string]interface{}{"baseFeePerGas": "0x7"}
+	effectiveGasPrice := ethbinding.HexBigInt(*big.NewInt(1007))
+	testRPC.ethGetTransactionReceiptResult.EffectiveGasPrice = &effectiveGasPrice
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+	assert.Equal(0, len(testTxnContext.errorReplies))
+
+	assert.Equal("eth_getBlockByNumber", testRPC.calls[0])
+	assert.Equal("eth_sendTransaction", testRPC.calls[1])
+	sendTX := testRPC.params[1][0].(*eth.SendTXArgs)
+	assert.Nil(sendTX.GasPrice)
+	assert.Equal(int64(2000), sendTX.MaxFeePerGas.ToInt().Int64())
+	assert.Equal(int64(100), sendTX.MaxPriorityFeePerGas.ToInt().Int64())
+
+	replyMsgBytes, _ := json.Marshal(testTxnContext.replies[0])
+	var replyMsgMap map[string]interface{}
+	json.Unmarshal(replyMsgBytes, &replyMsgMap)
+	assert.Equal("1007", replyMsgMap["effectiveGasPrice"])
+	assert.Equal("0x3ef", replyMsgMap["effectiveGasPriceHex"])
+}
+
+func TestOnSendTransactionMessageDynamicFeesCheckFail(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodDynamicFeeSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetBlockByNumberErr = fmt.Errorf("pop")
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Equal(1, len(testTxnContext.errorReplies))
+	assert.Regexp("eth_getBlockByNumber returned: pop", testTxnContext.errorReplies[0].err)
+	assert.NotContains(testRPC.calls, "eth_sendTransaction")
+}
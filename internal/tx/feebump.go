@@ -0,0 +1,137 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFeeBumpPercent = 10
+)
+
+// FeeBumpConf configures resending a transaction with a higher gas price, when the node rejects
+// it as underpriced, or as a replacement for a transaction with the same nonce
+type FeeBumpConf struct {
+	MaxAttempts int    `json:"maxAttempts,omitempty"`
+	Percent     int    `json:"percent,omitempty"`
+	MaxGasPrice string `json:"maxGasPrice,omitempty"`
+}
+
+// isFeeBumpError checks whether a node might accept a transaction if it is resent with a
+// higher gas price. A transaction that is already known is replaced by the resend
+func isFeeBumpError(err error) bool {
+	errorType, _, _ := errors.ClassifyNodeError(err)
+	switch errorType {
+	case errors.NodeErrorUnderpriced, errors.NodeErrorReplacementUnderpriced, errors.NodeErrorAlreadyKnown:
+		return true
+	default:
+		return false
+	}
+}
+
+// bumpedGasPrice returns the gas price to resend a transaction with. A transaction sent
+// without a gas price is resent with a bump of the price suggested by the node
+func (p *txnProcessor) bumpedGasPrice(ctx context.Context, inflight *inflightTxn, tx *eth.Txn) (*big.Int, error) {
+	gasPrice := tx.EthTX.GasPrice()
+	if gasPrice == nil || gasPrice.Sign() == 0 {
+		var err error
+		if gasPrice, err = eth.GetGasPrice(ctx, inflight.rpc); err != nil {
+			return nil, err
+		}
+	}
+	return p.bumpFee(gasPrice)
+}
+
+// bumpedDynamicFees returns the fees to resend a dynamic fee transaction with. Both fees
+// are bumped, as a node only accepts a replacement that raises both. A transaction sent
+// without a priority fee is resent with a bump of the priority fee suggested by the node
+func (p *txnProcessor) bumpedDynamicFees(ctx context.Context, inflight *inflightTxn, tx *eth.Txn) (maxFee, priorityFee *big.Int, err error) {
+	if maxFee, err = p.bumpFee(tx.MaxFeePerGas); err != nil {
+		return nil, nil, err
+	}
+	priorityFee = tx.MaxPriorityFeePerGas
+	if priorityFee == nil {
+		if priorityFee, err = eth.GetMaxPriorityFee(ctx, inflight.rpc); err != nil {
+			return nil, nil, err
+		}
+	}
+	priorityFee = eth.BumpGasPrice(priorityFee, p.feeBumpPercent())
+	if priorityFee.Cmp(maxFee) > 0 {
+		priorityFee = maxFee
+	}
+	return maxFee, priorityFee, nil
+}
+
+func (p *txnProcessor) feeBumpPercent() int {
+	if p.conf.FeeBump.Percent <= 0 {
+		return defaultFeeBumpPercent
+	}
+	return p.conf.FeeBump.Percent
+}
+
+// bumpFee raises a fee by the configured percentage, up to the configured maximum
+func (p *txnProcessor) bumpFee(fee *big.Int) (*big.Int, error) {
+	bumped := eth.BumpGasPrice(fee, p.feeBumpPercent())
+	if p.conf.FeeBump.MaxGasPrice != "" {
+		maxGasPrice, ok := new(big.Int).SetString(p.conf.FeeBump.MaxGasPrice, 10)
+		if !ok {
+			return nil, errors.Errorf(errors.TransactionSendFeeBumpBadMaxGasPrice, p.conf.FeeBump.MaxGasPrice)
+		}
+		if fee.Cmp(maxGasPrice) >= 0 {
+			return nil, errors.Errorf(errors.TransactionSendFeeBumpMaxGasPrice, fee.String(), maxGasPrice.String())
+		}
+		if bumped.Cmp(maxGasPrice) > 0 {
+			bumped = maxGasPrice
+		}
+	}
+	return bumped, nil
+}
+
+// sendWithFeeBump sends a transaction, and if the node rejects it as underpriced, resends it
+// with a higher gas price up to the configured number of attempts. This only applies to
+// transactions with a nonce assigned by ethconnect, as otherwise the failed nonce is not
+// reserved for the resend, and not on a chain that requires a gas price of zero. The error from
+// the last send is returned
+func (p *txnProcessor) sendWithFeeBump(ctx context.Context, inflight *inflightTxn, tx *eth.Txn) error {
+	err := tx.Send(ctx, inflight.rpc)
+	for attempt := 1; err != nil && attempt <= p.conf.FeeBump.MaxAttempts && !inflight.nodeAssignNonce && !p.zeroGasPrice() && isFeeBumpError(err); attempt++ {
+		if tx.IsDynamicFee() {
+			maxFee, priorityFee, bumpErr := p.bumpedDynamicFees(ctx, inflight, tx)
+			if bumpErr != nil {
+				log.Warnf("In-flight %d cannot be resent with higher fees: %s", inflight.id, bumpErr)
+				break
+			}
+			log.Infof("In-flight %d resending nonce=%d with maxFeePerGas=%s maxPriorityFeePerGas=%s (attempt %d/%d) after: %s", inflight.id, inflight.nonce, maxFee.String(), priorityFee.String(), attempt, p.conf.FeeBump.MaxAttempts, err)
+			tx.MaxFeePerGas = maxFee
+			tx.MaxPriorityFeePerGas = priorityFee
+		} else {
+			gasPrice, bumpErr := p.bumpedGasPrice(ctx, inflight, tx)
+			if bumpErr != nil {
+				log.Warnf("In-flight %d cannot be resent with a higher gas price: %s", inflight.id, bumpErr)
+				break
+			}
+			log.Infof("In-flight %d resending nonce=%d with gasPrice=%s (attempt %d/%d) after: %s", inflight.id, inflight.nonce, gasPrice.String(), attempt, p.conf.FeeBump.MaxAttempts, err)
+			tx.SetGasPrice(gasPrice)
+		}
+		err = tx.Send(ctx, inflight.rpc)
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// feeBumpRPC rejects the first sends of a transaction, and records the fees of each send
+type feeBumpRPC struct {
+	sendErrs       []error
+	gasPrices      []int64
+	gasPrice       int64
+	gasPriceErr    error
+	gasPriceCall   bool
+	maxFees        []int64
+	priorityFees   []int64
+	priorityFee    int64
+	priorityFeeErr error
+	baseFee        *big.Int
+	blockErr       error
+	blockCalls     int
+}
+
+func (r *feeBumpRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_sendTransaction":
+		sendTX := args[0].(*eth.SendTXArgs)
+		if sendTX.GasPrice != nil {
+			r.gasPrices = append(r.gasPrices, sendTX.GasPrice.ToInt().Int64())
+		}
+		if sendTX.MaxFeePerGas != nil {
+			r.maxFees = append(r.maxFees, sendTX.MaxFeePerGas.ToInt().Int64())
+		}
+		if sendTX.MaxPriorityFeePerGas != nil {
+			r.priorityFees = append(r.priorityFees, sendTX.MaxPriorityFeePerGas.ToInt().Int64())
+		}
+		*(result.(*string)) = "0x12345"
+		if len(r.sendErrs) > 0 {
+			err := r.sendErrs[0]
+			r.sendErrs = r.sendErrs[1:]
+			return err
+		}
+		return nil
+	case "eth_gasPrice":
+		r.gasPriceCall = true
+		result.(*ethbinding.HexBigInt).ToInt().SetInt64(r.gasPrice)
+		return r.gasPriceErr
+	case "eth_maxPriorityFeePerGas":
+		result.(*ethbinding.HexBigInt).ToInt().SetInt64(r.priorityFee)
+		return r.priorityFeeErr
+	case "eth_getBlockByNumber":
+		r.blockCalls++
+		b, _ := json.Marshal(map[string]interface{}{"baseFeePerGas": (*ethbinding.HexBigInt)(r.baseFee)})
+		json.Unmarshal(b, result)
+		return r.blockErr
+	}
+	panic(fmt.Errorf("method unknown to test: %s", method))
+}
+
+func newFeeBumpTestTxn(gasPrice int64) *eth.Txn {
+	to := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	return &eth.Txn{
+		From:  ethbind.API.HexToAddress(testFromAddr),
+		EthTX: ethbind.API.NewTransaction(5, to, big.NewInt(0), 21000, big.NewInt(gasPrice), []byte{}),
+	}
+}
+
+func TestSendWithFeeBump(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 3}}}
+	rpc := &feeBumpRPC{sendErrs: []error{
+		fmt.Errorf("replacement transaction underpriced"),
+		fmt.Errorf("transaction underpriced"),
+	}}
+	inflight := &inflightTxn{rpc: rpc, nonce: 5}
+
+	tx := newFeeBumpTestTxn(1000)
+	err := p.sendWithFeeBump(context.Background(), inflight, tx)
+	assert.NoError(err)
+	assert.Equal([]int64{1000, 1100, 1210}, rpc.gasPrices)
+	assert.Equal(int64(1210), tx.EthTX.GasPrice().Int64())
+	assert.Equal(uint64(5), tx.EthTX.Nonce())
+}
+
+func TestSendWithFeeBumpMaxAttempts(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 2, Percent: 50}}}
+	rpc := &feeBumpRPC{sendErrs: []error{
+		fmt.Errorf("already known"),
+		fmt.Errorf("already known"),
+		fmt.Errorf("already known"),
+	}}
+	inflight := &inflightTxn{rpc: rpc}
+
+	err := p.sendWithFeeBump(context.Background(), inflight, newFeeBumpTestTxn(1000))
+	assert.Regexp("already known", err)
+	assert.Equal([]int64{1000, 1500, 2250}, rpc.gasPrices)
+}
+
+func TestSendWithFeeBumpMaxGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 5, MaxGasPrice: "1150"}}}
+	rpc := &feeBumpRPC{sendErrs: []error{
+		fmt.Errorf("transaction underpriced"),
+		fmt.Errorf("transaction underpriced"),
+		fmt.Errorf("transaction underpriced"),
+	}}
+	inflight := &inflightTxn{rpc: rpc}
+
+	err := p.sendWithFeeBump(context.Background(), inflight, newFeeBumpTestTxn(1000))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{1000, 1100, 1150}, rpc.gasPrices)
+
+	_, err = p.bumpedGasPrice(context.Background(), inflight, newFeeBumpTestTxn(1150))
+	assert.Regexp("FFEC100318.*1150", err)
+
+	p.conf.FeeBump.MaxGasPrice = "bad"
+	_, err = p.bumpedGasPrice(context.Background(), inflight, newFeeBumpTestTxn(1000))
+	assert.Regexp("FFEC100319", err)
+}
+
+func TestSendWithFeeBumpNodeGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 1}}}
+	rpc := &feeBumpRPC{gasPrice: 2000, sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+	inflight := &inflightTxn{rpc: rpc}
+
+	err := p.sendWithFeeBump(context.Background(), inflight, newFeeBumpTestTxn(0))
+	assert.NoError(err)
+	assert.True(rpc.gasPriceCall)
+	assert.Equal([]int64{0, 2200}, rpc.gasPrices)
+
+	rpc = &feeBumpRPC{gasPriceErr: fmt.Errorf("pop"), sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+	inflight.rpc = rpc
+	err = p.sendWithFeeBump(context.Background(), inflight, newFeeBumpTestTxn(0))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{0}, rpc.gasPrices)
+}
+
+func TestSendWithFeeBumpNotApplicable(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{FeeBump: FeeBumpConf{MaxAttempts: 3}}}
+
+	// Other errors are not retried
+	rpc := &feeBumpRPC{sendErrs: []error{fmt.Errorf("insufficient funds for gas * price + value")}}
+	err := p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, newFeeBumpTestTxn(1000))
+	assert.Regexp("insufficient funds", err)
+	assert.Equal([]int64{1000}, rpc.gasPrices)
+
+	// Nor are transactions with a nonce assigned by the node
+	rpc = &feeBumpRPC{sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+	err = p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc, nodeAssignNonce: true}, newFeeBumpTestTxn(1000))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{1000}, rpc.gasPrices)
+
+	// Nor is anything retried when disabled
+	p.conf.FeeBump.MaxAttempts = 0
+	rpc = &feeBumpRPC{sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+	err = p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, newFeeBumpTestTxn(1000))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{1000}, rpc.gasPrices)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+)
+
+// InflightAddress is the state ethconnect holds for the transactions it has in-flight from an
+// address, for diagnosing transactions that are stuck behind a nonce
+type InflightAddress struct {
+	Address      string                       `json:"address"`
+	HighestNonce json.Number                  `json:"highestNonce"`
+	GapFill      *GapFillStatus               `json:"gapFill,omitempty"`
+	Transactions []*InflightTransactionStatus `json:"transactions"`
+}
+
+// InflightTransactionStatus is an in-flight transaction, with how long it has been tracked,
+// and how many times its receipt has been checked
+type InflightTransactionStatus struct {
+	ID              int         `json:"id"`
+	RequestID       string      `json:"requestId,omitempty"`
+	Nonce           json.Number `json:"nonce,omitempty"`
+	NodeAssignNonce bool        `json:"nodeAssignNonce,omitempty"`
+	Hash            string      `json:"hash,omitempty"`
+	Since           string      `json:"since"`
+	ElapsedSec      float64     `json:"elapsedSec"`
+	Retries         int         `json:"retries"`
+	ReplacedHashes  []string    `json:"replacedHashes,omitempty"`
+	Cancelling      bool        `json:"cancelling,omitempty"`
+}
+
+// GapFillStatus is the last gap-fill transaction submitted for an address, to fill the nonce of
+// a transaction that failed to send while transactions with higher nonces were in-flight
+type GapFillStatus struct {
+	Nonce     json.Number `json:"nonce"`
+	Hash      string      `json:"hash"`
+	Succeeded bool        `json:"succeeded"`
+	Time      string      `json:"time"`
+}
+
+// InflightTransactions returns the in-flight transactions of every address, or of a single
+// address when one is supplied. The transactions of each address are in nonce order
+func (p *txnProcessor) InflightTransactions(addr string) ([]*InflightAddress, error) {
+	fromStr := ""
+	if addr != "" {
+		from, err := utils.StrToAddress("address", addr)
+		if err != nil {
+			return nil, err
+		}
+		fromStr = strings.ToLower(from.Hex())
+	}
+
+	now := time.Now()
+	result := []*InflightAddress{}
+	p.inflightTxnsLock.Lock()
+	for from, inflightForAddr := range p.inflightTxns {
+		if fromStr != "" && from != fromStr {
+			continue
+		}
+		ia := &InflightAddress{
+			Address:      from,
+			HighestNonce: json.Number(strconv.FormatInt(inflightForAddr.highestNonce, 10)),
+			GapFill:      inflightForAddr.gapFill,
+			Transactions: make([]*InflightTransactionStatus, 0, len(inflightForAddr.txnsInFlight)),
+		}
+		for _, inflight := range inflightForAddr.txnsInFlight {
+			ia.Transactions = append(ia.Transactions, inflight.status(now))
+		}
+		sort.SliceStable(ia.Transactions, func(i, j int) bool {
+			ni, errI := ia.Transactions[i].Nonce.Int64()
+			nj, errJ := ia.Transactions[j].Nonce.Int64()
+			if errI != nil || errJ != nil {
+				return errI == nil
+			}
+			return ni < nj
+		})
+		result = append(result, ia)
+	}
+	p.inflightTxnsLock.Unlock()
+
+	if fromStr != "" && len(result) == 0 {
+		result = append(result, &InflightAddress{
+			Address:      fromStr,
+			HighestNonce: "-1",
+			Transactions: []*InflightTransactionStatus{},
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Address < result[j].Address })
+	return result, nil
+}
+
+// status must be called holding the in-flight lock
+func (i *inflightTxn) status(now time.Time) *InflightTransactionStatus {
+	s := &InflightTransactionStatus{
+		ID:              i.id,
+		RequestID:       i.txnContext.Headers().ID,
+		NodeAssignNonce: i.nodeAssignNonce,
+		Since:           i.added.UTC().Format(time.RFC3339Nano),
+		ElapsedSec:      now.Sub(i.added).Seconds(),
+		Retries:         i.receiptChecks,
+		Cancelling:      i.cancellation != nil,
+	}
+	if !i.nodeAssignNonce {
+		s.Nonce = i.nonceNumber()
+	}
+	if i.tx != nil {
+		s.Hash = i.tx.Hash
+	}
+	for _, replaced := range i.replaced {
+		s.ReplacedHashes = append(s.ReplacedHashes, replaced.Hash)
+	}
+	return s
+}
+
+// recordGapFill records the outcome of a gap-fill on the address, which still has
+// the transactions with higher nonces in-flight
+func (p *txnProcessor) recordGapFill(inflight *inflightTxn) {
+	p.inflightTxnsLock.Lock()
+	defer p.inflightTxnsLock.Unlock()
+	if inflightForAddr, exists := p.inflightTxns[inflight.from]; exists {
+		inflightForAddr.gapFill = &GapFillStatus{
+			Nonce:     inflight.nonceNumber(),
+			Hash:      inflight.gapFillTxHash,
+			Succeeded: inflight.gapFillSucceeded,
+			Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		}
+	}
+}
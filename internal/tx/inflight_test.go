@@ -0,0 +1,104 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInflightTransactions(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	added := time.Now().Add(-10 * time.Second)
+	state := p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"]
+	state.txnsInFlight[0].added = added
+	state.txnsInFlight[0].receiptChecks = 3
+	state.txnsInFlight[0].replaced = []*eth.Txn{{Hash: "0xaaaa"}}
+	state.txnsInFlight[0].cancellation = &cancellation{}
+	state.txnsInFlight = append([]*inflightTxn{state.txnsInFlight[1]}, state.txnsInFlight[0], state.txnsInFlight[2])
+	p.inflightTxns["0x0000000000000000000000000000000000000001"] = &inflightTxnState{highestNonce: 1}
+
+	inflight, err := p.InflightTransactions("")
+	assert.NoError(err)
+	assert.Equal(2, len(inflight))
+	assert.Equal("0x0000000000000000000000000000000000000001", inflight[0].Address)
+	assert.Empty(inflight[0].Transactions)
+
+	ia := inflight[1]
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", ia.Address)
+	assert.Equal(json.Number("12"), ia.HighestNonce)
+	assert.Nil(ia.GapFill)
+	assert.Equal(3, len(ia.Transactions))
+	txn := ia.Transactions[0]
+	assert.Equal(1, txn.ID)
+	assert.Equal("req1", txn.RequestID)
+	assert.Equal(json.Number("11"), txn.Nonce)
+	assert.Equal("0xbbbb", txn.Hash)
+	assert.Equal(added.UTC().Format(time.RFC3339Nano), txn.Since)
+	assert.GreaterOrEqual(txn.ElapsedSec, float64(10))
+	assert.Equal(3, txn.Retries)
+	assert.Equal([]string{"0xaaaa"}, txn.ReplacedHashes)
+	assert.True(txn.Cancelling)
+	assert.Equal(json.Number("12"), ia.Transactions[1].Nonce)
+	assert.Empty(ia.Transactions[1].Hash)
+	assert.Equal(json.Number(""), ia.Transactions[2].Nonce)
+	assert.True(ia.Transactions[2].NodeAssignNonce)
+}
+
+func TestInflightTransactionsForAddress(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+
+	inflight, err := p.InflightTransactions("83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1")
+	assert.NoError(err)
+	assert.Equal(1, len(inflight))
+	assert.Equal(3, len(inflight[0].Transactions))
+
+	inflight, err = p.InflightTransactions("0x0000000000000000000000000000000000000001")
+	assert.NoError(err)
+	assert.Equal(1, len(inflight))
+	assert.Equal("0x0000000000000000000000000000000000000001", inflight[0].Address)
+	assert.Equal(json.Number("-1"), inflight[0].HighestNonce)
+	assert.Empty(inflight[0].Transactions)
+
+	_, err = p.InflightTransactions("badness")
+	assert.Regexp("Supplied value for 'address' is not a valid hex address", err)
+}
+
+func TestRecordGapFill(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+
+	p.recordGapFill(&inflightTxn{from: "0x0000000000000000000000000000000000000001", nonce: 10})
+
+	p.recordGapFill(&inflightTxn{
+		from:             "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1",
+		nonce:            10,
+		gapFillTxHash:    "0xffff",
+		gapFillSucceeded: true,
+	})
+	inflight, err := p.InflightTransactions("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1")
+	assert.NoError(err)
+	gapFill := inflight[0].GapFill
+	assert.Equal(json.Number("10"), gapFill.Nonce)
+	assert.Equal("0xffff", gapFill.Hash)
+	assert.True(gapFill.Succeeded)
+	assert.NotEmpty(gapFill.Time)
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/alecthomas/template"
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	integrationHDWallet    = "hdWallet"
+	integrationAddressBook = "addressBook"
+)
+
+// IntegrationUpdate is the result of replacing the configuration of an integration at runtime
+type IntegrationUpdate struct {
+	Integration     string `json:"integration"`
+	Enabled         bool   `json:"enabled"`
+	Probe           string `json:"probe,omitempty"`
+	ResolvedAddress string `json:"resolvedAddress,omitempty"`
+}
+
+func (p *txnProcessor) getHDWallet() HDWallet {
+	p.integrationsLock.RLock()
+	defer p.integrationsLock.RUnlock()
+	return p.hdwallet
+}
+
+func (p *txnProcessor) getAddressBook() AddressBook {
+	p.integrationsLock.RLock()
+	defer p.integrationsLock.RUnlock()
+	return p.addressBook
+}
+
+// UpdateHDWallet replaces the HD wallet configuration, once a signing key has been obtained
+// from the new configuration for the probe 'from' address. An empty URL template disables
+// HD wallet signing. Transactions already signed are unaffected
+func (p *txnProcessor) UpdateHDWallet(conf *HDWalletConf, probe string) (*IntegrationUpdate, error) {
+	update := &IntegrationUpdate{Integration: integrationHDWallet}
+	if conf.URLTemplate == "" {
+		p.integrationsLock.Lock()
+		p.hdwallet = nil
+		p.integrationsLock.Unlock()
+		log.Infof("HD wallet signing disabled")
+		return update, nil
+	}
+
+	if _, err := template.New("urlTemplate").Parse(conf.URLTemplate); err != nil {
+		return nil, errors.Errorf(errors.HDWalletUpdateBadTemplate, err)
+	}
+	if _, ok := new(big.Int).SetString(conf.ChainID, 0); conf.ChainID != "" && !ok {
+		return nil, errors.Errorf(errors.HDWalletUpdateBadChainID, conf.ChainID)
+	}
+	request := IsHDWalletRequest(probe)
+	if request == nil {
+		return nil, errors.Errorf(errors.IntegrationUpdateProbeRequired, "'from' of the form HD-<instanceId>-<walletId>-<index>", integrationHDWallet)
+	}
+	hd := newHDWallet(conf)
+	signer, err := hd.SignerFor(request)
+	if err != nil {
+		return nil, errors.Errorf(errors.IntegrationUpdateProbeFailed, integrationHDWallet, err)
+	}
+
+	p.integrationsLock.Lock()
+	p.hdwallet = hd
+	p.integrationsLock.Unlock()
+	log.Infof("HD wallet configuration updated (probe %s resolved to %s)", probe, signer.Address())
+	update.Enabled = true
+	update.Probe = probe
+	update.ResolvedAddress = signer.Address()
+	return update, nil
+}
+
+// UpdateAddressBook replaces the address book configuration, once the new configuration has
+// looked up the probe address and connected to the node it resolves to. An empty URL prefix
+// disables the address book. Connections the in-flight transactions use are left open, so they
+// continue to be tracked on the node they were submitted to
+func (p *txnProcessor) UpdateAddressBook(ctx context.Context, conf *AddressBookConf, probe string) (*IntegrationUpdate, error) {
+	update := &IntegrationUpdate{Integration: integrationAddressBook}
+	if conf.AddressbookURLPrefix == "" {
+		p.integrationsLock.Lock()
+		p.addressBook = nil
+		p.integrationsLock.Unlock()
+		log.Infof("Address book disabled")
+		return update, nil
+	}
+
+	if u, err := url.Parse(conf.AddressbookURLPrefix); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf(errors.AddressBookUpdateBadURL, conf.AddressbookURLPrefix)
+	}
+	if probe == "" {
+		return nil, errors.Errorf(errors.IntegrationUpdateProbeRequired, "address", integrationAddressBook)
+	}
+	addr, err := utils.StrToAddress("probe", probe)
+	if err != nil {
+		return nil, err
+	}
+	probe = strings.ToLower(addr.Hex())
+	ab := NewAddressBook(conf, p.rpcConf).(*addressBook)
+	rpc, err := ab.lookup(ctx, probe)
+	if err == nil {
+		var netID string
+		err = rpc.CallContext(ctx, &netID, "net_version")
+	}
+	if err != nil {
+		ab.close()
+		return nil, errors.Errorf(errors.IntegrationUpdateProbeFailed, integrationAddressBook, err)
+	}
+
+	p.integrationsLock.Lock()
+	p.addressBook = ab
+	p.integrationsLock.Unlock()
+	log.Infof("Address book configuration updated (probe %s)", probe)
+	update.Enabled = true
+	update.Probe = probe
+	return update, nil
+}
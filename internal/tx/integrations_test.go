@@ -0,0 +1,217 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHDWalletServer() (*httptest.Server, string) {
+	key, _ := ethbind.API.GenerateKey()
+	addr := ethbind.API.PubkeyToAddress(key.PublicKey)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer rotated" {
+			res.WriteHeader(401)
+			return
+		}
+		res.WriteHeader(200)
+		res.Write([]byte(`{"address":"` + addr.String() + `","privateKey":"` + hex.EncodeToString(ethbind.API.FromECDSA(key)) + `"}`))
+	}))
+	return svr, addr.String()
+}
+
+func newTestAddressBookServer(failRPC bool) *httptest.Server {
+	var serverURL string
+	router := &httprouter.Router{}
+	router.POST("/", func(res http.ResponseWriter, req *http.Request, parms httprouter.Params) {
+		if failRPC {
+			res.WriteHeader(500)
+			return
+		}
+		res.WriteHeader(200)
+		res.Write([]byte("{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":\"2109240103\"}"))
+	})
+	router.GET("/addresses/:address", func(res http.ResponseWriter, req *http.Request, parms httprouter.Params) {
+		res.WriteHeader(200)
+		res.Write([]byte("{\"endpoint\":\"" + serverURL + "\"}"))
+	})
+	server := httptest.NewServer(router)
+	serverURL = server.URL
+	return server
+}
+
+func newTestIntegrationsProcessor() *txnProcessor {
+	p := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	p.Init(nil)
+	return p
+}
+
+func TestUpdateHDWalletOK(t *testing.T) {
+	assert := assert.New(t)
+	svr, addr := newTestHDWalletServer()
+	defer svr.Close()
+	p := newTestIntegrationsProcessor()
+
+	update, err := p.UpdateHDWallet(&HDWalletConf{
+		HTTPRequesterConf: utils.HTTPRequesterConf{
+			Headers: map[string][]string{"Authorization": {"Bearer rotated"}},
+		},
+		URLTemplate: svr.URL + "/{{.InstanceID}}/{{.WalletID}}/{{.Index}}",
+		ChainID:     "12345",
+	}, "HD-inst-wallet-0")
+	assert.NoError(err)
+	assert.Equal(&IntegrationUpdate{
+		Integration:     "hdWallet",
+		Enabled:         true,
+		Probe:           "HD-inst-wallet-0",
+		ResolvedAddress: addr,
+	}, update)
+
+	resolved, err := p.ResolveAddress("HD-inst-wallet-1")
+	assert.NoError(err)
+	assert.Equal(addr, resolved)
+}
+
+func TestUpdateHDWalletDisable(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+	p.hdwallet = newHDWallet(&HDWalletConf{URLTemplate: "http://localhost"})
+
+	update, err := p.UpdateHDWallet(&HDWalletConf{}, "")
+	assert.NoError(err)
+	assert.False(update.Enabled)
+
+	_, err = p.ResolveAddress("HD-inst-wallet-1")
+	assert.Regexp("No HD Wallet Configuration", err)
+}
+
+func TestUpdateHDWalletBadTemplate(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+
+	_, err := p.UpdateHDWallet(&HDWalletConf{URLTemplate: "http://localhost/{{.InstanceID"}, "HD-inst-wallet-0")
+	assert.Regexp("Invalid HD wallet URL template", err)
+}
+
+func TestUpdateHDWalletBadChainID(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+
+	_, err := p.UpdateHDWallet(&HDWalletConf{URLTemplate: "http://localhost", ChainID: "chain"}, "HD-inst-wallet-0")
+	assert.Regexp("Invalid HD wallet chain ID 'chain'", err)
+}
+
+func TestUpdateHDWalletProbeRequired(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+
+	_, err := p.UpdateHDWallet(&HDWalletConf{URLTemplate: "http://localhost"}, "0x4a2a2b0bd6cd3d7ff8ab0e0b2c2ac63d62d3ba1f")
+	assert.Regexp("A probe 'from' of the form HD-<instanceId>-<walletId>-<index> is required to validate the hdWallet configuration", err)
+}
+
+func TestUpdateHDWalletProbeFailedKeepsExisting(t *testing.T) {
+	assert := assert.New(t)
+	svr, _ := newTestHDWalletServer()
+	defer svr.Close()
+	p := newTestIntegrationsProcessor()
+	existing := newHDWallet(&HDWalletConf{URLTemplate: "http://localhost"})
+	p.hdwallet = existing
+
+	_, err := p.UpdateHDWallet(&HDWalletConf{
+		URLTemplate: svr.URL + "/{{.InstanceID}}/{{.WalletID}}/{{.Index}}",
+	}, "HD-inst-wallet-0")
+	assert.Regexp("Validation probe of the hdWallet configuration failed: .*HDWallet signing failed", err)
+	assert.Equal(existing, p.getHDWallet())
+}
+
+func TestUpdateAddressBookOK(t *testing.T) {
+	assert := assert.New(t)
+	svr := newTestAddressBookServer(false)
+	defer svr.Close()
+	p := newTestIntegrationsProcessor()
+
+	update, err := p.UpdateAddressBook(context.Background(), &AddressBookConf{
+		AddressbookURLPrefix: svr.URL + "/addresses",
+	}, "0x4A2A2B0BD6CD3D7FF8AB0E0B2C2AC63D62D3BA1F")
+	assert.NoError(err)
+	assert.Equal(&IntegrationUpdate{
+		Integration: "addressBook",
+		Enabled:     true,
+		Probe:       "0x4a2a2b0bd6cd3d7ff8ab0e0b2c2ac63d62d3ba1f",
+	}, update)
+
+	ab := p.getAddressBook().(*addressBook)
+	assert.Equal(svr.URL, ab.addrToHost["0x4a2a2b0bd6cd3d7ff8ab0e0b2c2ac63d62d3ba1f"])
+}
+
+func TestUpdateAddressBookDisable(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+	p.addressBook = NewAddressBook(&AddressBookConf{AddressbookURLPrefix: "http://localhost"}, &eth.RPCConf{})
+
+	update, err := p.UpdateAddressBook(context.Background(), &AddressBookConf{}, "")
+	assert.NoError(err)
+	assert.False(update.Enabled)
+	assert.Nil(p.getAddressBook())
+}
+
+func TestUpdateAddressBookBadURL(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+
+	_, err := p.UpdateAddressBook(context.Background(), &AddressBookConf{AddressbookURLPrefix: "addresses"}, "0x4a2a2b0bd6cd3d7ff8ab0e0b2c2ac63d62d3ba1f")
+	assert.Regexp("Invalid address book URL prefix 'addresses'", err)
+}
+
+func TestUpdateAddressBookProbeRequired(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+
+	_, err := p.UpdateAddressBook(context.Background(), &AddressBookConf{AddressbookURLPrefix: "http://localhost"}, "")
+	assert.Regexp("A probe address is required to validate the addressBook configuration", err)
+}
+
+func TestUpdateAddressBookBadProbe(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestIntegrationsProcessor()
+
+	_, err := p.UpdateAddressBook(context.Background(), &AddressBookConf{AddressbookURLPrefix: "http://localhost"}, "bad")
+	assert.Regexp("Supplied value for 'probe' is not a valid hex address", err)
+}
+
+func TestUpdateAddressBookProbeFailedKeepsExisting(t *testing.T) {
+	assert := assert.New(t)
+	svr := newTestAddressBookServer(true)
+	defer svr.Close()
+	p := newTestIntegrationsProcessor()
+	existing := NewAddressBook(&AddressBookConf{AddressbookURLPrefix: "http://localhost"}, &eth.RPCConf{})
+	p.addressBook = existing
+
+	_, err := p.UpdateAddressBook(context.Background(), &AddressBookConf{
+		AddressbookURLPrefix: svr.URL + "/addresses",
+	}, "0x4a2a2b0bd6cd3d7ff8ab0e0b2c2ac63d62d3ba1f")
+	assert.Regexp("Validation probe of the addressBook configuration failed", err)
+	assert.Equal(existing, p.getAddressBook())
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// LifecycleAccepted is emitted when a transaction request is received by the processor
+	LifecycleAccepted = "accepted"
+	// LifecycleNonceAssigned is emitted once the transaction is in-flight, with its nonce when assigned by the processor
+	LifecycleNonceAssigned = "nonceAssigned"
+	// LifecycleSent is emitted when the transaction has been submitted to the node, with its hash
+	LifecycleSent = "sent"
+	// LifecycleReceiptPending is emitted each time the receipt is checked for and not yet available
+	LifecycleReceiptPending = "receiptPending"
+	// LifecycleReplaced is emitted when the transaction has been sped up, with the hash of the replacement
+	LifecycleReplaced = "replaced"
+	// LifecycleCancelled is emitted when a cancellation has been sent for the transaction, with the hash of the cancellation
+	LifecycleCancelled = "cancelled"
+	// LifecycleMined is emitted when the receipt is available, whether the transaction succeeded or reverted
+	LifecycleMined = "mined"
+	// LifecycleFailed is emitted when an error reply is sent for the transaction
+	LifecycleFailed = "failed"
+
+	defaultLifecycleBufferSize = 1000
+	lifecycleMaxBatchSize      = 100
+	lifecycleWebhookTimeout    = 30 * time.Second
+)
+
+// LifecycleConf configures where intermediate transaction lifecycle events are sent
+type LifecycleConf struct {
+	WebhookURL string `json:"webhookURL,omitempty"`
+	KafkaTopic string `json:"kafkaTopic,omitempty"`
+	BufferSize int    `json:"bufferSize,omitempty"`
+}
+
+// LifecycleEvent records a step in the processing of a transaction, for monitoring
+type LifecycleEvent struct {
+	Type            string `json:"type"`
+	RequestID       string `json:"requestId"`
+	MsgType         string `json:"msgType,omitempty"`
+	From            string `json:"from,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+	TransactionHash string `json:"transactionHash,omitempty"`
+	Retry           int    `json:"retry,omitempty"`
+	BlockNumber     string `json:"blockNumber,omitempty"`
+	Status          string `json:"status,omitempty"`
+	Error           string `json:"error,omitempty"`
+	Timestamp       string `json:"timestamp"`
+}
+
+// LifecycleSink delivers batches of lifecycle events to a monitoring system
+type LifecycleSink interface {
+	SendLifecycleEvents(events []*LifecycleEvent) error
+}
+
+// lifecycleEmitter buffers lifecycle events, and delivers them to the sinks in the background.
+// Events are best effort, so they are dropped rather than slowing down transaction
+// processing when the buffer is full, and are not retried if a sink fails
+type lifecycleEmitter struct {
+	sinks   []LifecycleSink
+	events  chan *LifecycleEvent
+	dropped uint64
+}
+
+func newLifecycleEmitter(bufferSize int) *lifecycleEmitter {
+	if bufferSize <= 0 {
+		bufferSize = defaultLifecycleBufferSize
+	}
+	e := &lifecycleEmitter{
+		events: make(chan *LifecycleEvent, bufferSize),
+	}
+	go e.deliveryLoop()
+	return e
+}
+
+func (e *lifecycleEmitter) emit(event *LifecycleEvent) {
+	select {
+	case e.events <- event:
+	default:
+		if dropped := atomic.AddUint64(&e.dropped, 1); dropped%100 == 1 {
+			log.Warnf("Transaction lifecycle event buffer full. Dropped %d events", dropped)
+		}
+	}
+}
+
+func (e *lifecycleEmitter) deliveryLoop() {
+	for event := range e.events {
+		batch := []*LifecycleEvent{event}
+	drain:
+		for len(batch) < lifecycleMaxBatchSize {
+			select {
+			case event, ok := <-e.events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, event)
+			default:
+				break drain
+			}
+		}
+		for _, sink := range e.sinks {
+			if err := sink.SendLifecycleEvents(batch); err != nil {
+				log.Warnf("Failed to deliver %d transaction lifecycle events: %s", len(batch), err)
+			}
+		}
+	}
+}
+
+// lifecycleWebhook POSTs each batch of lifecycle events to a URL as a JSON array
+type lifecycleWebhook struct {
+	url    string
+	client *http.Client
+}
+
+func newLifecycleWebhook(url string) *lifecycleWebhook {
+	return &lifecycleWebhook{
+		url:    url,
+		client: &http.Client{Timeout: lifecycleWebhookTimeout},
+	}
+}
+
+func (w *lifecycleWebhook) SendLifecycleEvents(events []*LifecycleEvent) error {
+	b, _ := json.Marshal(events)
+	res, err := w.client.Post(w.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.TransactionLifecycleWebhookFailed, w.url, res.StatusCode)
+	}
+	return nil
+}
+
+// AddLifecycleSink adds a destination for transaction lifecycle events, in addition to
+// the webhook in the configuration. Must be called before messages are processed
+func (p *txnProcessor) AddLifecycleSink(sink LifecycleSink) {
+	if p.lifecycle == nil {
+		p.lifecycle = newLifecycleEmitter(p.conf.Lifecycle.BufferSize)
+	}
+	p.lifecycle.sinks = append(p.lifecycle.sinks, sink)
+}
+
+// emitLifecycle fills in the common fields of a lifecycle event from the request and
+// in-flight transaction (if there is one yet), and queues it for delivery
+func (p *txnProcessor) emitLifecycle(txnContext TxnContext, inflight *inflightTxn, event *LifecycleEvent) {
+	if p.lifecycle == nil {
+		return
+	}
+	headers := txnContext.Headers()
+	event.RequestID = headers.ID
+	event.MsgType = headers.MsgType
+	event.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	if inflight != nil {
+		event.From = inflight.from
+		if !inflight.nodeAssignNonce {
+			event.Nonce = inflight.nonceNumber().String()
+		}
+		if inflight.tx != nil {
+			event.TransactionHash = inflight.tx.Hash
+		}
+	}
+	p.lifecycle.emit(event)
+}
+
+// emitLifecycleFailed emits a failed lifecycle event for an error reply
+func (p *txnProcessor) emitLifecycleFailed(txnContext TxnContext, inflight *inflightTxn, err error) {
+	p.emitLifecycle(txnContext, inflight, &LifecycleEvent{
+		Type:  LifecycleFailed,
+		Error: errors.ToRESTError(err).Message,
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLifecycleSink struct {
+	lock   sync.Mutex
+	events []*LifecycleEvent
+	err    error
+}
+
+func (s *testLifecycleSink) SendLifecycleEvents(events []*LifecycleEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, events...)
+	return s.err
+}
+
+func (s *testLifecycleSink) waitFor(eventType string) []*LifecycleEvent {
+	for {
+		s.lock.Lock()
+		events := s.events
+		s.lock.Unlock()
+		if len(events) > 0 && events[len(events)-1].Type == eventType {
+			return events
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func lifecycleTypes(events []*LifecycleEvent) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestLifecycleEventsMined(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	sink := &testLifecycleSink{}
+	txnProcessor.AddLifecycleSink(sink)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	events := sink.waitFor(LifecycleMined)
+	assert.Equal([]string{LifecycleAccepted, LifecycleNonceAssigned, LifecycleSent, LifecycleMined}, lifecycleTypes(events))
+	for _, event := range events {
+		assert.Equal("SendTransaction", event.MsgType)
+		assert.NotEmpty(event.Timestamp)
+	}
+	assert.Equal("", events[0].From)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", events[1].From)
+	assert.Equal("", events[1].Nonce) // assigned by the node
+	assert.Equal(testRPC.ethSendTransactionResult, events[2].TransactionHash)
+	assert.Equal(testRPC.ethSendTransactionResult, events[3].TransactionHash)
+	assert.Equal("12345", events[3].BlockNumber)
+	assert.Equal("1", events[3].Status)
+}
+
+func TestLifecycleEventsReceiptTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	txHash := "0xac18e98664e160305cdb77e75e5eae32e55447e94ad8ceb0123729589ed09f8b"
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:     1,
+		AlwaysManageNonce: true,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	sink := &testLifecycleSink{}
+	txnProcessor.AddLifecycleSink(sink)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	testRPC := &testRPC{
+		ethSendTransactionResult:     txHash,
+		ethGetTransactionCountResult: 10,
+	}
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	events := sink.waitFor(LifecycleFailed)
+	assert.Equal(LifecycleNonceAssigned, events[1].Type)
+	assert.Equal("10", events[1].Nonce)
+	assert.Equal(LifecycleReceiptPending, events[3].Type)
+	assert.Equal(1, events[3].Retry)
+	failed := events[len(events)-1]
+	assert.Equal(txHash, failed.TransactionHash)
+	assert.Regexp("Timed out waiting for transaction receipt", failed.Error)
+}
+
+func TestLifecycleEventsSendFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	sink := &testLifecycleSink{}
+	txnProcessor.AddLifecycleSink(sink)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.Init(&testRPC{
+		ethSendTransactionErr: fmt.Errorf("pop"),
+	})
+
+	txnProcessor.OnMessage(testTxnContext)
+	events := sink.waitFor(LifecycleFailed)
+	assert.Equal([]string{LifecycleAccepted, LifecycleNonceAssigned, LifecycleFailed}, lifecycleTypes(events))
+	assert.Equal("pop", events[2].Error)
+}
+
+func TestLifecycleEventsBadMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	sink := &testLifecycleSink{}
+	txnProcessor.AddLifecycleSink(sink)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.badMsgType = "badness"
+
+	txnProcessor.OnMessage(testTxnContext)
+	events := sink.waitFor(LifecycleFailed)
+	assert.Equal([]string{LifecycleAccepted, LifecycleFailed}, lifecycleTypes(events))
+	assert.Regexp("Unknown message type 'badness'", events[1].Error)
+}
+
+func TestLifecycleEmitterDropsWhenFull(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &lifecycleEmitter{events: make(chan *LifecycleEvent, 1)}
+	e.emit(&LifecycleEvent{Type: LifecycleAccepted})
+	e.emit(&LifecycleEvent{Type: LifecycleSent})
+	e.emit(&LifecycleEvent{Type: LifecycleMined})
+	assert.Equal(uint64(2), e.dropped)
+	assert.Equal(LifecycleAccepted, (<-e.events).Type)
+}
+
+func TestLifecycleEmitterBatchesAndContinuesOnError(t *testing.T) {
+	assert := assert.New(t)
+
+	sink1 := &testLifecycleSink{err: fmt.Errorf("pop")}
+	sink2 := &testLifecycleSink{}
+	e := &lifecycleEmitter{
+		sinks:  []LifecycleSink{sink1, sink2},
+		events: make(chan *LifecycleEvent, 3),
+	}
+	e.emit(&LifecycleEvent{Type: LifecycleAccepted})
+	e.emit(&LifecycleEvent{Type: LifecycleNonceAssigned})
+	e.emit(&LifecycleEvent{Type: LifecycleSent})
+	close(e.events)
+	e.deliveryLoop()
+	assert.Equal(3, len(sink1.events))
+	assert.Equal(3, len(sink2.events))
+}
+
+func TestLifecycleWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	status := 204
+	var received []*LifecycleEvent
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		json.Unmarshal(b, &received)
+		res.WriteHeader(status)
+	}))
+	defer svr.Close()
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		Lifecycle: LifecycleConf{WebhookURL: svr.URL},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	assert.Equal(1, len(txnProcessor.lifecycle.sinks))
+	w := txnProcessor.lifecycle.sinks[0]
+
+	err := w.SendLifecycleEvents([]*LifecycleEvent{{Type: LifecycleAccepted, RequestID: "req1"}})
+	assert.NoError(err)
+	assert.Equal("req1", received[0].RequestID)
+
+	status = 500
+	err = w.SendLifecycleEvents([]*LifecycleEvent{{Type: LifecycleAccepted, RequestID: "req1"}})
+	assert.Regexp("Transaction lifecycle webhook .* failed with status=500", err)
+
+	err = newLifecycleWebhook("http://localhost:0").SendLifecycleEvents([]*LifecycleEvent{})
+	assert.Error(err)
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+)
+
+// processableMsgTypes are the message types the processor can be restricted to
+var processableMsgTypes = []string{
+	messages.MsgTypeDeployContract,
+	messages.MsgTypeSendTransaction,
+	messages.MsgTypeSpeedUpTransaction,
+	messages.MsgTypeCancelTransaction,
+}
+
+// ValidateMessageTypes checks the message types an instance is restricted to, such as a hardened
+// instance that only deploys contracts from CI, and normalizes them to the case used in message headers.
+// An empty list processes every message type
+func ValidateMessageTypes(conf *TxnProcessorConf) error {
+	for i, msgType := range conf.MessageTypes {
+		valid := false
+		for _, processable := range processableMsgTypes {
+			if strings.EqualFold(strings.TrimSpace(msgType), processable) {
+				conf.MessageTypes[i] = processable
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.Errorf(errors.ConfigInvalidMessageType, msgType, strings.Join(processableMsgTypes, ","))
+		}
+	}
+	return nil
+}
+
+// msgTypeAllowed returns true if the instance is configured to process messages of the type
+func (p *txnProcessor) msgTypeAllowed(msgType string) bool {
+	if len(p.conf.MessageTypes) == 0 {
+		return true
+	}
+	for _, allowed := range p.conf.MessageTypes {
+		if allowed == msgType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMessageTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &TxnProcessorConf{}
+	assert.NoError(ValidateMessageTypes(conf))
+
+	conf.MessageTypes = []string{"deploycontract", " SendTransaction "}
+	assert.NoError(ValidateMessageTypes(conf))
+	assert.Equal([]string{"DeployContract", "SendTransaction"}, conf.MessageTypes)
+
+	conf.MessageTypes = []string{"TransactionSuccess"}
+	assert.Regexp("Invalid message type 'TransactionSuccess'. Must be one of: DeployContract,SendTransaction,SpeedUpTransaction,CancelTransaction", ValidateMessageTypes(conf))
+}
+
+func TestOnMessageTypeNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MessageTypes: []string{"DeployContract"},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	sink := &testLifecycleSink{}
+	txnProcessor.AddLifecycleSink(sink)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}" +
+		"}"
+	txnProcessor.OnMessage(testTxnContext)
+
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(1, len(testTxnContext.errorReplies))
+	assert.Equal(403, testTxnContext.errorReplies[0].status)
+	assert.Regexp("Message type 'SendTransaction' is not enabled on this instance", testTxnContext.errorReplies[0].err)
+	events := sink.waitFor(LifecycleFailed)
+	assert.Regexp("not enabled", events[len(events)-1].Error)
+	assert.True(txnProcessor.msgTypeAllowed("DeployContract"))
+}
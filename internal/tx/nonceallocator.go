@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// NonceAllocatorMemory allocates nonces in the memory of each ethconnect, which is the default
+	NonceAllocatorMemory = "memory"
+	// NonceAllocatorRedis allocates nonces from Redis, shared by every replica of ethconnect
+	NonceAllocatorRedis = "redis"
+
+	defaultNonceKeyPrefix = "ethconnect:nonce:"
+	defaultNonceLeaseSec  = 60
+)
+
+// NonceAllocatorConf selects where the nonces are allocated from, for the transactions that ethconnect
+// assigns the nonce of. Nonces allocated in memory collide when more than one replica of ethconnect
+// signs with the same address, so replicas allocate them from Redis instead
+type NonceAllocatorConf struct {
+	Type      string `json:"type,omitempty"`
+	RedisURL  string `json:"redisURL,omitempty"`
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	// LeaseSec is how long the nonce sequence of an address is kept after its last allocation,
+	// after which the sequence starts again from the pending transaction count of the node
+	LeaseSec  int `json:"leaseSec,omitempty"`
+	TimeoutMS int `json:"timeoutMS,omitempty"`
+}
+
+// NonceAllocator allocates nonces from state that is shared by the replicas of ethconnect signing with an address
+type NonceAllocator interface {
+	// Allocate returns the next nonce for an address. When no sequence is leased for the address,
+	// it starts from the nonce returned by nodeNonce
+	Allocate(ctx context.Context, addr string, nodeNonce func() (int64, error)) (int64, error)
+	// Release returns a nonce that was allocated but not submitted, so it is allocated again
+	// if no higher nonce has been allocated since
+	Release(ctx context.Context, addr string, nonce int64) error
+	// Reset discards the sequence of an address, so it starts again from the node, or from the
+	// next nonce if it is above zero
+	Reset(ctx context.Context, addr string, nextNonce int64) error
+}
+
+// allocateNonceScript increments the nonce sequence of an address and renews its lease, returning -1
+// if there is no sequence to increment
+const allocateNonceScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  local n = redis.call('INCR', KEYS[1])
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+  return n
+end
+return -1`
+
+// releaseNonceScript decrements the nonce sequence of an address, if the nonce is still the highest allocated
+const releaseNonceScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DECR', KEYS[1])
+end
+return -1`
+
+type redisNonceAllocator struct {
+	client    redis.Client
+	keyPrefix string
+	leaseMS   string
+}
+
+// newNonceAllocator returns the configured nonce allocator, or nil when nonces are allocated in memory
+func newNonceAllocator(conf *NonceAllocatorConf) (NonceAllocator, error) {
+	switch conf.Type {
+	case "", NonceAllocatorMemory:
+		return nil, nil
+	case NonceAllocatorRedis:
+		client, err := redis.NewClient(conf.RedisURL, time.Duration(conf.TimeoutMS)*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		return newRedisNonceAllocator(client, conf), nil
+	default:
+		return nil, errors.Errorf(errors.TransactionNonceAllocatorUnknown, conf.Type)
+	}
+}
+
+func newRedisNonceAllocator(client redis.Client, conf *NonceAllocatorConf) *redisNonceAllocator {
+	a := &redisNonceAllocator{
+		client:    client,
+		keyPrefix: conf.KeyPrefix,
+		leaseMS:   strconv.Itoa(conf.LeaseSec * 1000),
+	}
+	if a.keyPrefix == "" {
+		a.keyPrefix = defaultNonceKeyPrefix
+	}
+	if conf.LeaseSec <= 0 {
+		a.leaseMS = strconv.Itoa(defaultNonceLeaseSec * 1000)
+	}
+	return a
+}
+
+func (a *redisNonceAllocator) Allocate(ctx context.Context, addr string, nodeNonce func() (int64, error)) (int64, error) {
+	key := a.keyPrefix + addr
+	for {
+		reply, err := a.client.Do(ctx, "EVAL", allocateNonceScript, "1", key, a.leaseMS)
+		if err != nil {
+			return -1, err
+		}
+		nonce, ok := reply.(int64)
+		if !ok {
+			return -1, errors.Errorf(errors.RedisUnexpectedReply, reply)
+		}
+		if nonce >= 0 {
+			return nonce, nil
+		}
+
+		// There is no sequence for the address, so start one from the node
+		if nonce, err = nodeNonce(); err != nil {
+			return -1, err
+		}
+		if reply, err = a.client.Do(ctx, "SET", key, strconv.FormatInt(nonce, 10), "NX", "PX", a.leaseMS); err != nil {
+			return -1, err
+		}
+		if reply != nil {
+			log.Infof("Started nonce sequence for %s from %d", addr, nonce)
+			return nonce, nil
+		}
+		// Another replica started the sequence first, so allocate from that
+	}
+}
+
+func (a *redisNonceAllocator) Release(ctx context.Context, addr string, nonce int64) error {
+	reply, err := a.client.Do(ctx, "EVAL", releaseNonceScript, "1", a.keyPrefix+addr, strconv.FormatInt(nonce, 10))
+	if err != nil {
+		return err
+	}
+	if n, ok := reply.(int64); ok && n >= 0 {
+		log.Infof("Released nonce %d of %s", nonce, addr)
+	}
+	return nil
+}
+
+func (a *redisNonceAllocator) Reset(ctx context.Context, addr string, nextNonce int64) error {
+	key := a.keyPrefix + addr
+	if nextNonce > 0 {
+		_, err := a.client.Do(ctx, "SET", key, strconv.FormatInt(nextNonce-1, 10), "PX", a.leaseMS)
+		return err
+	}
+	_, err := a.client.Do(ctx, "DEL", key)
+	return err
+}
+
+// failedNonceAllocator fails every allocation, when the configured allocator could not be created,
+// so transactions are not sent with nonces that collide with those of other replicas
+type failedNonceAllocator struct {
+	err error
+}
+
+func (a *failedNonceAllocator) Allocate(ctx context.Context, addr string, nodeNonce func() (int64, error)) (int64, error) {
+	return -1, a.err
+}
+
+func (a *failedNonceAllocator) Release(ctx context.Context, addr string, nonce int64) error {
+	return a.err
+}
+
+func (a *failedNonceAllocator) Reset(ctx context.Context, addr string, nextNonce int64) error {
+	return a.err
+}
@@ -0,0 +1,340 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRedis emulates the redis commands used by the nonce allocator
+type testRedis struct {
+	lock      sync.Mutex
+	values    map[string]int64
+	commands  []string
+	err       error
+	raceValue *int64
+}
+
+func newTestRedis() *testRedis {
+	return &testRedis{values: map[string]int64{}}
+}
+
+func (r *testRedis) Do(ctx context.Context, args ...string) (interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.commands = append(r.commands, args[0])
+	if r.err != nil {
+		return nil, r.err
+	}
+	switch args[0] {
+	case "EVAL":
+		key := args[3]
+		n, exists := r.values[key]
+		switch args[1] {
+		case allocateNonceScript:
+			if !exists {
+				return int64(-1), nil
+			}
+			r.values[key] = n + 1
+			return n + 1, nil
+		case releaseNonceScript:
+			if exists && strconv.FormatInt(n, 10) == args[4] {
+				r.values[key] = n - 1
+				return n - 1, nil
+			}
+			return int64(-1), nil
+		}
+	case "SET":
+		key := args[1]
+		if r.raceValue != nil {
+			r.values[key] = *r.raceValue
+			r.raceValue = nil
+		}
+		if _, exists := r.values[key]; exists && args[3] == "NX" {
+			return nil, nil
+		}
+		r.values[key], _ = strconv.ParseInt(args[2], 10, 64)
+		return "OK", nil
+	case "DEL":
+		delete(r.values, args[1])
+		return int64(1), nil
+	}
+	return nil, fmt.Errorf("unexpected command %s", args[0])
+}
+
+func (r *testRedis) Close() {}
+
+type testNonceAllocator struct {
+	nonce     int64
+	err       error
+	allocated []int64
+	released  []int64
+	resets    []int64
+}
+
+func (a *testNonceAllocator) Allocate(ctx context.Context, addr string, nodeNonce func() (int64, error)) (int64, error) {
+	if a.err != nil {
+		return -1, a.err
+	}
+	a.allocated = append(a.allocated, a.nonce)
+	a.nonce++
+	return a.nonce - 1, nil
+}
+
+func (a *testNonceAllocator) Release(ctx context.Context, addr string, nonce int64) error {
+	a.released = append(a.released, nonce)
+	return a.err
+}
+
+func (a *testNonceAllocator) Reset(ctx context.Context, addr string, nextNonce int64) error {
+	a.resets = append(a.resets, nextNonce)
+	return a.err
+}
+
+func TestRedisNonceAllocatorAllocate(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestRedis()
+	a := newRedisNonceAllocator(r, &NonceAllocatorConf{})
+	assert.Equal("60000", a.leaseMS)
+
+	nodeCalls := 0
+	nodeNonce := func() (int64, error) {
+		nodeCalls++
+		return 10, nil
+	}
+	n, err := a.Allocate(context.Background(), "0x12345", nodeNonce)
+	assert.NoError(err)
+	assert.Equal(int64(10), n)
+	n, err = a.Allocate(context.Background(), "0x12345", nodeNonce)
+	assert.NoError(err)
+	assert.Equal(int64(11), n)
+	assert.Equal(1, nodeCalls)
+	assert.Equal(int64(11), r.values["ethconnect:nonce:0x12345"])
+	assert.Equal([]string{"EVAL", "SET", "EVAL"}, r.commands)
+}
+
+func TestRedisNonceAllocatorAllocateRace(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestRedis()
+	a := newRedisNonceAllocator(r, &NonceAllocatorConf{KeyPrefix: "test:", LeaseSec: 5})
+	assert.Equal("5000", a.leaseMS)
+
+	// Another replica starts the sequence between the EVAL and the SET
+	otherReplica := int64(20)
+	r.raceValue = &otherReplica
+	n, err := a.Allocate(context.Background(), "0x12345", func() (int64, error) { return 10, nil })
+	assert.NoError(err)
+	assert.Equal(int64(21), n)
+	assert.Equal([]string{"EVAL", "SET", "EVAL"}, r.commands)
+	assert.Equal(int64(21), r.values["test:0x12345"])
+}
+
+func TestRedisNonceAllocatorAllocateFail(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestRedis()
+	a := newRedisNonceAllocator(r, &NonceAllocatorConf{})
+
+	_, err := a.Allocate(context.Background(), "0x12345", func() (int64, error) { return -1, fmt.Errorf("pop") })
+	assert.Regexp("pop", err)
+
+	r.err = fmt.Errorf("bang")
+	_, err = a.Allocate(context.Background(), "0x12345", func() (int64, error) { return 10, nil })
+	assert.Regexp("bang", err)
+}
+
+func TestRedisNonceAllocatorAllocateSetFail(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestRedis()
+	a := newRedisNonceAllocator(r, &NonceAllocatorConf{})
+
+	_, err := a.Allocate(context.Background(), "0x12345", func() (int64, error) {
+		r.err = fmt.Errorf("bang")
+		return 10, nil
+	})
+	assert.Regexp("bang", err)
+}
+
+func TestRedisNonceAllocatorAllocateBadReply(t *testing.T) {
+	assert := assert.New(t)
+	a := newRedisNonceAllocator(&badReplyRedis{}, &NonceAllocatorConf{})
+
+	_, err := a.Allocate(context.Background(), "0x12345", func() (int64, error) { return 10, nil })
+	assert.Regexp("Unexpected reply from Redis", err)
+}
+
+type badReplyRedis struct{}
+
+func (r *badReplyRedis) Do(ctx context.Context, args ...string) (interface{}, error) {
+	return "bad", nil
+}
+
+func (r *badReplyRedis) Close() {}
+
+func TestRedisNonceAllocatorRelease(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestRedis()
+	a := newRedisNonceAllocator(r, &NonceAllocatorConf{})
+	r.values["ethconnect:nonce:0x12345"] = 11
+
+	// A nonce that is not the highest allocated is left as a gap
+	err := a.Release(context.Background(), "0x12345", 10)
+	assert.NoError(err)
+	assert.Equal(int64(11), r.values["ethconnect:nonce:0x12345"])
+
+	err = a.Release(context.Background(), "0x12345", 11)
+	assert.NoError(err)
+	assert.Equal(int64(10), r.values["ethconnect:nonce:0x12345"])
+
+	r.err = fmt.Errorf("bang")
+	err = a.Release(context.Background(), "0x12345", 10)
+	assert.Regexp("bang", err)
+}
+
+func TestRedisNonceAllocatorReset(t *testing.T) {
+	assert := assert.New(t)
+	r := newTestRedis()
+	a := newRedisNonceAllocator(r, &NonceAllocatorConf{})
+	r.values["ethconnect:nonce:0x12345"] = 11
+
+	err := a.Reset(context.Background(), "0x12345", 20)
+	assert.NoError(err)
+	assert.Equal(int64(19), r.values["ethconnect:nonce:0x12345"])
+	n, err := a.Allocate(context.Background(), "0x12345", nil)
+	assert.NoError(err)
+	assert.Equal(int64(20), n)
+
+	err = a.Reset(context.Background(), "0x12345", 0)
+	assert.NoError(err)
+	assert.Empty(r.values)
+}
+
+func TestNewNonceAllocator(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := newNonceAllocator(&NonceAllocatorConf{})
+	assert.NoError(err)
+	assert.Nil(a)
+
+	a, err = newNonceAllocator(&NonceAllocatorConf{Type: NonceAllocatorMemory})
+	assert.NoError(err)
+	assert.Nil(a)
+
+	a, err = newNonceAllocator(&NonceAllocatorConf{Type: NonceAllocatorRedis, RedisURL: "redis://localhost:6379"})
+	assert.NoError(err)
+	assert.IsType(&redisNonceAllocator{}, a)
+
+	_, err = newNonceAllocator(&NonceAllocatorConf{Type: NonceAllocatorRedis, RedisURL: "http://localhost"})
+	assert.Regexp("Invalid Redis URL", err)
+
+	_, err = newNonceAllocator(&NonceAllocatorConf{Type: "etcd"})
+	assert.Regexp("Unknown nonce allocator 'etcd'", err)
+}
+
+func TestFailedNonceAllocator(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewTxnProcessor(&TxnProcessorConf{
+		NonceAllocator: NonceAllocatorConf{Type: "etcd"},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	p.Init(&testRPC{})
+	a := p.nonceAllocator
+	assert.IsType(&failedNonceAllocator{}, a)
+
+	_, err := a.Allocate(context.Background(), "0x12345", nil)
+	assert.Regexp("Unknown nonce allocator", err)
+	assert.Regexp("Unknown nonce allocator", a.Release(context.Background(), "0x12345", 10))
+	assert.Regexp("Unknown nonce allocator", a.Reset(context.Background(), "0x12345", 0))
+}
+
+func TestOnSendTransactionMessageAllocatedNonce(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:     1,
+		AlwaysManageNonce: true,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+	allocator := &testNonceAllocator{nonce: 42}
+	txnProcessor.nonceAllocator = allocator
+
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.replies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Equal([]int64{42}, allocator.allocated)
+	assert.Empty(allocator.released)
+	assert.Equal("eth_sendTransaction", testRPC.calls[0])
+	sendTX := testRPC.params[0][0].(*eth.SendTXArgs)
+	assert.Equal(uint64(42), uint64(*sendTX.Nonce))
+}
+
+func TestOnSendTransactionMessageAllocatedNonceReleased(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:     1,
+		AlwaysManageNonce: true,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testRPC := goodMessageRPC()
+	testRPC.ethSendTransactionErr = fmt.Errorf("pop")
+	txnProcessor.Init(testRPC)
+	allocator := &testNonceAllocator{nonce: 42}
+	txnProcessor.nonceAllocator = allocator
+
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Regexp("pop", testTxnContext.errorReplies[0].err)
+	assert.Equal([]int64{42}, allocator.allocated)
+	assert.Equal([]int64{42}, allocator.released)
+}
+
+func TestOnSendTransactionMessageAllocateNonceFail(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:     1,
+		AlwaysManageNonce: true,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+	txnProcessor.nonceAllocator = &testNonceAllocator{err: fmt.Errorf("bang")}
+
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Regexp("bang", testTxnContext.errorReplies[0].err)
+	assert.Empty(testRPC.calls)
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// NonceReset is the outcome of resetting the nonce state of an address. The next nonce is
+// empty when the next transaction queries the node for the nonce
+type NonceReset struct {
+	Address              string      `json:"address"`
+	PreviousHighestNonce json.Number `json:"previousHighestNonce,omitempty"`
+	NextNonce            json.Number `json:"nextNonce,omitempty"`
+	Released             int         `json:"released"`
+}
+
+// ResetNonce clears the nonce state of an address, to recover from nonce drift without a restart.
+// The transactions in-flight for the address are released from nonce tracking, although their
+// receipts are still checked, and the next transaction queries the node for its nonce. When a
+// next nonce above zero is supplied, it is used instead of querying the node. Nonces allocated
+// from state shared with other replicas are reset there too
+func (p *txnProcessor) ResetNonce(addr string, nextNonce *int64) (*NonceReset, error) {
+	from, err := utils.StrToAddress("address", addr)
+	if err != nil {
+		return nil, err
+	}
+	if nextNonce != nil && *nextNonce < 0 {
+		return nil, errors.Errorf(errors.TransactionNonceResetInvalid, strconv.FormatInt(*nextNonce, 10))
+	}
+	fromStr := strings.ToLower(from.Hex())
+	reset := &NonceReset{Address: fromStr}
+
+	// The shared state is reset under the lock, as nonces are allocated from it under the lock,
+	// so that no nonce can be allocated between the reset of the shared and in-memory state
+	p.inflightTxnsLock.Lock()
+	if p.nonceAllocator != nil {
+		var n int64
+		if nextNonce != nil {
+			n = *nextNonce
+		}
+		if err := p.nonceAllocator.Reset(context.Background(), fromStr, n); err != nil {
+			p.inflightTxnsLock.Unlock()
+			return nil, err
+		}
+	}
+	if inflightForAddr, exists := p.inflightTxns[fromStr]; exists {
+		reset.PreviousHighestNonce = json.Number(strconv.FormatInt(inflightForAddr.highestNonce, 10))
+		for _, inflight := range inflightForAddr.txnsInFlight {
+			inflight.released = true
+		}
+		reset.Released = len(inflightForAddr.txnsInFlight)
+		delete(p.inflightTxns, fromStr)
+	}
+	delete(p.recoveredNonces, fromStr)
+	if nextNonce != nil && *nextNonce > 0 {
+		p.inflightTxns[fromStr] = &inflightTxnState{
+			highestNonce: *nextNonce - 1,
+			txnsInFlight: []*inflightTxn{},
+		}
+		reset.NextNonce = json.Number(strconv.FormatInt(*nextNonce, 10))
+	}
+	p.inflightTxnsLock.Unlock()
+	if nextNonce != nil && *nextNonce > 0 {
+		p.persistNonce(fromStr, *nextNonce-1, true)
+	} else {
+		p.persistNonce(fromStr, -1, true)
+	}
+
+	log.Warnf("Nonce reset for %s. previous=%s next=%s released=%d", fromStr, reset.PreviousHighestNonce, reset.NextNonce, reset.Released)
+	return reset, nil
+}
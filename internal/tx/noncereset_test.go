@@ -0,0 +1,171 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetNonce(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	released := p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight[0]
+
+	reset, err := p.ResetNonce("83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", nil)
+	assert.NoError(err)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", reset.Address)
+	assert.Equal(json.Number("12"), reset.PreviousHighestNonce)
+	assert.Equal(json.Number(""), reset.NextNonce)
+	assert.Equal(3, reset.Released)
+	assert.True(released.released)
+	assert.Empty(p.inflightTxns)
+
+	reset, err = p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", nil)
+	assert.NoError(err)
+	assert.Equal(json.Number(""), reset.PreviousHighestNonce)
+	assert.Equal(0, reset.Released)
+}
+
+func TestResetNonceExplicit(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	released := p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight[0]
+	released.from = "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+
+	nextNonce := int64(20)
+	reset, err := p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", &nextNonce)
+	assert.NoError(err)
+	assert.Equal(json.Number("20"), reset.NextNonce)
+	state := p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"]
+	assert.Equal(int64(19), state.highestNonce)
+	assert.Empty(state.txnsInFlight)
+
+	// A released transaction that completes does not affect the state after the reset
+	p.cancelInFlight(released, true)
+	assert.Equal(state, p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"])
+
+	nextNonce = 0
+	reset, err = p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", &nextNonce)
+	assert.NoError(err)
+	assert.Equal(json.Number("19"), reset.PreviousHighestNonce)
+	assert.Equal(json.Number(""), reset.NextNonce)
+	assert.Empty(p.inflightTxns)
+}
+
+func TestResetNonceInvalid(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+
+	_, err := p.ResetNonce("badness", nil)
+	assert.Regexp("Supplied value for 'address' is not a valid hex address", err)
+
+	nextNonce := int64(-1)
+	_, err = p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", &nextNonce)
+	assert.Regexp("Invalid nonce '-1' to reset to", err)
+	assert.Equal(3, len(p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight))
+}
+
+func TestResetNonceAllocator(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	allocator := &testNonceAllocator{}
+	p.nonceAllocator = allocator
+
+	nextNonce := int64(20)
+	_, err := p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", &nextNonce)
+	assert.NoError(err)
+	_, err = p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", nil)
+	assert.NoError(err)
+	assert.Equal([]int64{20, 0}, allocator.resets)
+}
+
+func TestResetNonceAllocatorFail(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	p.nonceAllocator = &testNonceAllocator{err: fmt.Errorf("pop")}
+
+	_, err := p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", nil)
+	assert.Regexp("pop", err)
+	assert.Equal(3, len(p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight))
+}
+
+// blockingResetAllocator holds a reset of the shared state until the test lets it proceed
+type blockingResetAllocator struct {
+	testNonceAllocator
+	resetStarted chan struct{}
+	resetProceed chan struct{}
+}
+
+func (a *blockingResetAllocator) Reset(ctx context.Context, addr string, nextNonce int64) error {
+	close(a.resetStarted)
+	<-a.resetProceed
+	a.nonce = nextNonce
+	return a.testNonceAllocator.Reset(ctx, addr, nextNonce)
+}
+
+func TestResetNonceAllocatorConcurrentAllocation(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	p.conf.AlwaysManageNonce = true
+	allocator := &blockingResetAllocator{
+		testNonceAllocator: testNonceAllocator{nonce: 13},
+		resetStarted:       make(chan struct{}),
+		resetProceed:       make(chan struct{}),
+	}
+	p.nonceAllocator = allocator
+
+	resetDone := make(chan struct{})
+	go func() {
+		nextNonce := int64(20)
+		_, err := p.ResetNonce("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", &nextNonce)
+		assert.NoError(err)
+		close(resetDone)
+	}()
+	<-allocator.resetStarted
+
+	// An allocation while the shared state is being reset waits for the reset to complete
+	added := make(chan *inflightTxn, 1)
+	go func() {
+		inflight, err := p.addInflightWrapper(&testTxnContext{}, &messages.TransactionCommon{
+			From: "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1",
+		})
+		assert.NoError(err)
+		added <- inflight
+	}()
+	var inflight *inflightTxn
+	select {
+	case inflight = <-added:
+		assert.Fail("nonce allocated during the reset")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(allocator.resetProceed)
+	<-resetDone
+	if inflight == nil {
+		inflight = <-added
+	}
+	assert.Equal(int64(20), inflight.nonce)
+	assert.False(inflight.released)
+	state := p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"]
+	assert.Equal(int64(20), state.highestNonce)
+	assert.Equal([]*inflightTxn{inflight}, state.txnsInFlight)
+}
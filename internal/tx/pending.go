@@ -0,0 +1,155 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/utils"
+)
+
+const (
+	// PendingStatusPending is a transaction the node has pending, so can be mined
+	PendingStatusPending = "pending"
+	// PendingStatusQueued is a transaction the node has queued, usually behind a nonce gap
+	PendingStatusQueued = "queued"
+	// PendingStatusNotInPool is an in-flight transaction that is not in the transaction pool
+	// of the node, because it has not been submitted yet, has been mined, or has been dropped
+	PendingStatusNotInPool = "notInPool"
+)
+
+// PendingTransactions is the view of the transactions for an address that are queued
+// in the node, merged with those ethconnect is tracking in-flight
+type PendingTransactions struct {
+	Address              string                `json:"address"`
+	InflightHighestNonce *json.Number          `json:"inflightHighestNonce,omitempty"`
+	TxPoolError          string                `json:"txpoolError,omitempty"`
+	Transactions         []*PendingTransaction `json:"transactions"`
+}
+
+// PendingTransaction is a transaction in the transaction pool of the node, in-flight in ethconnect, or both
+type PendingTransaction struct {
+	Nonce    json.Number            `json:"nonce,omitempty"`
+	Status   string                 `json:"status"`
+	Node     *eth.TxPoolTransaction `json:"node,omitempty"`
+	Inflight *InflightTransaction   `json:"inflight,omitempty"`
+}
+
+// InflightTransaction is the state ethconnect holds for an in-flight transaction
+type InflightTransaction struct {
+	ID              int    `json:"id"`
+	RequestID       string `json:"requestId,omitempty"`
+	Hash            string `json:"hash,omitempty"`
+	NodeAssignNonce bool   `json:"nodeAssignNonce,omitempty"`
+}
+
+// PendingTransactions queries the transaction pool of the node that submits transactions
+// for the address, and merges it with the in-flight transactions for the address.
+// Nodes that do not support txpool_content return only the in-flight transactions
+func (p *txnProcessor) PendingTransactions(ctx context.Context, addr string) (*PendingTransactions, error) {
+	from, err := utils.StrToAddress("address", addr)
+	if err != nil {
+		return nil, err
+	}
+	fromStr := strings.ToLower(from.Hex())
+
+	rpc := p.rpc
+	if addressBook := p.getAddressBook(); addressBook != nil {
+		if rpc, err = addressBook.lookup(ctx, fromStr); err != nil {
+			return nil, err
+		}
+	}
+	result := &PendingTransactions{
+		Address:      fromStr,
+		Transactions: []*PendingTransaction{},
+	}
+	byNonce := make(map[uint64]*PendingTransaction)
+	byHash := make(map[string]*PendingTransaction)
+
+	content, err := eth.GetTxPoolContent(ctx, rpc, fromStr)
+	if err != nil {
+		log.Warnf("Unable to query the transaction pool for %s: %s", fromStr, err)
+		result.TxPoolError = errors.ToRESTError(err).Message
+	} else {
+		for status, txns := range map[string][]*eth.TxPoolTransaction{
+			PendingStatusPending: content.Pending,
+			PendingStatusQueued:  content.Queued,
+		} {
+			for _, txn := range txns {
+				pt := &PendingTransaction{
+					Nonce:  json.Number(strconv.FormatUint(uint64(txn.Nonce), 10)),
+					Status: status,
+					Node:   txn,
+				}
+				byNonce[uint64(txn.Nonce)] = pt
+				byHash[strings.ToLower(txn.Hash)] = pt
+				result.Transactions = append(result.Transactions, pt)
+			}
+		}
+	}
+
+	p.inflightTxnsLock.Lock()
+	if inflightForAddr, exists := p.inflightTxns[fromStr]; exists {
+		highestNonce := json.Number(strconv.FormatInt(inflightForAddr.highestNonce, 10))
+		result.InflightHighestNonce = &highestNonce
+		for _, inflight := range inflightForAddr.txnsInFlight {
+			it := &InflightTransaction{
+				ID:              inflight.id,
+				RequestID:       inflight.txnContext.Headers().ID,
+				NodeAssignNonce: inflight.nodeAssignNonce,
+			}
+			if inflight.tx != nil {
+				it.Hash = inflight.tx.Hash
+			}
+			// Transactions with a nonce assigned by the node can only be matched once submitted
+			pt, ok := byHash[strings.ToLower(it.Hash)]
+			if !ok && !inflight.nodeAssignNonce {
+				pt, ok = byNonce[uint64(inflight.nonce)]
+			}
+			if ok {
+				pt.Inflight = it
+				continue
+			}
+			pt = &PendingTransaction{
+				Status:   PendingStatusNotInPool,
+				Inflight: it,
+			}
+			if !inflight.nodeAssignNonce {
+				pt.Nonce = inflight.nonceNumber()
+			}
+			result.Transactions = append(result.Transactions, pt)
+		}
+	}
+	p.inflightTxnsLock.Unlock()
+
+	// Transactions with a nonce assigned by the node sort last
+	sort.SliceStable(result.Transactions, func(i, j int) bool {
+		ni, errI := result.Transactions[i].Nonce.Int64()
+		nj, errJ := result.Transactions[j].Nonce.Int64()
+		if errI != nil || errJ != nil {
+			return errI == nil
+		}
+		return ni < nj
+	})
+	return result, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTxPoolContent = `{
+	"pending": {
+		"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1": {
+			"10": {"hash": "0xaaaa", "nonce": "0xa", "gas": "0x5208"},
+			"11": {"hash": "0xbbbb", "nonce": "0xb", "gas": "0x5208"}
+		}
+	},
+	"queued": {
+		"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1": {
+			"14": {"hash": "0xeeee", "nonce": "0xe", "gas": "0x5208"}
+		}
+	}
+}`
+
+func newTestPendingProcessor(rpc *testRPC) *txnProcessor {
+	p := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	p.Init(rpc)
+	p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{
+		highestNonce: 12,
+		txnsInFlight: []*inflightTxn{
+			{id: 1, nonce: 11, tx: &eth.Txn{Hash: "0xbbbb"}, txnContext: &testTxnContext{jsonMsg: `{"headers":{"id":"req1"}}`}},
+			{id: 2, nonce: 12, txnContext: &testTxnContext{jsonMsg: `{"headers":{"id":"req2"}}`}},
+			{id: 3, nodeAssignNonce: true, txnContext: &testTxnContext{jsonMsg: `{"headers":{"id":"req3"}}`}},
+		},
+	}
+	return p
+}
+
+func TestPendingTransactions(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{txpoolContentResult: testTxPoolContent})
+
+	pending, err := p.PendingTransactions(context.Background(), "83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1")
+	assert.NoError(err)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", pending.Address)
+	assert.Equal(json.Number("12"), *pending.InflightHighestNonce)
+	assert.Empty(pending.TxPoolError)
+
+	txns := pending.Transactions
+	assert.Equal(5, len(txns))
+	assert.Equal(json.Number("10"), txns[0].Nonce)
+	assert.Equal(PendingStatusPending, txns[0].Status)
+	assert.Equal("0xaaaa", txns[0].Node.Hash)
+	assert.Nil(txns[0].Inflight)
+	assert.Equal(json.Number("11"), txns[1].Nonce)
+	assert.Equal(PendingStatusPending, txns[1].Status)
+	assert.Equal(&InflightTransaction{ID: 1, RequestID: "req1", Hash: "0xbbbb"}, txns[1].Inflight)
+	assert.Equal(json.Number("12"), txns[2].Nonce)
+	assert.Equal(PendingStatusNotInPool, txns[2].Status)
+	assert.Nil(txns[2].Node)
+	assert.Equal("req2", txns[2].Inflight.RequestID)
+	assert.Equal(json.Number("14"), txns[3].Nonce)
+	assert.Equal(PendingStatusQueued, txns[3].Status)
+	assert.Equal(json.Number(""), txns[4].Nonce)
+	assert.Equal(PendingStatusNotInPool, txns[4].Status)
+	assert.True(txns[4].Inflight.NodeAssignNonce)
+}
+
+func TestPendingTransactionsTxPoolUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{txpoolContentErr: fmt.Errorf("the method txpool_content does not exist/is not available")})
+
+	pending, err := p.PendingTransactions(context.Background(), testFromAddr)
+	assert.NoError(err)
+	assert.Regexp("txpool_content returned: the method txpool_content does not exist", pending.TxPoolError)
+	assert.Equal(3, len(pending.Transactions))
+
+	pending, err = p.PendingTransactions(context.Background(), "0x0000000000000000000000000000000000000001")
+	assert.NoError(err)
+	assert.Nil(pending.InflightHighestNonce)
+	assert.Empty(pending.Transactions)
+}
+
+func TestPendingTransactionsBadAddress(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+
+	_, err := p.PendingTransactions(context.Background(), "badness")
+	assert.Regexp("Supplied value for 'address' is not a valid hex address", err)
+}
+
+func TestPendingTransactionsAddressBookFail(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	p := NewTxnProcessor(&TxnProcessorConf{
+		AddressBookConf: AddressBookConf{
+			AddressbookURLPrefix: server.URL,
+		},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	p.Init(&testRPC{})
+
+	_, err := p.PendingTransactions(context.Background(), testFromAddr)
+	assert.Regexp("Could not process Addressbook \\[500\\] response", err)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// ContractABIResolver looks up the stored ABI of a contract, so the logs in the receipts of
+// transactions can be decoded. The block is the one the transaction was mined in, as the ABI
+// of a contract that has been upgraded depends on the block
+type ContractABIResolver interface {
+	ContractABI(address string, blockNumber *big.Int) (ethbinding.ABIMarshaling, error)
+}
+
+// SetContractABIResolver sets the resolver for the ABIs of contracts, to add the decoded events to receipts
+func (p *txnProcessor) SetContractABIResolver(resolver ContractABIResolver) {
+	p.abiResolver = resolver
+}
+
+// receiptEvents decodes the logs of a receipt against the ABIs of the contracts that emitted them.
+// Logs of contracts without a known ABI, or that do not match an event in it, are omitted
+func (p *txnProcessor) receiptEvents(inflight *inflightTxn, receipt *eth.TxnReceipt) []*messages.ReceiptEvent {
+	if len(receipt.Logs) == 0 {
+		return nil
+	}
+	var blockNumber *big.Int
+	if receipt.BlockNumber != nil {
+		blockNumber = receipt.BlockNumber.ToInt()
+	}
+	contractEvents := make(map[ethbinding.Address]map[ethbinding.Hash]*ethbinding.ABIEvent)
+	var events []*messages.ReceiptEvent
+	for idx, txLog := range receipt.Logs {
+		if txLog == nil || txLog.Address == nil {
+			continue
+		}
+		abiEvents, ok := contractEvents[*txLog.Address]
+		if !ok {
+			abiEvents = eth.ABIEvents(p.contractABI(inflight, receipt, *txLog.Address, blockNumber))
+			contractEvents[*txLog.Address] = abiEvents
+		}
+		event, data := eth.DecodeLog(abiEvents, txLog)
+		if event == nil {
+			continue
+		}
+		logIndex := strconv.Itoa(idx)
+		if txLog.LogIndex != nil {
+			logIndex = strconv.FormatUint(uint64(*txLog.LogIndex), 10)
+		}
+		events = append(events, &messages.ReceiptEvent{
+			Address:   txLog.Address.String(),
+			Signature: ethbind.API.ABIEventSignature(event),
+			LogIndex:  logIndex,
+			Data:      data,
+		})
+	}
+	return events
+}
+
+// contractABI returns the ABI of a contract that emitted a log. A contract being deployed is
+// not yet registered, so its events are decoded with the ABI in the deploy request
+func (p *txnProcessor) contractABI(inflight *inflightTxn, receipt *eth.TxnReceipt, address ethbinding.Address, blockNumber *big.Int) ethbinding.ABIMarshaling {
+	if inflight.deployABI != nil && receipt.ContractAddress != nil && *receipt.ContractAddress == address {
+		return inflight.deployABI
+	}
+	if p.abiResolver == nil {
+		return nil
+	}
+	abi, err := p.abiResolver.ContractABI(address.Hex(), blockNumber)
+	if err != nil {
+		log.Debugf("No ABI to decode the logs of %s in receipt: %s", address.Hex(), err)
+		return nil
+	}
+	return abi
+}
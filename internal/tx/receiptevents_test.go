@@ -0,0 +1,159 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+var testStoredABI = ethbinding.ABIMarshaling{
+	{
+		Type: "event", Name: "Stored",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "by", Type: "address", Indexed: true},
+			{Name: "value", Type: "uint256"},
+		},
+	},
+}
+
+type mockABIResolver struct {
+	abis        map[string]ethbinding.ABIMarshaling
+	lookups     []string
+	blockNumber *big.Int
+}
+
+func (r *mockABIResolver) ContractABI(address string, blockNumber *big.Int) (ethbinding.ABIMarshaling, error) {
+	r.lookups = append(r.lookups, address)
+	r.blockNumber = blockNumber
+	abi, ok := r.abis[strings.ToLower(address)]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	return abi, nil
+}
+
+func testStoredLog(t *testing.T, address string, value int64, logIndex uint) *eth.TxnLog {
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&testStoredABI[0])
+	assert.NoError(t, err)
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(value))
+	assert.NoError(t, err)
+	addr := ethbind.API.HexToAddress(address)
+	byTopic := ethbind.API.HexToHash("0x000000000000000000000000aa983ad2a0e0ed8ac639277f37be42f2a5d2618c")
+	idx := ethbinding.HexUint(logIndex)
+	return &eth.TxnLog{
+		Address:  &addr,
+		Topics:   []*ethbinding.Hash{&event.ID, &byTopic},
+		Data:     data,
+		LogIndex: &idx,
+	}
+}
+
+func TestReceiptEvents(t *testing.T) {
+	assert := assert.New(t)
+	known := "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832"
+	unknown := "0xd7fac2bce408ed7c6ded07a32038b1f79c2b27d3"
+	resolver := &mockABIResolver{abis: map[string]ethbinding.ABIMarshaling{known: testStoredABI}}
+	p := &txnProcessor{}
+	p.SetContractABIResolver(resolver)
+
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	receipt := &eth.TxnReceipt{
+		BlockNumber: &blockNumber,
+		Logs: []*eth.TxnLog{
+			testStoredLog(t, known, 10, 5),
+			testStoredLog(t, unknown, 20, 6),
+			nil,
+			testStoredLog(t, known, 30, 7),
+		},
+	}
+	events := p.receiptEvents(&inflightTxn{}, receipt)
+	assert.Len(events, 2)
+	assert.Equal(ethbind.API.HexToAddress(known).String(), events[0].Address)
+	assert.Equal("Stored(address,uint256)", events[0].Signature)
+	assert.Equal("5", events[0].LogIndex)
+	assert.Equal("10", events[0].Data["value"])
+	assert.Equal("7", events[1].LogIndex)
+	assert.Equal("30", events[1].Data["value"])
+
+	// Each contract is only resolved once
+	assert.Len(resolver.lookups, 2)
+	assert.Equal(int64(12345), resolver.blockNumber.Int64())
+}
+
+func TestReceiptEventsDeployedContract(t *testing.T) {
+	assert := assert.New(t)
+	deployed := "0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37"
+	p := &txnProcessor{}
+
+	contractAddr := ethbind.API.HexToAddress(deployed)
+	txLog := testStoredLog(t, deployed, 10, 0)
+	txLog.LogIndex = nil
+	receipt := &eth.TxnReceipt{
+		ContractAddress: &contractAddr,
+		Logs:            []*eth.TxnLog{txLog},
+	}
+	events := p.receiptEvents(&inflightTxn{deployABI: testStoredABI}, receipt)
+	assert.Len(events, 1)
+	assert.Equal("0", events[0].LogIndex)
+
+	// Without the ABI of the deployment, or a resolver, nothing is decoded
+	assert.Empty(p.receiptEvents(&inflightTxn{}, receipt))
+	assert.Empty(p.receiptEvents(&inflightTxn{}, &eth.TxnReceipt{}))
+}
+
+func TestOnSendTransactionMessageReceiptEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	to := "0xd7fac2bce408ed7c6ded07a32038b1f79c2b27d3"
+	txnProcessor.SetContractABIResolver(&mockABIResolver{abis: map[string]ethbinding.ABIMarshaling{to: testStoredABI}})
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetTransactionReceiptResult.Logs = []*eth.TxnLog{testStoredLog(t, to, 10, 1)}
+	txnProcessor.Init(testRPC)                          // configured in seconds for real world
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond // ... but fail asap for this test
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	replyMsg := testTxnContext.replies[0]
+	assert.Equal("TransactionSuccess", replyMsg.ReplyHeaders().MsgType)
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+	var reply messages.TransactionReceipt
+	json.Unmarshal(replyMsgBytes, &reply)
+	assert.Len(reply.Events, 1)
+	assert.Equal("Stored(address,uint256)", reply.Events[0].Signature)
+	assert.Equal("10", reply.Events[0].Data["value"])
+	assert.Equal("0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c", strings.ToLower(reply.Events[0].Data["by"].(string)))
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBlockReceiptsPollingIntervalMS = 1000
+)
+
+// The methods are tried in order on first use, to find one the node supports
+var blockReceiptsMethods = []string{"eth_getBlockReceipts", "parity_getBlockReceipts"}
+
+// blockReceiptPoller fetches all the receipts for each new block in a single call,
+// and matches them against the hashes of the transactions that are waiting.
+// This replaces an eth_getTransactionReceipt call for every in-flight transaction
+// on every poll, with one call per block.
+type blockReceiptPoller struct {
+	rpc         eth.RPCClient
+	interval    time.Duration
+	lock        sync.Mutex
+	waiters     map[string]chan *eth.TxnReceipt
+	method      string
+	unsupported bool
+	running     bool
+}
+
+func newBlockReceiptPoller(rpc eth.RPCClient, interval time.Duration) *blockReceiptPoller {
+	return &blockReceiptPoller{
+		rpc:      rpc,
+		interval: interval,
+		waiters:  make(map[string]chan *eth.TxnReceipt),
+	}
+}
+
+// register returns a channel that will be sent the receipt for the transaction
+// once it is found in a block. Returns nil if the node does not support block receipts.
+// If that is only discovered later, the channel is closed without a receipt being sent.
+func (bp *blockReceiptPoller) register(txHash string) chan *eth.TxnReceipt {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	if bp.unsupported {
+		return nil
+	}
+	receiptChan := make(chan *eth.TxnReceipt, 1)
+	bp.waiters[strings.ToLower(txHash)] = receiptChan
+	if !bp.running {
+		bp.running = true
+		go bp.pollLoop()
+	}
+	return receiptChan
+}
+
+func (bp *blockReceiptPoller) unregister(txHash string) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	delete(bp.waiters, strings.ToLower(txHash))
+}
+
+// pollLoop runs while there are transactions waiting for receipts
+func (bp *blockReceiptPoller) pollLoop() {
+	var lastBlock uint64
+	for {
+		bp.lock.Lock()
+		if len(bp.waiters) == 0 || bp.unsupported {
+			bp.running = false
+			bp.lock.Unlock()
+			return
+		}
+		bp.lock.Unlock()
+
+		lastBlock = bp.poll(lastBlock)
+		time.Sleep(bp.interval)
+	}
+}
+
+// poll processes each block after lastBlock up to the head of the chain,
+// and returns the last block that was successfully processed
+func (bp *blockReceiptPoller) poll(lastBlock uint64) uint64 {
+	ctx := context.Background()
+	head, err := eth.GetBlockNumber(ctx, bp.rpc)
+	if err != nil {
+		log.Warnf("Failed to query block height for receipts: %s", err)
+		return lastBlock
+	}
+	if lastBlock == 0 && head > 0 {
+		// Any transaction mined before we started is found by the waiter checking directly
+		lastBlock = head - 1
+	}
+	for blockNumber := lastBlock + 1; blockNumber <= head; blockNumber++ {
+		receipts, err := bp.getBlockReceipts(ctx, blockNumber)
+		if err != nil {
+			log.Warnf("Failed to get receipts for block %d: %s", blockNumber, err)
+			return lastBlock
+		}
+		bp.dispatch(receipts)
+		lastBlock = blockNumber
+	}
+	return lastBlock
+}
+
+func (bp *blockReceiptPoller) getBlockReceipts(ctx context.Context, blockNumber uint64) (receipts []*eth.TxnReceipt, err error) {
+	if bp.method != "" {
+		return eth.GetBlockReceipts(ctx, bp.rpc, bp.method, blockNumber)
+	}
+	notFound := 0
+	for _, method := range blockReceiptsMethods {
+		if receipts, err = eth.GetBlockReceipts(ctx, bp.rpc, method, blockNumber); err == nil {
+			log.Infof("Using %s to poll for transaction receipts", method)
+			bp.method = method
+			return receipts, nil
+		}
+		if eth.IsMethodNotFound(err) {
+			notFound++
+		}
+	}
+	// Only give up on block receipts once the node has told us it implements none of the methods.
+	// Any other failure, such as the node not being up yet, means we probe again on the next poll
+	if notFound == len(blockReceiptsMethods) {
+		bp.markUnsupported(err)
+	}
+	return nil, err
+}
+
+func (bp *blockReceiptPoller) markUnsupported(err error) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	log.Warnf("Node does not support block receipts. Falling back to polling for individual receipts: %s", err)
+	bp.unsupported = true
+	for txHash, receiptChan := range bp.waiters {
+		close(receiptChan)
+		delete(bp.waiters, txHash)
+	}
+}
+
+func (bp *blockReceiptPoller) dispatch(receipts []*eth.TxnReceipt) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	for _, receipt := range receipts {
+		if receipt == nil || receipt.TransactionHash == nil {
+			continue
+		}
+		txHash := strings.ToLower(receipt.TransactionHash.Hex())
+		if receiptChan, exists := bp.waiters[txHash]; exists {
+			receiptChan <- receipt
+			delete(bp.waiters, txHash)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBlockRPC struct {
+	lock          sync.Mutex
+	blockNumber   uint64
+	receipts      map[uint64][]*eth.TxnReceipt
+	methodErrors  map[string]error
+	blocksFetched []uint64
+	calls         []string
+}
+
+func (r *testBlockRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls = append(r.calls, method)
+	if err := r.methodErrors[method]; err != nil {
+		return err
+	}
+	switch method {
+	case "eth_blockNumber":
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(ethbinding.HexUint64(r.blockNumber)))
+	case "eth_getBlockReceipts", "parity_getBlockReceipts":
+		blockNumber := uint64(args[0].(ethbinding.HexUint64))
+		r.blocksFetched = append(r.blocksFetched, blockNumber)
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.receipts[blockNumber]))
+	default:
+		panic(fmt.Errorf("method unknown to test: %s", method))
+	}
+	return nil
+}
+
+func testReceiptForHash(txHash string) *eth.TxnReceipt {
+	hash := ethbind.API.HexToHash(txHash)
+	blockNumber := ethbinding.HexBigInt{}
+	blockNumber.ToInt().SetInt64(10)
+	return &eth.TxnReceipt{
+		TransactionHash: &hash,
+		BlockNumber:     &blockNumber,
+	}
+}
+
+func TestBlockReceiptPollerMatchesReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	txHash := "0xE2215336B09F9B5B82E36E1144ED64F40A42E61B68FDACA82549FD98B8531A89"
+	rpc := &testBlockRPC{
+		blockNumber: 10,
+		receipts: map[uint64][]*eth.TxnReceipt{
+			10: {testReceiptForHash("0x6e710868fd2d0ac1f141ba3f0cd569e38ce1999d8f39518ee7633d2b9a7122af"), testReceiptForHash(txHash)},
+		},
+	}
+	bp := newBlockReceiptPoller(rpc, 1*time.Millisecond)
+
+	receiptChan := bp.register(txHash)
+	receipt := <-receiptChan
+	assert.Equal(ethbind.API.HexToHash(txHash), *receipt.TransactionHash)
+	assert.Equal("eth_getBlockReceipts", bp.method)
+
+	// Poller stops once there is nothing waiting
+	for {
+		bp.lock.Lock()
+		running := bp.running
+		bp.lock.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(bp.waiters)
+}
+
+func TestBlockReceiptPollerProcessesEachNewBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBlockRPC{
+		blockNumber: 13,
+		receipts: map[uint64][]*eth.TxnReceipt{
+			13: {testReceiptForHash("0x01")},
+		},
+	}
+	bp := newBlockReceiptPoller(rpc, 1*time.Millisecond)
+
+	lastBlock := bp.poll(10)
+	assert.Equal(uint64(13), lastBlock)
+	assert.Equal([]uint64{11, 12, 13}, rpc.blocksFetched)
+
+	// Nothing new
+	lastBlock = bp.poll(lastBlock)
+	assert.Equal(uint64(13), lastBlock)
+	assert.Equal(3, len(rpc.blocksFetched))
+
+	// Starting fresh only processes the head block
+	lastBlock = bp.poll(0)
+	assert.Equal(uint64(13), lastBlock)
+	assert.Equal([]uint64{11, 12, 13, 13}, rpc.blocksFetched)
+}
+
+func TestBlockReceiptPollerBlockNumberFail(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBlockRPC{
+		methodErrors: map[string]error{
+			"eth_blockNumber": fmt.Errorf("pop"),
+		},
+	}
+	bp := newBlockReceiptPoller(rpc, 1*time.Millisecond)
+
+	lastBlock := bp.poll(5)
+	assert.Equal(uint64(5), lastBlock)
+	assert.False(bp.unsupported)
+}
+
+func TestBlockReceiptPollerParityFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBlockRPC{
+		blockNumber: 10,
+		methodErrors: map[string]error{
+			"eth_getBlockReceipts": fmt.Errorf("method not found"),
+		},
+	}
+	bp := newBlockReceiptPoller(rpc, 1*time.Millisecond)
+
+	lastBlock := bp.poll(9)
+	assert.Equal(uint64(10), lastBlock)
+	assert.Equal("parity_getBlockReceipts", bp.method)
+	assert.Equal([]string{"eth_blockNumber", "eth_getBlockReceipts", "parity_getBlockReceipts"}, rpc.calls)
+
+	// Once found, we go straight to the supported method
+	rpc.blockNumber = 11
+	bp.poll(lastBlock)
+	assert.Equal([]string{"eth_blockNumber", "eth_getBlockReceipts", "parity_getBlockReceipts", "eth_blockNumber", "parity_getBlockReceipts"}, rpc.calls)
+}
+
+func TestBlockReceiptPollerUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBlockRPC{
+		blockNumber: 10,
+		methodErrors: map[string]error{
+			"eth_getBlockReceipts":    fmt.Errorf("method not found"),
+			"parity_getBlockReceipts": fmt.Errorf("method not found"),
+		},
+	}
+	bp := newBlockReceiptPoller(rpc, 1*time.Millisecond)
+
+	receiptChan := bp.register("0x01")
+	_, ok := <-receiptChan
+	assert.False(ok)
+	assert.True(bp.unsupported)
+	assert.Nil(bp.register("0x02"))
+}
+
+func TestBlockReceiptPollerProbeRetriedAfterTransportError(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBlockRPC{
+		blockNumber: 10,
+		methodErrors: map[string]error{
+			"eth_getBlockReceipts":    fmt.Errorf("connection refused"),
+			"parity_getBlockReceipts": fmt.Errorf("connection refused"),
+		},
+	}
+	bp := newBlockReceiptPoller(rpc, 1*time.Millisecond)
+
+	lastBlock := bp.poll(9)
+	assert.Equal(uint64(9), lastBlock)
+	assert.False(bp.unsupported)
+	assert.Equal("", bp.method)
+
+	// Once the node is up, the probe succeeds on the next poll
+	rpc.lock.Lock()
+	rpc.methodErrors = map[string]error{}
+	rpc.lock.Unlock()
+	lastBlock = bp.poll(lastBlock)
+	assert.Equal(uint64(10), lastBlock)
+	assert.Equal("eth_getBlockReceipts", bp.method)
+}
@@ -0,0 +1,287 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+// InflightRecord is persisted for each transaction submitted to the node, until a reply
+// has been sent for it, so tracking can be resumed after a restart of the gateway
+type InflightRecord struct {
+	Headers         messages.CommonHeaders `json:"headers"`
+	From            string                 `json:"from"`
+	Nonce           int64                  `json:"nonce"`
+	NodeAssignNonce bool                   `json:"nodeAssignNonce,omitempty"`
+	TransactionHash string                 `json:"transactionHash"`
+	PrivacyGroupID  string                 `json:"privacyGroupId,omitempty"`
+	PrivateFrom     string                 `json:"privateFrom,omitempty"`
+	RegisterAs      string                 `json:"registerAs,omitempty"`
+	Request         *messages.RequestEcho  `json:"request,omitempty"`
+	Submitted       string                 `json:"submitted"`
+}
+
+// NonceRecord is persisted for each address that transactions are submitted from with a nonce
+// assigned by the gateway, so the nonce view of the address is not reset by a restart
+type NonceRecord struct {
+	Address      string `json:"address"`
+	HighestNonce int64  `json:"highestNonce"`
+}
+
+// nonceRecordPrefix distinguishes the nonce records from the in-flight records, which are keyed by transaction hash
+const nonceRecordPrefix = "nonce:"
+
+// RecoveryContextFactory returns the context to send the reply for a recovered transaction to,
+// or nil if a reply has already been recorded for the request, so no reply is needed
+type RecoveryContextFactory func(record *InflightRecord) TxnContext
+
+// RecoveryResult summarizes the transactions recovered on startup
+type RecoveryResult struct {
+	Resumed int `json:"resumed"`
+	Lost    int `json:"lost"`
+	Skipped int `json:"skipped"`
+	Nonces  int `json:"nonces"`
+}
+
+// RecoverInflight sets the store that in-flight transactions are persisted to, and resumes
+// tracking the transactions that were in-flight when the gateway last stopped. Each is checked
+// against the node, and a transaction that is neither mined nor known to the node gets an
+// error reply, instead of being lost silently. The highest nonce submitted from each address is
+// restored too, so the node is not trusted for a nonce below it. It must be called before messages
+// are processed
+func (p *txnProcessor) RecoverInflight(store kvstore.KVStore, newContext RecoveryContextFactory) (*RecoveryResult, error) {
+	var records []*InflightRecord
+	nonces := make(map[string]int64)
+	it := store.NewIterator()
+	for it.Next() {
+		if strings.HasPrefix(it.Key(), nonceRecordPrefix) {
+			var record NonceRecord
+			if err := json.Unmarshal(it.Value(), &record); err != nil {
+				log.Errorf("Skipping invalid nonce record '%s': %s", it.Key(), err)
+				continue
+			}
+			nonces[record.Address] = record.HighestNonce
+			continue
+		}
+		var record InflightRecord
+		if err := json.Unmarshal(it.Value(), &record); err != nil {
+			log.Errorf("Skipping invalid in-flight record '%s': %s", it.Key(), err)
+			continue
+		}
+		records = append(records, &record)
+	}
+	it.Release()
+	p.inflightStore = store
+
+	result := &RecoveryResult{}
+	for _, record := range records {
+		txnContext := newContext(record)
+		if txnContext == nil {
+			log.Infof("Reply already recorded for in-flight transaction %s (request %s)", record.TransactionHash, record.Headers.ID)
+			p.forgetInflight(record.TransactionHash)
+			result.Skipped++
+			continue
+		}
+		inflight, err := p.addRecoveredInflight(txnContext, record)
+		if err != nil {
+			return nil, err
+		}
+		known, err := p.knownToNode(inflight)
+		if err != nil {
+			// Keep waiting for the receipt, in case connectivity to the node resumes within the timeout
+			log.Warnf("Unable to check transaction %s with the node: %s", record.TransactionHash, err)
+		} else if !known {
+			log.Warnf("In-flight transaction %s (request %s) is no longer known to the node", record.TransactionHash, record.Headers.ID)
+			err = errors.Errorf(errors.TransactionRecoveryNotFound, record.TransactionHash)
+			p.emitLifecycleFailed(txnContext, inflight, err)
+			txnContext.SendErrorReplyWithTX(500, err, record.TransactionHash)
+			p.cancelInFlight(inflight, true)
+			p.forgetInflight(record.TransactionHash)
+			// The nonce of a lost transaction is free to be used again
+			if highest, exists := nonces[inflight.from]; exists && !record.NodeAssignNonce && record.Nonce <= highest {
+				nonces[inflight.from] = record.Nonce - 1
+			}
+			result.Lost++
+			continue
+		}
+		log.Infof("Resuming tracking of in-flight transaction %s (request %s)", record.TransactionHash, record.Headers.ID)
+		p.trackMining(inflight, inflight.tx)
+		result.Resumed++
+	}
+	result.Nonces = p.restoreNonces(nonces)
+	return result, nil
+}
+
+// restoreNonces restores the highest nonce submitted from each address before the restart. Where
+// transactions were resumed, it raises the highest nonce in-flight. Otherwise it is held until the
+// next transaction from the address, as the lowest nonce the node can return
+func (p *txnProcessor) restoreNonces(nonces map[string]int64) int {
+	p.inflightTxnsLock.Lock()
+	defer p.inflightTxnsLock.Unlock()
+	for addr, highestNonce := range nonces {
+		if highestNonce < 0 {
+			continue
+		}
+		if inflightForAddr, exists := p.inflightTxns[addr]; exists {
+			if highestNonce > inflightForAddr.highestNonce {
+				inflightForAddr.highestNonce = highestNonce
+			}
+		} else {
+			p.recoveredNonces[addr] = highestNonce
+		}
+		log.Infof("Restored highest nonce %d for %s", highestNonce, addr)
+	}
+	return len(nonces)
+}
+
+// recoveredNonce raises a nonce returned by the node, to follow on from the highest nonce submitted
+// from the address before a restart. Must be called under the in-flight lock
+func (p *txnProcessor) recoveredNonce(addr string, nodeNonce int64) int64 {
+	highestNonce, exists := p.recoveredNonces[addr]
+	if !exists {
+		return nodeNonce
+	}
+	delete(p.recoveredNonces, addr)
+	if nodeNonce <= highestNonce {
+		log.Warnf("Node returned nonce %d for %s, below the highest nonce %d submitted before the restart", nodeNonce, addr, highestNonce)
+		return highestNonce + 1
+	}
+	return nodeNonce
+}
+
+// addRecoveredInflight adds a recovered transaction to the in-flight list of its address,
+// so the nonces assigned to new transactions follow on from it
+func (p *txnProcessor) addRecoveredInflight(txnContext TxnContext, record *InflightRecord) (inflight *inflightTxn, err error) {
+	inflight = &inflightTxn{
+		from:            strings.ToLower(record.From),
+		nonce:           record.Nonce,
+		nodeAssignNonce: record.NodeAssignNonce,
+		privacyGroupID:  record.PrivacyGroupID,
+		registerAs:      record.RegisterAs,
+		requestEcho:     record.Request,
+		txnContext:      txnContext,
+		rpc:             p.rpc,
+		added:           time.Now(),
+		tx: &eth.Txn{
+			Hash:           record.TransactionHash,
+			PrivacyGroupID: record.PrivacyGroupID,
+			PrivateFrom:    record.PrivateFrom,
+		},
+	}
+	if addressBook := p.getAddressBook(); addressBook != nil {
+		if inflight.rpc, err = addressBook.lookup(txnContext.Context(), inflight.from); err != nil {
+			return nil, err
+		}
+	}
+
+	p.inflightTxnsLock.Lock()
+	inflight.id = highestID
+	highestID++
+	inflightForAddr, exists := p.inflightTxns[inflight.from]
+	if !exists {
+		inflightForAddr = &inflightTxnState{highestNonce: -1}
+		p.inflightTxns[inflight.from] = inflightForAddr
+	}
+	if !inflight.nodeAssignNonce && inflight.nonce > inflightForAddr.highestNonce {
+		inflightForAddr.highestNonce = inflight.nonce
+	}
+	inflightForAddr.txnsInFlight = append(inflightForAddr.txnsInFlight, inflight)
+	inflight.initialWaitDelay = p.inflightTxnDelayer.GetInitialDelay() // Must call under lock
+	p.inflightTxnsLock.Unlock()
+	return inflight, nil
+}
+
+// knownToNode checks whether a transaction has been mined, or is still in the transaction pool of the node
+func (p *txnProcessor) knownToNode(inflight *inflightTxn) (bool, error) {
+	ctx, cancel := context.WithTimeout(inflight.txnContext.Context(), 30*time.Second)
+	defer cancel()
+	var info *eth.TxnInfo
+	if err := inflight.rpc.CallContext(ctx, &info, "eth_getTransactionByHash", inflight.tx.Hash); err != nil {
+		return false, errors.Errorf(errors.RPCCallReturnedError, "eth_getTransactionByHash", err)
+	}
+	return info != nil, nil
+}
+
+// persistInflight records a transaction that has been submitted to the node, when recovery is enabled
+func (p *txnProcessor) persistInflight(inflight *inflightTxn, tx *eth.Txn) {
+	if p.inflightStore == nil {
+		return
+	}
+	record := &InflightRecord{
+		Headers:         *inflight.txnContext.Headers(),
+		From:            inflight.from,
+		Nonce:           inflight.nonce,
+		NodeAssignNonce: inflight.nodeAssignNonce,
+		TransactionHash: tx.Hash,
+		PrivacyGroupID:  inflight.privacyGroupID,
+		PrivateFrom:     tx.PrivateFrom,
+		RegisterAs:      inflight.registerAs,
+		Request:         inflight.requestEcho,
+		Submitted:       time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	b, _ := json.Marshal(record)
+	if err := p.inflightStore.Put(tx.Hash, b); err != nil {
+		log.Errorf("Failed to persist in-flight transaction %s: %s", tx.Hash, err)
+	}
+	if !inflight.nodeAssignNonce {
+		p.persistNonce(inflight.from, inflight.nonce, false)
+	}
+}
+
+// persistNonce records the highest nonce submitted from an address, when recovery is enabled.
+// A lower nonce only replaces the record when it is reset
+func (p *txnProcessor) persistNonce(addr string, nonce int64, reset bool) {
+	if p.inflightStore == nil {
+		return
+	}
+	p.nonceRecordsLock.Lock()
+	defer p.nonceRecordsLock.Unlock()
+	key := nonceRecordPrefix + addr
+	if !reset {
+		var existing NonceRecord
+		if b, err := p.inflightStore.Get(key); err == nil && json.Unmarshal(b, &existing) == nil && existing.HighestNonce >= nonce {
+			return
+		}
+	}
+	var err error
+	if nonce < 0 {
+		err = p.inflightStore.Delete(key)
+	} else {
+		b, _ := json.Marshal(&NonceRecord{Address: addr, HighestNonce: nonce})
+		err = p.inflightStore.Put(key, b)
+	}
+	if err != nil {
+		log.Errorf("Failed to persist highest nonce %d for %s: %s", nonce, addr, err)
+	}
+}
+
+// forgetInflight removes the record of a transaction once a reply has been sent for it
+func (p *txnProcessor) forgetInflight(txHash string) {
+	if p.inflightStore == nil {
+		return
+	}
+	if err := p.inflightStore.Delete(txHash); err != nil {
+		log.Errorf("Failed to remove in-flight transaction %s: %s", txHash, err)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRecoveredTxHash = "0xe2215336b09f9b5b82e36e1144ed64f40a42e61b68fdaca82549fd98b8531a89"
+
+type testAddressBook struct {
+	err error
+}
+
+func (a *testAddressBook) lookup(ctx context.Context, addr string) (eth.RPCClient, error) {
+	return nil, a.err
+}
+
+type undeletableKV struct {
+	*kvstore.MockKV
+}
+
+func (u *undeletableKV) Delete(key string) error {
+	return fmt.Errorf("pop")
+}
+
+func newTestRecoveryStore() *kvstore.MockKV {
+	store := kvstore.NewMockKV(nil)
+	b, _ := json.Marshal(&InflightRecord{
+		Headers:         messages.CommonHeaders{ID: "req1", MsgType: messages.MsgTypeSendTransaction},
+		From:            strings.ToLower(testFromAddr),
+		Nonce:           10,
+		TransactionHash: testRecoveredTxHash,
+		Submitted:       time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	store.KVS[testRecoveredTxHash] = b
+	return store
+}
+
+func newTestRecoveryProcessor(rpc *testRPC) *txnProcessor {
+	p := NewTxnProcessor(&TxnProcessorConf{MaxTXWaitTime: 1}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	p.Init(rpc)
+	p.maxTXWaitTime = 250 * time.Millisecond
+	return p
+}
+
+func TestRecoverInflightMined(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	rpc.ethGetTransactionByHashResult = &eth.TxnInfo{}
+	p := newTestRecoveryProcessor(rpc)
+	store := newTestRecoveryStore()
+
+	txnContext := &testTxnContext{jsonMsg: `{"headers":{"id":"req1","type":"SendTransaction"}}`}
+	var recovered *InflightRecord
+	result, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		recovered = record
+		return txnContext
+	})
+	assert.NoError(err)
+	assert.Equal(&RecoveryResult{Resumed: 1}, result)
+	assert.Equal("req1", recovered.Headers.ID)
+	assert.Equal(int64(10), recovered.Nonce)
+
+	inflightForAddr := p.inflightTxns[strings.ToLower(testFromAddr)]
+	assert.Equal(int64(10), inflightForAddr.highestNonce)
+	inflightForAddr.txnsInFlight[0].wg.Wait()
+
+	assert.Empty(txnContext.errorReplies)
+	assert.Equal(messages.MsgTypeTransactionSuccess, txnContext.replies[0].ReplyHeaders().MsgType)
+	assert.Equal("eth_getTransactionByHash", rpc.calls[0])
+	assert.Empty(store.KVS)
+	_, exists := p.inflightTxns[strings.ToLower(testFromAddr)]
+	assert.False(exists)
+}
+
+func TestRecoverInflightLost(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	p := newTestRecoveryProcessor(rpc)
+	store := newTestRecoveryStore()
+
+	txnContext := &testTxnContext{jsonMsg: `{"headers":{"id":"req1","type":"SendTransaction"}}`}
+	result, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		return txnContext
+	})
+	assert.NoError(err)
+	assert.Equal(&RecoveryResult{Lost: 1}, result)
+	assert.Regexp("is no longer known to the node", txnContext.errorReplies[0].err)
+	assert.Equal(testRecoveredTxHash, txnContext.errorReplies[0].txHash)
+	assert.Empty(store.KVS)
+	assert.Empty(p.inflightTxns)
+}
+
+func TestRecoverInflightNodeUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	rpc.ethGetTransactionByHashErr = fmt.Errorf("pop")
+	p := newTestRecoveryProcessor(rpc)
+	store := newTestRecoveryStore()
+
+	txnContext := &testTxnContext{jsonMsg: `{"headers":{"id":"req1","type":"SendTransaction"}}`}
+	result, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		return txnContext
+	})
+	assert.NoError(err)
+	assert.Equal(&RecoveryResult{Resumed: 1}, result)
+	p.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg.Wait()
+	assert.Equal(messages.MsgTypeTransactionSuccess, txnContext.replies[0].ReplyHeaders().MsgType)
+}
+
+func TestRecoverInflightAlreadyReplied(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	p := newTestRecoveryProcessor(rpc)
+	store := newTestRecoveryStore()
+	store.KVS["bad"] = []byte("!json")
+
+	result, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(&RecoveryResult{Skipped: 1}, result)
+	assert.Empty(rpc.calls)
+	assert.Equal([]string{"bad"}, func() []string {
+		keys := []string{}
+		for k := range store.KVS {
+			keys = append(keys, k)
+		}
+		return keys
+	}())
+}
+
+func TestRecoverInflightAddressBookFail(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestRecoveryProcessor(goodMessageRPC())
+	p.addressBook = &testAddressBook{err: fmt.Errorf("pop")}
+	store := newTestRecoveryStore()
+
+	_, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		return &testTxnContext{}
+	})
+	assert.Regexp("pop", err)
+}
+
+func TestSendTransactionPersistsInflight(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	p := newTestRecoveryProcessor(rpc)
+	store := &undeletableKV{kvstore.NewMockKV(nil)} // leave the record behind, to check it
+	_, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext { return nil })
+	assert.NoError(err)
+
+	txnContext := &testTxnContext{jsonMsg: goodSendTxnJSON}
+	p.OnMessage(txnContext)
+	for len(txnContext.replies) == 0 && len(txnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	var record InflightRecord
+	err = json.Unmarshal(store.KVS[testRecoveredTxHash], &record)
+	assert.NoError(err)
+	assert.Equal(strings.ToLower(testFromAddr), record.From)
+	assert.Equal(testRecoveredTxHash, record.TransactionHash)
+	assert.Equal(messages.MsgTypeSendTransaction, record.Headers.MsgType)
+	assert.NotEmpty(record.Submitted)
+}
+
+func TestRecoverInflightRestoresNonces(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	rpc.ethGetTransactionByHashResult = &eth.TxnInfo{}
+	p := newTestRecoveryProcessor(rpc)
+	store := newTestRecoveryStore()
+	from := strings.ToLower(testFromAddr)
+	b, _ := json.Marshal(&NonceRecord{Address: from, HighestNonce: 15})
+	store.KVS[nonceRecordPrefix+from] = b
+	b, _ = json.Marshal(&NonceRecord{Address: "0x12345", HighestNonce: 20})
+	store.KVS[nonceRecordPrefix+"0x12345"] = b
+	store.KVS[nonceRecordPrefix+"bad"] = []byte("!json")
+
+	txnContext := &testTxnContext{jsonMsg: `{"headers":{"id":"req1","type":"SendTransaction"}}`}
+	result, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		return txnContext
+	})
+	assert.NoError(err)
+	assert.Equal(&RecoveryResult{Resumed: 1, Nonces: 2}, result)
+
+	// The resumed transaction has nonce 10, but nonces up to 15 were submitted before the restart
+	inflightForAddr := p.inflightTxns[from]
+	assert.Equal(int64(15), inflightForAddr.highestNonce)
+	inflightForAddr.txnsInFlight[0].wg.Wait()
+	assert.Equal(map[string]int64{"0x12345": 20}, p.recoveredNonces)
+}
+
+func TestRecoverInflightLostLowersNonce(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestRecoveryProcessor(goodMessageRPC())
+	store := newTestRecoveryStore()
+	from := strings.ToLower(testFromAddr)
+	b, _ := json.Marshal(&NonceRecord{Address: from, HighestNonce: 12})
+	store.KVS[nonceRecordPrefix+from] = b
+
+	result, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext {
+		return &testTxnContext{}
+	})
+	assert.NoError(err)
+	assert.Equal(&RecoveryResult{Lost: 1, Nonces: 1}, result)
+	assert.Equal(map[string]int64{from: 9}, p.recoveredNonces)
+}
+
+func TestRecoveredNonce(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestRecoveryProcessor(goodMessageRPC())
+	p.recoveredNonces["0x12345"] = 15
+	p.recoveredNonces["0x67890"] = 15
+
+	assert.Equal(int64(16), p.recoveredNonce("0x12345", 12))
+	assert.Equal(int64(20), p.recoveredNonce("0x67890", 20))
+	assert.Equal(int64(12), p.recoveredNonce("0x12345", 12))
+	assert.Empty(p.recoveredNonces)
+}
+
+func TestSendTransactionFollowsRecoveredNonce(t *testing.T) {
+	assert := assert.New(t)
+	rpc := goodMessageRPC()
+	rpc.ethGetTransactionCountResult = 10
+	p := newTestRecoveryProcessor(rpc)
+	p.conf.AlwaysManageNonce = true
+	store := kvstore.NewMockKV(nil)
+	from := strings.ToLower(testFromAddr)
+	b, _ := json.Marshal(&NonceRecord{Address: from, HighestNonce: 15})
+	store.KVS[nonceRecordPrefix+from] = b
+	_, err := p.RecoverInflight(store, func(record *InflightRecord) TxnContext { return nil })
+	assert.NoError(err)
+
+	txnContext := &testTxnContext{jsonMsg: goodSendTxnJSON}
+	p.OnMessage(txnContext)
+	for len(txnContext.replies) == 0 && len(txnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Equal("eth_getTransactionCount", rpc.calls[0])
+	sendTX := rpc.params[1][0].(*eth.SendTXArgs)
+	assert.Equal(uint64(16), uint64(*sendTX.Nonce))
+	var record NonceRecord
+	err = json.Unmarshal(store.KVS[nonceRecordPrefix+from], &record)
+	assert.NoError(err)
+	assert.Equal(int64(16), record.HighestNonce)
+}
+
+func TestPersistNonce(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestRecoveryProcessor(goodMessageRPC())
+	p.persistNonce("0x12345", 10, false) // not enabled
+	store := kvstore.NewMockKV(nil)
+	p.inflightStore = store
+
+	getNonce := func() int64 {
+		var record NonceRecord
+		err := json.Unmarshal(store.KVS[nonceRecordPrefix+"0x12345"], &record)
+		assert.NoError(err)
+		return record.HighestNonce
+	}
+	p.persistNonce("0x12345", 10, false)
+	assert.Equal(int64(10), getNonce())
+	p.persistNonce("0x12345", 8, false)
+	assert.Equal(int64(10), getNonce())
+	p.persistNonce("0x12345", 8, true)
+	assert.Equal(int64(8), getNonce())
+	p.persistNonce("0x12345", -1, true)
+	assert.Empty(store.KVS)
+
+	p.inflightStore = &undeletableKV{store}
+	p.persistNonce("0x12345", -1, true) // error is logged
+}
+
+func TestResetNoncePersisted(t *testing.T) {
+	assert := assert.New(t)
+	p := newTestPendingProcessor(&testRPC{})
+	store := kvstore.NewMockKV(nil)
+	p.inflightStore = store
+	from := "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	p.persistNonce(from, 30, false)
+	p.recoveredNonces[from] = 30
+
+	nextNonce := int64(20)
+	_, err := p.ResetNonce(from, &nextNonce)
+	assert.NoError(err)
+	var record NonceRecord
+	err = json.Unmarshal(store.KVS[nonceRecordPrefix+from], &record)
+	assert.NoError(err)
+	assert.Equal(int64(19), record.HighestNonce)
+	assert.Empty(p.recoveredNonces)
+
+	_, err = p.ResetNonce(from, nil)
+	assert.NoError(err)
+	assert.Empty(store.KVS)
+}
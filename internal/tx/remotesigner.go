@@ -0,0 +1,115 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	log "github.com/sirupsen/logrus"
+)
+
+// RemoteSignerConf configures signing by an external EthSigner or Web3Signer, for the listed
+// from addresses, so their private keys are held by neither ethconnect nor the node
+type RemoteSignerConf struct {
+	URL       string   `json:"url"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// remoteSigner signs transactions with eth_signTransaction over JSON/RPC, for the from addresses it holds the keys for
+type remoteSigner struct {
+	rpc       eth.RPCClient
+	connErr   error
+	addresses map[string]bool
+}
+
+type remoteTXSigner struct {
+	rs      *remoteSigner
+	address ethbinding.Address
+}
+
+func newRemoteSigner(conf *RemoteSignerConf) *remoteSigner {
+	rs := &remoteSigner{
+		addresses: make(map[string]bool),
+	}
+	for _, addr := range conf.Addresses {
+		rs.addresses[strings.ToLower(ethbind.API.HexToAddress(addr).Hex())] = true
+	}
+	if rs.rpc, rs.connErr = eth.RPCConnect(&eth.RPCConnOpts{URL: conf.URL}); rs.connErr != nil {
+		log.Errorf("Failed to connect to remote signer: %s", rs.connErr)
+	} else {
+		log.Infof("Remote signer enabled for %d addresses", len(rs.addresses))
+	}
+	return rs
+}
+
+// signerFor returns the signer for a from address, or nil if the remote signer does not hold its key
+func (rs *remoteSigner) signerFor(from string) (eth.TXSigner, error) {
+	if !ethbind.API.IsHexAddress(from) {
+		return nil, nil
+	}
+	address := ethbind.API.HexToAddress(from)
+	if !rs.addresses[strings.ToLower(address.Hex())] {
+		return nil, nil
+	}
+	if rs.connErr != nil {
+		return nil, rs.connErr
+	}
+	return &remoteTXSigner{rs: rs, address: address}, nil
+}
+
+func (s *remoteTXSigner) Type() string {
+	return "Remote Signer"
+}
+
+func (s *remoteTXSigner) Address() string {
+	return s.address.String()
+}
+
+// Sign passes the transaction to the remote signer with eth_signTransaction, which returns it signed and RLP encoded
+func (s *remoteTXSigner) Sign(tx *ethbinding.Transaction) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	nonce := ethbinding.HexUint64(tx.Nonce())
+	gas := ethbinding.HexUint64(tx.Gas())
+	data := ethbinding.HexBytes(tx.Data())
+	txArgs := &eth.SendTXArgs{
+		Nonce:    &nonce,
+		From:     s.address.Hex(),
+		Gas:      &gas,
+		GasPrice: (*ethbinding.HexBigInt)(tx.GasPrice()),
+		Value:    ethbinding.HexBigInt(*tx.Value()),
+		Data:     &data,
+	}
+	if to := tx.To(); to != nil {
+		txArgs.To = to.Hex()
+	}
+
+	var signedHex string
+	if err := s.rs.rpc.CallContext(ctx, &signedHex, "eth_signTransaction", txArgs); err != nil {
+		return nil, errors.Errorf(errors.RemoteSignerSignFailed, s.address.Hex(), err)
+	}
+	signed, err := ethbind.API.HexDecode(signedHex)
+	if err != nil || len(signed) == 0 {
+		return nil, errors.Errorf(errors.RemoteSignerBadResponse, s.address.Hex(), signedHex)
+	}
+	return signed, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRemoteSignedTX = "0xf86c0a8502540be400825208940000000000000000000000000000000000000000880de0b6b3a76400008025a0"
+
+type testRemoteSignerServer struct {
+	*httptest.Server
+	params []map[string]interface{}
+	result interface{}
+	err    string
+}
+
+func newTestRemoteSignerServer() *testRemoteSignerServer {
+	s := &testRemoteSignerServer{result: testRemoteSignedTX}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var rpcReq struct {
+			ID     json.RawMessage          `json:"id"`
+			Method string                   `json:"method"`
+			Params []map[string]interface{} `json:"params"`
+		}
+		json.NewDecoder(req.Body).Decode(&rpcReq)
+		rpcRes := map[string]interface{}{"jsonrpc": "2.0", "id": rpcReq.ID}
+		if rpcReq.Method != "eth_signTransaction" {
+			rpcRes["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		} else if s.err != "" {
+			rpcRes["error"] = map[string]interface{}{"code": -32000, "message": s.err}
+		} else {
+			s.params = append(s.params, rpcReq.Params...)
+			rpcRes["result"] = s.result
+		}
+		b, _ := json.Marshal(rpcRes)
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(b)
+	}))
+	return s
+}
+
+func TestRemoteSignerFor(t *testing.T) {
+	assert := assert.New(t)
+	server := newTestRemoteSignerServer()
+	defer server.Close()
+
+	rs := newRemoteSigner(&RemoteSignerConf{URL: server.URL, Addresses: []string{testFromAddr}})
+	signer, err := rs.signerFor("0x83DBC8E329B38CBA0FC4ED99B1CE9C2A390ABDC1")
+	assert.NoError(err)
+	assert.Equal("Remote Signer", signer.Type())
+	assert.Equal(ethbind.API.HexToAddress(testFromAddr).String(), signer.Address())
+
+	signer, err = rs.signerFor("0x0000000000000000000000000000000000000001")
+	assert.NoError(err)
+	assert.Nil(signer)
+
+	signer, err = rs.signerFor("hd-testinst-testwallet-1234")
+	assert.NoError(err)
+	assert.Nil(signer)
+}
+
+func TestRemoteSignerConnectFail(t *testing.T) {
+	assert := assert.New(t)
+
+	rs := newRemoteSigner(&RemoteSignerConf{URL: "!!!bad", Addresses: []string{testFromAddr}})
+	_, err := rs.signerFor(testFromAddr)
+	assert.Regexp("JSON/RPC connection to !!!bad failed", err)
+}
+
+func TestRemoteSignerSign(t *testing.T) {
+	assert := assert.New(t)
+	server := newTestRemoteSignerServer()
+	defer server.Close()
+
+	rs := newRemoteSigner(&RemoteSignerConf{URL: server.URL, Addresses: []string{testFromAddr}})
+	signer, _ := rs.signerFor(testFromAddr)
+	to := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	signed, err := signer.Sign(ethbind.API.NewTransaction(5, to, big.NewInt(10), 21000, big.NewInt(1000), []byte{0x01, 0x02}))
+	assert.NoError(err)
+	assert.Equal(testRemoteSignedTX, ethbind.API.HexEncode(signed))
+
+	txArgs := server.params[0]
+	assert.Equal("0x5", txArgs["nonce"])
+	assert.Equal(ethbind.API.HexToAddress(testFromAddr).Hex(), txArgs["from"])
+	assert.Equal(to.Hex(), txArgs["to"])
+	assert.Equal("0x5208", txArgs["gas"])
+	assert.Equal("0x3e8", txArgs["gasPrice"])
+	assert.Equal("0xa", txArgs["value"])
+	assert.Equal("0x0102", txArgs["data"])
+
+	// Contract deployments have no to address
+	_, err = signer.Sign(ethbind.API.NewContractCreation(6, big.NewInt(0), 21000, big.NewInt(0), []byte{}))
+	assert.NoError(err)
+	_, hasTo := server.params[1]["to"]
+	assert.False(hasTo)
+}
+
+func TestRemoteSignerSignFail(t *testing.T) {
+	assert := assert.New(t)
+	server := newTestRemoteSignerServer()
+	defer server.Close()
+
+	rs := newRemoteSigner(&RemoteSignerConf{URL: server.URL, Addresses: []string{testFromAddr}})
+	signer, _ := rs.signerFor(testFromAddr)
+	tx := ethbind.API.NewContractCreation(0, big.NewInt(0), 21000, big.NewInt(0), []byte{})
+
+	server.err = "locked"
+	_, err := signer.Sign(tx)
+	assert.Regexp("FFEC100396.*locked", err)
+
+	server.err = ""
+	server.result = "not hex"
+	_, err = signer.Sign(tx)
+	assert.Regexp("FFEC100397.*not hex", err)
+}
+
+func TestOnSendTransactionMessageRemoteSigner(t *testing.T) {
+	assert := assert.New(t)
+	server := newTestRemoteSignerServer()
+	defer server.Close()
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		RemoteSigner: RemoteSignerConf{
+			URL:       server.URL,
+			Addresses: []string{testFromAddr},
+		},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{jsonMsg: goodSendTxnJSON}
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	resolved, err := txnProcessor.ResolveAddress(testFromAddr)
+	assert.NoError(err)
+	assert.Equal(ethbind.API.HexToAddress(testFromAddr).String(), resolved)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.errorReplies)
+	var rawTX interface{}
+	for i, method := range testRPC.calls {
+		if method == "eth_sendRawTransaction" {
+			rawTX = testRPC.params[i][0]
+		}
+		assert.NotEqual("eth_sendTransaction", method)
+	}
+	assert.Equal(testRemoteSignedTX, rawTX)
+	assert.Equal(1, len(server.params))
+	assert.Equal(fmt.Sprintf("0x%x", 123), server.params[0]["gas"])
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// echoRequest reports whether the request of a transaction is echoed into its receipt, which
+// is enabled for all transactions in the configuration, or for each request
+func (p *txnProcessor) echoRequest(msg *messages.TransactionCommon) bool {
+	return p.conf.EchoRequest || msg.EchoRequest
+}
+
+// sendRequestEcho is built before the transaction is built, as that flattens the parameters
+func sendRequestEcho(msg *messages.SendTransaction) *messages.RequestEcho {
+	echo := &messages.RequestEcho{
+		Method: msg.MethodName,
+		To:     msg.To,
+		Path:   msg.RequestPath,
+	}
+	var inputs []ethbinding.ABIArgumentMarshaling
+	if msg.Method != nil && msg.Method.Name != "" {
+		echo.Method = msg.Method.Name
+		inputs = msg.Method.Inputs
+	}
+	echo.Params = requestEchoParams(inputs, msg.Parameters)
+	return echo
+}
+
+func deployRequestEcho(msg *messages.DeployContract) *messages.RequestEcho {
+	echo := &messages.RequestEcho{
+		Method: "constructor",
+		Path:   msg.RequestPath,
+	}
+	var inputs []ethbinding.ABIArgumentMarshaling
+	for _, element := range msg.ABI {
+		if element.Type == "constructor" {
+			inputs = element.Inputs
+		}
+	}
+	echo.Params = requestEchoParams(inputs, msg.Parameters)
+	return echo
+}
+
+// requestEchoParams pairs each parameter with the name and type of its ABI input. Without an
+// ABI the type can be supplied inline with each parameter, as {"type":"uint256","value":"1"}
+func requestEchoParams(inputs []ethbinding.ABIArgumentMarshaling, params []interface{}) []*messages.RequestEchoParam {
+	echoParams := make([]*messages.RequestEchoParam, len(params))
+	for i, param := range params {
+		echoParam := &messages.RequestEchoParam{Value: param}
+		if i < len(inputs) {
+			echoParam.Name = inputs[i].Name
+			echoParam.Type = inputs[i].Type
+		} else if inline, ok := param.(map[string]interface{}); ok {
+			typeStr, isString := inline["type"].(string)
+			value, hasValue := inline["value"]
+			if isString && hasValue {
+				echoParam.Type = typeStr
+				echoParam.Value = value
+			}
+		}
+		echoParams[i] = echoParam
+	}
+	return echoParams
+}
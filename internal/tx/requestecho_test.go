@@ -0,0 +1,140 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendRequestEchoWithABI(t *testing.T) {
+	assert := assert.New(t)
+	msg := &messages.SendTransaction{
+		Method: &ethbinding.ABIElementMarshaling{
+			Name: "set",
+			Inputs: []ethbinding.ABIArgumentMarshaling{
+				{Name: "x", Type: "uint256"},
+				{Name: "label", Type: "string"},
+			},
+		},
+	}
+	msg.To = "0xd7fac2bce408ed7c6ded07a32038b1f79c2b27d3"
+	msg.RequestPath = "/contracts/simplestorage/set"
+	msg.Parameters = []interface{}{"42", "answer"}
+
+	echo := sendRequestEcho(msg)
+	assert.Equal("set", echo.Method)
+	assert.Equal(msg.To, echo.To)
+	assert.Equal("/contracts/simplestorage/set", echo.Path)
+	assert.Equal(2, len(echo.Params))
+	assert.Equal("x", echo.Params[0].Name)
+	assert.Equal("uint256", echo.Params[0].Type)
+	assert.Equal("42", echo.Params[0].Value)
+	assert.Equal("label", echo.Params[1].Name)
+	assert.Equal("answer", echo.Params[1].Value)
+}
+
+func TestSendRequestEchoInlineTypes(t *testing.T) {
+	assert := assert.New(t)
+	msg := &messages.SendTransaction{MethodName: "set"}
+	msg.Parameters = []interface{}{
+		map[string]interface{}{"type": "uint256", "value": "42"},
+		"untyped",
+	}
+
+	echo := sendRequestEcho(msg)
+	assert.Equal("set", echo.Method)
+	assert.Equal("", echo.Params[0].Name)
+	assert.Equal("uint256", echo.Params[0].Type)
+	assert.Equal("42", echo.Params[0].Value)
+	assert.Equal("", echo.Params[1].Type)
+	assert.Equal("untyped", echo.Params[1].Value)
+}
+
+func TestDeployRequestEcho(t *testing.T) {
+	assert := assert.New(t)
+	msg := &messages.DeployContract{
+		ABI: ethbinding.ABIMarshaling{
+			{Type: "function", Name: "get"},
+			{Type: "constructor", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "initVal", Type: "uint256"}}},
+		},
+	}
+	msg.RequestPath = "/abis/abi1"
+	msg.Parameters = []interface{}{"12345"}
+
+	echo := deployRequestEcho(msg)
+	assert.Equal("constructor", echo.Method)
+	assert.Equal("", echo.To)
+	assert.Equal("/abis/abi1", echo.Path)
+	assert.Equal("initVal", echo.Params[0].Name)
+	assert.Equal("uint256", echo.Params[0].Type)
+	assert.Equal("12345", echo.Params[0].Value)
+}
+
+func TestEchoRequestPerMessageOrConfig(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{}}
+	assert.False(p.echoRequest(&messages.TransactionCommon{}))
+	assert.True(p.echoRequest(&messages.TransactionCommon{EchoRequest: true}))
+	p.conf.EchoRequest = true
+	assert.True(p.echoRequest(&messages.TransactionCommon{}))
+}
+
+func TestOnSendTransactionMessageEchoRequestInReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		EchoRequest:   true,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"" + testFromAddr + "\"," +
+		"  \"to\":\"0xd7fac2bce408ed7c6ded07a32038b1f79c2b27d3\"," +
+		"  \"gas\":\"123\"," +
+		"  \"method\":{\"name\":\"set\",\"inputs\":[{\"name\":\"x\",\"type\":\"uint256\"}]}," +
+		"  \"params\":[\"42\"]" +
+		"}"
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	from := strings.ToLower(testFromAddr)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[from] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnProcessor.inflightTxns[from].txnsInFlight[0].wg.Wait()
+	assert.Equal(0, len(testTxnContext.errorReplies))
+
+	replyMsgBytes, _ := json.Marshal(testTxnContext.replies[0])
+	var replyMsgMap map[string]interface{}
+	json.Unmarshal(replyMsgBytes, &replyMsgMap)
+	request := replyMsgMap["request"].(map[string]interface{})
+	assert.Equal("set", request["method"])
+	assert.Equal("0xd7fac2bce408ed7c6ded07a32038b1f79c2b27d3", request["to"])
+	param := request["params"].([]interface{})[0].(map[string]interface{})
+	assert.Equal("x", param["name"])
+	assert.Equal("uint256", param["type"])
+	assert.Equal("42", param["value"])
+}
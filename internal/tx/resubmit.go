@@ -0,0 +1,99 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultResubmitAttempts = 3
+)
+
+// ResubmitConf configures resending a transaction with a higher gas price, when it has not been
+// mined within a number of seconds of being sent. The gas price is bumped by the fee bump
+// percentage, up to the fee bump maximum gas price
+type ResubmitConf struct {
+	AfterSec    int `json:"afterSec,omitempty"`
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+}
+
+func (p *txnProcessor) resubmitAttempts() int {
+	if p.conf.Resubmit.MaxAttempts <= 0 {
+		return defaultResubmitAttempts
+	}
+	return p.conf.Resubmit.MaxAttempts
+}
+
+// resubmittable checks whether an in-flight transaction can be resubmitted automatically. Only a
+// transaction with a nonce assigned by ethconnect, and a signed payload, can be replaced - and
+// not on a chain that requires a gas price of zero, as the fees cannot be raised
+func (p *txnProcessor) resubmittable(inflight *inflightTxn) bool {
+	p.inflightTxnsLock.Lock()
+	defer p.inflightTxnsLock.Unlock()
+	return p.conf.Resubmit.AfterSec > 0 &&
+		!p.zeroGasPrice() &&
+		len(inflight.resubmissions) < p.resubmitAttempts() &&
+		!inflight.nodeAssignNonce &&
+		inflight.tx.EthTX != nil &&
+		inflight.cancellation == nil
+}
+
+// resubmitDue checks whether an in-flight transaction has waited long enough since it was last sent to be resubmitted
+func (p *txnProcessor) resubmitDue(inflight *inflightTxn) bool {
+	return p.resubmittable(inflight) && time.Since(inflight.lastSent) >= time.Duration(p.conf.Resubmit.AfterSec)*time.Second
+}
+
+// resubmitAfter returns a channel that fires when an in-flight transaction is due to be resubmitted,
+// or nil if it will not be resubmitted
+func (p *txnProcessor) resubmitAfter(inflight *inflightTxn) <-chan time.Time {
+	if !p.resubmittable(inflight) {
+		return nil
+	}
+	return time.After(time.Until(inflight.lastSent.Add(time.Duration(p.conf.Resubmit.AfterSec) * time.Second)))
+}
+
+// resubmitInflight resends an in-flight transaction that has not been mined with a higher gas price,
+// on the goroutine tracking it. Each attempt is recorded, whether or not it succeeds, to be included
+// in the receipt
+func (p *txnProcessor) resubmitInflight(inflight *inflightTxn) {
+	current := inflight.tx
+	resubmission := &messages.Resubmission{
+		Attempt:                 len(inflight.resubmissions) + 1,
+		Time:                    time.Now().UTC().Format(time.RFC3339Nano),
+		ReplacedTransactionHash: current.Hash,
+	}
+	replacement, err := p.replaceInflight(inflight.txnContext.Context(), inflight, &speedUpRequest{txHash: current.Hash})
+	if err != nil {
+		log.Warnf("In-flight %d resubmission %d/%d failed. nonce=%d hash=%s: %s", inflight.id, resubmission.Attempt, p.resubmitAttempts(), inflight.nonce, current.Hash, err)
+		resubmission.Error = err.Error()
+	} else {
+		resubmission.TransactionHash = replacement.Hash
+		if replacement.IsDynamicFee() {
+			resubmission.MaxFeePerGasStr = replacement.MaxFeePerGas.Text(10)
+			resubmission.MaxPriorityFeePerGasStr = replacement.MaxPriorityFeePerGas.Text(10)
+		} else {
+			resubmission.GasPriceStr = replacement.EthTX.GasPrice().Text(10)
+		}
+		log.Infof("In-flight %d resubmitted %d/%d without a receipt. nonce=%d replaced=%s with=%s", inflight.id, resubmission.Attempt, p.resubmitAttempts(), inflight.nonce, current.Hash, replacement.Hash)
+	}
+	p.inflightTxnsLock.Lock()
+	inflight.resubmissions = append(inflight.resubmissions, resubmission)
+	inflight.lastSent = time.Now() // the next attempt waits the full interval, even after a failure
+	p.inflightTxnsLock.Unlock()
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResubmitInflightGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+	p.conf.Resubmit.AfterSec = 1
+
+	p.resubmitInflight(inflight)
+	p.resubmitInflight(inflight)
+	assert.Equal(2, len(inflight.resubmissions))
+	first := inflight.resubmissions[0]
+	assert.Equal(1, first.Attempt)
+	assert.Equal(testSpeedUpHash, first.ReplacedTransactionHash)
+	assert.Equal(fmt.Sprintf("0x%064x", 1), first.TransactionHash)
+	assert.Equal("1100", first.GasPriceStr)
+	assert.NotEmpty(first.Time)
+	second := inflight.resubmissions[1]
+	assert.Equal(2, second.Attempt)
+	assert.Equal(first.TransactionHash, second.ReplacedTransactionHash)
+	assert.Equal("1210", second.GasPriceStr)
+	assert.Equal(second.TransactionHash, inflight.tx.Hash)
+	assert.Equal(2, len(inflight.replaced))
+	assert.Equal(int64(1210), rpc.sent[1].GasPrice.ToInt().Int64())
+}
+
+func TestResubmitInflightDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+	tx := newFeeBumpTestTxn(0)
+	tx.MaxFeePerGas = big.NewInt(2000)
+	tx.MaxPriorityFeePerGas = big.NewInt(100)
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, tx)
+	p := newSpeedUpTestProcessor(inflight)
+
+	p.resubmitInflight(inflight)
+	assert.Equal("2200", inflight.resubmissions[0].MaxFeePerGasStr)
+	assert.Equal("110", inflight.resubmissions[0].MaxPriorityFeePerGasStr)
+	assert.Empty(inflight.resubmissions[0].GasPriceStr)
+}
+
+func TestResubmitInflightFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{sendErr: fmt.Errorf("pop")}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+	inflight.lastSent = time.Now().Add(-1 * time.Hour)
+
+	p.resubmitInflight(inflight)
+	assert.Equal(1, len(inflight.resubmissions))
+	assert.Regexp("pop", inflight.resubmissions[0].Error)
+	assert.Empty(inflight.resubmissions[0].TransactionHash)
+	assert.Equal(testSpeedUpHash, inflight.tx.Hash)
+	assert.True(time.Since(inflight.lastSent) < time.Minute)
+
+	p.conf.FeeBump.MaxGasPrice = "1000"
+	p.resubmitInflight(inflight)
+	assert.Regexp("FFEC100318", inflight.resubmissions[1].Error)
+	assert.Equal(1, len(rpc.sent))
+}
+
+func TestResubmitDue(t *testing.T) {
+	assert := assert.New(t)
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+	inflight.lastSent = time.Now().Add(-10 * time.Second)
+
+	// Disabled by default
+	assert.False(p.resubmitDue(inflight))
+	assert.Nil(p.resubmitAfter(inflight))
+
+	p.conf.Resubmit.AfterSec = 5
+	assert.True(p.resubmitDue(inflight))
+	assert.NotNil(p.resubmitAfter(inflight))
+
+	p.conf.Resubmit.AfterSec = 60
+	assert.False(p.resubmitDue(inflight))
+
+	p.conf.Resubmit.AfterSec = 5
+	p.conf.Resubmit.MaxAttempts = 1
+	inflight.resubmissions = []*messages.Resubmission{{Attempt: 1}}
+	assert.False(p.resubmitDue(inflight))
+
+	inflight.resubmissions = nil
+	inflight.nodeAssignNonce = true
+	assert.False(p.resubmitDue(inflight))
+
+	inflight.nodeAssignNonce = false
+	inflight.tx.EthTX = nil
+	assert.False(p.resubmitDue(inflight))
+}
+
+func TestResubmitTrackedTransaction(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{mined: map[string]bool{fmt.Sprintf("0x%064x", 1): true}}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	inflight.initialWaitDelay = 10 * time.Millisecond
+	p := newSpeedUpTestProcessor(inflight)
+	p.conf.MaxTXWaitTime = 5
+	p.conf.Resubmit.AfterSec = 1
+	p.Init(rpc)
+
+	p.trackMining(inflight, inflight.tx)
+	inflight.wg.Wait()
+
+	txnContext := inflight.txnContext.(*testTxnContext)
+	assert.Empty(txnContext.errorReplies)
+	reply := txnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionSuccess, reply.Headers.MsgType)
+	assert.Equal(1, len(reply.Resubmissions))
+	assert.Equal(testSpeedUpHash, reply.Resubmissions[0].ReplacedTransactionHash)
+	assert.Equal(fmt.Sprintf("0x%064x", 1), reply.Resubmissions[0].TransactionHash)
+	assert.Equal("1100", reply.Resubmissions[0].GasPriceStr)
+	assert.Empty(p.inflightTxns)
+}
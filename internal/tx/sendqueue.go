@@ -0,0 +1,141 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"sync"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+// sendQueueDepth is the number of sends that can wait for each concurrency slot,
+// before enqueue blocks to push back on the producer
+const sendQueueDepth = 10
+
+// sendQueueItem is a transaction that has been assigned its nonce,
+// and is waiting for a slot to be sent to the node
+type sendQueueItem struct {
+	txnContext TxnContext
+	inflight   *inflightTxn
+	tx         *eth.Txn
+}
+
+// addressSendQueue is the FIFO list of pending sends for a single from address
+type addressSendQueue struct {
+	from    string
+	items   []*sendQueueItem
+	sending bool
+}
+
+// sendScheduler drains the per-address send queues over a fixed number of
+// concurrency slots. Each address has at most one send outstanding at any time,
+// so the sends for an address reach the node in the order the nonces were assigned.
+// Addresses with work waiting are serviced round-robin, so a burst of transactions
+// for one address cannot starve the other addresses.
+// The total number of sends waiting across all addresses is bounded, so that a burst
+// of transactions, or a slow node, pushes back on the producer rather than assigning
+// nonces far ahead of what can be sent.
+type sendScheduler struct {
+	lock       sync.Mutex
+	notFull    *sync.Cond
+	queues     map[string]*addressSendQueue
+	ready      []*addressSendQueue
+	freeSlots  int
+	waiting    int
+	maxWaiting int
+	send       func(item *sendQueueItem)
+}
+
+func newSendScheduler(concurrency int, send func(item *sendQueueItem)) *sendScheduler {
+	s := &sendScheduler{
+		queues:     make(map[string]*addressSendQueue),
+		freeSlots:  concurrency,
+		maxWaiting: concurrency * sendQueueDepth,
+		send:       send,
+	}
+	s.notFull = sync.NewCond(&s.lock)
+	return s
+}
+
+// enqueue adds an item to the tail of the queue for its from address,
+// and dispatches it immediately if there is a slot available.
+// It blocks while the maximum number of sends are already waiting
+func (s *sendScheduler) enqueue(item *sendQueueItem) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for s.waiting >= s.maxWaiting {
+		log.Debugf("Send queue full (waiting=%d) for in-flight %d", s.waiting, item.inflight.id)
+		s.notFull.Wait()
+	}
+	s.waiting++
+
+	from := item.inflight.from
+	q, exists := s.queues[from]
+	if !exists {
+		q = &addressSendQueue{from: from}
+		s.queues[from] = q
+	}
+	q.items = append(q.items, item)
+	if !q.sending && len(q.items) == 1 {
+		// An idle queue that was empty joins the back of the ready list.
+		// Queues that are sending re-join when their current send completes.
+		s.ready = append(s.ready, q)
+	}
+	log.Debugf("Queued send for in-flight %d addr=%s queued=%d sending=%t", item.inflight.id, from, len(q.items), q.sending)
+	s.dispatch()
+}
+
+// queued returns the number of sends waiting for a slot, for the supplied address
+func (s *sendScheduler) queued(from string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if q, exists := s.queues[from]; exists {
+		return len(q.items)
+	}
+	return 0
+}
+
+// dispatch must be called holding the lock
+func (s *sendScheduler) dispatch() {
+	for s.freeSlots > 0 && len(s.ready) > 0 {
+		q := s.ready[0]
+		s.ready = s.ready[1:]
+		item := q.items[0]
+		q.items = q.items[1:]
+		q.sending = true
+		s.freeSlots--
+		s.waiting--
+		s.notFull.Signal()
+		go s.run(q, item)
+	}
+}
+
+func (s *sendScheduler) run(q *addressSendQueue, item *sendQueueItem) {
+	s.send(item)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	q.sending = false
+	s.freeSlots++
+	if len(q.items) > 0 {
+		// Go to the back of the line, behind any other address that is waiting
+		s.ready = append(s.ready, q)
+	} else {
+		delete(s.queues, q.from)
+	}
+	s.dispatch()
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSendQueue struct {
+	started  chan int
+	releases map[int]chan bool
+}
+
+func newTestSendQueue(ids ...int) *testSendQueue {
+	tq := &testSendQueue{
+		started:  make(chan int, len(ids)),
+		releases: make(map[int]chan bool),
+	}
+	for _, id := range ids {
+		tq.releases[id] = make(chan bool)
+	}
+	return tq
+}
+
+func (tq *testSendQueue) send(item *sendQueueItem) {
+	tq.started <- item.inflight.id
+	<-tq.releases[item.inflight.id]
+}
+
+func (s *sendScheduler) idle() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.freeSlots
+}
+
+func testSendQueueItem(id int, from string) *sendQueueItem {
+	return &sendQueueItem{
+		inflight: &inflightTxn{id: id, from: from},
+	}
+}
+
+func TestSendSchedulerFairAcrossAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	tq := newTestSendQueue(1, 2, 3, 4, 5)
+	s := newSendScheduler(2, tq.send)
+
+	// A burst for address A, followed by one each for B and C
+	s.enqueue(testSendQueueItem(1, "0xaaaa"))
+	s.enqueue(testSendQueueItem(2, "0xaaaa"))
+	s.enqueue(testSendQueueItem(3, "0xaaaa"))
+	s.enqueue(testSendQueueItem(4, "0xbbbb"))
+	s.enqueue(testSendQueueItem(5, "0xcccc"))
+
+	// A1 and B1 take the two slots, with A2 held back for ordering
+	assert.ElementsMatch([]int{1, 4}, []int{<-tq.started, <-tq.started})
+	assert.Equal(2, s.queued("0xaaaa"))
+	assert.Equal(1, s.queued("0xcccc"))
+
+	// When A1 completes, C1 goes before A2
+	tq.releases[1] <- true
+	assert.Equal(5, <-tq.started)
+
+	// When B1 completes, A2 goes
+	tq.releases[4] <- true
+	assert.Equal(2, <-tq.started)
+
+	// A3 can only go once A2 completes, even with a free slot
+	tq.releases[5] <- true
+	assert.Equal(1, s.queued("0xaaaa"))
+	tq.releases[2] <- true
+	assert.Equal(3, <-tq.started)
+	tq.releases[3] <- true
+
+	// All queues are cleaned up once the slots are returned
+	for s.idle() != 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(s.queues)
+	assert.Empty(s.ready)
+}
+
+func TestSendSchedulerSingleAddressInOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	tq := newTestSendQueue(1, 2, 3)
+	s := newSendScheduler(10, tq.send)
+
+	s.enqueue(testSendQueueItem(1, "0xaaaa"))
+	s.enqueue(testSendQueueItem(2, "0xaaaa"))
+	s.enqueue(testSendQueueItem(3, "0xaaaa"))
+
+	for i := 1; i <= 3; i++ {
+		assert.Equal(i, <-tq.started)
+		assert.Equal(3-i, s.queued("0xaaaa"))
+		tq.releases[i] <- true
+	}
+}
+
+func TestSendSchedulerBlocksWhenFull(t *testing.T) {
+	assert := assert.New(t)
+
+	tq := newTestSendQueue(1, 2, 3)
+	s := newSendScheduler(1, tq.send)
+	s.maxWaiting = 1
+
+	s.enqueue(testSendQueueItem(1, "0xaaaa"))
+	assert.Equal(1, <-tq.started)
+	s.enqueue(testSendQueueItem(2, "0xaaaa"))
+
+	// The producer blocks, as the one waiting slot is taken
+	enqueued := make(chan bool)
+	go func() {
+		s.enqueue(testSendQueueItem(3, "0xbbbb"))
+		close(enqueued)
+	}()
+	select {
+	case <-enqueued:
+		assert.Fail("enqueue did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once the first send completes, the second is sent and the producer is unblocked
+	tq.releases[1] <- true
+	assert.Equal(2, <-tq.started)
+	<-enqueued
+	assert.Equal(1, s.queued("0xbbbb"))
+	tq.releases[2] <- true
+	assert.Equal(3, <-tq.started)
+	tq.releases[3] <- true
+}
@@ -0,0 +1,261 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+// speedUpRequest is queued to the goroutine tracking an in-flight transaction, which
+// owns the transaction, so it is the only goroutine that resends or replaces it
+type speedUpRequest struct {
+	txnContext  TxnContext
+	txHash      string
+	gasPrice    *big.Int
+	maxFee      *big.Int
+	priorityFee *big.Int
+	cancel      bool // replace with a zero-value transfer, rather than resending the transaction
+}
+
+func newSpeedUpRequest(txnContext TxnContext, msg *messages.SpeedUpTransaction) (req *speedUpRequest, err error) {
+	if msg.TransactionHash == "" {
+		return nil, errors.Errorf(errors.TransactionSpeedUpMissingHash)
+	}
+	req = &speedUpRequest{
+		txnContext: txnContext,
+		txHash:     msg.TransactionHash,
+	}
+	if req.gasPrice, err = speedUpFee("gasPrice", msg.GasPrice); err != nil {
+		return nil, err
+	}
+	if req.maxFee, err = speedUpFee("maxFeePerGas", msg.MaxFeePerGas); err != nil {
+		return nil, err
+	}
+	if req.priorityFee, err = speedUpFee("maxPriorityFeePerGas", msg.MaxPriorityFeePerGas); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func speedUpFee(name string, value json.Number) (*big.Int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	fee, ok := new(big.Int).SetString(value.String(), 10)
+	if !ok || fee.Sign() < 0 {
+		return nil, errors.Errorf(errors.TransactionSpeedUpInvalidFee, name, value)
+	}
+	return fee, nil
+}
+
+// OnSpeedUpTransactionMessage queues a request to resend an in-flight transaction with a
+// higher gas price. The goroutine tracking the transaction sends the reply
+func (p *txnProcessor) OnSpeedUpTransactionMessage(txnContext TxnContext, msg *messages.SpeedUpTransaction) {
+	req, err := newSpeedUpRequest(txnContext, msg)
+	if err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+	if status, err := p.queueSpeedUp(req); err != nil {
+		txnContext.SendErrorReply(status, err)
+	}
+}
+
+func (p *txnProcessor) queueSpeedUp(req *speedUpRequest) (int, error) {
+	p.inflightTxnsLock.Lock()
+	defer p.inflightTxnsLock.Unlock()
+	inflight := p.findInflightByHash(req.txHash)
+	if inflight == nil {
+		return 404, errors.Errorf(errors.TransactionSpeedUpNotFound, req.txHash)
+	}
+	if inflight.nodeAssignNonce || inflight.tx.EthTX == nil {
+		// A transaction recovered after a restart has no signed payload to resend
+		return 400, errors.Errorf(errors.TransactionSpeedUpNotReplaceable, req.txHash)
+	}
+	if p.zeroGasPrice() {
+		return 400, errors.Errorf(errors.TransactionSpeedUpZeroGasPrice, req.txHash)
+	}
+	if inflight.cancellation != nil {
+		return 409, errors.Errorf(errors.TransactionCancelInProgress, inflight.cancellation.cancelledHash, inflight.cancellation.tx.Hash)
+	}
+	if req.cancel && (inflight.privacyGroupID != "" || len(inflight.tx.PrivateFor) > 0) {
+		return 400, errors.Errorf(errors.TransactionCancelPrivate, req.txHash)
+	}
+	select {
+	case inflight.speedUps <- req:
+		return 0, nil
+	default:
+		return 409, errors.Errorf(errors.TransactionSpeedUpInProgress, req.txHash)
+	}
+}
+
+// findInflightByHash returns the transaction that is being tracked with the hash, if any.
+// Must be called holding the in-flight lock
+func (p *txnProcessor) findInflightByHash(txHash string) *inflightTxn {
+	for _, inflightForAddr := range p.inflightTxns {
+		for _, inflight := range inflightForAddr.txnsInFlight {
+			if inflight.tx != nil && !inflight.complete && strings.EqualFold(inflight.tx.Hash, txHash) {
+				return inflight
+			}
+		}
+	}
+	return nil
+}
+
+// speedUpInflight resends an in-flight transaction with the same nonce and higher fees, on
+// the goroutine tracking it. The replaced transaction is still checked for a receipt, as it
+// might be mined before the replacement
+func (p *txnProcessor) speedUpInflight(inflight *inflightTxn, req *speedUpRequest) {
+	if req.cancel {
+		p.sendCancellation(inflight, req)
+		return
+	}
+	current := inflight.tx
+	replacement, err := p.replaceInflight(req.txnContext.Context(), inflight, req)
+	if err != nil {
+		req.txnContext.SendErrorReplyWithTX(400, err, current.Hash)
+		return
+	}
+	log.Infof("In-flight %d sped up. nonce=%d replaced=%s with=%s", inflight.id, inflight.nonce, current.Hash, replacement.Hash)
+
+	reply := &messages.TransactionSpeedUp{
+		TransactionHash:         replacement.Hash,
+		ReplacedTransactionHash: current.Hash,
+		NonceStr:                inflight.nonceNumber().String(),
+	}
+	reply.Headers.MsgType = messages.MsgTypeTransactionSpeedUp
+	if replacement.IsDynamicFee() {
+		reply.MaxFeePerGasStr = replacement.MaxFeePerGas.Text(10)
+		reply.MaxPriorityFeePerGasStr = replacement.MaxPriorityFeePerGas.Text(10)
+	} else {
+		reply.GasPriceStr = replacement.EthTX.GasPrice().Text(10)
+	}
+	req.txnContext.Reply(reply)
+}
+
+// replaceInflight sends a replacement for an in-flight transaction, with the fees of the request,
+// and tracks the replacement in its place
+func (p *txnProcessor) replaceInflight(ctx context.Context, inflight *inflightTxn, req *speedUpRequest) (*eth.Txn, error) {
+	current := inflight.tx
+	replacement := &eth.Txn{
+		NodeAssignNonce:      current.NodeAssignNonce,
+		OrionPrivateAPIS:     current.OrionPrivateAPIS,
+		From:                 current.From,
+		EthTX:                current.EthTX,
+		PrivateFrom:          current.PrivateFrom,
+		PrivateFor:           current.PrivateFor,
+		PrivacyGroupID:       current.PrivacyGroupID,
+		Signer:               current.Signer,
+		MaxFeePerGas:         current.MaxFeePerGas,
+		MaxPriorityFeePerGas: current.MaxPriorityFeePerGas,
+		GasEstimate:          current.GasEstimate,
+		EstimatedGas:         current.EstimatedGas,
+	}
+	if err := p.setSpeedUpFees(ctx, inflight, replacement, req); err != nil {
+		return nil, err
+	}
+	if err := replacement.Send(ctx, inflight.rpc); err != nil {
+		return nil, err
+	}
+
+	p.inflightTxnsLock.Lock()
+	inflight.replaced = append(inflight.replaced, current)
+	inflight.tx = replacement
+	inflight.lastSent = time.Now()
+	p.inflightTxnsLock.Unlock()
+
+	p.persistInflight(inflight, replacement)
+	p.forgetInflight(current.Hash)
+	p.emitLifecycle(inflight.txnContext, inflight, &LifecycleEvent{Type: LifecycleReplaced})
+	return replacement, nil
+}
+
+// setSpeedUpFees sets the fees supplied in the request on the replacement, and bumps the
+// fees that were not supplied by the configured percentage
+func (p *txnProcessor) setSpeedUpFees(ctx context.Context, inflight *inflightTxn, tx *eth.Txn, req *speedUpRequest) error {
+	if !tx.IsDynamicFee() {
+		gasPrice := req.gasPrice
+		if gasPrice == nil {
+			var err error
+			if gasPrice, err = p.bumpedGasPrice(ctx, inflight, tx); err != nil {
+				return err
+			}
+		}
+		tx.SetGasPrice(gasPrice)
+		return nil
+	}
+	maxFee, priorityFee := req.maxFee, req.priorityFee
+	if maxFee == nil || priorityFee == nil {
+		bumpedMaxFee, bumpedPriorityFee, err := p.bumpedDynamicFees(ctx, inflight, tx)
+		if err != nil {
+			return err
+		}
+		if maxFee == nil {
+			maxFee = bumpedMaxFee
+		}
+		if priorityFee == nil {
+			priorityFee = bumpedPriorityFee
+		}
+	}
+	tx.MaxFeePerGas = maxFee
+	tx.MaxPriorityFeePerGas = priorityFee
+	return nil
+}
+
+// getInflightReceipt checks for the receipt of an in-flight transaction, and of each transaction
+// it replaced. Only one of them can be mined, as they share a nonce
+func (p *txnProcessor) getInflightReceipt(ctx context.Context, inflight *inflightTxn) (bool, error) {
+	isMined, err := inflight.tx.GetTXReceipt(ctx, p.rpc)
+	for i := 0; !isMined && err == nil && i < len(inflight.replaced); i++ {
+		replaced := inflight.replaced[i]
+		if isMined, err = replaced.GetTXReceipt(ctx, p.rpc); isMined {
+			log.Infof("In-flight %d mined with replaced transaction %s", inflight.id, replaced.Hash)
+			p.inflightTxnsLock.Lock()
+			inflight.replaced[i], inflight.tx = inflight.tx, replaced
+			p.inflightTxnsLock.Unlock()
+		}
+	}
+	return isMined, err
+}
+
+// completeInflight stops an in-flight transaction being sped up or cancelled, once tracking has
+// finished, and replies to a request that was queued in the meantime
+func (p *txnProcessor) completeInflight(inflight *inflightTxn) {
+	p.inflightTxnsLock.Lock()
+	inflight.complete = true
+	p.inflightTxnsLock.Unlock()
+	select {
+	case req := <-inflight.speedUps:
+		req.txnContext.SendErrorReply(409, errors.Errorf(errors.TransactionSpeedUpCompleted, req.txHash))
+	default:
+	}
+}
+
+// forgetInflightTxns removes the records of an in-flight transaction, and of any it replaced
+func (p *txnProcessor) forgetInflightTxns(inflight *inflightTxn) {
+	p.forgetInflight(inflight.tx.Hash)
+	for _, replaced := range inflight.replaced {
+		p.forgetInflight(replaced.Hash)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSpeedUpHash = "0x000000000000000000000000000000000000000000000000000000000000aaaa"
+
+// speedUpRPC returns a new hash for each send, and a receipt for each hash that is mined
+type speedUpRPC struct {
+	lock    sync.Mutex
+	sent    []*eth.SendTXArgs
+	sendErr error
+	mined   map[string]bool
+}
+
+func (r *speedUpRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch method {
+	case "eth_sendTransaction":
+		r.sent = append(r.sent, args[0].(*eth.SendTXArgs))
+		*(result.(*string)) = fmt.Sprintf("0x%064x", len(r.sent))
+		return r.sendErr
+	case "eth_getTransactionReceipt":
+		if r.mined[args[0].(string)] {
+			blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+			status := ethbinding.HexBigInt(*big.NewInt(1))
+			result.(*eth.TxnReceipt).BlockNumber = &blockNumber
+			result.(*eth.TxnReceipt).Status = &status
+		}
+		return nil
+	}
+	panic(fmt.Errorf("method unknown to test: %s", method))
+}
+
+func speedUpMsgJSON(fees string) string {
+	return `{"headers":{"type":"SpeedUpTransaction"},"transactionHash":"` + testSpeedUpHash + `"` + fees + `}`
+}
+
+func newSpeedUpTestInflight(rpc eth.RPCClient, tx *eth.Txn) *inflightTxn {
+	tx.Hash = testSpeedUpHash
+	return &inflightTxn{
+		from:       strings.ToLower(testFromAddr),
+		nonce:      5,
+		rpc:        rpc,
+		tx:         tx,
+		txnContext: &testTxnContext{jsonMsg: goodSendTxnJSON},
+		speedUps:   make(chan *speedUpRequest, 1),
+	}
+}
+
+func newSpeedUpTestProcessor(inflight *inflightTxn) *txnProcessor {
+	p := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	p.inflightTxns[inflight.from] = &inflightTxnState{
+		txnsInFlight: []*inflightTxn{inflight},
+		highestNonce: inflight.nonce,
+	}
+	return p
+}
+
+func TestNewSpeedUpRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	req, err := newSpeedUpRequest(nil, &messages.SpeedUpTransaction{TransactionHash: testSpeedUpHash, GasPrice: "2000", MaxPriorityFeePerGas: "100"})
+	assert.NoError(err)
+	assert.Equal(int64(2000), req.gasPrice.Int64())
+	assert.Nil(req.maxFee)
+	assert.Equal(int64(100), req.priorityFee.Int64())
+
+	_, err = newSpeedUpRequest(nil, &messages.SpeedUpTransaction{})
+	assert.Regexp("Must supply the transactionHash", err)
+
+	_, err = newSpeedUpRequest(nil, &messages.SpeedUpTransaction{TransactionHash: testSpeedUpHash, GasPrice: "bad"})
+	assert.Regexp("Invalid gasPrice 'bad'", err)
+
+	_, err = newSpeedUpRequest(nil, &messages.SpeedUpTransaction{TransactionHash: testSpeedUpHash, MaxFeePerGas: "-1"})
+	assert.Regexp("Invalid maxFeePerGas '-1'", err)
+
+	_, err = newSpeedUpRequest(nil, &messages.SpeedUpTransaction{TransactionHash: testSpeedUpHash, MaxPriorityFeePerGas: "1.5"})
+	assert.Regexp("Invalid maxPriorityFeePerGas '1.5'", err)
+}
+
+func TestOnSpeedUpTransactionMessageQueueErrors(t *testing.T) {
+	assert := assert.New(t)
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	speedUp := func(msg string) *testTxnContext {
+		txnContext := &testTxnContext{jsonMsg: msg}
+		p.OnMessage(txnContext)
+		return txnContext
+	}
+
+	txnContext := speedUp(speedUpMsgJSON(`,"gasPrice":"bad"`))
+	assert.Equal(400, txnContext.errorReplies[0].status)
+
+	txnContext = speedUp(`{"headers":{"type":"SpeedUpTransaction"},"transactionHash":"0x1234"}`)
+	assert.Equal(404, txnContext.errorReplies[0].status)
+	assert.Regexp("Transaction 0x1234 is not in-flight", txnContext.errorReplies[0].err)
+
+	txnContext = speedUp(speedUpMsgJSON(""))
+	assert.Empty(txnContext.errorReplies)
+	assert.Equal(1, len(inflight.speedUps))
+
+	txnContext = speedUp(speedUpMsgJSON(""))
+	assert.Equal(409, txnContext.errorReplies[0].status)
+	assert.Regexp("already in progress", txnContext.errorReplies[0].err)
+
+	inflight.nodeAssignNonce = true
+	txnContext = speedUp(speedUpMsgJSON(""))
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Regexp("its nonce is not managed by the gateway", txnContext.errorReplies[0].err)
+
+	// A queued speed-up gets a reply once the transaction completes
+	queued := <-inflight.speedUps
+	inflight.speedUps <- queued
+	p.completeInflight(inflight)
+	assert.Equal(409, queued.txnContext.(*testTxnContext).errorReplies[0].status)
+	assert.Regexp("completed before it could be replaced", queued.txnContext.(*testTxnContext).errorReplies[0].err)
+
+	txnContext = speedUp(speedUpMsgJSON(""))
+	assert.Equal(404, txnContext.errorReplies[0].status)
+}
+
+func TestSpeedUpInflightGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	txnContext := &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext, txHash: testSpeedUpHash})
+	assert.Empty(txnContext.errorReplies)
+	reply := txnContext.replies[0].(*messages.TransactionSpeedUp)
+	assert.Equal(messages.MsgTypeTransactionSpeedUp, reply.Headers.MsgType)
+	assert.Equal(testSpeedUpHash, reply.ReplacedTransactionHash)
+	assert.Equal(inflight.tx.Hash, reply.TransactionHash)
+	assert.Equal("5", reply.NonceStr)
+	assert.Equal("1100", reply.GasPriceStr)
+	assert.Equal(int64(1100), rpc.sent[0].GasPrice.ToInt().Int64())
+	assert.Equal(uint64(5), uint64(*rpc.sent[0].Nonce))
+	assert.Equal(testSpeedUpHash, inflight.replaced[0].Hash)
+
+	txnContext = &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext, gasPrice: big.NewInt(5000)})
+	assert.Equal("5000", txnContext.replies[0].(*messages.TransactionSpeedUp).GasPriceStr)
+	assert.Equal(2, len(inflight.replaced))
+}
+
+func TestSpeedUpInflightDynamicFees(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{}
+	tx := newFeeBumpTestTxn(0)
+	tx.MaxFeePerGas = big.NewInt(2000)
+	tx.MaxPriorityFeePerGas = big.NewInt(100)
+	inflight := newSpeedUpTestInflight(rpc, tx)
+	p := newSpeedUpTestProcessor(inflight)
+
+	txnContext := &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext})
+	reply := txnContext.replies[0].(*messages.TransactionSpeedUp)
+	assert.Equal("2200", reply.MaxFeePerGasStr)
+	assert.Equal("110", reply.MaxPriorityFeePerGasStr)
+	assert.Empty(reply.GasPriceStr)
+
+	txnContext = &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext, priorityFee: big.NewInt(500)})
+	reply = txnContext.replies[0].(*messages.TransactionSpeedUp)
+	assert.Equal("2420", reply.MaxFeePerGasStr)
+	assert.Equal("500", reply.MaxPriorityFeePerGasStr)
+
+	txnContext = &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext, maxFee: big.NewInt(3000), priorityFee: big.NewInt(600)})
+	reply = txnContext.replies[0].(*messages.TransactionSpeedUp)
+	assert.Equal("3000", reply.MaxFeePerGasStr)
+	assert.Equal("600", reply.MaxPriorityFeePerGasStr)
+}
+
+func TestSpeedUpInflightFail(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{sendErr: fmt.Errorf("replacement transaction underpriced")}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+
+	txnContext := &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext})
+	assert.Empty(txnContext.replies)
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Equal(testSpeedUpHash, txnContext.errorReplies[0].txHash)
+	assert.Regexp("replacement transaction underpriced", txnContext.errorReplies[0].err)
+	assert.Equal(testSpeedUpHash, inflight.tx.Hash)
+
+	p.conf.FeeBump.MaxGasPrice = "1000"
+	txnContext = &testTxnContext{}
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: txnContext})
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Regexp("FFEC100318", txnContext.errorReplies[0].err)
+	assert.Equal(1, len(rpc.sent))
+}
+
+func TestGetInflightReceiptReplaced(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{mined: map[string]bool{testSpeedUpHash: true}}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	p := newSpeedUpTestProcessor(inflight)
+	p.rpc = rpc
+
+	p.speedUpInflight(inflight, &speedUpRequest{txnContext: &testTxnContext{}})
+	replacementHash := inflight.tx.Hash
+	assert.NotEqual(testSpeedUpHash, replacementHash)
+
+	// The original transaction was mined before the replacement
+	isMined, err := p.getInflightReceipt(context.Background(), inflight)
+	assert.NoError(err)
+	assert.True(isMined)
+	assert.Equal(testSpeedUpHash, inflight.tx.Hash)
+	assert.Equal(replacementHash, inflight.replaced[0].Hash)
+}
+
+func TestSpeedUpTrackedTransaction(t *testing.T) {
+	assert := assert.New(t)
+	rpc := &speedUpRPC{mined: map[string]bool{fmt.Sprintf("0x%064x", 1): true}}
+	inflight := newSpeedUpTestInflight(rpc, newFeeBumpTestTxn(1000))
+	inflight.initialWaitDelay = 10 * time.Millisecond
+	p := newSpeedUpTestProcessor(inflight)
+	p.conf.MaxTXWaitTime = 5
+	p.Init(rpc)
+
+	p.trackMining(inflight, inflight.tx)
+	speedUpContext := &testTxnContext{jsonMsg: speedUpMsgJSON(`,"gasPrice":"3000"`)}
+	p.OnMessage(speedUpContext)
+	inflight.wg.Wait()
+
+	assert.Empty(speedUpContext.errorReplies)
+	assert.Equal("3000", speedUpContext.replies[0].(*messages.TransactionSpeedUp).GasPriceStr)
+	txnContext := inflight.txnContext.(*testTxnContext)
+	assert.Empty(txnContext.errorReplies)
+	assert.Equal(messages.MsgTypeTransactionSuccess, txnContext.replies[0].ReplyHeaders().MsgType)
+	assert.Equal(fmt.Sprintf("0x%064x", 1), inflight.tx.Hash)
+	assert.Empty(p.inflightTxns)
+}
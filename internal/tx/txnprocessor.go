@@ -15,6 +15,7 @@
 package tx
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-ethconnect/internal/messages"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
@@ -42,6 +44,14 @@ type TxnProcessor interface {
 	OnMessage(TxnContext)
 	Init(eth.RPCClient)
 	ResolveAddress(from string) (resolvedFrom string, err error)
+	PendingTransactions(ctx context.Context, addr string) (*PendingTransactions, error)
+	InflightTransactions(addr string) ([]*InflightAddress, error)
+	ResetNonce(addr string, nextNonce *int64) (*NonceReset, error)
+	AddLifecycleSink(sink LifecycleSink)
+	SetContractABIResolver(resolver ContractABIResolver)
+	RecoverInflight(store kvstore.KVStore, newContext RecoveryContextFactory) (*RecoveryResult, error)
+	UpdateHDWallet(conf *HDWalletConf, probe string) (*IntegrationUpdate, error)
+	UpdateAddressBook(ctx context.Context, conf *AddressBookConf, probe string) (*IntegrationUpdate, error)
 }
 
 var highestID = 1000000
@@ -56,11 +66,23 @@ type inflightTxn struct {
 	txnContext       TxnContext
 	tx               *eth.Txn
 	wg               sync.WaitGroup
-	registerAs       string // passed from request to reply
+	registerAs       string                   // passed from request to reply
+	deployABI        ethbinding.ABIMarshaling // the ABI of a contract being deployed, to decode the events of its constructor
 	rpc              eth.RPCClient
 	signer           eth.TXSigner
 	gapFillSucceeded bool
 	gapFillTxHash    string
+	speedUps         chan *speedUpRequest // created once the transaction is sent
+	replaced         []*eth.Txn           // replaced by speed-ups, and still checked for a receipt
+	cancellation     *cancellation        // set once a cancellation has been sent in place of the transaction
+	complete         bool
+	added            time.Time // when tracking started, for the in-flight API
+	receiptChecks    int       // the times the receipt has been checked, without being found
+	released         bool      // released from nonce tracking, by a reset of the nonce of the address
+	allocatedNonce   bool      // the nonce was allocated by the shared nonce allocator
+	lastSent         time.Time // when the transaction was sent, or last replaced or resubmitted
+	resubmissions    []*messages.Resubmission
+	requestEcho      *messages.RequestEcho // echoed into the receipt, when requested
 }
 
 func (i *inflightTxn) nonceNumber() json.Number {
@@ -77,19 +99,36 @@ func (i *inflightTxn) String() string {
 
 // TxnProcessorConf configuration for the message processor
 type TxnProcessorConf struct {
-	AlwaysManageNonce  bool            `json:"alwaysManageNonce"`
-	AttemptGapFill     bool            `json:"attemptGapFill"`
-	MaxTXWaitTime      int             `json:"maxTXWaitTime"`
-	SendConcurrency    int             `json:"sendConcurrency"`
-	OrionPrivateAPIS   bool            `json:"orionPrivateAPIs"`
-	HexValuesInReceipt bool            `json:"hexValuesInReceipt"`
-	AddressBookConf    AddressBookConf `json:"addressBook"`
-	HDWalletConf       HDWalletConf    `json:"hdWallet"`
+	AlwaysManageNonce  bool                `json:"alwaysManageNonce"`
+	AttemptGapFill     bool                `json:"attemptGapFill"`
+	MaxTXWaitTime      int                 `json:"maxTXWaitTime"`
+	SendConcurrency    int                 `json:"sendConcurrency"`
+	OrionPrivateAPIS   bool                `json:"orionPrivateAPIs"`
+	HexValuesInReceipt bool                `json:"hexValuesInReceipt"`
+	AddressBookConf    AddressBookConf     `json:"addressBook"`
+	HDWalletConf       HDWalletConf        `json:"hdWallet"`
+	BlockReceipts      BlockReceiptsConf   `json:"blockReceipts"`
+	Lifecycle          LifecycleConf       `json:"lifecycle,omitempty"`
+	FeeBump            FeeBumpConf         `json:"feeBump,omitempty"`
+	MessageTypes       []string            `json:"messageTypes,omitempty"`
+	GasEstimate        eth.GasEstimateConf `json:"gasEstimate,omitempty"`
+	NonceAllocator     NonceAllocatorConf  `json:"nonceAllocator,omitempty"`
+	Resubmit           ResubmitConf        `json:"resubmit,omitempty"`
+	EchoRequest        bool                `json:"echoRequest,omitempty"`
+	ZeroGasPrice       ZeroGasPriceConf    `json:"zeroGasPrice,omitempty"`
+	RemoteSigner       RemoteSignerConf    `json:"remoteSigner,omitempty"`
+}
+
+// BlockReceiptsConf configuration for polling receipts a block at a time
+type BlockReceiptsConf struct {
+	Enabled           bool `json:"enabled"`
+	PollingIntervalMS int  `json:"pollingIntervalMS,omitempty"`
 }
 
 type inflightTxnState struct {
 	txnsInFlight []*inflightTxn
 	highestNonce int64
+	gapFill      *GapFillStatus // the last gap-fill submitted for the address
 }
 
 type txnProcessor struct {
@@ -100,29 +139,52 @@ type txnProcessor struct {
 	rpc                eth.RPCClient
 	addressBook        AddressBook
 	hdwallet           HDWallet
+	remoteSigner       *remoteSigner
 	conf               *TxnProcessorConf
 	rpcConf            *eth.RPCConf
-	concurrencySlots   chan bool
+	sendQueues         *sendScheduler
+	receiptPoller      *blockReceiptPoller
+	lifecycle          *lifecycleEmitter
+	inflightStore      kvstore.KVStore // set when in-flight transactions are persisted for recovery
+	dynamicFeesLock    sync.Mutex
+	dynamicFees        *bool               // cached once the chain has been checked for EIP-1559 support
+	abiResolver        ContractABIResolver // set when the stored ABIs of contracts are known, to decode the events in receipts
+	nonceAllocator     NonceAllocator      // set when nonces are allocated from state shared with other replicas
+	recoveredNonces    map[string]int64    // highest nonces submitted before a restart, for addresses with nothing in-flight
+	nonceRecordsLock   sync.Mutex
+	integrationsLock   sync.RWMutex          // protects the HD wallet and address book, which can be replaced at runtime
+	rpcBreaker         eth.RPCCircuitBreaker // set when the RPC connection has a circuit breaker
+	solc               *eth.SolcConf         // shared by everything in the process that compiles Solidity
 }
 
 // NewTxnProcessor constructor for message procss
-func NewTxnProcessor(conf *TxnProcessorConf, rpcConf *eth.RPCConf) TxnProcessor {
+func NewTxnProcessor(conf *TxnProcessorConf, rpcConf *eth.RPCConf, solc *eth.SolcConf) TxnProcessor {
 	if conf.SendConcurrency == 0 {
 		conf.SendConcurrency = defaultSendConcurrency
 	}
 	p := &txnProcessor{
 		inflightTxnsLock:   &sync.Mutex{},
 		inflightTxns:       make(map[string]*inflightTxnState),
+		recoveredNonces:    make(map[string]int64),
 		inflightTxnDelayer: NewTxnDelayTracker(),
 		conf:               conf,
 		rpcConf:            rpcConf,
-		concurrencySlots:   make(chan bool, conf.SendConcurrency),
+		solc:               solc,
+	}
+	if conf.Lifecycle.WebhookURL != "" {
+		p.AddLifecycleSink(newLifecycleWebhook(conf.Lifecycle.WebhookURL))
+	}
+	if conf.SendConcurrency > 1 {
+		p.sendQueues = newSendScheduler(conf.SendConcurrency, func(item *sendQueueItem) {
+			p.sendAndTrackMining(item.txnContext, item.inflight, item.tx)
+		})
 	}
 	return p
 }
 
 func (p *txnProcessor) Init(rpc eth.RPCClient) {
 	p.rpc = rpc
+	p.rpcBreaker = eth.CircuitBreakerFor(rpc)
 	p.maxTXWaitTime = time.Duration(p.conf.MaxTXWaitTime) * time.Second
 	if p.conf.AddressBookConf.AddressbookURLPrefix != "" {
 		p.addressBook = NewAddressBook(&p.conf.AddressBookConf, p.rpcConf)
@@ -130,14 +192,50 @@ func (p *txnProcessor) Init(rpc eth.RPCClient) {
 	if p.conf.HDWalletConf.URLTemplate != "" {
 		p.hdwallet = newHDWallet(&p.conf.HDWalletConf)
 	}
+	if p.conf.RemoteSigner.URL != "" {
+		p.remoteSigner = newRemoteSigner(&p.conf.RemoteSigner)
+	}
+	if p.conf.BlockReceipts.Enabled {
+		if p.conf.BlockReceipts.PollingIntervalMS <= 0 {
+			p.conf.BlockReceipts.PollingIntervalMS = defaultBlockReceiptsPollingIntervalMS
+		}
+		p.receiptPoller = newBlockReceiptPoller(rpc, time.Duration(p.conf.BlockReceipts.PollingIntervalMS)*time.Millisecond)
+	}
+	nonceAllocator, err := newNonceAllocator(&p.conf.NonceAllocator)
+	if err != nil {
+		log.Errorf("Failed to create nonce allocator: %s", err)
+		nonceAllocator = &failedNonceAllocator{err: err}
+	}
+	if nonceAllocator != nil {
+		p.nonceAllocator = nonceAllocator
+	}
 }
 
 // CobraInitTxnProcessor sets the standard command-line parameters for the txnprocessor
 func CobraInitTxnProcessor(cmd *cobra.Command, txconf *TxnProcessorConf) {
 	cmd.Flags().IntVarP(&txconf.MaxTXWaitTime, "tx-timeout", "x", utils.DefInt("ETH_TX_TIMEOUT", 0), "Maximum wait time for an individual transaction (seconds)")
 	cmd.Flags().BoolVarP(&txconf.HexValuesInReceipt, "hex-values", "H", false, "Include hex values for large numbers in receipts (as well as numeric strings)")
+	cmd.Flags().BoolVarP(&txconf.EchoRequest, "reply-echo-request", "", false, "Echo the method, parameters and target of each request into its receipt")
 	cmd.Flags().BoolVarP(&txconf.AlwaysManageNonce, "predict-nonces", "P", false, "Predict the next nonce before sending (default=false for node-signed txns)")
 	cmd.Flags().BoolVarP(&txconf.OrionPrivateAPIS, "orion-privapi", "G", false, "Use Orion JSON/RPC API semantics for private transactions")
+	cmd.Flags().BoolVarP(&txconf.BlockReceipts.Enabled, "block-receipts", "", false, "Poll for receipts a block at a time with eth_getBlockReceipts/parity_getBlockReceipts, where supported by the node")
+	cmd.Flags().StringVarP(&txconf.Lifecycle.WebhookURL, "lifecycle-webhook", "", "", "URL to POST transaction lifecycle events to, for monitoring")
+	cmd.Flags().StringVarP(&txconf.Lifecycle.KafkaTopic, "lifecycle-topic", "", "", "Kafka topic to send transaction lifecycle events to, for monitoring")
+	cmd.Flags().IntVarP(&txconf.FeeBump.MaxAttempts, "fee-bump-attempts", "", 0, "Number of times to resend a transaction with a higher gas price when the node rejects it as underpriced (0=disabled)")
+	cmd.Flags().IntVarP(&txconf.FeeBump.Percent, "fee-bump-percent", "", defaultFeeBumpPercent, "Percentage to increase the gas price by each time a transaction is resent")
+	cmd.Flags().StringVarP(&txconf.FeeBump.MaxGasPrice, "fee-bump-max-gas-price", "", "", "Maximum gas price in wei to resend a transaction with")
+	cmd.Flags().StringVarP(&txconf.RemoteSigner.URL, "remote-signer-url", "", "", "JSON/RPC URL of an EthSigner or Web3Signer to sign transactions with, for the --remote-signer-addresses")
+	cmd.Flags().StringSliceVarP(&txconf.RemoteSigner.Addresses, "remote-signer-addresses", "", nil, "From addresses to sign transactions for with the remote signer")
+	cmd.Flags().BoolVarP(&txconf.ZeroGasPrice.Enabled, "zero-gas-price", "", false, "Send all transactions with a gas price of zero, for permissioned chains that require it")
+	cmd.Flags().StringVarP(&txconf.ZeroGasPrice.Policy, "zero-gas-price-policy", "", ZeroGasPriceOverride, "Whether to 'override' or 'reject' transactions submitted with a non-zero gas price, when --zero-gas-price is set")
+	cmd.Flags().IntVarP(&txconf.Resubmit.AfterSec, "resubmit-after-sec", "", 0, "Seconds without a receipt before a transaction is resent with a higher gas price (0=disabled)")
+	cmd.Flags().IntVarP(&txconf.Resubmit.MaxAttempts, "resubmit-attempts", "", defaultResubmitAttempts, "Maximum number of times to resend a transaction that has no receipt")
+	cmd.Flags().Float64VarP(&txconf.GasEstimate.Factor, "gas-estimate-factor", "", eth.DefaultGasEstimateFactor, "Multiplier applied to the gas estimate when a transaction is sent without gas")
+	cmd.Flags().Uint64VarP(&txconf.GasEstimate.MaxGas, "gas-estimate-max", "", 0, "Maximum gas for a transaction sent without gas, failing if the estimate is higher (0=no maximum)")
+	cmd.Flags().StringSliceVarP(&txconf.MessageTypes, "message-types", "", []string{}, "Message types to process, such as DeployContract or SendTransaction (default all)")
+	cmd.Flags().StringVarP(&txconf.NonceAllocator.Type, "nonce-allocator", "", NonceAllocatorMemory, "Where to allocate the nonces of transactions from: memory, or redis to share them with other replicas")
+	cmd.Flags().StringVarP(&txconf.NonceAllocator.RedisURL, "nonce-redis-url", "", "", "URL of the Redis server to allocate nonces from, such as redis://:password@localhost:6379/0")
+	cmd.Flags().IntVarP(&txconf.NonceAllocator.LeaseSec, "nonce-lease-sec", "", defaultNonceLeaseSec, "How long the nonce sequence of an address is kept after its last allocation, before it starts again from the node")
 	return
 }
 
@@ -150,6 +248,21 @@ func (p *txnProcessor) OnMessage(txnContext TxnContext) {
 	var unmarshalErr error
 	headers := txnContext.Headers()
 	log.Debugf("Processing %+v", headers)
+	p.emitLifecycle(txnContext, nil, &LifecycleEvent{Type: LifecycleAccepted})
+	if !p.msgTypeAllowed(headers.MsgType) {
+		err := errors.Errorf(errors.TransactionSendMsgTypeNotAllowed, headers.MsgType)
+		p.emitLifecycleFailed(txnContext, nil, err)
+		txnContext.SendErrorReply(403, err)
+		return
+	}
+	if p.rpcBreaker != nil {
+		// No nonces are assigned while the node is failing, so gaps are not created
+		if err := p.rpcBreaker.Check(); err != nil {
+			p.emitLifecycleFailed(txnContext, nil, err)
+			txnContext.SendErrorReply(503, err)
+			return
+		}
+	}
 	switch headers.MsgType {
 	case messages.MsgTypeDeployContract:
 		var deployContractMsg messages.DeployContract
@@ -165,11 +278,26 @@ func (p *txnProcessor) OnMessage(txnContext TxnContext) {
 		}
 		p.OnSendTransactionMessage(txnContext, &sendTransactionMsg)
 		break
+	case messages.MsgTypeSpeedUpTransaction:
+		var speedUpMsg messages.SpeedUpTransaction
+		if unmarshalErr = txnContext.Unmarshal(&speedUpMsg); unmarshalErr != nil {
+			break
+		}
+		p.OnSpeedUpTransactionMessage(txnContext, &speedUpMsg)
+		break
+	case messages.MsgTypeCancelTransaction:
+		var cancelMsg messages.CancelTransaction
+		if unmarshalErr = txnContext.Unmarshal(&cancelMsg); unmarshalErr != nil {
+			break
+		}
+		p.OnCancelTransactionMessage(txnContext, &cancelMsg)
+		break
 	default:
 		unmarshalErr = errors.Errorf(errors.TransactionSendMsgTypeUnknown, headers.MsgType)
 	}
 	// We must always send a reply
 	if unmarshalErr != nil {
+		p.emitLifecycleFailed(txnContext, nil, unmarshalErr)
 		txnContext.SendErrorReply(400, unmarshalErr)
 	}
 
@@ -187,13 +315,16 @@ func (p *txnProcessor) ResolveAddress(from string) (resolvedFrom string, err err
 
 func (p *txnProcessor) resolveSigner(from string) (signer eth.TXSigner, err error) {
 	if hdWalletRequest := IsHDWalletRequest(from); hdWalletRequest != nil {
-		if p.hdwallet == nil {
+		hdwallet := p.getHDWallet()
+		if hdwallet == nil {
 			err = errors.Errorf(errors.HDWalletSigningNoConfig)
 			return
 		}
-		if signer, err = p.hdwallet.SignerFor(hdWalletRequest); err != nil {
+		if signer, err = hdwallet.SignerFor(hdWalletRequest); err != nil {
 			return
 		}
+	} else if p.remoteSigner != nil {
+		signer, err = p.remoteSigner.signerFor(from)
 	}
 	return
 }
@@ -207,6 +338,7 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 
 	inflight = &inflightTxn{
 		txnContext: txnContext,
+		added:      time.Now(),
 	}
 
 	// Use the correct RPC for sending transactions
@@ -215,8 +347,8 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 		msg.From = inflight.signer.Address()
 	} else if err != nil {
 		return nil, err
-	} else if p.addressBook != nil {
-		if inflight.rpc, err = p.addressBook.lookup(txnContext.Context(), msg.From); err != nil {
+	} else if addressBook := p.getAddressBook(); addressBook != nil {
+		if inflight.rpc, err = addressBook.lookup(txnContext.Context(), msg.From); err != nil {
 			return
 		}
 	}
@@ -290,6 +422,18 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 			return
 		}
 		fromNode = true
+	} else if p.nonceAllocator != nil && !nodeAssignNonce {
+		// Allocate the nonce from the state shared with the other replicas signing with the address
+		if inflight.nonce, err = p.nonceAllocator.Allocate(txnContext.Context(), inflight.from, func() (int64, error) {
+			return eth.GetTransactionCount(txnContext.Context(), p.rpc, &from, "pending")
+		}); err != nil {
+			p.inflightTxnsLock.Unlock()
+			return
+		}
+		inflight.allocatedNonce = true
+		if inflight.nonce > inflightForAddr.highestNonce {
+			inflightForAddr.highestNonce = inflight.nonce
+		}
 	} else if highestNonce >= 0 {
 		// If we found a nonce in-flight in memory, store & return one higher.
 		inflight.nonce = highestNonce + 1
@@ -308,6 +452,7 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 			p.inflightTxnsLock.Unlock()
 			return
 		}
+		inflight.nonce = p.recoveredNonce(inflight.from, inflight.nonce)
 		inflightForAddr.highestNonce = inflight.nonce // store the nonce in our inflight txns state
 		fromNode = true
 	}
@@ -328,7 +473,9 @@ func (p *txnProcessor) cancelInFlight(inflight *inflightTxn, submitted bool) {
 	var before, after int
 	var highestNonce int64 = -1
 	p.inflightTxnsLock.Lock()
-	if inflightForAddr, exists := p.inflightTxns[inflight.from]; exists {
+	// A nonce reset sets released under the lock, so it is read once here while the lock is held
+	released := inflight.released
+	if inflightForAddr, exists := p.inflightTxns[inflight.from]; exists && !released {
 		// Remove from the in-flight list
 		before = len(inflightForAddr.txnsInFlight)
 		for idx, alreadyInflight := range inflightForAddr.txnsInFlight {
@@ -362,6 +509,13 @@ func (p *txnProcessor) cancelInFlight(inflight *inflightTxn, submitted bool) {
 
 	log.Infof("In-flight %d complete. nonce=%d addr=%s nan=%t sub=%t before=%d after=%d highest=%d", inflight.id, inflight.nonce, inflight.from, inflight.nodeAssignNonce, submitted, before, after, highestNonce)
 
+	// Return a nonce that was not used to the shared allocator, so it is not left as a gap
+	if !submitted && inflight.allocatedNonce && !released {
+		if err := p.nonceAllocator.Release(inflight.txnContext.Context(), inflight.from, inflight.nonce); err != nil {
+			log.Warnf("Failed to release nonce %d of %s: %s", inflight.nonce, inflight.from, err)
+		}
+	}
+
 	// If we've got a gap potential, we need to submit a gap-fill TX
 	if !submitted && highestNonce > inflight.nonce && !inflight.nodeAssignNonce {
 		log.Warnf("Potential nonce gap. Nonce %d failed to send. Nonce %d in-flight", inflight.nonce, highestNonce)
@@ -385,6 +539,7 @@ func (p *txnProcessor) submitGapFillTX(inflight *inflightTxn) {
 				inflight.gapFillSucceeded = true
 				log.Infof("Submission of gap-fill TX '%s' completed", tx.Hash)
 			}
+			p.recordGapFill(inflight)
 		}
 	}
 }
@@ -398,15 +553,28 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 	// both latency beyond the block period, and avoiding spamming the node
 	// with REST calls for long block periods, or when there is a backlog
 	replyWaitStart := time.Now().UTC()
-	time.Sleep(initialWaitDelay)
+
+	// A synchronous request stops waiting once it is cancelled, or reaches its deadline
+	ctx := inflight.txnContext.Context()
 
 	var isMined, timedOut bool
 	var err error
 	var retries int
 	var elapsed time.Duration
-	for !isMined && !timedOut {
+	if p.receiptPoller != nil && inflight.privacyGroupID == "" {
+		// Receipts are matched as each block is mined. We only fall back to
+		// polling for the individual receipt if the node turns out not to support it
+		isMined, timedOut = p.waitForBlockReceipt(inflight, replyWaitStart)
+		elapsed = time.Now().UTC().Sub(replyWaitStart)
+	} else {
+		select {
+		case <-time.After(initialWaitDelay):
+		case <-ctx.Done():
+		}
+	}
+	for !isMined && !timedOut && ctx.Err() == nil {
 
-		if isMined, err = inflight.tx.GetTXReceipt(inflight.txnContext.Context(), p.rpc); err != nil {
+		if isMined, err = p.getInflightReceipt(ctx, inflight); err != nil {
 			// We wait even on connectivity errors, as we've submitted the transaction and
 			// we want to provide a receipt if connectivity resumes within the timeout
 			log.Infof("Failed to get receipt for %s (retries=%d): %s", inflight, retries, err)
@@ -419,20 +587,41 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 			// while we're waiting
 			p.inflightTxnsLock.Lock()
 			delayBeforeRetry := p.inflightTxnDelayer.GetRetryDelay(initialWaitDelay, retries+1)
+			inflight.receiptChecks = retries + 1
 			p.inflightTxnsLock.Unlock()
 
 			log.Debugf("Receipt not available after %.2fs (retries=%d): %s", elapsed.Seconds(), retries, inflight)
-			time.Sleep(delayBeforeRetry)
+			p.emitLifecycle(inflight.txnContext, inflight, &LifecycleEvent{Type: LifecycleReceiptPending, Retry: retries + 1})
+			if p.resubmitDue(inflight) {
+				p.resubmitInflight(inflight)
+			}
+			select {
+			case <-time.After(delayBeforeRetry):
+			case <-ctx.Done():
+			case req := <-inflight.speedUps:
+				p.speedUpInflight(inflight, req)
+			}
 			retries++
 		}
 	}
+	p.completeInflight(inflight)
 
 	if timedOut {
 		if err != nil {
-			inflight.txnContext.SendErrorReplyWithTX(500, errors.Errorf(errors.TransactionSendReceiptCheckError, retries, err), inflight.tx.Hash)
+			err = errors.Errorf(errors.TransactionSendReceiptCheckError, retries, err)
+			p.emitLifecycleFailed(inflight.txnContext, inflight, err)
+			inflight.txnContext.SendErrorReplyWithTX(500, err, inflight.tx.Hash)
 		} else {
-			inflight.txnContext.SendErrorReplyWithTX(408, errors.Errorf(errors.TransactionSendReceiptCheckTimeout), inflight.tx.Hash)
+			err = errors.Errorf(errors.TransactionSendReceiptCheckTimeout)
+			p.emitLifecycleFailed(inflight.txnContext, inflight, err)
+			inflight.txnContext.SendErrorReplyWithTX(408, err, inflight.tx.Hash)
 		}
+	} else if !isMined {
+		// The transaction was submitted, and might still be mined, but nobody is waiting for the receipt
+		log.Infof("Stopped waiting for receipt for %s after %.2fs: %s", inflight, time.Now().UTC().Sub(replyWaitStart).Seconds(), ctx.Err())
+		inflight.txnContext.SendErrorReplyWithTX(408, errors.Errorf(errors.TransactionSendReceiptCheckAborted, ctx.Err()), inflight.tx.Hash)
+	} else if inflight.cancelled() {
+		p.replyCancelled(inflight)
 	} else {
 		// Update the stats
 		p.inflightTxnsLock.Lock()
@@ -465,7 +654,20 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 		if receipt.CumulativeGasUsed != nil {
 			reply.CumulativeGasUsedStr = receipt.CumulativeGasUsed.ToInt().Text(10)
 		}
+		if p.conf.HexValuesInReceipt {
+			reply.EffectiveGasPriceHex = receipt.EffectiveGasPrice
+		}
+		if receipt.EffectiveGasPrice != nil {
+			reply.EffectiveGasPriceStr = receipt.EffectiveGasPrice.ToInt().Text(10)
+		}
 		reply.From = receipt.From
+		if inflight.tx.EstimatedGas > 0 {
+			estimatedGas := ethbinding.HexUint64(inflight.tx.EstimatedGas)
+			if p.conf.HexValuesInReceipt {
+				reply.EstimatedGasHex = &estimatedGas
+			}
+			reply.EstimatedGasStr = strconv.FormatUint(inflight.tx.EstimatedGas, 10)
+		}
 		if p.conf.HexValuesInReceipt {
 			reply.GasUsedHex = receipt.GasUsed
 		}
@@ -491,21 +693,76 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 		if receipt.TransactionIndex != nil {
 			reply.TransactionIndexStr = strconv.FormatUint(uint64(*receipt.TransactionIndex), 10)
 		}
+		reply.Events = p.receiptEvents(inflight, &receipt)
+		reply.Resubmissions = inflight.resubmissions
+		reply.Request = inflight.requestEcho
+		if !isSuccess && inflight.privacyGroupID == "" && len(inflight.tx.PrivateFor) == 0 {
+			// Replay the transaction to find out why it failed, as the receipt does not say
+			reply.RevertReason = inflight.tx.RevertReason(ctx, inflight.rpc, receipt.BlockNumber.ToInt())
+		}
 
+		p.emitLifecycle(inflight.txnContext, inflight, &LifecycleEvent{
+			Type:        LifecycleMined,
+			BlockNumber: reply.BlockNumberStr,
+			Status:      reply.StatusStr,
+		})
 		inflight.txnContext.Reply(&reply)
 	}
+	p.replyCancellation(inflight, isMined)
 
 	// We've submitted the transaction, even if we didn't get a receipt within our timeout.
 	p.cancelInFlight(inflight, true)
+	p.forgetInflightTxns(inflight)
 	inflight.wg.Done()
 }
 
+// waitForBlockReceipt waits for the block receipt poller to find the receipt for the
+// transaction, or for the timeout. Returns with neither set if block receipts are unsupported.
+func (p *txnProcessor) waitForBlockReceipt(inflight *inflightTxn, replyWaitStart time.Time) (isMined, timedOut bool) {
+	receiptChan := p.receiptPoller.register(inflight.tx.Hash)
+	if receiptChan == nil {
+		return false, false
+	}
+	defer p.receiptPoller.unregister(inflight.tx.Hash)
+
+	// The transaction might have been mined in a block processed before we registered
+	if isMined, _ = inflight.tx.GetTXReceipt(inflight.txnContext.Context(), p.rpc); isMined {
+		return true, false
+	}
+
+	timer := time.NewTimer(p.maxTXWaitTime - time.Now().UTC().Sub(replyWaitStart))
+	defer timer.Stop()
+	select {
+	case receipt, ok := <-receiptChan:
+		if ok {
+			inflight.tx.Receipt = *receipt
+			return true, false
+		}
+		return false, false
+	case <-timer.C:
+		return false, true
+	case <-inflight.txnContext.Context().Done():
+		return false, false
+	case req := <-inflight.speedUps:
+		// The receipt of the replacement is polled for, along with the receipt of the transaction it replaced
+		p.speedUpInflight(inflight, req)
+		return false, false
+	case <-p.resubmitAfter(inflight):
+		p.resubmitInflight(inflight)
+		return false, false
+	}
+}
+
 // addInflight adds a transaction to the inflight list, and kick off
 // a goroutine to check for its completion and send the result
 func (p *txnProcessor) trackMining(inflight *inflightTxn, tx *eth.Txn) {
 
 	// Kick off the goroutine to track it to completion
+	p.inflightTxnsLock.Lock()
 	inflight.tx = tx
+	inflight.speedUps = make(chan *speedUpRequest, 1)
+	inflight.lastSent = time.Now()
+	p.inflightTxnsLock.Unlock()
 	inflight.wg.Add(1)
 	go p.waitForCompletion(inflight, inflight.initialWaitDelay)
 
@@ -513,17 +770,29 @@ func (p *txnProcessor) trackMining(inflight *inflightTxn, tx *eth.Txn) {
 
 func (p *txnProcessor) OnDeployContractMessage(txnContext TxnContext, msg *messages.DeployContract) {
 
+	if err := p.applyZeroGasPrice(&msg.TransactionCommon); err != nil {
+		p.emitLifecycleFailed(txnContext, nil, err)
+		txnContext.SendErrorReply(400, err)
+		return
+	}
 	inflight, err := p.addInflightWrapper(txnContext, &msg.TransactionCommon)
 	if err != nil {
+		p.emitLifecycleFailed(txnContext, nil, err)
 		txnContext.SendErrorReply(400, err)
 		return
 	}
+	p.emitLifecycle(txnContext, inflight, &LifecycleEvent{Type: LifecycleNonceAssigned})
 	inflight.registerAs = msg.RegisterAs
+	inflight.deployABI = msg.ABI
+	if p.echoRequest(&msg.TransactionCommon) {
+		inflight.requestEcho = deployRequestEcho(msg)
+	}
 	msg.Nonce = inflight.nonceNumber()
 
-	tx, err := eth.NewContractDeployTxn(msg, inflight.signer)
+	tx, err := eth.NewContractDeployTxn(p.solc, msg, inflight.signer)
 	if err != nil {
 		p.cancelInFlight(inflight, false /* not yet submitted */)
+		p.emitLifecycleFailed(txnContext, inflight, err)
 		txnContext.SendErrorReply(400, err)
 		return
 	}
@@ -533,16 +802,27 @@ func (p *txnProcessor) OnDeployContractMessage(txnContext TxnContext, msg *messa
 
 func (p *txnProcessor) OnSendTransactionMessage(txnContext TxnContext, msg *messages.SendTransaction) {
 
+	if err := p.applyZeroGasPrice(&msg.TransactionCommon); err != nil {
+		p.emitLifecycleFailed(txnContext, nil, err)
+		txnContext.SendErrorReply(400, err)
+		return
+	}
 	inflight, err := p.addInflightWrapper(txnContext, &msg.TransactionCommon)
 	if err != nil {
+		p.emitLifecycleFailed(txnContext, nil, err)
 		txnContext.SendErrorReply(400, err)
 		return
 	}
+	p.emitLifecycle(txnContext, inflight, &LifecycleEvent{Type: LifecycleNonceAssigned})
+	if p.echoRequest(&msg.TransactionCommon) {
+		inflight.requestEcho = sendRequestEcho(msg)
+	}
 	msg.Nonce = inflight.nonceNumber()
 
 	tx, err := eth.NewSendTxn(msg, inflight.signer)
 	if err != nil {
 		p.cancelInFlight(inflight, false /* not yet submitted */)
+		p.emitLifecycleFailed(txnContext, inflight, err)
 		txnContext.SendErrorReply(400, err)
 		return
 	}
@@ -554,12 +834,17 @@ func (p *txnProcessor) sendTransactionCommon(txnContext TxnContext, inflight *in
 	tx.OrionPrivateAPIS = p.conf.OrionPrivateAPIS
 	tx.PrivacyGroupID = inflight.privacyGroupID
 	tx.NodeAssignNonce = inflight.nodeAssignNonce
+	tx.GasEstimate = &p.conf.GasEstimate
 
-	if p.conf.SendConcurrency > 1 {
+	if p.sendQueues != nil {
 		// The above must happen synchronously for each partition in Kafka - as it is where we assign the nonce.
-		// However, the send to the node can happen at high concurrency.
-		p.concurrencySlots <- true
-		go p.sendAndTrackMining(txnContext, inflight, tx)
+		// However, the send to the node can happen at high concurrency across addresses.
+		// Sends for the same address are queued, and performed one at a time in nonce order.
+		p.sendQueues.enqueue(&sendQueueItem{
+			txnContext: txnContext,
+			inflight:   inflight,
+			tx:         tx,
+		})
 	} else {
 		// For the special case of 1 we do it synchronously, so we don't assign the next nonce until we've sent this one
 		p.sendAndTrackMining(txnContext, inflight, tx)
@@ -567,15 +852,21 @@ func (p *txnProcessor) sendTransactionCommon(txnContext TxnContext, inflight *in
 }
 
 func (p *txnProcessor) sendAndTrackMining(txnContext TxnContext, inflight *inflightTxn, tx *eth.Txn) {
-	err := tx.Send(txnContext.Context(), inflight.rpc)
-	if p.conf.SendConcurrency > 1 {
-		<-p.concurrencySlots // return our slot as soon as send is complete, to let an awaiting send go
+	// When concurrency is enabled, this is called on a slot for the from address.
+	// Any gap-fill is submitted before the slot is released, so before the next
+	// queued send for the same address.
+	err := p.resolveDynamicFees(txnContext.Context(), inflight, tx)
+	if err == nil {
+		err = p.sendWithFeeBump(txnContext.Context(), inflight, tx)
 	}
 	if err != nil {
 		p.cancelInFlight(inflight, false /* not confirmed as submitted, as send failed */)
+		p.emitLifecycleFailed(txnContext, inflight, err)
 		txnContext.SendErrorReplyWithGapFill(400, err, inflight.gapFillTxHash, inflight.gapFillSucceeded)
 		return
 	}
 
+	p.emitLifecycle(txnContext, inflight, &LifecycleEvent{Type: LifecycleSent, TransactionHash: tx.Hash})
+	p.persistInflight(inflight, tx)
 	p.trackMining(inflight, tx)
 }
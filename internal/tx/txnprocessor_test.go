@@ -48,6 +48,7 @@ type errorReply struct {
 }
 
 type testTxnContext struct {
+	ctx          context.Context
 	jsonMsg      string
 	badMsgType   string
 	replies      []messages.ReplyWithHeaders
@@ -70,6 +71,16 @@ type testRPC struct {
 	privFindPrivacyGroupErr        error
 	ethEstimateGasResult           ethbinding.HexUint64
 	ethEstimateGasErr              error
+	ethCallResult                  string
+	ethBlockNumberResult           ethbinding.HexUint64
+	ethGetBlockReceiptsResult      []*eth.TxnReceipt
+	ethGetBlockReceiptsErr         error
+	txpoolContentResult            string
+	txpoolContentErr               error
+	ethGetTransactionByHashResult  *eth.TxnInfo
+	ethGetTransactionByHashErr     error
+	ethGetBlockByNumberResult      map[string]interface{}
+	ethGetBlockByNumberErr         error
 	condLock                       sync.Mutex
 	calls                          []string
 	params                         [][]interface{}
@@ -154,14 +165,36 @@ func (r *testRPC) CallContext(ctx context.Context, result interface{}, method st
 		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(&r.ethEstimateGasResult))
 		return r.ethEstimateGasErr
 	} else if method == "eth_call" {
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethCallResult))
 		return nil
 	} else if method == "priv_getTransactionReceipt" {
 		return nil
+	} else if method == "eth_blockNumber" {
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethBlockNumberResult))
+		return nil
+	} else if method == "eth_getBlockReceipts" {
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethGetBlockReceiptsResult))
+		return r.ethGetBlockReceiptsErr
+	} else if method == "eth_getTransactionByHash" {
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethGetTransactionByHashResult))
+		return r.ethGetTransactionByHashErr
+	} else if method == "eth_getBlockByNumber" {
+		b, _ := json.Marshal(r.ethGetBlockByNumberResult)
+		json.Unmarshal(b, result)
+		return r.ethGetBlockByNumberErr
+	} else if method == "txpool_content" {
+		if r.txpoolContentErr != nil {
+			return r.txpoolContentErr
+		}
+		return json.Unmarshal([]byte(r.txpoolContentResult), result)
 	}
 	panic(fmt.Errorf("method unknown to test: %s", method))
 }
 
 func (c *testTxnContext) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
 	return context.Background()
 }
 
@@ -216,7 +249,7 @@ func (c *testTxnContext) Reply(replyMsg messages.ReplyWithHeaders) {
 func TestOnMessageBadMessage(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"badness\"}" +
@@ -232,7 +265,7 @@ func TestOnMessageBadMessage(t *testing.T) {
 func TestOnDeployContractMessageBadMsg(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"DeployContract\"}," +
@@ -249,7 +282,7 @@ func TestOnDeployContractMessageBadMsg(t *testing.T) {
 func TestOnDeployContractMessageBadJSON(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "badness"
 	testTxnContext.badMsgType = messages.MsgTypeDeployContract
@@ -265,7 +298,7 @@ func TestOnDeployContractMessageGoodTxnErrOnReceipt(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnJSON
 	testRPC := &testRPC{
@@ -325,7 +358,7 @@ func TestOnDeployContractMessageGoodTxnMined(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnJSON
 
@@ -388,7 +421,7 @@ func TestOnDeployContractMessageGoodTxnMinedHDWallet(t *testing.T) {
 		HDWalletConf: HDWalletConf{
 			URLTemplate: svr.URL,
 		},
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodHDWalletDeployTxnJSON
 
@@ -432,7 +465,7 @@ func TestOnDeployContractPrivateMessageGoodTxnMined(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnPrivateJSON
 
@@ -481,7 +514,7 @@ func TestOnDeployContractMessageGoodTxnMinedWithHex(t *testing.T) {
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime:      1,
 		HexValuesInReceipt: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnJSON
 
@@ -530,7 +563,7 @@ func TestOnDeployContractMessageFailedTxnMined(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnJSON
 
@@ -551,12 +584,45 @@ func TestOnDeployContractMessageFailedTxnMined(t *testing.T) {
 	assert.Equal("TransactionFailure", replyMsg.ReplyHeaders().MsgType)
 }
 
+func TestOnSendTransactionMessageFailedTxnRevertReason(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	failStatus := ethbinding.HexBigInt(*big.NewInt(0))
+	testRPC.ethGetTransactionReceiptResult.Status = &failStatus
+	testRPC.ethCallResult = "0x08c379a0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000000000000000000000000000000000000000000114d75707065747279206465746563746564000000000000000000000000000000"
+	txnProcessor.Init(testRPC)                          // configured in seconds for real world
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond // ... but fail asap for this test
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	replyMsg := testTxnContext.replies[0]
+	assert.Equal("TransactionFailure", replyMsg.ReplyHeaders().MsgType)
+	assert.Equal("Muppetry detected", replyMsg.(*messages.TransactionReceipt).RevertReason)
+
+	// Replayed against the state before the block it was mined in
+	callIdx := len(testRPC.calls) - 1
+	assert.Equal("eth_call", testRPC.calls[callIdx])
+	assert.Equal("0x3038", testRPC.params[callIdx][1])
+}
+
 func TestOnDeployContractMessageFailedTxn(t *testing.T) {
 	assert := assert.New(t)
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 5000,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnJSON
 	testRPC := &testRPC{
@@ -578,7 +644,7 @@ func TestOnDeployContractMessageFailedToGetNonce(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.conf.AlwaysManageNonce = true
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
@@ -602,7 +668,7 @@ func TestOnDeployContractMessageFailedToGetNonce(t *testing.T) {
 func TestOnSendTransactionMessageMissingFrom(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"SendTransaction\"}," +
@@ -622,7 +688,7 @@ func TestOnSendTransactionMessageMissingFrom(t *testing.T) {
 func TestOnSendTransactionMessageBadNonce(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"SendTransaction\"}," +
@@ -643,7 +709,7 @@ func TestOnSendTransactionMessageBadNonce(t *testing.T) {
 func TestOnSendTransactionMessageBadMsg(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"SendTransaction\"}," +
@@ -666,7 +732,7 @@ func TestOnSendTransactionMessageBadMsg(t *testing.T) {
 func TestOnSendTransactionMessageBadJSON(t *testing.T) {
 	assert := assert.New(t)
 
-	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "badness"
 	testTxnContext.badMsgType = messages.MsgTypeSendTransaction
@@ -681,13 +747,44 @@ func TestOnSendTransactionMessageBadJSON(t *testing.T) {
 
 }
 
+func TestOnSendTransactionMessageRequestDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	txHash := "0xac18e98664e160305cdb77e75e5eae32e55447e94ad8ceb0123729589ed09f8b"
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 60,
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	testTxnContext := &testTxnContext{ctx: ctx}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	testRPC := &testRPC{
+		ethSendTransactionResult: txHash,
+	}
+	txnProcessor.Init(testRPC)
+
+	startTime := time.Now()
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+	assert.Less(time.Since(startTime).Seconds(), 30.0)
+	assert.Equal(1, len(testTxnContext.errorReplies))
+	assert.Equal(408, testTxnContext.errorReplies[0].status)
+	assert.Equal(txHash, testTxnContext.errorReplies[0].txHash)
+	assert.Regexp("Stopped waiting for transaction receipt, as the request was cancelled or reached its deadline: context deadline exceeded", testTxnContext.errorReplies[0].err.Error())
+	assert.Equal("eth_sendTransaction", testRPC.calls[0])
+}
+
 func TestOnSendTransactionMessageTxnTimeout(t *testing.T) {
 	assert := assert.New(t)
 
 	txHash := "0xac18e98664e160305cdb77e75e5eae32e55447e94ad8ceb0123729589ed09f8b"
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodSendTxnJSON
 	testRPC := &testRPC{
@@ -712,12 +809,40 @@ func TestOnSendTransactionMessageTxnTimeout(t *testing.T) {
 
 }
 
+func TestOnSendTransactionMessageBlockReceipts(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		BlockReceipts: BlockReceiptsConf{
+			Enabled:           true,
+			PollingIntervalMS: 1,
+		},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	testRPC := goodMessageRPC()
+	blockReceipt := testRPC.ethGetTransactionReceiptResult
+	testRPC.ethGetTransactionReceiptResult = eth.TxnReceipt{} // not mined when checked directly
+	testRPC.ethBlockNumberResult = 12345
+	testRPC.ethGetBlockReceiptsResult = []*eth.TxnReceipt{&blockReceipt}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.replies) == 0 && len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(testTxnContext.errorReplies)
+	assert.Equal(messages.MsgTypeTransactionSuccess, testTxnContext.replies[0].ReplyHeaders().MsgType)
+	assert.Equal([]string{"eth_sendTransaction", "eth_getTransactionReceipt", "eth_blockNumber", "eth_getBlockReceipts"}, testRPC.calls[0:4])
+}
+
 func TestOnSendTransactionMessageFailedTxn(t *testing.T) {
 	assert := assert.New(t)
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodSendTxnJSON
 	testRPC := &testRPC{
@@ -742,7 +867,7 @@ func TestOnSendTransactionMessageFailedWithGapFillOK(t *testing.T) {
 		SendConcurrency:   10,
 		AlwaysManageNonce: true,
 		AttemptGapFill:    true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testRPC := goodMessageRPC()
 	testRPC.ethSendTransactionErr = fmt.Errorf("pop")
 	testRPC.ethSendTransactionErrOnce = true
@@ -765,17 +890,24 @@ func TestOnSendTransactionMessageFailedWithGapFillOK(t *testing.T) {
 		time.Sleep(1 * time.Millisecond)
 	}
 
+	// Number 2 is queued behind number 1 for the same address
+	for len(testRPC.calls) < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Equal(1, txnProcessor.sendQueues.queued(from))
+	assert.EqualValues([]string{"eth_getTransactionCount", "eth_sendTransaction"}, testRPC.calls)
+
 	// Let number 1 go first
 	testRPC.ethSendTransactionFirstCond.L.Lock()
 	testRPC.ethSendTransactionFirstReady = true
 	testRPC.ethSendTransactionFirstCond.Broadcast()
 	testRPC.ethSendTransactionFirstCond.L.Unlock()
 
-	// Wait for the gap-fill
-	for len(testRPC.calls) < 4 {
+	// Wait for the gap-fill, which is submitted before number 2
+	for len(testRPC.calls) < 3 {
 		time.Sleep(1 * time.Millisecond)
 	}
-	assert.EqualValues([]string{"eth_getTransactionCount", "eth_sendTransaction", "eth_sendTransaction", "eth_sendTransaction"}, testRPC.calls)
+	assert.EqualValues([]string{"eth_getTransactionCount", "eth_sendTransaction", "eth_sendTransaction"}, testRPC.calls)
 
 	// Let number 2 go second
 	testRPC.ethSendTransactionCond.L.Lock()
@@ -802,7 +934,7 @@ func TestOnSendTransactionMessageFailedWithGapFillFail(t *testing.T) {
 		SendConcurrency:   10,
 		AlwaysManageNonce: true,
 		AttemptGapFill:    true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testRPC := goodMessageRPC()
 	testRPC.ethSendTransactionErr = fmt.Errorf("pop")
 	testRPC.ethSendTransactionErrOnce = false
@@ -825,17 +957,24 @@ func TestOnSendTransactionMessageFailedWithGapFillFail(t *testing.T) {
 		time.Sleep(1 * time.Millisecond)
 	}
 
+	// Number 2 is queued behind number 1 for the same address
+	for len(testRPC.calls) < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Equal(1, txnProcessor.sendQueues.queued(from))
+	assert.EqualValues([]string{"eth_getTransactionCount", "eth_sendTransaction"}, testRPC.calls)
+
 	// Let number 1 go first
 	testRPC.ethSendTransactionFirstCond.L.Lock()
 	testRPC.ethSendTransactionFirstReady = true
 	testRPC.ethSendTransactionFirstCond.Broadcast()
 	testRPC.ethSendTransactionFirstCond.L.Unlock()
 
-	// Wait for the gap-fill
-	for len(testRPC.calls) < 4 {
+	// Wait for the gap-fill, which is submitted before number 2
+	for len(testRPC.calls) < 3 {
 		time.Sleep(1 * time.Millisecond)
 	}
-	assert.EqualValues([]string{"eth_getTransactionCount", "eth_sendTransaction", "eth_sendTransaction", "eth_sendTransaction"}, testRPC.calls)
+	assert.EqualValues([]string{"eth_getTransactionCount", "eth_sendTransaction", "eth_sendTransaction"}, testRPC.calls)
 
 	// Let number 2 go second
 	testRPC.ethSendTransactionCond.L.Lock()
@@ -859,7 +998,7 @@ func TestOnSendTransactionMessageFailedToGetNonce(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.conf.AlwaysManageNonce = true
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
@@ -886,7 +1025,7 @@ func TestOnSendTransactionMessageInflightNonce(t *testing.T) {
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime:     1,
 		AlwaysManageNonce: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{}
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight = []*inflightTxn{{nonce: 100}, {nonce: 101}}
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].highestNonce = 101
@@ -917,7 +1056,7 @@ func TestOnSendTransactionMessageFailedToEstimateGas(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.conf.AlwaysManageNonce = true
 	testRPC := goodMessageRPC()
 	testRPC.ethSendTransactionFirstCond = sync.NewCond(&testRPC.condLock)
@@ -961,7 +1100,7 @@ func TestOnSendTransactionMessageOrionNoPrivacyGroup(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		OrionPrivateAPIS: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"SendTransaction\"}," +
@@ -991,7 +1130,7 @@ func TestOnSendTransactionMessageOrionCannotUsePrivacyGroupIdAndPrivateFor(t *te
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		OrionPrivateAPIS: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = "{" +
 		"  \"headers\":{\"type\": \"SendTransaction\"}," +
@@ -1018,7 +1157,7 @@ func TestOnSendTransactionMessageOrionFailNonce(t *testing.T) {
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime:    1,
 		OrionPrivateAPIS: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{}
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight = []*inflightTxn{{nonce: 100}, {nonce: 101}}
 	testTxnContext := &testTxnContext{}
@@ -1056,7 +1195,7 @@ func TestOnSendTransactionMessageOrion(t *testing.T) {
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime:    1,
 		OrionPrivateAPIS: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{}
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight = []*inflightTxn{{nonce: 100}, {nonce: 101}}
 	testTxnContext := &testTxnContext{}
@@ -1093,7 +1232,7 @@ func TestOnSendTransactionMessageOrionPrivacyGroupId(t *testing.T) {
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime:    1,
 		OrionPrivateAPIS: true,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{}
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight = []*inflightTxn{{nonce: 100}, {nonce: 101}}
 	testTxnContext := &testTxnContext{}
@@ -1155,7 +1294,7 @@ func TestOnSendTransactionAddressBook(t *testing.T) {
 		RPC: eth.RPCConnOpts{
 			URL: server.URL,
 		},
-	}).(*txnProcessor)
+	}, &eth.SolcConf{}).(*txnProcessor)
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{}
 	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"].txnsInFlight =
 		[]*inflightTxn{{nonce: 100}, {nonce: 101}}
@@ -1187,7 +1326,7 @@ func TestOnDeployContractMessageFailAddressLookup(t *testing.T) {
 		AddressBookConf: AddressBookConf{
 			AddressbookURLPrefix: "   ",
 		},
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodDeployTxnJSON
 
@@ -1209,7 +1348,7 @@ func TestOnDeployContractMessageFailHDWalletMissing(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodHDWalletDeployTxnJSON
 
@@ -1232,7 +1371,7 @@ func TestOnDeployContractMessageFailHDWalletFail(t *testing.T) {
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
 		HDWalletConf:  HDWalletConf{URLTemplate: "   "},
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testTxnContext := &testTxnContext{}
 	testTxnContext.jsonMsg = goodHDWalletDeployTxnJSON
 
@@ -1254,7 +1393,7 @@ func TestResolveAddressNonHDWallet(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testRPC := goodMessageRPC()
 	txnProcessor.Init(testRPC)
 
@@ -1283,7 +1422,7 @@ func TestResolveAddressHDWalletSuccess(t *testing.T) {
 		HDWalletConf: HDWalletConf{
 			URLTemplate: svr.URL,
 		},
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 	testRPC := goodMessageRPC()
 	txnProcessor.Init(testRPC)
 
@@ -1297,8 +1436,92 @@ func TestResolveAddressHDWalletFail(t *testing.T) {
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
 		MaxTXWaitTime: 1,
-	}, &eth.RPCConf{}).(*txnProcessor)
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
 
 	_, err := txnProcessor.ResolveAddress("hd-testinst-testwallet-1234")
 	assert.Regexp("No HD Wallet Configuration", err)
 }
+
+func TestOnSendTransactionMessageEstimatedGasInReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:      1,
+		HexValuesInReceipt: true,
+		GasEstimate:        eth.GasEstimateConf{Factor: 1.5},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSONWithoutGas
+
+	testRPC := goodMessageRPC()
+	testRPC.ethEstimateGasResult = 1000
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+	assert.Equal(0, len(testTxnContext.errorReplies))
+
+	assert.Equal("eth_estimateGas", testRPC.calls[0])
+	assert.Equal("eth_sendTransaction", testRPC.calls[1])
+
+	replyMsgBytes, _ := json.Marshal(testTxnContext.replies[0])
+	var replyMsgMap map[string]interface{}
+	json.Unmarshal(replyMsgBytes, &replyMsgMap)
+	assert.Equal("1000", replyMsgMap["estimatedGas"])
+	assert.Equal("0x3e8", replyMsgMap["estimatedGasHex"])
+}
+
+func TestOnSendTransactionMessageEstimatedGasOverMax(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		GasEstimate: eth.GasEstimateConf{MaxGas: 500},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSONWithoutGas
+
+	testRPC := goodMessageRPC()
+	testRPC.ethEstimateGasResult = 1000
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Equal(1, len(testTxnContext.errorReplies))
+	assert.Regexp("Estimated gas 1000 exceeds the maximum of 500", testTxnContext.errorReplies[0].err)
+	assert.NotContains(testRPC.calls, "eth_sendTransaction")
+}
+
+type testRPCBreaker struct {
+	testRPC
+	err error
+}
+
+func (b *testRPCBreaker) Check() error                         { return b.err }
+func (b *testRPCBreaker) WaitClosed(ctx context.Context) error { return nil }
+func (b *testRPCBreaker) State() *eth.RPCBreakerState          { return &eth.RPCBreakerState{} }
+
+func TestOnMessageRPCCircuitBreakerOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	breaker := &testRPCBreaker{err: fmt.Errorf("circuit breaker is open")}
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	txnProcessor.Init(breaker)
+	assert.Equal(breaker, txnProcessor.rpcBreaker)
+	sink := &testLifecycleSink{}
+	txnProcessor.AddLifecycleSink(sink)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(testTxnContext)
+
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(1, len(testTxnContext.errorReplies))
+	assert.Equal(503, testTxnContext.errorReplies[0].status)
+	assert.Regexp("circuit breaker is open", testTxnContext.errorReplies[0].err)
+	events := sink.waitFor(LifecycleFailed)
+	assert.Regexp("circuit breaker is open", events[len(events)-1].Error)
+	assert.Empty(txnProcessor.inflightTxns)
+}
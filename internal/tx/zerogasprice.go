@@ -0,0 +1,89 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/errors"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ZeroGasPriceOverride sends transactions submitted with fees with a gas price of zero instead
+	ZeroGasPriceOverride = "override"
+	// ZeroGasPriceReject rejects transactions submitted with fees
+	ZeroGasPriceReject = "reject"
+)
+
+// ZeroGasPriceConf configures the profile for permissioned chains that only accept transactions
+// with a gas price of zero. Fees submitted with a transaction are overridden, or the transaction
+// rejected, and no fee estimation is done - the node is never asked for a gas price, dynamic fees
+// are not used, and transactions are not resent with higher fees
+type ZeroGasPriceConf struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+func (p *txnProcessor) zeroGasPrice() bool {
+	return p.conf.ZeroGasPrice.Enabled
+}
+
+// applyZeroGasPrice enforces a gas price of zero on a transaction before it is assigned a nonce
+func (p *txnProcessor) applyZeroGasPrice(msg *messages.TransactionCommon) error {
+	if !p.zeroGasPrice() {
+		return nil
+	}
+	policy := p.conf.ZeroGasPrice.Policy
+	if policy == "" {
+		policy = ZeroGasPriceOverride
+	}
+	if policy != ZeroGasPriceOverride && policy != ZeroGasPriceReject {
+		return errors.Errorf(errors.ZeroGasPriceBadPolicy, policy)
+	}
+	fees := []struct {
+		name  string
+		value json.Number
+	}{
+		{"gasPrice", msg.GasPrice},
+		{"maxFeePerGas", msg.MaxFeePerGas},
+		{"maxPriorityFeePerGas", msg.MaxPriorityFeePerGas},
+	}
+	for _, fee := range fees {
+		if isZeroFee(fee.value) {
+			continue
+		}
+		if policy == ZeroGasPriceReject {
+			return errors.Errorf(errors.ZeroGasPriceRejected, fee.name, fee.value)
+		}
+		log.Warnf("Overriding %s=%s with a gas price of zero", fee.name, fee.value)
+	}
+	msg.GasPrice = json.Number("0")
+	msg.MaxFeePerGas = ""
+	msg.MaxPriorityFeePerGas = ""
+	return nil
+}
+
+// isZeroFee checks whether a fee is unset, or zero. A fee that is not a valid number is not
+// zero, so it is rejected or overridden rather than failing later when the transaction is built
+func isZeroFee(fee json.Number) bool {
+	if fee == "" {
+		return true
+	}
+	value, ok := new(big.Int).SetString(fee.String(), 10)
+	return ok && value.Sign() == 0
+}
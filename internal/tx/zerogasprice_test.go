@@ -0,0 +1,142 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/firefly-ethconnect/internal/eth"
+	"github.com/hyperledger/firefly-ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+var zeroGasPriceSendTxnJSON = "{" +
+	"  \"headers\":{\"type\": \"SendTransaction\"}," +
+	"  \"from\":\"" + testFromAddr + "\"," +
+	"  \"gas\":\"123\"," +
+	"  \"gasPrice\":\"1000\"," +
+	"  \"method\":{\"name\":\"test\"}" +
+	"}"
+
+func TestApplyZeroGasPriceOverride(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{ZeroGasPrice: ZeroGasPriceConf{Enabled: true}}}
+
+	msg := &messages.TransactionCommon{GasPrice: "1000", MaxFeePerGas: "2000", MaxPriorityFeePerGas: "100"}
+	err := p.applyZeroGasPrice(msg)
+	assert.NoError(err)
+	assert.Equal("0", msg.GasPrice.String())
+	assert.Empty(msg.MaxFeePerGas)
+	assert.Empty(msg.MaxPriorityFeePerGas)
+}
+
+func TestApplyZeroGasPriceReject(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{ZeroGasPrice: ZeroGasPriceConf{Enabled: true, Policy: ZeroGasPriceReject}}}
+
+	err := p.applyZeroGasPrice(&messages.TransactionCommon{MaxPriorityFeePerGas: "100"})
+	assert.Regexp("FFEC100392.*maxPriorityFeePerGas=100", err)
+
+	err = p.applyZeroGasPrice(&messages.TransactionCommon{GasPrice: "bad"})
+	assert.Regexp("FFEC100392.*gasPrice=bad", err)
+
+	msg := &messages.TransactionCommon{GasPrice: "0"}
+	err = p.applyZeroGasPrice(msg)
+	assert.NoError(err)
+	assert.Equal("0", msg.GasPrice.String())
+}
+
+func TestApplyZeroGasPriceBadPolicy(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{ZeroGasPrice: ZeroGasPriceConf{Enabled: true, Policy: "ignore"}}}
+
+	err := p.applyZeroGasPrice(&messages.TransactionCommon{})
+	assert.Regexp("FFEC100391.*'ignore'", err)
+}
+
+func TestApplyZeroGasPriceDisabled(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{}}
+
+	msg := &messages.TransactionCommon{GasPrice: "1000"}
+	err := p.applyZeroGasPrice(msg)
+	assert.NoError(err)
+	assert.Equal("1000", msg.GasPrice.String())
+}
+
+func TestOnSendTransactionMessageZeroGasPriceOverride(t *testing.T) {
+	assert := assert.New(t)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		ZeroGasPrice:  ZeroGasPriceConf{Enabled: true},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{jsonMsg: zeroGasPriceSendTxnJSON}
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.errorReplies)
+	assert.Equal("eth_sendTransaction", testRPC.calls[0])
+	assert.Equal(int64(0), testRPC.params[0][0].(*eth.SendTXArgs).GasPrice.ToInt().Int64())
+}
+
+func TestOnSendTransactionMessageZeroGasPriceReject(t *testing.T) {
+	assert := assert.New(t)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		ZeroGasPrice: ZeroGasPriceConf{Enabled: true, Policy: ZeroGasPriceReject},
+	}, &eth.RPCConf{}, &eth.SolcConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{jsonMsg: zeroGasPriceSendTxnJSON}
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.Regexp("FFEC100392.*gasPrice=1000", testTxnContext.errorReplies[0].err)
+	assert.Empty(testRPC.calls)
+	assert.Empty(txnProcessor.inflightTxns)
+}
+
+func TestZeroGasPriceNoFeeBumpOrResubmit(t *testing.T) {
+	assert := assert.New(t)
+	p := &txnProcessor{conf: &TxnProcessorConf{
+		FeeBump:      FeeBumpConf{MaxAttempts: 3},
+		Resubmit:     ResubmitConf{AfterSec: 1},
+		ZeroGasPrice: ZeroGasPriceConf{Enabled: true},
+	}, inflightTxnsLock: &sync.Mutex{}}
+
+	rpc := &feeBumpRPC{sendErrs: []error{fmt.Errorf("transaction underpriced")}}
+	err := p.sendWithFeeBump(context.Background(), &inflightTxn{rpc: rpc}, newFeeBumpTestTxn(0))
+	assert.Regexp("transaction underpriced", err)
+	assert.Equal([]int64{0}, rpc.gasPrices)
+
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, newFeeBumpTestTxn(0))
+	assert.False(p.resubmittable(inflight))
+}
+
+func TestOnSpeedUpTransactionMessageZeroGasPrice(t *testing.T) {
+	assert := assert.New(t)
+	inflight := newSpeedUpTestInflight(&speedUpRPC{}, newFeeBumpTestTxn(0))
+	p := newSpeedUpTestProcessor(inflight)
+	p.conf.ZeroGasPrice.Enabled = true
+
+	txnContext := &testTxnContext{jsonMsg: speedUpMsgJSON("")}
+	p.OnMessage(txnContext)
+	assert.Equal(400, txnContext.errorReplies[0].status)
+	assert.Regexp("FFEC100393", txnContext.errorReplies[0].err)
+	assert.Empty(inflight.speedUps)
+}
@@ -15,28 +15,35 @@
 package ws
 
 import (
+	"context"
+	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	ws "github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/hyperledger/firefly-ethconnect/internal/utils"
 )
 
 type webSocketConnection struct {
-	id        string
-	server    *webSocketServer
-	conn      *ws.Conn
-	mux       sync.Mutex
-	closed    bool
-	topics    map[string]*webSocketTopic
-	broadcast chan interface{}
-	newTopic  chan bool
-	receive   chan error
-	closing   chan struct{}
+	id         string
+	ctx        context.Context
+	remoteAddr string
+	connected  time.Time
+	server     *webSocketServer
+	conn       *ws.Conn
+	mux        sync.Mutex
+	closed     bool
+	topics     map[string]*webSocketTopic
+	broadcast  chan interface{}
+	newTopic   chan bool
+	receive    chan error
+	closing    chan struct{}
 }
 
 type webSocketCommandMessage struct {
@@ -45,16 +52,19 @@ type webSocketCommandMessage struct {
 	Message string `json:"message,omitempty"`
 }
 
-func newConnection(server *webSocketServer, conn *ws.Conn) *webSocketConnection {
+func newConnection(server *webSocketServer, conn *ws.Conn, req *http.Request) *webSocketConnection {
 	wsc := &webSocketConnection{
-		id:        utils.UUIDv4(),
-		server:    server,
-		conn:      conn,
-		newTopic:  make(chan bool),
-		topics:    make(map[string]*webSocketTopic),
-		broadcast: make(chan interface{}),
-		receive:   make(chan error),
-		closing:   make(chan struct{}),
+		id:         utils.UUIDv4(),
+		ctx:        req.Context(),
+		remoteAddr: req.RemoteAddr,
+		connected:  time.Now().UTC(),
+		server:     server,
+		conn:       conn,
+		newTopic:   make(chan bool),
+		topics:     make(map[string]*webSocketTopic),
+		broadcast:  make(chan interface{}),
+		receive:    make(chan error),
+		closing:    make(chan struct{}),
 	}
 	go wsc.listen()
 	go wsc.sender()
@@ -114,7 +124,28 @@ func (c *webSocketConnection) sender() {
 	}
 }
 
+func (c *webSocketConnection) info() *ConnectionInfo {
+	return &ConnectionInfo{
+		ID:         c.id,
+		RemoteAddr: c.remoteAddr,
+		Connected:  c.connected.Format(time.RFC3339),
+	}
+}
+
+// sendError reports a rejected command back to the client, via the sender so we only have one writer
+func (c *webSocketConnection) sendError(topic string, err error) {
+	log.Errorf("WS/%s: %s", c.id, err)
+	select {
+	case c.broadcast <- &webSocketCommandMessage{Type: "error", Topic: topic, Message: err.Error()}:
+	case <-c.closing:
+	}
+}
+
 func (c *webSocketConnection) listenTopic(t *webSocketTopic) {
+	if err := auth.AuthWebSocketTopic(c.ctx, t.topic); err != nil {
+		c.sendError(t.topic, errors.Errorf(errors.WebSocketTopicUnauthorized, t.topic, err))
+		return
+	}
 	c.mux.Lock()
 	c.topics[t.topic] = t
 	c.server.ListenOnTopic(c, t.topic)
@@ -126,6 +157,10 @@ func (c *webSocketConnection) listenTopic(t *webSocketTopic) {
 }
 
 func (c *webSocketConnection) listenReplies() {
+	if err := auth.AuthListAsyncReplies(c.ctx); err != nil {
+		c.sendError("", err)
+		return
+	}
 	c.server.ListenForReplies(c)
 }
 
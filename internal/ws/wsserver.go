@@ -15,12 +15,15 @@
 package ws
 
 import (
+	"encoding/json"
 	"net/http"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
 	"github.com/hyperledger/firefly-ethconnect/internal/errors"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
@@ -31,6 +34,14 @@ import (
 type WebSocketChannels interface {
 	GetChannels(topic string) (chan<- interface{}, chan<- interface{}, <-chan error)
 	SendReply(message interface{})
+	Connections(topic string) []*ConnectionInfo
+}
+
+// ConnectionInfo describes a WebSocket connection that is listening on a topic
+type ConnectionInfo struct {
+	ID         string `json:"id"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Connected  string `json:"connected"`
 }
 
 // WebSocketServer is the full server interface with the init call
@@ -79,7 +90,20 @@ func NewWebSocketServer() WebSocketServer {
 	return s
 }
 
+type errMsg struct {
+	Message string `json:"error"`
+}
+
 func (s *webSocketServer) handler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// The access token has already been verified from the request, and stored in the context
+	if err := auth.AuthWebSocket(r.Context()); err != nil {
+		log.Errorf("WebSocket upgrade from %s rejected: %s", r.RemoteAddr, err)
+		b, _ := json.Marshal(&errMsg{Message: errors.Errorf(errors.WebSocketUnauthorized, err).Error()})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write(b)
+		return
+	}
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Errorf("WebSocket upgrade failed: %s", err)
@@ -87,7 +111,7 @@ func (s *webSocketServer) handler(w http.ResponseWriter, r *http.Request, p http
 	}
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	c := newConnection(s, conn)
+	c := newConnection(s, conn, r)
 	s.connections[c.id] = c
 }
 
@@ -151,13 +175,30 @@ func (s *webSocketServer) GetChannels(topic string) (chan<- interface{}, chan<-
 
 func (s *webSocketServer) ListenOnTopic(c *webSocketConnection, topic string) {
 	// Track that this connection is interested in this topic
+	s.mux.Lock()
+	defer s.mux.Unlock()
 	s.topicMap[topic][c.id] = c
 }
 
 func (s *webSocketServer) ListenForReplies(c *webSocketConnection) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
 	s.replyMap[c.id] = c
 }
 
+// Connections returns the connections currently listening on a topic, oldest first
+func (s *webSocketServer) Connections(topic string) []*ConnectionInfo {
+	s.mux.Lock()
+	wsconns := getConnListFromMap(s.topicMap[topic])
+	s.mux.Unlock()
+	sort.Slice(wsconns, func(i, j int) bool { return wsconns[i].connected.Before(wsconns[j].connected) })
+	infos := make([]*ConnectionInfo, len(wsconns))
+	for i, c := range wsconns {
+		infos[i] = c.info()
+	}
+	return infos
+}
+
 func (s *webSocketServer) SendReply(message interface{}) {
 	s.replyChannel <- message
 }
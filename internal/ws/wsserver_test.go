@@ -15,6 +15,7 @@
 package ws
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -23,6 +24,8 @@ import (
 	"time"
 
 	ws "github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-ethconnect/internal/auth"
+	"github.com/hyperledger/firefly-ethconnect/internal/auth/authtest"
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/stretchr/testify/assert"
@@ -351,3 +354,134 @@ func TestSendReply(t *testing.T) {
 	c.ReadJSON(&val)
 	assert.Equal("Hello World", val)
 }
+
+func newTestAuthWebSocketServer() (*webSocketServer, *httptest.Server) {
+	s := NewWebSocketServer().(*webSocketServer)
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx, err := auth.WithAuthContext(req.Context(), req.URL.Query().Get("access_token"))
+		if err != nil {
+			res.WriteHeader(401)
+			return
+		}
+		r.ServeHTTP(res, req.WithContext(ctx))
+	}))
+	return s, ts
+}
+
+func TestConnectUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestWebSocketSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	w, ts := newTestAuthWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	_, res, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.Error(err)
+	assert.Equal(401, res.StatusCode)
+
+	// Skip the token verification, to check the upgrade is still rejected without an auth context
+	w2, ts2 := newTestWebSocketServer()
+	defer ts2.Close()
+	u2, _ := url.Parse(ts2.URL)
+	u2.Scheme = "ws"
+	u2.Path = "/ws"
+	_, res, err = ws.DefaultDialer.Dial(u2.String(), nil)
+	assert.Error(err)
+	assert.Equal(403, res.StatusCode)
+	var errBody errMsg
+	err = json.NewDecoder(res.Body).Decode(&errBody)
+	assert.NoError(err)
+	assert.Regexp("WebSocket connection not authorized: .*No auth context", errBody.Message)
+
+	w.Close()
+	w2.Close()
+}
+
+func TestListenTopicAuthorization(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestWebSocketSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	w, ts := newTestAuthWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	u.RawQuery = "access_token=testat"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:  "listen",
+		Topic: "othertopic",
+	})
+	var errReply webSocketCommandMessage
+	err = c.ReadJSON(&errReply)
+	assert.NoError(err)
+	assert.Equal("error", errReply.Type)
+	assert.Equal("othertopic", errReply.Topic)
+	assert.Regexp("Not authorized to listen on WebSocket topic 'othertopic': badness", errReply.Message)
+	assert.Empty(w.Connections("othertopic"))
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:  "listen",
+		Topic: "testtopic",
+	})
+	s, _, _ := w.GetChannels("testtopic")
+	s <- "Hello World"
+
+	var val string
+	c.ReadJSON(&val)
+	assert.Equal("Hello World", val)
+
+	conns := w.Connections("testtopic")
+	assert.Equal(1, len(conns))
+	assert.Regexp("127.0.0.1", conns[0].RemoteAddr)
+	assert.NotEmpty(conns[0].ID)
+	assert.NotEmpty(conns[0].Connected)
+
+	c.Close()
+	for len(w.connections) > 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(w.Connections("testtopic"))
+	w.Close()
+}
+
+func TestListenRepliesUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	// Register the module after the upgrade, so the connection has no auth context
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type: "listenReplies",
+	})
+	var errReply webSocketCommandMessage
+	err = c.ReadJSON(&errReply)
+	assert.NoError(err)
+	assert.Equal("error", errReply.Type)
+	assert.Regexp("No auth context", errReply.Message)
+	assert.Empty(w.replyMap)
+
+	w.Close()
+}
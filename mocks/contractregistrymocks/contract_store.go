@@ -3,6 +3,8 @@
 package contractregistrymocks
 
 import (
+	big "math/big"
+
 	contractregistry "github.com/hyperledger/firefly-ethconnect/internal/contractregistry"
 	messages "github.com/hyperledger/firefly-ethconnect/internal/messages"
 
@@ -17,7 +19,7 @@ type ContractStore struct {
 }
 
 // AddABI provides a mock function with given fields: id, deployMsg, createdTime
-func (_m *ContractStore) AddABI(id string, deployMsg *messages.DeployContract, createdTime time.Time) *contractregistry.ABIInfo {
+func (_m *ContractStore) AddABI(id string, deployMsg *messages.DeployContract, createdTime time.Time) (*contractregistry.ABIInfo, error) {
 	ret := _m.Called(id, deployMsg, createdTime)
 
 	var r0 *contractregistry.ABIInfo
@@ -29,16 +31,23 @@ func (_m *ContractStore) AddABI(id string, deployMsg *messages.DeployContract, c
 		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *messages.DeployContract, time.Time) error); ok {
+		r1 = rf(id, deployMsg, createdTime)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// AddContract provides a mock function with given fields: addrHexNo0x, abiID, pathName, registerAs
-func (_m *ContractStore) AddContract(addrHexNo0x string, abiID string, pathName string, registerAs string) (*contractregistry.ContractInfo, error) {
-	ret := _m.Called(addrHexNo0x, abiID, pathName, registerAs)
+// AddContract provides a mock function with given fields: addrHexNo0x, abiID, pathName, registerAs, opts
+func (_m *ContractStore) AddContract(addrHexNo0x string, abiID string, pathName string, registerAs string, opts *contractregistry.RegistrationOptions) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, abiID, pathName, registerAs, opts)
 
 	var r0 *contractregistry.ContractInfo
-	if rf, ok := ret.Get(0).(func(string, string, string, string) *contractregistry.ContractInfo); ok {
-		r0 = rf(addrHexNo0x, abiID, pathName, registerAs)
+	if rf, ok := ret.Get(0).(func(string, string, string, string, *contractregistry.RegistrationOptions) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, abiID, pathName, registerAs, opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*contractregistry.ContractInfo)
@@ -46,8 +55,31 @@ func (_m *ContractStore) AddContract(addrHexNo0x string, abiID string, pathName
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, string, string, string) error); ok {
-		r1 = rf(addrHexNo0x, abiID, pathName, registerAs)
+	if rf, ok := ret.Get(1).(func(string, string, string, string, *contractregistry.RegistrationOptions) error); ok {
+		r1 = rf(addrHexNo0x, abiID, pathName, registerAs, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddFacet provides a mock function with given fields: addrHexNo0x, abiID
+func (_m *ContractStore) AddFacet(addrHexNo0x string, abiID string) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, abiID)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string, string) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, abiID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(addrHexNo0x, abiID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -88,6 +120,52 @@ func (_m *ContractStore) Close() {
 	_m.Called()
 }
 
+// DeleteABI provides a mock function with given fields: abiID
+func (_m *ContractStore) DeleteABI(abiID string) (*contractregistry.ABIInfo, error) {
+	ret := _m.Called(abiID)
+
+	var r0 *contractregistry.ABIInfo
+	if rf, ok := ret.Get(0).(func(string) *contractregistry.ABIInfo); ok {
+		r0 = rf(abiID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ABIInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(abiID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteContract provides a mock function with given fields: addrHexOrName
+func (_m *ContractStore) DeleteContract(addrHexOrName string) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexOrName)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexOrName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(addrHexOrName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetABI provides a mock function with given fields: location, refresh
 func (_m *ContractStore) GetABI(location contractregistry.ABILocation, refresh bool) (*contractregistry.DeployContractWithAddress, error) {
 	ret := _m.Called(location, refresh)
@@ -171,36 +249,87 @@ func (_m *ContractStore) Init() error {
 	return r0
 }
 
-// ListABIs provides a mock function with given fields:
-func (_m *ContractStore) ListABIs() []messages.TimeSortable {
-	ret := _m.Called()
+// ListABIs provides a mock function with given fields: opts
+func (_m *ContractStore) ListABIs(opts *contractregistry.ListOptions) ([]messages.TimeSortable, int, error) {
+	ret := _m.Called(opts)
 
 	var r0 []messages.TimeSortable
-	if rf, ok := ret.Get(0).(func() []messages.TimeSortable); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(*contractregistry.ListOptions) []messages.TimeSortable); ok {
+		r0 = rf(opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]messages.TimeSortable)
 		}
 	}
 
-	return r0
+	var r1 int
+	if rf, ok := ret.Get(1).(func(*contractregistry.ListOptions) int); ok {
+		r1 = rf(opts)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(*contractregistry.ListOptions) error); ok {
+		r2 = rf(opts)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
-// ListContracts provides a mock function with given fields:
-func (_m *ContractStore) ListContracts() []messages.TimeSortable {
-	ret := _m.Called()
+// ListContracts provides a mock function with given fields: opts
+func (_m *ContractStore) ListContracts(opts *contractregistry.ListOptions) ([]messages.TimeSortable, int, error) {
+	ret := _m.Called(opts)
 
 	var r0 []messages.TimeSortable
-	if rf, ok := ret.Get(0).(func() []messages.TimeSortable); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(*contractregistry.ListOptions) []messages.TimeSortable); ok {
+		r0 = rf(opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]messages.TimeSortable)
 		}
 	}
 
-	return r0
+	var r1 int
+	if rf, ok := ret.Get(1).(func(*contractregistry.ListOptions) int); ok {
+		r1 = rf(opts)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(*contractregistry.ListOptions) error); ok {
+		r2 = rf(opts)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ListProjects provides a mock function with given fields:
+func (_m *ContractStore) ListProjects() ([]*contractregistry.ProjectInfo, error) {
+	ret := _m.Called()
+
+	var r0 []*contractregistry.ProjectInfo
+	if rf, ok := ret.Get(0).(func() []*contractregistry.ProjectInfo); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*contractregistry.ProjectInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // ResolveContractAddress provides a mock function with given fields: registeredName
@@ -223,3 +352,178 @@ func (_m *ContractStore) ResolveContractAddress(registeredName string) (string,
 
 	return r0, r1
 }
+
+// RemoveFacet provides a mock function with given fields: addrHexNo0x, abiID
+func (_m *ContractStore) RemoveFacet(addrHexNo0x string, abiID string) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, abiID)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string, string) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, abiID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(addrHexNo0x, abiID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreABI provides a mock function with given fields: abiID
+func (_m *ContractStore) RestoreABI(abiID string) (*contractregistry.ABIInfo, error) {
+	ret := _m.Called(abiID)
+
+	var r0 *contractregistry.ABIInfo
+	if rf, ok := ret.Get(0).(func(string) *contractregistry.ABIInfo); ok {
+		r0 = rf(abiID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ABIInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(abiID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreContract provides a mock function with given fields: addrHexOrName
+func (_m *ContractStore) RestoreContract(addrHexOrName string) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexOrName)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexOrName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(addrHexOrName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetMethodPolicy provides a mock function with given fields: addrHexNo0x, policy
+func (_m *ContractStore) SetMethodPolicy(addrHexNo0x string, policy *contractregistry.MethodPolicy) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, policy)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string, *contractregistry.MethodPolicy) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, policy)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *contractregistry.MethodPolicy) error); ok {
+		r1 = rf(addrHexNo0x, policy)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetParamDefaults provides a mock function with given fields: addrHexNo0x, defaults
+func (_m *ContractStore) SetParamDefaults(addrHexNo0x string, defaults map[string]string) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, defaults)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string, map[string]string) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, defaults)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, map[string]string) error); ok {
+		r1 = rf(addrHexNo0x, defaults)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetProject provides a mock function with given fields: addrHexNo0x, project
+func (_m *ContractStore) SetProject(addrHexNo0x string, project string) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, project)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string, string) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, project)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(addrHexNo0x, project)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StoreABI provides a mock function with given fields: id, deployMsg
+func (_m *ContractStore) StoreABI(id string, deployMsg *messages.DeployContract) error {
+	ret := _m.Called(id, deployMsg)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *messages.DeployContract) error); ok {
+		r0 = rf(id, deployMsg)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpgradeContract provides a mock function with given fields: addrHexNo0x, abiID, fromBlock
+func (_m *ContractStore) UpgradeContract(addrHexNo0x string, abiID string, fromBlock *big.Int) (*contractregistry.ContractInfo, error) {
+	ret := _m.Called(addrHexNo0x, abiID, fromBlock)
+
+	var r0 *contractregistry.ContractInfo
+	if rf, ok := ret.Get(0).(func(string, string, *big.Int) *contractregistry.ContractInfo); ok {
+		r0 = rf(addrHexNo0x, abiID, fromBlock)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*contractregistry.ContractInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *big.Int) error); ok {
+		r1 = rf(addrHexNo0x, abiID, fromBlock)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
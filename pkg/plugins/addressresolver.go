@@ -0,0 +1,27 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugins
+
+import "context"
+
+// AddressResolver is a code plug-point that can be implemented using a go plugin module, to resolve
+// identifiers supplied for parameters typed as address, such as DIDs or application-level identifiers.
+// Build your plugin with an "AddressResolver" export that implements this interface, and configure
+// the identifier scheme it resolves, with the dynamic load path of your module, in the configuration.
+type AddressResolver interface {
+
+	// ResolveAddress - resolves an identifier of the configured scheme, such as "did:web:example.com", to a 0x prefixed hex address
+	ResolveAddress(ctx context.Context, identifier string) (string, error)
+}
@@ -36,3 +36,14 @@ type SecurityModule interface {
 	// AuthReadAsyncReplyByUUID - Authorization plugpoint for getting an individual reply by UUID (containing an individual receipt/error)
 	AuthReadAsyncReplyByUUID(authCtx interface{}) error
 }
+
+// WebSocketSecurityModule can optionally be implemented by a SecurityModule, to authorize WebSocket connections
+// and the topics they listen on. For modules that do not implement it, any authenticated connection can be upgraded,
+// and listening on a topic is authorized by AuthEventStreams.
+type WebSocketSecurityModule interface {
+
+	// AuthWebSocket - Authorization plugpoint for upgrading an HTTP connection to a WebSocket
+	AuthWebSocket(authCtx interface{}) error
+	// AuthWebSocketTopic - Authorization plugpoint for a WebSocket connection listening on a topic
+	AuthWebSocketTopic(authCtx interface{}, topic string) error
+}